@@ -10,6 +10,10 @@ fi
 
 if [ ${TESTMODE} == "unit" ]; then
   ginkgo -r -v -cover -randomizeAllSpecs -randomizeSuites -trace -skipPackage integrationtests,benchmark
+  # run the unit tests again with the additional consistency checks enabled
+  ginkgo -tags debug -randomizeAllSpecs -trace .
+  # run the unit tests again with the error injection and test hooks enabled
+  ginkgo -tags internal_test -randomizeAllSpecs -trace . internal/ackhandler
 fi
 
 if [ ${TESTMODE} == "integration" ]; then
@@ -20,6 +24,8 @@ if [ ${TESTMODE} == "integration" ]; then
   if [ ${TRAVIS_GOARCH} == 'amd64' ]; then
     ginkgo -race -randomizeAllSpecs -randomizeSuites -trace benchmark -- -samples=1 -size=10
   fi
+  # run the Go benchmarks once, to make sure they keep working
+  go test -run=NONE -bench=. -benchtime=1x . ./benchmark
   # run integration tests
   ginkgo -r -v -randomizeAllSpecs -randomizeSuites -trace integrationtests
 fi
@@ -0,0 +1,68 @@
+package quic
+
+import (
+	"crypto/tls"
+	"errors"
+
+	"github.com/lucas-clemente/quic-go/internal/qerr"
+)
+
+// QUIC requires the use of ALPN to negotiate the application protocol.
+// Both the client and the server need to set tls.Config.NextProtos,
+// and the handshake fails if they don't support a common application protocol.
+
+var (
+	errNoNextProtosClient = errors.New("quic: NextProtos not set in tls.Config")
+	errNoNextProtosServer = errors.New("quic: NextProtos not set in tls.Config, and no GetConfigForClient callback set")
+)
+
+// An ALPNError is returned by Dial when the handshake failed
+// because the client and the server don't support a common application protocol.
+type ALPNError struct {
+	// Protocols are the application protocols offered by the client (tls.Config.NextProtos).
+	Protocols []string
+
+	err *CryptoError
+}
+
+var _ error = &ALPNError{}
+
+func (e *ALPNError) Error() string {
+	return e.err.Error()
+}
+
+// toALPNError converts an error caused by a failure to negotiate the application protocol to an ALPNError.
+// All other errors are returned unchanged.
+func toALPNError(err error, protocols []string) error {
+	cryptoErr, ok := err.(*CryptoError)
+	if !ok || cryptoErr.err.ErrorCode != qerr.NoApplicationProtocol {
+		return err
+	}
+	return &ALPNError{Protocols: protocols, err: cryptoErr}
+}
+
+func validateNextProtosClient(tlsConf *tls.Config) error {
+	if tlsConf == nil || len(tlsConf.NextProtos) == 0 {
+		return errNoNextProtosClient
+	}
+	return nil
+}
+
+// validateNextProtosServer checks that the server is configured to negotiate an application protocol.
+// If GetConfigForClient is set, the application protocols might be selected per client.
+// In that case, the check is deferred to the handshake.
+func validateNextProtosServer(tlsConf *tls.Config) error {
+	if len(tlsConf.NextProtos) == 0 && tlsConf.GetConfigForClient == nil {
+		return errNoNextProtosServer
+	}
+	return nil
+}
+
+// AcceptWithProtocol returns new sessions, together with the negotiated application protocol.
+func (s *server) AcceptWithProtocol() (Session, string, error) {
+	sess, err := s.Accept()
+	if err != nil {
+		return nil, "", err
+	}
+	return sess, sess.ConnectionState().NegotiatedProtocol, nil
+}
@@ -1,8 +1,11 @@
 package benchmark
 
 import (
+	"crypto/tls"
 	"flag"
 
+	"github.com/lucas-clemente/quic-go/internal/testdata"
+
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 
@@ -14,6 +17,19 @@ func TestBenchmark(t *testing.T) {
 	RunSpecs(t, "Benchmark Suite")
 }
 
+// the application protocol negotiated using ALPN
+const alpn = "quic-go benchmark"
+
+func getTLSConfig() *tls.Config {
+	conf := testdata.GetTLSConfig()
+	conf.NextProtos = []string{alpn}
+	return conf
+}
+
+func getTLSClientConfig() *tls.Config {
+	return &tls.Config{InsecureSkipVerify: true, NextProtos: []string{alpn}}
+}
+
 var (
 	size    int // file size in MB, will be read from flags
 	samples int // number of samples for Measure, will be read from flags
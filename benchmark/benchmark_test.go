@@ -2,7 +2,6 @@ package benchmark
 
 import (
 	"bytes"
-	"crypto/tls"
 	"fmt"
 	"io"
 	"math/rand"
@@ -11,7 +10,6 @@ import (
 	quic "github.com/lucas-clemente/quic-go"
 	_ "github.com/lucas-clemente/quic-go/integrationtests/tools/testlog"
 	"github.com/lucas-clemente/quic-go/internal/protocol"
-	"github.com/lucas-clemente/quic-go/internal/testdata"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 )
@@ -37,7 +35,7 @@ func init() {
 						var err error
 						ln, err = quic.ListenAddr(
 							"localhost:0",
-							testdata.GetTLSConfig(),
+							getTLSConfig(),
 							&quic.Config{Versions: []protocol.VersionNumber{version}},
 						)
 						Expect(err).ToNot(HaveOccurred())
@@ -59,7 +57,7 @@ func init() {
 					addr := <-serverAddr
 					sess, err := quic.DialAddr(
 						addr.String(),
-						&tls.Config{InsecureSkipVerify: true},
+						getTLSClientConfig(),
 						&quic.Config{Versions: []protocol.VersionNumber{version}},
 					)
 					Expect(err).ToNot(HaveOccurred())
@@ -0,0 +1,146 @@
+package benchmark
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"sort"
+	"time"
+
+	quic "github.com/lucas-clemente/quic-go"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+const (
+	roleBulk = 'b'
+	roleEcho = 'e'
+)
+
+func init() {
+	var _ = Describe("Burst limiting", func() {
+		dataLen := size * /* MB */ 1e6
+		data := make([]byte, dataLen)
+		rand.Seed(GinkgoRandomSeed())
+		rand.Read(data) // no need to check for an error. math.Rand.Read never errors
+
+		// runServer runs a server that handles two kinds of streams, depending on the first byte:
+		// On bulk streams, it sends the data and closes the stream.
+		// On echo streams, it echoes everything it receives.
+		runServer := func(conf *quic.Config) quic.Listener {
+			ln, err := quic.ListenAddr("localhost:0", getTLSConfig(), conf)
+			Expect(err).ToNot(HaveOccurred())
+			go func() {
+				defer GinkgoRecover()
+				for {
+					sess, err := ln.Accept()
+					if err != nil {
+						return
+					}
+					go func() {
+						defer GinkgoRecover()
+						str, err := sess.AcceptStream()
+						if err != nil {
+							return
+						}
+						role := make([]byte, 1)
+						if _, err := io.ReadFull(str, role); err != nil {
+							return
+						}
+						switch role[0] {
+						case roleBulk:
+							str.Write(data)
+							str.Close()
+						case roleEcho:
+							io.Copy(str, str)
+						}
+					}()
+				}
+			}()
+			return ln
+		}
+
+		openStream := func(ln quic.Listener, role byte) (quic.Session, quic.Stream) {
+			sess, err := quic.DialAddr(ln.Addr().String(), getTLSClientConfig(), nil)
+			Expect(err).ToNot(HaveOccurred())
+			str, err := sess.OpenStreamSync()
+			Expect(err).ToNot(HaveOccurred())
+			_, err = str.Write([]byte{role})
+			Expect(err).ToNot(HaveOccurred())
+			return sess, str
+		}
+
+		// percentile returns the p-th percentile of the (sorted) durations
+		percentile := func(durations []time.Duration, p int) time.Duration {
+			return durations[(len(durations)-1)*p/100]
+		}
+
+		for _, c := range []struct {
+			name            string
+			maxBurstPackets int
+		}{
+			{name: "without burst limit", maxBurstPackets: 1 << 20},
+			{name: "with the default burst limit", maxBurstPackets: 0},
+		} {
+			maxBurstPackets := c.maxBurstPackets
+			// The percentiles of a single sample are dominated by a few outliers.
+			// Collect the latencies of all samples, and report the percentiles after the last sample.
+			var allLatencies []time.Duration
+			var numSamples int
+
+			Measure(fmt.Sprintf("latency of a competing connection while transferring a %d MB file, %s", size, c.name), func(b Benchmarker) {
+				ln := runServer(&quic.Config{MaxBurstPackets: maxBurstPackets})
+				defer ln.Close()
+
+				echoSess, echoStr := openStream(ln, roleEcho)
+				defer echoSess.Close()
+				bulkSess, bulkStr := openStream(ln, roleBulk)
+				defer bulkSess.Close()
+
+				transferDone := make(chan struct{})
+				go func() {
+					defer GinkgoRecover()
+					defer close(transferDone)
+					n, err := io.Copy(ioutil.Discard, bulkStr)
+					Expect(err).ToNot(HaveOccurred())
+					Expect(n).To(BeEquivalentTo(dataLen))
+				}()
+
+				// send small messages on the other connection for as long as the transfer is running
+				var latencies []time.Duration
+				msg := make([]byte, 1)
+			measureLoop:
+				for {
+					select {
+					case <-transferDone:
+						break measureLoop
+					default:
+					}
+					start := time.Now()
+					_, err := echoStr.Write(msg)
+					Expect(err).ToNot(HaveOccurred())
+					_, err = io.ReadFull(echoStr, msg)
+					Expect(err).ToNot(HaveOccurred())
+					latencies = append(latencies, time.Since(start))
+					time.Sleep(time.Millisecond)
+				}
+				Expect(latencies).ToNot(BeEmpty())
+				sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+
+				b.RecordValue("median latency [ms]", float64(percentile(latencies, 50))/float64(time.Millisecond))
+				b.RecordValue("P99 latency [ms]", float64(percentile(latencies, 99))/float64(time.Millisecond))
+
+				allLatencies = append(allLatencies, latencies...)
+				numSamples++
+				if numSamples == samples {
+					sort.Slice(allLatencies, func(i, j int) bool { return allLatencies[i] < allLatencies[j] })
+					for _, p := range []int{50, 90, 99} {
+						b.RecordValue(fmt.Sprintf("P%d latency over all samples [ms]", p), float64(percentile(allLatencies, p))/float64(time.Millisecond))
+					}
+					b.RecordValue("number of round trips", float64(len(allLatencies)))
+				}
+			}, samples)
+		}
+	})
+}
@@ -0,0 +1,137 @@
+package benchmark
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"math/rand"
+	"runtime"
+	"testing"
+	"time"
+
+	quic "github.com/lucas-clemente/quic-go"
+)
+
+// the amount of data sent on every stream
+const multiplexStreamDataLen = 1 << 20 // 1 MB
+
+// BenchmarkStreamMultiplex sends 1 MB on every one of a number of unidirectional streams,
+// which are all opened at the same time on a single connection over loopback.
+// The throughput is the total amount of data transferred.
+// In addition, it logs the fairness between the streams (as the coefficient of variation of the times
+// it took to receive the streams), as well as the maximum number of goroutines during the transfer.
+func BenchmarkStreamMultiplex(b *testing.B) {
+	for _, n := range []int{1, 10, 100, 1000} {
+		numStreams := n
+		b.Run(fmt.Sprintf("streams=%d", numStreams), func(b *testing.B) {
+			benchmarkStreamMultiplex(b, numStreams)
+		})
+	}
+}
+
+func benchmarkStreamMultiplex(b *testing.B, numStreams int) {
+	data := make([]byte, multiplexStreamDataLen)
+	rand.Read(data) // no need to check for an error. math.Rand.Read never errors
+
+	conf := &quic.Config{MaxIncomingUniStreams: numStreams}
+	ln, err := quic.ListenAddr("localhost:0", getTLSConfig(), conf)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer ln.Close()
+	serverSessChan := make(chan quic.Session, 1)
+	go func() {
+		sess, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		serverSessChan <- sess
+	}()
+	sess, err := quic.DialAddr(ln.Addr().String(), getTLSClientConfig(), conf)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer sess.Close()
+	serverSess := <-serverSessChan
+
+	type result struct {
+		duration time.Duration
+		err      error
+	}
+	durations := make([]time.Duration, 0, b.N*numStreams)
+	var maxGoroutines int
+
+	b.SetBytes(int64(numStreams * multiplexStreamDataLen))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		start := time.Now()
+		results := make(chan result, numStreams)
+		go func() {
+			for j := 0; j < numStreams; j++ {
+				str, err := serverSess.AcceptUniStream()
+				if err != nil {
+					results <- result{err: err}
+					return
+				}
+				go func() {
+					_, err := io.Copy(ioutil.Discard, str)
+					results <- result{duration: time.Since(start), err: err}
+				}()
+			}
+		}()
+		sendErrs := make(chan error, numStreams)
+		for j := 0; j < numStreams; j++ {
+			go func() {
+				str, err := sess.OpenUniStreamSync()
+				if err != nil {
+					sendErrs <- err
+					return
+				}
+				if _, err := str.Write(data); err != nil {
+					sendErrs <- err
+					return
+				}
+				sendErrs <- str.Close()
+			}()
+		}
+		for j := 0; j < numStreams; j++ {
+			res := <-results
+			if res.err != nil {
+				b.Fatal(res.err)
+			}
+			if n := runtime.NumGoroutine(); n > maxGoroutines {
+				maxGoroutines = n
+			}
+			durations = append(durations, res.duration)
+		}
+		for j := 0; j < numStreams; j++ {
+			if err := <-sendErrs; err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+	b.StopTimer()
+	b.Logf("fairness (coefficient of variation of the stream durations): %.3f, max goroutines: %d", coefficientOfVariation(durations), maxGoroutines)
+}
+
+// coefficientOfVariation calculates the ratio of the standard deviation to the mean
+func coefficientOfVariation(durations []time.Duration) float64 {
+	if len(durations) == 0 {
+		return 0
+	}
+	var sum float64
+	for _, d := range durations {
+		sum += d.Seconds()
+	}
+	mean := sum / float64(len(durations))
+	if mean == 0 {
+		return 0
+	}
+	var variance float64
+	for _, d := range durations {
+		variance += (d.Seconds() - mean) * (d.Seconds() - mean)
+	}
+	variance /= float64(len(durations))
+	return math.Sqrt(variance) / mean
+}
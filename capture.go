@@ -0,0 +1,58 @@
+package quic
+
+import (
+	"net"
+	"time"
+)
+
+// A PacketCapturer creates a ConnectionCapture for every connection.
+// PcapWriter is an implementation that writes the datagrams to a pcap file.
+type PacketCapturer interface {
+	// CaptureConnection is called when a connection is created.
+	// For the client, odcid is the destination connection ID of the first Initial packet,
+	// for the server, it is the destination connection ID of the client's Initial packet.
+	// It may return nil, in which case the datagrams of the connection are not captured.
+	CaptureConnection(isClient bool, odcid ConnectionID) ConnectionCapture
+}
+
+// A ConnectionCapture receives the raw UDP datagrams sent and received on a single connection,
+// after they were encrypted, and before they are decrypted, respectively.
+// The data passed to SentDatagram and ReceivedDatagram must not be retained:
+// it is only valid until the method returns.
+// The methods are called synchronously, so they must return quickly.
+// Implementations must be safe for concurrent use.
+// Datagrams might still be passed after Close was called, when packets arrive after the connection was closed,
+// and when the CONNECTION_CLOSE packet is retransmitted in response.
+type ConnectionCapture interface {
+	// SentDatagram is called when a datagram is sent.
+	SentDatagram(t time.Time, local, remote net.Addr, data []byte)
+	// ReceivedDatagram is called when a datagram is received.
+	ReceivedDatagram(t time.Time, local, remote net.Addr, data []byte)
+	// Close is called when the connection is closed.
+	Close()
+}
+
+// capturingConn is a connection that passes all datagrams sent to a ConnectionCapture.
+type capturingConn struct {
+	connection
+	capture ConnectionCapture
+}
+
+var _ connection = &capturingConn{}
+
+func (c *capturingConn) Write(p []byte) error {
+	c.capture.SentDatagram(time.Now(), c.LocalAddr(), c.RemoteAddr(), p)
+	return c.connection.Write(p)
+}
+
+// setupCapture sets up the capturing of the session's datagrams, if a PacketCapturer is configured.
+func (s *session) setupCapture(isClient bool, odcid ConnectionID) {
+	if s.config.PacketCapturer == nil {
+		return
+	}
+	s.capture = s.config.PacketCapturer.CaptureConnection(isClient, odcid)
+	if s.capture == nil {
+		return
+	}
+	s.conn = &capturingConn{connection: s.conn, capture: s.capture}
+}
@@ -56,6 +56,9 @@ var (
 // DialAddr establishes a new QUIC connection to a server.
 // It uses a new UDP connection and closes this connection when the QUIC session is closed.
 // The hostname for SNI is taken from the given address.
+// The tls.Config must set the application protocols offered to the server (NextProtos).
+// If the server doesn't support any of them, an ALPNError is returned.
+// If the hostname resolves to both IPv6 and IPv4 addresses, connection attempts are raced (see Config.DisableHappyEyeballs).
 func DialAddr(
 	addr string,
 	tlsConf *tls.Config,
@@ -72,9 +75,22 @@ func DialAddrContext(
 	tlsConf *tls.Config,
 	config *Config,
 ) (Session, error) {
-	udpAddr, err := net.ResolveUDPAddr("udp", addr)
-	if err != nil {
-		return nil, err
+	var udpAddr *net.UDPAddr
+	if config == nil || !config.DisableHappyEyeballs {
+		primary, fallback, err := resolveAddrHappyEyeballs(ctx, addr)
+		if err != nil {
+			return nil, err
+		}
+		if fallback != nil {
+			return dialAddrHappyEyeballs(ctx, primary, fallback, addr, tlsConf, config)
+		}
+		udpAddr = primary
+	} else {
+		var err error
+		udpAddr, err = net.ResolveUDPAddr("udp", addr)
+		if err != nil {
+			return nil, err
+		}
 	}
 	udpConn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4zero, Port: 0})
 	if err != nil {
@@ -87,6 +103,8 @@ func DialAddrContext(
 // The same PacketConn can be used for multiple calls to Dial and Listen,
 // QUIC connection IDs are used for demultiplexing the different connections.
 // The host parameter is used for SNI.
+// The tls.Config must set the application protocols offered to the server (NextProtos).
+// If the server doesn't support any of them, an ALPNError is returned.
 func Dial(
 	pconn net.PacketConn,
 	remoteAddr net.Addr,
@@ -119,7 +137,24 @@ func dialContext(
 	config *Config,
 	createdPacketConn bool,
 ) (Session, error) {
+	if err := validateNextProtosClient(tlsConf); err != nil {
+		return nil, err
+	}
+	if err := validateConnectionIDLength(config); err != nil {
+		return nil, err
+	}
+	if err := validateConnectionIDGenerator(config); err != nil {
+		return nil, err
+	}
+	if config != nil {
+		if err := handshake.ValidateCustomTransportParameters(config.CustomTransportParameters); err != nil {
+			return nil, err
+		}
+	}
 	config = populateClientConfig(config, createdPacketConn)
+	if createdPacketConn {
+		setUDPBufferSizes(pconn, config.UDPReceiveBufferSize, newLogger(config, "client"))
+	}
 	packetHandlers, err := getMultiplexer().AddConn(pconn, config.ConnectionIDLength, config.StatelessResetKey)
 	if err != nil {
 		return nil, err
@@ -130,7 +165,7 @@ func dialContext(
 	}
 	c.packetHandlers = packetHandlers
 	if err := c.dial(ctx); err != nil {
-		return nil, err
+		return nil, toALPNError(err, c.tlsConf.NextProtos)
 	}
 	return c.session, nil
 }
@@ -163,7 +198,7 @@ func newClient(
 		}
 	}
 
-	srcConnID, err := generateConnectionID(config.ConnectionIDLength)
+	srcConnID, err := newConnectionID(config.ConnectionIDGenerator)
 	if err != nil {
 		return nil, err
 	}
@@ -180,7 +215,7 @@ func newClient(
 		config:            config,
 		version:           config.Versions[0],
 		handshakeChan:     make(chan struct{}),
-		logger:            utils.DefaultLogger.WithPrefix("client"),
+		logger:            newLogger(config, "client"),
 	}
 	return c, nil
 }
@@ -204,6 +239,16 @@ func populateClientConfig(config *Config, createdPacketConn bool) *Config {
 	if config.IdleTimeout != 0 {
 		idleTimeout = config.IdleTimeout
 	}
+	idleTimeoutMultiplier := config.IdleTimeoutMultiplier
+	if idleTimeoutMultiplier == 0 {
+		idleTimeoutMultiplier = protocol.DefaultIdleTimeoutMultiplier
+	} else if idleTimeoutMultiplier < 0 {
+		idleTimeoutMultiplier = 0
+	}
+	happyEyeballsDelay := protocol.DefaultHappyEyeballsDelay
+	if config.HappyEyeballsDelay != 0 {
+		happyEyeballsDelay = config.HappyEyeballsDelay
+	}
 
 	maxReceiveStreamFlowControlWindow := config.MaxReceiveStreamFlowControlWindow
 	if maxReceiveStreamFlowControlWindow == 0 {
@@ -213,6 +258,10 @@ func populateClientConfig(config *Config, createdPacketConn bool) *Config {
 	if maxReceiveConnectionFlowControlWindow == 0 {
 		maxReceiveConnectionFlowControlWindow = protocol.DefaultMaxReceiveConnectionFlowControlWindow
 	}
+	maxConnectionSendBufferBytes := config.MaxConnectionSendBufferBytes
+	if maxConnectionSendBufferBytes == 0 {
+		maxConnectionSendBufferBytes = protocol.DefaultMaxConnectionSendBufferSize
+	}
 	maxIncomingStreams := config.MaxIncomingStreams
 	if maxIncomingStreams == 0 {
 		maxIncomingStreams = protocol.DefaultMaxIncomingStreams
@@ -225,22 +274,57 @@ func populateClientConfig(config *Config, createdPacketConn bool) *Config {
 	} else if maxIncomingUniStreams < 0 {
 		maxIncomingUniStreams = 0
 	}
+	maxBurstPackets := config.MaxBurstPackets
+	if maxBurstPackets <= 0 {
+		maxBurstPackets = protocol.DefaultMaxBurstPackets
+	}
+	connIDGenerator := config.ConnectionIDGenerator
 	connIDLen := config.ConnectionIDLength
-	if connIDLen == 0 && !createdPacketConn {
-		connIDLen = protocol.DefaultConnectionIDLength
+	if connIDGenerator != nil {
+		connIDLen = connIDGenerator.ConnectionIDLen()
+	} else {
+		if connIDLen == 0 && !createdPacketConn {
+			connIDLen = protocol.DefaultConnectionIDLength
+		}
+		connIDGenerator = &randomConnectionIDGenerator{connIDLen: connIDLen}
 	}
 
 	return &Config{
 		Versions:                              versions,
 		HandshakeTimeout:                      handshakeTimeout,
 		IdleTimeout:                           idleTimeout,
+		IdleTimeoutMultiplier:                 idleTimeoutMultiplier,
+		MinIdleTimeout:                        config.MinIdleTimeout,
+		MaxIdleTimeout:                        config.MaxIdleTimeout,
+		DisableHappyEyeballs:                  config.DisableHappyEyeballs,
+		HappyEyeballsDelay:                    happyEyeballsDelay,
+		TokenStore:                            config.TokenStore,
 		ConnectionIDLength:                    connIDLen,
+		ConnectionIDGenerator:                 connIDGenerator,
 		MaxReceiveStreamFlowControlWindow:     maxReceiveStreamFlowControlWindow,
 		MaxReceiveConnectionFlowControlWindow: maxReceiveConnectionFlowControlWindow,
+		MaxConnectionSendBufferBytes:          maxConnectionSendBufferBytes,
 		MaxIncomingStreams:                    maxIncomingStreams,
 		MaxIncomingUniStreams:                 maxIncomingUniStreams,
+		MaxBurstPackets:                       maxBurstPackets,
 		KeepAlive:                             config.KeepAlive,
+		VerifyConnection:                      config.VerifyConnection,
+		PaddingStrategy:                       config.PaddingStrategy,
+		ObfuscateStreamFingerprint:            config.ObfuscateStreamFingerprint,
+		EnableDatagrams:                       config.EnableDatagrams,
+		EnableFrameGreasing:                   config.EnableFrameGreasing,
+		CustomTransportParameters:             config.CustomTransportParameters,
+		OnCustomFrame:                         config.OnCustomFrame,
+		customFrameTypes:                      config.customFrameTypes,
+		OnReadAvailable:                       config.OnReadAvailable,
+		EventHooks:                            config.EventHooks,
+		Tracer:                                config.Tracer,
+		MetricsCollector:                      config.MetricsCollector,
+		Logger:                                config.Logger,
+		PacketCapturer:                        config.PacketCapturer,
+		testingTB:                             config.testingTB,
 		StatelessResetKey:                     config.StatelessResetKey,
+		UDPReceiveBufferSize:                  udpBufferSize(config),
 	}
 }
 
@@ -326,6 +410,9 @@ func (c *client) handleVersionNegotiationPacket(p *receivedPacket) {
 	}
 
 	c.logger.Infof("Received a Version Negotiation packet. Supported Versions: %s", hdr.SupportedVersions)
+	if c.config.MetricsCollector != nil {
+		c.config.MetricsCollector.VersionNegotiation()
+	}
 	newVersion, ok := protocol.ChooseSupportedVersion(c.config.Versions, hdr.SupportedVersions)
 	if !ok {
 		c.session.destroy(fmt.Errorf("No compatible QUIC version found. We support %s, server offered %s", c.config.Versions, hdr.SupportedVersions))
@@ -349,18 +436,23 @@ func (c *client) createNewTLSSession(version protocol.VersionNumber) error {
 		InitialMaxStreamDataBidiLocal:  protocol.InitialMaxStreamData,
 		InitialMaxStreamDataUni:        protocol.InitialMaxStreamData,
 		InitialMaxData:                 protocol.InitialMaxData,
-		IdleTimeout:                    c.config.IdleTimeout,
+		IdleTimeout:                    advertisedIdleTimeout(c.config),
 		MaxBidiStreams:                 uint64(c.config.MaxIncomingStreams),
 		MaxUniStreams:                  uint64(c.config.MaxIncomingUniStreams),
 		AckDelayExponent:               protocol.AckDelayExponent,
 		DisableMigration:               true,
+		SupportsGreaseFrames:           c.config.EnableFrameGreasing,
+		CustomParameters:               c.config.CustomTransportParameters,
+	}
+	if c.config.EnableDatagrams {
+		params.MaxDatagramFrameSize = protocol.MaxDatagramFrameSize
 	}
 
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
 	runner := &runner{
 		packetHandlerManager:    c.packetHandlers,
-		onHandshakeCompleteImpl: func(_ Session) { close(c.handshakeChan) },
+		onHandshakeCompleteImpl: func(_ quicSession) { close(c.handshakeChan) },
 	}
 	sess, err := newClientSession(
 		c.conn,
@@ -372,7 +464,7 @@ func (c *client) createNewTLSSession(version protocol.VersionNumber) error {
 		c.initialPacketNumber,
 		params,
 		c.initialVersion,
-		c.logger,
+		c.logger.WithConnection(protocol.PerspectiveClient, c.srcConnID, "odcid", c.destConnID),
 		c.version,
 	)
 	if err != nil {
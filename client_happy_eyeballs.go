@@ -0,0 +1,194 @@
+package quic
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+)
+
+// make it possible to mock name resolution in the tests
+var lookupIPAddr = net.DefaultResolver.LookupIPAddr
+
+// A responseNotifyingConn is a UDP connection that closes the responded channel as soon as the first packet is received.
+// It is used to find out if the server responded to our Initial packet.
+type responseNotifyingConn struct {
+	*net.UDPConn
+
+	once      sync.Once
+	responded chan struct{}
+}
+
+func newResponseNotifyingConn(c *net.UDPConn) *responseNotifyingConn {
+	return &responseNotifyingConn{
+		UDPConn:   c,
+		responded: make(chan struct{}),
+	}
+}
+
+func (c *responseNotifyingConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	n, addr, err := c.UDPConn.ReadFrom(b)
+	if err == nil {
+		c.once.Do(func() { close(c.responded) })
+	}
+	return n, addr, err
+}
+
+// resolveAddrHappyEyeballs resolves addr.
+// It returns the address that should be tried first (preferring IPv6),
+// and, if the host has both IPv6 and IPv4 addresses, the address of the other family.
+func resolveAddrHappyEyeballs(ctx context.Context, addr string) (*net.UDPAddr, *net.UDPAddr, error) {
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, nil, err
+	}
+	port, err := net.DefaultResolver.LookupPort(ctx, "udp", portStr)
+	if err != nil {
+		return nil, nil, err
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		return &net.UDPAddr{IP: ip, Port: port}, nil, nil
+	}
+	ips, err := lookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, nil, err
+	}
+	var ipv4, ipv6 *net.UDPAddr
+	for _, ip := range ips {
+		if ip.IP.To4() != nil {
+			if ipv4 == nil {
+				ipv4 = &net.UDPAddr{IP: ip.IP, Port: port}
+			}
+		} else if ipv6 == nil {
+			ipv6 = &net.UDPAddr{IP: ip.IP, Port: port, Zone: ip.Zone}
+		}
+	}
+	if ipv6 == nil {
+		if ipv4 == nil {
+			return nil, nil, &net.AddrError{Err: "no suitable address found", Addr: host}
+		}
+		return ipv4, nil, nil
+	}
+	if ipv4 == nil {
+		return ipv6, nil, nil
+	}
+	return ipv6, ipv4, nil
+}
+
+func listenUDPForAddr(raddr *net.UDPAddr) (*responseNotifyingConn, error) {
+	network := "udp6"
+	laddr := &net.UDPAddr{IP: net.IPv6unspecified}
+	if raddr.IP.To4() != nil {
+		network = "udp4"
+		laddr = &net.UDPAddr{IP: net.IPv4zero}
+	}
+	conn, err := net.ListenUDP(network, laddr)
+	if err != nil {
+		return nil, err
+	}
+	return newResponseNotifyingConn(conn), nil
+}
+
+// dialAddrHappyEyeballs races connection attempts to the primary and the fallback address (see RFC 8305).
+// The connection attempt to the fallback address is started if the server doesn't respond
+// to the first connection attempt within the Config.HappyEyeballsDelay, or if the first attempt fails.
+// Every attempt uses its own UDP connection, and therefore its own connection IDs.
+// The first session to complete the handshake is returned, the other attempt is aborted.
+func dialAddrHappyEyeballs(
+	ctx context.Context,
+	primary, fallback *net.UDPAddr,
+	host string,
+	tlsConf *tls.Config,
+	config *Config,
+) (Session, error) {
+	delay := protocol.DefaultHappyEyeballsDelay
+	if config != nil && config.HappyEyeballsDelay != 0 {
+		delay = config.HappyEyeballsDelay
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel() // aborts the attempt that lost the race
+
+	type dialResult struct {
+		sess Session
+		err  error
+	}
+	results := make(chan dialResult, 2)
+	dial := func(raddr *net.UDPAddr) (<-chan struct{}, error) {
+		conn, err := listenUDPForAddr(raddr)
+		if err != nil {
+			return nil, err
+		}
+		// newClient sets the ServerName on the tls.Config, so every attempt needs its own copy
+		var conf *tls.Config
+		if tlsConf != nil {
+			conf = tlsConf.Clone()
+		}
+		go func() {
+			sess, err := dialContext(ctx, conn, raddr, host, conf, config, true)
+			results <- dialResult{sess: sess, err: err}
+		}()
+		return conn.responded, nil
+	}
+
+	var firstErr error
+	var pending int
+	primaryResponded, err := dial(primary)
+	if err != nil {
+		firstErr = err
+	} else {
+		pending++
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	fallbackTimer := timer.C
+	var fallbackStarted bool
+	startFallback := func() {
+		fallbackStarted = true
+		fallbackTimer = nil
+		primaryResponded = nil
+		if _, err := dial(fallback); err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			return
+		}
+		pending++
+	}
+	if pending == 0 {
+		startFallback()
+	}
+	for pending > 0 {
+		select {
+		case <-primaryResponded:
+			// The server responded to the first attempt. Don't start a second one.
+			primaryResponded = nil
+			fallbackTimer = nil
+		case <-fallbackTimer:
+			startFallback()
+		case res := <-results:
+			pending--
+			if res.err == nil {
+				if pending > 0 {
+					// The other attempt might complete the handshake before it notices that it was aborted.
+					go func() {
+						if r := <-results; r.sess != nil {
+							r.sess.Close()
+						}
+					}()
+				}
+				return res.sess, nil
+			}
+			if firstErr == nil {
+				firstErr = res.err
+			}
+			if !fallbackStarted && ctx.Err() == nil {
+				startFallback()
+			}
+		}
+	}
+	return nil, firstErr
+}
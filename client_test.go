@@ -5,13 +5,17 @@ import (
 	"context"
 	"crypto/tls"
 	"errors"
+	"fmt"
+	"io/ioutil"
 	"net"
 	"os"
+	"reflect"
 	"time"
 
 	"github.com/golang/mock/gomock"
 	"github.com/lucas-clemente/quic-go/internal/handshake"
 	"github.com/lucas-clemente/quic-go/internal/protocol"
+	"github.com/lucas-clemente/quic-go/internal/qerr"
 	"github.com/lucas-clemente/quic-go/internal/utils"
 	"github.com/lucas-clemente/quic-go/internal/wire"
 
@@ -23,6 +27,7 @@ var _ = Describe("Client", func() {
 	var (
 		cl              *client
 		packetConn      *mockPacketConn
+		tlsConf         *tls.Config
 		addr            net.Addr
 		connID          protocol.ConnectionID
 		mockMultiplexer *MockMultiplexer
@@ -66,6 +71,7 @@ var _ = Describe("Client", func() {
 
 	BeforeEach(func() {
 		connID = protocol.ConnectionID{0, 0, 0, 0, 0, 0, 0x13, 0x37}
+		tlsConf = &tls.Config{NextProtos: []string{"proto1"}}
 		originalClientSessConstructor = newClientSession
 		Eventually(areSessionsRunning).Should(BeFalse())
 		// sess = NewMockQuicSession(mockCtrl)
@@ -148,11 +154,28 @@ var _ = Describe("Client", func() {
 				sess.EXPECT().run()
 				return sess, nil
 			}
-			_, err := DialAddr("localhost:17890", nil, &Config{HandshakeTimeout: time.Millisecond})
+			_, err := DialAddr("localhost:17890", tlsConf, &Config{HandshakeTimeout: time.Millisecond})
 			Expect(err).ToNot(HaveOccurred())
 			Eventually(remoteAddrChan).Should(Receive(Equal("127.0.0.1:17890")))
 		})
 
+		It("errors if the ConnectionIDLength is invalid", func() {
+			_, err := DialAddr("localhost:17890", tlsConf, &Config{ConnectionIDLength: 2})
+			Expect(err).To(MatchError("invalid ConnectionIDLength: 2 (must be 0, or between 4 and 18)"))
+		})
+
+		It("errors if the custom transport parameters are invalid", func() {
+			_, err := DialAddr("localhost:17890", tlsConf, &Config{CustomTransportParameters: map[uint64][]byte{0x4: nil}})
+			Expect(err).To(MatchError("custom transport parameter ID 0x4 collides with a registered transport parameter"))
+		})
+
+		It("errors if no application protocols are set in the tls.Config", func() {
+			_, err := DialAddr("localhost:17890", nil, nil)
+			Expect(err).To(MatchError("quic: NextProtos not set in tls.Config"))
+			_, err = DialAddr("localhost:17890", &tls.Config{ServerName: "foobar"}, nil)
+			Expect(err).To(MatchError("quic: NextProtos not set in tls.Config"))
+		})
+
 		It("uses the tls.Config.ServerName as the hostname, if present", func() {
 			manager := NewMockPacketHandlerManager(mockCtrl)
 			manager.EXPECT().Add(gomock.Any(), gomock.Any())
@@ -178,11 +201,237 @@ var _ = Describe("Client", func() {
 				sess.EXPECT().run()
 				return sess, nil
 			}
-			_, err := DialAddr("localhost:17890", &tls.Config{ServerName: "foobar"}, nil)
+			tlsConf.ServerName = "foobar"
+			_, err := DialAddr("localhost:17890", tlsConf, nil)
 			Expect(err).ToNot(HaveOccurred())
 			Eventually(hostnameChan).Should(Receive(Equal("foobar")))
 		})
 
+		Context("happy eyeballs", func() {
+			var origLookupIPAddr func(context.Context, string) ([]net.IPAddr, error)
+
+			BeforeEach(func() {
+				origLookupIPAddr = lookupIPAddr
+				lookupIPAddr = func(_ context.Context, host string) ([]net.IPAddr, error) {
+					Expect(host).To(Equal("quic.clemente.io"))
+					return []net.IPAddr{{IP: net.IPv4(127, 0, 0, 1)}, {IP: net.IPv6loopback}}, nil
+				}
+			})
+
+			AfterEach(func() {
+				lookupIPAddr = origLookupIPAddr
+			})
+
+			It("resolves IP addresses", func() {
+				primary, fallback, err := resolveAddrHappyEyeballs(context.Background(), "192.168.13.37:443")
+				Expect(err).ToNot(HaveOccurred())
+				Expect(primary.String()).To(Equal("192.168.13.37:443"))
+				Expect(fallback).To(BeNil())
+			})
+
+			It("prefers IPv6", func() {
+				primary, fallback, err := resolveAddrHappyEyeballs(context.Background(), "quic.clemente.io:443")
+				Expect(err).ToNot(HaveOccurred())
+				Expect(primary.String()).To(Equal("[::1]:443"))
+				Expect(fallback.String()).To(Equal("127.0.0.1:443"))
+			})
+
+			It("doesn't return a fallback if the host only has addresses of one family", func() {
+				lookupIPAddr = func(context.Context, string) ([]net.IPAddr, error) {
+					return []net.IPAddr{{IP: net.IPv4(127, 0, 0, 1)}, {IP: net.IPv4(127, 0, 0, 2)}}, nil
+				}
+				primary, fallback, err := resolveAddrHappyEyeballs(context.Background(), "quic.clemente.io:443")
+				Expect(err).ToNot(HaveOccurred())
+				Expect(primary.String()).To(Equal("127.0.0.1:443"))
+				Expect(fallback).To(BeNil())
+			})
+
+			It("doesn't race connection attempts if disabled", func() {
+				lookupIPAddr = func(context.Context, string) ([]net.IPAddr, error) {
+					Fail("didn't expect a lookup")
+					return nil, nil
+				}
+				manager := NewMockPacketHandlerManager(mockCtrl)
+				manager.EXPECT().Add(gomock.Any(), gomock.Any())
+				manager.EXPECT().Close()
+				mockMultiplexer.EXPECT().AddConn(gomock.Any(), gomock.Any(), gomock.Any()).Return(manager, nil)
+
+				newClientSession = func(
+					_ connection,
+					_ sessionRunner,
+					_ protocol.ConnectionID,
+					_ protocol.ConnectionID,
+					_ *Config,
+					_ *tls.Config,
+					_ protocol.PacketNumber,
+					_ *handshake.TransportParameters,
+					_ protocol.VersionNumber,
+					_ utils.Logger,
+					_ protocol.VersionNumber,
+				) (quicSession, error) {
+					sess := NewMockQuicSession(mockCtrl)
+					sess.EXPECT().run()
+					return sess, nil
+				}
+				_, err := DialAddr("localhost:17890", tlsConf, &Config{DisableHappyEyeballs: true})
+				Expect(err).ToNot(HaveOccurred())
+			})
+
+			It("uses IPv4 if the server doesn't respond on IPv6", func() {
+				mockMultiplexer.EXPECT().AddConn(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(func(net.PacketConn, int, []byte) (packetHandlerManager, error) {
+					manager := NewMockPacketHandlerManager(mockCtrl)
+					manager.EXPECT().Add(gomock.Any(), gomock.Any())
+					manager.EXPECT().Close().MaxTimes(1)
+					return manager, nil
+				}).Times(2)
+
+				ipv6Closed := make(chan struct{})
+				var ipv4Sess *MockQuicSession
+				remoteAddrs := make(chan string, 2)
+				newClientSession = func(
+					conn connection,
+					runner sessionRunner,
+					_ protocol.ConnectionID,
+					_ protocol.ConnectionID,
+					_ *Config,
+					_ *tls.Config,
+					_ protocol.PacketNumber,
+					_ *handshake.TransportParameters,
+					_ protocol.VersionNumber,
+					_ utils.Logger,
+					_ protocol.VersionNumber,
+				) (quicSession, error) {
+					remoteAddrs <- conn.RemoteAddr().String()
+					sess := NewMockQuicSession(mockCtrl)
+					if conn.RemoteAddr().(*net.UDPAddr).IP.To4() == nil {
+						// the server never responds on IPv6
+						sess.EXPECT().run().Do(func() { <-ipv6Closed })
+						sess.EXPECT().Close().Do(func() { close(ipv6Closed) })
+						return sess, nil
+					}
+					ipv4Sess = sess
+					sess.EXPECT().run().MaxTimes(1)
+					runner.OnHandshakeComplete(sess)
+					return sess, nil
+				}
+				start := time.Now()
+				s, err := DialAddr("quic.clemente.io:17890", tlsConf, &Config{HappyEyeballsDelay: 50 * time.Millisecond})
+				Expect(err).ToNot(HaveOccurred())
+				Expect(time.Since(start)).To(BeNumerically(">=", 50*time.Millisecond))
+				Expect(s).To(Equal(ipv4Sess))
+				Expect(remoteAddrs).To(Receive(Equal("[::1]:17890")))
+				Expect(remoteAddrs).To(Receive(Equal("127.0.0.1:17890")))
+				// the IPv6 attempt is aborted
+				Eventually(ipv6Closed).Should(BeClosed())
+			})
+
+			It("uses IPv4 immediately if the IPv6 attempt fails", func() {
+				mockMultiplexer.EXPECT().AddConn(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(func(net.PacketConn, int, []byte) (packetHandlerManager, error) {
+					manager := NewMockPacketHandlerManager(mockCtrl)
+					manager.EXPECT().Add(gomock.Any(), gomock.Any()).MaxTimes(1)
+					manager.EXPECT().Close().MaxTimes(1)
+					return manager, nil
+				}).Times(2)
+
+				testErr := errors.New("IPv6 error")
+				newClientSession = func(
+					conn connection,
+					runner sessionRunner,
+					_ protocol.ConnectionID,
+					_ protocol.ConnectionID,
+					_ *Config,
+					_ *tls.Config,
+					_ protocol.PacketNumber,
+					_ *handshake.TransportParameters,
+					_ protocol.VersionNumber,
+					_ utils.Logger,
+					_ protocol.VersionNumber,
+				) (quicSession, error) {
+					if conn.RemoteAddr().(*net.UDPAddr).IP.To4() == nil {
+						return nil, testErr
+					}
+					sess := NewMockQuicSession(mockCtrl)
+					sess.EXPECT().run().MaxTimes(1)
+					runner.OnHandshakeComplete(sess)
+					return sess, nil
+				}
+				start := time.Now()
+				s, err := DialAddr("quic.clemente.io:17890", tlsConf, &Config{HappyEyeballsDelay: time.Hour})
+				Expect(err).ToNot(HaveOccurred())
+				Expect(s).ToNot(BeNil())
+				Expect(time.Since(start)).To(BeNumerically("<", time.Second))
+			})
+
+			It("returns the first error if both attempts fail", func() {
+				mockMultiplexer.EXPECT().AddConn(gomock.Any(), gomock.Any(), gomock.Any()).Return(NewMockPacketHandlerManager(mockCtrl), nil).Times(2)
+
+				var counter int
+				newClientSession = func(
+					_ connection,
+					_ sessionRunner,
+					_ protocol.ConnectionID,
+					_ protocol.ConnectionID,
+					_ *Config,
+					_ *tls.Config,
+					_ protocol.PacketNumber,
+					_ *handshake.TransportParameters,
+					_ protocol.VersionNumber,
+					_ utils.Logger,
+					_ protocol.VersionNumber,
+				) (quicSession, error) {
+					counter++
+					return nil, fmt.Errorf("error %d", counter)
+				}
+				_, err := DialAddr("quic.clemente.io:17890", tlsConf, &Config{HappyEyeballsDelay: time.Hour})
+				Expect(err).To(MatchError("error 1"))
+				Expect(counter).To(Equal(2))
+			})
+
+			It("doesn't start the IPv4 attempt if the server responds on IPv6", func() {
+				mockMultiplexer.EXPECT().AddConn(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(func(pconn net.PacketConn, _ int, _ []byte) (packetHandlerManager, error) {
+					// simulate a response from the server
+					go pconn.ReadFrom(make([]byte, 100))
+					c, err := net.DialUDP("udp6", nil, &net.UDPAddr{IP: net.IPv6loopback, Port: pconn.LocalAddr().(*net.UDPAddr).Port})
+					Expect(err).ToNot(HaveOccurred())
+					defer c.Close()
+					_, err = c.Write([]byte("foobar"))
+					Expect(err).ToNot(HaveOccurred())
+					manager := NewMockPacketHandlerManager(mockCtrl)
+					manager.EXPECT().Add(gomock.Any(), gomock.Any())
+					manager.EXPECT().Close().MaxTimes(1)
+					return manager, nil
+				})
+
+				remoteAddrs := make(chan string, 2)
+				newClientSession = func(
+					conn connection,
+					runner sessionRunner,
+					_ protocol.ConnectionID,
+					_ protocol.ConnectionID,
+					_ *Config,
+					_ *tls.Config,
+					_ protocol.PacketNumber,
+					_ *handshake.TransportParameters,
+					_ protocol.VersionNumber,
+					_ utils.Logger,
+					_ protocol.VersionNumber,
+				) (quicSession, error) {
+					remoteAddrs <- conn.RemoteAddr().String()
+					sess := NewMockQuicSession(mockCtrl)
+					sess.EXPECT().run().MaxTimes(1)
+					go func() {
+						time.Sleep(100 * time.Millisecond) // longer than the HappyEyeballsDelay
+						runner.OnHandshakeComplete(sess)
+					}()
+					return sess, nil
+				}
+				_, err := DialAddr("quic.clemente.io:17890", tlsConf, &Config{HappyEyeballsDelay: 20 * time.Millisecond})
+				Expect(err).ToNot(HaveOccurred())
+				Expect(remoteAddrs).To(Receive(Equal("[::1]:17890")))
+				Expect(remoteAddrs).ToNot(Receive())
+			})
+		})
+
 		It("returns after the handshake is complete", func() {
 			manager := NewMockPacketHandlerManager(mockCtrl)
 			manager.EXPECT().Add(gomock.Any(), gomock.Any())
@@ -211,7 +460,7 @@ var _ = Describe("Client", func() {
 				packetConn,
 				addr,
 				"localhost:1337",
-				nil,
+				tlsConf,
 				&Config{},
 			)
 			Expect(err).ToNot(HaveOccurred())
@@ -247,12 +496,48 @@ var _ = Describe("Client", func() {
 				packetConn,
 				addr,
 				"localhost:1337",
-				nil,
+				tlsConf,
 				&Config{},
 			)
 			Expect(err).To(MatchError(testErr))
 		})
 
+		It("returns an ALPNError if the application protocol negotiation failed", func() {
+			manager := NewMockPacketHandlerManager(mockCtrl)
+			manager.EXPECT().Add(gomock.Any(), gomock.Any())
+			mockMultiplexer.EXPECT().AddConn(packetConn, gomock.Any(), gomock.Any()).Return(manager, nil)
+
+			alpnErr := qerr.Error(qerr.NoApplicationProtocol, "no application protocol in common")
+			newClientSession = func(
+				_ connection,
+				_ sessionRunner,
+				_ protocol.ConnectionID,
+				_ protocol.ConnectionID,
+				_ *Config,
+				_ *tls.Config,
+				_ protocol.PacketNumber,
+				_ *handshake.TransportParameters,
+				_ protocol.VersionNumber,
+				_ utils.Logger,
+				_ protocol.VersionNumber,
+			) (quicSession, error) {
+				sess := NewMockQuicSession(mockCtrl)
+				sess.EXPECT().run().Return(&CryptoError{Alert: 120, Remote: true, err: alpnErr})
+				return sess, nil
+			}
+			tlsConf.NextProtos = []string{"proto1", "proto2"}
+			_, err := Dial(
+				packetConn,
+				addr,
+				"localhost:1337",
+				tlsConf,
+				&Config{},
+			)
+			Expect(err).To(BeAssignableToTypeOf(&ALPNError{}))
+			Expect(err.(*ALPNError).Protocols).To(Equal([]string{"proto1", "proto2"}))
+			Expect(err).To(MatchError(alpnErr.Error()))
+		})
+
 		It("closes the session when the context is canceled", func() {
 			manager := NewMockPacketHandlerManager(mockCtrl)
 			manager.EXPECT().Add(gomock.Any(), gomock.Any())
@@ -288,7 +573,7 @@ var _ = Describe("Client", func() {
 					packetConn,
 					addr,
 					"localhost:1337",
-					nil,
+					tlsConf,
 					&Config{},
 				)
 				Expect(err).To(MatchError(context.Canceled))
@@ -333,7 +618,7 @@ var _ = Describe("Client", func() {
 				packetConn,
 				addr,
 				"localhost:1337",
-				nil,
+				tlsConf,
 				&Config{},
 			)
 			Expect(err).ToNot(HaveOccurred())
@@ -376,7 +661,7 @@ var _ = Describe("Client", func() {
 			done := make(chan struct{})
 			go func() {
 				defer GinkgoRecover()
-				_, err := DialAddr("localhost:1337", nil, nil)
+				_, err := DialAddr("localhost:1337", tlsConf, nil)
 				Expect(err).ToNot(HaveOccurred())
 				close(done)
 			}()
@@ -396,20 +681,60 @@ var _ = Describe("Client", func() {
 		Context("quic.Config", func() {
 			It("setups with the right values", func() {
 				config := &Config{
-					HandshakeTimeout:      1337 * time.Minute,
-					IdleTimeout:           42 * time.Hour,
-					MaxIncomingStreams:    1234,
-					MaxIncomingUniStreams: 4321,
-					ConnectionIDLength:    13,
-					StatelessResetKey:     []byte("foobar"),
+					HandshakeTimeout:             1337 * time.Minute,
+					IdleTimeout:                  42 * time.Hour,
+					IdleTimeoutMultiplier:        10,
+					MinIdleTimeout:               time.Hour,
+					MaxIdleTimeout:               100 * time.Hour,
+					MaxIncomingStreams:           1234,
+					MaxIncomingUniStreams:        4321,
+					ConnectionIDLength:           13,
+					StatelessResetKey:            []byte("foobar"),
+					UDPReceiveBufferSize:         1 << 22,
+					MaxConnectionSendBufferBytes: 1 << 20,
+					DisableHappyEyeballs:         true,
+					HappyEyeballsDelay:           time.Second,
+					MaxBurstPackets:              42,
+					VerifyConnection:             func(tls.ConnectionState, Session) error { return nil },
+					MetricsCollector:             &Metrics{},
+					Logger:                       NewStandardLogger(ioutil.Discard, LogLevelDebug),
+					PacketCapturer:               NewPcapWriter(ioutil.Discard, 0),
+					EnableDatagrams:              true,
+					EnableFrameGreasing:          true,
+					CustomTransportParameters:    map[uint64][]byte{0x1337: []byte("foobar")},
+					OnCustomFrame:                func(Session, CustomFrame) {},
 				}
+				config.RegisterFrameType(0x1337, func([]byte) (CustomFrame, error) { return nil, nil })
 				c := populateClientConfig(config, false)
 				Expect(c.HandshakeTimeout).To(Equal(1337 * time.Minute))
 				Expect(c.IdleTimeout).To(Equal(42 * time.Hour))
+				Expect(c.IdleTimeoutMultiplier).To(Equal(10.0))
+				Expect(c.MinIdleTimeout).To(Equal(time.Hour))
+				Expect(c.MaxIdleTimeout).To(Equal(100 * time.Hour))
+				Expect(c.MetricsCollector).To(BeIdenticalTo(config.MetricsCollector))
+				Expect(c.Logger).To(BeIdenticalTo(config.Logger))
+				Expect(c.PacketCapturer).To(BeIdenticalTo(config.PacketCapturer))
 				Expect(c.MaxIncomingStreams).To(Equal(1234))
 				Expect(c.MaxIncomingUniStreams).To(Equal(4321))
 				Expect(c.ConnectionIDLength).To(Equal(13))
 				Expect(c.StatelessResetKey).To(Equal([]byte("foobar")))
+				Expect(c.UDPReceiveBufferSize).To(Equal(1 << 22))
+				Expect(c.MaxConnectionSendBufferBytes).To(Equal(uint64(1 << 20)))
+				Expect(c.DisableHappyEyeballs).To(BeTrue())
+				Expect(c.HappyEyeballsDelay).To(Equal(time.Second))
+				Expect(c.MaxBurstPackets).To(Equal(42))
+				Expect(c.EnableDatagrams).To(BeTrue())
+				Expect(c.EnableFrameGreasing).To(BeTrue())
+				Expect(c.CustomTransportParameters).To(Equal(map[uint64][]byte{0x1337: []byte("foobar")}))
+				Expect(c.OnCustomFrame).ToNot(BeNil())
+				Expect(c.customFrameTypes).To(HaveKey(uint64(0x1337)))
+				Expect(reflect.ValueOf(c.VerifyConnection)).To(Equal(reflect.ValueOf(config.VerifyConnection)))
+			})
+
+			It("keeps the TB used for error injection", func() {
+				tb := &testTB{}
+				c := populateClientConfig(&Config{testingTB: tb}, false)
+				Expect(c.testingTB).To(Equal(tb))
 			})
 
 			It("errors when the Config contains an invalid version", func() {
@@ -417,7 +742,7 @@ var _ = Describe("Client", func() {
 				mockMultiplexer.EXPECT().AddConn(packetConn, gomock.Any(), gomock.Any()).Return(manager, nil)
 
 				version := protocol.VersionNumber(0x1234)
-				_, err := Dial(packetConn, nil, "localhost:1234", &tls.Config{}, &Config{Versions: []protocol.VersionNumber{version}})
+				_, err := Dial(packetConn, nil, "localhost:1234", tlsConf, &Config{Versions: []protocol.VersionNumber{version}})
 				Expect(err).To(MatchError("0x1234 is not a valid QUIC version"))
 			})
 
@@ -441,6 +766,18 @@ var _ = Describe("Client", func() {
 				Expect(c.MaxIncomingUniStreams).To(BeZero())
 			})
 
+			It("disables scaling of the timeouts with the RTT", func() {
+				c := populateClientConfig(&Config{IdleTimeoutMultiplier: -1}, false)
+				Expect(c.IdleTimeoutMultiplier).To(BeZero())
+			})
+
+			It("uses the length of the ConnectionIDGenerator", func() {
+				g := &serverIDConnectionIDGenerator{connIDLen: 9}
+				c := populateClientConfig(&Config{ConnectionIDGenerator: g}, true)
+				Expect(c.ConnectionIDLength).To(Equal(9))
+				Expect(c.ConnectionIDGenerator).To(Equal(g))
+			})
+
 			It("uses 0-byte connection IDs when dialing an address", func() {
 				config := &Config{}
 				c := populateClientConfig(config, true)
@@ -452,6 +789,13 @@ var _ = Describe("Client", func() {
 				Expect(c.Versions).To(Equal(protocol.SupportedVersions))
 				Expect(c.HandshakeTimeout).To(Equal(protocol.DefaultHandshakeTimeout))
 				Expect(c.IdleTimeout).To(Equal(protocol.DefaultIdleTimeout))
+				Expect(c.IdleTimeoutMultiplier).To(Equal(float64(protocol.DefaultIdleTimeoutMultiplier)))
+				Expect(c.MinIdleTimeout).To(BeZero())
+				Expect(c.MaxIdleTimeout).To(BeZero())
+				Expect(c.UDPReceiveBufferSize).To(Equal(protocol.DefaultUDPBufferSize))
+				Expect(c.MaxConnectionSendBufferBytes).To(BeEquivalentTo(protocol.DefaultMaxConnectionSendBufferSize))
+				Expect(c.HappyEyeballsDelay).To(Equal(protocol.DefaultHappyEyeballsDelay))
+				Expect(c.MaxBurstPackets).To(Equal(protocol.DefaultMaxBurstPackets))
 			})
 		})
 
@@ -487,7 +831,7 @@ var _ = Describe("Client", func() {
 				sess.EXPECT().run()
 				return sess, nil
 			}
-			_, err := Dial(packetConn, addr, "localhost:1337", nil, config)
+			_, err := Dial(packetConn, addr, "localhost:1337", tlsConf, config)
 			Expect(err).ToNot(HaveOccurred())
 			Eventually(c).Should(BeClosed())
 			Expect(cconn.(*conn).pconn).To(Equal(packetConn))
@@ -535,7 +879,7 @@ var _ = Describe("Client", func() {
 					packetConn,
 					addr,
 					"localhost:1337",
-					nil,
+					tlsConf,
 					&Config{},
 				)
 				Expect(err).To(MatchError(testErr))
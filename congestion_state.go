@@ -0,0 +1,52 @@
+// +build internal_test
+
+package quic
+
+import "github.com/lucas-clemente/quic-go/internal/congestion"
+
+// A CongestionState is the state of the congestion controller.
+type CongestionState = congestion.State
+
+const (
+	// CongestionStateSlowStart is the slow start phase.
+	CongestionStateSlowStart = congestion.StateSlowStart
+	// CongestionStateCongestionAvoidance is the congestion avoidance phase.
+	CongestionStateCongestionAvoidance = congestion.StateCongestionAvoidance
+	// CongestionStateRecovery is the recovery period entered after a packet loss.
+	CongestionStateRecovery = congestion.StateRecovery
+)
+
+// CongestionControlState is a snapshot of the state of the congestion controller.
+type CongestionControlState struct {
+	CWND          ByteCount
+	Ssthresh      ByteCount
+	BytesInFlight ByteCount
+	State         CongestionState
+}
+
+// A CongestionStateInspector allows inspecting the state of the congestion controller of a session.
+// It is implemented by all sessions, but only in builds with the internal_test build tag.
+// Together with ErrorInjector.TestInjectPacketLoss, it allows testing how the congestion controller reacts to loss.
+// The method returns an error unless error injection was enabled using EnableErrorInjection.
+type CongestionStateInspector interface {
+	TestCongestionState() (CongestionControlState, error)
+}
+
+func (s *session) TestCongestionState() (CongestionControlState, error) {
+	if s.testingTB() == nil {
+		return CongestionControlState{}, errErrorInjectionDisabled
+	}
+	// The sent packet handler is not thread-safe. Read the state on the run loop.
+	var state CongestionControlState
+	if err := s.runOnRunLoop(func() {
+		state = CongestionControlState{
+			CWND:          s.sentPacketHandler.GetCongestionWindow(),
+			Ssthresh:      s.sentPacketHandler.GetSlowStartThreshold(),
+			BytesInFlight: s.sentPacketHandler.GetBytesInFlight(),
+			State:         s.sentPacketHandler.GetCongestionState(),
+		}
+	}); err != nil {
+		return CongestionControlState{}, err
+	}
+	return state, nil
+}
@@ -0,0 +1,80 @@
+package quic
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+)
+
+// minAffinityRandomLen is the minimum number of random bytes in a connection ID
+// generated by the affinityConnectionIDGenerator.
+const minAffinityRandomLen = 4
+
+// The affinityConnectionIDGenerator generates connection IDs that contain a server token.
+// This allows a load balancer to route packets to the server that owns the connection,
+// without any further coordination with the server.
+// The connection IDs have the following layout:
+// the length of the server token (1 byte), the server token, and random bytes filling the remaining connection ID.
+type affinityConnectionIDGenerator struct {
+	token     []byte
+	connIDLen int
+
+	rand io.Reader
+}
+
+var _ ConnectionIDGenerator = &affinityConnectionIDGenerator{}
+
+// NewAffinityConnectionIDGenerator creates a ConnectionIDGenerator that embeds a server token in every connection ID.
+// It is intended to be used as Config.ConnectionIDGenerator by servers running behind a load balancer.
+// The load balancer uses DecodeAffinityToken to retrieve the token from the connection ID.
+// The token is not encrypted, it can be read by on-path observers.
+// At least 4 bytes of the connection ID are chosen randomly,
+// so the connection ID length must be at least 5 bytes larger than the token.
+func NewAffinityConnectionIDGenerator(serverToken []byte, connIDLen int) (ConnectionIDGenerator, error) {
+	if connIDLen < protocol.MinConnectionIDLen || connIDLen > protocol.MaxConnectionIDLen {
+		return nil, fmt.Errorf("invalid connection ID length: %d", connIDLen)
+	}
+	if len(serverToken) == 0 {
+		return nil, errors.New("empty server token")
+	}
+	if 1+len(serverToken)+minAffinityRandomLen > connIDLen {
+		return nil, fmt.Errorf("server token too long for a connection ID length of %d bytes: %d", connIDLen, len(serverToken))
+	}
+	return &affinityConnectionIDGenerator{
+		token:     append([]byte{}, serverToken...),
+		connIDLen: connIDLen,
+		rand:      rand.Reader,
+	}, nil
+}
+
+func (g *affinityConnectionIDGenerator) GenerateConnectionID() (ConnectionID, error) {
+	b := make([]byte, g.connIDLen)
+	b[0] = uint8(len(g.token))
+	n := copy(b[1:], g.token)
+	if _, err := io.ReadFull(g.rand, b[1+n:]); err != nil {
+		return nil, err
+	}
+	return protocol.ConnectionID(b), nil
+}
+
+func (g *affinityConnectionIDGenerator) ConnectionIDLen() int {
+	return g.connIDLen
+}
+
+// DecodeAffinityToken returns the server token embedded in a connection ID
+// that was generated by a generator created with NewAffinityConnectionIDGenerator.
+// It is intended to be used by load balancers.
+// The returned slice references the memory of the connection ID.
+func DecodeAffinityToken(connID ConnectionID) ([]byte, error) {
+	if connID.Len() == 0 {
+		return nil, errors.New("empty connection ID")
+	}
+	tokenLen := int(connID[0])
+	if tokenLen == 0 || 1+tokenLen+minAffinityRandomLen > connID.Len() {
+		return nil, fmt.Errorf("connection ID %s doesn't contain a server token", connID)
+	}
+	return connID[1 : 1+tokenLen], nil
+}
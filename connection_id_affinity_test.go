@@ -0,0 +1,103 @@
+package quic
+
+import (
+	"bytes"
+	"encoding/hex"
+
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Connection ID affinity", func() {
+	unhex := func(s string) []byte {
+		b, err := hex.DecodeString(s)
+		Expect(err).ToNot(HaveOccurred())
+		return b
+	}
+
+	// newGenerator creates a generator that uses the given bytes instead of cryptographic random
+	newGenerator := func(token []byte, connIDLen int, random []byte) ConnectionIDGenerator {
+		g, err := NewAffinityConnectionIDGenerator(token, connIDLen)
+		Expect(err).ToNot(HaveOccurred())
+		g.(*affinityConnectionIDGenerator).rand = bytes.NewReader(random)
+		return g
+	}
+
+	Context("test vectors", func() {
+		vectors := []struct {
+			token, random, connID string
+			connIDLen             int
+		}{
+			{token: "01", random: "deadbeef", connID: "0101deadbeef", connIDLen: 6},
+			{token: "c0ffee", random: "0102030405060708", connID: "03c0ffee0102030405060708", connIDLen: 12},
+			{token: "0a0b0c0d0e0f1011", random: "aabbccddeeff0011ff", connID: "080a0b0c0d0e0f1011aabbccddeeff0011ff", connIDLen: 18},
+		}
+
+		for i := range vectors {
+			v := vectors[i]
+
+			It("encodes "+v.token, func() {
+				g := newGenerator(unhex(v.token), v.connIDLen, unhex(v.random))
+				Expect(g.ConnectionIDLen()).To(Equal(v.connIDLen))
+				connID, err := g.GenerateConnectionID()
+				Expect(err).ToNot(HaveOccurred())
+				Expect(connID).To(Equal(protocol.ConnectionID(unhex(v.connID))))
+			})
+
+			It("decodes "+v.connID, func() {
+				token, err := DecodeAffinityToken(unhex(v.connID))
+				Expect(err).ToNot(HaveOccurred())
+				Expect(token).To(Equal(unhex(v.token)))
+			})
+		}
+	})
+
+	It("generates different connection IDs with the same token", func() {
+		g, err := NewAffinityConnectionIDGenerator([]byte("server1"), 16)
+		Expect(err).ToNot(HaveOccurred())
+		c1, err := g.GenerateConnectionID()
+		Expect(err).ToNot(HaveOccurred())
+		c2, err := g.GenerateConnectionID()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(c1).ToNot(Equal(c2))
+		Expect(newConnectionID(g)).To(HaveLen(16))
+		t1, err := DecodeAffinityToken(c1)
+		Expect(err).ToNot(HaveOccurred())
+		t2, err := DecodeAffinityToken(c2)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(t1).To(Equal([]byte("server1")))
+		Expect(t2).To(Equal([]byte("server1")))
+	})
+
+	It("can be used in the Config", func() {
+		g, err := NewAffinityConnectionIDGenerator([]byte{1, 2}, 8)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(validateConnectionIDGenerator(&Config{ConnectionIDGenerator: g})).To(Succeed())
+	})
+
+	It("rejects invalid connection ID lengths", func() {
+		_, err := NewAffinityConnectionIDGenerator([]byte{1}, 19)
+		Expect(err).To(MatchError("invalid connection ID length: 19"))
+	})
+
+	It("rejects empty tokens", func() {
+		_, err := NewAffinityConnectionIDGenerator(nil, 8)
+		Expect(err).To(MatchError("empty server token"))
+	})
+
+	It("rejects tokens that are too long", func() {
+		_, err := NewAffinityConnectionIDGenerator([]byte{1, 2, 3, 4}, 8)
+		Expect(err).To(MatchError("server token too long for a connection ID length of 8 bytes: 4"))
+	})
+
+	It("doesn't decode connection IDs that don't contain a token", func() {
+		_, err := DecodeAffinityToken(nil)
+		Expect(err).To(MatchError("empty connection ID"))
+		_, err = DecodeAffinityToken(protocol.ConnectionID{0, 1, 2, 3, 4})
+		Expect(err).To(MatchError("connection ID 0x0001020304 doesn't contain a server token"))
+		_, err = DecodeAffinityToken(protocol.ConnectionID{2, 1, 2, 3, 4, 5})
+		Expect(err).To(MatchError("connection ID 0x020102030405 doesn't contain a server token"))
+	})
+})
@@ -0,0 +1,65 @@
+package quic
+
+import (
+	"fmt"
+
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+)
+
+// The randomConnectionIDGenerator generates connection IDs using cryptographic random.
+// It is used if no ConnectionIDGenerator is set in the Config.
+type randomConnectionIDGenerator struct {
+	connIDLen int
+}
+
+var _ ConnectionIDGenerator = &randomConnectionIDGenerator{}
+
+func (g *randomConnectionIDGenerator) GenerateConnectionID() (ConnectionID, error) {
+	return generateConnectionID(g.connIDLen)
+}
+
+func (g *randomConnectionIDGenerator) ConnectionIDLen() int {
+	return g.connIDLen
+}
+
+// validateConnectionIDLength checks that the ConnectionIDLength set in the Config is either 0, or a valid connection ID length.
+func validateConnectionIDLength(config *Config) error {
+	if config == nil || config.ConnectionIDLength == 0 {
+		return nil
+	}
+	if l := config.ConnectionIDLength; l < protocol.MinConnectionIDLen || l > protocol.MaxConnectionIDLen {
+		return fmt.Errorf("invalid ConnectionIDLength: %d (must be 0, or between %d and %d)", l, protocol.MinConnectionIDLen, protocol.MaxConnectionIDLen)
+	}
+	return nil
+}
+
+// validateConnectionIDGenerator checks that the ConnectionIDGenerator set in the Config is consistent with the ConnectionIDLength.
+func validateConnectionIDGenerator(config *Config) error {
+	if config == nil || config.ConnectionIDGenerator == nil {
+		return nil
+	}
+	l := config.ConnectionIDGenerator.ConnectionIDLen()
+	if l < protocol.MinConnectionIDLen || l > protocol.MaxConnectionIDLen {
+		return fmt.Errorf("invalid connection ID length: %d", l)
+	}
+	if config.ConnectionIDLength != 0 && config.ConnectionIDLength != l {
+		return fmt.Errorf("ConnectionIDLength (%d) doesn't match the length of the ConnectionIDGenerator (%d)", config.ConnectionIDLength, l)
+	}
+	return nil
+}
+
+// newConnectionID generates a new connection ID.
+// For custom generators, it checks that the connection ID has the length announced by the generator.
+func newConnectionID(g ConnectionIDGenerator) (protocol.ConnectionID, error) {
+	connID, err := g.GenerateConnectionID()
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := g.(*randomConnectionIDGenerator); ok {
+		return connID, nil
+	}
+	if connID.Len() != g.ConnectionIDLen() {
+		return nil, fmt.Errorf("generated connection ID has an invalid length: %d (expected %d)", connID.Len(), g.ConnectionIDLen())
+	}
+	return connID, nil
+}
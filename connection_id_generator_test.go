@@ -0,0 +1,111 @@
+package quic
+
+import (
+	"crypto/rand"
+	"errors"
+
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// The serverIDConnectionIDGenerator generates connection IDs that start with a 2 byte server ID,
+// as a load balancer would use for routing.
+type serverIDConnectionIDGenerator struct {
+	serverID  [2]byte
+	connIDLen int
+}
+
+func (g *serverIDConnectionIDGenerator) GenerateConnectionID() (ConnectionID, error) {
+	b := make([]byte, g.connIDLen)
+	copy(b, g.serverID[:])
+	if _, err := rand.Read(b[2:]); err != nil {
+		return nil, err
+	}
+	return ConnectionID(b), nil
+}
+
+func (g *serverIDConnectionIDGenerator) ConnectionIDLen() int { return g.connIDLen }
+
+type mockConnectionIDGenerator struct {
+	connID    ConnectionID
+	err       error
+	connIDLen int
+}
+
+func (g *mockConnectionIDGenerator) GenerateConnectionID() (ConnectionID, error) {
+	return g.connID, g.err
+}
+
+func (g *mockConnectionIDGenerator) ConnectionIDLen() int { return g.connIDLen }
+
+var _ = Describe("Connection ID Generator", func() {
+	It("generates random connection IDs", func() {
+		g := &randomConnectionIDGenerator{connIDLen: 7}
+		Expect(g.ConnectionIDLen()).To(Equal(7))
+		c1, err := newConnectionID(g)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(c1).To(HaveLen(7))
+		c2, err := newConnectionID(g)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(c1).ToNot(Equal(c2))
+	})
+
+	It("uses a custom generator", func() {
+		g := &serverIDConnectionIDGenerator{serverID: [2]byte{0xde, 0xad}, connIDLen: 8}
+		connID, err := newConnectionID(g)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(connID).To(HaveLen(8))
+		Expect(connID[:2]).To(Equal(protocol.ConnectionID{0xde, 0xad}))
+	})
+
+	It("errors if the generated connection ID has the wrong length", func() {
+		g := &mockConnectionIDGenerator{connID: ConnectionID{1, 2, 3, 4, 5}, connIDLen: 6}
+		_, err := newConnectionID(g)
+		Expect(err).To(MatchError("generated connection ID has an invalid length: 5 (expected 6)"))
+	})
+
+	It("returns errors from the generator", func() {
+		g := &mockConnectionIDGenerator{err: errors.New("generation failed"), connIDLen: 6}
+		_, err := newConnectionID(g)
+		Expect(err).To(MatchError("generation failed"))
+	})
+
+	Context("validating the Config", func() {
+		It("accepts valid connection ID lengths", func() {
+			Expect(validateConnectionIDLength(nil)).To(Succeed())
+			Expect(validateConnectionIDLength(&Config{})).To(Succeed())
+			Expect(validateConnectionIDLength(&Config{ConnectionIDLength: 4})).To(Succeed())
+			Expect(validateConnectionIDLength(&Config{ConnectionIDLength: 18})).To(Succeed())
+		})
+
+		It("rejects invalid connection ID lengths", func() {
+			Expect(validateConnectionIDLength(&Config{ConnectionIDLength: 3})).To(MatchError("invalid ConnectionIDLength: 3 (must be 0, or between 4 and 18)"))
+			Expect(validateConnectionIDLength(&Config{ConnectionIDLength: 19})).To(MatchError("invalid ConnectionIDLength: 19 (must be 0, or between 4 and 18)"))
+			Expect(validateConnectionIDLength(&Config{ConnectionIDLength: -1})).To(MatchError("invalid ConnectionIDLength: -1 (must be 0, or between 4 and 18)"))
+		})
+
+		It("accepts a Config without a generator", func() {
+			Expect(validateConnectionIDGenerator(nil)).To(Succeed())
+			Expect(validateConnectionIDGenerator(&Config{ConnectionIDLength: 5})).To(Succeed())
+		})
+
+		It("accepts a generator, if the ConnectionIDLength is unset or matches", func() {
+			g := &mockConnectionIDGenerator{connIDLen: 6}
+			Expect(validateConnectionIDGenerator(&Config{ConnectionIDGenerator: g})).To(Succeed())
+			Expect(validateConnectionIDGenerator(&Config{ConnectionIDGenerator: g, ConnectionIDLength: 6})).To(Succeed())
+		})
+
+		It("rejects a generator, if the ConnectionIDLength doesn't match", func() {
+			g := &mockConnectionIDGenerator{connIDLen: 6}
+			err := validateConnectionIDGenerator(&Config{ConnectionIDGenerator: g, ConnectionIDLength: 5})
+			Expect(err).To(MatchError("ConnectionIDLength (5) doesn't match the length of the ConnectionIDGenerator (6)"))
+		})
+
+		It("rejects a generator with an invalid length", func() {
+			Expect(validateConnectionIDGenerator(&Config{ConnectionIDGenerator: &mockConnectionIDGenerator{connIDLen: 3}})).To(MatchError("invalid connection ID length: 3"))
+			Expect(validateConnectionIDGenerator(&Config{ConnectionIDGenerator: &mockConnectionIDGenerator{connIDLen: 19}})).To(MatchError("invalid connection ID length: 19"))
+		})
+	})
+})
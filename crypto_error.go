@@ -0,0 +1,38 @@
+package quic
+
+import "github.com/lucas-clemente/quic-go/internal/qerr"
+
+// A CryptoError is returned when a connection is closed because the TLS handshake failed,
+// e.g. because the peer's certificate couldn't be verified (bad_certificate, 42),
+// or because the client didn't send a certificate that the server requires (certificate_required, 116).
+// QUIC sends the TLS alert in the CONNECTION_CLOSE frame, so both the endpoint that aborted the handshake
+// and its peer close the connection with a CryptoError.
+// Note that the client might only learn that the server rejected its certificate after Dial returned.
+type CryptoError struct {
+	// Alert is the TLS alert.
+	Alert uint8
+	// Remote says if the peer aborted the handshake.
+	Remote bool
+
+	err *qerr.QuicError
+}
+
+var _ error = &CryptoError{}
+
+func (e *CryptoError) Error() string {
+	return e.err.Error()
+}
+
+// toCryptoError converts a QuicError carrying a TLS alert to a CryptoError.
+// All other errors are returned unchanged.
+func toCryptoError(err error, remote bool) error {
+	qErr, ok := err.(*qerr.QuicError)
+	if !ok || !qErr.IsCryptoError() {
+		return err
+	}
+	return &CryptoError{
+		Alert:  uint8(qErr.ErrorCode - 0x100),
+		Remote: remote,
+		err:    qErr,
+	}
+}
@@ -1,11 +1,13 @@
 package quic
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
 	"io"
 
 	"github.com/lucas-clemente/quic-go/internal/protocol"
+	"github.com/lucas-clemente/quic-go/internal/qerr"
 	"github.com/lucas-clemente/quic-go/internal/utils"
 	"github.com/lucas-clemente/quic-go/internal/wire"
 )
@@ -53,6 +55,10 @@ func (s *postHandshakeCryptoStream) Write(p []byte) (int, error) {
 type cryptoStreamImpl struct {
 	queue  *frameSorter
 	msgBuf []byte
+	// received contains all data that was passed on in order (i.e. appended to msgBuf).
+	// It is used to detect CRYPTO frames that contradict data that was already delivered to TLS.
+	// It is released when the stream is finished.
+	received []byte
 
 	highestOffset protocol.ByteCount
 	finished      bool
@@ -79,8 +85,23 @@ func (s *cryptoStreamImpl) HandleCryptoFrame(f *wire.CryptoFrame) error {
 		// could e.g. be a retransmission
 		return nil
 	}
+	data, offset := f.Data, f.Offset
+	// Data below the read offset was already delivered.
+	// Duplicates (retransmissions, or packets duplicated by the network) are dropped,
+	// but data that differs from what was delivered would corrupt the TLS state.
+	if readOffset := protocol.ByteCount(len(s.received)); offset < readOffset {
+		overlap := utils.MinByteCount(readOffset-offset, protocol.ByteCount(len(data)))
+		if !bytes.Equal(data[:overlap], s.received[offset:offset+overlap]) {
+			return qerr.Error(qerr.ProtocolViolation, "received CRYPTO frame contradicting data already received")
+		}
+		data = data[overlap:]
+		offset += overlap
+		if len(data) == 0 {
+			return nil
+		}
+	}
 	s.highestOffset = utils.MaxByteCount(s.highestOffset, highestOffset)
-	if err := s.queue.Push(f.Data, f.Offset); err != nil {
+	if err := s.queue.Push(data, offset); err != nil {
 		return err
 	}
 	for {
@@ -89,6 +110,7 @@ func (s *cryptoStreamImpl) HandleCryptoFrame(f *wire.CryptoFrame) error {
 			return nil
 		}
 		s.msgBuf = append(s.msgBuf, data...)
+		s.received = append(s.received, data...)
 	}
 }
 
@@ -112,6 +134,7 @@ func (s *cryptoStreamImpl) Finish() error {
 		return errors.New("encryption level changed, but crypto stream has more data to read")
 	}
 	s.finished = true
+	s.received = nil
 	return nil
 }
 
@@ -3,8 +3,10 @@ package quic
 import (
 	"crypto/rand"
 	"fmt"
+	mrand "math/rand"
 
 	"github.com/lucas-clemente/quic-go/internal/protocol"
+	"github.com/lucas-clemente/quic-go/internal/qerr"
 	"github.com/lucas-clemente/quic-go/internal/wire"
 
 	. "github.com/onsi/ginkgo"
@@ -90,6 +92,63 @@ var _ = Describe("Crypto Stream", func() {
 			Expect(str.GetCryptoData()).To(BeNil())
 		})
 
+		Context("duplicate detection", func() {
+			It("delivers the data exactly once, when receiving lots of duplicate CRYPTO frames", func() {
+				msg1 := createHandshakeMessage(1000)
+				msg2 := createHandshakeMessage(500)
+				data := append(append([]byte{}, msg1...), msg2...)
+				var frames []*wire.CryptoFrame
+				for offset := 0; offset < len(data); offset += 100 {
+					end := offset + 100
+					if end > len(data) {
+						end = len(data)
+					}
+					frames = append(frames, &wire.CryptoFrame{
+						Offset: protocol.ByteCount(offset),
+						Data:   data[offset:end],
+					})
+				}
+				// receive every frame 50 times, in random order
+				var received []*wire.CryptoFrame
+				for i := 0; i < 50; i++ {
+					received = append(received, frames...)
+				}
+				mrand.Shuffle(len(received), func(i, j int) { received[i], received[j] = received[j], received[i] })
+				var msgs [][]byte
+				for _, f := range received {
+					Expect(str.HandleCryptoFrame(f)).To(Succeed())
+					for {
+						msg := str.GetCryptoData()
+						if msg == nil {
+							break
+						}
+						msgs = append(msgs, msg)
+					}
+				}
+				Expect(msgs).To(Equal([][]byte{msg1, msg2}))
+				Expect(str.Finish()).To(Succeed())
+			})
+
+			It("only delivers the new part of a CRYPTO frame overlapping data already received", func() {
+				msg := createHandshakeMessage(6)
+				Expect(str.HandleCryptoFrame(&wire.CryptoFrame{Data: msg[:5]})).To(Succeed())
+				Expect(str.GetCryptoData()).To(BeNil())
+				Expect(str.HandleCryptoFrame(&wire.CryptoFrame{Offset: 2, Data: msg[2:]})).To(Succeed())
+				Expect(str.GetCryptoData()).To(Equal(msg))
+				Expect(str.GetCryptoData()).To(BeNil())
+			})
+
+			It("errors when a CRYPTO frame contradicts data already received", func() {
+				msg := createHandshakeMessage(6)
+				Expect(str.HandleCryptoFrame(&wire.CryptoFrame{Data: msg})).To(Succeed())
+				Expect(str.GetCryptoData()).To(Equal(msg))
+				corrupted := append([]byte{}, msg[4:]...)
+				corrupted[0]++
+				err := str.HandleCryptoFrame(&wire.CryptoFrame{Offset: 4, Data: corrupted})
+				Expect(err).To(MatchError(qerr.Error(qerr.ProtocolViolation, "received CRYPTO frame contradicting data already received")))
+			})
+		})
+
 		Context("finishing", func() {
 			It("errors if there's still data to read after finishing", func() {
 				Expect(str.HandleCryptoFrame(&wire.CryptoFrame{
@@ -188,7 +247,7 @@ var _ = Describe("Post Handshake Crypto Stream", func() {
 	)
 
 	BeforeEach(func() {
-		framer = newFramer(NewMockStreamGetter(mockCtrl), protocol.VersionTLS)
+		framer = newFramer(NewMockStreamGetter(mockCtrl), newConnectionSendBuffer(protocol.MaxByteCount), protocol.VersionTLS)
 		cs = newPostHandshakeCryptoStream(framer)
 	})
 
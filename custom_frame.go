@@ -0,0 +1,84 @@
+package quic
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+	"github.com/lucas-clemente/quic-go/internal/wire"
+)
+
+// A CustomFrame is a frame of a QUIC extension that is implemented by the application,
+// e.g. of an experimental extension that is negotiated using Config.CustomTransportParameters.
+// The application serializes and parses the frame, quic-go only writes and reads the frame type.
+// Custom frames are ack-eliciting, and they are retransmitted if the packet containing them is lost.
+// They are only sent and accepted in 1-RTT packets.
+// Warning: This API should not be considered stable and might change soon.
+type CustomFrame interface {
+	// FrameType is the type of the frame.
+	FrameType() uint64
+	// Write writes the frame, without the frame type.
+	Write(b *bytes.Buffer) error
+	// Length is the length of the frame, without the frame type.
+	Length() ByteCount
+}
+
+// A CustomFrameDecoder parses a CustomFrame.
+// data is the rest of the packet payload following the frame type.
+// It must only parse a single frame: the Length of the returned frame is the number of bytes consumed.
+type CustomFrameDecoder func(data []byte) (CustomFrame, error)
+
+// RegisterFrameType registers the decoder for a frame type of a QUIC extension.
+// When a frame of this type is received, it is parsed using decode, and passed to Config.OnCustomFrame.
+// If decode returns an error, the connection is closed with a FRAME_ENCODING_ERROR.
+// Receiving a frame of a type that is not registered also closes the connection.
+// It panics if the frame type is defined by QUIC, or reserved for GREASE frames.
+// Warning: This API should not be considered stable and might change soon.
+func (c *Config) RegisterFrameType(frameType uint64, decode CustomFrameDecoder) {
+	if !wire.IsExtensionFrameType(frameType) {
+		panic(fmt.Sprintf("frame type 0x%x can't be used for custom frames", frameType))
+	}
+	if c.customFrameTypes == nil {
+		c.customFrameTypes = make(map[uint64]CustomFrameDecoder)
+	}
+	c.customFrameTypes[frameType] = decode
+}
+
+// extensionFrameDecoders returns the decoders of the registered frame types, for use by the frame parser
+func (c *Config) extensionFrameDecoders() map[uint64]wire.ExtensionFrameDecoder {
+	if len(c.customFrameTypes) == 0 {
+		return nil
+	}
+	decoders := make(map[uint64]wire.ExtensionFrameDecoder, len(c.customFrameTypes))
+	for frameType, decode := range c.customFrameTypes {
+		decode := decode
+		decoders[frameType] = func(data []byte) (wire.ExtensionFrame, error) {
+			f, err := decode(data)
+			if err != nil {
+				return nil, err
+			}
+			return f, nil
+		}
+	}
+	return decoders
+}
+
+func (s *session) SendCustomFrame(frame CustomFrame) error {
+	if !wire.IsExtensionFrameType(frame.FrameType()) {
+		return fmt.Errorf("frame type 0x%x can't be used for custom frames", frame.FrameType())
+	}
+	f := &wire.CustomFrame{Frame: frame}
+	if f.Length(s.version) > protocol.MaxCustomFrameSize {
+		return errors.New("custom frame too large")
+	}
+	s.framer.QueueCustomFrame(f)
+	s.scheduleSending()
+	return nil
+}
+
+func (s *session) handleCustomFrame(frame *wire.CustomFrame) {
+	if s.config.OnCustomFrame != nil {
+		s.config.OnCustomFrame(s, frame.Frame.(CustomFrame))
+	}
+}
@@ -0,0 +1,74 @@
+package quic
+
+import (
+	"bytes"
+	"errors"
+
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+	"github.com/lucas-clemente/quic-go/internal/wire"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// testCustomFrame is a CustomFrame that extends to the end of the packet
+type testCustomFrame struct {
+	frameType uint64
+	data      []byte
+}
+
+var _ CustomFrame = &testCustomFrame{}
+
+func (f *testCustomFrame) FrameType() uint64 { return f.frameType }
+
+func (f *testCustomFrame) Write(b *bytes.Buffer) error {
+	b.Write(f.data)
+	return nil
+}
+
+func (f *testCustomFrame) Length() ByteCount { return protocol.ByteCount(len(f.data)) }
+
+var _ = Describe("Custom frames", func() {
+	It("registers frame types", func() {
+		c := &Config{}
+		c.RegisterFrameType(0x42, func(data []byte) (CustomFrame, error) {
+			return &testCustomFrame{frameType: 0x42, data: data}, nil
+		})
+		c.RegisterFrameType(0x1337, func([]byte) (CustomFrame, error) {
+			return nil, errors.New("invalid frame")
+		})
+		decoders := c.extensionFrameDecoders()
+		Expect(decoders).To(HaveLen(2))
+		f, err := decoders[0x42]([]byte("foobar"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(f).To(Equal(&testCustomFrame{frameType: 0x42, data: []byte("foobar")}))
+		f, err = decoders[0x1337]([]byte("foobar"))
+		Expect(err).To(MatchError("invalid frame"))
+		Expect(f).To(BeNil())
+	})
+
+	It("doesn't return any decoders if no frame types are registered", func() {
+		Expect((&Config{}).extensionFrameDecoders()).To(BeNil())
+	})
+
+	It("refuses to register frame types defined by QUIC", func() {
+		decode := func([]byte) (CustomFrame, error) { return nil, nil }
+		Expect(func() { (&Config{}).RegisterFrameType(0x1, decode) }).To(Panic())
+		Expect(func() { (&Config{}).RegisterFrameType(0x30, decode) }).To(Panic())
+		// a GREASE frame type
+		Expect(func() { (&Config{}).RegisterFrameType(0x1f+0x1b, decode) }).To(Panic())
+	})
+
+	It("wraps the frames for the frame parser", func() {
+		c := &Config{}
+		c.RegisterFrameType(0x42, func(data []byte) (CustomFrame, error) {
+			return &testCustomFrame{frameType: 0x42, data: data}, nil
+		})
+		b := &bytes.Buffer{}
+		Expect((&wire.CustomFrame{Frame: &testCustomFrame{frameType: 0x42, data: []byte("foobar")}}).Write(b, protocol.VersionTLS)).To(Succeed())
+		parser := wire.NewFrameParser(false, false, c.extensionFrameDecoders(), protocol.PerspectiveClient, protocol.VersionTLS)
+		frame, err := parser.ParseNext(bytes.NewReader(b.Bytes()), protocol.Encryption1RTT)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(frame).To(Equal(&wire.CustomFrame{Frame: &testCustomFrame{frameType: 0x42, data: []byte("foobar")}}))
+	})
+})
@@ -0,0 +1,61 @@
+package quic
+
+import (
+	"bytes"
+	"errors"
+	"math"
+
+	"github.com/lucas-clemente/quic-go/internal/utils"
+)
+
+var errSessionClosedBeforeDatagramReceived = errors.New("session closed before a DATAGRAM frame was received")
+
+// A datagramSender sends unreliable messages in DATAGRAM frames.
+// This is only possible if the peer advertised the max_datagram_frame_size transport parameter.
+type datagramSender interface {
+	datagramsSupported() bool
+	sendDatagram([]byte) error
+}
+
+// A DatagramOrStreamSender sends unreliable messages.
+// If the peer supports DATAGRAM frames, a message is sent in a DATAGRAM frame.
+// Otherwise, a new unidirectional stream is opened for every message.
+// The stream contains the length of the message (as a 4 byte big-endian integer), followed by the message,
+// and it is closed right after the message was written.
+// Note that messages sent on streams are retransmitted when lost.
+type DatagramOrStreamSender struct {
+	sess Session
+}
+
+// NewDatagramOrStreamSender creates a new DatagramOrStreamSender for a session.
+func NewDatagramOrStreamSender(sess Session) *DatagramOrStreamSender {
+	return &DatagramOrStreamSender{sess: sess}
+}
+
+// Send sends a message.
+// If the peer's stream limit is reached, it returns an error, and the message is not sent.
+// Messages sent in DATAGRAM frames are limited in size, and an error is returned if the message is too large,
+// or if too many messages are already queued for sending.
+func (s *DatagramOrStreamSender) Send(p []byte) error {
+	if ds, ok := s.sess.(datagramSender); ok && ds.datagramsSupported() {
+		return ds.sendDatagram(p)
+	}
+	return s.sendOnStream(p)
+}
+
+func (s *DatagramOrStreamSender) sendOnStream(p []byte) error {
+	if uint64(len(p)) > math.MaxUint32 {
+		return errors.New("message too large")
+	}
+	str, err := s.sess.OpenUniStream()
+	if err != nil {
+		return err
+	}
+	b := bytes.NewBuffer(make([]byte, 0, 4+len(p)))
+	utils.BigEndian.WriteUint32(b, uint32(len(p)))
+	b.Write(p)
+	if _, err := str.Write(b.Bytes()); err != nil {
+		return err
+	}
+	return str.Close()
+}
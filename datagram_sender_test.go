@@ -0,0 +1,84 @@
+package quic
+
+import (
+	"errors"
+
+	"github.com/golang/mock/gomock"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type mockDatagramSession struct {
+	*MockQuicSession
+	supported bool
+	sent      [][]byte
+}
+
+var _ datagramSender = &mockDatagramSession{}
+
+func (s *mockDatagramSession) datagramsSupported() bool { return s.supported }
+
+func (s *mockDatagramSession) sendDatagram(p []byte) error {
+	s.sent = append(s.sent, p)
+	return nil
+}
+
+var _ = Describe("Datagram or Stream Sender", func() {
+	var (
+		sess   *MockQuicSession
+		sender *DatagramOrStreamSender
+	)
+
+	BeforeEach(func() {
+		sess = NewMockQuicSession(mockCtrl)
+		sender = NewDatagramOrStreamSender(sess)
+	})
+
+	It("sends a message on a new unidirectional stream", func() {
+		str := NewMockSendStreamI(mockCtrl)
+		sess.EXPECT().OpenUniStream().Return(str, nil)
+		gomock.InOrder(
+			str.EXPECT().Write([]byte{0, 0, 0, 6, 'f', 'o', 'o', 'b', 'a', 'r'}).Return(10, nil),
+			str.EXPECT().Close(),
+		)
+		Expect(sender.Send([]byte("foobar"))).To(Succeed())
+	})
+
+	It("sends empty messages", func() {
+		str := NewMockSendStreamI(mockCtrl)
+		sess.EXPECT().OpenUniStream().Return(str, nil)
+		str.EXPECT().Write([]byte{0, 0, 0, 0}).Return(4, nil)
+		str.EXPECT().Close()
+		Expect(sender.Send(nil)).To(Succeed())
+	})
+
+	It("returns the error when opening the stream fails", func() {
+		testErr := errors.New("too many open streams")
+		sess.EXPECT().OpenUniStream().Return(nil, testErr)
+		Expect(sender.Send([]byte("foobar"))).To(MatchError(testErr))
+	})
+
+	It("returns write errors", func() {
+		testErr := errors.New("write error")
+		str := NewMockSendStreamI(mockCtrl)
+		sess.EXPECT().OpenUniStream().Return(str, nil)
+		str.EXPECT().Write(gomock.Any()).Return(0, testErr)
+		Expect(sender.Send([]byte("foobar"))).To(MatchError(testErr))
+	})
+
+	It("sends DATAGRAM frames if the peer supports them", func() {
+		dsess := &mockDatagramSession{MockQuicSession: sess, supported: true}
+		Expect(NewDatagramOrStreamSender(dsess).Send([]byte("foobar"))).To(Succeed())
+		Expect(dsess.sent).To(Equal([][]byte{[]byte("foobar")}))
+	})
+
+	It("uses streams if the peer doesn't support DATAGRAM frames", func() {
+		dsess := &mockDatagramSession{MockQuicSession: sess}
+		str := NewMockSendStreamI(mockCtrl)
+		sess.EXPECT().OpenUniStream().Return(str, nil)
+		str.EXPECT().Write(gomock.Any()).Return(10, nil)
+		str.EXPECT().Close()
+		Expect(NewDatagramOrStreamSender(dsess).Send([]byte("foobar"))).To(Succeed())
+		Expect(dsess.sent).To(BeEmpty())
+	})
+})
@@ -0,0 +1,6 @@
+// +build debug
+
+package quic
+
+// debugChecks enables additional consistency checks, which are too expensive for production builds.
+const debugChecks = true
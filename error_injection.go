@@ -0,0 +1,96 @@
+// +build internal_test
+
+package quic
+
+import (
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+	"github.com/lucas-clemente/quic-go/internal/qerr"
+)
+
+// An ErrorInjector injects errors into a session.
+// It is implemented by all sessions in builds with the internal_test build tag, and allows testing how an application handles errors.
+// The methods return an error unless error injection was enabled using EnableErrorInjection.
+type ErrorInjector interface {
+	// TestInjectClose closes the session with a transport error.
+	// The CONNECTION_CLOSE is sent immediately, regardless of any outstanding data.
+	TestInjectClose(code uint64, reason string) error
+	// TestInjectPacketLoss declares a 1-RTT packet lost, without waiting for loss detection.
+	TestInjectPacketLoss(pn PacketNumber) error
+}
+
+// A StreamErrorInjector injects errors into a stream.
+// It is implemented by all streams that can be written to, in builds with the internal_test build tag.
+type StreamErrorInjector interface {
+	// TestInjectReset sends a RESET_STREAM frame.
+	TestInjectReset(code ErrorCode) error
+}
+
+// lossDeclarer is implemented by the sent packet handler in builds with the internal_test build tag.
+type lossDeclarer interface {
+	DeclareLost(protocol.PacketNumber) error
+}
+
+var errErrorInjectionDisabled = errors.New("error injection not enabled for this session")
+
+// EnableErrorInjection returns a copy of the config that enables error injection
+// (see ErrorInjector and StreamErrorInjector) for sessions created using this config.
+// The TB is stored in the context of these sessions. It must only be used in tests.
+func EnableErrorInjection(config *Config, tb TB) *Config {
+	var c Config
+	if config != nil {
+		c = *config
+	}
+	c.testingTB = tb
+	return &c
+}
+
+func (s *session) TestInjectClose(code uint64, reason string) error {
+	tb := s.testingTB()
+	if tb == nil {
+		return errErrorInjectionDisabled
+	}
+	tb.Helper()
+	if code > math.MaxUint16 {
+		return fmt.Errorf("invalid error code: %d", code)
+	}
+	tb.Logf("Injecting CONNECTION_CLOSE with error code %d: %s", code, reason)
+	s.closeLocal(qerr.Error(qerr.ErrorCode(code), reason))
+	return nil
+}
+
+func (s *session) TestInjectPacketLoss(pn PacketNumber) error {
+	tb := s.testingTB()
+	if tb == nil {
+		return errErrorInjectionDisabled
+	}
+	tb.Helper()
+	tb.Logf("Injecting loss of packet %#x", pn)
+	// The sent packet handler is not thread-safe. Declare the packet lost on the run loop.
+	var err error
+	if rerr := s.runOnRunLoop(func() {
+		ld, ok := s.sentPacketHandler.(lossDeclarer)
+		if !ok {
+			err = errors.New("the sent packet handler doesn't support declaring packets lost")
+			return
+		}
+		err = ld.DeclareLost(pn)
+	}); rerr != nil {
+		return rerr
+	}
+	return err
+}
+
+func (s *sendStream) TestInjectReset(code ErrorCode) error {
+	tb := s.sender.testingTB()
+	if tb == nil {
+		return errErrorInjectionDisabled
+	}
+	tb.Helper()
+	tb.Logf("Injecting RESET_STREAM for stream %d with error code %d", s.streamID, code)
+	s.CancelWrite(code)
+	return nil
+}
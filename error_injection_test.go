@@ -0,0 +1,214 @@
+// +build internal_test
+
+package quic
+
+import (
+	"context"
+	"errors"
+
+	"github.com/golang/mock/gomock"
+	"github.com/lucas-clemente/quic-go/internal/ackhandler"
+	"github.com/lucas-clemente/quic-go/internal/handshake"
+	"github.com/lucas-clemente/quic-go/internal/mocks"
+	mockackhandler "github.com/lucas-clemente/quic-go/internal/mocks/ackhandler"
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+	"github.com/lucas-clemente/quic-go/internal/qerr"
+	"github.com/lucas-clemente/quic-go/internal/utils"
+	"github.com/lucas-clemente/quic-go/internal/wire"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// lossDeclaringSentPacketHandler adds the DeclareLost method to the mock sent packet handler
+type lossDeclaringSentPacketHandler struct {
+	*mockackhandler.MockSentPacketHandler
+	declareLost func(protocol.PacketNumber) error
+}
+
+func (h *lossDeclaringSentPacketHandler) DeclareLost(pn protocol.PacketNumber) error {
+	return h.declareLost(pn)
+}
+
+var _ = Describe("Error injection", func() {
+	It("enables error injection", func() {
+		tb := &testTB{}
+		config := &Config{IdleTimeout: 1337}
+		c := EnableErrorInjection(config, tb)
+		Expect(c.testingTB).To(Equal(tb))
+		Expect(c.IdleTimeout).To(BeEquivalentTo(1337))
+		Expect(config.testingTB).To(BeNil())
+		c = populateClientConfig(c, false)
+		Expect(c.testingTB).To(Equal(tb))
+	})
+
+	Context("sessions", func() {
+		var (
+			sess          *session
+			tb            *testTB
+			sessionRunner *MockSessionRunner
+			mconn         *mockConnection
+			streamManager *MockStreamManager
+			packer        *MockPacker
+			cryptoSetup   *mocks.MockCryptoSetup
+			sph           *mockackhandler.MockSentPacketHandler
+		)
+
+		BeforeEach(func() {
+			Eventually(areSessionsRunning).Should(BeFalse())
+
+			sessionRunner = NewMockSessionRunner(mockCtrl)
+			mconn = newMockConnection()
+			pSess, err := newSession(
+				mconn,
+				sessionRunner,
+				protocol.ConnectionID{1, 2, 3, 4, 5, 6, 7, 8, 9, 10},
+				protocol.ConnectionID{8, 7, 6, 5, 4, 3, 2, 1},
+				protocol.ConnectionID{1, 2, 3, 4, 5, 6, 7, 8},
+				populateServerConfig(&Config{}),
+				nil, // tls.Config
+				&handshake.TransportParameters{},
+				utils.DefaultLogger,
+				protocol.VersionTLS,
+			)
+			Expect(err).NotTo(HaveOccurred())
+			sess = pSess.(*session)
+			tb = &testTB{}
+			sess.ctx = context.WithValue(sess.ctx, testingTBKey, tb)
+			streamManager = NewMockStreamManager(mockCtrl)
+			sess.streamsMap = streamManager
+			packer = NewMockPacker(mockCtrl)
+			sess.packer = packer
+			cryptoSetup = mocks.NewMockCryptoSetup(mockCtrl)
+			sess.cryptoStreamHandler = cryptoSetup
+			sph = mockackhandler.NewMockSentPacketHandler(mockCtrl)
+			sph.EXPECT().GetAlarmTimeout().AnyTimes()
+			sph.EXPECT().GetStats().AnyTimes()
+			sph.EXPECT().TimeUntilSend().AnyTimes()
+			sph.EXPECT().SendMode().Return(ackhandler.SendNone).AnyTimes()
+		})
+
+		AfterEach(func() {
+			Eventually(areSessionsRunning).Should(BeFalse())
+		})
+
+		runSession := func() {
+			go func() {
+				defer GinkgoRecover()
+				cryptoSetup.EXPECT().RunHandshake().Do(func() { <-sess.Context().Done() })
+				sess.run()
+			}()
+			Eventually(areSessionsRunning).Should(BeTrue())
+		}
+
+		closeSession := func() {
+			streamManager.EXPECT().CloseWithError(gomock.Any())
+			sessionRunner.EXPECT().Retire(gomock.Any())
+			cryptoSetup.EXPECT().Close()
+			packer.EXPECT().PackConnectionClose(gomock.Any()).Return(&packedPacket{}, nil)
+			Expect(sess.Close()).To(Succeed())
+			Eventually(areSessionsRunning).Should(BeFalse())
+		}
+
+		It("doesn't inject errors if not enabled", func() {
+			sess.ctx = context.Background()
+			Expect(sess.TestInjectClose(0x42, "foobar")).To(MatchError(errErrorInjectionDisabled))
+			Expect(sess.TestInjectPacketLoss(10)).To(MatchError(errErrorInjectionDisabled))
+			_, err := sess.TestCongestionState()
+			Expect(err).To(MatchError(errErrorInjectionDisabled))
+		})
+
+		It("injects a CONNECTION_CLOSE", func() {
+			runSession()
+			streamManager.EXPECT().CloseWithError(qerr.Error(0x42, "foobar"))
+			sessionRunner.EXPECT().Retire(gomock.Any())
+			cryptoSetup.EXPECT().Close()
+			packer.EXPECT().PackConnectionClose(&wire.ConnectionCloseFrame{
+				ErrorCode:    0x42,
+				ReasonPhrase: "foobar",
+			}).Return(&packedPacket{raw: []byte("connection close")}, nil)
+			Expect(sess.TestInjectClose(0x42, "foobar")).To(Succeed())
+			Eventually(areSessionsRunning).Should(BeFalse())
+			Expect(mconn.written).To(Receive(ContainSubstring("connection close")))
+			Expect(tb.logs).To(HaveLen(1))
+		})
+
+		It("refuses to inject invalid error codes", func() {
+			Expect(sess.TestInjectClose(1<<16, "foobar")).To(MatchError("invalid error code: 65536"))
+		})
+
+		It("injects packet loss", func() {
+			sph.EXPECT().GetCongestionWindow().AnyTimes()
+			sph.EXPECT().GetBytesInFlight().AnyTimes()
+			var lost []protocol.PacketNumber
+			testErr := errors.New("packet not outstanding")
+			sess.sentPacketHandler = &lossDeclaringSentPacketHandler{
+				MockSentPacketHandler: sph,
+				declareLost: func(pn protocol.PacketNumber) error {
+					lost = append(lost, pn)
+					if pn == 11 {
+						return testErr
+					}
+					return nil
+				},
+			}
+			runSession()
+			Expect(sess.TestInjectPacketLoss(10)).To(Succeed())
+			Expect(sess.TestInjectPacketLoss(11)).To(MatchError(testErr))
+			Expect(lost).To(Equal([]protocol.PacketNumber{10, 11}))
+			closeSession()
+			Expect(sess.TestInjectPacketLoss(12)).To(MatchError("session closed"))
+		})
+
+		It("returns the congestion control state", func() {
+			sph.EXPECT().GetCongestionWindow().Return(protocol.ByteCount(1000)).AnyTimes()
+			sph.EXPECT().GetBytesInFlight().Return(protocol.ByteCount(500)).AnyTimes()
+			sess.sentPacketHandler = sph
+			runSession()
+			sph.EXPECT().GetSlowStartThreshold().Return(protocol.ByteCount(800))
+			sph.EXPECT().GetCongestionState().Return(CongestionStateRecovery)
+			state, err := sess.TestCongestionState()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(state).To(Equal(CongestionControlState{
+				CWND:          1000,
+				Ssthresh:      800,
+				BytesInFlight: 500,
+				State:         CongestionStateRecovery,
+			}))
+			closeSession()
+			_, err = sess.TestCongestionState()
+			Expect(err).To(MatchError("session closed"))
+		})
+	})
+
+	Context("send streams", func() {
+		const streamID protocol.StreamID = 1337
+
+		var (
+			str        *sendStream
+			mockSender *MockStreamSender
+		)
+
+		BeforeEach(func() {
+			mockSender = NewMockStreamSender(mockCtrl)
+			str = newSendStream(streamID, mockSender, mocks.NewMockStreamFlowController(mockCtrl), nil, protocol.VersionWhatever)
+		})
+
+		It("injects a RESET_STREAM frame", func() {
+			mockSender.EXPECT().testingTB().Return(&testTB{})
+			mockSender.EXPECT().queueControlFrame(&wire.ResetStreamFrame{
+				StreamID:   streamID,
+				ByteOffset: 1234,
+				ErrorCode:  9876,
+			})
+			mockSender.EXPECT().onStreamCompleted(streamID, gomock.Not(gomock.Nil()))
+			str.writeOffset = 1234
+			Expect(str.TestInjectReset(9876)).To(Succeed())
+		})
+
+		It("doesn't inject a RESET_STREAM frame if error injection is disabled", func() {
+			mockSender.EXPECT().testingTB()
+			Expect(str.TestInjectReset(9876)).To(MatchError(errErrorInjectionDisabled))
+		})
+	})
+})
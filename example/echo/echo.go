@@ -18,6 +18,9 @@ const addr = "localhost:4242"
 
 const message = "foobar"
 
+// the application protocol negotiated using ALPN
+const nextProto = "quic-echo-example"
+
 // We start a server echoing data on the first stream the client opens,
 // then connect with a client, send the message, and wait for its receipt.
 func main() {
@@ -49,7 +52,11 @@ func echoServer() error {
 }
 
 func clientMain() error {
-	session, err := quic.DialAddr(addr, &tls.Config{InsecureSkipVerify: true}, nil)
+	tlsConf := &tls.Config{
+		InsecureSkipVerify: true,
+		NextProtos:         []string{nextProto},
+	}
+	session, err := quic.DialAddr(addr, tlsConf, nil)
 	if err != nil {
 		return err
 	}
@@ -101,5 +108,8 @@ func generateTLSConfig() *tls.Config {
 	if err != nil {
 		panic(err)
 	}
-	return &tls.Config{Certificates: []tls.Certificate{tlsCert}}
+	return &tls.Config{
+		Certificates: []tls.Certificate{tlsCert},
+		NextProtos:   []string{nextProto},
+	}
 }
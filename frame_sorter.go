@@ -11,6 +11,8 @@ type frameSorter struct {
 	queue   map[protocol.ByteCount][]byte
 	readPos protocol.ByteCount
 	gaps    *utils.ByteIntervalList
+	// the number of bytes in the queue
+	queuedBytes protocol.ByteCount
 }
 
 var errDuplicateStreamData = errors.New("Duplicate Stream Data")
@@ -88,7 +90,7 @@ func (s *frameSorter) push(data []byte, offset protocol.ByteCount) error {
 			break
 		}
 		// delete queued frames completely covered by the current frame
-		delete(s.queue, endGap.Value.End)
+		s.dequeue(endGap.Value.End)
 		endGap = nextEndGap
 	}
 
@@ -138,21 +140,48 @@ func (s *frameSorter) push(data []byte, offset protocol.ByteCount) error {
 		data = newData
 	}
 
+	s.dequeue(offset)
 	s.queue[offset] = data
+	s.queuedBytes += protocol.ByteCount(len(data))
 	return nil
 }
 
+func (s *frameSorter) dequeue(offset protocol.ByteCount) {
+	if data, ok := s.queue[offset]; ok {
+		delete(s.queue, offset)
+		s.queuedBytes -= protocol.ByteCount(len(data))
+	}
+}
+
 func (s *frameSorter) Pop() (protocol.ByteCount, []byte) {
 	data, ok := s.queue[s.readPos]
 	if !ok {
 		return s.readPos, nil
 	}
-	delete(s.queue, s.readPos)
+	s.dequeue(s.readPos)
 	offset := s.readPos
 	s.readPos += protocol.ByteCount(len(data))
 	return offset, data
 }
 
+// ContiguousLen returns the number of bytes that can be popped without hitting a gap.
+func (s *frameSorter) ContiguousLen() protocol.ByteCount {
+	var n protocol.ByteCount
+	for {
+		data, ok := s.queue[s.readPos+n]
+		if !ok {
+			return n
+		}
+		n += protocol.ByteCount(len(data))
+	}
+}
+
+// GapBytes returns the number of bytes that are queued, but can't be popped yet,
+// because data at a lower offset is still missing.
+func (s *frameSorter) GapBytes() protocol.ByteCount {
+	return s.queuedBytes - s.ContiguousLen()
+}
+
 // HasMoreData says if there is any more data queued at *any* offset.
 func (s *frameSorter) HasMoreData() bool {
 	return len(s.queue) > 0
@@ -19,6 +19,12 @@ var _ = Describe("STREAM frame sorter", func() {
 			Expect(gap.Value).To(Equal(expectedGaps[i]))
 			i++
 		}
+		// check the accounting of queued bytes
+		var queued protocol.ByteCount
+		for _, data := range s.queue {
+			queued += protocol.ByteCount(len(data))
+		}
+		Expect(s.queuedBytes).To(Equal(queued))
 	}
 
 	BeforeEach(func() {
@@ -70,6 +76,48 @@ var _ = Describe("STREAM frame sorter", func() {
 			Expect(s.HasMoreData()).To(BeFalse())
 		})
 
+		It("says how much data can be popped without hitting a gap", func() {
+			Expect(s.ContiguousLen()).To(BeZero())
+			Expect(s.Push([]byte("foo"), 0)).To(Succeed())
+			Expect(s.Push([]byte("lorem"), 10)).To(Succeed())
+			Expect(s.ContiguousLen()).To(Equal(protocol.ByteCount(3)))
+			Expect(s.Push([]byte("bar"), 3)).To(Succeed())
+			Expect(s.ContiguousLen()).To(Equal(protocol.ByteCount(6)))
+			_, data := s.Pop()
+			Expect(data).To(Equal([]byte("foo")))
+			Expect(s.ContiguousLen()).To(Equal(protocol.ByteCount(3)))
+			Expect(s.Push([]byte("abcd"), 6)).To(Succeed())
+			Expect(s.ContiguousLen()).To(Equal(protocol.ByteCount(12)))
+		})
+
+		It("says how much data is queued behind a gap", func() {
+			Expect(s.GapBytes()).To(BeZero())
+			Expect(s.Push([]byte("foo"), 0)).To(Succeed())
+			Expect(s.GapBytes()).To(BeZero())
+			Expect(s.Push([]byte("lorem"), 10)).To(Succeed())
+			Expect(s.Push([]byte("ipsum"), 20)).To(Succeed())
+			Expect(s.GapBytes()).To(Equal(protocol.ByteCount(10)))
+			// duplicate data doesn't count twice
+			Expect(s.Push([]byte("rem"), 12)).To(Succeed())
+			Expect(s.GapBytes()).To(Equal(protocol.ByteCount(10)))
+			// overlapping data only counts once
+			Expect(s.Push([]byte("foobarfoobar"), 5)).To(Succeed())
+			Expect(s.GapBytes()).To(Equal(protocol.ByteCount(17)))
+			// fill the first gap
+			Expect(s.Push([]byte("ab"), 3)).To(Succeed())
+			Expect(s.GapBytes()).To(Equal(protocol.ByteCount(5)))
+			for {
+				_, data := s.Pop()
+				if data == nil {
+					break
+				}
+			}
+			Expect(s.GapBytes()).To(Equal(protocol.ByteCount(5)))
+			Expect(s.Push([]byte("abcd"), 16)).To(Succeed())
+			Expect(s.GapBytes()).To(BeZero())
+			Expect(s.queuedBytes).To(Equal(protocol.ByteCount(8)))
+		})
+
 		Context("Gap handling", func() {
 			It("finds the first gap", func() {
 				Expect(s.Push([]byte("foobar"), 10)).To(Succeed())
@@ -1,6 +1,7 @@
 package quic
 
 import (
+	"container/heap"
 	"sync"
 
 	"github.com/lucas-clemente/quic-go/internal/protocol"
@@ -9,35 +10,66 @@ import (
 
 type framer interface {
 	QueueControlFrame(wire.Frame)
+	// QueueCustomFrame queues a frame of a QUIC extension.
+	// Custom frames are sent after the other control frames, in the order they were queued.
+	QueueCustomFrame(*wire.CustomFrame)
+	// QueueDatagramFrame queues a DATAGRAM frame.
+	// DATAGRAM frames are sent after the custom frames, in the order they were queued.
+	// It returns false if too many DATAGRAM frames are queued already.
+	QueueDatagramFrame(*wire.DatagramFrame) bool
 	AppendControlFrames([]wire.Frame, protocol.ByteCount) ([]wire.Frame, protocol.ByteCount)
 
 	AddActiveStream(protocol.StreamID)
 	AppendStreamFrames([]wire.Frame, protocol.ByteCount) []wire.Frame
+	// SetStreamPriority sets the priority of a stream, using the urgency and incremental parameters of RFC 9218.
+	// Streams with a lower urgency are served first.
+	// Incremental streams with the same urgency share the bandwidth,
+	// non-incremental streams are served one after the other.
+	SetStreamPriority(id protocol.StreamID, urgency uint8, incremental bool)
+	// RemoveStream is called when a stream is completed
+	RemoveStream(protocol.StreamID)
+
+	// TotalBufferedBytes returns the number of bytes buffered in the send buffers of all streams
+	TotalBufferedBytes() protocol.ByteCount
 }
 
 type framerI struct {
 	mutex sync.Mutex
 
-	streamGetter streamGetter
-	version      protocol.VersionNumber
+	streamGetter   streamGetter
+	connSendBuffer *connectionSendBuffer
+	version        protocol.VersionNumber
 
 	activeStreams map[protocol.StreamID]struct{}
-	streamQueue   []protocol.StreamID
+	// the active streams, grouped by their urgency
+	levels   priorityLevels
+	levelMap map[uint8]*priorityLevel
+
+	// The priorities are protected by a separate mutex, since RemoveStream is called
+	// from the stream's popStreamFrame, while AppendStreamFrames holds the mutex.
+	priorityMutex sync.Mutex
+	priorities    map[protocol.StreamID]streamPriority // only contains streams that don't use the default priority
 
 	controlFrameMutex sync.Mutex
 	controlFrames     []wire.Frame
+	customFrameQueue  []*wire.CustomFrame
+	datagramQueue     []*wire.DatagramFrame
 }
 
 var _ framer = &framerI{}
 
 func newFramer(
 	streamGetter streamGetter,
+	connSendBuffer *connectionSendBuffer,
 	v protocol.VersionNumber,
 ) framer {
 	return &framerI{
-		streamGetter:  streamGetter,
-		activeStreams: make(map[protocol.StreamID]struct{}),
-		version:       v,
+		streamGetter:   streamGetter,
+		connSendBuffer: connSendBuffer,
+		activeStreams:  make(map[protocol.StreamID]struct{}),
+		levelMap:       make(map[uint8]*priorityLevel),
+		priorities:     make(map[protocol.StreamID]streamPriority),
+		version:        v,
 	}
 }
 
@@ -47,6 +79,22 @@ func (f *framerI) QueueControlFrame(frame wire.Frame) {
 	f.controlFrameMutex.Unlock()
 }
 
+func (f *framerI) QueueCustomFrame(frame *wire.CustomFrame) {
+	f.controlFrameMutex.Lock()
+	f.customFrameQueue = append(f.customFrameQueue, frame)
+	f.controlFrameMutex.Unlock()
+}
+
+func (f *framerI) QueueDatagramFrame(frame *wire.DatagramFrame) bool {
+	f.controlFrameMutex.Lock()
+	defer f.controlFrameMutex.Unlock()
+	if len(f.datagramQueue) >= protocol.MaxDatagramSendQueueLen {
+		return false
+	}
+	f.datagramQueue = append(f.datagramQueue, frame)
+	return true
+}
+
 func (f *framerI) AppendControlFrames(frames []wire.Frame, maxLen protocol.ByteCount) ([]wire.Frame, protocol.ByteCount) {
 	var length protocol.ByteCount
 	f.controlFrameMutex.Lock()
@@ -60,6 +108,30 @@ func (f *framerI) AppendControlFrames(frames []wire.Frame, maxLen protocol.ByteC
 		length += frameLen
 		f.controlFrames = f.controlFrames[:len(f.controlFrames)-1]
 	}
+	// Custom frames are sent in order.
+	// If the next custom frame doesn't fit, it is sent in the next packet.
+	for len(f.customFrameQueue) > 0 {
+		frame := f.customFrameQueue[0]
+		frameLen := frame.Length(f.version)
+		if length+frameLen > maxLen {
+			break
+		}
+		frames = append(frames, frame)
+		length += frameLen
+		f.customFrameQueue[0] = nil
+		f.customFrameQueue = f.customFrameQueue[1:]
+	}
+	for len(f.datagramQueue) > 0 {
+		frame := f.datagramQueue[0]
+		frameLen := frame.Length(f.version)
+		if length+frameLen > maxLen {
+			break
+		}
+		frames = append(frames, frame)
+		length += frameLen
+		f.datagramQueue[0] = nil
+		f.datagramQueue = f.datagramQueue[1:]
+	}
 	f.controlFrameMutex.Unlock()
 	return frames, length
 }
@@ -67,43 +139,192 @@ func (f *framerI) AppendControlFrames(frames []wire.Frame, maxLen protocol.ByteC
 func (f *framerI) AddActiveStream(id protocol.StreamID) {
 	f.mutex.Lock()
 	if _, ok := f.activeStreams[id]; !ok {
-		f.streamQueue = append(f.streamQueue, id)
+		f.enqueue(id)
 		f.activeStreams[id] = struct{}{}
 	}
 	f.mutex.Unlock()
 }
 
+func (f *framerI) SetStreamPriority(id protocol.StreamID, urgency uint8, incremental bool) {
+	if urgency > protocol.MaxStreamUrgency {
+		urgency = protocol.MaxStreamUrgency
+	}
+	prio := streamPriority{urgency: urgency, incremental: incremental}
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.priorityMutex.Lock()
+	oldPrio, ok := f.priorities[id]
+	if !ok {
+		oldPrio = defaultStreamPriority
+	}
+	if prio == defaultStreamPriority {
+		delete(f.priorities, id)
+	} else {
+		f.priorities[id] = prio
+	}
+	f.priorityMutex.Unlock()
+
+	if _, ok := f.activeStreams[id]; !ok || oldPrio.urgency == prio.urgency {
+		return
+	}
+	// move the stream to the queue for its new urgency
+	f.dequeue(id, oldPrio.urgency)
+	f.enqueue(id)
+}
+
+func (f *framerI) RemoveStream(id protocol.StreamID) {
+	f.priorityMutex.Lock()
+	delete(f.priorities, id)
+	f.priorityMutex.Unlock()
+}
+
 func (f *framerI) AppendStreamFrames(frames []wire.Frame, maxLen protocol.ByteCount) []wire.Frame {
 	var length protocol.ByteCount
+	// streams that have data, but can't send any right now (e.g. because they're blocked by flow control)
+	var skipped []protocol.StreamID
 	f.mutex.Lock()
 	// pop STREAM frames, until less than MinStreamFrameSize bytes are left in the packet
-	numActiveStreams := len(f.streamQueue)
+	numActiveStreams := len(f.activeStreams)
 	for i := 0; i < numActiveStreams; i++ {
 		if maxLen-length < protocol.MinStreamFrameSize {
 			break
 		}
-		id := f.streamQueue[0]
-		f.streamQueue = f.streamQueue[1:]
+		if len(f.levels) == 0 {
+			break
+		}
+		level := f.levels[0] // the level with the lowest urgency
+		id := level.queue[0]
 		// This should never return an error. Better check it anyway.
-		// The stream will only be in the streamQueue, if it enqueued itself there.
+		// The stream will only be in the queue, if it enqueued itself there.
 		str, err := f.streamGetter.GetOrOpenSendStream(id)
 		// The stream can be nil if it completed after it said it had data.
 		if str == nil || err != nil {
+			f.dequeue(id, level.urgency)
 			delete(f.activeStreams, id)
+			f.RemoveStream(id)
 			continue
 		}
 		frame, hasMoreData := str.popStreamFrame(maxLen - length)
-		if hasMoreData { // put the stream back in the queue (at the end)
-			f.streamQueue = append(f.streamQueue, id)
-		} else { // no more data to send. Stream is not active any more
+		if !hasMoreData { // no more data to send. Stream is not active any more
+			f.dequeue(id, level.urgency)
 			delete(f.activeStreams, id)
+		} else if frame == nil {
+			// Skip the stream for the rest of this packet.
+			// Otherwise, it would be picked again, and starve streams with a higher urgency value.
+			f.dequeue(id, level.urgency)
+			skipped = append(skipped, id)
+		} else if f.getPriority(id).incremental { // put the stream back in the queue (at the end)
+			level.queue = append(level.queue[1:], id)
 		}
+		// A non-incremental stream stays at the front of the queue, until it has sent all its data.
 		if frame == nil { // can happen if the receiveStream was canceled after it said it had data
 			continue
 		}
 		frames = append(frames, frame)
 		length += frame.Length(f.version)
 	}
+	// Put the skipped streams back at the front of their queues, so they don't lose their position.
+	for i := len(skipped) - 1; i >= 0; i-- {
+		f.enqueueFront(skipped[i])
+	}
 	f.mutex.Unlock()
 	return frames
 }
+
+func (f *framerI) getPriority(id protocol.StreamID) streamPriority {
+	f.priorityMutex.Lock()
+	defer f.priorityMutex.Unlock()
+	if prio, ok := f.priorities[id]; ok {
+		return prio
+	}
+	return defaultStreamPriority
+}
+
+// enqueue adds a stream at the end of the queue for its urgency.
+func (f *framerI) enqueue(id protocol.StreamID) {
+	urgency := f.getPriority(id).urgency
+	level, ok := f.levelMap[urgency]
+	if !ok {
+		level = &priorityLevel{urgency: urgency}
+		f.levelMap[urgency] = level
+		heap.Push(&f.levels, level)
+	}
+	level.queue = append(level.queue, id)
+}
+
+// enqueueFront adds a stream at the front of the queue for its urgency.
+func (f *framerI) enqueueFront(id protocol.StreamID) {
+	f.enqueue(id)
+	level := f.levelMap[f.getPriority(id).urgency]
+	copy(level.queue[1:], level.queue[:len(level.queue)-1])
+	level.queue[0] = id
+}
+
+// dequeue removes a stream from the queue for the given urgency.
+func (f *framerI) dequeue(id protocol.StreamID, urgency uint8) {
+	level, ok := f.levelMap[urgency]
+	if !ok {
+		return
+	}
+	for i, qid := range level.queue {
+		if qid == id {
+			level.queue = append(level.queue[:i], level.queue[i+1:]...)
+			break
+		}
+	}
+	if len(level.queue) == 0 {
+		heap.Remove(&f.levels, level.index)
+		delete(f.levelMap, urgency)
+	}
+}
+
+func (f *framerI) TotalBufferedBytes() protocol.ByteCount {
+	return f.connSendBuffer.Len()
+}
+
+type streamPriority struct {
+	urgency     uint8
+	incremental bool
+}
+
+// defaultStreamPriority is the priority defined in RFC 9218, Section 4.
+// Since all streams are incremental by default, streams are served round-robin.
+var defaultStreamPriority = streamPriority{urgency: protocol.DefaultStreamUrgency, incremental: true}
+
+// A priorityLevel holds the active streams with the same urgency.
+type priorityLevel struct {
+	urgency uint8
+	queue   []protocol.StreamID
+	index   int // the index in the priorityLevels heap
+}
+
+// priorityLevels is a min-heap of priorityLevel, ordered by urgency.
+type priorityLevels []*priorityLevel
+
+var _ heap.Interface = &priorityLevels{}
+
+func (h priorityLevels) Len() int           { return len(h) }
+func (h priorityLevels) Less(i, j int) bool { return h[i].urgency < h[j].urgency }
+
+func (h priorityLevels) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *priorityLevels) Push(x interface{}) {
+	level := x.(*priorityLevel)
+	level.index = len(*h)
+	*h = append(*h, level)
+}
+
+func (h *priorityLevels) Pop() interface{} {
+	old := *h
+	n := len(old)
+	level := old[n-1]
+	old[n-1] = nil
+	*h = old[:n-1]
+	return level
+}
@@ -2,10 +2,12 @@ package quic
 
 import (
 	"bytes"
+	"fmt"
 
 	"github.com/golang/mock/gomock"
 
 	"github.com/lucas-clemente/quic-go/internal/protocol"
+	"github.com/lucas-clemente/quic-go/internal/utils"
 	"github.com/lucas-clemente/quic-go/internal/wire"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
@@ -19,6 +21,7 @@ var _ = Describe("Stream Framer", func() {
 
 	var (
 		framer           framer
+		connSendBuffer   *connectionSendBuffer
 		stream1, stream2 *MockSendStreamI
 		streamGetter     *MockStreamGetter
 		version          protocol.VersionNumber
@@ -30,7 +33,16 @@ var _ = Describe("Stream Framer", func() {
 		stream1.EXPECT().StreamID().Return(protocol.StreamID(5)).AnyTimes()
 		stream2 = NewMockSendStreamI(mockCtrl)
 		stream2.EXPECT().StreamID().Return(protocol.StreamID(6)).AnyTimes()
-		framer = newFramer(streamGetter, version)
+		connSendBuffer = newConnectionSendBuffer(protocol.MaxByteCount)
+		framer = newFramer(streamGetter, connSendBuffer, version)
+	})
+
+	It("reports the number of bytes buffered in all streams", func() {
+		Expect(framer.TotalBufferedBytes()).To(BeZero())
+		connSendBuffer.add(1000)
+		Expect(framer.TotalBufferedBytes()).To(Equal(protocol.ByteCount(1000)))
+		connSendBuffer.remove(400)
+		Expect(framer.TotalBufferedBytes()).To(Equal(protocol.ByteCount(600)))
 	})
 
 	Context("handling control frames", func() {
@@ -69,6 +81,61 @@ var _ = Describe("Stream Framer", func() {
 			Expect(frames).To(HaveLen(1))
 			Expect(length).To(Equal(bfLen))
 		})
+
+		It("adds custom frames after the other control frames, in order", func() {
+			cf1 := &wire.CustomFrame{Frame: &testCustomFrame{frameType: 0x42, data: []byte("foo")}}
+			cf2 := &wire.CustomFrame{Frame: &testCustomFrame{frameType: 0x42, data: []byte("bar")}}
+			mdf := &wire.MaxDataFrame{ByteOffset: 0x42}
+			framer.QueueCustomFrame(cf1)
+			framer.QueueCustomFrame(cf2)
+			framer.QueueControlFrame(mdf)
+			frames, length := framer.AppendControlFrames(nil, 1000)
+			Expect(frames).To(Equal([]wire.Frame{mdf, cf1, cf2}))
+			Expect(length).To(Equal(mdf.Length(version) + cf1.Length(version) + cf2.Length(version)))
+		})
+
+		It("doesn't reorder custom frames if the next one doesn't fit", func() {
+			cf1 := &wire.CustomFrame{Frame: &testCustomFrame{frameType: 0x42, data: make([]byte, 100)}}
+			cf2 := &wire.CustomFrame{Frame: &testCustomFrame{frameType: 0x42, data: []byte("foo")}}
+			framer.QueueCustomFrame(cf1)
+			framer.QueueCustomFrame(cf2)
+			frames, _ := framer.AppendControlFrames(nil, 50)
+			Expect(frames).To(BeEmpty())
+			frames, _ = framer.AppendControlFrames(nil, 1000)
+			Expect(frames).To(Equal([]wire.Frame{cf1, cf2}))
+		})
+	})
+
+	Context("popping DATAGRAM frames", func() {
+		It("adds DATAGRAM frames after the other control frames, in order", func() {
+			df1 := &wire.DatagramFrame{DataLenPresent: true, Data: []byte("foo")}
+			df2 := &wire.DatagramFrame{DataLenPresent: true, Data: []byte("bar")}
+			mdf := &wire.MaxDataFrame{ByteOffset: 0x42}
+			Expect(framer.QueueDatagramFrame(df1)).To(BeTrue())
+			Expect(framer.QueueDatagramFrame(df2)).To(BeTrue())
+			framer.QueueControlFrame(mdf)
+			frames, length := framer.AppendControlFrames(nil, 1000)
+			Expect(frames).To(Equal([]wire.Frame{mdf, df1, df2}))
+			Expect(length).To(Equal(mdf.Length(version) + df1.Length(version) + df2.Length(version)))
+		})
+
+		It("doesn't reorder DATAGRAM frames if the next one doesn't fit", func() {
+			df1 := &wire.DatagramFrame{DataLenPresent: true, Data: make([]byte, 100)}
+			df2 := &wire.DatagramFrame{DataLenPresent: true, Data: []byte("foo")}
+			Expect(framer.QueueDatagramFrame(df1)).To(BeTrue())
+			Expect(framer.QueueDatagramFrame(df2)).To(BeTrue())
+			frames, _ := framer.AppendControlFrames(nil, 50)
+			Expect(frames).To(BeEmpty())
+			frames, _ = framer.AppendControlFrames(nil, 1000)
+			Expect(frames).To(Equal([]wire.Frame{df1, df2}))
+		})
+
+		It("limits the number of queued DATAGRAM frames", func() {
+			for i := 0; i < protocol.MaxDatagramSendQueueLen; i++ {
+				Expect(framer.QueueDatagramFrame(&wire.DatagramFrame{Data: []byte("foo")})).To(BeTrue())
+			}
+			Expect(framer.QueueDatagramFrame(&wire.DatagramFrame{Data: []byte("foo")})).To(BeFalse())
+		})
 	})
 
 	Context("popping STREAM frames", func() {
@@ -226,4 +293,267 @@ var _ = Describe("Stream Framer", func() {
 			Expect(fs).To(Equal([]wire.Frame{f}))
 		})
 	})
+
+	Context("prioritizing streams", func() {
+		const id3 = protocol.StreamID(12)
+
+		var stream3 *MockSendStreamI
+
+		BeforeEach(func() {
+			stream3 = NewMockSendStreamI(mockCtrl)
+			streamGetter.EXPECT().GetOrOpenSendStream(id1).Return(stream1, nil).AnyTimes()
+			streamGetter.EXPECT().GetOrOpenSendStream(id2).Return(stream2, nil).AnyTimes()
+			streamGetter.EXPECT().GetOrOpenSendStream(id3).Return(stream3, nil).AnyTimes()
+		})
+
+		// popStreamIDs pops n STREAM frames, each filling a whole packet, and returns the stream IDs
+		popStreamIDs := func(n int) []protocol.StreamID {
+			var ids []protocol.StreamID
+			for i := 0; i < n; i++ {
+				frames := framer.AppendStreamFrames(nil, protocol.MinStreamFrameSize)
+				Expect(frames).To(HaveLen(1))
+				ids = append(ids, frames[0].(*wire.StreamFrame).StreamID)
+			}
+			return ids
+		}
+
+		// sendData makes the stream return num frames, the last one without more data
+		sendData := func(str *MockSendStreamI, id protocol.StreamID, num int) {
+			for i := 0; i < num; i++ {
+				f := &wire.StreamFrame{StreamID: id, Data: []byte("foobar")}
+				str.EXPECT().popStreamFrame(gomock.Any()).Return(f, i < num-1)
+			}
+		}
+
+		It("serves a stream with a lower urgency first", func() {
+			sendData(stream1, id1, 2)
+			sendData(stream2, id2, 2)
+			sendData(stream3, id3, 3)
+			framer.AddActiveStream(id1)
+			framer.AddActiveStream(id2)
+			framer.SetStreamPriority(id3, 0, true)
+			framer.AddActiveStream(id3)
+			Expect(popStreamIDs(7)).To(Equal([]protocol.StreamID{id3, id3, id3, id1, id2, id1, id2}))
+		})
+
+		It("shares the bandwidth between incremental streams with the same urgency", func() {
+			sendData(stream1, id1, 4)
+			sendData(stream2, id2, 4)
+			framer.SetStreamPriority(id1, 0, true)
+			framer.SetStreamPriority(id2, 0, true)
+			framer.AddActiveStream(id1)
+			framer.AddActiveStream(id2)
+			ids := popStreamIDs(8)
+			Expect(ids).To(Equal([]protocol.StreamID{id1, id2, id1, id2, id1, id2, id1, id2}))
+		})
+
+		It("serves non-incremental streams with the same urgency one after the other", func() {
+			sendData(stream1, id1, 3)
+			sendData(stream2, id2, 3)
+			framer.SetStreamPriority(id1, 2, false)
+			framer.SetStreamPriority(id2, 2, false)
+			framer.AddActiveStream(id1)
+			framer.AddActiveStream(id2)
+			Expect(popStreamIDs(6)).To(Equal([]protocol.StreamID{id1, id1, id1, id2, id2, id2}))
+		})
+
+		It("skips a stream that can't send data right now, without changing its position", func() {
+			framer.SetStreamPriority(id1, 0, false)
+			framer.SetStreamPriority(id2, 0, false)
+			framer.AddActiveStream(id1)
+			framer.AddActiveStream(id2)
+			// stream 1 is blocked by flow control
+			stream1.EXPECT().popStreamFrame(gomock.Any()).Return(nil, true)
+			f := &wire.StreamFrame{StreamID: id2, Data: []byte("foobar")}
+			stream2.EXPECT().popStreamFrame(gomock.Any()).Return(f, true)
+			Expect(framer.AppendStreamFrames(nil, protocol.MinStreamFrameSize)).To(Equal([]wire.Frame{f}))
+			sendData(stream1, id1, 1)
+			sendData(stream2, id2, 1)
+			Expect(popStreamIDs(2)).To(Equal([]protocol.StreamID{id1, id2}))
+		})
+
+		It("moves an active stream when its urgency changes", func() {
+			sendData(stream1, id1, 2)
+			sendData(stream2, id2, 2)
+			framer.AddActiveStream(id1)
+			framer.AddActiveStream(id2)
+			framer.SetStreamPriority(id1, 7, true)
+			Expect(popStreamIDs(4)).To(Equal([]protocol.StreamID{id2, id2, id1, id1}))
+		})
+
+		It("caps the urgency at the maximum value", func() {
+			sendData(stream1, id1, 1)
+			sendData(stream2, id2, 1)
+			framer.SetStreamPriority(id1, 100, true)
+			framer.SetStreamPriority(id2, 7, true)
+			framer.AddActiveStream(id1)
+			framer.AddActiveStream(id2)
+			// both streams have the same urgency, and are served in the order they became active
+			Expect(popStreamIDs(2)).To(Equal([]protocol.StreamID{id1, id2}))
+		})
+
+		It("allows removing a stream while popping a STREAM frame", func() {
+			f := &wire.StreamFrame{StreamID: id1, Data: []byte("foobar")}
+			framer.SetStreamPriority(id1, 0, false)
+			// the send stream calls onStreamCompleted from popStreamFrame, after sending the FIN
+			stream1.EXPECT().popStreamFrame(gomock.Any()).DoAndReturn(func(protocol.ByteCount) (*wire.StreamFrame, bool) {
+				framer.RemoveStream(id1)
+				return f, false
+			})
+			framer.AddActiveStream(id1)
+			Expect(framer.AppendStreamFrames(nil, 1000)).To(Equal([]wire.Frame{f}))
+		})
+
+		It("forgets the priority when the stream is removed", func() {
+			framer.SetStreamPriority(id1, 7, false)
+			framer.RemoveStream(id1)
+			sendData(stream1, id1, 2)
+			sendData(stream2, id2, 2)
+			framer.AddActiveStream(id1)
+			framer.AddActiveStream(id2)
+			Expect(popStreamIDs(4)).To(Equal([]protocol.StreamID{id1, id2, id1, id2}))
+		})
+	})
+
+	// These tests simulate sending packets of a fixed size,
+	// and measure how the bandwidth is shared between the streams.
+	// They use the number of packets sent as a clock.
+	Context("scheduling", func() {
+		const (
+			packetSize         = 1200
+			packetsPerInterval = 100
+			dataLen            = 10 * (1 << 20)
+		)
+
+		// a dataStream is a send stream that has dataLen bytes to send
+		type dataStream struct {
+			id        protocol.StreamID
+			remaining protocol.ByteCount
+			sent      protocol.ByteCount
+			blocked   bool // blocked by flow control, with the STREAM_DATA_BLOCKED frame already sent
+		}
+
+		addStream := func(id protocol.StreamID) *dataStream {
+			ds := &dataStream{id: id, remaining: dataLen}
+			str := NewMockSendStreamI(mockCtrl)
+			str.EXPECT().popStreamFrame(gomock.Any()).DoAndReturn(func(maxLen protocol.ByteCount) (*wire.StreamFrame, bool) {
+				if ds.blocked {
+					return nil, true
+				}
+				f := &wire.StreamFrame{StreamID: id, Offset: dataLen - ds.remaining, DataLenPresent: true}
+				n := utils.MinByteCount(f.MaxDataLen(maxLen, version), ds.remaining)
+				f.Data = make([]byte, n)
+				ds.remaining -= n
+				ds.sent += n
+				return f, ds.remaining > 0
+			}).AnyTimes()
+			streamGetter.EXPECT().GetOrOpenSendStream(id).Return(str, nil).AnyTimes()
+			return ds
+		}
+
+		// sendPacket pops STREAM frames for one packet, and returns the number of bytes of STREAM data
+		sendPacket := func() protocol.ByteCount {
+			var n protocol.ByteCount
+			for _, f := range framer.AppendStreamFrames(nil, packetSize) {
+				n += f.(*wire.StreamFrame).DataLen()
+			}
+			return n
+		}
+
+		It("shares the bandwidth fairly between streams with the same priority", func() {
+			var streams []*dataStream
+			for i := 0; i < 5; i++ {
+				ds := addStream(protocol.StreamID(100 + 4*i))
+				framer.AddActiveStream(ds.id)
+				streams = append(streams, ds)
+			}
+			lastSent := make([]protocol.ByteCount, len(streams))
+			var numIntervals int
+			for {
+				var sent protocol.ByteCount
+				for i := 0; i < packetsPerInterval; i++ {
+					sent += sendPacket()
+				}
+				if sent == 0 {
+					break
+				}
+				numIntervals++
+				var numActive int
+				for _, ds := range streams {
+					if ds.remaining > 0 {
+						numActive++
+					}
+				}
+				if numActive < len(streams) { // the last interval, when the streams are finishing
+					continue
+				}
+				mean := float64(sent) / float64(len(streams))
+				for i, ds := range streams {
+					delivered := float64(ds.sent - lastSent[i])
+					Expect(delivered).To(BeNumerically("~", mean, mean/4), fmt.Sprintf("stream %d in interval %d", ds.id, numIntervals))
+					lastSent[i] = ds.sent
+				}
+			}
+			Expect(numIntervals).To(BeNumerically(">", 100))
+			for _, ds := range streams {
+				Expect(ds.remaining).To(BeZero())
+			}
+		})
+
+		It("serves a stream with the lowest urgency first", func() {
+			urgent := addStream(100)
+			background := addStream(104)
+			framer.SetStreamPriority(urgent.id, 0, true)
+			framer.SetStreamPriority(background.id, 7, true)
+			framer.AddActiveStream(background.id)
+			framer.AddActiveStream(urgent.id)
+			var packets, urgentCompleted int
+			for background.remaining > 0 {
+				Expect(sendPacket()).ToNot(BeZero())
+				packets++
+				if urgentCompleted == 0 && urgent.remaining == 0 {
+					urgentCompleted = packets
+					// the background stream didn't get a significant share of the bandwidth
+					Expect(background.sent).To(BeNumerically("<", dataLen/10))
+				}
+			}
+			Expect(urgentCompleted).ToNot(BeZero())
+			// The urgent stream completes as fast as if it was the only stream,
+			// i.e. after sending (about) half of the total data.
+			Expect(urgentCompleted).To(BeNumerically("<=", packets/2+1))
+		})
+
+		for _, incremental := range []bool{true, false} {
+			incremental := incremental
+
+			It(fmt.Sprintf("doesn't let a blocked stream starve streams with a higher urgency value (incremental: %t)", incremental), func() {
+				blocked := addStream(100)
+				blocked.blocked = true
+				other1 := addStream(104)
+				other2 := addStream(108)
+				framer.SetStreamPriority(blocked.id, 0, incremental)
+				framer.SetStreamPriority(other1.id, 1, true)
+				framer.SetStreamPriority(other2.id, 1, true)
+				framer.AddActiveStream(blocked.id)
+				framer.AddActiveStream(other1.id)
+				framer.AddActiveStream(other2.id)
+				for i := 0; i < packetsPerInterval; i++ {
+					Expect(sendPacket()).ToNot(BeZero())
+				}
+				Expect(blocked.sent).To(BeZero())
+				Expect(other1.sent).To(BeNumerically("~", other2.sent, packetSize))
+				Expect(other1.sent + other2.sent).To(BeNumerically(">", (packetsPerInterval-1)*(packetSize-protocol.MinStreamFrameSize)))
+				// the stream receives flow control credit
+				blocked.blocked = false
+				framer.AddActiveStream(blocked.id)
+				sent1, sent2 := other1.sent, other2.sent
+				for i := 0; i < packetsPerInterval; i++ {
+					Expect(sendPacket()).ToNot(BeZero())
+				}
+				Expect(blocked.sent).ToNot(BeZero())
+				Expect(other1.sent).To(Equal(sent1))
+				Expect(other2.sent).To(Equal(sent2))
+			})
+		}
+	})
 })
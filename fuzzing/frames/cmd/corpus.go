@@ -0,0 +1,71 @@
+// +build gofuzz
+
+package main
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/lucas-clemente/quic-go/fuzzing/frames"
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+	"github.com/lucas-clemente/quic-go/internal/wire"
+)
+
+const version = protocol.VersionTLS
+
+func getFrames() [][]wire.Frame {
+	sf := &wire.StreamFrame{StreamID: 4, Offset: 0x1337, Data: []byte("foobar"), DataLenPresent: true}
+	ack := &wire.AckFrame{AckRanges: []wire.AckRange{{Smallest: 1, Largest: 10}}}
+	return [][]wire.Frame{
+		{&wire.PingFrame{}},
+		{ack},
+		{&wire.CryptoFrame{Offset: 42, Data: []byte("lorem ipsum")}},
+		{sf},
+		{&wire.MaxDataFrame{ByteOffset: 0xdeadbeef}},
+		{&wire.ConnectionCloseFrame{ErrorCode: 0x42, ReasonPhrase: "foobar"}},
+		// GREASE frames, in front of, between and after other frames
+		{&wire.GreaseFrame{FrameType: 0x1f + 0x1b}},
+		{&wire.GreaseFrame{FrameType: 0x1f*42 + 0x1b}, &wire.PingFrame{}},
+		{ack, &wire.GreaseFrame{FrameType: 0x1f*500 + 0x1b}, sf},
+		{&wire.PingFrame{}, &wire.GreaseFrame{FrameType: 0x1f*0x20a + 0x1b}},
+		// frame types adjacent to GREASE frame types
+		{&wire.GreaseFrame{FrameType: 0x1b}},
+		{&wire.GreaseFrame{FrameType: 0x1f + 0x1a}},
+		{&wire.GreaseFrame{FrameType: 0x1f + 0x1c}},
+	}
+}
+
+func main() {
+	dir := filepath.Join("fuzzing", "frames", "corpus")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		log.Fatal(err)
+	}
+	for _, fs := range getFrames() {
+		b := &bytes.Buffer{}
+		for _, f := range fs {
+			if err := f.Write(b, version); err != nil {
+				log.Fatal(err)
+			}
+		}
+		// Write every payload for all encryption levels, with GREASE frames enabled and disabled,
+		// since that determines if GREASE frames are skipped.
+		for _, encLevel := range []protocol.EncryptionLevel{protocol.EncryptionInitial, protocol.EncryptionHandshake, protocol.Encryption1RTT} {
+			for _, supportsGreaseFrames := range []bool{false, true} {
+				data := append(frames.EncodePrefix(encLevel, supportsGreaseFrames), b.Bytes()...)
+				if err := writeCorpusFile(dir, data); err != nil {
+					log.Fatal(err)
+				}
+			}
+		}
+	}
+}
+
+func writeCorpusFile(dir string, data []byte) error {
+	filename := fmt.Sprintf("%x", sha1.Sum(data))
+	return ioutil.WriteFile(filepath.Join(dir, filename), data, 0644)
+}
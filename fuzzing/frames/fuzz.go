@@ -0,0 +1,75 @@
+// +build gofuzz
+
+package frames
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+	"github.com/lucas-clemente/quic-go/internal/wire"
+)
+
+const version = protocol.VersionTLS
+
+// PrefixLen is the number of bytes used for configuration
+const PrefixLen = 1
+
+// EncodePrefix encodes the configuration of the frame parser:
+// the encryption level, and if GREASE frames are enabled.
+func EncodePrefix(encLevel protocol.EncryptionLevel, supportsGreaseFrames bool) []byte {
+	b := byte(encLevel) & 0x3
+	if supportsGreaseFrames {
+		b |= 0x4
+	}
+	return []byte{b}
+}
+
+func decodePrefix(b byte) (protocol.EncryptionLevel, bool) {
+	encLevel := protocol.EncryptionLevel(b & 0x3)
+	if encLevel == protocol.EncryptionUnspecified {
+		encLevel = protocol.Encryption1RTT
+	}
+	return encLevel, b&0x4 > 0
+}
+
+// Fuzz fuzzes the QUIC frames.
+// The corpus is generated by running go run -tags gofuzz ./fuzzing/frames/cmd/corpus.go in the repository root.
+func Fuzz(data []byte) int {
+	if len(data) < PrefixLen {
+		return 0
+	}
+	encLevel, supportsGreaseFrames := decodePrefix(data[0])
+	data = data[PrefixLen:]
+
+	parser := wire.NewFrameParser(true, supportsGreaseFrames, nil, protocol.PerspectiveClient, version)
+	r := bytes.NewReader(data)
+	var frames []wire.Frame
+	for r.Len() > 0 {
+		f, err := parser.ParseNext(r, encLevel)
+		if err != nil {
+			break
+		}
+		if f == nil { // only PADDING (and GREASE) frames were left
+			if r.Len() != 0 {
+				panic("didn't consume all data")
+			}
+			break
+		}
+		frames = append(frames, f)
+	}
+	if len(frames) == 0 {
+		return 0
+	}
+
+	for _, f := range frames {
+		b := &bytes.Buffer{}
+		if err := f.Write(b, version); err != nil {
+			panic(err)
+		}
+		if protocol.ByteCount(b.Len()) != f.Length(version) {
+			panic(fmt.Sprintf("inconsistent frame length for %#v: expected %d, got %d", f, b.Len(), f.Length(version)))
+		}
+	}
+	return 1
+}
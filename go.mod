@@ -11,4 +11,6 @@ require (
 	github.com/onsi/gomega v1.4.3
 	golang.org/x/crypto v0.0.0-20190228161510-8dd112bcdc25
 	golang.org/x/net v0.0.0-20190228165749-92fc7df08ae7
+	golang.org/x/sys v0.0.0-20190228124157-a34e9553db1e
+	golang.org/x/time v0.0.0-20190921001708-c4c64cad1fd0
 )
@@ -0,0 +1,13 @@
+package autocert
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestAutocert(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Autocert Suite")
+}
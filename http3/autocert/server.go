@@ -0,0 +1,197 @@
+// Package autocert provides an HTTP/3 server that automatically obtains its certificates
+// from Let's Encrypt (or any other ACME CA), using golang.org/x/crypto/acme/autocert.
+package autocert
+
+import (
+	"crypto/tls"
+	"errors"
+	"net"
+	"net/http"
+	"sync"
+
+	quic "github.com/lucas-clemente/quic-go"
+	"github.com/lucas-clemente/quic-go/http3"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+const (
+	defaultAddr     = ":443"
+	defaultHTTPAddr = ":80"
+)
+
+// QuicAutocertServer serves HTTP/3 as well as HTTPS (over TCP) on the same port,
+// using certificates that are obtained automatically by an autocert.Manager.
+// Certificates are obtained on demand, when the first request for a domain is received,
+// so every domain is served with its own certificate.
+//
+// The ACME HTTP-01 challenge is answered by an HTTP/1.1 server on HTTPAddr,
+// which redirects all other requests to HTTPS.
+// HTTPS responses contain an Alt-Svc header advertising HTTP/3.
+type QuicAutocertServer struct {
+	// Manager obtains and caches the certificates.
+	// If nil, a Manager is created when Start is called. It accepts the CA's Terms of Service,
+	// only obtains certificates for the domains passed to Start, and stores them in CacheDir.
+	// If the Manager doesn't have a HostPolicy, Start sets it to only allow the domains passed to Start.
+	Manager *autocert.Manager
+	// CacheDir is the directory where the certificates are cached.
+	// It is only used if Manager is nil.
+	// If empty, certificates are not cached, and have to be obtained again every time the server is started.
+	// This is not recommended, since CAs impose rate limits.
+	CacheDir string
+	// Email is the contact address used when registering an account with the CA.
+	// It is only used if Manager is nil.
+	Email string
+
+	// Addr is the address that HTTP/3 (UDP) and HTTPS (TCP) are served on.
+	// If empty, ":443" is used.
+	Addr string
+	// HTTPAddr is the address of the HTTP/1.1 server answering the ACME HTTP-01 challenge.
+	// The CA always sends the challenge to port 80, so this address only needs to be changed
+	// if port 80 is forwarded to another port.
+	// If empty, ":80" is used.
+	HTTPAddr string
+	// QuicConfig is the QUIC configuration used by the HTTP/3 server.
+	// If nil, it uses reasonable default values.
+	QuicConfig *quic.Config
+
+	mutex           sync.Mutex
+	closed          bool
+	quicServer      *http3.Server
+	httpsServer     *http.Server
+	challengeServer *http.Server
+}
+
+// Start starts serving handler on Addr, for the given domains.
+// If handler is nil, http.DefaultServeMux is used.
+// Start blocks until one of the servers fails, or until Close is called.
+// It always returns a non-nil error. After Close, the returned error is http.ErrServerClosed.
+func (s *QuicAutocertServer) Start(domains []string, handler http.Handler) error {
+	if len(domains) == 0 {
+		return errors.New("autocert: no domains")
+	}
+	addr := s.Addr
+	if addr == "" {
+		addr = defaultAddr
+	}
+	httpAddr := s.HTTPAddr
+	if httpAddr == "" {
+		httpAddr = defaultHTTPAddr
+	}
+
+	udpAddr, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return err
+	}
+	udpConn, err := net.ListenUDP("udp", udpAddr)
+	if err != nil {
+		return err
+	}
+	tcpLn, err := net.Listen("tcp", addr)
+	if err != nil {
+		udpConn.Close()
+		return err
+	}
+	httpLn, err := net.Listen("tcp", httpAddr)
+	if err != nil {
+		udpConn.Close()
+		tcpLn.Close()
+		return err
+	}
+	return s.serve(domains, handler, udpConn, tcpLn, httpLn)
+}
+
+func (s *QuicAutocertServer) serve(domains []string, handler http.Handler, udpConn net.PacketConn, tcpLn, httpLn net.Listener) error {
+	defer udpConn.Close()
+
+	m := s.manager(domains)
+	if handler == nil {
+		handler = http.DefaultServeMux
+	}
+
+	quicServer := &http3.Server{
+		Server: &http.Server{
+			Handler:   handler,
+			TLSConfig: &tls.Config{GetCertificate: m.GetCertificate},
+		},
+		QuicConfig: s.QuicConfig,
+	}
+	httpsServer := &http.Server{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			quicServer.SetQuicHeaders(w.Header())
+			handler.ServeHTTP(w, r)
+		}),
+		// The TLS config contains the ALPN value for the ACME TLS-ALPN-01 challenge,
+		// so that certificates can also be obtained if port 80 is not reachable.
+		TLSConfig: m.TLSConfig(),
+	}
+	challengeServer := &http.Server{Handler: m.HTTPHandler(nil)}
+
+	s.mutex.Lock()
+	if s.closed {
+		s.mutex.Unlock()
+		tcpLn.Close()
+		httpLn.Close()
+		return http.ErrServerClosed
+	}
+	s.quicServer = quicServer
+	s.httpsServer = httpsServer
+	s.challengeServer = challengeServer
+	s.mutex.Unlock()
+
+	errChan := make(chan error, 3)
+	go func() { errChan <- quicServer.Serve(udpConn) }()
+	go func() { errChan <- httpsServer.ServeTLS(tcpLn, "", "") }()
+	go func() { errChan <- challengeServer.Serve(httpLn) }()
+	err := <-errChan
+
+	s.mutex.Lock()
+	closed := s.closed
+	s.mutex.Unlock()
+	if closed {
+		return http.ErrServerClosed
+	}
+	// One of the servers failed. Stop the other ones as well.
+	s.Close()
+	return err
+}
+
+func (s *QuicAutocertServer) manager(domains []string) *autocert.Manager {
+	if s.Manager != nil {
+		if s.Manager.HostPolicy == nil {
+			s.Manager.HostPolicy = autocert.HostWhitelist(domains...)
+		}
+		return s.Manager
+	}
+	m := &autocert.Manager{
+		Prompt:     autocert.AcceptTOS,
+		HostPolicy: autocert.HostWhitelist(domains...),
+		Email:      s.Email,
+	}
+	if s.CacheDir != "" {
+		m.Cache = autocert.DirCache(s.CacheDir)
+	}
+	s.Manager = m
+	return m
+}
+
+// Close immediately closes all servers.
+// The QuicAutocertServer can't be started again afterwards.
+func (s *QuicAutocertServer) Close() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+	if s.quicServer == nil {
+		return nil
+	}
+	err := s.quicServer.Close()
+	if e := s.httpsServer.Close(); e != nil && err == nil {
+		err = e
+	}
+	if e := s.challengeServer.Close(); e != nil && err == nil {
+		err = e
+	}
+	return err
+}
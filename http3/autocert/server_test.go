@@ -0,0 +1,249 @@
+package autocert
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	quic "github.com/lucas-clemente/quic-go"
+	"github.com/lucas-clemente/quic-go/http3"
+	"golang.org/x/crypto/acme/autocert"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// memCache is an in-memory autocert.Cache
+type memCache struct {
+	mutex sync.Mutex
+	data  map[string][]byte
+}
+
+var _ autocert.Cache = &memCache{}
+
+func (c *memCache) Get(_ context.Context, key string) ([]byte, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	data, ok := c.data[key]
+	if !ok {
+		return nil, autocert.ErrCacheMiss
+	}
+	return data, nil
+}
+
+func (c *memCache) Put(_ context.Context, key string, data []byte) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.data == nil {
+		c.data = make(map[string][]byte)
+	}
+	c.data[key] = data
+	return nil
+}
+
+func (c *memCache) Delete(_ context.Context, key string) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	delete(c.data, key)
+	return nil
+}
+
+// generateCertificate generates a self-signed certificate for the domain,
+// encoded in the format that the autocert.Manager uses for its cache:
+// the PEM-encoded private key, followed by the PEM-encoded certificate.
+func generateCertificate(domain string) (*x509.Certificate, []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	Expect(err).ToNot(HaveOccurred())
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: domain},
+		DNSNames:              []string{domain},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	certDER, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	Expect(err).ToNot(HaveOccurred())
+	cert, err := x509.ParseCertificate(certDER)
+	Expect(err).ToNot(HaveOccurred())
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	Expect(err).ToNot(HaveOccurred())
+	buf := &bytes.Buffer{}
+	Expect(pem.Encode(buf, &pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})).To(Succeed())
+	Expect(pem.Encode(buf, &pem.Block{Type: "CERTIFICATE", Bytes: certDER})).To(Succeed())
+	return cert, buf.Bytes()
+}
+
+var _ = Describe("QuicAutocertServer", func() {
+	const domain = "quic-go.example"
+
+	It("errors when no domains are given", func() {
+		Expect((&QuicAutocertServer{}).Start(nil, nil)).To(MatchError("autocert: no domains"))
+	})
+
+	Context("the autocert.Manager", func() {
+		It("creates a Manager that only allows the domains", func() {
+			s := &QuicAutocertServer{Email: "foo@example.com", CacheDir: "/tmp/certs"}
+			m := s.manager([]string{domain, "www." + domain})
+			Expect(s.Manager).To(Equal(m))
+			Expect(m.Email).To(Equal("foo@example.com"))
+			Expect(m.Cache).To(Equal(autocert.DirCache("/tmp/certs")))
+			Expect(m.Prompt("https://example.com/tos")).To(BeTrue())
+			Expect(m.HostPolicy(context.Background(), domain)).To(Succeed())
+			Expect(m.HostPolicy(context.Background(), "www."+domain)).To(Succeed())
+			Expect(m.HostPolicy(context.Background(), "example.com")).ToNot(Succeed())
+		})
+
+		It("doesn't cache certificates if no cache directory is given", func() {
+			m := (&QuicAutocertServer{}).manager([]string{domain})
+			Expect(m.Cache).To(BeNil())
+		})
+
+		It("uses the Manager, and sets its HostPolicy", func() {
+			m := &autocert.Manager{}
+			s := &QuicAutocertServer{Manager: m}
+			Expect(s.manager([]string{domain})).To(BeIdenticalTo(m))
+			Expect(m.HostPolicy).ToNot(BeNil())
+			Expect(m.HostPolicy(context.Background(), "example.com")).ToNot(Succeed())
+		})
+
+		It("doesn't overwrite the HostPolicy of the Manager", func() {
+			m := &autocert.Manager{HostPolicy: func(context.Context, string) error { return nil }}
+			s := &QuicAutocertServer{Manager: m}
+			s.manager([]string{domain})
+			Expect(m.HostPolicy(context.Background(), "example.com")).To(Succeed())
+		})
+	})
+
+	Context("serving", func() {
+		var (
+			server      *QuicAutocertServer
+			certPool    *x509.CertPool
+			udpConn     net.PacketConn
+			tcpLn       net.Listener
+			httpLn      net.Listener
+			serverErr   chan error
+			handlerFunc http.HandlerFunc
+		)
+
+		BeforeEach(func() {
+			cert, cacheEntry := generateCertificate(domain)
+			certPool = x509.NewCertPool()
+			certPool.AddCert(cert)
+			cache := &memCache{}
+			Expect(cache.Put(context.Background(), domain, cacheEntry)).To(Succeed())
+			server = &QuicAutocertServer{
+				Manager: &autocert.Manager{Prompt: autocert.AcceptTOS, Cache: cache},
+			}
+
+			var err error
+			udpConn, err = net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+			Expect(err).ToNot(HaveOccurred())
+			tcpLn, err = net.Listen("tcp", "127.0.0.1:0")
+			Expect(err).ToNot(HaveOccurred())
+			httpLn, err = net.Listen("tcp", "127.0.0.1:0")
+			Expect(err).ToNot(HaveOccurred())
+
+			handlerFunc = func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(fmt.Sprintf("Hello from %s", r.Proto)))
+			}
+			serverErr = make(chan error, 1)
+			go func() {
+				defer GinkgoRecover()
+				serverErr <- server.serve([]string{domain}, handlerFunc, udpConn, tcpLn, httpLn)
+			}()
+		})
+
+		AfterEach(func() {
+			Expect(server.Close()).To(Succeed())
+			Eventually(serverErr).Should(Receive(Equal(http.ErrServerClosed)))
+		})
+
+		tlsConf := func() *tls.Config {
+			return &tls.Config{RootCAs: certPool, ServerName: domain}
+		}
+
+		It("serves HTTPS, and advertises HTTP/3", func() {
+			client := &http.Client{
+				Transport: &http.Transport{
+					TLSClientConfig: tlsConf(),
+					DialContext: func(ctx context.Context, network, _ string) (net.Conn, error) {
+						return (&net.Dialer{}).DialContext(ctx, network, tcpLn.Addr().String())
+					},
+				},
+			}
+			rsp, err := client.Get(fmt.Sprintf("https://%s/", domain))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(rsp.StatusCode).To(Equal(http.StatusOK))
+			body, err := ioutil.ReadAll(rsp.Body)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(body)).To(HavePrefix("Hello from HTTP/"))
+			port := udpConn.LocalAddr().(*net.UDPAddr).Port
+			Expect(rsp.Header.Get("Alt-Svc")).To(ContainSubstring(fmt.Sprintf(`":%d"`, port)))
+		})
+
+		It("serves HTTP/3", func() {
+			rt := &http3.RoundTripper{
+				TLSClientConfig: tlsConf(),
+				Dial: func(_, _ string, tlsConf *tls.Config, conf *quic.Config) (quic.Session, error) {
+					return quic.DialAddr(udpConn.LocalAddr().String(), tlsConf, conf)
+				},
+			}
+			defer rt.Close()
+			rsp, err := (&http.Client{Transport: rt}).Get(fmt.Sprintf("https://%s/", domain))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(rsp.StatusCode).To(Equal(http.StatusOK))
+			body, err := ioutil.ReadAll(rsp.Body)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(body)).To(Equal("Hello from HTTP/3"))
+		})
+
+		It("answers ACME HTTP-01 challenges, and redirects other requests to HTTPS", func() {
+			client := &http.Client{
+				CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+			}
+			get := func(path string) *http.Response {
+				req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("http://%s%s", httpLn.Addr(), path), nil)
+				Expect(err).ToNot(HaveOccurred())
+				req.Host = domain
+				rsp, err := client.Do(req)
+				Expect(err).ToNot(HaveOccurred())
+				return rsp
+			}
+			// The challenge is unknown, since the Manager didn't request a certificate.
+			rsp := get("/.well-known/acme-challenge/foobar")
+			Expect(rsp.StatusCode).To(Equal(http.StatusNotFound))
+			rsp = get("/foo")
+			Expect(rsp.StatusCode).To(Equal(http.StatusFound))
+			Expect(rsp.Header.Get("Location")).To(Equal(fmt.Sprintf("https://%s/foo", domain)))
+		})
+
+		It("stops all servers when one of them fails", func() {
+			// closing the listener makes the HTTP server fail
+			Expect(httpLn.Close()).To(Succeed())
+			var err error
+			Eventually(serverErr).Should(Receive(&err))
+			Expect(err).ToNot(Equal(http.ErrServerClosed))
+			// the other servers were closed
+			_, err = net.Dial("tcp", tcpLn.Addr().String())
+			Expect(err).To(HaveOccurred())
+			serverErr <- http.ErrServerClosed // for the AfterEach
+		})
+	})
+})
@@ -2,7 +2,11 @@ package http3
 
 import (
 	"errors"
+	"fmt"
 	"io"
+	"net/http"
+
+	"golang.org/x/net/http/httpguts"
 )
 
 // The body of a http.Request or http.Response.
@@ -12,19 +16,31 @@ type body struct {
 	isRequest bool
 
 	bytesRemainingInFrame uint64
+
+	// maxHeaderBytes is the limit for the size of the trailers.
+	// If zero, the default limit is used.
+	maxHeaderBytes uint64
+
+	// onTrailers is called with the trailers, before Read returns io.EOF.
+	// It may be nil.
+	onTrailers func(http.Header)
 }
 
 var _ io.ReadCloser = &body{}
 
-func newRequestBody(str io.ReadCloser) *body {
+func newRequestBody(str io.ReadCloser, onTrailers func(http.Header)) *body {
 	return &body{
-		str:       str,
-		isRequest: true,
+		str:        str,
+		isRequest:  true,
+		onTrailers: onTrailers,
 	}
 }
 
-func newResponseBody(str io.ReadCloser) *body {
-	return &body{str: str}
+func newResponseBody(str io.ReadCloser, onTrailers func(http.Header)) *body {
+	return &body{
+		str:        str,
+		onTrailers: onTrailers,
+	}
 }
 
 func (r *body) Read(b []byte) (int, error) {
@@ -37,8 +53,11 @@ func (r *body) Read(b []byte) (int, error) {
 			}
 			switch f := frame.(type) {
 			case *headersFrame:
-				// skip HEADERS frames
-				continue
+				// A HEADERS frame following the header block contains the trailers.
+				if err := r.readTrailers(f); err != nil {
+					return 0, err
+				}
+				return 0, io.EOF
 			case *dataFrame:
 				r.bytesRemainingInFrame = f.Length
 				break parseLoop
@@ -66,3 +85,44 @@ func (r *body) Close() error {
 	}
 	return r.str.Close()
 }
+
+// readTrailers reads the trailers.
+// The HEADERS frame containing the trailers must be the last frame on the stream.
+func (r *body) readTrailers(hf *headersFrame) error {
+	maxHeaderBytes := r.maxHeaderBytes
+	if maxHeaderBytes == 0 {
+		maxHeaderBytes = http.DefaultMaxHeaderBytes
+	}
+	if hf.Length > maxHeaderBytes {
+		return errHeaderTooLarge
+	}
+	headerBlock := make([]byte, hf.Length)
+	if _, err := io.ReadFull(r.str, headerBlock); err != nil {
+		return err
+	}
+	hfs, err := decodeHeaders(headerBlock, maxHeaderBytes)
+	if err != nil {
+		return err
+	}
+	trailers := make(http.Header, len(hfs))
+	for _, hf := range hfs {
+		if hf.IsPseudo() {
+			return fmt.Errorf("invalid pseudo header in trailers: %s", hf.Name)
+		}
+		key := http.CanonicalHeaderKey(hf.Name)
+		if !httpguts.ValidTrailerHeader(key) {
+			return fmt.Errorf("invalid trailer: %s", key)
+		}
+		trailers.Add(key, hf.Value)
+	}
+	if _, err := parseNextFrame(r.str); err != io.EOF {
+		if err == nil {
+			err = errors.New("unexpected frame after the trailers")
+		}
+		return err
+	}
+	if r.onTrailers != nil {
+		r.onTrailers(trailers)
+	}
+	return nil
+}
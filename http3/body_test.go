@@ -3,6 +3,10 @@ package http3
 import (
 	"bytes"
 	"io"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/marten-seemann/qpack"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
@@ -24,8 +28,11 @@ const (
 )
 
 var _ = Describe("Body", func() {
-	var rb *body
-	var buf *bytes.Buffer
+	var (
+		rb       *body
+		buf      *bytes.Buffer
+		trailers http.Header
+	)
 
 	getDataFrame := func(data []byte) []byte {
 		b := &bytes.Buffer{}
@@ -34,6 +41,19 @@ var _ = Describe("Body", func() {
 		return b.Bytes()
 	}
 
+	getHeadersFrame := func(headers map[string]string) []byte {
+		headerBuf := &bytes.Buffer{}
+		enc := qpack.NewEncoder(headerBuf)
+		for name, value := range headers {
+			Expect(enc.WriteField(qpack.HeaderField{Name: name, Value: value})).To(Succeed())
+		}
+		Expect(enc.Close()).To(Succeed())
+		b := &bytes.Buffer{}
+		(&headersFrame{Length: uint64(headerBuf.Len())}).Write(b)
+		b.Write(headerBuf.Bytes())
+		return b.Bytes()
+	}
+
 	BeforeEach(func() {
 		buf = &bytes.Buffer{}
 	})
@@ -42,12 +62,14 @@ var _ = Describe("Body", func() {
 		bodyType := bt
 
 		BeforeEach(func() {
+			trailers = nil
+			onTrailers := func(t http.Header) { trailers = t }
 			cb := &closingBuffer{Buffer: buf}
 			switch bodyType {
 			case bodyTypeRequest:
-				rb = newRequestBody(cb)
+				rb = newRequestBody(cb, onTrailers)
 			case bodyTypeResponse:
-				rb = newResponseBody(cb)
+				rb = newResponseBody(cb, onTrailers)
 			}
 		})
 
@@ -109,16 +131,63 @@ var _ = Describe("Body", func() {
 			Expect(b[:n]).To(Equal([]byte("bar")))
 		})
 
-		It("skips HEADERS frames", func() {
+		It("reads trailers", func() {
 			buf.Write(getDataFrame([]byte("foo")))
-			(&headersFrame{Length: 10}).Write(buf)
-			buf.Write(make([]byte, 10))
 			buf.Write(getDataFrame([]byte("bar")))
-			b := make([]byte, 6)
-			n, err := io.ReadFull(rb, b)
+			buf.Write(getHeadersFrame(map[string]string{"grpc-status": "0", "grpc-message": "ok"}))
+			data, err := ioutil.ReadAll(rb)
 			Expect(err).ToNot(HaveOccurred())
-			Expect(n).To(Equal(6))
-			Expect(b).To(Equal([]byte("foobar")))
+			Expect(data).To(Equal([]byte("foobar")))
+			Expect(trailers).To(Equal(http.Header{
+				"Grpc-Status":  []string{"0"},
+				"Grpc-Message": []string{"ok"},
+			}))
+		})
+
+		It("reads trailers for an empty body", func() {
+			buf.Write(getHeadersFrame(map[string]string{"foo": "bar"}))
+			n, err := rb.Read(make([]byte, 10))
+			Expect(n).To(BeZero())
+			Expect(err).To(Equal(io.EOF))
+			Expect(trailers).To(Equal(http.Header{"Foo": []string{"bar"}}))
+		})
+
+		It("reads empty trailers", func() {
+			buf.Write(getDataFrame([]byte("foobar")))
+			buf.Write(getHeadersFrame(nil))
+			data, err := ioutil.ReadAll(rb)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(data).To(Equal([]byte("foobar")))
+			Expect(trailers).ToNot(BeNil())
+			Expect(trailers).To(BeEmpty())
+		})
+
+		It("errors on frames after the trailers", func() {
+			buf.Write(getHeadersFrame(map[string]string{"foo": "bar"}))
+			buf.Write(getDataFrame([]byte("foobar")))
+			_, err := rb.Read(make([]byte, 10))
+			Expect(err).To(MatchError("unexpected frame after the trailers"))
+			Expect(trailers).To(BeNil())
+		})
+
+		It("rejects pseudo headers in the trailers", func() {
+			buf.Write(getHeadersFrame(map[string]string{":status": "200"}))
+			_, err := rb.Read(make([]byte, 10))
+			Expect(err).To(MatchError("invalid pseudo header in trailers: :status"))
+		})
+
+		It("rejects invalid trailers", func() {
+			buf.Write(getHeadersFrame(map[string]string{"content-length": "6"}))
+			_, err := rb.Read(make([]byte, 10))
+			Expect(err).To(MatchError("invalid trailer: Content-Length"))
+		})
+
+		It("rejects trailers that are too large", func() {
+			rb.maxHeaderBytes = 10
+			buf.Write(getHeadersFrame(map[string]string{"foo": "foobarfoobar"}))
+			_, err := rb.Read(make([]byte, 10))
+			Expect(err).To(MatchError(errHeaderTooLarge))
+			Expect(trailers).To(BeNil())
 		})
 
 		It("errors when it can't parse the frame", func() {
@@ -136,14 +205,14 @@ var _ = Describe("Body", func() {
 
 	It("closes requests", func() {
 		cb := &closingBuffer{Buffer: buf}
-		rb := newRequestBody(cb)
+		rb := newRequestBody(cb, nil)
 		Expect(rb.Close()).To(Succeed())
 		Expect(cb.closed).To(BeFalse())
 	})
 
 	It("closes responses", func() {
 		cb := &closingBuffer{Buffer: buf}
-		rb := newResponseBody(cb)
+		rb := newResponseBody(cb, nil)
 		Expect(rb.Close()).To(Succeed())
 		Expect(cb.closed).To(BeTrue())
 	})
@@ -1,16 +1,22 @@
 package http3
 
 import (
-	"bytes"
+	"context"
 	"crypto/tls"
 	"errors"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
+	"net/http/httptrace"
+	"net/textproto"
 	"strconv"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/lucas-clemente/quic-go"
+	"github.com/lucas-clemente/quic-go/internal/protocol"
 	"github.com/lucas-clemente/quic-go/internal/utils"
 	"github.com/marten-seemann/qpack"
 )
@@ -21,8 +27,25 @@ var defaultQuicConfig = &quic.Config{KeepAlive: true}
 
 var dialAddr = quic.DialAddr
 
+// errGoingAway is returned for requests on a session that received a GOAWAY frame.
+var errGoingAway = errors.New("http3: session is going away")
+
+// max1xxResponses is the maximum number of informational (1xx) responses accepted before the final response.
+const max1xxResponses = 5
+
 type roundTripperOpts struct {
 	DisableCompression bool
+	// IdleTimeout is the time after which a session without any active requests is closed.
+	// If zero, idle sessions are kept open.
+	IdleTimeout time.Duration
+	// MaxHeaderBytes is the limit for the size of response headers.
+	// If zero, a default limit is used.
+	MaxHeaderBytes int64
+	// ExpectContinueTimeout is the time to wait for a 100 Continue response before sending the request body.
+	// If zero, a default timeout is used. If negative, the body is sent immediately.
+	ExpectContinueTimeout time.Duration
+	// EnableWebTransport allows establishing WebTransport sessions.
+	EnableWebTransport bool
 }
 
 // client is a HTTP3 client doing requests
@@ -31,16 +54,25 @@ type client struct {
 	config  *quic.Config
 	opts    *roundTripperOpts
 
-	dialOnce     sync.Once
-	dialer       func(network, addr string, tlsCfg *tls.Config, cfg *quic.Config) (quic.Session, error)
-	handshakeErr error
+	dialOnce sync.Once
+	dialer   func(network, addr string, tlsCfg *tls.Config, cfg *quic.Config) (quic.Session, error)
 
 	requestWriter *requestWriter
 
-	decoder *qpack.Decoder
-
 	hostname string
-	session  quic.Session
+
+	// mutex protects all members below.
+	// After receiving a GOAWAY frame, the session is closed once all responses have been closed.
+	mutex          sync.Mutex
+	session        quic.Session         // nil until dialing completed
+	webTransport   *webTransportManager // nil if WebTransport is disabled
+	handshakeErr   error
+	goingAway      bool
+	activeRequests int
+	// streamLimitReached is set when a request had to wait for the peer to allow a new stream.
+	// It is reset when a request finishes.
+	streamLimitReached bool
+	idleTimer          *time.Timer
 
 	logger utils.Logger
 }
@@ -55,18 +87,24 @@ func newClient(
 	if tlsConf == nil {
 		tlsConf = &tls.Config{}
 	}
-	tlsConf.NextProtos = []string{"h3-19"}
+	tlsConf.NextProtos = []string{nextProtoH3}
 	if quicConfig == nil {
 		quicConfig = defaultQuicConfig
 	}
-	quicConfig.MaxIncomingStreams = -1 // don't allow any bidirectional streams
-	logger := utils.DefaultLogger.WithPrefix("h3 client")
+	if !opts.EnableWebTransport {
+		quicConfig.MaxIncomingStreams = -1 // don't allow any bidirectional streams
+	} else if quicConfig.MaxIncomingStreams < 0 {
+		// The server opens bidirectional streams for WebTransport sessions.
+		conf := *quicConfig
+		conf.MaxIncomingStreams = 0
+		quicConfig = &conf
+	}
+	logger := newLogger(quicConfig, "h3 client")
 
 	return &client{
 		hostname:      authorityAddr("https", hostname),
 		tlsConf:       tlsConf,
 		requestWriter: newRequestWriter(logger),
-		decoder:       qpack.NewDecoder(func(hf qpack.HeaderField) {}),
 		config:        quicConfig,
 		opts:          opts,
 		dialer:        dialer,
@@ -74,80 +112,507 @@ func newClient(
 	}
 }
 
-func (c *client) dial() error {
+// dial dials the session.
+// The session (or the error that occurred when dialing) is recorded, for use by all requests.
+func (c *client) dial() {
+	var sess quic.Session
 	var err error
 	if c.dialer != nil {
-		c.session, err = c.dialer("udp", c.hostname, c.tlsConf, c.config)
+		sess, err = c.dialer("udp", c.hostname, c.tlsConf, c.config)
 	} else {
-		c.session, err = dialAddr(c.hostname, c.tlsConf, c.config)
+		sess, err = dialAddr(c.hostname, c.tlsConf, c.config)
 	}
+	var webTransport *webTransportManager
+	if err == nil && c.opts.EnableWebTransport {
+		webTransport = newWebTransportManager(sess, c.logger)
+	}
+	c.mutex.Lock()
+	c.session = sess
+	c.handshakeErr = err
+	c.webTransport = webTransport
+	c.mutex.Unlock()
 	if err != nil {
-		return err
+		return
 	}
 
 	go func() {
-		if err := c.setupSession(); err != nil {
-			c.session.CloseWithError(quic.ErrorCode(errorInternalError), err)
+		if _, err := openControlStream(sess, c.maxHeaderBytes(), c.opts.EnableWebTransport); err != nil {
+			sess.CloseWithError(quic.ErrorCode(errorInternalError), err)
 		}
 	}()
+	go handleUnidirectionalStreams(sess, protocol.PerspectiveClient, nil, c.handleGoAway, webTransport, c.logger)
+	if webTransport != nil {
+		go c.handleWebTransportStreams(sess, webTransport)
+	}
+}
 
-	// TODO: send a SETTINGS frame
-	return nil
+// handleWebTransportStreams accepts the bidirectional streams opened by the server.
+// The server is only allowed to open streams for WebTransport sessions.
+func (c *client) handleWebTransportStreams(sess quic.Session, webTransport *webTransportManager) {
+	for {
+		str, err := sess.AcceptStream()
+		if err != nil {
+			c.logger.Debugf("Accepting stream failed: %s", err)
+			return
+		}
+		go func() {
+			frame, err := parseNextFrame(str)
+			if err != nil {
+				str.CancelRead(quic.ErrorCode(errorRequestCanceled))
+				str.CancelWrite(quic.ErrorCode(errorRequestCanceled))
+				return
+			}
+			f, ok := frame.(*webTransportStreamFrame)
+			if !ok {
+				str.CancelRead(quic.ErrorCode(errorUnexpectedFrame))
+				str.CancelWrite(quic.ErrorCode(errorUnexpectedFrame))
+				return
+			}
+			webTransport.handleStream(str, f.SessionID)
+		}()
+	}
 }
 
-func (c *client) setupSession() error {
-	// open the control stream
-	str, err := c.session.OpenUniStreamSync()
-	if err != nil {
-		return err
+func (c *client) maxHeaderBytes() uint64 {
+	return maxHeaderBytesOrDefault(c.opts.MaxHeaderBytes)
+}
+
+// rejectHeaderTooLarge resets a request stream, because the response headers exceeded the MaxHeaderBytes limit.
+func (c *client) rejectHeaderTooLarge(str quic.Stream) error {
+	str.CancelRead(quic.ErrorCode(errorExcessiveLoad))
+	str.CancelWrite(quic.ErrorCode(errorExcessiveLoad))
+	return fmt.Errorf("http3: server response headers exceeded %d bytes", c.maxHeaderBytes())
+}
+
+// abortUpload aborts sending the request body, if it wasn't sent completely yet.
+func (c *client) abortUpload(upload *uploadBody, str quic.Stream) {
+	if upload.abort() {
+		c.logger.Debugf("Aborting upload of the request body.")
+		str.CancelWrite(quic.ErrorCode(errorRequestCanceled))
+	}
+}
+
+func (c *client) expectContinueTimeout() time.Duration {
+	if c.opts.ExpectContinueTimeout == 0 {
+		return defaultExpectContinueTimeout
+	}
+	return c.opts.ExpectContinueTimeout
+}
+
+// handleGoAway handles a GOAWAY frame.
+// No new requests are sent on this session.
+// The server rejects requests on streams with stream IDs above the limit sent in the GOAWAY frame.
+func (c *client) handleGoAway(protocol.StreamID) {
+	c.mutex.Lock()
+	c.goingAway = true
+	closeSession := c.activeRequests == 0
+	c.mutex.Unlock()
+	c.logger.Debugf("Received a GOAWAY frame.")
+	if closeSession {
+		c.session.Close()
+	}
+}
+
+// isGoingAway says if a GOAWAY frame was received
+func (c *client) isGoingAway() bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.goingAway
+}
+
+// isClosed says if dialing failed, or if the session was closed
+func (c *client) isClosed() bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.handshakeErr != nil {
+		return true
 	}
-	buf := &bytes.Buffer{}
-	// write the type byte
-	buf.Write([]byte{0x0})
-	// send the SETTINGS frame
-	(&settingsFrame{}).Write(buf)
-	if _, err := str.Write(buf.Bytes()); err != nil {
-		return err
+	// still dialing
+	if c.session == nil {
+		return false
 	}
+	return c.session.Context().Err() != nil
+}
+
+// hasStreamLimitReached says if the last request had to wait for the peer to allow a new stream
+func (c *client) hasStreamLimitReached() bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.streamLimitReached
+}
+
+func (c *client) numActiveRequests() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.activeRequests
+}
 
+// closeIfIdle closes the session if there are no active requests.
+// It returns true if the session was closed (or is going to be closed, since it received a GOAWAY).
+func (c *client) closeIfIdle() bool {
+	c.mutex.Lock()
+	if c.activeRequests > 0 {
+		c.mutex.Unlock()
+		return false
+	}
+	// Requests that are started afterwards are rejected, and retried on a new session.
+	closeSession := !c.goingAway
+	c.goingAway = true
+	sess := c.session
+	c.mutex.Unlock()
+	if closeSession && sess != nil {
+		c.logger.Debugf("Closing idle session.")
+		sess.Close()
+	}
+	return true
+}
+
+func (c *client) startRequest() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.goingAway {
+		return errGoingAway
+	}
+	c.activeRequests++
+	if c.idleTimer != nil {
+		c.idleTimer.Stop()
+		c.idleTimer = nil
+	}
 	return nil
 }
 
+func (c *client) finishRequest() {
+	c.mutex.Lock()
+	c.activeRequests--
+	c.streamLimitReached = false
+	closeSession := c.goingAway && c.activeRequests == 0
+	if c.activeRequests == 0 && !c.goingAway && c.session != nil && c.opts.IdleTimeout > 0 {
+		c.idleTimer = time.AfterFunc(c.opts.IdleTimeout, func() { c.closeIfIdle() })
+	}
+	sess := c.session
+	c.mutex.Unlock()
+	if closeSession && sess != nil {
+		sess.Close()
+	}
+}
+
+// setStreamLimitReached is called when the peer's stream limit prevents opening a new stream.
+func (c *client) setStreamLimitReached() {
+	c.mutex.Lock()
+	c.streamLimitReached = true
+	c.mutex.Unlock()
+}
+
 func (c *client) Close() error {
-	return c.session.Close()
+	c.mutex.Lock()
+	sess := c.session
+	c.mutex.Unlock()
+	if sess == nil {
+		return nil
+	}
+	return sess.Close()
 }
 
 // Roundtrip executes a request and returns a response
-// TODO: handle request cancelations
 func (c *client) RoundTrip(req *http.Request) (*http.Response, error) {
+	return c.RoundTripOpt(req, RoundTripOpt{})
+}
+
+// RoundTripOpt executes a request and returns a response.
+// The OnlyCachedConn option is handled by the RoundTripper.
+func (c *client) RoundTripOpt(req *http.Request, opt RoundTripOpt) (_ *http.Response, rerr error) {
 	if req.URL.Scheme != "https" {
 		return nil, errors.New("http3: unsupported scheme")
 	}
 	if authorityAddr("https", hostnameFromRequest(req)) != c.hostname {
 		return nil, fmt.Errorf("http3 client BUG: RoundTrip called for the wrong client (expected %s, got %s)", c.hostname, req.Host)
 	}
+	origReq := req
+	hasBody := req.Body != nil && req.Body != http.NoBody
+	// For CONNECT requests, the request stream is used as a tunnel after receiving the response.
+	// If the request has a body, the body is sent on the tunnel.
+	isConnect := req.Method == http.MethodConnect
+	if opt.HijackStream && hasBody {
+		return nil, errors.New("http3: cannot hijack the stream of a request with a body")
+	}
 
-	c.dialOnce.Do(func() {
-		c.handshakeErr = c.dial()
-	})
+	if err := c.startRequest(); err != nil {
+		return nil, classifyRequestError(err, false)
+	}
+	// The request is finished when the response body is closed.
+	requestDone := true
+	defer func() {
+		if requestDone {
+			c.finishRequest()
+		}
+	}()
 
-	if c.handshakeErr != nil {
-		return nil, c.handshakeErr
+	c.dialOnce.Do(c.dial)
+	c.mutex.Lock()
+	sess, handshakeErr := c.session, c.handshakeErr
+	c.mutex.Unlock()
+	if handshakeErr != nil {
+		return nil, handshakeErr
 	}
 
-	str, err := c.session.OpenStreamSync()
+	// requestSent is set before the first part of the request is written to the stream.
+	// If the session is lost before that, the request can safely be retried on a new session.
+	var requestSent bool
+	defer func() {
+		if rerr != nil {
+			rerr = classifyRequestError(rerr, requestSent)
+		}
+	}()
+
+	str, err := sess.OpenStream()
+	if nerr, ok := err.(net.Error); ok && nerr.Temporary() {
+		// The peer's stream limit was reached.
+		// Tell the RoundTripper, such that it can use a different session for the next requests.
+		c.setStreamLimitReached()
+		str, err = sess.OpenStreamSync()
+	}
 	if err != nil {
 		return nil, err
 	}
 
+	// reqDone is closed when the request is done, i.e. when the response body was read or closed,
+	// or when an error occurred.
+	reqDone := make(chan struct{})
+	if ctxDone := req.Context().Done(); ctxDone != nil {
+		go func() {
+			select {
+			case <-ctxDone:
+				// If both channels are closed, select picks one of them at random.
+				select {
+				case <-reqDone:
+					return
+				default:
+				}
+				str.CancelWrite(quic.ErrorCode(errorRequestCanceled))
+				str.CancelRead(quic.ErrorCode(errorRequestCanceled))
+			case <-reqDone:
+			}
+		}()
+	}
+	defer func() {
+		if rerr != nil {
+			close(reqDone)
+			// If the request was canceled, the error occurred because the stream was canceled.
+			if err := req.Context().Err(); err != nil {
+				rerr = err
+			}
+		}
+	}()
+
+	// The priority is applied to the request stream, and signaled to the server.
+	if prio, ok := PriorityFromContext(req.Context()); ok {
+		str.SetPriority(prio.Urgency, prio.Incremental)
+		r := *req
+		r.Header = make(http.Header, len(req.Header)+1)
+		for k, vv := range req.Header {
+			r.Header[k] = vv
+		}
+		r.Header.Set("Priority", prio.String())
+		req = &r
+	}
+
 	var requestGzip bool
-	if !c.opts.DisableCompression && req.Method != "HEAD" && req.Header.Get("Accept-Encoding") == "" && req.Header.Get("Range") == "" {
+	if !c.opts.DisableCompression && !opt.HijackStream && !isConnect && req.Method != "HEAD" && req.Header.Get("Accept-Encoding") == "" && req.Header.Get("Range") == "" {
 		requestGzip = true
 	}
-	if err := c.requestWriter.WriteRequest(str, req, requestGzip); err != nil {
+	// For requests with an Expect: 100-continue header, the body is only sent once the server sent a 100 Continue.
+	var continueBody *expectContinueBody
+	if hasBody && !isConnect && expectsContinue(req) {
+		if timeout := c.expectContinueTimeout(); timeout > 0 {
+			continueBody = newExpectContinueBody(req.Body, timeout)
+			r := *req
+			r.Body = continueBody
+			req = &r
+		}
+	}
+	// The body is streamed while waiting for the response.
+	// If the server responds with an error before the body was sent completely, the upload is aborted.
+	var upload *uploadBody
+	if hasBody && !isConnect {
+		upload = newUploadBody(req.Body)
+		r := *req
+		r.Body = upload
+		req = &r
+		defer func() {
+			if rerr != nil {
+				c.abortUpload(upload, str)
+			}
+		}()
+	}
+	requestSent = true
+	if opt.HijackStream || (isConnect && !hasBody) {
+		// Only send the HEADERS frame. Don't close the stream.
+		headers, err := c.requestWriter.getHeaders(req, false)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := str.Write(headers); err != nil {
+			return nil, err
+		}
+	} else if err := c.requestWriter.WriteRequest(str, req, requestGzip); err != nil {
 		return nil, err
 	}
 
+	maxHeaderBytes := c.maxHeaderBytes()
+	trace := httptrace.ContextClientTrace(req.Context())
+	var res *http.Response
+	var num1xx int
+	for {
+		hfs, err := c.readResponseHeaders(str, maxHeaderBytes)
+		if err != nil {
+			return nil, err
+		}
+		res, err = responseFromHeaders(hfs)
+		if err != nil {
+			return nil, err
+		}
+		// Informational (1xx) responses are followed by the final response.
+		if res.StatusCode < 100 || res.StatusCode > 199 {
+			break
+		}
+		num1xx++
+		if num1xx > max1xxResponses {
+			str.CancelWrite(quic.ErrorCode(errorExcessiveLoad))
+			str.CancelRead(quic.ErrorCode(errorExcessiveLoad))
+			return nil, errors.New("http3: too many 1xx informational responses")
+		}
+		if res.StatusCode == http.StatusContinue {
+			if continueBody != nil {
+				continueBody.decide(true)
+			}
+			if trace != nil && trace.Got100Continue != nil {
+				trace.Got100Continue()
+			}
+		}
+		if trace != nil && trace.Got1xxResponse != nil {
+			if err := trace.Got1xxResponse(res.StatusCode, textproto.MIMEHeader(res.Header)); err != nil {
+				str.CancelWrite(quic.ErrorCode(errorRequestCanceled))
+				str.CancelRead(quic.ErrorCode(errorRequestCanceled))
+				return nil, err
+			}
+		}
+	}
+	if upload != nil {
+		// If the server sent the final response without a 100 Continue, the body is not sent.
+		expectationFailed := continueBody != nil && !continueBody.decide(false)
+		if expectationFailed || res.StatusCode >= 300 {
+			c.abortUpload(upload, str)
+		}
+	}
+	// Allow the caller to find out which connection the response was received on.
+	res.Request = origReq.WithContext(context.WithValue(origReq.Context(), connectionStateKey{}, newConnectionState(sess)))
+	requestDone = false
+	streamBody := newResponseStreamBody(str, c.finishRequest)
+	streamBody.ctx = req.Context()
+	if opt.HijackStream {
+		// Once the stream was returned, the application is responsible for it.
+		close(reqDone)
+	} else {
+		streamBody.onDone = func() { close(reqDone) }
+	}
+	respBody := newResponseBody(streamBody, func(trailers http.Header) {
+		if res.Trailer == nil {
+			res.Trailer = make(http.Header, len(trailers))
+		}
+		for k, vv := range trailers {
+			res.Trailer[k] = vv
+		}
+	})
+	respBody.maxHeaderBytes = maxHeaderBytes
+	if opt.HijackStream {
+		res.Body = newHijackableBody(respBody, str)
+	} else if isConnect {
+		res.ContentLength = -1
+		res.Body = newTunnel(respBody, str, !hasBody)
+	} else if requestGzip && res.Header.Get("Content-Encoding") == "gzip" {
+		res.Header.Del("Content-Encoding")
+		res.Header.Del("Content-Length")
+		res.ContentLength = -1
+		res.Body = newGzipReader(respBody)
+		res.Uncompressed = true
+	} else {
+		res.Body = respBody
+	}
+
+	return res, nil
+}
+
+// dialWebTransport sends an extended CONNECT request to establish a WebTransport session.
+// The session counts as an active request until it is closed.
+func (c *client) dialWebTransport(req *http.Request) (_ *http.Response, _ *WebTransportSession, rerr error) {
+	if !c.opts.EnableWebTransport {
+		return nil, nil, errors.New("http3: WebTransport is not enabled")
+	}
+	if err := c.startRequest(); err != nil {
+		return nil, nil, err
+	}
+	c.dialOnce.Do(c.dial)
+	c.mutex.Lock()
+	sess, handshakeErr, webTransport := c.session, c.handshakeErr, c.webTransport
+	c.mutex.Unlock()
+	if handshakeErr != nil {
+		c.finishRequest()
+		return nil, nil, handshakeErr
+	}
+	str, err := sess.OpenStreamSync()
+	if err != nil {
+		c.finishRequest()
+		return nil, nil, err
+	}
+	// Add the session before sending the request, since the server might open streams right after sending the response.
+	wsess := webTransport.addSession(str, c.finishRequest)
+	defer func() {
+		if rerr != nil {
+			wsess.Close()
+		}
+	}()
+	reqDone := make(chan struct{})
+	defer close(reqDone)
+	if ctxDone := req.Context().Done(); ctxDone != nil {
+		go func() {
+			select {
+			case <-ctxDone:
+				str.CancelWrite(quic.ErrorCode(errorRequestCanceled))
+				str.CancelRead(quic.ErrorCode(errorRequestCanceled))
+			case <-reqDone:
+			}
+		}()
+	}
+
+	headers, err := c.requestWriter.getHeaders(req, false)
+	if err != nil {
+		return nil, nil, err
+	}
+	if _, err := str.Write(headers); err != nil {
+		return nil, nil, err
+	}
+	hfs, err := c.readResponseHeaders(str, c.maxHeaderBytes())
+	if err != nil {
+		if ctxErr := req.Context().Err(); ctxErr != nil {
+			return nil, nil, ctxErr
+		}
+		return nil, nil, err
+	}
+	res, err := responseFromHeaders(hfs)
+	if err != nil {
+		return nil, nil, err
+	}
+	res.Request = req
+	res.Body = http.NoBody
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return res, nil, fmt.Errorf("http3: WebTransport session rejected (status %d)", res.StatusCode)
+	}
+	go wsess.run()
+	return res, wsess, nil
+}
+
+// readResponseHeaders reads a HEADERS frame from the request stream, and decodes the header block.
+func (c *client) readResponseHeaders(str quic.Stream, maxHeaderBytes uint64) ([]qpack.HeaderField, error) {
 	frame, err := parseNextFrame(str)
 	if err != nil {
 		return nil, err
@@ -156,15 +621,22 @@ func (c *client) RoundTrip(req *http.Request) (*http.Response, error) {
 	if !ok {
 		return nil, errors.New("not a HEADERS frame")
 	}
-	// TODO: check size
+	if hf.Length > maxHeaderBytes {
+		return nil, c.rejectHeaderTooLarge(str)
+	}
 	headerBlock := make([]byte, hf.Length)
 	if _, err := io.ReadFull(str, headerBlock); err != nil {
 		return nil, err
 	}
-	hfs, err := c.decoder.DecodeFull(headerBlock)
-	if err != nil {
-		return nil, err
+	hfs, err := decodeHeaders(headerBlock, maxHeaderBytes)
+	if err == errHeaderTooLarge {
+		return nil, c.rejectHeaderTooLarge(str)
 	}
+	return hfs, err
+}
+
+// responseFromHeaders creates the http.Response from the decoded response headers.
+func responseFromHeaders(hfs []qpack.HeaderField) (*http.Response, error) {
 	res := &http.Response{
 		Proto:      "HTTP/3",
 		ProtoMajor: 3,
@@ -179,20 +651,20 @@ func (c *client) RoundTrip(req *http.Request) (*http.Response, error) {
 			}
 			res.StatusCode = status
 			res.Status = hf.Value + " " + http.StatusText(status)
+		case "trailer":
+			// The values of the trailers are set when the trailers are received.
+			for _, k := range strings.Split(hf.Value, ",") {
+				if k = strings.TrimSpace(k); k == "" {
+					continue
+				}
+				if res.Trailer == nil {
+					res.Trailer = make(http.Header)
+				}
+				res.Trailer[http.CanonicalHeaderKey(k)] = nil
+			}
 		default:
 			res.Header.Add(hf.Name, hf.Value)
 		}
 	}
-	respBody := newResponseBody(&responseBody{str})
-	if requestGzip && res.Header.Get("Content-Encoding") == "gzip" {
-		res.Header.Del("Content-Encoding")
-		res.Header.Del("Content-Length")
-		res.ContentLength = -1
-		res.Body = newGzipReader(respBody)
-		res.Uncompressed = true
-	} else {
-		res.Body = respBody
-	}
-
 	return res, nil
 }
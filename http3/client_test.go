@@ -3,16 +3,25 @@ package http3
 import (
 	"bytes"
 	"compress/gzip"
+	"context"
 	"crypto/tls"
 	"errors"
+	"fmt"
 	"io"
 	"io/ioutil"
+	"net"
 	"net/http"
+	"net/http/httptrace"
+	"net/textproto"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/golang/mock/gomock"
 	quic "github.com/lucas-clemente/quic-go"
 	mockquic "github.com/lucas-clemente/quic-go/internal/mocks/quic"
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+	"github.com/lucas-clemente/quic-go/internal/qerr"
 	"github.com/lucas-clemente/quic-go/internal/utils"
 	"github.com/marten-seemann/qpack"
 
@@ -20,6 +29,13 @@ import (
 	. "github.com/onsi/gomega"
 )
 
+// mockTemporaryError is the error returned by OpenStream when the peer's stream limit is reached
+type mockTemporaryError struct{}
+
+func (mockTemporaryError) Error() string   { return "too many open streams" }
+func (mockTemporaryError) Temporary() bool { return true }
+func (mockTemporaryError) Timeout() bool   { return false }
+
 var _ = Describe("Client", func() {
 	var (
 		client       *client
@@ -122,7 +138,8 @@ var _ = Describe("Client", func() {
 		client = newClient("localhost:1337", nil, &roundTripperOpts{}, nil, nil)
 		session := mockquic.NewMockSession(mockCtrl)
 		session.EXPECT().OpenUniStreamSync().Return(nil, testErr).MaxTimes(1)
-		session.EXPECT().OpenStreamSync().Return(nil, testErr).MaxTimes(1)
+		session.EXPECT().AcceptUniStream().Return(nil, testErr).MaxTimes(1)
+		session.EXPECT().OpenStream().Return(nil, testErr).MaxTimes(1)
 		session.EXPECT().CloseWithError(gomock.Any(), gomock.Any()).MaxTimes(1)
 		dialAddr = func(hostname string, _ *tls.Config, _ *quic.Config) (quic.Session, error) {
 			return session, nil
@@ -165,6 +182,12 @@ var _ = Describe("Client", func() {
 			str = mockquic.NewMockStream(mockCtrl)
 			sess = mockquic.NewMockSession(mockCtrl)
 			sess.EXPECT().OpenUniStreamSync().Return(controlStr, nil).MaxTimes(1)
+			sess.EXPECT().AcceptUniStream().Return(nil, errors.New("done")).MaxTimes(1)
+			sess.EXPECT().ConnectionState().Return(tls.ConnectionState{NegotiatedProtocol: nextProtoH3}).AnyTimes()
+			sess.EXPECT().ConnectionStats().Return(quic.ConnectionStats{SmoothedRTT: 42 * time.Millisecond}).AnyTimes()
+			sess.EXPECT().ConnectionID().Return("deadbeef").AnyTimes()
+			sess.EXPECT().LocalAddr().Return(&net.UDPAddr{IP: net.IPv4(192, 168, 0, 1), Port: 1337}).AnyTimes()
+			sess.EXPECT().RemoteAddr().Return(&net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 443}).AnyTimes()
 			dialAddr = func(hostname string, _ *tls.Config, _ *quic.Config) (quic.Session, error) {
 				return sess, nil
 			}
@@ -174,7 +197,7 @@ var _ = Describe("Client", func() {
 		})
 
 		It("sends a request", func() {
-			sess.EXPECT().OpenStreamSync().Return(str, nil)
+			sess.EXPECT().OpenStream().Return(str, nil)
 			buf := &bytes.Buffer{}
 			str.EXPECT().Write(gomock.Any()).DoAndReturn(func(p []byte) (int, error) {
 				return buf.Write(p)
@@ -194,8 +217,9 @@ var _ = Describe("Client", func() {
 			rspBuf := &bytes.Buffer{}
 			rw := newResponseWriter(rspBuf, utils.DefaultLogger)
 			rw.WriteHeader(418)
+			rw.Flush()
 
-			sess.EXPECT().OpenStreamSync().Return(str, nil)
+			sess.EXPECT().OpenStream().Return(str, nil)
 			str.EXPECT().Write(gomock.Any()).AnyTimes()
 			str.EXPECT().Close()
 			str.EXPECT().Read(gomock.Any()).DoAndReturn(func(p []byte) (int, error) {
@@ -208,6 +232,592 @@ var _ = Describe("Client", func() {
 			Expect(rsp.StatusCode).To(Equal(418))
 		})
 
+		It("exposes the connection state on the response", func() {
+			rspBuf := &bytes.Buffer{}
+			rw := newResponseWriter(rspBuf, utils.DefaultLogger)
+			rw.WriteHeader(200)
+			rw.Flush()
+
+			sess.EXPECT().OpenStream().Return(str, nil)
+			str.EXPECT().Write(gomock.Any()).AnyTimes()
+			str.EXPECT().Close()
+			str.EXPECT().Read(gomock.Any()).DoAndReturn(func(p []byte) (int, error) {
+				return rspBuf.Read(p)
+			}).AnyTimes()
+			rsp, err := client.RoundTrip(request)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(rsp.Request).ToNot(BeNil())
+			Expect(rsp.Request.URL).To(Equal(request.URL))
+			state, ok := ResponseConnectionState(rsp)
+			Expect(ok).To(BeTrue())
+			Expect(state.TLS.NegotiatedProtocol).To(Equal(nextProtoH3))
+			Expect(state.Stats.SmoothedRTT).To(Equal(42 * time.Millisecond))
+			Expect(state.ConnectionID).To(Equal("deadbeef"))
+			Expect(state.RemoteAddr).To(Equal(&net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 443}))
+			_, ok = ResponseConnectionState(&http.Response{})
+			Expect(ok).To(BeFalse())
+		})
+
+		Context("trailers", func() {
+			It("exposes the trailers after the body was read", func() {
+				rspBuf := &bytes.Buffer{}
+				rw := newResponseWriter(rspBuf, utils.DefaultLogger)
+				rw.Header().Set("Trailer", "Grpc-Status, Grpc-Message")
+				rw.Write([]byte("foo"))
+				rw.Write([]byte("bar"))
+				rw.Header().Set("Grpc-Status", "0")
+				rw.Header().Set("Grpc-Message", "ok")
+				rw.writeTrailers()
+				rw.Flush()
+
+				sess.EXPECT().OpenStream().Return(str, nil)
+				str.EXPECT().Write(gomock.Any()).AnyTimes()
+				str.EXPECT().Close()
+				str.EXPECT().Read(gomock.Any()).DoAndReturn(rspBuf.Read).AnyTimes()
+				rsp, err := client.RoundTrip(request)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(rsp.Header).ToNot(HaveKey("Trailer"))
+				Expect(rsp.Trailer).To(Equal(http.Header{"Grpc-Status": nil, "Grpc-Message": nil}))
+				data, err := ioutil.ReadAll(rsp.Body)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(data).To(Equal([]byte("foobar")))
+				Expect(rsp.Trailer).To(Equal(http.Header{
+					"Grpc-Status":  []string{"0"},
+					"Grpc-Message": []string{"ok"},
+				}))
+			})
+
+			It("exposes undeclared trailers", func() {
+				rspBuf := &bytes.Buffer{}
+				rw := newResponseWriter(rspBuf, utils.DefaultLogger)
+				rw.Write([]byte("foobar"))
+				rw.Header().Set(http.TrailerPrefix+"Foo", "bar")
+				rw.writeTrailers()
+				rw.Flush()
+
+				sess.EXPECT().OpenStream().Return(str, nil)
+				str.EXPECT().Write(gomock.Any()).AnyTimes()
+				str.EXPECT().Close()
+				str.EXPECT().Read(gomock.Any()).DoAndReturn(rspBuf.Read).AnyTimes()
+				rsp, err := client.RoundTrip(request)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(rsp.Trailer).To(BeNil())
+				_, err = ioutil.ReadAll(rsp.Body)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(rsp.Trailer).To(Equal(http.Header{"Foo": []string{"bar"}}))
+			})
+		})
+
+		Context("CONNECT requests", func() {
+			BeforeEach(func() {
+				var err error
+				request, err = http.NewRequest(http.MethodConnect, "https://quic.clemente.io:1337", nil)
+				Expect(err).ToNot(HaveOccurred())
+				request.Host = "www.example.com:443"
+			})
+
+			It("uses the request stream as a tunnel", func() {
+				rspBuf := &bytes.Buffer{}
+				rw := newResponseWriter(rspBuf, utils.DefaultLogger)
+				rw.WriteHeader(200)
+				rw.Write([]byte("raboof"))
+				rw.Flush()
+
+				sess.EXPECT().OpenStream().Return(str, nil)
+				reqBuf := &bytes.Buffer{}
+				str.EXPECT().Write(gomock.Any()).DoAndReturn(reqBuf.Write).AnyTimes()
+				str.EXPECT().Read(gomock.Any()).DoAndReturn(rspBuf.Read).AnyTimes()
+				rsp, err := client.RoundTrip(request)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(rsp.StatusCode).To(Equal(200))
+				hfs := decodeHeader(reqBuf)
+				Expect(hfs).To(HaveKeyWithValue(":method", "CONNECT"))
+				Expect(hfs).To(HaveKeyWithValue(":authority", "www.example.com:443"))
+				Expect(hfs).ToNot(HaveKey(":path"))
+				Expect(hfs).ToNot(HaveKey(":scheme"))
+				Expect(hfs).ToNot(HaveKey("accept-encoding"))
+				Expect(reqBuf.Len()).To(BeZero())
+
+				tunnel, ok := rsp.Body.(io.ReadWriteCloser)
+				Expect(ok).To(BeTrue())
+				_, err = tunnel.Write([]byte("foobar"))
+				Expect(err).ToNot(HaveOccurred())
+				f, err := parseNextFrame(reqBuf)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(f).To(Equal(&dataFrame{Length: 6}))
+				Expect(reqBuf.String()).To(Equal("foobar"))
+				data := make([]byte, 6)
+				_, err = io.ReadFull(tunnel, data)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(data).To(Equal([]byte("raboof")))
+				str.EXPECT().Close()
+				Expect(rsp.Body.(interface{ CloseWrite() error }).CloseWrite()).To(Succeed())
+				str.EXPECT().Close()
+				str.EXPECT().CancelRead(gomock.Any())
+				Expect(tunnel.Close()).To(Succeed())
+			})
+
+			It("sends the request body on the tunnel", func() {
+				request.Body = ioutil.NopCloser(bytes.NewReader([]byte("foobar")))
+				rspBuf := &bytes.Buffer{}
+				rw := newResponseWriter(rspBuf, utils.DefaultLogger)
+				rw.WriteHeader(200)
+				rw.Flush()
+
+				sess.EXPECT().OpenStream().Return(str, nil)
+				reqBuf := &bytes.Buffer{}
+				closed := make(chan struct{})
+				str.EXPECT().Write(gomock.Any()).DoAndReturn(reqBuf.Write).AnyTimes()
+				str.EXPECT().Close().Do(func() { close(closed) })
+				str.EXPECT().Read(gomock.Any()).DoAndReturn(rspBuf.Read).AnyTimes()
+				rsp, err := client.RoundTrip(request)
+				Expect(err).ToNot(HaveOccurred())
+				Eventually(closed).Should(BeClosed())
+				decodeHeader(reqBuf)
+				f, err := parseNextFrame(reqBuf)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(f).To(Equal(&dataFrame{Length: 6}))
+				Expect(reqBuf.String()).To(Equal("foobar"))
+				_, err = rsp.Body.(io.Writer).Write([]byte("foobar"))
+				Expect(err).To(MatchError(errTunnelNotWritable))
+			})
+		})
+
+		Context("hijacking", func() {
+			It("hands the stream to the caller", func() {
+				rspBuf := &bytes.Buffer{}
+				rw := newResponseWriter(rspBuf, utils.DefaultLogger)
+				rw.WriteHeader(200)
+				rw.Flush()
+				rspBuf.Write([]byte("raw data"))
+
+				sess.EXPECT().OpenStream().Return(str, nil)
+				reqBuf := &bytes.Buffer{}
+				str.EXPECT().Write(gomock.Any()).DoAndReturn(reqBuf.Write)
+				// no call to Close
+				str.EXPECT().Read(gomock.Any()).DoAndReturn(rspBuf.Read).AnyTimes()
+				rsp, err := client.RoundTripOpt(request, RoundTripOpt{HijackStream: true})
+				Expect(err).ToNot(HaveOccurred())
+				Expect(rsp.StatusCode).To(Equal(200))
+				hfs := decodeHeader(reqBuf)
+				Expect(hfs).ToNot(HaveKey("accept-encoding"))
+				Expect(reqBuf.Len()).To(BeZero())
+				hijacked, err := rsp.Body.(Hijacker).HijackStream()
+				Expect(err).ToNot(HaveOccurred())
+				Expect(hijacked).To(Equal(str))
+				data, err := ioutil.ReadAll(hijacked)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(data).To(Equal([]byte("raw data")))
+				// the body can't be used any more
+				_, err = rsp.Body.Read([]byte{0})
+				Expect(err).To(MatchError(http.ErrHijacked))
+				Expect(rsp.Body.Close()).To(Succeed())
+				_, err = rsp.Body.(Hijacker).HijackStream()
+				Expect(err).To(MatchError(http.ErrHijacked))
+			})
+
+			It("refuses to hijack requests with a body", func() {
+				req, err := http.NewRequest("POST", "https://quic.clemente.io:1337/upload", bytes.NewReader([]byte("foobar")))
+				Expect(err).ToNot(HaveOccurred())
+				_, err = client.RoundTripOpt(req, RoundTripOpt{HijackStream: true})
+				Expect(err).To(MatchError("http3: cannot hijack the stream of a request with a body"))
+			})
+		})
+
+		Context("WebTransport", func() {
+			var blockRead chan struct{}
+
+			BeforeEach(func() {
+				client = newClient("quic.clemente.io:1337", nil, &roundTripperOpts{EnableWebTransport: true}, nil, nil)
+				sess.EXPECT().AcceptStream().Return(nil, errors.New("done")).MaxTimes(1)
+				str.EXPECT().StreamID().Return(protocol.StreamID(4)).AnyTimes()
+				var err error
+				request, err = http.NewRequest(http.MethodConnect, "https://quic.clemente.io:1337/webtransport", nil)
+				Expect(err).ToNot(HaveOccurred())
+				request.Header.Set(":protocol", webTransportProtocol)
+				blockRead = make(chan struct{})
+			})
+
+			AfterEach(func() {
+				close(blockRead)
+			})
+
+			// setResponse makes the stream return a response, and then block until the test ends
+			setResponse := func(status int) {
+				rspBuf := &bytes.Buffer{}
+				rw := newResponseWriter(rspBuf, utils.DefaultLogger)
+				rw.WriteHeader(status)
+				rw.Flush()
+				block := blockRead
+				str.EXPECT().Read(gomock.Any()).DoAndReturn(func(p []byte) (int, error) {
+					if rspBuf.Len() == 0 {
+						<-block
+						return 0, io.EOF
+					}
+					return rspBuf.Read(p)
+				}).AnyTimes()
+			}
+
+			It("establishes sessions", func() {
+				setResponse(200)
+				sess.EXPECT().OpenStreamSync().Return(str, nil)
+				reqBuf := &bytes.Buffer{}
+				str.EXPECT().Write(gomock.Any()).DoAndReturn(reqBuf.Write)
+				// no call to Close
+				rsp, wsess, err := client.dialWebTransport(request)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(rsp.StatusCode).To(Equal(200))
+				Expect(wsess).ToNot(BeNil())
+				hfs := decodeHeader(reqBuf)
+				Expect(hfs).To(HaveKeyWithValue(":method", "CONNECT"))
+				Expect(hfs).To(HaveKeyWithValue(":protocol", "webtransport"))
+				Expect(hfs).To(HaveKeyWithValue(":path", "/webtransport"))
+				// the session counts as an active request until it is closed
+				Expect(client.numActiveRequests()).To(Equal(1))
+				str.EXPECT().CancelRead(quic.ErrorCode(errorNoError))
+				str.EXPECT().Close()
+				Expect(wsess.Close()).To(Succeed())
+				Expect(client.numActiveRequests()).To(BeZero())
+			})
+
+			It("returns the response if the server rejects the session", func() {
+				setResponse(404)
+				sess.EXPECT().OpenStreamSync().Return(str, nil)
+				str.EXPECT().Write(gomock.Any())
+				str.EXPECT().CancelRead(quic.ErrorCode(errorNoError))
+				str.EXPECT().Close()
+				rsp, wsess, err := client.dialWebTransport(request)
+				Expect(err).To(MatchError("http3: WebTransport session rejected (status 404)"))
+				Expect(rsp.StatusCode).To(Equal(404))
+				Expect(wsess).To(BeNil())
+				Expect(client.numActiveRequests()).To(BeZero())
+			})
+
+			It("refuses to establish sessions if WebTransport is disabled", func() {
+				client = newClient("quic.clemente.io:1337", nil, &roundTripperOpts{}, nil, nil)
+				_, _, err := client.dialWebTransport(request)
+				Expect(err).To(MatchError("http3: WebTransport is not enabled"))
+			})
+
+			It("passes streams opened by the server to the session", func() {
+				qsess := mockquic.NewMockSession(mockCtrl)
+				webTransport := newWebTransportManager(qsess, utils.DefaultLogger)
+				wsess := webTransport.addSession(str, nil)
+				buf := &bytes.Buffer{}
+				(&webTransportStreamFrame{SessionID: 4}).Write(buf)
+				incoming := mockquic.NewMockStream(mockCtrl)
+				incoming.EXPECT().Read(gomock.Any()).DoAndReturn(buf.Read).AnyTimes()
+				gomock.InOrder(
+					qsess.EXPECT().AcceptStream().Return(incoming, nil),
+					qsess.EXPECT().AcceptStream().Return(nil, errors.New("test done")),
+				)
+				client.handleWebTransportStreams(qsess, webTransport)
+				Expect(wsess.AcceptStream()).To(Equal(incoming))
+			})
+
+			It("resets streams opened by the server that don't belong to a WebTransport session", func() {
+				buf := &bytes.Buffer{}
+				(&dataFrame{Length: 6}).Write(buf)
+				incoming := mockquic.NewMockStream(mockCtrl)
+				incoming.EXPECT().Read(gomock.Any()).DoAndReturn(buf.Read).AnyTimes()
+				done := make(chan struct{})
+				incoming.EXPECT().CancelRead(quic.ErrorCode(errorUnexpectedFrame))
+				incoming.EXPECT().CancelWrite(quic.ErrorCode(errorUnexpectedFrame)).Do(func(quic.ErrorCode) { close(done) })
+				qsess := mockquic.NewMockSession(mockCtrl)
+				gomock.InOrder(
+					qsess.EXPECT().AcceptStream().Return(incoming, nil),
+					qsess.EXPECT().AcceptStream().Return(nil, errors.New("test done")),
+				)
+				client.handleWebTransportStreams(qsess, newWebTransportManager(qsess, utils.DefaultLogger))
+				Eventually(done).Should(BeClosed())
+			})
+		})
+
+		Context("GOAWAY", func() {
+			It("doesn't send new requests after receiving a GOAWAY, and closes the session when the last response is closed", func() {
+				rspBuf := &bytes.Buffer{}
+				rw := newResponseWriter(rspBuf, utils.DefaultLogger)
+				rw.WriteHeader(200)
+				rw.Flush()
+
+				sess.EXPECT().OpenStream().Return(str, nil)
+				str.EXPECT().Write(gomock.Any()).AnyTimes()
+				str.EXPECT().Close()
+				str.EXPECT().Read(gomock.Any()).DoAndReturn(rspBuf.Read).AnyTimes()
+				rsp, err := client.RoundTrip(request)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(client.isGoingAway()).To(BeFalse())
+				client.handleGoAway(4)
+				Expect(client.isGoingAway()).To(BeTrue())
+				_, err = client.RoundTrip(request)
+				Expect(err).To(MatchError(&RequestError{Err: errGoingAway}))
+				// the session is closed when the response body is closed
+				str.EXPECT().CancelRead(gomock.Any())
+				sess.EXPECT().Close()
+				Expect(rsp.Body.Close()).To(Succeed())
+			})
+
+			It("closes the session when receiving a GOAWAY, if there are no active requests", func() {
+				sess.EXPECT().OpenStream().Return(str, nil)
+				str.EXPECT().Write(gomock.Any()).AnyTimes()
+				str.EXPECT().Close()
+				str.EXPECT().Read(gomock.Any()).Return(0, errors.New("test done"))
+				_, err := client.RoundTrip(request)
+				Expect(err).To(MatchError("test done"))
+				sess.EXPECT().Close()
+				client.handleGoAway(4)
+			})
+		})
+
+		Context("classifying errors", func() {
+			It("returns a RequestError if the session was lost before the request was sent", func() {
+				testErr := qerr.TimeoutError("No recent network activity")
+				sess.EXPECT().OpenStream().Return(nil, testErr)
+				_, err := client.RoundTrip(request)
+				Expect(err).To(MatchError(&RequestError{Err: testErr}))
+			})
+
+			It("returns a RequestError if the session was lost after the request was sent", func() {
+				testErr := qerr.TimeoutError("No recent network activity")
+				sess.EXPECT().OpenStream().Return(str, nil)
+				str.EXPECT().Write(gomock.Any()).AnyTimes()
+				str.EXPECT().Close()
+				str.EXPECT().Read(gomock.Any()).Return(0, testErr)
+				_, err := client.RoundTrip(request)
+				Expect(err).To(MatchError(&RequestError{Err: testErr, MayHaveBeenProcessed: true, requestSent: true}))
+			})
+
+			It("returns a RequestError if the server rejected the request", func() {
+				testErr := &mockStreamError{code: quic.ErrorCode(errorRequestRejected)}
+				sess.EXPECT().OpenStream().Return(str, nil)
+				str.EXPECT().Write(gomock.Any()).AnyTimes()
+				str.EXPECT().Close()
+				str.EXPECT().Read(gomock.Any()).Return(0, testErr)
+				_, err := client.RoundTrip(request)
+				Expect(err).To(MatchError(&RequestError{Err: testErr, requestSent: true}))
+			})
+
+			It("doesn't wrap other stream errors", func() {
+				testErr := &mockStreamError{code: quic.ErrorCode(errorInternalError)}
+				sess.EXPECT().OpenStream().Return(str, nil)
+				str.EXPECT().Write(gomock.Any()).AnyTimes()
+				str.EXPECT().Close()
+				str.EXPECT().Read(gomock.Any()).Return(0, testErr)
+				_, err := client.RoundTrip(request)
+				Expect(err).To(Equal(testErr))
+			})
+		})
+
+		Context("limiting the response header size", func() {
+			var rspBuf *bytes.Buffer
+			var headerListSize int
+
+			BeforeEach(func() {
+				rspBuf = &bytes.Buffer{}
+				rw := newResponseWriter(rspBuf, utils.DefaultLogger)
+				rw.Header().Set("foo", strings.Repeat("a", 1000))
+				rw.WriteHeader(200)
+				rw.Flush()
+				hfs := decodeHeader(bytes.NewReader(rspBuf.Bytes()))
+				headerListSize = 0
+				for name, value := range hfs {
+					headerListSize += len(name) + len(value) + 32
+				}
+				sess.EXPECT().OpenStream().Return(str, nil)
+				str.EXPECT().Write(gomock.Any()).AnyTimes()
+				str.EXPECT().Close()
+				str.EXPECT().Read(gomock.Any()).DoAndReturn(rspBuf.Read).AnyTimes()
+			})
+
+			It("accepts response headers just under the limit", func() {
+				client.opts.MaxHeaderBytes = int64(headerListSize)
+				rsp, err := client.RoundTrip(request)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(rsp.Header.Get("foo")).To(HaveLen(1000))
+			})
+
+			It("resets the stream if the response headers exceed the limit", func() {
+				client.opts.MaxHeaderBytes = int64(headerListSize - 1)
+				str.EXPECT().CancelRead(quic.ErrorCode(errorExcessiveLoad))
+				str.EXPECT().CancelWrite(quic.ErrorCode(errorExcessiveLoad))
+				_, err := client.RoundTrip(request)
+				Expect(err).To(MatchError(fmt.Sprintf("http3: server response headers exceeded %d bytes", headerListSize-1)))
+			})
+
+			It("resets the stream if the HEADERS frame exceeds the limit", func() {
+				client.opts.MaxHeaderBytes = 100
+				str.EXPECT().CancelRead(quic.ErrorCode(errorExcessiveLoad))
+				str.EXPECT().CancelWrite(quic.ErrorCode(errorExcessiveLoad))
+				_, err := client.RoundTrip(request)
+				Expect(err).To(MatchError("http3: server response headers exceeded 100 bytes"))
+			})
+		})
+
+		Context("request cancelations", func() {
+			It("cancels the stream when the request context is canceled while waiting for the response", func() {
+				ctx, cancel := context.WithCancel(context.Background())
+				req := request.WithContext(ctx)
+				sess.EXPECT().OpenStream().Return(str, nil)
+				str.EXPECT().Write(gomock.Any()).AnyTimes()
+				str.EXPECT().Close()
+				canceled := make(chan struct{})
+				str.EXPECT().Read(gomock.Any()).DoAndReturn(func([]byte) (int, error) {
+					<-canceled
+					return 0, errors.New("read canceled")
+				})
+				str.EXPECT().CancelWrite(quic.ErrorCode(errorRequestCanceled))
+				str.EXPECT().CancelRead(quic.ErrorCode(errorRequestCanceled)).Do(func(quic.ErrorCode) { close(canceled) })
+				go func() {
+					time.Sleep(10 * time.Millisecond)
+					cancel()
+				}()
+				_, err := client.RoundTrip(req)
+				Expect(err).To(MatchError(context.Canceled))
+			})
+
+			It("cancels the stream when the request context is canceled while reading a streaming response", func() {
+				ctx, cancel := context.WithCancel(context.Background())
+				req := request.WithContext(ctx)
+				rspBuf := &bytes.Buffer{}
+				rw := newResponseWriter(rspBuf, utils.DefaultLogger)
+				rw.WriteHeader(200)
+				rw.Flush()
+				// the server announces a large DATA frame, but only sends a part of it
+				(&dataFrame{Length: 1000}).Write(rspBuf)
+				rspBuf.Write([]byte("foobar"))
+
+				sess.EXPECT().OpenStream().Return(str, nil)
+				str.EXPECT().Write(gomock.Any()).AnyTimes()
+				str.EXPECT().Close()
+				canceled := make(chan struct{})
+				str.EXPECT().Read(gomock.Any()).DoAndReturn(func(p []byte) (int, error) {
+					if rspBuf.Len() > 0 {
+						return rspBuf.Read(p)
+					}
+					<-canceled
+					return 0, errors.New("read canceled")
+				}).AnyTimes()
+				rsp, err := client.RoundTrip(req)
+				Expect(err).ToNot(HaveOccurred())
+				data := make([]byte, 6)
+				_, err = io.ReadFull(rsp.Body, data)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(data).To(Equal([]byte("foobar")))
+
+				str.EXPECT().CancelWrite(quic.ErrorCode(errorRequestCanceled))
+				str.EXPECT().CancelRead(quic.ErrorCode(errorRequestCanceled)).Do(func(quic.ErrorCode) { close(canceled) })
+				cancel()
+				_, err = rsp.Body.Read(data)
+				Expect(err).To(MatchError(context.Canceled))
+			})
+
+			It("doesn't cancel the stream once the response body was read", func() {
+				ctx, cancel := context.WithCancel(context.Background())
+				req := request.WithContext(ctx)
+				rspBuf := &bytes.Buffer{}
+				rw := newResponseWriter(rspBuf, utils.DefaultLogger)
+				rw.WriteHeader(200)
+				rw.Write([]byte("foobar"))
+				rw.Flush()
+
+				sess.EXPECT().OpenStream().Return(str, nil)
+				str.EXPECT().Write(gomock.Any()).AnyTimes()
+				str.EXPECT().Close()
+				str.EXPECT().Read(gomock.Any()).DoAndReturn(func(p []byte) (int, error) {
+					if rspBuf.Len() == 0 {
+						return 0, io.EOF
+					}
+					return rspBuf.Read(p)
+				}).AnyTimes()
+				rsp, err := client.RoundTrip(req)
+				Expect(err).ToNot(HaveOccurred())
+				data, err := ioutil.ReadAll(rsp.Body)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(data).To(Equal([]byte("foobar")))
+				// no calls to CancelRead or CancelWrite
+				cancel()
+				time.Sleep(10 * time.Millisecond)
+			})
+		})
+
+		Context("pooling", func() {
+			respond := func() {
+				rspBuf := &bytes.Buffer{}
+				rw := newResponseWriter(rspBuf, utils.DefaultLogger)
+				rw.WriteHeader(200)
+				rw.Flush()
+				str.EXPECT().Write(gomock.Any()).AnyTimes()
+				str.EXPECT().Close()
+				str.EXPECT().Read(gomock.Any()).DoAndReturn(rspBuf.Read).AnyTimes()
+			}
+
+			It("waits for a stream, if the stream limit is reached", func() {
+				respond()
+				sess.EXPECT().OpenStream().Return(nil, &mockTemporaryError{})
+				sess.EXPECT().OpenStreamSync().Return(str, nil)
+				rsp, err := client.RoundTrip(request)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(client.hasStreamLimitReached()).To(BeTrue())
+				Expect(client.numActiveRequests()).To(Equal(1))
+				str.EXPECT().CancelRead(gomock.Any())
+				Expect(rsp.Body.Close()).To(Succeed())
+				Expect(client.hasStreamLimitReached()).To(BeFalse())
+				Expect(client.numActiveRequests()).To(BeZero())
+			})
+
+			It("reports dial errors", func() {
+				dialAddr = func(string, *tls.Config, *quic.Config) (quic.Session, error) {
+					return nil, errors.New("handshake error")
+				}
+				Expect(client.isClosed()).To(BeFalse())
+				_, err := client.RoundTrip(request)
+				Expect(err).To(MatchError("handshake error"))
+				Expect(client.isClosed()).To(BeTrue())
+			})
+
+			It("reports when the session is closed", func() {
+				respond()
+				sess.EXPECT().OpenStream().Return(str, nil)
+				_, err := client.RoundTrip(request)
+				Expect(err).ToNot(HaveOccurred())
+				ctx, cancel := context.WithCancel(context.Background())
+				sess.EXPECT().Context().Return(ctx).AnyTimes()
+				Expect(client.isClosed()).To(BeFalse())
+				cancel()
+				Expect(client.isClosed()).To(BeTrue())
+			})
+
+			It("only closes the session if it is idle", func() {
+				respond()
+				sess.EXPECT().OpenStream().Return(str, nil)
+				rsp, err := client.RoundTrip(request)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(client.closeIfIdle()).To(BeFalse())
+				str.EXPECT().CancelRead(gomock.Any())
+				Expect(rsp.Body.Close()).To(Succeed())
+				sess.EXPECT().Close()
+				Expect(client.closeIfIdle()).To(BeTrue())
+				// new requests are rejected
+				_, err = client.RoundTrip(request)
+				Expect(err).To(MatchError(&RequestError{Err: errGoingAway}))
+			})
+
+			It("closes the session after the idle timeout", func() {
+				client.opts.IdleTimeout = 50 * time.Millisecond
+				respond()
+				sess.EXPECT().OpenStream().Return(str, nil)
+				rsp, err := client.RoundTrip(request)
+				Expect(err).ToNot(HaveOccurred())
+				str.EXPECT().CancelRead(gomock.Any())
+				closed := make(chan struct{})
+				sess.EXPECT().Close().Do(func() { close(closed) })
+				Expect(rsp.Body.Close()).To(Succeed())
+				Consistently(closed, 25*time.Millisecond).ShouldNot(BeClosed())
+				Eventually(closed).Should(BeClosed())
+				Expect(client.isGoingAway()).To(BeTrue())
+			})
+		})
+
 		Context("validating the address", func() {
 			It("refuses to do requests for the wrong host", func() {
 				req, err := http.NewRequest("https", "https://quic.clemente.io:1336/foobar.html", nil)
@@ -229,7 +839,7 @@ var _ = Describe("Client", func() {
 
 			BeforeEach(func() {
 				strBuf = &bytes.Buffer{}
-				sess.EXPECT().OpenStreamSync().Return(str, nil)
+				sess.EXPECT().OpenStream().Return(str, nil)
 				body := &mockBody{}
 				body.SetData([]byte("request body"))
 				var err error
@@ -269,6 +879,308 @@ var _ = Describe("Client", func() {
 				_, err := client.RoundTrip(request)
 				Expect(err).To(MatchError("test done"))
 			})
+
+			Context("streaming bodies", func() {
+				var pw *io.PipeWriter
+
+				BeforeEach(func() {
+					var pr *io.PipeReader
+					pr, pw = io.Pipe()
+					var err error
+					request, err = http.NewRequest("POST", "https://quic.clemente.io:1337/upload", pr)
+					Expect(err).ToNot(HaveOccurred())
+				})
+
+				setResponse := func(status int) {
+					rspBuf := &bytes.Buffer{}
+					rw := newResponseWriter(rspBuf, utils.DefaultLogger)
+					rw.WriteHeader(status)
+					rw.Flush()
+					str.EXPECT().Read(gomock.Any()).DoAndReturn(rspBuf.Read).AnyTimes()
+				}
+
+				It("aborts the upload when the server responds with an error before the body was sent", func() {
+					setResponse(http.StatusForbidden)
+					str.EXPECT().CancelWrite(quic.ErrorCode(errorRequestCanceled))
+					rsp, err := client.RoundTrip(request)
+					Expect(err).ToNot(HaveOccurred())
+					Expect(rsp.StatusCode).To(Equal(http.StatusForbidden))
+					// the request body was closed
+					_, err = pw.Write([]byte("foobar"))
+					Expect(err).To(MatchError(io.ErrClosedPipe))
+				})
+
+				It("continues the upload when the server responds with a success status", func() {
+					setResponse(http.StatusOK)
+					closed := make(chan struct{})
+					str.EXPECT().Close().Do(func() { close(closed) })
+					rsp, err := client.RoundTrip(request)
+					Expect(err).ToNot(HaveOccurred())
+					Expect(rsp.StatusCode).To(Equal(http.StatusOK))
+					_, err = pw.Write([]byte("foobar"))
+					Expect(err).ToNot(HaveOccurred())
+					Consistently(closed).ShouldNot(BeClosed())
+					Expect(pw.Close()).To(Succeed())
+					Eventually(closed).Should(BeClosed())
+				})
+
+				It("aborts the upload when the request fails", func() {
+					str.EXPECT().Read(gomock.Any()).Return(0, errors.New("test done"))
+					str.EXPECT().CancelWrite(quic.ErrorCode(errorRequestCanceled))
+					_, err := client.RoundTrip(request)
+					Expect(err).To(MatchError("test done"))
+					_, err = pw.Write([]byte("foobar"))
+					Expect(err).To(MatchError(io.ErrClosedPipe))
+				})
+			})
+		})
+
+		Context("Expect: 100-continue", func() {
+			var (
+				strBuf    *bytes.Buffer
+				strMutex  sync.Mutex
+				rspBuf    *bytes.Buffer
+				bodySent  chan struct{}
+				startRead chan struct{}
+			)
+
+			BeforeEach(func() {
+				strBuf = &bytes.Buffer{}
+				rspBuf = &bytes.Buffer{}
+				bodySent = make(chan struct{})
+				startRead = make(chan struct{})
+				sess.EXPECT().OpenStream().Return(str, nil)
+				body := &mockBody{}
+				body.SetData([]byte("request body"))
+				var err error
+				request, err = http.NewRequest("POST", "https://quic.clemente.io:1337/upload", body)
+				Expect(err).ToNot(HaveOccurred())
+				request.Header.Set("Expect", "100-continue")
+				str.EXPECT().Write(gomock.Any()).DoAndReturn(func(p []byte) (int, error) {
+					strMutex.Lock()
+					defer strMutex.Unlock()
+					return strBuf.Write(p)
+				}).AnyTimes()
+				str.EXPECT().Read(gomock.Any()).DoAndReturn(func(p []byte) (int, error) {
+					<-startRead
+					return rspBuf.Read(p)
+				}).AnyTimes()
+			})
+
+			requestBody := func() []byte {
+				strMutex.Lock()
+				defer strMutex.Unlock()
+				hfs := decodeHeader(strBuf)
+				Expect(hfs).To(HaveKeyWithValue("expect", "100-continue"))
+				f, err := parseNextFrame(strBuf)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(f).To(Equal(&dataFrame{Length: 12}))
+				return strBuf.Bytes()
+			}
+
+			It("sends the body after receiving the 100 Continue", func() {
+				rw := newResponseWriter(rspBuf, utils.DefaultLogger)
+				rw.writeInformationalHeader(100, nil)
+				rw.WriteHeader(200)
+				rw.Flush()
+				str.EXPECT().Close().Do(func() { close(bodySent) })
+				rspChan := make(chan *http.Response)
+				go func() {
+					defer GinkgoRecover()
+					rsp, err := client.RoundTrip(request)
+					Expect(err).ToNot(HaveOccurred())
+					rspChan <- rsp
+				}()
+				Consistently(bodySent).ShouldNot(BeClosed())
+				close(startRead)
+				var rsp *http.Response
+				Eventually(rspChan).Should(Receive(&rsp))
+				Expect(rsp.StatusCode).To(Equal(200))
+				Eventually(bodySent).Should(BeClosed())
+				Expect(requestBody()).To(Equal([]byte("request body")))
+			})
+
+			It("doesn't send the body if the server sends a final response first", func() {
+				rw := newResponseWriter(rspBuf, utils.DefaultLogger)
+				rw.WriteHeader(http.StatusExpectationFailed)
+				rw.Flush()
+				str.EXPECT().CancelWrite(quic.ErrorCode(errorRequestCanceled)).Do(func(quic.ErrorCode) { close(bodySent) })
+				close(startRead)
+				rsp, err := client.RoundTrip(request)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(rsp.StatusCode).To(Equal(http.StatusExpectationFailed))
+				Eventually(bodySent).Should(BeClosed())
+				Expect(request.Body.(*mockBody).reader.Len()).To(Equal(len("request body")))
+			})
+
+			It("sends the body when the timeout expires", func() {
+				client.opts.ExpectContinueTimeout = 50 * time.Millisecond
+				rw := newResponseWriter(rspBuf, utils.DefaultLogger)
+				rw.WriteHeader(200)
+				rw.Flush()
+				str.EXPECT().Close().Do(func() {
+					close(bodySent)
+					close(startRead)
+				})
+				start := time.Now()
+				rsp, err := client.RoundTrip(request)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(rsp.StatusCode).To(Equal(200))
+				Expect(time.Since(start)).To(BeNumerically(">=", 50*time.Millisecond))
+				Expect(requestBody()).To(Equal([]byte("request body")))
+			})
+
+			It("sends the body immediately, if waiting for 100 Continue is disabled", func() {
+				client.opts.ExpectContinueTimeout = -1
+				rw := newResponseWriter(rspBuf, utils.DefaultLogger)
+				rw.WriteHeader(200)
+				rw.Flush()
+				str.EXPECT().Close().Do(func() {
+					close(bodySent)
+					close(startRead)
+				})
+				rsp, err := client.RoundTrip(request)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(rsp.StatusCode).To(Equal(200))
+				Expect(requestBody()).To(Equal([]byte("request body")))
+			})
+		})
+
+		It("sets the priority", func() {
+			sess.EXPECT().OpenStream().Return(str, nil)
+			buf := &bytes.Buffer{}
+			str.EXPECT().Write(gomock.Any()).DoAndReturn(buf.Write)
+			str.EXPECT().Close()
+			str.EXPECT().Read(gomock.Any()).Return(0, errors.New("test done"))
+			str.EXPECT().SetPriority(uint8(0), true)
+			_, err := client.RoundTrip(request.WithContext(WithPriority(context.Background(), 0, true)))
+			Expect(err).To(MatchError("test done"))
+			hfs := decodeHeader(buf)
+			Expect(hfs).To(HaveKeyWithValue("priority", "u=0, i"))
+			// the original request is not modified
+			Expect(request.Header).ToNot(HaveKey("Priority"))
+		})
+
+		Context("informational responses", func() {
+			It("skips informational responses", func() {
+				rspBuf := &bytes.Buffer{}
+				rw := newResponseWriter(rspBuf, utils.DefaultLogger)
+				rw.WriteHeader(103)
+				rw.Header().Set("foo", "bar")
+				rw.WriteHeader(200)
+				rw.Flush()
+
+				sess.EXPECT().OpenStream().Return(str, nil)
+				str.EXPECT().Write(gomock.Any()).AnyTimes()
+				str.EXPECT().Close()
+				str.EXPECT().Read(gomock.Any()).DoAndReturn(rspBuf.Read).AnyTimes()
+				rsp, err := client.RoundTrip(request)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(rsp.StatusCode).To(Equal(200))
+				Expect(rsp.Header.Get("foo")).To(Equal("bar"))
+			})
+
+			It("reports informational responses to the client trace", func() {
+				rspBuf := &bytes.Buffer{}
+				rw := newResponseWriter(rspBuf, utils.DefaultLogger)
+				rw.Header().Set("Link", "</style.css>; rel=preload")
+				rw.WriteHeader(103)
+				rw.Header().Del("Link")
+				rw.Header().Set("Content-Type", "text/plain")
+				rw.Write([]byte("foobar"))
+				rw.Flush()
+
+				type informationalResponse struct {
+					code   int
+					header textproto.MIMEHeader
+				}
+				var got1xx []informationalResponse
+				trace := &httptrace.ClientTrace{
+					Got1xxResponse: func(code int, header textproto.MIMEHeader) error {
+						got1xx = append(got1xx, informationalResponse{code: code, header: header})
+						return nil
+					},
+				}
+				req := request.WithContext(httptrace.WithClientTrace(context.Background(), trace))
+
+				sess.EXPECT().OpenStream().Return(str, nil)
+				str.EXPECT().Write(gomock.Any()).AnyTimes()
+				str.EXPECT().Close()
+				str.EXPECT().Read(gomock.Any()).DoAndReturn(rspBuf.Read).AnyTimes()
+				rsp, err := client.RoundTrip(req)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(got1xx).To(Equal([]informationalResponse{
+					{code: 103, header: textproto.MIMEHeader{"Link": {"</style.css>; rel=preload"}}},
+				}))
+				Expect(rsp.StatusCode).To(Equal(200))
+				Expect(rsp.Header).To(Equal(http.Header{"Content-Type": {"text/plain"}}))
+				data, err := ioutil.ReadAll(rsp.Body)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(data).To(Equal([]byte("foobar")))
+			})
+
+			It("calls Got100Continue", func() {
+				rspBuf := &bytes.Buffer{}
+				rw := newResponseWriter(rspBuf, utils.DefaultLogger)
+				rw.writeInformationalHeader(100, nil)
+				rw.WriteHeader(200)
+				rw.Flush()
+
+				var gotContinue bool
+				trace := &httptrace.ClientTrace{Got100Continue: func() { gotContinue = true }}
+				req := request.WithContext(httptrace.WithClientTrace(context.Background(), trace))
+
+				sess.EXPECT().OpenStream().Return(str, nil)
+				str.EXPECT().Write(gomock.Any()).AnyTimes()
+				str.EXPECT().Close()
+				str.EXPECT().Read(gomock.Any()).DoAndReturn(rspBuf.Read).AnyTimes()
+				rsp, err := client.RoundTrip(req)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(rsp.StatusCode).To(Equal(200))
+				Expect(gotContinue).To(BeTrue())
+			})
+
+			It("cancels the request when the client trace returns an error", func() {
+				rspBuf := &bytes.Buffer{}
+				rw := newResponseWriter(rspBuf, utils.DefaultLogger)
+				rw.WriteHeader(103)
+				rw.WriteHeader(200)
+				rw.Flush()
+
+				testErr := errors.New("test error")
+				trace := &httptrace.ClientTrace{
+					Got1xxResponse: func(int, textproto.MIMEHeader) error { return testErr },
+				}
+				req := request.WithContext(httptrace.WithClientTrace(context.Background(), trace))
+
+				sess.EXPECT().OpenStream().Return(str, nil)
+				str.EXPECT().Write(gomock.Any()).AnyTimes()
+				str.EXPECT().Close()
+				str.EXPECT().Read(gomock.Any()).DoAndReturn(rspBuf.Read).AnyTimes()
+				str.EXPECT().CancelWrite(quic.ErrorCode(errorRequestCanceled))
+				str.EXPECT().CancelRead(quic.ErrorCode(errorRequestCanceled))
+				_, err := client.RoundTrip(req)
+				Expect(err).To(MatchError(testErr))
+			})
+
+			It("errors when receiving too many informational responses", func() {
+				rspBuf := &bytes.Buffer{}
+				rw := newResponseWriter(rspBuf, utils.DefaultLogger)
+				for i := 0; i <= max1xxResponses; i++ {
+					rw.WriteHeader(103)
+				}
+				rw.WriteHeader(200)
+				rw.Flush()
+
+				sess.EXPECT().OpenStream().Return(str, nil)
+				str.EXPECT().Write(gomock.Any()).AnyTimes()
+				str.EXPECT().Close()
+				str.EXPECT().Read(gomock.Any()).DoAndReturn(rspBuf.Read).AnyTimes()
+				str.EXPECT().CancelWrite(quic.ErrorCode(errorExcessiveLoad))
+				str.EXPECT().CancelRead(quic.ErrorCode(errorExcessiveLoad))
+				_, err := client.RoundTrip(request)
+				Expect(err).To(MatchError("http3: too many 1xx informational responses"))
+			})
 		})
 
 		Context("gzip compression", func() {
@@ -290,7 +1202,7 @@ var _ = Describe("Client", func() {
 			})
 
 			It("adds the gzip header to requests", func() {
-				sess.EXPECT().OpenStreamSync().Return(str, nil)
+				sess.EXPECT().OpenStream().Return(str, nil)
 				buf := &bytes.Buffer{}
 				str.EXPECT().Write(gomock.Any()).DoAndReturn(func(p []byte) (int, error) {
 					return buf.Write(p)
@@ -305,7 +1217,7 @@ var _ = Describe("Client", func() {
 
 			It("doesn't add gzip if the header disable it", func() {
 				client = newClient("quic.clemente.io:1337", nil, &roundTripperOpts{DisableCompression: true}, nil, nil)
-				sess.EXPECT().OpenStreamSync().Return(str, nil)
+				sess.EXPECT().OpenStream().Return(str, nil)
 				buf := &bytes.Buffer{}
 				str.EXPECT().Write(gomock.Any()).DoAndReturn(func(p []byte) (int, error) {
 					return buf.Write(p)
@@ -319,13 +1231,14 @@ var _ = Describe("Client", func() {
 			})
 
 			It("decompresses the response", func() {
-				sess.EXPECT().OpenStreamSync().Return(str, nil)
+				sess.EXPECT().OpenStream().Return(str, nil)
 				buf := &bytes.Buffer{}
 				rw := newResponseWriter(buf, utils.DefaultLogger)
 				rw.Header().Set("Content-Encoding", "gzip")
 				gz := gzip.NewWriter(rw)
 				gz.Write([]byte("gzipped response"))
 				gz.Close()
+				rw.Flush()
 				str.EXPECT().Write(gomock.Any()).AnyTimes()
 				str.EXPECT().Read(gomock.Any()).DoAndReturn(func(p []byte) (int, error) {
 					return buf.Read(p)
@@ -343,10 +1256,11 @@ var _ = Describe("Client", func() {
 			})
 
 			It("only decompresses the response if the response contains the right content-encoding header", func() {
-				sess.EXPECT().OpenStreamSync().Return(str, nil)
+				sess.EXPECT().OpenStream().Return(str, nil)
 				buf := &bytes.Buffer{}
 				rw := newResponseWriter(buf, utils.DefaultLogger)
 				rw.Write([]byte("not gzipped"))
+				rw.Flush()
 				str.EXPECT().Write(gomock.Any()).AnyTimes()
 				str.EXPECT().Read(gomock.Any()).DoAndReturn(func(p []byte) (int, error) {
 					return buf.Read(p)
@@ -0,0 +1,54 @@
+package http3
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+
+	quic "github.com/lucas-clemente/quic-go"
+)
+
+// ConnectionState describes the QUIC connection that a request was received on (on the server side),
+// or that a response was received on (on the client side).
+type ConnectionState struct {
+	// TLS contains details about the TLS handshake,
+	// e.g. the negotiated ALPN and the peer's certificates.
+	TLS tls.ConnectionState
+	// Stats is a snapshot of the connection statistics (e.g. the RTT),
+	// taken when the request headers (on the server side) or the response headers (on the client side) were received.
+	Stats quic.ConnectionStats
+	// ConnectionID identifies the QUIC connection, see quic.Session.ConnectionID.
+	ConnectionID string
+	LocalAddr    net.Addr
+	RemoteAddr   net.Addr
+}
+
+type connectionStateKey struct{}
+
+func newConnectionState(sess quic.Session) *ConnectionState {
+	return &ConnectionState{
+		TLS:          sess.ConnectionState(),
+		Stats:        sess.ConnectionStats(),
+		ConnectionID: sess.ConnectionID(),
+		LocalAddr:    sess.LocalAddr(),
+		RemoteAddr:   sess.RemoteAddr(),
+	}
+}
+
+// ServerConnectionState returns the state of the QUIC connection that a request was received on.
+// It is called with the context of a request passed to an http.Handler.
+func ServerConnectionState(ctx context.Context) (*ConnectionState, bool) {
+	state, ok := ctx.Value(connectionStateKey{}).(*ConnectionState)
+	return state, ok
+}
+
+// ResponseConnectionState returns the state of the QUIC connection that a response was received on.
+// It is stored in the context of the response's Request.
+func ResponseConnectionState(rsp *http.Response) (*ConnectionState, bool) {
+	if rsp.Request == nil {
+		return nil, false
+	}
+	state, ok := rsp.Request.Context().Value(connectionStateKey{}).(*ConnectionState)
+	return state, ok
+}
@@ -0,0 +1,143 @@
+package http3
+
+import (
+	"bytes"
+	"errors"
+	"sync/atomic"
+
+	quic "github.com/lucas-clemente/quic-go"
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+	"github.com/lucas-clemente/quic-go/internal/utils"
+)
+
+// nextProtoH3 is the ALPN protocol negotiated for HTTP/3.
+const nextProtoH3 = "h3-19"
+
+// The stream types of unidirectional streams.
+const (
+	streamTypeControlStream      = 0x0
+	streamTypePushStream         = 0x1
+	streamTypeQPACKEncoderStream = 0x2
+	streamTypeQPACKDecoderStream = 0x3
+)
+
+// openControlStream opens the control stream, and sends the SETTINGS frame on it.
+// The SETTINGS frame announces the limit for the size of header lists that the peer may send,
+// and if WebTransport is enabled.
+func openControlStream(sess quic.Session, maxHeaderBytes uint64, enableWebTransport bool) (quic.SendStream, error) {
+	str, err := sess.OpenUniStreamSync()
+	if err != nil {
+		return nil, err
+	}
+	settings := map[uint64]uint64{settingMaxHeaderListSize: maxHeaderBytes}
+	if enableWebTransport {
+		settings[settingEnableConnectProtocol] = 1
+		settings[settingEnableWebTransport] = 1
+	}
+	buf := &bytes.Buffer{}
+	utils.WriteVarInt(buf, streamTypeControlStream)
+	(&settingsFrame{settings: settings}).Write(buf)
+	if _, err := str.Write(buf.Bytes()); err != nil {
+		return nil, err
+	}
+	return str, nil
+}
+
+// A pushFrameHandler handles the MAX_PUSH_ID and CANCEL_PUSH frames received on the control stream.
+type pushFrameHandler func(frame) error
+
+// A goAwayHandler handles the GOAWAY frames received on the control stream.
+type goAwayHandler func(protocol.StreamID)
+
+// handleUnidirectionalStreams accepts the unidirectional streams opened by the peer.
+// If handlePushFrame is nil, MAX_PUSH_ID and CANCEL_PUSH frames are treated as unexpected frames.
+// If handleGoAway is nil, GOAWAY frames are treated as unexpected frames.
+// If webTransport is nil, WebTransport datagram streams are treated as unknown streams.
+// It returns when the session is closed.
+func handleUnidirectionalStreams(sess quic.Session, perspective protocol.Perspective, handlePushFrame pushFrameHandler, handleGoAway goAwayHandler, webTransport *webTransportManager, logger utils.Logger) {
+	var rcvdControlStream int32 // accessed atomically
+	for {
+		str, err := sess.AcceptUniStream()
+		if err != nil {
+			logger.Debugf("Accepting unidirectional stream failed: %s", err)
+			return
+		}
+		// Read the stream type in a separate go routine.
+		// Otherwise a peer that doesn't send the stream type would block the accept loop.
+		go func(str quic.ReceiveStream) {
+			streamType, err := utils.ReadVarInt(&byteReaderImpl{str})
+			if err != nil {
+				logger.Debugf("Reading the stream type on stream %d failed: %s", str.StreamID(), err)
+				return
+			}
+			switch streamType {
+			case streamTypeControlStream:
+				if !atomic.CompareAndSwapInt32(&rcvdControlStream, 0, 1) {
+					sess.CloseWithError(quic.ErrorCode(errorWrongStreamCount), errors.New("received a second control stream"))
+					return
+				}
+				handleControlStream(sess, str, handlePushFrame, handleGoAway, logger)
+			case streamTypePushStream:
+				if perspective == protocol.PerspectiveServer {
+					sess.CloseWithError(quic.ErrorCode(errorWrongStreamDirection), errors.New("client opened a push stream"))
+					return
+				}
+				// We never send a MAX_PUSH_ID frame, so the server is not allowed to push.
+				sess.CloseWithError(quic.ErrorCode(errorLimitExceeded), errors.New("server opened a push stream"))
+			case streamTypeQPACKEncoderStream, streamTypeQPACKDecoderStream:
+				// We only use the QPACK static table.
+				// The dynamic table capacity is 0, so the peer doesn't send anything on these streams.
+			case streamTypeWebTransportDatagram:
+				if webTransport == nil {
+					str.CancelRead(quic.ErrorCode(errorUnknownStreamType))
+					return
+				}
+				webTransport.handleDatagramStream(str)
+			default:
+				str.CancelRead(quic.ErrorCode(errorUnknownStreamType))
+			}
+		}(str)
+	}
+}
+
+// handleControlStream reads the frames sent on the peer's control stream.
+// The first frame must be a SETTINGS frame.
+func handleControlStream(sess quic.Session, str quic.ReceiveStream, handlePushFrame pushFrameHandler, handleGoAway goAwayHandler, logger utils.Logger) {
+	f, err := parseNextFrame(str)
+	if err != nil {
+		sess.CloseWithError(quic.ErrorCode(errorClosedCriticalStream), err)
+		return
+	}
+	if _, ok := f.(*settingsFrame); !ok {
+		sess.CloseWithError(quic.ErrorCode(errorMissingSettings), errors.New("first frame on the control stream is not a SETTINGS frame"))
+		return
+	}
+	for {
+		// parseNextFrame skips over all frames that we don't handle yet.
+		f, err := parseNextFrame(str)
+		if err != nil {
+			sess.CloseWithError(quic.ErrorCode(errorClosedCriticalStream), err)
+			return
+		}
+		switch f := f.(type) {
+		case *goAwayFrame:
+			if handleGoAway == nil {
+				break
+			}
+			handleGoAway(f.StreamID)
+			continue
+		case *maxPushIDFrame, *cancelPushFrame:
+			if handlePushFrame == nil {
+				break
+			}
+			if err := handlePushFrame(f); err != nil {
+				sess.CloseWithError(quic.ErrorCode(errorGeneralProtocolError), err)
+				return
+			}
+			continue
+		}
+		logger.Debugf("Received unexpected frame on the control stream: %#v", f)
+		sess.CloseWithError(quic.ErrorCode(errorUnexpectedFrame), errors.New("unexpected frame on the control stream"))
+		return
+	}
+}
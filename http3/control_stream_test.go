@@ -0,0 +1,278 @@
+package http3
+
+import (
+	"bytes"
+	"errors"
+	"io"
+
+	"github.com/golang/mock/gomock"
+	quic "github.com/lucas-clemente/quic-go"
+	mockquic "github.com/lucas-clemente/quic-go/internal/mocks/quic"
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+	"github.com/lucas-clemente/quic-go/internal/utils"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Control Stream", func() {
+	var (
+		sess     *mockquic.MockSession
+		closed   chan quic.ErrorCode
+		testDone chan struct{}
+	)
+
+	BeforeEach(func() {
+		testDone = make(chan struct{})
+		sess = mockquic.NewMockSession(mockCtrl)
+		closedChan := make(chan quic.ErrorCode, 1)
+		closed = closedChan
+		sess.EXPECT().CloseWithError(gomock.Any(), gomock.Any()).Do(func(code quic.ErrorCode, _ error) {
+			closedChan <- code
+		}).MaxTimes(1)
+	})
+
+	AfterEach(func() {
+		close(testDone)
+	})
+
+	// newStream creates a unidirectional stream that returns the data, followed by an io.EOF
+	newStream := func(data []byte) *mockquic.MockStream {
+		str := mockquic.NewMockStream(mockCtrl)
+		buf := bytes.NewBuffer(data)
+		str.EXPECT().StreamID().AnyTimes()
+		str.EXPECT().Read(gomock.Any()).DoAndReturn(buf.Read).AnyTimes()
+		return str
+	}
+
+	// newBlockingStream creates a unidirectional stream that returns the data, and then blocks until the test ends
+	newBlockingStream := func(data []byte) *mockquic.MockStream {
+		str := mockquic.NewMockStream(mockCtrl)
+		buf := bytes.NewBuffer(data)
+		done := testDone
+		str.EXPECT().StreamID().AnyTimes()
+		str.EXPECT().Read(gomock.Any()).DoAndReturn(func(b []byte) (int, error) {
+			if buf.Len() == 0 {
+				<-done
+				return 0, io.EOF
+			}
+			return buf.Read(b)
+		}).AnyTimes()
+		return str
+	}
+
+	// acceptStreams makes AcceptUniStream return the streams, followed by an error
+	acceptStreams := func(strs ...quic.ReceiveStream) {
+		calls := make([]*gomock.Call, 0, len(strs)+1)
+		for _, str := range strs {
+			calls = append(calls, sess.EXPECT().AcceptUniStream().Return(str, nil))
+		}
+		calls = append(calls, sess.EXPECT().AcceptUniStream().Return(nil, errors.New("test done")))
+		gomock.InOrder(calls...)
+	}
+
+	controlStreamData := func(frames ...[]byte) []byte {
+		buf := &bytes.Buffer{}
+		utils.WriteVarInt(buf, streamTypeControlStream)
+		for _, f := range frames {
+			buf.Write(f)
+		}
+		return buf.Bytes()
+	}
+
+	settings := func() []byte {
+		buf := &bytes.Buffer{}
+		(&settingsFrame{}).Write(buf)
+		return buf.Bytes()
+	}
+
+	It("opens the control stream and sends a SETTINGS frame", func() {
+		str := mockquic.NewMockStream(mockCtrl)
+		sess.EXPECT().OpenUniStreamSync().Return(str, nil)
+		buf := &bytes.Buffer{}
+		str.EXPECT().Write(gomock.Any()).DoAndReturn(buf.Write)
+		Expect(openControlStream(sess, 1337, false)).To(Equal(str))
+		streamType, err := utils.ReadVarInt(buf)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(streamType).To(BeEquivalentTo(streamTypeControlStream))
+		f, err := parseNextFrame(buf)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(f).To(BeAssignableToTypeOf(&settingsFrame{}))
+		Expect(f.(*settingsFrame).settings).To(HaveKeyWithValue(uint64(settingMaxHeaderListSize), uint64(1337)))
+	})
+
+	It("announces WebTransport support", func() {
+		str := mockquic.NewMockStream(mockCtrl)
+		sess.EXPECT().OpenUniStreamSync().Return(str, nil)
+		buf := &bytes.Buffer{}
+		str.EXPECT().Write(gomock.Any()).DoAndReturn(buf.Write)
+		Expect(openControlStream(sess, 1337, true)).To(Equal(str))
+		_, err := utils.ReadVarInt(buf)
+		Expect(err).ToNot(HaveOccurred())
+		f, err := parseNextFrame(buf)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(f).To(BeAssignableToTypeOf(&settingsFrame{}))
+		Expect(f.(*settingsFrame).settings).To(HaveKeyWithValue(uint64(settingEnableConnectProtocol), uint64(1)))
+		Expect(f.(*settingsFrame).settings).To(HaveKeyWithValue(uint64(settingEnableWebTransport), uint64(1)))
+	})
+
+	It("errors when opening the control stream fails", func() {
+		testErr := errors.New("stream open error")
+		sess.EXPECT().OpenUniStreamSync().Return(nil, testErr)
+		_, err := openControlStream(sess, 1337, false)
+		Expect(err).To(MatchError(testErr))
+	})
+
+	It("accepts a control stream starting with a SETTINGS frame", func() {
+		acceptStreams(newStream(controlStreamData(settings())))
+		handleUnidirectionalStreams(sess, protocol.PerspectiveServer, nil, nil, nil, utils.DefaultLogger)
+		// The control stream is closed after the SETTINGS frame.
+		// This is an error, since the control stream is a critical stream.
+		Eventually(closed).Should(Receive(Equal(quic.ErrorCode(errorClosedCriticalStream))))
+	})
+
+	It("closes the session if the first frame is not a SETTINGS frame", func() {
+		buf := &bytes.Buffer{}
+		(&dataFrame{Length: 6}).Write(buf)
+		buf.Write([]byte("foobar"))
+		acceptStreams(newStream(controlStreamData(buf.Bytes())))
+		handleUnidirectionalStreams(sess, protocol.PerspectiveServer, nil, nil, nil, utils.DefaultLogger)
+		Eventually(closed).Should(Receive(Equal(quic.ErrorCode(errorMissingSettings))))
+	})
+
+	It("closes the session when receiving a second SETTINGS frame", func() {
+		acceptStreams(newStream(controlStreamData(settings(), settings())))
+		handleUnidirectionalStreams(sess, protocol.PerspectiveClient, nil, nil, nil, utils.DefaultLogger)
+		Eventually(closed).Should(Receive(Equal(quic.ErrorCode(errorUnexpectedFrame))))
+	})
+
+	It("passes MAX_PUSH_ID and CANCEL_PUSH frames to the push frame handler", func() {
+		buf := &bytes.Buffer{}
+		(&maxPushIDFrame{PushID: 10}).Write(buf)
+		(&cancelPushFrame{PushID: 3}).Write(buf)
+		acceptStreams(newStream(controlStreamData(settings(), buf.Bytes())))
+		var frames []frame
+		handleUnidirectionalStreams(sess, protocol.PerspectiveServer, func(f frame) error {
+			frames = append(frames, f)
+			return nil
+		}, nil, nil, utils.DefaultLogger)
+		Eventually(closed).Should(Receive(Equal(quic.ErrorCode(errorClosedCriticalStream))))
+		Expect(frames).To(Equal([]frame{&maxPushIDFrame{PushID: 10}, &cancelPushFrame{PushID: 3}}))
+	})
+
+	It("closes the session when the push frame handler errors", func() {
+		buf := &bytes.Buffer{}
+		(&maxPushIDFrame{PushID: 10}).Write(buf)
+		acceptStreams(newStream(controlStreamData(settings(), buf.Bytes())))
+		handleUnidirectionalStreams(sess, protocol.PerspectiveServer, func(frame) error {
+			return errors.New("invalid frame")
+		}, nil, nil, utils.DefaultLogger)
+		Eventually(closed).Should(Receive(Equal(quic.ErrorCode(errorGeneralProtocolError))))
+	})
+
+	It("treats push frames as unexpected if there's no push frame handler", func() {
+		buf := &bytes.Buffer{}
+		(&maxPushIDFrame{PushID: 10}).Write(buf)
+		acceptStreams(newStream(controlStreamData(settings(), buf.Bytes())))
+		handleUnidirectionalStreams(sess, protocol.PerspectiveClient, nil, nil, nil, utils.DefaultLogger)
+		Eventually(closed).Should(Receive(Equal(quic.ErrorCode(errorUnexpectedFrame))))
+	})
+
+	It("passes GOAWAY frames to the GOAWAY handler", func() {
+		buf := &bytes.Buffer{}
+		(&goAwayFrame{StreamID: 8}).Write(buf)
+		acceptStreams(newStream(controlStreamData(settings(), buf.Bytes())))
+		var streamIDs []protocol.StreamID
+		handleUnidirectionalStreams(sess, protocol.PerspectiveClient, nil, func(id protocol.StreamID) {
+			streamIDs = append(streamIDs, id)
+		}, nil, utils.DefaultLogger)
+		Eventually(closed).Should(Receive(Equal(quic.ErrorCode(errorClosedCriticalStream))))
+		Expect(streamIDs).To(Equal([]protocol.StreamID{8}))
+	})
+
+	It("treats GOAWAY frames as unexpected if there's no GOAWAY handler", func() {
+		buf := &bytes.Buffer{}
+		(&goAwayFrame{StreamID: 8}).Write(buf)
+		acceptStreams(newStream(controlStreamData(settings(), buf.Bytes())))
+		handleUnidirectionalStreams(sess, protocol.PerspectiveServer, nil, nil, nil, utils.DefaultLogger)
+		Eventually(closed).Should(Receive(Equal(quic.ErrorCode(errorUnexpectedFrame))))
+	})
+
+	It("closes the session when the peer opens a second control stream", func() {
+		// Both control streams block after the SETTINGS frame.
+		acceptStreams(
+			newBlockingStream(controlStreamData(settings())),
+			newBlockingStream(controlStreamData(settings())),
+		)
+		handleUnidirectionalStreams(sess, protocol.PerspectiveServer, nil, nil, nil, utils.DefaultLogger)
+		Eventually(closed).Should(Receive(Equal(quic.ErrorCode(errorWrongStreamCount))))
+		// the first control stream is closed when the test ends
+		sess.EXPECT().CloseWithError(gomock.Any(), gomock.Any()).AnyTimes()
+	})
+
+	It("doesn't block the accept loop on streams that don't send the stream type", func() {
+		acceptStreams(
+			newBlockingStream(nil),
+			newStream(controlStreamData(settings())),
+		)
+		handleUnidirectionalStreams(sess, protocol.PerspectiveServer, nil, nil, nil, utils.DefaultLogger)
+		Eventually(closed).Should(Receive(Equal(quic.ErrorCode(errorClosedCriticalStream))))
+	})
+
+	It("closes the session when the client opens a push stream", func() {
+		buf := &bytes.Buffer{}
+		utils.WriteVarInt(buf, streamTypePushStream)
+		acceptStreams(newStream(buf.Bytes()))
+		handleUnidirectionalStreams(sess, protocol.PerspectiveServer, nil, nil, nil, utils.DefaultLogger)
+		Eventually(closed).Should(Receive(Equal(quic.ErrorCode(errorWrongStreamDirection))))
+	})
+
+	It("ignores the QPACK streams", func() {
+		encBuf := &bytes.Buffer{}
+		utils.WriteVarInt(encBuf, streamTypeQPACKEncoderStream)
+		decBuf := &bytes.Buffer{}
+		utils.WriteVarInt(decBuf, streamTypeQPACKDecoderStream)
+		acceptStreams(newStream(encBuf.Bytes()), newStream(decBuf.Bytes()))
+		handleUnidirectionalStreams(sess, protocol.PerspectiveClient, nil, nil, nil, utils.DefaultLogger)
+		Consistently(closed).ShouldNot(Receive())
+	})
+
+	It("cancels reading on streams of unknown types", func() {
+		buf := &bytes.Buffer{}
+		utils.WriteVarInt(buf, 0x21)
+		str := newStream(buf.Bytes())
+		canceled := make(chan struct{})
+		str.EXPECT().CancelRead(quic.ErrorCode(errorUnknownStreamType)).Do(func(quic.ErrorCode) { close(canceled) })
+		acceptStreams(str)
+		handleUnidirectionalStreams(sess, protocol.PerspectiveClient, nil, nil, nil, utils.DefaultLogger)
+		Eventually(canceled).Should(BeClosed())
+		Expect(closed).ToNot(Receive())
+	})
+
+	It("passes WebTransport datagrams to the session", func() {
+		webTransport := newWebTransportManager(sess, utils.DefaultLogger)
+		requestStr := mockquic.NewMockStream(mockCtrl)
+		requestStr.EXPECT().StreamID().Return(protocol.StreamID(4)).AnyTimes()
+		wsess := webTransport.addSession(requestStr, nil)
+		buf := &bytes.Buffer{}
+		utils.WriteVarInt(buf, streamTypeWebTransportDatagram)
+		utils.WriteVarInt(buf, 4)
+		buf.Write([]byte("foobar"))
+		acceptStreams(newStream(buf.Bytes()))
+		handleUnidirectionalStreams(sess, protocol.PerspectiveClient, nil, nil, webTransport, utils.DefaultLogger)
+		Expect(wsess.ReceiveDatagram()).To(Equal([]byte("foobar")))
+	})
+
+	It("treats WebTransport datagram streams as unknown streams, if WebTransport is disabled", func() {
+		buf := &bytes.Buffer{}
+		utils.WriteVarInt(buf, streamTypeWebTransportDatagram)
+		utils.WriteVarInt(buf, 4)
+		str := newStream(buf.Bytes())
+		canceled := make(chan struct{})
+		str.EXPECT().CancelRead(quic.ErrorCode(errorUnknownStreamType)).Do(func(quic.ErrorCode) { close(canceled) })
+		acceptStreams(str)
+		handleUnidirectionalStreams(sess, protocol.PerspectiveClient, nil, nil, nil, utils.DefaultLogger)
+		Eventually(canceled).Should(BeClosed())
+		Expect(closed).ToNot(Receive())
+	})
+})
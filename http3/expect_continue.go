@@ -0,0 +1,76 @@
+package http3
+
+import (
+	"errors"
+	"io"
+	"sync"
+	"time"
+)
+
+// defaultExpectContinueTimeout is the time the client waits for a 100 Continue response
+// before sending the body of a request with an Expect: 100-continue header.
+const defaultExpectContinueTimeout = time.Second
+
+// errExpectationFailed is returned when reading an expectContinueBody,
+// if the server sent a final response before the 100 Continue.
+var errExpectationFailed = errors.New("http3: server responded before 100 Continue, not sending the request body")
+
+// expectContinueBody delays sending a request body until the server sent a 100 Continue response,
+// or until the timeout expires.
+// If the server sends a final response instead, the body is not sent.
+type expectContinueBody struct {
+	io.ReadCloser
+
+	timeout time.Duration
+
+	mutex   sync.Mutex
+	decided chan struct{} // closed once the server sent a 100 Continue or a final response, or when the timeout expired
+	waited  bool          // set once the first Read call stopped waiting
+	send    bool
+}
+
+func newExpectContinueBody(body io.ReadCloser, timeout time.Duration) *expectContinueBody {
+	return &expectContinueBody{
+		ReadCloser: body,
+		timeout:    timeout,
+		decided:    make(chan struct{}),
+	}
+}
+
+func (b *expectContinueBody) Read(p []byte) (int, error) {
+	if !b.waited {
+		timer := time.NewTimer(b.timeout)
+		select {
+		case <-b.decided:
+		case <-timer.C:
+			// The server didn't respond in time. Send the body anyway.
+			b.decide(true)
+		}
+		timer.Stop()
+		b.waited = true
+	}
+	b.mutex.Lock()
+	send := b.send
+	b.mutex.Unlock()
+	if !send {
+		return 0, errExpectationFailed
+	}
+	return b.ReadCloser.Read(p)
+}
+
+// decide is called when the 100 Continue (send == true) or a final response (send == false) was received.
+// Only the first call has an effect.
+// In particular, once sending of the body started (after the timeout), it is not aborted any more.
+// It returns whether the body is sent.
+func (b *expectContinueBody) decide(send bool) bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	select {
+	case <-b.decided:
+		return b.send
+	default:
+	}
+	b.send = send
+	close(b.decided)
+	return send
+}
@@ -46,18 +46,33 @@ func parseNextFrame(b io.Reader) (frame, error) {
 		return &dataFrame{Length: l}, nil
 	case 0x1:
 		return &headersFrame{Length: l}, nil
+	case 0x3:
+		pushID, err := parsePushID(br, l)
+		if err != nil {
+			return nil, err
+		}
+		return &cancelPushFrame{PushID: pushID}, nil
 	case 0x4:
 		return parseSettingsFrame(br, l)
+	case 0x7:
+		streamID, err := parseSingleVarInt(br, l, "stream ID")
+		if err != nil {
+			return nil, err
+		}
+		return &goAwayFrame{StreamID: protocol.StreamID(streamID)}, nil
+	case 0xd:
+		pushID, err := parsePushID(br, l)
+		if err != nil {
+			return nil, err
+		}
+		return &maxPushIDFrame{PushID: pushID}, nil
+	case frameTypeWebTransportStream:
+		// This frame doesn't have a length. It is followed by the session ID, and then by the stream data.
+		return &webTransportStreamFrame{SessionID: protocol.StreamID(l)}, nil
 	case 0x2: // PRIORITY
 		fallthrough
-	case 0x3: // CANCEL_PUSH
-		fallthrough
 	case 0x5: // PUSH_PROMISE
 		fallthrough
-	case 0x7: // GOAWAY
-		fallthrough
-	case 0xd: // MAX_PUSH_ID
-		fallthrough
 	case 0xe: // DUPLICATE_PUSH
 		fallthrough
 	default:
@@ -78,6 +93,15 @@ func (f *dataFrame) Write(b *bytes.Buffer) {
 	utils.WriteVarInt(b, f.Length)
 }
 
+type webTransportStreamFrame struct {
+	SessionID protocol.StreamID
+}
+
+func (f *webTransportStreamFrame) Write(b *bytes.Buffer) {
+	utils.WriteVarInt(b, frameTypeWebTransportStream)
+	utils.WriteVarInt(b, uint64(f.SessionID))
+}
+
 type headersFrame struct {
 	Length uint64
 }
@@ -133,3 +157,75 @@ func (f *settingsFrame) Write(b *bytes.Buffer) {
 		utils.WriteVarInt(b, val)
 	}
 }
+
+// parsePushID parses the payload of CANCEL_PUSH and MAX_PUSH_ID frames, which consists of a single push ID.
+func parsePushID(r io.Reader, l uint64) (uint64, error) {
+	return parseSingleVarInt(r, l, "push ID")
+}
+
+// parseSingleVarInt parses a frame payload consisting of a single varint, e.g. a push ID or a stream ID.
+func parseSingleVarInt(r io.Reader, l uint64, name string) (uint64, error) {
+	if l == 0 || l > 8 {
+		return 0, fmt.Errorf("unexpected length for a frame containing a %s: %d", name, l)
+	}
+	buf := make([]byte, l)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return 0, io.EOF
+		}
+		return 0, err
+	}
+	b := bytes.NewReader(buf)
+	val, err := utils.ReadVarInt(b)
+	if err != nil {
+		return 0, err
+	}
+	if b.Len() > 0 {
+		return 0, fmt.Errorf("frame contains more data than the %s", name)
+	}
+	return val, nil
+}
+
+// The pushPromiseFrame is followed by the (QPACK-encoded) header block of the promised request.
+type pushPromiseFrame struct {
+	PushID uint64
+	Length uint64 // the length of the header block
+}
+
+func (f *pushPromiseFrame) Write(b *bytes.Buffer) {
+	utils.WriteVarInt(b, 0x5)
+	utils.WriteVarInt(b, uint64(utils.VarIntLen(f.PushID))+f.Length)
+	utils.WriteVarInt(b, f.PushID)
+}
+
+type cancelPushFrame struct {
+	PushID uint64
+}
+
+func (f *cancelPushFrame) Write(b *bytes.Buffer) {
+	utils.WriteVarInt(b, 0x3)
+	utils.WriteVarInt(b, uint64(utils.VarIntLen(f.PushID)))
+	utils.WriteVarInt(b, f.PushID)
+}
+
+type maxPushIDFrame struct {
+	PushID uint64
+}
+
+func (f *maxPushIDFrame) Write(b *bytes.Buffer) {
+	utils.WriteVarInt(b, 0xd)
+	utils.WriteVarInt(b, uint64(utils.VarIntLen(f.PushID)))
+	utils.WriteVarInt(b, f.PushID)
+}
+
+// The goAwayFrame is sent by the server to initiate a graceful shutdown of the connection.
+// Requests on streams with a stream ID greater than or equal to StreamID are not processed.
+type goAwayFrame struct {
+	StreamID protocol.StreamID
+}
+
+func (f *goAwayFrame) Write(b *bytes.Buffer) {
+	utils.WriteVarInt(b, 0x7)
+	utils.WriteVarInt(b, uint64(utils.VarIntLen(uint64(f.StreamID))))
+	utils.WriteVarInt(b, uint64(f.StreamID))
+}
@@ -71,6 +71,29 @@ var _ = Describe("Frames", func() {
 		})
 	})
 
+	Context("WEBTRANSPORT_STREAM frames", func() {
+		It("parses", func() {
+			data := appendVarInt(nil, 0x41) // type byte
+			data = appendVarInt(data, 0x1337)
+			data = append(data, []byte("foobar")...)
+			r := bytes.NewReader(data)
+			frame, err := parseNextFrame(r)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(frame).To(Equal(&webTransportStreamFrame{SessionID: 0x1337}))
+			// the frame doesn't have a length, it is followed by the stream data
+			Expect(r.Len()).To(Equal(6))
+		})
+
+		It("writes", func() {
+			buf := &bytes.Buffer{}
+			(&webTransportStreamFrame{SessionID: 0xdeadbeef}).Write(buf)
+			frame, err := parseNextFrame(buf)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(frame).To(Equal(&webTransportStreamFrame{SessionID: 0xdeadbeef}))
+			Expect(buf.Len()).To(BeZero())
+		})
+	})
+
 	Context("SETTINGS frames", func() {
 		It("parses", func() {
 			settings := appendVarInt(nil, 13)
@@ -133,4 +156,99 @@ var _ = Describe("Frames", func() {
 			}
 		})
 	})
+
+	Context("CANCEL_PUSH frames", func() {
+		It("parses", func() {
+			data := appendVarInt(nil, 3) // type byte
+			data = appendVarInt(data, 2)
+			data = appendVarInt(data, 0x1337)
+			frame, err := parseNextFrame(bytes.NewReader(data))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(frame).To(Equal(&cancelPushFrame{PushID: 0x1337}))
+		})
+
+		It("writes", func() {
+			buf := &bytes.Buffer{}
+			(&cancelPushFrame{PushID: 0xdeadbeef}).Write(buf)
+			frame, err := parseNextFrame(buf)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(frame).To(Equal(&cancelPushFrame{PushID: 0xdeadbeef}))
+			Expect(buf.Len()).To(BeZero())
+		})
+
+		It("rejects frames that contain more data than the push ID", func() {
+			data := appendVarInt(nil, 3) // type byte
+			data = appendVarInt(data, 3)
+			data = appendVarInt(data, 0x1337)
+			data = append(data, 0x0)
+			_, err := parseNextFrame(bytes.NewReader(data))
+			Expect(err).To(MatchError("frame contains more data than the push ID"))
+		})
+
+		It("errors on EOF", func() {
+			buf := &bytes.Buffer{}
+			(&cancelPushFrame{PushID: 0xdeadbeef}).Write(buf)
+			data := buf.Bytes()
+			for i := range data {
+				_, err := parseNextFrame(bytes.NewReader(data[:i]))
+				Expect(err).To(MatchError(io.EOF))
+			}
+		})
+	})
+
+	Context("MAX_PUSH_ID frames", func() {
+		It("writes", func() {
+			buf := &bytes.Buffer{}
+			(&maxPushIDFrame{PushID: 42}).Write(buf)
+			frame, err := parseNextFrame(buf)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(frame).To(Equal(&maxPushIDFrame{PushID: 42}))
+			Expect(buf.Len()).To(BeZero())
+		})
+
+		It("rejects frames with an invalid length", func() {
+			data := appendVarInt(nil, 0xd) // type byte
+			data = appendVarInt(data, 0)
+			_, err := parseNextFrame(bytes.NewReader(data))
+			Expect(err).To(MatchError("unexpected length for a frame containing a push ID: 0"))
+		})
+	})
+
+	Context("GOAWAY frames", func() {
+		It("writes", func() {
+			buf := &bytes.Buffer{}
+			(&goAwayFrame{StreamID: 0x1337}).Write(buf)
+			frame, err := parseNextFrame(buf)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(frame).To(Equal(&goAwayFrame{StreamID: 0x1337}))
+			Expect(buf.Len()).To(BeZero())
+		})
+
+		It("rejects frames that contain more data than the stream ID", func() {
+			data := appendVarInt(nil, 7) // type byte
+			data = appendVarInt(data, 3)
+			data = appendVarInt(data, 0x1337)
+			data = append(data, 0x0)
+			_, err := parseNextFrame(bytes.NewReader(data))
+			Expect(err).To(MatchError("frame contains more data than the stream ID"))
+		})
+	})
+
+	Context("PUSH_PROMISE frames", func() {
+		It("writes", func() {
+			buf := &bytes.Buffer{}
+			(&pushPromiseFrame{PushID: 0x1337, Length: 6}).Write(buf)
+			buf.Write([]byte("foobar"))
+			t, err := utils.ReadVarInt(buf)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(t).To(BeEquivalentTo(5))
+			l, err := utils.ReadVarInt(buf)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(l).To(BeEquivalentTo(2 + 6))
+			pushID, err := utils.ReadVarInt(buf)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(pushID).To(BeEquivalentTo(0x1337))
+			Expect(buf.Bytes()).To(Equal([]byte("foobar")))
+		})
+	})
 })
@@ -0,0 +1,51 @@
+package http3
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/marten-seemann/qpack"
+)
+
+// settingMaxHeaderListSize is the SETTINGS_MAX_HEADER_LIST_SIZE setting.
+const settingMaxHeaderListSize = 0x6
+
+var errHeaderTooLarge = errors.New("http3: header too large")
+
+// maxHeaderBytesOrDefault returns the limit for the size of header blocks.
+// If no limit is configured, it uses the same default as net/http (1 MB).
+func maxHeaderBytesOrDefault(maxHeaderBytes int64) uint64 {
+	if maxHeaderBytes <= 0 {
+		return http.DefaultMaxHeaderBytes
+	}
+	return uint64(maxHeaderBytes)
+}
+
+// decodeHeaders decodes a header block.
+// It returns errHeaderTooLarge if the decoded header list exceeds maxHeaderBytes.
+// Callers are expected to check that the size of the header block itself doesn't exceed maxHeaderBytes
+// before reading it from the stream.
+// The size of the header list is calculated as defined for SETTINGS_MAX_HEADER_LIST_SIZE:
+// the sum of the lengths of all names and values, plus an overhead of 32 bytes for each field.
+// Fields exceeding the limit are discarded while decoding, so that memory usage stays bounded.
+func decodeHeaders(headerBlock []byte, maxHeaderBytes uint64) ([]qpack.HeaderField, error) {
+	var hfs []qpack.HeaderField
+	var size uint64
+	decoder := qpack.NewDecoder(func(hf qpack.HeaderField) {
+		size += uint64(len(hf.Name)+len(hf.Value)) + 32
+		if size > maxHeaderBytes {
+			return
+		}
+		hfs = append(hfs, hf)
+	})
+	if _, err := decoder.Write(headerBlock); err != nil {
+		return nil, err
+	}
+	if err := decoder.Close(); err != nil {
+		return nil, err
+	}
+	if size > maxHeaderBytes {
+		return nil, errHeaderTooLarge
+	}
+	return hfs, nil
+}
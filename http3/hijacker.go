@@ -0,0 +1,72 @@
+package http3
+
+import (
+	"io"
+	"net/http"
+	"sync"
+
+	quic "github.com/lucas-clemente/quic-go"
+)
+
+// A Hijacker allows taking over the QUIC stream that a request was sent on.
+// This is useful for protocols that use HTTP/3 to set up a stream, and then send their own data on it.
+//
+// On the server side, the http.ResponseWriter passed to the handler implements Hijacker.
+// On the client side, the body of the http.Response implements Hijacker,
+// if the request was sent with RoundTripOpt.HijackStream set.
+type Hijacker interface {
+	// HijackStream returns the stream. After a call to HijackStream, the HTTP/3 layer won't touch the stream any more:
+	// it won't read or write any frames, and it won't close the stream.
+	// Any data that was written to the http.ResponseWriter before is sent on the stream.
+	// It returns http.ErrHijacked if the stream was already hijacked.
+	HijackStream() (quic.Stream, error)
+}
+
+// hijackableBody is the body of a response to a request sent with RoundTripOpt.HijackStream.
+type hijackableBody struct {
+	io.ReadCloser
+
+	mutex    sync.Mutex
+	str      quic.Stream
+	hijacked bool
+}
+
+var _ Hijacker = &hijackableBody{}
+
+func newHijackableBody(body io.ReadCloser, str quic.Stream) *hijackableBody {
+	return &hijackableBody{
+		ReadCloser: body,
+		str:        str,
+	}
+}
+
+func (b *hijackableBody) HijackStream() (quic.Stream, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if b.hijacked {
+		return nil, http.ErrHijacked
+	}
+	b.hijacked = true
+	return b.str, nil
+}
+
+func (b *hijackableBody) Read(p []byte) (int, error) {
+	b.mutex.Lock()
+	hijacked := b.hijacked
+	b.mutex.Unlock()
+	if hijacked {
+		return 0, http.ErrHijacked
+	}
+	return b.ReadCloser.Read(p)
+}
+
+// Close closes the body. Once the stream was hijacked, this is a no-op.
+func (b *hijackableBody) Close() error {
+	b.mutex.Lock()
+	hijacked := b.hijacked
+	b.mutex.Unlock()
+	if hijacked {
+		return nil
+	}
+	return b.ReadCloser.Close()
+}
@@ -0,0 +1,14 @@
+package http3
+
+import (
+	quic "github.com/lucas-clemente/quic-go"
+	"github.com/lucas-clemente/quic-go/internal/utils"
+)
+
+// newLogger creates a logger that uses the Logger of the quic.Config, if set.
+func newLogger(quicConf *quic.Config, prefix string) utils.Logger {
+	if quicConf == nil || quicConf.Logger == nil {
+		return utils.DefaultLogger.WithPrefix(prefix)
+	}
+	return utils.NewStructuredLogger(quicConf.Logger).WithPrefix(prefix)
+}
@@ -0,0 +1,369 @@
+package http3
+
+import (
+	"crypto/tls"
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/lucas-clemente/quic-go"
+)
+
+// An ALPNHandler handles a QUIC session that negotiated an application protocol registered with MuxListener.HandleALPN.
+// The session is closed when the handler returns.
+type ALPNHandler func(quic.Session)
+
+// A MuxListener serves multiple applications on a single QUIC listener,
+// without the need for a TLS-terminating reverse proxy in front of them.
+// HTTP/3 connections are routed by the server name (SNI) that the client sent in its ClientHello:
+// Handle registers the handler for a server name, HandleDefault the handler for all other server names.
+// Connections using other application protocols are routed by the negotiated application protocol (ALPN),
+// see HandleALPN.
+//
+// The application protocols offered to a client are selected when its ClientHello is received,
+// using tls.Config.GetConfigForClient. HTTP/3 is only offered if there's a handler for the requested server name,
+// so the handshake fails with a no_application_protocol alert if the client neither requests a known server name,
+// nor supports any of the protocols registered with HandleALPN.
+type MuxListener struct {
+	// TLSConfig is used for all connections. NextProtos is set by the MuxListener.
+	// If TLSConfig.GetConfigForClient is set, it is called first, e.g. to select the certificate for the server name.
+	TLSConfig *tls.Config
+
+	// By providing a quic.Config, it is possible to set parameters of the QUIC connection.
+	// If nil, it uses reasonable default values.
+	// It must be set before serving.
+	QuicConfig *quic.Config
+
+	// MaxConcurrentSessions is the maximum number of sessions that every handler serves concurrently.
+	// Each handler has its own limit, so a busy handler doesn't affect the others.
+	// Sessions exceeding the limit are queued, see MaxQueuedSessions.
+	// If 0, the number of sessions is not limited.
+	// It must be set before serving.
+	MaxConcurrentSessions int
+
+	// MaxQueuedSessions is the maximum number of sessions that are queued for every handler,
+	// while the handler is serving MaxConcurrentSessions sessions.
+	// Queued sessions are served in the order they were accepted.
+	// Sessions exceeding the limit are closed right away (using H3_EXCESSIVE_LOAD for HTTP/3, and 0 otherwise).
+	// If 0, up to MaxConcurrentSessions sessions are queued. To disable queueing, set it to a negative value.
+	// It must be set before serving.
+	MaxQueuedSessions int
+
+	mutex        sync.Mutex
+	sniRoutes    map[string]*muxRoute
+	defaultRoute *muxRoute
+	alpnRoutes   map[string]*muxRoute
+	alpnProtos   []string // in the order the ALPN handlers were registered
+	listener     quic.Listener
+	closed       bool
+	// maxSessions and maxQueuedSessions are set from MaxConcurrentSessions and MaxQueuedSessions when serving starts
+	maxSessions       int
+	maxQueuedSessions int
+	// quicConfig is set from QuicConfig when serving starts
+	quicConfig *quic.Config
+}
+
+var errMuxListenerClosed = errors.New("http3: MuxListener is already closed")
+
+// A muxRoute serves the sessions routed to a single handler.
+type muxRoute struct {
+	serve func(quic.Session)
+	// server is the server used for HTTP/3 sessions. It is nil for routes registered with HandleALPN.
+	server *Server
+	// rejectCode is the error code used to close sessions that exceed the concurrency limit
+	rejectCode quic.ErrorCode
+
+	mutex  sync.Mutex
+	active int            // the number of sessions being served
+	queue  []quic.Session // sessions waiting to be served
+	closed bool
+}
+
+func newMuxRoute(serve func(quic.Session), server *Server, rejectCode quic.ErrorCode) *muxRoute {
+	return &muxRoute{serve: serve, server: server, rejectCode: rejectCode}
+}
+
+// handleSession serves the session in a new go routine, or queues it if the route is already serving maxSessions sessions.
+// It returns false if the queue is full, or if the route was closed.
+func (r *muxRoute) handleSession(sess quic.Session, maxSessions, maxQueued int) bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.closed {
+		return false
+	}
+	if maxSessions == 0 || r.active < maxSessions {
+		r.active++
+		go r.run(sess)
+		return true
+	}
+	if len(r.queue) >= maxQueued {
+		return false
+	}
+	r.queue = append(r.queue, sess)
+	return true
+}
+
+// run serves the session, followed by the sessions queued in the meantime.
+func (r *muxRoute) run(sess quic.Session) {
+	for {
+		r.serve(sess)
+
+		r.mutex.Lock()
+		if r.closed || len(r.queue) == 0 {
+			r.active--
+			r.mutex.Unlock()
+			return
+		}
+		sess = r.queue[0]
+		r.queue[0] = nil
+		r.queue = r.queue[1:]
+		r.mutex.Unlock()
+	}
+}
+
+// close closes the queued sessions.
+// For HTTP/3, a GOAWAY frame is sent on the sessions being served.
+func (r *muxRoute) close() {
+	r.mutex.Lock()
+	r.closed = true
+	queue := r.queue
+	r.queue = nil
+	r.mutex.Unlock()
+
+	for _, sess := range queue {
+		sess.CloseWithError(0, errors.New("MuxListener closed"))
+	}
+	if r.server != nil {
+		r.server.goAway()
+	}
+}
+
+// Handle registers the handler for HTTP/3 connections to the given server name.
+// Server names are matched case-insensitively.
+// It returns an error if the MuxListener was already closed.
+func (m *MuxListener) Handle(sni string, handler http.Handler) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if m.closed {
+		return errMuxListenerClosed
+	}
+	if m.sniRoutes == nil {
+		m.sniRoutes = make(map[string]*muxRoute)
+	}
+	m.sniRoutes[strings.ToLower(sni)] = m.newHTTPRoute(handler)
+	return nil
+}
+
+// HandleDefault registers the handler for HTTP/3 connections to server names that don't have a handler,
+// as well as for connections that don't use SNI.
+// It returns an error if the MuxListener was already closed.
+func (m *MuxListener) HandleDefault(handler http.Handler) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if m.closed {
+		return errMuxListenerClosed
+	}
+	m.defaultRoute = m.newHTTPRoute(handler)
+	return nil
+}
+
+// HandleALPN registers the handler for connections that negotiate the given application protocol.
+// These protocols are offered to all clients, regardless of the requested server name,
+// in the order they were registered (but after HTTP/3).
+// If alpn is the ALPN token of HTTP/3, the handler takes precedence over the HTTP handlers.
+// It returns an error if the MuxListener was already closed.
+func (m *MuxListener) HandleALPN(alpn string, handler ALPNHandler) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if m.closed {
+		return errMuxListenerClosed
+	}
+	if m.alpnRoutes == nil {
+		m.alpnRoutes = make(map[string]*muxRoute)
+	}
+	if _, ok := m.alpnRoutes[alpn]; !ok {
+		m.alpnProtos = append(m.alpnProtos, alpn)
+	}
+	serve := func(sess quic.Session) {
+		handler(sess)
+		sess.Close()
+	}
+	m.alpnRoutes[alpn] = newMuxRoute(serve, nil, 0)
+	return nil
+}
+
+// newHTTPRoute creates a route that serves HTTP/3 requests using the handler.
+// The server uses the quic.Config that the MuxListener is serving with.
+// Since handlers can be registered before serving starts, it is only read when the first session is served.
+func (m *MuxListener) newHTTPRoute(handler http.Handler) *muxRoute {
+	s := &Server{Server: &http.Server{Handler: handler}}
+	var once sync.Once
+	serve := func(sess quic.Session) {
+		once.Do(func() {
+			m.mutex.Lock()
+			s.QuicConfig = m.quicConfig
+			m.mutex.Unlock()
+			s.logger = newLogger(s.QuicConfig, "server")
+		})
+		s.handleConn(sess)
+	}
+	return newMuxRoute(serve, s, quic.ErrorCode(errorExcessiveLoad))
+}
+
+// httpRoute returns the route for HTTP/3 connections to the server name, or nil if there's no handler.
+// It must be called with the mutex held.
+func (m *MuxListener) httpRoute(sni string) *muxRoute {
+	if r, ok := m.sniRoutes[strings.ToLower(sni)]; ok {
+		return r
+	}
+	return m.defaultRoute
+}
+
+// nextProtos returns the application protocols offered to a client that requested the server name.
+func (m *MuxListener) nextProtos(sni string) []string {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	protos := make([]string, 0, len(m.alpnProtos)+1)
+	if _, ok := m.alpnRoutes[nextProtoH3]; !ok && m.httpRoute(sni) != nil {
+		protos = append(protos, nextProtoH3)
+	}
+	return append(protos, m.alpnProtos...)
+}
+
+// route returns the route for a session, or nil if there's no handler for it.
+// It must be called with the mutex held.
+func (m *MuxListener) route(state tls.ConnectionState) *muxRoute {
+	if r, ok := m.alpnRoutes[state.NegotiatedProtocol]; ok {
+		return r
+	}
+	if state.NegotiatedProtocol == nextProtoH3 {
+		return m.httpRoute(state.ServerName)
+	}
+	return nil
+}
+
+// ListenAndServe listens on the UDP network address addr, and serves incoming connections using the registered handlers.
+func (m *MuxListener) ListenAndServe(addr string) error {
+	return m.serveImpl(addr, nil)
+}
+
+// Serve serves incoming connections on an existing UDP connection, using the registered handlers.
+func (m *MuxListener) Serve(conn net.PacketConn) error {
+	return m.serveImpl("", conn)
+}
+
+func (m *MuxListener) serveImpl(addr string, conn net.PacketConn) error {
+	m.mutex.Lock()
+	if m.closed {
+		m.mutex.Unlock()
+		return errMuxListenerClosed
+	}
+	if m.listener != nil {
+		m.mutex.Unlock()
+		return errors.New("http3: MuxListener is already serving")
+	}
+	if m.TLSConfig == nil {
+		m.mutex.Unlock()
+		return errors.New("http3: MuxListener without tls.Config")
+	}
+
+	m.setSessionLimits()
+	m.quicConfig = m.QuicConfig
+	tlsConf := m.TLSConfig.Clone()
+	tlsConf.NextProtos = nil
+	tlsConf.GetConfigForClient = m.getConfigForClient
+	var ln quic.Listener
+	var err error
+	if conn == nil {
+		ln, err = quicListenAddr(addr, tlsConf, m.quicConfig)
+	} else {
+		ln, err = quicListen(conn, tlsConf, m.quicConfig)
+	}
+	if err != nil {
+		m.mutex.Unlock()
+		return err
+	}
+	m.listener = ln
+	m.mutex.Unlock()
+
+	for {
+		sess, err := ln.Accept()
+		if err != nil {
+			return err
+		}
+		m.handleSession(sess)
+	}
+}
+
+// getConfigForClient selects the application protocols offered to the client, based on the server name it requested.
+func (m *MuxListener) getConfigForClient(ch *tls.ClientHelloInfo) (*tls.Config, error) {
+	conf := m.TLSConfig
+	if conf.GetConfigForClient != nil {
+		c, err := conf.GetConfigForClient(ch)
+		if err != nil {
+			return nil, err
+		}
+		if c != nil {
+			conf = c
+		}
+	}
+	conf = conf.Clone()
+	conf.GetConfigForClient = nil
+	conf.NextProtos = m.nextProtos(ch.ServerName)
+	return conf, nil
+}
+
+// setSessionLimits reads the limits for the number of sessions served by every handler.
+// It must be called with the mutex held.
+func (m *MuxListener) setSessionLimits() {
+	m.maxSessions = m.MaxConcurrentSessions
+	switch {
+	case m.MaxQueuedSessions > 0:
+		m.maxQueuedSessions = m.MaxQueuedSessions
+	case m.MaxQueuedSessions == 0:
+		m.maxQueuedSessions = m.MaxConcurrentSessions
+	default:
+		m.maxQueuedSessions = 0
+	}
+}
+
+func (m *MuxListener) handleSession(sess quic.Session) {
+	m.mutex.Lock()
+	route := m.route(sess.ConnectionState())
+	maxSessions, maxQueued := m.maxSessions, m.maxQueuedSessions
+	m.mutex.Unlock()
+	// Only protocols that have a handler are offered in the handshake, and handlers can't be removed.
+	if route == nil {
+		sess.CloseWithError(0, errors.New("no handler"))
+		return
+	}
+	if !route.handleSession(sess, maxSessions, maxQueued) {
+		sess.CloseWithError(route.rejectCode, errors.New("too many sessions"))
+	}
+}
+
+// Close closes the listener, and shuts down the handlers.
+// HTTP/3 sessions that are being served are sent a GOAWAY frame:
+// requests received before are served, later requests are rejected.
+// Queued sessions are closed.
+// Sessions served by the handlers registered with HandleALPN are not closed, the handlers are responsible for closing them.
+func (m *MuxListener) Close() error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.closed = true
+	for _, r := range m.sniRoutes {
+		r.close()
+	}
+	if m.defaultRoute != nil {
+		m.defaultRoute.close()
+	}
+	for _, r := range m.alpnRoutes {
+		r.close()
+	}
+	if m.listener == nil {
+		return nil
+	}
+	return m.listener.Close()
+}
@@ -0,0 +1,326 @@
+package http3
+
+import (
+	"crypto/tls"
+	"errors"
+	"net/http"
+
+	"github.com/golang/mock/gomock"
+	"github.com/lucas-clemente/quic-go"
+	mockquic "github.com/lucas-clemente/quic-go/internal/mocks/quic"
+	"github.com/lucas-clemente/quic-go/internal/testdata"
+	"github.com/lucas-clemente/quic-go/internal/utils"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("MuxListener", func() {
+	var (
+		m                  *MuxListener
+		origQuicListenAddr = quicListenAddr
+	)
+
+	BeforeEach(func() {
+		m = &MuxListener{TLSConfig: testdata.GetTLSConfig()}
+		origQuicListenAddr = quicListenAddr
+	})
+
+	AfterEach(func() {
+		quicListenAddr = origQuicListenAddr
+	})
+
+	Context("selecting the application protocols", func() {
+		// getTLSConfig returns the tls.Config that the listener is started with
+		getTLSConfig := func() *tls.Config {
+			var tlsConf *tls.Config
+			quicListenAddr = func(_ string, conf *tls.Config, _ *quic.Config) (quic.Listener, error) {
+				tlsConf = conf
+				return nil, errors.New("listen err")
+			}
+			Expect(m.ListenAndServe("localhost:0")).To(MatchError("listen err"))
+			return tlsConf
+		}
+
+		nextProtos := func(tlsConf *tls.Config, sni string) []string {
+			conf, err := tlsConf.GetConfigForClient(&tls.ClientHelloInfo{ServerName: sni})
+			Expect(err).ToNot(HaveOccurred())
+			return conf.NextProtos
+		}
+
+		It("only offers HTTP/3 for server names that have a handler", func() {
+			m.Handle("foo.example.com", http.NotFoundHandler())
+			m.HandleALPN("echo", func(quic.Session) {})
+			m.HandleALPN("chat", func(quic.Session) {})
+			tlsConf := getTLSConfig()
+			Expect(nextProtos(tlsConf, "foo.example.com")).To(Equal([]string{nextProtoH3, "echo", "chat"}))
+			Expect(nextProtos(tlsConf, "FOO.example.com")).To(Equal([]string{nextProtoH3, "echo", "chat"}))
+			Expect(nextProtos(tlsConf, "bar.example.com")).To(Equal([]string{"echo", "chat"}))
+			Expect(nextProtos(tlsConf, "")).To(Equal([]string{"echo", "chat"}))
+			// handlers can be registered while serving
+			m.HandleDefault(http.NotFoundHandler())
+			Expect(nextProtos(tlsConf, "bar.example.com")).To(Equal([]string{nextProtoH3, "echo", "chat"}))
+			Expect(nextProtos(tlsConf, "")).To(Equal([]string{nextProtoH3, "echo", "chat"}))
+		})
+
+		It("doesn't offer any protocol if there's no handler", func() {
+			m.Handle("foo.example.com", http.NotFoundHandler())
+			Expect(nextProtos(getTLSConfig(), "bar.example.com")).To(BeEmpty())
+		})
+
+		It("offers HTTP/3 once, if a handler is registered for its ALPN", func() {
+			m.Handle("foo.example.com", http.NotFoundHandler())
+			m.HandleALPN("echo", func(quic.Session) {})
+			m.HandleALPN(nextProtoH3, func(quic.Session) {})
+			m.HandleALPN("echo", func(quic.Session) {})
+			Expect(nextProtos(getTLSConfig(), "foo.example.com")).To(Equal([]string{"echo", nextProtoH3}))
+		})
+
+		It("uses the tls.Config returned by GetConfigForClient", func() {
+			m.HandleDefault(http.NotFoundHandler())
+			cert := testdata.GetTLSConfig().Certificates[0]
+			m.TLSConfig = &tls.Config{
+				GetConfigForClient: func(ch *tls.ClientHelloInfo) (*tls.Config, error) {
+					if ch.ServerName == "foo.example.com" {
+						return &tls.Config{Certificates: []tls.Certificate{cert}}, nil
+					}
+					return nil, nil
+				},
+				NextProtos: []string{"foobar"},
+			}
+			tlsConf := getTLSConfig()
+			Expect(tlsConf.NextProtos).To(BeEmpty())
+			conf, err := tlsConf.GetConfigForClient(&tls.ClientHelloInfo{ServerName: "foo.example.com"})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(conf.Certificates).To(Equal([]tls.Certificate{cert}))
+			Expect(conf.NextProtos).To(Equal([]string{nextProtoH3}))
+			Expect(conf.GetConfigForClient).To(BeNil())
+			// if GetConfigForClient returns nil, the TLSConfig is used
+			conf, err = tlsConf.GetConfigForClient(&tls.ClientHelloInfo{ServerName: "bar.example.com"})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(conf.Certificates).To(BeEmpty())
+			Expect(conf.NextProtos).To(Equal([]string{nextProtoH3}))
+			// the tls.Config passed by the user is not modified
+			Expect(m.TLSConfig.NextProtos).To(Equal([]string{"foobar"}))
+		})
+
+		It("returns errors from GetConfigForClient", func() {
+			testErr := errors.New("unknown server name")
+			m.TLSConfig = &tls.Config{
+				GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) { return nil, testErr },
+			}
+			_, err := getTLSConfig().GetConfigForClient(&tls.ClientHelloInfo{})
+			Expect(err).To(MatchError(testErr))
+		})
+	})
+
+	Context("routing sessions", func() {
+		getSession := func(sni, alpn string) *mockquic.MockSession {
+			sess := mockquic.NewMockSession(mockCtrl)
+			sess.EXPECT().ConnectionState().Return(tls.ConnectionState{ServerName: sni, NegotiatedProtocol: alpn}).AnyTimes()
+			return sess
+		}
+
+		It("routes HTTP/3 sessions by the server name", func() {
+			m.Handle("foo.example.com", http.NotFoundHandler())
+			Expect(m.route(tls.ConnectionState{ServerName: "foo.example.com", NegotiatedProtocol: nextProtoH3})).To(Equal(m.sniRoutes["foo.example.com"]))
+			Expect(m.route(tls.ConnectionState{ServerName: "bar.example.com", NegotiatedProtocol: nextProtoH3})).To(BeNil())
+			m.HandleDefault(http.NotFoundHandler())
+			Expect(m.route(tls.ConnectionState{ServerName: "bar.example.com", NegotiatedProtocol: nextProtoH3})).To(Equal(m.defaultRoute))
+		})
+
+		It("routes sessions by the negotiated application protocol", func() {
+			handled := make(chan quic.Session, 1)
+			m.HandleALPN("echo", func(sess quic.Session) { handled <- sess })
+			sess := getSession("foo.example.com", "echo")
+			closed := make(chan struct{})
+			sess.EXPECT().Close().Do(func() { close(closed) })
+			m.handleSession(sess)
+			Eventually(handled).Should(Receive(Equal(sess)))
+			Eventually(closed).Should(BeClosed())
+		})
+
+		It("closes sessions that don't have a handler", func() {
+			sess := getSession("foo.example.com", "echo")
+			sess.EXPECT().CloseWithError(quic.ErrorCode(0), gomock.Any())
+			m.handleSession(sess)
+		})
+
+		It("limits the number of sessions served concurrently by each handler", func() {
+			m.MaxConcurrentSessions = 1
+			m.MaxQueuedSessions = -1
+			m.setSessionLimits()
+			unblock := make(chan struct{})
+			handled := make(chan quic.Session, 3)
+			handler := func(sess quic.Session) {
+				handled <- sess
+				<-unblock
+			}
+			m.HandleALPN("echo", handler)
+			m.HandleALPN("chat", handler)
+			sess1 := getSession("", "echo")
+			closed := make(chan struct{})
+			sess1.EXPECT().Close().Do(func() { close(closed) })
+			m.handleSession(sess1)
+			Eventually(handled).Should(Receive(Equal(sess1)))
+			// the echo handler is busy
+			sess2 := getSession("", "echo")
+			sess2.EXPECT().CloseWithError(quic.ErrorCode(0), gomock.Any())
+			m.handleSession(sess2)
+			// the chat handler is not
+			sess3 := getSession("", "chat")
+			sess3.EXPECT().Close()
+			m.handleSession(sess3)
+			Eventually(handled).Should(Receive(Equal(sess3)))
+			close(unblock)
+			Eventually(closed).Should(BeClosed())
+			// once the first session is done, the echo handler accepts a new session
+			Eventually(func() int {
+				r := m.alpnRoutes["echo"]
+				r.mutex.Lock()
+				defer r.mutex.Unlock()
+				return r.active
+			}).Should(BeZero())
+			sess4 := getSession("", "echo")
+			sess4.EXPECT().Close()
+			m.handleSession(sess4)
+			Eventually(handled).Should(Receive(Equal(sess4)))
+		})
+
+		It("queues sessions exceeding the limit", func() {
+			m.MaxConcurrentSessions = 1
+			m.MaxQueuedSessions = 2
+			m.setSessionLimits()
+			unblock := make(chan struct{}, 3)
+			handled := make(chan quic.Session, 3)
+			m.HandleALPN("echo", func(sess quic.Session) {
+				handled <- sess
+				<-unblock
+			})
+			var sessions []quic.Session
+			closed := make(chan struct{}, 3)
+			for i := 0; i < 3; i++ {
+				sess := getSession("", "echo")
+				sess.EXPECT().Close().Do(func() { closed <- struct{}{} })
+				m.handleSession(sess)
+				sessions = append(sessions, sess)
+			}
+			Eventually(handled).Should(Receive(Equal(sessions[0])))
+			// the queue is full
+			sess := getSession("", "echo")
+			sess.EXPECT().CloseWithError(quic.ErrorCode(0), gomock.Any())
+			m.handleSession(sess)
+			// queued sessions are served in order, one at a time
+			for i := 1; i < 3; i++ {
+				Consistently(handled).ShouldNot(Receive())
+				unblock <- struct{}{}
+				Eventually(handled).Should(Receive(Equal(sessions[i])))
+			}
+			unblock <- struct{}{}
+			for i := 0; i < 3; i++ {
+				Eventually(closed).Should(Receive())
+			}
+		})
+
+		It("queues up to MaxConcurrentSessions sessions by default", func() {
+			m.MaxConcurrentSessions = 5
+			m.setSessionLimits()
+			Expect(m.maxSessions).To(Equal(5))
+			Expect(m.maxQueuedSessions).To(Equal(5))
+			// changing the limits after serving started has no effect
+			m.MaxConcurrentSessions = 10
+			Expect(m.maxSessions).To(Equal(5))
+		})
+
+		It("closes HTTP/3 sessions exceeding the limit with H3_EXCESSIVE_LOAD", func() {
+			m.MaxConcurrentSessions = 1
+			m.MaxQueuedSessions = -1
+			m.setSessionLimits()
+			m.HandleDefault(http.NotFoundHandler())
+			m.defaultRoute.active = 1 // the handler is already serving a session
+			sess := getSession("foo.example.com", nextProtoH3)
+			sess.EXPECT().CloseWithError(quic.ErrorCode(errorExcessiveLoad), gomock.Any())
+			m.handleSession(sess)
+		})
+	})
+
+	Context("closing", func() {
+		It("closes queued sessions, and refuses new sessions", func() {
+			m.MaxConcurrentSessions = 1
+			m.setSessionLimits()
+			m.HandleALPN("echo", func(quic.Session) {})
+			m.alpnRoutes["echo"].active = 1 // the handler is already serving a session
+			sess := mockquic.NewMockSession(mockCtrl)
+			sess.EXPECT().ConnectionState().Return(tls.ConnectionState{NegotiatedProtocol: "echo"})
+			m.handleSession(sess)
+			sess.EXPECT().CloseWithError(quic.ErrorCode(0), gomock.Any())
+			Expect(m.Close()).To(Succeed())
+			sess2 := mockquic.NewMockSession(mockCtrl)
+			sess2.EXPECT().ConnectionState().Return(tls.ConnectionState{NegotiatedProtocol: "echo"})
+			sess2.EXPECT().CloseWithError(quic.ErrorCode(0), gomock.Any())
+			m.handleSession(sess2)
+		})
+
+		It("sends a GOAWAY frame on HTTP/3 sessions", func() {
+			m.Handle("foo.example.com", http.NotFoundHandler())
+			m.HandleDefault(http.NotFoundHandler())
+			servers := []*Server{m.sniRoutes["foo.example.com"].server, m.defaultRoute.server}
+			var sessions []*serverSession
+			for _, s := range servers {
+				sess := newServerSession(utils.DefaultLogger)
+				s.addSession(sess)
+				sessions = append(sessions, sess)
+			}
+			Expect(m.Close()).To(Succeed())
+			for i, s := range servers {
+				Expect(s.closed).To(BeTrue())
+				Expect(sessions[i].goingAway).To(BeTrue())
+			}
+		})
+
+		It("refuses to register handlers after it was closed", func() {
+			Expect(m.Close()).To(Succeed())
+			Expect(m.Handle("foo.example.com", http.NotFoundHandler())).To(MatchError("http3: MuxListener is already closed"))
+			Expect(m.HandleDefault(http.NotFoundHandler())).To(MatchError("http3: MuxListener is already closed"))
+			Expect(m.HandleALPN("echo", func(quic.Session) {})).To(MatchError("http3: MuxListener is already closed"))
+			Expect(m.sniRoutes).To(BeEmpty())
+			Expect(m.defaultRoute).To(BeNil())
+			Expect(m.alpnRoutes).To(BeEmpty())
+		})
+	})
+
+	It("serves HTTP/3 with the quic.Config it is serving with", func() {
+		Expect(m.HandleDefault(http.NotFoundHandler())).To(Succeed())
+		// the quic.Config is set after the handler was registered
+		conf := &quic.Config{MaxIncomingStreams: 1337}
+		m.QuicConfig = conf
+		quicListenAddr = func(_ string, _ *tls.Config, c *quic.Config) (quic.Listener, error) {
+			Expect(c).To(Equal(conf))
+			return nil, errors.New("listen err")
+		}
+		Expect(m.ListenAndServe("localhost:0")).To(MatchError("listen err"))
+
+		sess := mockquic.NewMockSession(mockCtrl)
+		sess.EXPECT().OpenUniStreamSync().Return(nil, errors.New("test done")).AnyTimes()
+		sess.EXPECT().CloseWithError(gomock.Any(), gomock.Any()).AnyTimes()
+		acceptedUni := make(chan struct{})
+		sess.EXPECT().AcceptUniStream().DoAndReturn(func() (quic.ReceiveStream, error) {
+			close(acceptedUni)
+			return nil, errors.New("test done")
+		})
+		sess.EXPECT().AcceptStream().Return(nil, errors.New("test done"))
+		m.defaultRoute.serve(sess)
+		Expect(m.defaultRoute.server.QuicConfig).To(Equal(conf))
+		Eventually(acceptedUni).Should(BeClosed())
+	})
+
+	It("errors when serving after it was closed", func() {
+		Expect(m.Close()).To(Succeed())
+		Expect(m.ListenAndServe("localhost:0")).To(MatchError("http3: MuxListener is already closed"))
+	})
+
+	It("errors when the tls.Config is missing", func() {
+		m.TLSConfig = nil
+		Expect(m.ListenAndServe("localhost:0")).To(MatchError("http3: MuxListener without tls.Config"))
+	})
+})
@@ -0,0 +1,90 @@
+package http3
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+)
+
+// A Priority is the priority of a request and its response,
+// using the urgency and incremental parameters of the Extensible Priority Scheme (RFC 9218).
+type Priority struct {
+	// Urgency ranges from 0 (the highest priority) to 7 (the lowest priority).
+	// The default urgency is 3.
+	Urgency uint8
+	// Incremental says if the response can be processed incrementally.
+	// Incremental responses with the same urgency share the bandwidth,
+	// non-incremental responses are sent one after the other.
+	Incremental bool
+}
+
+// String returns the value of the Priority header.
+func (p Priority) String() string {
+	s := "u=" + strconv.Itoa(int(p.Urgency))
+	if p.Incremental {
+		s += ", i"
+	}
+	return s
+}
+
+type priorityKey struct{}
+
+// WithPriority returns a copy of ctx that carries a priority.
+// On the client side, requests using this context are sent with this priority:
+// The priority is applied to the QUIC stream, and signaled to the server in the Priority header.
+// Urgency values larger than 7 are treated as 7.
+func WithPriority(ctx context.Context, urgency uint8, incremental bool) context.Context {
+	if urgency > protocol.MaxStreamUrgency {
+		urgency = protocol.MaxStreamUrgency
+	}
+	return context.WithValue(ctx, priorityKey{}, Priority{Urgency: urgency, Incremental: incremental})
+}
+
+// PriorityFromContext returns the priority carried by ctx.
+// On the server side, it is called with the context of a request passed to an http.Handler,
+// and returns the priority that the client signaled in the Priority header.
+func PriorityFromContext(ctx context.Context) (Priority, bool) {
+	prio, ok := ctx.Value(priorityKey{}).(Priority)
+	return prio, ok
+}
+
+// priorityFromHeader parses the Priority header.
+// Parameters that are missing or invalid take their default value, unknown parameters are ignored.
+// It returns false if the header is not present.
+func priorityFromHeader(header http.Header) (Priority, bool) {
+	values, ok := header[http.CanonicalHeaderKey("Priority")]
+	if !ok {
+		return Priority{}, false
+	}
+	prio := Priority{Urgency: protocol.DefaultStreamUrgency}
+	for _, v := range values {
+		for _, member := range strings.Split(v, ",") {
+			member = strings.TrimSpace(member)
+			// strip parameters of the dictionary member, e.g. "u=1;foo=bar"
+			if i := strings.IndexByte(member, ';'); i >= 0 {
+				member = member[:i]
+			}
+			key, value := member, ""
+			if i := strings.IndexByte(member, '='); i >= 0 {
+				key, value = member[:i], member[i+1:]
+			}
+			switch key {
+			case "u":
+				if u, err := strconv.ParseUint(value, 10, 8); err == nil && u <= protocol.MaxStreamUrgency {
+					prio.Urgency = uint8(u)
+				}
+			case "i":
+				switch value {
+				case "", "?1":
+					prio.Incremental = true
+				case "?0":
+					prio.Incremental = false
+				}
+			}
+		}
+	}
+	return prio, true
+}
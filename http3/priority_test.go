@@ -0,0 +1,64 @@
+package http3
+
+import (
+	"context"
+	"net/http"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Priority", func() {
+	It("formats the Priority header", func() {
+		Expect(Priority{Urgency: 1}.String()).To(Equal("u=1"))
+		Expect(Priority{Urgency: 5, Incremental: true}.String()).To(Equal("u=5, i"))
+	})
+
+	It("stores the priority in the context", func() {
+		_, ok := PriorityFromContext(context.Background())
+		Expect(ok).To(BeFalse())
+		prio, ok := PriorityFromContext(WithPriority(context.Background(), 2, true))
+		Expect(ok).To(BeTrue())
+		Expect(prio).To(Equal(Priority{Urgency: 2, Incremental: true}))
+	})
+
+	It("limits the urgency", func() {
+		prio, ok := PriorityFromContext(WithPriority(context.Background(), 100, false))
+		Expect(ok).To(BeTrue())
+		Expect(prio.Urgency).To(BeEquivalentTo(7))
+	})
+
+	Context("parsing the Priority header", func() {
+		parse := func(values ...string) Priority {
+			prio, ok := priorityFromHeader(http.Header{"Priority": values})
+			ExpectWithOffset(1, ok).To(BeTrue())
+			return prio
+		}
+
+		It("returns false if the header is missing", func() {
+			_, ok := priorityFromHeader(http.Header{})
+			Expect(ok).To(BeFalse())
+		})
+
+		It("parses the urgency and the incremental flag", func() {
+			Expect(parse("u=0, i")).To(Equal(Priority{Urgency: 0, Incremental: true}))
+			Expect(parse("i=?1,u=6")).To(Equal(Priority{Urgency: 6, Incremental: true}))
+			Expect(parse("u=1, i=?0")).To(Equal(Priority{Urgency: 1}))
+		})
+
+		It("uses the default values for missing parameters", func() {
+			Expect(parse("i")).To(Equal(Priority{Urgency: 3, Incremental: true}))
+			Expect(parse("")).To(Equal(Priority{Urgency: 3}))
+		})
+
+		It("ignores invalid values and unknown parameters", func() {
+			Expect(parse("u=8, foo=bar")).To(Equal(Priority{Urgency: 3}))
+			Expect(parse("u=abc, i=?2")).To(Equal(Priority{Urgency: 3}))
+			Expect(parse("u=2;foo=bar")).To(Equal(Priority{Urgency: 2}))
+		})
+
+		It("parses multiple header lines", func() {
+			Expect(parse("u=2", "i")).To(Equal(Priority{Urgency: 2, Incremental: true}))
+		})
+	})
+})
@@ -9,10 +9,11 @@ import (
 	"strings"
 
 	"github.com/marten-seemann/qpack"
+	"golang.org/x/net/http/httpguts"
 )
 
 func requestFromHeaders(headers []qpack.HeaderField) (*http.Request, error) {
-	var path, authority, method, contentLengthStr string
+	var path, authority, method, protocol, contentLengthStr string
 	httpHeaders := http.Header{}
 
 	for _, h := range headers {
@@ -23,6 +24,8 @@ func requestFromHeaders(headers []qpack.HeaderField) (*http.Request, error) {
 			method = h.Value
 		case ":authority":
 			authority = h.Value
+		case ":protocol":
+			protocol = h.Value
 		case "content-length":
 			contentLengthStr = h.Value
 		default:
@@ -37,13 +40,57 @@ func requestFromHeaders(headers []qpack.HeaderField) (*http.Request, error) {
 		httpHeaders.Set("Cookie", strings.Join(httpHeaders["Cookie"], "; "))
 	}
 
-	if len(path) == 0 || len(authority) == 0 || len(method) == 0 {
-		return nil, errors.New(":path, :authority and :method must not be empty")
+	// copied from net/http2/server.go
+	var trailer http.Header
+	for _, v := range httpHeaders["Trailer"] {
+		for _, key := range strings.Split(v, ",") {
+			key = http.CanonicalHeaderKey(strings.TrimSpace(key))
+			switch key {
+			case "Transfer-Encoding", "Trailer", "Content-Length", "":
+				// Bogus. (copy of http1 rules)
+				// Ignore.
+			default:
+				if trailer == nil {
+					trailer = make(http.Header)
+				}
+				trailer[key] = nil
+			}
+		}
 	}
+	delete(httpHeaders, "Trailer")
 
-	u, err := url.Parse(path)
-	if err != nil {
-		return nil, err
+	var u *url.URL
+	var requestURI string
+	var err error
+	if method == http.MethodConnect && len(protocol) > 0 {
+		// An extended CONNECT request (RFC 8441) carries the :protocol, and a :path.
+		// Like net/http, the protocol is exposed as the :protocol header.
+		if len(path) == 0 || len(authority) == 0 {
+			return nil, errors.New(":path and :authority must not be empty for extended CONNECT requests")
+		}
+		u, err = url.Parse(path)
+		if err != nil {
+			return nil, err
+		}
+		u.Host = authority
+		requestURI = path
+		httpHeaders.Set(":protocol", protocol)
+	} else if method == http.MethodConnect {
+		// A CONNECT request only carries the :method and the :authority.
+		if len(path) != 0 || len(authority) == 0 {
+			return nil, errors.New(":path must be empty and :authority must not be empty for CONNECT requests")
+		}
+		u = &url.URL{Host: authority}
+		requestURI = authority // mimic HTTP/1 server behavior
+	} else {
+		if len(path) == 0 || len(authority) == 0 || len(method) == 0 {
+			return nil, errors.New(":path, :authority and :method must not be empty")
+		}
+		u, err = url.Parse(path)
+		if err != nil {
+			return nil, err
+		}
+		requestURI = path
 	}
 
 	var contentLength int64
@@ -61,10 +108,11 @@ func requestFromHeaders(headers []qpack.HeaderField) (*http.Request, error) {
 		ProtoMajor:    3,
 		ProtoMinor:    0,
 		Header:        httpHeaders,
+		Trailer:       trailer,
 		Body:          nil,
 		ContentLength: contentLength,
 		Host:          authority,
-		RequestURI:    path,
+		RequestURI:    requestURI,
 		TLS:           &tls.ConnectionState{},
 	}, nil
 }
@@ -75,3 +123,8 @@ func hostnameFromRequest(req *http.Request) string {
 	}
 	return ""
 }
+
+// expectsContinue reports whether the request carries an Expect: 100-continue header.
+func expectsContinue(req *http.Request) bool {
+	return httpguts.HeaderValuesContainsToken(req.Header["Expect"], "100-continue")
+}
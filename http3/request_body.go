@@ -0,0 +1,36 @@
+package http3
+
+import (
+	"context"
+
+	quic "github.com/lucas-clemente/quic-go"
+)
+
+// requestStreamBody is the stream that the server reads a request body from.
+type requestStreamBody struct {
+	quic.Stream
+
+	// cancel cancels the request's context.
+	// It is called when the client resets the stream.
+	cancel context.CancelFunc
+
+	// onFirstRead is called before the body is read for the first time. It may be nil.
+	// It is used to send the 100 Continue response to clients that sent an Expect: 100-continue header.
+	onFirstRead func()
+}
+
+func newRequestStreamBody(str quic.Stream, cancel context.CancelFunc) *requestStreamBody {
+	return &requestStreamBody{Stream: str, cancel: cancel}
+}
+
+func (b *requestStreamBody) Read(p []byte) (int, error) {
+	if b.onFirstRead != nil {
+		b.onFirstRead()
+		b.onFirstRead = nil
+	}
+	n, err := b.Stream.Read(p)
+	if _, ok := err.(quic.StreamError); ok {
+		b.cancel()
+	}
+	return n, err
+}
@@ -0,0 +1,44 @@
+package http3
+
+import (
+	quic "github.com/lucas-clemente/quic-go"
+	"github.com/lucas-clemente/quic-go/internal/qerr"
+)
+
+// A RequestError is returned by the RoundTripper when a request failed because the QUIC session was lost,
+// e.g. due to an idle timeout or a network error, or because the server rejected the request, since the session is going away.
+// The RoundTripper already retries requests if that is safe. Requests are safe to retry if they weren't processed
+// by the server, or if they are idempotent.
+type RequestError struct {
+	Err error
+	// MayHaveBeenProcessed says if the server might have processed the request, at least partially.
+	// It is false if the request was rejected by the server, or if the session was lost before the request was sent.
+	MayHaveBeenProcessed bool
+
+	// requestSent is set if any part of the request was written to the stream.
+	// If not, the request body wasn't read yet.
+	requestSent bool
+}
+
+func (e *RequestError) Error() string {
+	return e.Err.Error()
+}
+
+// classifyRequestError wraps errors that were caused by losing the session, or by the server rejecting the request, in a RequestError.
+// Other errors are returned unchanged.
+func classifyRequestError(err error, requestSent bool) error {
+	if err == errGoingAway {
+		return &RequestError{Err: err, requestSent: requestSent}
+	}
+	switch e := err.(type) {
+	case quic.StreamError:
+		// The server didn't process requests that it rejected.
+		if e.ErrorCode() == quic.ErrorCode(errorRequestRejected) {
+			return &RequestError{Err: err, requestSent: requestSent}
+		}
+	case *qerr.QuicError:
+		// When the session is closed, all operations on its streams return the session's error.
+		return &RequestError{Err: err, MayHaveBeenProcessed: requestSent, requestSent: requestSent}
+	}
+	return err
+}
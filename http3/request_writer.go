@@ -2,10 +2,12 @@ package http3
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"io"
 	"net"
 	"net/http"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -44,8 +46,10 @@ func (w *requestWriter) WriteRequest(str quic.Stream, req *http.Request, gzip bo
 	if _, err := str.Write(headers); err != nil {
 		return err
 	}
-	// TODO: add support for trailers
 	if req.Body == nil {
+		if err := w.writeTrailers(str, req); err != nil {
+			return err
+		}
 		str.Close()
 		return nil
 	}
@@ -53,9 +57,18 @@ func (w *requestWriter) WriteRequest(str quic.Stream, req *http.Request, gzip bo
 	// send the request body asynchronously
 	go func() {
 		if err := w.sendRequestBody(req.Body, str); err != nil {
+			if err == errExpectationFailed || err == errUploadAborted {
+				w.logger.Debugf("Not sending the request body: %s", err)
+				return
+			}
 			w.logger.Errorf("Error writing request: %s", err)
 			return
 		}
+		// The values of the trailers may be set while the body is read.
+		if err := w.writeTrailers(str, req); err != nil {
+			w.logger.Errorf("Error writing trailers: %s", err)
+			return
+		}
 		str.Close()
 	}()
 
@@ -67,7 +80,11 @@ func (w *requestWriter) getHeaders(req *http.Request, gzip bool) ([]byte, error)
 	defer w.mutex.Unlock()
 	defer w.encoder.Close()
 
-	if err := w.encodeHeaders(req, gzip, "", actualContentLength(req)); err != nil {
+	trailers, err := commaSeparatedTrailers(req)
+	if err != nil {
+		return nil, err
+	}
+	if err := w.encodeHeaders(req, gzip, trailers, actualContentLength(req)); err != nil {
 		return nil, err
 	}
 
@@ -81,30 +98,110 @@ func (w *requestWriter) getHeaders(req *http.Request, gzip bool) ([]byte, error)
 	return buf.Bytes(), nil
 }
 
+// writeTrailers sends the trailers declared in req.Trailer in a HEADERS frame.
+func (w *requestWriter) writeTrailers(str quic.Stream, req *http.Request) error {
+	if len(req.Trailer) == 0 {
+		return nil
+	}
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	defer w.encoder.Close()
+
+	for k, vv := range req.Trailer {
+		for _, v := range vv {
+			if !httpguts.ValidHeaderFieldValue(v) {
+				return fmt.Errorf("invalid HTTP trailer value %q for trailer %q", v, k)
+			}
+			w.encoder.WriteField(qpack.HeaderField{Name: strings.ToLower(k), Value: v})
+		}
+	}
+	buf := &bytes.Buffer{}
+	(&headersFrame{Length: uint64(w.headerBuf.Len())}).Write(buf)
+	buf.Write(w.headerBuf.Bytes())
+	w.headerBuf.Reset()
+	_, err := str.Write(buf.Bytes())
+	return err
+}
+
 func (w *requestWriter) sendRequestBody(req io.ReadCloser, str quic.Stream) error {
+	// The body is sent as it is read, terminated by the stream FIN.
+	// Since writing to the stream blocks when the peer's flow control limit is reached,
+	// the body is not read faster than the peer can receive it.
 	b := make([]byte, 8*1024)
 	for {
-		n, err := req.Read(b)
-		if err == io.EOF {
-			break
-		}
-		if err != nil {
-			str.CancelWrite(quic.ErrorCode(errorRequestCanceled))
-			return err
+		n, rerr := req.Read(b)
+		if n > 0 {
+			buf := &bytes.Buffer{}
+			(&dataFrame{Length: uint64(n)}).Write(buf)
+			if _, err := str.Write(buf.Bytes()); err != nil {
+				return err
+			}
+			if _, err := str.Write(b[:n]); err != nil {
+				return err
+			}
 		}
-		buf := &bytes.Buffer{}
-		(&dataFrame{Length: uint64(n)}).Write(buf)
-		if _, err := str.Write(buf.Bytes()); err != nil {
-			return err
+		if rerr == io.EOF {
+			break
 		}
-		if _, err := str.Write(b[:n]); err != nil {
-			return err
+		if rerr != nil {
+			// If the upload was aborted, the stream was already reset.
+			if rerr != errUploadAborted {
+				str.CancelWrite(quic.ErrorCode(errorRequestCanceled))
+			}
+			return rerr
 		}
 	}
 	req.Close()
 	return nil
 }
 
+// errUploadAborted is returned when reading an uploadBody after the upload was aborted.
+var errUploadAborted = errors.New("http3: upload aborted, since the server responded before the request body was sent")
+
+// uploadBody wraps the body of a request while it is being sent.
+// If the server sends an error response before the body was sent completely,
+// the upload is aborted, instead of waiting for the rest of the body (which might never arrive).
+type uploadBody struct {
+	io.ReadCloser
+
+	mutex    sync.Mutex
+	finished bool // set once reading the body returned an error (including io.EOF)
+	aborted  bool
+}
+
+func newUploadBody(body io.ReadCloser) *uploadBody {
+	return &uploadBody{ReadCloser: body}
+}
+
+func (b *uploadBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if b.aborted {
+		return 0, errUploadAborted
+	}
+	if err != nil {
+		b.finished = true
+	}
+	return n, err
+}
+
+// abort aborts the upload, unless the body was already read completely (or reading it failed).
+// It closes the body, unblocking a pending Read call.
+// The caller is responsible for resetting the stream.
+// It returns false if the upload already finished (or was aborted before).
+func (b *uploadBody) abort() bool {
+	b.mutex.Lock()
+	if b.finished || b.aborted {
+		b.mutex.Unlock()
+		return false
+	}
+	b.aborted = true
+	b.mutex.Unlock()
+	b.ReadCloser.Close()
+	return true
+}
+
 // copied from net/transport.go
 
 func (w *requestWriter) encodeHeaders(req *http.Request, addGzipHeader bool, trailers string, contentLength int64) error {
@@ -117,8 +214,12 @@ func (w *requestWriter) encodeHeaders(req *http.Request, addGzipHeader bool, tra
 		return err
 	}
 
+	// An extended CONNECT request (RFC 8441) carries the :protocol, as well as the :path and the :scheme.
+	protocol := req.Header.Get(":protocol")
+	isExtendedConnect := req.Method == "CONNECT" && protocol != ""
+
 	var path string
-	if req.Method != "CONNECT" {
+	if req.Method != "CONNECT" || isExtendedConnect {
 		path = req.URL.RequestURI()
 		if !validPseudoPath(path) {
 			orig := path
@@ -137,6 +238,9 @@ func (w *requestWriter) encodeHeaders(req *http.Request, addGzipHeader bool, tra
 	// potentially pollute our hpack state. (We want to be able to
 	// continue to reuse the hpack encoder for future requests)
 	for k, vv := range req.Header {
+		if k == ":protocol" {
+			continue
+		}
 		if !httpguts.ValidHeaderFieldName(k) {
 			return fmt.Errorf("invalid HTTP header name %q", k)
 		}
@@ -155,19 +259,23 @@ func (w *requestWriter) encodeHeaders(req *http.Request, addGzipHeader bool, tra
 		// [RFC3986]).
 		f(":authority", host)
 		f(":method", req.Method)
-		if req.Method != "CONNECT" {
+		if req.Method != "CONNECT" || isExtendedConnect {
 			f(":path", path)
 			f(":scheme", req.URL.Scheme)
 		}
+		if isExtendedConnect {
+			f(":protocol", protocol)
+		}
 		if trailers != "" {
 			f("trailer", trailers)
 		}
 
 		var didUA bool
 		for k, vv := range req.Header {
-			if strings.EqualFold(k, "host") || strings.EqualFold(k, "content-length") {
+			if strings.EqualFold(k, "host") || strings.EqualFold(k, "content-length") || k == ":protocol" {
 				// Host is :authority, already sent.
 				// Content-Length is automatic, set below.
+				// :protocol is sent as a pseudo-header above.
 				continue
 			} else if strings.EqualFold(k, "connection") || strings.EqualFold(k, "proxy-connection") ||
 				strings.EqualFold(k, "transfer-encoding") || strings.EqualFold(k, "upgrade") ||
@@ -238,6 +346,27 @@ func (w *requestWriter) encodeHeaders(req *http.Request, addGzipHeader bool, tra
 	return nil
 }
 
+// copied from net/http2/transport.go
+
+// commaSeparatedTrailers returns the value of the Trailer header,
+// listing the trailers declared in req.Trailer.
+func commaSeparatedTrailers(req *http.Request) (string, error) {
+	keys := make([]string, 0, len(req.Trailer))
+	for k := range req.Trailer {
+		k = http.CanonicalHeaderKey(k)
+		switch k {
+		case "Transfer-Encoding", "Trailer", "Content-Length":
+			return "", fmt.Errorf("invalid Trailer key %q", k)
+		}
+		keys = append(keys, k)
+	}
+	if len(keys) > 0 {
+		sort.Strings(keys)
+		return strings.Join(keys, ","), nil
+	}
+	return "", nil
+}
+
 // authorityAddr returns a given authority (a host/IP, or host:port / ip:port)
 // and returns a host:port. The port 443 is added if needed.
 func authorityAddr(scheme string, authority string) (addr string) {
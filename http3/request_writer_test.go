@@ -3,8 +3,11 @@ package http3
 import (
 	"bytes"
 	"io"
+	"io/ioutil"
 	"net/http"
 	"strconv"
+	"testing/iotest"
+	"time"
 
 	"github.com/marten-seemann/qpack"
 
@@ -63,6 +66,21 @@ var _ = Describe("Request Writer", func() {
 		Expect(headerFields).ToNot(HaveKey("accept-encoding"))
 	})
 
+	It("writes an extended CONNECT request", func() {
+		req, err := http.NewRequest(http.MethodConnect, "https://quic.clemente.io/webtransport", nil)
+		Expect(err).ToNot(HaveOccurred())
+		req.Header.Set(":protocol", "webtransport")
+		headers, err := rw.getHeaders(req, false)
+		Expect(err).ToNot(HaveOccurred())
+		headerFields := decode(bytes.NewReader(headers))
+		Expect(headerFields).To(HaveKeyWithValue(":authority", "quic.clemente.io"))
+		Expect(headerFields).To(HaveKeyWithValue(":method", "CONNECT"))
+		Expect(headerFields).To(HaveKeyWithValue(":protocol", "webtransport"))
+		Expect(headerFields).To(HaveKeyWithValue(":path", "/webtransport"))
+		Expect(headerFields).To(HaveKeyWithValue(":scheme", "https"))
+		Expect(headerFields).To(HaveLen(6)) // the 5 pseudo-headers, and the user-agent
+	})
+
 	It("writes a POST request", func() {
 		closed := make(chan struct{})
 		str.EXPECT().Close().Do(func() { close(closed) })
@@ -84,6 +102,70 @@ var _ = Describe("Request Writer", func() {
 		Expect(frame.(*dataFrame).Length).To(BeEquivalentTo(6))
 	})
 
+	Context("streaming request bodies", func() {
+		// readBody reads all DATA frames from the stream
+		readBody := func(str io.Reader) []byte {
+			var body []byte
+			for {
+				frame, err := parseNextFrame(str)
+				if err == io.EOF {
+					return body
+				}
+				Expect(err).ToNot(HaveOccurred())
+				Expect(frame).To(BeAssignableToTypeOf(&dataFrame{}))
+				data := make([]byte, frame.(*dataFrame).Length)
+				_, err = io.ReadFull(str, data)
+				Expect(err).ToNot(HaveOccurred())
+				body = append(body, data...)
+			}
+		}
+
+		It("sends a body of unknown length as it is read, without a Content-Length", func() {
+			closed := make(chan struct{})
+			str.EXPECT().Close().Do(func() { close(closed) })
+			pr, pw := io.Pipe()
+			req, err := http.NewRequest("POST", "https://quic.clemente.io/upload.html", pr)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(rw.WriteRequest(str, req, false)).To(Succeed())
+			for i := 0; i < 3; i++ {
+				_, err := pw.Write([]byte("foobar"))
+				Expect(err).ToNot(HaveOccurred())
+			}
+			Consistently(closed).ShouldNot(BeClosed())
+			Expect(pw.Close()).To(Succeed())
+			Eventually(closed).Should(BeClosed())
+			Expect(decode(strBuf)).ToNot(HaveKey("content-length"))
+			Expect(readBody(strBuf)).To(Equal([]byte("foobarfoobarfoobar")))
+		})
+
+		It("sends data that is returned together with io.EOF", func() {
+			closed := make(chan struct{})
+			str.EXPECT().Close().Do(func() { close(closed) })
+			body := iotest.DataErrReader(bytes.NewReader([]byte("foobar")))
+			req, err := http.NewRequest("POST", "https://quic.clemente.io/upload.html", body)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(rw.WriteRequest(str, req, false)).To(Succeed())
+			Eventually(closed).Should(BeClosed())
+			decode(strBuf)
+			Expect(readBody(strBuf)).To(Equal([]byte("foobar")))
+		})
+
+		It("doesn't reset the stream when the upload was aborted", func() {
+			pr, pw := io.Pipe()
+			upload := newUploadBody(pr)
+			req, err := http.NewRequest("POST", "https://quic.clemente.io/upload.html", upload)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(rw.WriteRequest(str, req, false)).To(Succeed())
+			Expect(upload.abort()).To(BeTrue())
+			// the pipe was closed
+			_, err = pw.Write([]byte("foobar"))
+			Expect(err).To(MatchError(io.ErrClosedPipe))
+			Expect(upload.abort()).To(BeFalse())
+			// make sure that the stream is neither closed nor reset
+			time.Sleep(50 * time.Millisecond)
+		})
+	})
+
 	It("sends cookies", func() {
 		str.EXPECT().Close()
 		req, err := http.NewRequest("GET", "https://quic.clemente.io/", nil)
@@ -111,4 +193,63 @@ var _ = Describe("Request Writer", func() {
 		headerFields := decode(strBuf)
 		Expect(headerFields).To(HaveKeyWithValue("accept-encoding", "gzip"))
 	})
+
+	Context("trailers", func() {
+		It("sends trailers after a chunked body", func() {
+			closed := make(chan struct{})
+			str.EXPECT().Close().Do(func() { close(closed) })
+			pr, pw := io.Pipe()
+			req, err := http.NewRequest("POST", "https://quic.clemente.io/upload", ioutil.NopCloser(pr))
+			Expect(err).ToNot(HaveOccurred())
+			req.Trailer = http.Header{"Grpc-Status": nil, "Foo": nil}
+			Expect(rw.WriteRequest(str, req, false)).To(Succeed())
+			go func() {
+				defer GinkgoRecover()
+				pw.Write([]byte("foo"))
+				pw.Write([]byte("bar"))
+				// trailers are set while the body is being sent
+				req.Trailer.Set("Grpc-Status", "0")
+				req.Trailer.Set("Foo", "bar")
+				pw.Close()
+			}()
+			Eventually(closed).Should(BeClosed())
+			headerFields := decode(strBuf)
+			Expect(headerFields).To(HaveKeyWithValue("trailer", "Foo,Grpc-Status"))
+			Expect(headerFields).ToNot(HaveKey("content-length"))
+			// every Write on the pipe results in a separate DATA frame
+			for _, expected := range []string{"foo", "bar"} {
+				f, err := parseNextFrame(strBuf)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(f).To(Equal(&dataFrame{Length: uint64(len(expected))}))
+				data := make([]byte, len(expected))
+				_, err = io.ReadFull(strBuf, data)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(string(data)).To(Equal(expected))
+			}
+			Expect(decode(strBuf)).To(Equal(map[string]string{
+				"grpc-status": "0",
+				"foo":         "bar",
+			}))
+			Expect(strBuf.Len()).To(BeZero())
+		})
+
+		It("sends empty trailers for a request without a body", func() {
+			str.EXPECT().Close()
+			req, err := http.NewRequest("GET", "https://quic.clemente.io/", nil)
+			Expect(err).ToNot(HaveOccurred())
+			req.Trailer = http.Header{"Foo": nil}
+			Expect(rw.WriteRequest(str, req, false)).To(Succeed())
+			Expect(decode(strBuf)).To(HaveKeyWithValue("trailer", "Foo"))
+			Expect(decode(strBuf)).To(BeEmpty())
+			Expect(strBuf.Len()).To(BeZero())
+		})
+
+		It("refuses to send invalid trailers", func() {
+			req, err := http.NewRequest("GET", "https://quic.clemente.io/", nil)
+			Expect(err).ToNot(HaveOccurred())
+			req.Trailer = http.Header{"Content-Length": nil}
+			Expect(rw.WriteRequest(str, req, false)).To(MatchError(`invalid Trailer key "Content-Length"`))
+			Expect(strBuf.Len()).To(BeZero())
+		})
+	})
 })
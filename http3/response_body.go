@@ -1,18 +1,60 @@
 package http3
 
 import (
+	"context"
 	"io"
+	"sync"
 
 	quic "github.com/lucas-clemente/quic-go"
 )
 
 type responseBody struct {
 	quic.Stream
+
+	// ctx is the request's context. It may be nil.
+	// Once it is canceled, Read returns its error.
+	ctx context.Context
+
+	doneOnce sync.Once
+	onDone   func() // called when the body was read until an error occurred, or when it is closed, may be nil
+
+	closeOnce sync.Once
+	onClose   func() // called when the body is closed for the first time, may be nil
 }
 
 var _ io.ReadCloser = &responseBody{}
 
+func newResponseStreamBody(str quic.Stream, onClose func()) *responseBody {
+	return &responseBody{Stream: str, onClose: onClose}
+}
+
+func (rb *responseBody) Read(p []byte) (int, error) {
+	n, err := rb.Stream.Read(p)
+	if err != nil {
+		rb.done()
+		// If the request was canceled, the stream was canceled as well.
+		if err != io.EOF && rb.ctx != nil && rb.ctx.Err() != nil {
+			err = rb.ctx.Err()
+		}
+	}
+	return n, err
+}
+
 func (rb *responseBody) Close() error {
+	rb.done()
 	rb.Stream.CancelRead(0)
+	rb.closeOnce.Do(func() {
+		if rb.onClose != nil {
+			rb.onClose()
+		}
+	})
 	return nil
 }
+
+func (rb *responseBody) done() {
+	rb.doneOnce.Do(func() {
+		if rb.onDone != nil {
+			rb.onDone()
+		}
+	})
+}
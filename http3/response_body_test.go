@@ -1,6 +1,10 @@
 package http3
 
 import (
+	"context"
+	"errors"
+	"io"
+
 	"github.com/golang/mock/gomock"
 	mockquic "github.com/lucas-clemente/quic-go/internal/mocks/quic"
 
@@ -16,11 +20,49 @@ var _ = Describe("Response Body", func() {
 
 	BeforeEach(func() {
 		stream = mockquic.NewMockStream(mockCtrl)
-		body = &responseBody{stream}
+		body = newResponseStreamBody(stream, nil)
 	})
 
 	It("calls CancelRead when closing", func() {
 		stream.EXPECT().CancelRead(gomock.Any())
 		Expect(body.Close()).To(Succeed())
 	})
+
+	It("calls the close callback once", func() {
+		var closed int
+		body = newResponseStreamBody(stream, func() { closed++ })
+		stream.EXPECT().CancelRead(gomock.Any()).Times(2)
+		Expect(body.Close()).To(Succeed())
+		Expect(body.Close()).To(Succeed())
+		Expect(closed).To(Equal(1))
+	})
+
+	It("calls the done callback once when reading fails", func() {
+		var done int
+		body.onDone = func() { done++ }
+		stream.EXPECT().Read(gomock.Any()).Return(0, io.EOF)
+		_, err := body.Read([]byte{0})
+		Expect(err).To(MatchError(io.EOF))
+		Expect(done).To(Equal(1))
+		stream.EXPECT().CancelRead(gomock.Any())
+		Expect(body.Close()).To(Succeed())
+		Expect(done).To(Equal(1))
+	})
+
+	It("calls the done callback when closing", func() {
+		var done int
+		body.onDone = func() { done++ }
+		stream.EXPECT().CancelRead(gomock.Any())
+		Expect(body.Close()).To(Succeed())
+		Expect(done).To(Equal(1))
+	})
+
+	It("returns the context's error if the request was canceled", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		body.ctx = ctx
+		stream.EXPECT().Read(gomock.Any()).Return(0, errors.New("read canceled"))
+		cancel()
+		_, err := body.Read([]byte{0})
+		Expect(err).To(MatchError(context.Canceled))
+	})
 })
@@ -1,22 +1,39 @@
 package http3
 
 import (
+	"bufio"
 	"bytes"
+	"context"
 	"io"
 	"net/http"
+	"sort"
 	"strconv"
 	"strings"
 
+	quic "github.com/lucas-clemente/quic-go"
 	"github.com/lucas-clemente/quic-go/internal/utils"
 	"github.com/marten-seemann/qpack"
+	"golang.org/x/net/http/httpguts"
 )
 
 type responseWriter struct {
-	stream io.Writer
+	stream         io.Writer
+	bufferedStream *bufio.Writer // HEADERS and DATA frames are buffered until Flush is called, or the buffer is full
 
 	header        http.Header
 	status        int // status code passed to WriteHeader
 	headerWritten bool
+	trailers      []string // the trailers declared in the Trailer header
+
+	// pusher is used to push responses. It is nil if server push is not possible.
+	pusher func(target string, opts *http.PushOptions) error
+
+	// requestStream is the stream returned by HijackStream. It is nil if the stream can't be hijacked.
+	requestStream quic.Stream
+	hijacked      bool
+
+	// ctx is the context of the request. Once it is canceled, writes fail. It may be nil.
+	ctx context.Context
 
 	logger utils.Logger
 }
@@ -25,9 +42,10 @@ var _ http.ResponseWriter = &responseWriter{}
 
 func newResponseWriter(stream io.Writer, logger utils.Logger) *responseWriter {
 	return &responseWriter{
-		header: http.Header{},
-		stream: stream,
-		logger: logger,
+		header:         http.Header{},
+		stream:         stream,
+		bufferedStream: bufio.NewWriter(stream),
+		logger:         logger,
 	}
 }
 
@@ -36,9 +54,19 @@ func (w *responseWriter) Header() http.Header {
 }
 
 func (w *responseWriter) WriteHeader(status int) {
+	if w.hijacked {
+		w.logger.Errorf("WriteHeader called on a hijacked stream")
+		return
+	}
 	if w.headerWritten {
 		return
 	}
+	// Informational responses are sent right away, and are followed by the final response.
+	// 101 Switching Protocols is not used in HTTP/3, it is treated like a final response.
+	if status >= 100 && status <= 199 && status != http.StatusSwitchingProtocols {
+		w.writeInformationalHeader(status, w.header)
+		return
+	}
 	w.headerWritten = true
 	w.status = status
 
@@ -46,7 +74,16 @@ func (w *responseWriter) WriteHeader(status int) {
 	enc := qpack.NewEncoder(&headers)
 	enc.WriteField(qpack.HeaderField{Name: ":status", Value: strconv.Itoa(status)})
 
+	for _, v := range w.header["Trailer"] {
+		for _, k := range strings.Split(v, ",") {
+			w.declareTrailer(strings.TrimSpace(k))
+		}
+	}
+
 	for k, v := range w.header {
+		if strings.HasPrefix(k, http.TrailerPrefix) {
+			continue
+		}
 		for index := range v {
 			enc.WriteField(qpack.HeaderField{Name: strings.ToLower(k), Value: v[index]})
 		}
@@ -55,15 +92,51 @@ func (w *responseWriter) WriteHeader(status int) {
 	buf := &bytes.Buffer{}
 	(&headersFrame{Length: uint64(headers.Len())}).Write(buf)
 	w.logger.Infof("Responding with %d", status)
-	if _, err := w.stream.Write(buf.Bytes()); err != nil {
+	if _, err := w.bufferedStream.Write(buf.Bytes()); err != nil {
 		w.logger.Errorf("could not write headers frame: %s", err.Error())
 	}
-	if _, err := w.stream.Write(headers.Bytes()); err != nil {
+	if _, err := w.bufferedStream.Write(headers.Bytes()); err != nil {
 		w.logger.Errorf("could not write header frame payload: %s", err.Error())
 	}
 }
 
+// writeInformationalHeader sends an informational (1xx) response, e.g. 100 Continue or 103 Early Hints.
+// Informational responses are sent immediately. Besides the status code, they contain the fields of header, which may be nil.
+func (w *responseWriter) writeInformationalHeader(status int, header http.Header) {
+	var headers bytes.Buffer
+	enc := qpack.NewEncoder(&headers)
+	enc.WriteField(qpack.HeaderField{Name: ":status", Value: strconv.Itoa(status)})
+	for k, v := range header {
+		if k == "Trailer" || strings.HasPrefix(k, http.TrailerPrefix) {
+			continue
+		}
+		for index := range v {
+			enc.WriteField(qpack.HeaderField{Name: strings.ToLower(k), Value: v[index]})
+		}
+	}
+	buf := &bytes.Buffer{}
+	(&headersFrame{Length: uint64(headers.Len())}).Write(buf)
+	buf.Write(headers.Bytes())
+	w.logger.Debugf("Sending informational response %d", status)
+	if _, err := w.bufferedStream.Write(buf.Bytes()); err != nil {
+		w.logger.Errorf("could not write informational headers frame: %s", err.Error())
+		return
+	}
+	if err := w.bufferedStream.Flush(); err != nil {
+		w.logger.Errorf("could not flush informational response: %s", err.Error())
+	}
+}
+
 func (w *responseWriter) Write(p []byte) (int, error) {
+	if w.hijacked {
+		return 0, http.ErrHijacked
+	}
+	// Don't buffer any more data if the client canceled the request.
+	if w.ctx != nil {
+		if err := w.ctx.Err(); err != nil {
+			return 0, err
+		}
+	}
 	if !w.headerWritten {
 		w.WriteHeader(200)
 	}
@@ -73,13 +146,105 @@ func (w *responseWriter) Write(p []byte) (int, error) {
 	df := &dataFrame{Length: uint64(len(p))}
 	buf := &bytes.Buffer{}
 	df.Write(buf)
-	if _, err := w.stream.Write(buf.Bytes()); err != nil {
+	if _, err := w.bufferedStream.Write(buf.Bytes()); err != nil {
 		return 0, err
 	}
-	return w.stream.Write(p)
+	return w.bufferedStream.Write(p)
+}
+
+// declareTrailer is called for each trailer declared in the Trailer header,
+// and for each undeclared trailer set using the http.TrailerPrefix.
+func (w *responseWriter) declareTrailer(k string) {
+	k = http.CanonicalHeaderKey(k)
+	if !httpguts.ValidTrailerHeader(k) {
+		w.logger.Debugf("Ignoring invalid trailer %q", k)
+		return
+	}
+	for _, t := range w.trailers {
+		if t == k {
+			return
+		}
+	}
+	w.trailers = append(w.trailers, k)
+}
+
+// writeTrailers writes the trailers after the handler returned.
+// The values of the trailers are taken from the header map.
+// Like net/http, header keys starting with http.TrailerPrefix are sent as trailers,
+// even if they were not declared in the Trailer header.
+func (w *responseWriter) writeTrailers() {
+	for k, vv := range w.header {
+		if !strings.HasPrefix(k, http.TrailerPrefix) {
+			continue
+		}
+		trailerKey := strings.TrimPrefix(k, http.TrailerPrefix)
+		w.declareTrailer(trailerKey)
+		w.header[http.CanonicalHeaderKey(trailerKey)] = vv
+	}
+	if len(w.trailers) == 0 {
+		return
+	}
+	sort.Strings(w.trailers)
+
+	var headers bytes.Buffer
+	enc := qpack.NewEncoder(&headers)
+	for _, k := range w.trailers {
+		for _, v := range w.header[k] {
+			enc.WriteField(qpack.HeaderField{Name: strings.ToLower(k), Value: v})
+		}
+	}
+	buf := &bytes.Buffer{}
+	(&headersFrame{Length: uint64(headers.Len())}).Write(buf)
+	if _, err := w.bufferedStream.Write(buf.Bytes()); err != nil {
+		w.logger.Errorf("could not write trailers frame: %s", err.Error())
+	}
+	if _, err := w.bufferedStream.Write(headers.Bytes()); err != nil {
+		w.logger.Errorf("could not write trailers frame payload: %s", err.Error())
+	}
+}
+
+// Flush sends the buffered data to the client.
+// If the header wasn't written yet, it is written with status code 200.
+func (w *responseWriter) Flush() {
+	if w.hijacked {
+		return
+	}
+	if !w.headerWritten {
+		w.WriteHeader(200)
+	}
+	if err := w.bufferedStream.Flush(); err != nil {
+		w.logger.Errorf("could not flush to stream: %s", err.Error())
+	}
 }
 
-func (w *responseWriter) Flush() {}
+// Push initiates an HTTP/3 server push.
+// It returns http.ErrNotSupported if server push is disabled, or if the client doesn't allow pushes.
+func (w *responseWriter) Push(target string, opts *http.PushOptions) error {
+	if w.pusher == nil {
+		return http.ErrNotSupported
+	}
+	if w.hijacked {
+		return http.ErrHijacked
+	}
+	return w.pusher(target, opts)
+}
+
+// HijackStream takes over the request stream.
+// Data buffered in the response writer is flushed before the stream is returned.
+// It returns http.ErrNotSupported for pushed responses.
+func (w *responseWriter) HijackStream() (quic.Stream, error) {
+	if w.requestStream == nil {
+		return nil, http.ErrNotSupported
+	}
+	if w.hijacked {
+		return nil, http.ErrHijacked
+	}
+	if err := w.bufferedStream.Flush(); err != nil {
+		return nil, err
+	}
+	w.hijacked = true
+	return w.requestStream, nil
+}
 
 // This is a NOP. Use http.Request.Context
 func (w *responseWriter) CloseNotify() <-chan bool { return make(<-chan bool) }
@@ -87,6 +252,12 @@ func (w *responseWriter) CloseNotify() <-chan bool { return make(<-chan bool) }
 // test that we implement http.Flusher
 var _ http.Flusher = &responseWriter{}
 
+// test that we implement http.Pusher
+var _ http.Pusher = &responseWriter{}
+
+// test that we implement Hijacker
+var _ Hijacker = &responseWriter{}
+
 // copied from http2/http2.go
 // bodyAllowedForStatus reports whether a given response status code
 // permits a body. See RFC 2616, section 4.4.
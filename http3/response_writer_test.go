@@ -2,9 +2,11 @@ package http3
 
 import (
 	"bytes"
+	"context"
 	"io"
 	"net/http"
 
+	mockquic "github.com/lucas-clemente/quic-go/internal/mocks/quic"
 	"github.com/lucas-clemente/quic-go/internal/utils"
 	"github.com/marten-seemann/qpack"
 
@@ -55,14 +57,52 @@ var _ = Describe("Response Writer", func() {
 
 	It("writes status", func() {
 		rw.WriteHeader(http.StatusTeapot)
+		rw.Flush()
 		fields := decodeHeader(strBuf)
 		Expect(fields).To(HaveLen(1))
 		Expect(fields).To(HaveKeyWithValue(":status", []string{"418"}))
 	})
 
+	It("writes informational responses before the final response", func() {
+		rw.Header().Set("foo", "bar")
+		rw.writeInformationalHeader(http.StatusContinue, nil)
+		Expect(decodeHeader(strBuf)).To(Equal(map[string][]string{":status": {"100"}}))
+		rw.WriteHeader(http.StatusTeapot)
+		rw.Flush()
+		fields := decodeHeader(strBuf)
+		Expect(fields).To(HaveKeyWithValue(":status", []string{"418"}))
+		Expect(fields).To(HaveKeyWithValue("foo", []string{"bar"}))
+	})
+
+	It("writes 103 Early Hints followed by the final response", func() {
+		rw.Header().Add("Link", "</style.css>; rel=preload; as=style")
+		rw.WriteHeader(103)
+		// the informational response is sent right away
+		Expect(decodeHeader(strBuf)).To(Equal(map[string][]string{
+			":status": {"103"},
+			"link":    {"</style.css>; rel=preload; as=style"},
+		}))
+		rw.Header().Add("Link", "</script.js>; rel=preload; as=script")
+		rw.WriteHeader(103)
+		Expect(decodeHeader(strBuf)).To(HaveKeyWithValue("link", []string{"</style.css>; rel=preload; as=style", "</script.js>; rel=preload; as=script"}))
+		// the header can still be modified for the final response
+		rw.Header().Del("Link")
+		rw.Header().Set("Content-Type", "text/html")
+		rw.WriteHeader(http.StatusOK)
+		_, err := rw.Write([]byte("foobar"))
+		Expect(err).ToNot(HaveOccurred())
+		rw.Flush()
+		Expect(decodeHeader(strBuf)).To(Equal(map[string][]string{
+			":status":      {"200"},
+			"content-type": {"text/html"},
+		}))
+		Expect(getData(strBuf)).To(Equal([]byte("foobar")))
+	})
+
 	It("writes headers", func() {
 		rw.Header().Add("content-length", "42")
 		rw.WriteHeader(http.StatusTeapot)
+		rw.Flush()
 		fields := decodeHeader(strBuf)
 		Expect(fields).To(HaveKeyWithValue("content-length", []string{"42"}))
 	})
@@ -73,6 +113,7 @@ var _ = Describe("Response Writer", func() {
 		rw.Header().Add("set-cookie", cookie1)
 		rw.Header().Add("set-cookie", cookie2)
 		rw.WriteHeader(http.StatusTeapot)
+		rw.Flush()
 		fields := decodeHeader(strBuf)
 		Expect(fields).To(HaveKey("set-cookie"))
 		cookies := fields["set-cookie"]
@@ -85,6 +126,7 @@ var _ = Describe("Response Writer", func() {
 		Expect(n).To(Equal(6))
 		Expect(err).ToNot(HaveOccurred())
 		// Should have written 200 on the header stream
+		rw.Flush()
 		fields := decodeHeader(strBuf)
 		Expect(fields).To(HaveKeyWithValue(":status", []string{"200"}))
 		// And foobar on the data stream
@@ -97,6 +139,7 @@ var _ = Describe("Response Writer", func() {
 		Expect(n).To(Equal(6))
 		Expect(err).ToNot(HaveOccurred())
 		// Should have written 418 on the header stream
+		rw.Flush()
 		fields := decodeHeader(strBuf)
 		Expect(fields).To(HaveKeyWithValue(":status", []string{"418"}))
 		// And foobar on the data stream
@@ -106,15 +149,166 @@ var _ = Describe("Response Writer", func() {
 	It("does not WriteHeader() twice", func() {
 		rw.WriteHeader(200)
 		rw.WriteHeader(500)
+		rw.Flush()
 		fields := decodeHeader(strBuf)
 		Expect(fields).To(HaveLen(1))
 		Expect(fields).To(HaveKeyWithValue(":status", []string{"200"}))
 	})
 
+	It("buffers data until Flush is called", func() {
+		rw.WriteHeader(http.StatusTeapot)
+		_, err := rw.Write([]byte("foobar"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(strBuf.Len()).To(BeZero())
+		rw.Flush()
+		fields := decodeHeader(strBuf)
+		Expect(fields).To(HaveKeyWithValue(":status", []string{"418"}))
+		Expect(getData(strBuf)).To(Equal([]byte("foobar")))
+	})
+
+	It("writes the header when Flush is called before WriteHeader", func() {
+		rw.Flush()
+		fields := decodeHeader(strBuf)
+		Expect(fields).To(HaveKeyWithValue(":status", []string{"200"}))
+		Expect(strBuf.Len()).To(BeZero())
+		// the status can't be changed any more
+		rw.WriteHeader(500)
+		rw.Flush()
+		Expect(strBuf.Len()).To(BeZero())
+	})
+
+	Context("trailers", func() {
+		It("writes declared trailers after the body", func() {
+			rw.Header().Set("Trailer", "Grpc-Status, grpc-message")
+			rw.WriteHeader(http.StatusOK)
+			_, err := rw.Write([]byte("foo"))
+			Expect(err).ToNot(HaveOccurred())
+			rw.Flush()
+			_, err = rw.Write([]byte("bar"))
+			Expect(err).ToNot(HaveOccurred())
+			rw.Header().Set("Grpc-Status", "0")
+			rw.Header().Set("Grpc-Message", "ok")
+			rw.writeTrailers()
+			rw.Flush()
+			fields := decodeHeader(strBuf)
+			Expect(fields).To(HaveKeyWithValue("trailer", []string{"Grpc-Status, grpc-message"}))
+			Expect(fields).ToNot(HaveKey("grpc-status"))
+			Expect(getData(strBuf)).To(Equal([]byte("foo")))
+			Expect(getData(strBuf)).To(Equal([]byte("bar")))
+			trailers := decodeHeader(strBuf)
+			Expect(trailers).To(Equal(map[string][]string{
+				"grpc-status":  {"0"},
+				"grpc-message": {"ok"},
+			}))
+			Expect(strBuf.Len()).To(BeZero())
+		})
+
+		It("writes undeclared trailers set using the trailer prefix", func() {
+			rw.WriteHeader(http.StatusOK)
+			rw.Header().Set(http.TrailerPrefix+"Foo", "bar")
+			rw.writeTrailers()
+			rw.Flush()
+			fields := decodeHeader(strBuf)
+			Expect(fields).To(HaveLen(1))
+			trailers := decodeHeader(strBuf)
+			Expect(trailers).To(Equal(map[string][]string{"foo": {"bar"}}))
+		})
+
+		It("doesn't send headers with the trailer prefix in the header block", func() {
+			rw.Header().Set(http.TrailerPrefix+"Foo", "bar")
+			rw.WriteHeader(http.StatusOK)
+			rw.Flush()
+			fields := decodeHeader(strBuf)
+			Expect(fields).To(HaveLen(1))
+			Expect(fields).To(HaveKey(":status"))
+		})
+
+		It("writes empty trailers", func() {
+			rw.Header().Set("Trailer", "Foo")
+			rw.WriteHeader(http.StatusOK)
+			rw.writeTrailers()
+			rw.Flush()
+			decodeHeader(strBuf)
+			Expect(decodeHeader(strBuf)).To(BeEmpty())
+			Expect(strBuf.Len()).To(BeZero())
+		})
+
+		It("ignores invalid trailers", func() {
+			rw.Header().Set("Trailer", "Content-Length")
+			rw.WriteHeader(http.StatusOK)
+			rw.Header().Set("Content-Length", "42")
+			rw.writeTrailers()
+			rw.Flush()
+			decodeHeader(strBuf)
+			Expect(strBuf.Len()).To(BeZero())
+		})
+
+		It("doesn't write trailers if none were declared", func() {
+			_, err := rw.Write([]byte("foobar"))
+			Expect(err).ToNot(HaveOccurred())
+			rw.writeTrailers()
+			rw.Flush()
+			decodeHeader(strBuf)
+			Expect(getData(strBuf)).To(Equal([]byte("foobar")))
+			Expect(strBuf.Len()).To(BeZero())
+		})
+	})
+
+	Context("hijacking", func() {
+		It("doesn't allow hijacking if there's no request stream", func() {
+			_, err := rw.HijackStream()
+			Expect(err).To(MatchError(http.ErrNotSupported))
+		})
+
+		It("flushes the buffered data and returns the stream", func() {
+			str := mockquic.NewMockStream(mockCtrl)
+			rw.requestStream = str
+			rw.WriteHeader(http.StatusOK)
+			Expect(strBuf.Len()).To(BeZero())
+			hijacked, err := rw.HijackStream()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(hijacked).To(Equal(str))
+			Expect(decodeHeader(strBuf)).To(HaveKeyWithValue(":status", []string{"200"}))
+		})
+
+		It("doesn't write to a hijacked stream", func() {
+			rw.requestStream = mockquic.NewMockStream(mockCtrl)
+			_, err := rw.HijackStream()
+			Expect(err).ToNot(HaveOccurred())
+			_, err = rw.Write([]byte("foobar"))
+			Expect(err).To(MatchError(http.ErrHijacked))
+			rw.WriteHeader(http.StatusOK)
+			rw.Flush()
+			Expect(rw.Push("/style.css", nil)).To(MatchError(http.ErrNotSupported))
+			rw.pusher = func(string, *http.PushOptions) error { return nil }
+			Expect(rw.Push("/style.css", nil)).To(MatchError(http.ErrHijacked))
+			Expect(strBuf.Len()).To(BeZero())
+		})
+
+		It("doesn't hijack a stream twice", func() {
+			rw.requestStream = mockquic.NewMockStream(mockCtrl)
+			_, err := rw.HijackStream()
+			Expect(err).ToNot(HaveOccurred())
+			_, err = rw.HijackStream()
+			Expect(err).To(MatchError(http.ErrHijacked))
+		})
+	})
+
 	It("doesn't allow writes if the status code doesn't allow a body", func() {
 		rw.WriteHeader(304)
 		n, err := rw.Write([]byte("foobar"))
 		Expect(n).To(BeZero())
 		Expect(err).To(MatchError(http.ErrBodyNotAllowed))
 	})
+
+	It("doesn't allow writes once the request context is canceled", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		rw.ctx = ctx
+		_, err := rw.Write([]byte("foo"))
+		Expect(err).ToNot(HaveOccurred())
+		cancel()
+		n, err := rw.Write([]byte("bar"))
+		Expect(n).To(BeZero())
+		Expect(err).To(MatchError(context.Canceled))
+	})
 })
@@ -1,6 +1,7 @@
 package http3
 
 import (
+	"context"
 	"crypto/tls"
 	"errors"
 	"fmt"
@@ -8,6 +9,7 @@ import (
 	"net/http"
 	"strings"
 	"sync"
+	"time"
 
 	quic "github.com/lucas-clemente/quic-go"
 
@@ -16,9 +18,25 @@ import (
 
 type roundTripCloser interface {
 	http.RoundTripper
+	RoundTripOpt(*http.Request, RoundTripOpt) (*http.Response, error)
 	io.Closer
 }
 
+// A pooledClient is a client managed by the RoundTripper's session pool.
+type pooledClient interface {
+	roundTripCloser
+
+	// isGoingAway says if the session received a GOAWAY frame
+	isGoingAway() bool
+	// isClosed says if dialing failed, or if the session was closed
+	isClosed() bool
+	// hasStreamLimitReached says if the peer's stream limit is currently exhausted
+	hasStreamLimitReached() bool
+	numActiveRequests() int
+	// closeIfIdle closes the session if there are no active requests, and reports if it did so
+	closeIfIdle() bool
+}
+
 // RoundTripper implements the http.RoundTripper interface
 type RoundTripper struct {
 	mutex sync.Mutex
@@ -46,7 +64,37 @@ type RoundTripper struct {
 	// If Dial is nil, quic.DialAddr will be used.
 	Dial func(network, addr string, tlsCfg *tls.Config, cfg *quic.Config) (quic.Session, error)
 
-	clients map[string]roundTripCloser
+	// MaxSessionsPerHost is the maximum number of QUIC sessions used for a single host.
+	// A new session is only dialed when the stream limit of all existing sessions is exhausted.
+	// If zero, a single session is used per host.
+	MaxSessionsPerHost int
+
+	// IdleSessionTimeout is the time after which a session without any active requests is closed.
+	// If zero, idle sessions are kept open until they are closed by the QUIC idle timeout.
+	IdleSessionTimeout time.Duration
+
+	// MaxResponseHeaderBytes specifies a limit on how many response bytes are allowed in the server's response header.
+	// This limit is also announced to the server in the SETTINGS frame.
+	// Zero means to use a default limit of 1 MB.
+	MaxResponseHeaderBytes int64
+
+	// ExpectContinueTimeout is the time to wait for the server's 100 Continue response
+	// before sending the body of a request that has an "Expect: 100-continue" header.
+	// If the server sends a final response before that, the body is not sent.
+	// Zero means to use a default of 1 second, a negative value means that the body is sent immediately.
+	ExpectContinueTimeout time.Duration
+
+	// EnableWebTransport allows establishing WebTransport sessions using DialWebTransport.
+	// Warning: This API is experimental, see WebTransportSession.
+	EnableWebTransport bool
+
+	clients map[poolKey][]pooledClient
+}
+
+// Sessions are pooled per authority and TLS configuration.
+type poolKey struct {
+	authority string
+	tlsConf   *tls.Config
 }
 
 // RoundTripOpt are options for the Transport.RoundTripOpt method.
@@ -56,6 +104,11 @@ type RoundTripOpt struct {
 	// no cached connection is available, RoundTrip
 	// will return ErrNoCachedConn.
 	OnlyCachedConn bool
+	// HijackStream makes it possible to take over the request stream.
+	// The request stream is not closed after sending the request, and the body
+	// of the response implements Hijacker.
+	// Requests using HijackStream can't have a body.
+	HijackStream bool
 }
 
 var _ roundTripCloser = &RoundTripper{}
@@ -99,12 +152,38 @@ func (r *RoundTripper) RoundTripOpt(req *http.Request, opt RoundTripOpt) (*http.
 		return nil, fmt.Errorf("http3: invalid method %q", req.Method)
 	}
 
-	hostname := authorityAddr("https", hostnameFromRequest(req))
-	cl, err := r.getClient(hostname, opt.OnlyCachedConn)
+	key := poolKey{
+		authority: authorityAddr("https", hostnameFromRequest(req)),
+		tlsConf:   r.TLSClientConfig,
+	}
+	cl, isNew, err := r.getClient(key, opt.OnlyCachedConn)
 	if err != nil {
 		return nil, err
 	}
-	return cl.RoundTrip(req)
+	rsp, err := cl.RoundTripOpt(req, opt)
+	if err == nil {
+		return rsp, nil
+	}
+	// Retry the request once on a new session if
+	// * the server didn't process the request, since it was rejected or the session was lost before sending it, or
+	// * the request is idempotent, and it was sent on a pooled session that turned out to be dead.
+	reqErr, ok := err.(*RequestError)
+	if !ok || (reqErr.MayHaveBeenProcessed && isNew) {
+		return nil, err
+	}
+	r.removeClient(key, cl)
+	if reqErr.MayHaveBeenProcessed && !isIdempotent(req) {
+		return nil, err
+	}
+	retryReq, ok := rewindRequest(req, reqErr.requestSent)
+	if !ok {
+		return nil, err
+	}
+	cl, _, err = r.getClient(key, opt.OnlyCachedConn)
+	if err != nil {
+		return nil, err
+	}
+	return cl.RoundTripOpt(retryReq, opt)
 }
 
 // RoundTrip does a round trip.
@@ -112,44 +191,204 @@ func (r *RoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
 	return r.RoundTripOpt(req, RoundTripOpt{})
 }
 
-func (r *RoundTripper) getClient(hostname string, onlyCached bool) (http.RoundTripper, error) {
+// A webTransportDialer establishes WebTransport sessions.
+type webTransportDialer interface {
+	dialWebTransport(*http.Request) (*http.Response, *WebTransportSession, error)
+}
+
+// DialWebTransport establishes a WebTransport session, by sending an extended CONNECT request to urlStr.
+// The session uses a pooled QUIC connection, if available.
+// If the server rejects the session, the response is returned along with the error.
+// Warning: This API is experimental, see WebTransportSession.
+func (r *RoundTripper) DialWebTransport(ctx context.Context, urlStr string, header http.Header) (*http.Response, *WebTransportSession, error) {
+	if !r.EnableWebTransport {
+		return nil, nil, errors.New("http3: WebTransport is not enabled")
+	}
+	req, err := http.NewRequest(http.MethodConnect, urlStr, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	if req.URL.Scheme != "https" {
+		return nil, nil, fmt.Errorf("http3: unsupported protocol scheme: %s", req.URL.Scheme)
+	}
+	for k, vv := range header {
+		req.Header[k] = append([]string(nil), vv...)
+	}
+	req.Header.Set(":protocol", webTransportProtocol)
+	req = req.WithContext(ctx)
+
+	key := poolKey{
+		authority: authorityAddr("https", hostnameFromRequest(req)),
+		tlsConf:   r.TLSClientConfig,
+	}
+	cl, _, err := r.getClient(key, false)
+	if err != nil {
+		return nil, nil, err
+	}
+	d, ok := cl.(webTransportDialer)
+	if !ok {
+		return nil, nil, errors.New("http3: client doesn't support WebTransport")
+	}
+	return d.dialWebTransport(req)
+}
+
+// getClient returns a client for a new request.
+// Clients whose session is dead or going away are removed from the pool.
+// Of the remaining clients, the one with the fewest active requests that still has streams available is used.
+// A new client is created if there is no such client, unless the maximum number of sessions per host is reached.
+// Dialing happens lazily on the first request, such that concurrent requests share the handshake.
+func (r *RoundTripper) getClient(key poolKey, onlyCached bool) (cl pooledClient, isNew bool, err error) {
 	r.mutex.Lock()
 	defer r.mutex.Unlock()
 
 	if r.clients == nil {
-		r.clients = make(map[string]roundTripCloser)
+		r.clients = make(map[poolKey][]pooledClient)
 	}
 
-	client, ok := r.clients[hostname]
-	if !ok {
+	var clients []pooledClient
+	for _, c := range r.clients[key] {
+		// Don't reuse sessions that are dead, or that received a GOAWAY frame.
+		if c.isClosed() || c.isGoingAway() {
+			continue
+		}
+		clients = append(clients, c)
+	}
+
+	var leastBusy pooledClient
+	for _, c := range clients {
+		numActive := c.numActiveRequests()
+		if leastBusy == nil || numActive < leastBusy.numActiveRequests() {
+			leastBusy = c
+		}
+		if c.hasStreamLimitReached() {
+			continue
+		}
+		if cl == nil || numActive < cl.numActiveRequests() {
+			cl = c
+		}
+	}
+	maxSessions := r.MaxSessionsPerHost
+	if maxSessions <= 0 {
+		maxSessions = 1
+	}
+	// All sessions have exhausted their stream limit, and no new session may be dialed.
+	// The request will wait until a stream becomes available.
+	if cl == nil && leastBusy != nil && (len(clients) >= maxSessions || onlyCached) {
+		cl = leastBusy
+	}
+	if cl == nil {
 		if onlyCached {
-			return nil, ErrNoCachedConn
+			r.setClients(key, clients)
+			return nil, false, ErrNoCachedConn
 		}
-		client = newClient(
-			hostname,
-			r.TLSClientConfig,
-			&roundTripperOpts{DisableCompression: r.DisableCompression},
+		cl = newClient(
+			key.authority,
+			key.tlsConf,
+			&roundTripperOpts{
+				DisableCompression:    r.DisableCompression,
+				IdleTimeout:           r.IdleSessionTimeout,
+				MaxHeaderBytes:        r.MaxResponseHeaderBytes,
+				ExpectContinueTimeout: r.ExpectContinueTimeout,
+				EnableWebTransport:    r.EnableWebTransport,
+			},
 			r.QuicConfig,
 			r.Dial,
 		)
-		r.clients[hostname] = client
+		clients = append(clients, cl)
+		isNew = true
+	}
+	r.setClients(key, clients)
+	return cl, isNew, nil
+}
+
+// setClients sets the clients for a pool key.
+// It must be called with the mutex held.
+func (r *RoundTripper) setClients(key poolKey, clients []pooledClient) {
+	if len(clients) == 0 {
+		delete(r.clients, key)
+		return
+	}
+	r.clients[key] = clients
+}
+
+// removeClient removes a client from the pool.
+// The client's session is closed when all of its responses have been closed.
+func (r *RoundTripper) removeClient(key poolKey, cl pooledClient) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	var clients []pooledClient
+	for _, c := range r.clients[key] {
+		if c != cl {
+			clients = append(clients, c)
+		}
+	}
+	r.setClients(key, clients)
+}
+
+// CloseIdleConnections closes all QUIC sessions that don't have any active requests.
+// It doesn't interrupt any sessions currently in use.
+func (r *RoundTripper) CloseIdleConnections() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	for key, clients := range r.clients {
+		var remaining []pooledClient
+		for _, cl := range clients {
+			if !cl.closeIfIdle() {
+				remaining = append(remaining, cl)
+			}
+		}
+		r.setClients(key, remaining)
 	}
-	return client, nil
 }
 
 // Close closes the QUIC connections that this RoundTripper has used
 func (r *RoundTripper) Close() error {
 	r.mutex.Lock()
 	defer r.mutex.Unlock()
-	for _, client := range r.clients {
-		if err := client.Close(); err != nil {
-			return err
+	for _, clients := range r.clients {
+		for _, client := range clients {
+			if err := client.Close(); err != nil {
+				return err
+			}
 		}
 	}
 	r.clients = nil
 	return nil
 }
 
+// isIdempotent says if a request can be sent again, even if the server might have processed it.
+// Like net/http, requests with an Idempotency-Key header are treated as idempotent.
+func isIdempotent(req *http.Request) bool {
+	switch req.Method {
+	case "", http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	if _, ok := req.Header["Idempotency-Key"]; ok {
+		return true
+	}
+	_, ok := req.Header["X-Idempotency-Key"]
+	return ok
+}
+
+// rewindRequest returns a request that can be sent again.
+// If no part of the request was sent, the body wasn't read, and the request can be reused.
+// Otherwise, requests with a body can only be sent again if the request has a GetBody function.
+func rewindRequest(req *http.Request, requestSent bool) (*http.Request, bool) {
+	if req.Body == nil || req.Body == http.NoBody || !requestSent {
+		return req, true
+	}
+	if req.GetBody == nil {
+		return nil, false
+	}
+	body, err := req.GetBody()
+	if err != nil {
+		return nil, false
+	}
+	newReq := *req
+	newReq.Body = body
+	return &newReq, true
+}
+
 func closeRequestBody(req *http.Request) {
 	if req.Body != nil {
 		req.Body.Close()
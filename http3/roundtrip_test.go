@@ -2,6 +2,7 @@ package http3
 
 import (
 	"bytes"
+	"context"
 	"crypto/tls"
 	"errors"
 	"io"
@@ -16,18 +17,50 @@ import (
 )
 
 type mockClient struct {
-	closed bool
+	closed             bool // set when Close or closeIfIdle is called
+	goingAway          bool
+	sessionClosed      bool
+	streamLimitReached bool
+	activeRequests     int
+	err                error // returned by RoundTripOpt, if set
+	dieOnError         bool  // if set, the session is closed when returning err
 }
 
 func (m *mockClient) RoundTrip(req *http.Request) (*http.Response, error) {
+	return m.RoundTripOpt(req, RoundTripOpt{})
+}
+func (m *mockClient) RoundTripOpt(req *http.Request, _ RoundTripOpt) (*http.Response, error) {
+	if m.err != nil {
+		m.sessionClosed = m.dieOnError
+		return nil, m.err
+	}
 	return &http.Response{Request: req}, nil
 }
 func (m *mockClient) Close() error {
 	m.closed = true
 	return nil
 }
+func (m *mockClient) isGoingAway() bool           { return m.goingAway }
+func (m *mockClient) isClosed() bool              { return m.sessionClosed }
+func (m *mockClient) hasStreamLimitReached() bool { return m.streamLimitReached }
+func (m *mockClient) numActiveRequests() int      { return m.activeRequests }
+func (m *mockClient) closeIfIdle() bool {
+	if m.activeRequests > 0 {
+		return false
+	}
+	m.closed = true
+	return true
+}
+
+type mockStreamError struct {
+	code quic.ErrorCode
+}
 
-var _ roundTripCloser = &mockClient{}
+func (e *mockStreamError) Error() string             { return "stream error" }
+func (e *mockStreamError) Canceled() bool            { return true }
+func (e *mockStreamError) ErrorCode() quic.ErrorCode { return e.code }
+
+var _ pooledClient = &mockClient{}
 
 type mockBody struct {
 	reader   bytes.Reader
@@ -74,6 +107,8 @@ var _ = Describe("RoundTripper", func() {
 
 		BeforeEach(func() {
 			session = mockquic.NewMockSession(mockCtrl)
+			session.EXPECT().AcceptUniStream().Return(nil, errors.New("done")).AnyTimes()
+			session.EXPECT().Context().Return(context.Background()).AnyTimes()
 			origDialAddr = dialAddr
 			dialAddr = func(addr string, tlsConf *tls.Config, config *quic.Config) (quic.Session, error) {
 				// return an error when trying to open a stream
@@ -92,7 +127,7 @@ var _ = Describe("RoundTripper", func() {
 			req, err := http.NewRequest("GET", "https://quic.clemente.io/foobar.html", nil)
 			Expect(err).ToNot(HaveOccurred())
 			session.EXPECT().OpenUniStreamSync().AnyTimes().Return(nil, testErr)
-			session.EXPECT().OpenStreamSync().Return(nil, testErr)
+			session.EXPECT().OpenStream().Return(nil, testErr)
 			session.EXPECT().CloseWithError(gomock.Any(), gomock.Any()).Do(func(quic.ErrorCode, error) { close(closed) })
 			_, err = rt.RoundTrip(req)
 			Expect(err).To(MatchError(testErr))
@@ -129,7 +164,7 @@ var _ = Describe("RoundTripper", func() {
 			closed := make(chan struct{})
 			testErr := errors.New("test err")
 			session.EXPECT().OpenUniStreamSync().AnyTimes().Return(nil, testErr)
-			session.EXPECT().OpenStreamSync().Return(nil, testErr).Times(2)
+			session.EXPECT().OpenStream().Return(nil, testErr).Times(2)
 			session.EXPECT().CloseWithError(gomock.Any(), gomock.Any()).Do(func(quic.ErrorCode, error) { close(closed) })
 			req, err := http.NewRequest("GET", "https://quic.clemente.io/file1.html", nil)
 			Expect(err).ToNot(HaveOccurred())
@@ -152,6 +187,211 @@ var _ = Describe("RoundTripper", func() {
 		})
 	})
 
+	Context("pooling sessions", func() {
+		key := poolKey{authority: "quic.clemente.io:443"}
+		var dialed int
+
+		BeforeEach(func() {
+			dialed = 0
+			rt.Dial = func(_, _ string, _ *tls.Config, _ *quic.Config) (quic.Session, error) {
+				dialed++
+				return nil, errors.New("handshake error")
+			}
+			rt.clients = make(map[poolKey][]pooledClient)
+		})
+
+		newRequest := func() *http.Request {
+			req, err := http.NewRequest("GET", "https://quic.clemente.io/foobar.html", nil)
+			Expect(err).ToNot(HaveOccurred())
+			return req
+		}
+
+		It("uses the least busy session", func() {
+			cl1 := &mockClient{activeRequests: 3}
+			cl2 := &mockClient{activeRequests: 1}
+			cl3 := &mockClient{activeRequests: 2}
+			rt.clients[key] = []pooledClient{cl1, cl2, cl3}
+			cl, isNew, err := rt.getClient(key, false)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(isNew).To(BeFalse())
+			Expect(cl).To(Equal(cl2))
+		})
+
+		It("dials a new session when the stream limit of all sessions is exhausted", func() {
+			rt.MaxSessionsPerHost = 2
+			cl1 := &mockClient{streamLimitReached: true}
+			rt.clients[key] = []pooledClient{cl1}
+			cl, isNew, err := rt.getClient(key, false)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(isNew).To(BeTrue())
+			Expect(cl).ToNot(Equal(cl1))
+			Expect(rt.clients[key]).To(HaveLen(2))
+		})
+
+		It("doesn't dial more sessions than allowed", func() {
+			rt.MaxSessionsPerHost = 2
+			cl1 := &mockClient{streamLimitReached: true, activeRequests: 10}
+			cl2 := &mockClient{streamLimitReached: true, activeRequests: 5}
+			rt.clients[key] = []pooledClient{cl1, cl2}
+			cl, isNew, err := rt.getClient(key, false)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(isNew).To(BeFalse())
+			Expect(cl).To(Equal(cl2))
+		})
+
+		It("uses a single session per host by default", func() {
+			cl1 := &mockClient{streamLimitReached: true}
+			rt.clients[key] = []pooledClient{cl1}
+			cl, isNew, err := rt.getClient(key, false)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(isNew).To(BeFalse())
+			Expect(cl).To(Equal(cl1))
+		})
+
+		It("uses different sessions for different TLS configurations", func() {
+			rt.clients[key] = []pooledClient{&mockClient{}}
+			rt.TLSClientConfig = &tls.Config{}
+			_, err := rt.RoundTrip(newRequest())
+			Expect(err).To(MatchError("handshake error"))
+			Expect(dialed).To(Equal(1))
+			Expect(rt.clients).To(HaveLen(2))
+		})
+
+		It("doesn't reuse dead sessions", func() {
+			cl := &mockClient{sessionClosed: true}
+			rt.clients[key] = []pooledClient{cl}
+			_, err := rt.RoundTrip(newRequest())
+			Expect(err).To(MatchError("handshake error"))
+			Expect(dialed).To(Equal(1))
+			Expect(rt.clients[key]).To(HaveLen(1))
+			Expect(rt.clients[key][0]).ToNot(Equal(cl))
+		})
+
+		It("retries idempotent requests on a new session, if the pooled session was dead", func() {
+			rt.clients[key] = []pooledClient{&mockClient{err: &RequestError{Err: errors.New("session closed"), MayHaveBeenProcessed: true, requestSent: true}, dieOnError: true}}
+			_, err := rt.RoundTrip(newRequest())
+			Expect(err).To(MatchError("handshake error"))
+			Expect(dialed).To(Equal(1))
+		})
+
+		It("doesn't retry non-idempotent requests, if the pooled session was dead", func() {
+			rt.clients[key] = []pooledClient{&mockClient{err: &RequestError{Err: errors.New("session closed"), MayHaveBeenProcessed: true, requestSent: true}, dieOnError: true}}
+			req, err := http.NewRequest("POST", "https://quic.clemente.io/foobar.html", nil)
+			Expect(err).ToNot(HaveOccurred())
+			_, err = rt.RoundTrip(req)
+			Expect(err).To(MatchError("session closed"))
+			Expect(dialed).To(BeZero())
+			Expect(rt.clients).ToNot(HaveKey(key))
+		})
+
+		It("retries non-idempotent requests, if the pooled session was dead before the request was sent", func() {
+			rt.clients[key] = []pooledClient{&mockClient{err: &RequestError{Err: errors.New("session closed")}, dieOnError: true}}
+			req, err := http.NewRequest("POST", "https://quic.clemente.io/foobar.html", nil)
+			Expect(err).ToNot(HaveOccurred())
+			_, err = rt.RoundTrip(req)
+			Expect(err).To(MatchError("handshake error"))
+			Expect(dialed).To(Equal(1))
+		})
+
+		It("retries non-idempotent requests with an Idempotency-Key header, if the pooled session was dead", func() {
+			rt.clients[key] = []pooledClient{&mockClient{err: &RequestError{Err: errors.New("session closed"), MayHaveBeenProcessed: true, requestSent: true}, dieOnError: true}}
+			req, err := http.NewRequest("POST", "https://quic.clemente.io/foobar.html", nil)
+			Expect(err).ToNot(HaveOccurred())
+			req.Header.Set("Idempotency-Key", "foobar")
+			_, err = rt.RoundTrip(req)
+			Expect(err).To(MatchError("handshake error"))
+			Expect(dialed).To(Equal(1))
+		})
+
+		It("closes idle sessions", func() {
+			idle := &mockClient{}
+			active := &mockClient{activeRequests: 1}
+			rt.clients[key] = []pooledClient{idle, active}
+			rt.CloseIdleConnections()
+			Expect(idle.closed).To(BeTrue())
+			Expect(active.closed).To(BeFalse())
+			Expect(rt.clients[key]).To(Equal([]pooledClient{active}))
+		})
+	})
+
+	Context("handling GOAWAY", func() {
+		key := poolKey{authority: "quic.clemente.io:443"}
+		var dialed int
+
+		BeforeEach(func() {
+			dialed = 0
+			rt.Dial = func(_, _ string, _ *tls.Config, _ *quic.Config) (quic.Session, error) {
+				dialed++
+				return nil, errors.New("handshake error")
+			}
+			rt.clients = make(map[poolKey][]pooledClient)
+		})
+
+		It("doesn't reuse clients that received a GOAWAY", func() {
+			cl := &mockClient{goingAway: true}
+			rt.clients[key] = []pooledClient{cl}
+			req, err := http.NewRequest("GET", "https://quic.clemente.io/foobar.html", nil)
+			Expect(err).ToNot(HaveOccurred())
+			_, err = rt.RoundTrip(req)
+			Expect(err).To(MatchError("handshake error"))
+			Expect(dialed).To(Equal(1))
+			Expect(rt.clients[key]).To(HaveLen(1))
+			Expect(rt.clients[key][0]).ToNot(Equal(cl))
+		})
+
+		It("retries idempotent requests that were rejected on a new connection", func() {
+			rt.clients[key] = []pooledClient{&mockClient{err: &RequestError{Err: &mockStreamError{code: quic.ErrorCode(errorRequestRejected)}, requestSent: true}}}
+			req, err := http.NewRequest("GET", "https://quic.clemente.io/foobar.html", nil)
+			Expect(err).ToNot(HaveOccurred())
+			_, err = rt.RoundTrip(req)
+			Expect(err).To(MatchError("handshake error"))
+			Expect(dialed).To(Equal(1))
+		})
+
+		It("retries requests with a body that were rejected, if the body can be rewound", func() {
+			rt.clients[key] = []pooledClient{&mockClient{err: &RequestError{Err: &mockStreamError{code: quic.ErrorCode(errorRequestRejected)}, requestSent: true}}}
+			req, err := http.NewRequest("PUT", "https://quic.clemente.io/foobar.html", bytes.NewReader([]byte("foobar")))
+			Expect(err).ToNot(HaveOccurred())
+			_, err = rt.RoundTrip(req)
+			Expect(err).To(MatchError("handshake error"))
+			Expect(dialed).To(Equal(1))
+		})
+
+		It("doesn't retry requests with a body that were rejected, if the body can't be rewound", func() {
+			reqErr := &RequestError{Err: &mockStreamError{code: quic.ErrorCode(errorRequestRejected)}, requestSent: true}
+			rt.clients[key] = []pooledClient{&mockClient{err: reqErr}}
+			req, err := http.NewRequest("PUT", "https://quic.clemente.io/foobar.html", bytes.NewReader([]byte("foobar")))
+			Expect(err).ToNot(HaveOccurred())
+			req.GetBody = nil
+			_, err = rt.RoundTrip(req)
+			Expect(err).To(MatchError(reqErr))
+			Expect(dialed).To(BeZero())
+		})
+
+		It("retries requests with a body that wasn't sent yet, even if the body can't be rewound", func() {
+			cl := &mockClient{err: &RequestError{Err: errGoingAway}}
+			rt.clients[key] = []pooledClient{cl}
+			req, err := http.NewRequest("POST", "https://quic.clemente.io/foobar.html", bytes.NewReader([]byte("foobar")))
+			Expect(err).ToNot(HaveOccurred())
+			req.GetBody = nil
+			_, err = rt.RoundTrip(req)
+			Expect(err).To(MatchError("handshake error"))
+			Expect(dialed).To(Equal(1))
+			// the client is not used any more
+			Expect(rt.clients[key]).To(HaveLen(1))
+			Expect(rt.clients[key][0]).ToNot(Equal(cl))
+		})
+
+		It("doesn't retry requests that failed for other reasons", func() {
+			rt.clients[key] = []pooledClient{&mockClient{err: &mockStreamError{code: quic.ErrorCode(errorRequestCanceled)}}}
+			req, err := http.NewRequest("GET", "https://quic.clemente.io/foobar.html", nil)
+			Expect(err).ToNot(HaveOccurred())
+			_, err = rt.RoundTrip(req)
+			Expect(err).To(MatchError("stream error"))
+			Expect(dialed).To(BeZero())
+		})
+	})
+
 	Context("validating request", func() {
 		It("rejects plain HTTP requests", func() {
 			req, err := http.NewRequest("GET", "http://www.example.org/", nil)
@@ -216,9 +456,9 @@ var _ = Describe("RoundTripper", func() {
 
 	Context("closing", func() {
 		It("closes", func() {
-			rt.clients = make(map[string]roundTripCloser)
+			rt.clients = make(map[poolKey][]pooledClient)
 			cl := &mockClient{}
-			rt.clients["foo.bar"] = cl
+			rt.clients[poolKey{authority: "foo.bar"}] = []pooledClient{cl}
 			err := rt.Close()
 			Expect(err).ToNot(HaveOccurred())
 			Expect(len(rt.clients)).To(BeZero())
@@ -232,4 +472,17 @@ var _ = Describe("RoundTripper", func() {
 			Expect(len(rt.clients)).To(BeZero())
 		})
 	})
+
+	Context("WebTransport", func() {
+		It("refuses to dial WebTransport sessions if WebTransport is disabled", func() {
+			_, _, err := rt.DialWebTransport(context.Background(), "https://www.example.org/webtransport", nil)
+			Expect(err).To(MatchError("http3: WebTransport is not enabled"))
+		})
+
+		It("refuses to dial WebTransport sessions for non-https URLs", func() {
+			rt.EnableWebTransport = true
+			_, _, err := rt.DialWebTransport(context.Background(), "http://www.example.org/webtransport", nil)
+			Expect(err).To(MatchError("http3: unsupported protocol scheme: http"))
+		})
+	})
 })
@@ -1,6 +1,7 @@
 package http3
 
 import (
+	"context"
 	"crypto/tls"
 	"errors"
 	"fmt"
@@ -16,9 +17,11 @@ import (
 	"github.com/lucas-clemente/quic-go"
 	"github.com/lucas-clemente/quic-go/internal/protocol"
 	"github.com/lucas-clemente/quic-go/internal/utils"
-	"github.com/marten-seemann/qpack"
 )
 
+// errHijacked is returned by handleRequest if the handler hijacked the request stream
+var errHijacked = errors.New("http3: stream hijacked")
+
 // allows mocking of quic.Listen and quic.ListenAddr
 var (
 	quicListen     = quic.Listen
@@ -33,17 +36,56 @@ type Server struct {
 	// If nil, it uses reasonable default values.
 	QuicConfig *quic.Config
 
-	port uint32 // used atomically
+	// MaxPushPromises is the maximum number of responses that are pushed on a connection (see http.Pusher).
+	// Pushes are only possible if the client allows them by sending a MAX_PUSH_ID frame.
+	// If 0, server push is disabled, and Push returns http.ErrNotSupported.
+	MaxPushPromises int
+
+	// EnableWebTransport enables WebTransport sessions, established by extended CONNECT requests.
+	// Handlers for WebTransport sessions are registered using HandleWebTransport.
+	// Warning: This API is experimental, see WebTransportSession.
+	EnableWebTransport bool
+
+	// IgnorePriority disables applying the priority that clients signal in the Priority header (RFC 9218)
+	// to the response stream. By default, responses are scheduled according to their priority.
+	// The signaled priority is available to handlers via PriorityFromContext in any case.
+	IgnorePriority bool
+
+	headersTooLarge uint64 // used atomically
 
 	listenerMutex sync.Mutex
-	listener      quic.Listener
+	listeners     []quic.Listener
 	closed        bool
+	sessions      map[*serverSession]struct{} // used for sending GOAWAY frames in Shutdown
+	// altSvcHeader is the value of the Alt-Svc header set by SetQuicHeaders.
+	// It is regenerated every time a listener is added or removed.
+	altSvcHeader string
 
-	supportedVersionsAsString string
+	webTransportMutex    sync.Mutex
+	webTransportHandlers map[string]WebTransportHandler
 
 	logger utils.Logger
 }
 
+// HandleWebTransport registers the handler for WebTransport sessions established for the given path.
+// The path has to match the path of the extended CONNECT request exactly.
+// Requests for paths without a handler are rejected with a 404 status.
+func (s *Server) HandleWebTransport(path string, handler WebTransportHandler) {
+	s.webTransportMutex.Lock()
+	defer s.webTransportMutex.Unlock()
+	if s.webTransportHandlers == nil {
+		s.webTransportHandlers = make(map[string]WebTransportHandler)
+	}
+	s.webTransportHandlers[path] = handler
+}
+
+func (s *Server) webTransportHandler(path string) (WebTransportHandler, bool) {
+	s.webTransportMutex.Lock()
+	defer s.webTransportMutex.Unlock()
+	handler, ok := s.webTransportHandlers[path]
+	return handler, ok
+}
+
 // ListenAndServe listens on the UDP address s.Addr and calls s.Handler to handle HTTP/3 requests on incoming connections.
 func (s *Server) ListenAndServe() error {
 	if s.Server == nil {
@@ -77,15 +119,18 @@ func (s *Server) serveImpl(tlsConfig *tls.Config, conn net.PacketConn) error {
 	if s.Server == nil {
 		return errors.New("use of http3.Server without http.Server")
 	}
-	s.logger = utils.DefaultLogger.WithPrefix("server")
 	s.listenerMutex.Lock()
 	if s.closed {
 		s.listenerMutex.Unlock()
 		return errors.New("Server is already closed")
 	}
-	if s.listener != nil {
-		s.listenerMutex.Unlock()
-		return errors.New("ListenAndServe may only be called once")
+	if s.logger == nil {
+		s.logger = newLogger(s.QuicConfig, "server")
+	}
+
+	if tlsConfig != nil {
+		tlsConfig = tlsConfig.Clone()
+		tlsConfig.NextProtos = []string{nextProtoH3}
 	}
 
 	var ln quic.Listener
@@ -99,8 +144,9 @@ func (s *Server) serveImpl(tlsConfig *tls.Config, conn net.PacketConn) error {
 		s.listenerMutex.Unlock()
 		return err
 	}
-	s.listener = ln
+	s.addListener(ln)
 	s.listenerMutex.Unlock()
+	defer s.removeListener(ln)
 
 	for {
 		sess, err := ln.Accept()
@@ -112,8 +158,25 @@ func (s *Server) serveImpl(tlsConfig *tls.Config, conn net.PacketConn) error {
 }
 
 func (s *Server) handleConn(sess quic.Session) {
-	// TODO: accept control streams
-	decoder := qpack.NewDecoder(nil)
+	serverSess := newServerSession(s.logger)
+	s.addSession(serverSess)
+	defer s.removeSession(serverSess)
+
+	var webTransport *webTransportManager
+	if s.EnableWebTransport {
+		webTransport = newWebTransportManager(sess, s.logger)
+	}
+	go func() {
+		str, err := openControlStream(sess, s.maxHeaderBytes(), s.EnableWebTransport)
+		if err != nil {
+			s.logger.Debugf("Opening the control stream failed: %s", err)
+			sess.CloseWithError(quic.ErrorCode(errorInternalError), err)
+			return
+		}
+		serverSess.setControlStream(str)
+	}()
+	pushes := newPushManager(sess, s.MaxPushPromises)
+	go handleUnidirectionalStreams(sess, protocol.PerspectiveServer, pushes.handleFrame, nil, webTransport, s.logger)
 
 	for {
 		str, err := sess.AcceptStream()
@@ -121,9 +184,18 @@ func (s *Server) handleConn(sess quic.Session) {
 			s.logger.Debugf("Accepting stream failed: %s", err)
 			return
 		}
+		if !serverSess.acceptRequest(str.StreamID()) {
+			s.logger.Debugf("Rejecting request on stream %d, since the session is going away", str.StreamID())
+			str.CancelRead(quic.ErrorCode(errorRequestRejected))
+			str.CancelWrite(quic.ErrorCode(errorRequestRejected))
+			continue
+		}
 		// TODO: handle error
 		go func() {
-			if err := s.handleRequest(str, decoder); err != nil {
+			if err := s.handleRequest(sess, str, pushes, webTransport); err != nil {
+				if err == errHijacked { // the handler (or a WebTransport session) is now responsible for the stream
+					return
+				}
 				s.logger.Debugf("Handling request failed: %s", err)
 				str.CancelWrite(quic.ErrorCode(errorGeneralProtocolError))
 				return
@@ -135,24 +207,38 @@ func (s *Server) handleConn(sess quic.Session) {
 
 // TODO: improve error handling.
 // Most (but not all) of the errors occurring here are connection-level erros.
-func (s *Server) handleRequest(str quic.Stream, decoder *qpack.Decoder) error {
+// If webTransport is nil, WebTransport is disabled.
+func (s *Server) handleRequest(sess quic.Session, str quic.Stream, pushes *pushManager, webTransport *webTransportManager) error {
 	frame, err := parseNextFrame(str)
 	if err != nil {
 		str.CancelWrite(quic.ErrorCode(errorRequestCanceled))
 		return err
 	}
+	if f, ok := frame.(*webTransportStreamFrame); ok && webTransport != nil {
+		// This is not a request stream, but a stream belonging to a WebTransport session.
+		webTransport.handleStream(str, f.SessionID)
+		return errHijacked
+	}
 	hf, ok := frame.(*headersFrame)
 	if !ok {
 		str.CancelWrite(quic.ErrorCode(errorUnexpectedFrame))
 		return errors.New("expected first frame to be a headers frame")
 	}
-	// TODO: check length
+	maxHeaderBytes := s.maxHeaderBytes()
+	if hf.Length > maxHeaderBytes {
+		s.rejectHeaderTooLarge(str)
+		return errHeaderTooLarge
+	}
 	headerBlock := make([]byte, hf.Length)
 	if _, err := io.ReadFull(str, headerBlock); err != nil {
 		str.CancelWrite(quic.ErrorCode(errorIncompleteRequest))
 		return err
 	}
-	hfs, err := decoder.DecodeFull(headerBlock)
+	hfs, err := decodeHeaders(headerBlock, maxHeaderBytes)
+	if err == errHeaderTooLarge {
+		s.rejectHeaderTooLarge(str)
+		return err
+	}
 	if err != nil {
 		// TODO: use the right error code
 		str.CancelWrite(quic.ErrorCode(errorGeneralProtocolError))
@@ -162,7 +248,48 @@ func (s *Server) handleRequest(str quic.Stream, decoder *qpack.Decoder) error {
 	if err != nil {
 		return err
 	}
-	req.Body = newRequestBody(str)
+	// Like net/http, only the 100-continue expectation is supported.
+	expectsContinue := expectsContinue(req)
+	if !expectsContinue && req.Header.Get("Expect") != "" {
+		responseWriter := newResponseWriter(str, s.logger)
+		responseWriter.WriteHeader(http.StatusExpectationFailed)
+		responseWriter.Flush()
+		str.CancelRead(quic.ErrorCode(errorEarlyResponse))
+		return nil
+	}
+	req.Header.Del("Expect")
+
+	// Populate the fields that net/http sets, so that existing middleware keeps working.
+	connState := newConnectionState(sess)
+	req.TLS = &connState.TLS
+	req.RemoteAddr = connState.RemoteAddr.String()
+
+	// The request context is canceled when the client resets the stream.
+	// STOP_SENDING cancels the stream's context, a RESET_STREAM is noticed when reading the request body.
+	ctx, cancel := context.WithCancel(str.Context())
+	ctx = context.WithValue(ctx, http.ServerContextKey, s.Server)
+	ctx = context.WithValue(ctx, http.LocalAddrContextKey, connState.LocalAddr)
+	ctx = context.WithValue(ctx, connectionStateKey{}, connState)
+	if prio, ok := priorityFromHeader(req.Header); ok {
+		ctx = context.WithValue(ctx, priorityKey{}, prio)
+		if !s.IgnorePriority {
+			str.SetPriority(prio.Urgency, prio.Incremental)
+		}
+	}
+	if req.Method == http.MethodConnect && req.Header.Get(":protocol") != "" {
+		return s.handleExtendedConnect(str, req.WithContext(ctx), cancel, webTransport)
+	}
+	streamBody := newRequestStreamBody(str, cancel)
+	reqBody := newRequestBody(streamBody, func(trailers http.Header) {
+		// Only copy the trailers that were declared in the Trailer header.
+		for k, vv := range trailers {
+			if _, ok := req.Trailer[k]; ok {
+				req.Trailer[k] = vv
+			}
+		}
+	})
+	reqBody.maxHeaderBytes = maxHeaderBytes
+	req.Body = reqBody
 
 	if s.logger.Debug() {
 		s.logger.Infof("%s %s%s, on stream %d", req.Method, req.Host, req.RequestURI, str.StreamID())
@@ -170,8 +297,24 @@ func (s *Server) handleRequest(str quic.Stream, decoder *qpack.Decoder) error {
 		s.logger.Infof("%s %s%s", req.Method, req.Host, req.RequestURI)
 	}
 
-	req = req.WithContext(str.Context())
+	req = req.WithContext(ctx)
 	responseWriter := newResponseWriter(str, s.logger)
+	responseWriter.ctx = ctx
+	responseWriter.requestStream = str
+	if expectsContinue {
+		// The client waits for the 100 Continue response before sending the body.
+		// Send it when the handler starts reading the body, unless it already sent the final response.
+		streamBody.onFirstRead = func() {
+			if !responseWriter.headerWritten {
+				responseWriter.writeInformationalHeader(http.StatusContinue, nil)
+			}
+		}
+	}
+	if pushes != nil {
+		responseWriter.pusher = func(target string, opts *http.PushOptions) error {
+			return s.push(pushes, responseWriter.bufferedStream, req, target, opts)
+		}
+	}
 	handler := s.Handler
 	if handler == nil {
 		handler = http.DefaultServeMux
@@ -190,17 +333,26 @@ func (s *Server) handleRequest(str quic.Stream, decoder *qpack.Decoder) error {
 			}
 		}()
 		handler.ServeHTTP(responseWriter, req)
+		if responseWriter.hijacked {
+			return
+		}
 		// read the eof
 		if _, err = str.Read([]byte{}); err == io.EOF {
 			readEOF = true
 		}
 	}()
 
+	if responseWriter.hijacked {
+		return errHijacked
+	}
+	defer cancel()
 	if panicked {
 		responseWriter.WriteHeader(500)
 	} else {
 		responseWriter.WriteHeader(200)
+		responseWriter.writeTrailers()
 	}
+	responseWriter.Flush()
 
 	if !readEOF {
 		str.CancelRead(quic.ErrorCode(errorEarlyResponse))
@@ -208,57 +360,219 @@ func (s *Server) handleRequest(str quic.Stream, decoder *qpack.Decoder) error {
 	return nil
 }
 
+// handleExtendedConnect handles an extended CONNECT request (RFC 8441).
+// The only protocol supported is WebTransport, and only if it is enabled.
+// cancel cancels the request context. For WebTransport sessions, it is called when the session is closed.
+func (s *Server) handleExtendedConnect(str quic.Stream, req *http.Request, cancel context.CancelFunc, webTransport *webTransportManager) error {
+	responseWriter := newResponseWriter(str, s.logger)
+	if webTransport == nil || req.Header.Get(":protocol") != webTransportProtocol {
+		defer cancel()
+		responseWriter.WriteHeader(http.StatusNotImplemented)
+		responseWriter.Flush()
+		str.CancelRead(quic.ErrorCode(errorEarlyResponse))
+		return nil
+	}
+	handler, ok := s.webTransportHandler(req.URL.Path)
+	if !ok {
+		defer cancel()
+		responseWriter.WriteHeader(http.StatusNotFound)
+		responseWriter.Flush()
+		str.CancelRead(quic.ErrorCode(errorEarlyResponse))
+		return nil
+	}
+	s.logger.Infof("WebTransport session %d: %s%s", str.StreamID(), req.Host, req.RequestURI)
+	wsess := webTransport.addSession(str, cancel)
+	responseWriter.WriteHeader(http.StatusOK)
+	responseWriter.Flush()
+	go wsess.run()
+
+	defer func() {
+		if p := recover(); p != nil {
+			// Copied from net/http/server.go
+			const size = 64 << 10
+			buf := make([]byte, size)
+			buf = buf[:runtime.Stack(buf, false)]
+			s.logger.Errorf("http: panic serving WebTransport session: %v\n%s", p, buf)
+			wsess.Close()
+		}
+	}()
+	handler(wsess, req)
+	return errHijacked
+}
+
+// maxHeaderBytes returns the limit for the size of request header blocks, see http.Server.MaxHeaderBytes.
+func (s *Server) maxHeaderBytes() uint64 {
+	return maxHeaderBytesOrDefault(int64(s.Server.MaxHeaderBytes))
+}
+
+// rejectHeaderTooLarge resets a request stream, because the request headers exceeded the MaxHeaderBytes limit.
+func (s *Server) rejectHeaderTooLarge(str quic.Stream) {
+	if s.logger.Debug() {
+		s.logger.Debugf("Rejecting request on stream %d, since the request headers exceed %d bytes", str.StreamID(), s.maxHeaderBytes())
+	}
+	atomic.AddUint64(&s.headersTooLarge, 1)
+	str.CancelRead(quic.ErrorCode(errorExcessiveLoad))
+	str.CancelWrite(quic.ErrorCode(errorExcessiveLoad))
+}
+
+// ServerStats contains statistics about a Server.
+type ServerStats struct {
+	// HeadersTooLarge is the number of requests that were rejected because their headers exceeded MaxHeaderBytes.
+	HeadersTooLarge uint64
+}
+
+// Stats returns statistics about the server.
+func (s *Server) Stats() ServerStats {
+	return ServerStats{
+		HeadersTooLarge: atomic.LoadUint64(&s.headersTooLarge),
+	}
+}
+
 // Close the server immediately, aborting requests and sending CONNECTION_CLOSE frames to connected clients.
 // Close in combination with ListenAndServe() (instead of Serve()) may race if it is called before a UDP socket is established.
 func (s *Server) Close() error {
 	s.listenerMutex.Lock()
 	defer s.listenerMutex.Unlock()
 	s.closed = true
-	if s.listener != nil {
-		err := s.listener.Close()
-		s.listener = nil
-		return err
+	var err error
+	for _, ln := range s.listeners {
+		if cerr := ln.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
 	}
-	return nil
+	s.listeners = nil
+	s.generateAltSvcHeader()
+	return err
 }
 
 // CloseGracefully shuts down the server gracefully. The server sends a GOAWAY frame first, then waits for either timeout to trigger, or for all running requests to complete.
 // CloseGracefully in combination with ListenAndServe() (instead of Serve()) may race if it is called before a UDP socket is established.
 func (s *Server) CloseGracefully(timeout time.Duration) error {
-	// TODO: implement
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := s.Shutdown(ctx); err != nil && err != context.DeadlineExceeded {
+		return err
+	}
 	return nil
 }
 
+// addListener adds a listener, and updates the Alt-Svc header.
+// It must be called with the listenerMutex held.
+func (s *Server) addListener(ln quic.Listener) {
+	s.listeners = append(s.listeners, ln)
+	s.generateAltSvcHeader()
+}
+
+// removeListener removes a listener (if it wasn't already removed by Close or Shutdown), and updates the Alt-Svc header.
+func (s *Server) removeListener(ln quic.Listener) {
+	s.listenerMutex.Lock()
+	defer s.listenerMutex.Unlock()
+	for i, l := range s.listeners {
+		if l == ln {
+			s.listeners = append(s.listeners[:i], s.listeners[i+1:]...)
+			s.generateAltSvcHeader()
+			return
+		}
+	}
+}
+
+// generateAltSvcHeader generates the value of the Alt-Svc header.
+// It advertises the ports of all listeners the server is serving on.
+// If the server isn't serving yet, the header is generated by SetQuicHeaders from s.Server.Addr.
+// It must be called with the listenerMutex held.
+func (s *Server) generateAltSvcHeader() {
+	var ports []int
+	for _, ln := range s.listeners {
+		addr, ok := ln.Addr().(*net.UDPAddr)
+		if !ok {
+			continue
+		}
+		var seen bool
+		for _, p := range ports {
+			if p == addr.Port {
+				seen = true
+				break
+			}
+		}
+		if !seen {
+			ports = append(ports, addr.Port)
+		}
+	}
+	if len(ports) == 0 {
+		s.altSvcHeader = ""
+		return
+	}
+	s.altSvcHeader = s.altSvcValue(ports)
+}
+
+// altSvcValue returns the Alt-Svc value advertising the given ports.
+// For every port, it advertises HTTP/3 using the ALPN token, as well as the QUIC versions the server supports.
+func (s *Server) altSvcValue(ports []int) string {
+	supportedVersions := protocol.SupportedVersions
+	if s.QuicConfig != nil && len(s.QuicConfig.Versions) > 0 {
+		supportedVersions = s.QuicConfig.Versions
+	}
+	versions := make([]string, len(supportedVersions))
+	for i, v := range supportedVersions {
+		versions[i] = v.ToAltSvc()
+	}
+	versionsString := strings.Join(versions, ",")
+
+	values := make([]string, 0, 2*len(ports))
+	for _, port := range ports {
+		values = append(values, fmt.Sprintf(`%s=":%d"; ma=2592000`, nextProtoH3, port))
+		values = append(values, fmt.Sprintf(`quic=":%d"; ma=2592000; v="%s"`, port, versionsString))
+	}
+	return strings.Join(values, ",")
+}
+
 // SetQuicHeaders can be used to set the proper headers that announce that this server supports QUIC.
-// The values that are set depend on the port information from s.Server.Addr, and currently look like this (if Addr has port 443):
-//  Alt-Svc: quic=":443"; ma=2592000; v="33,32,31,30"
+// This allows migrating traffic from an existing HTTP/1.1 or HTTP/2 server (running over TCP) to HTTP/3:
+// both servers are run side by side using the same handler,
+// and the TCP server adds the Alt-Svc header to its responses, for example:
+//
+//	quicServer := &http3.Server{Server: &http.Server{Addr: ":443", Handler: handler}}
+//	httpServer := &http.Server{
+//		Addr: ":443",
+//		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+//			quicServer.SetQuicHeaders(w.Header())
+//			handler.ServeHTTP(w, r)
+//		}),
+//	}
+//	go quicServer.ListenAndServeTLS(certFile, keyFile)
+//	httpServer.ListenAndServeTLS(certFile, keyFile)
+//
+// ListenAndServe does exactly this.
+// Once the server is serving, the ports that the listeners are actually bound to are advertised
+// (this also works when listening on port 0). If the server is serving on multiple listeners, all ports are advertised.
+// Before that, the port is taken from s.Server.Addr.
+// The header currently looks like this (if the server listens on port 443):
+//
+//	Alt-Svc: h3-19=":443"; ma=2592000,quic=":443"; ma=2592000; v="4278190099"
 func (s *Server) SetQuicHeaders(hdr http.Header) error {
-	port := atomic.LoadUint32(&s.port)
-
-	if port == 0 {
+	s.listenerMutex.Lock()
+	altSvc := s.altSvcHeader
+	if altSvc == "" {
 		// Extract port from s.Server.Addr
 		_, portStr, err := net.SplitHostPort(s.Server.Addr)
 		if err != nil {
+			s.listenerMutex.Unlock()
 			return err
 		}
-		portInt, err := net.LookupPort("tcp", portStr)
+		port, err := net.LookupPort("tcp", portStr)
 		if err != nil {
+			s.listenerMutex.Unlock()
 			return err
 		}
-		port = uint32(portInt)
-		atomic.StoreUint32(&s.port, port)
-	}
-
-	if s.supportedVersionsAsString == "" {
-		var versions []string
-		for _, v := range protocol.SupportedVersions {
-			versions = append(versions, v.ToAltSvc())
+		if port == 0 {
+			s.listenerMutex.Unlock()
+			return errors.New("http3: can't advertise port 0, the server is not serving yet")
 		}
-		s.supportedVersionsAsString = strings.Join(versions, ",")
+		altSvc = s.altSvcValue([]int{port})
 	}
+	s.listenerMutex.Unlock()
 
-	hdr.Add("Alt-Svc", fmt.Sprintf(`quic=":%d"; ma=2592000; v="%s"`, port, s.supportedVersionsAsString))
-
+	hdr.Add("Alt-Svc", altSvc)
 	return nil
 }
 
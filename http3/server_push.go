@@ -0,0 +1,254 @@
+package http3
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"runtime"
+	"strings"
+	"sync"
+
+	quic "github.com/lucas-clemente/quic-go"
+	"github.com/lucas-clemente/quic-go/internal/utils"
+	"github.com/marten-seemann/qpack"
+)
+
+var errPushLimitReached = errors.New("http3: push limit reached")
+
+// The pushManager keeps track of the pushes on a session.
+// Push IDs are allocated sequentially, starting at 0.
+type pushManager struct {
+	mutex sync.Mutex
+
+	sess quic.Session
+	// maxPromises is the maximum number of pushes the server promises on this session
+	maxPromises uint64
+
+	maxPushIDReceived bool
+	maxPushID         uint64 // the maximum push ID allowed by the client
+	nextPushID        uint64
+
+	streams  map[uint64]quic.SendStream // push streams that are currently open
+	canceled map[uint64]struct{}        // pushes canceled by the client while the push stream was not open
+}
+
+func newPushManager(sess quic.Session, maxPromises int) *pushManager {
+	m := &pushManager{
+		sess:     sess,
+		streams:  make(map[uint64]quic.SendStream),
+		canceled: make(map[uint64]struct{}),
+	}
+	if maxPromises > 0 {
+		m.maxPromises = uint64(maxPromises)
+	}
+	return m
+}
+
+// handleFrame handles the MAX_PUSH_ID and CANCEL_PUSH frames sent by the client.
+func (m *pushManager) handleFrame(f frame) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	switch f := f.(type) {
+	case *maxPushIDFrame:
+		if m.maxPushIDReceived && f.PushID < m.maxPushID {
+			return fmt.Errorf("MAX_PUSH_ID reduced the maximum push ID (from %d to %d)", m.maxPushID, f.PushID)
+		}
+		m.maxPushIDReceived = true
+		m.maxPushID = f.PushID
+	case *cancelPushFrame:
+		if !m.maxPushIDReceived || f.PushID > m.maxPushID {
+			return fmt.Errorf("CANCEL_PUSH for push ID %d, which exceeds the maximum push ID", f.PushID)
+		}
+		if str, ok := m.streams[f.PushID]; ok {
+			str.CancelWrite(quic.ErrorCode(errorRequestCanceled))
+			delete(m.streams, f.PushID)
+			return nil
+		}
+		if f.PushID >= m.nextPushID {
+			// We haven't promised this push (yet), so there's nothing to cancel.
+			return nil
+		}
+		// The push stream wasn't opened yet, or the push was already completed.
+		// Only promised push IDs are recorded, so this map can't grow larger than maxPromises.
+		m.canceled[f.PushID] = struct{}{}
+	default:
+		return fmt.Errorf("unexpected frame: %#v", f)
+	}
+	return nil
+}
+
+// newPushID allocates a new push ID.
+func (m *pushManager) newPushID() (uint64, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if m.maxPromises == 0 || !m.maxPushIDReceived {
+		return 0, http.ErrNotSupported
+	}
+	if m.nextPushID >= m.maxPromises || m.nextPushID > m.maxPushID {
+		return 0, errPushLimitReached
+	}
+	pushID := m.nextPushID
+	m.nextPushID++
+	return pushID, nil
+}
+
+// openStream opens the push stream for a push.
+// It returns nil (and no error) if the push was canceled by the client.
+func (m *pushManager) openStream(pushID uint64) (quic.SendStream, error) {
+	str, err := m.sess.OpenUniStreamSync()
+	if err != nil {
+		return nil, err
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if _, ok := m.canceled[pushID]; ok {
+		delete(m.canceled, pushID)
+		str.CancelWrite(quic.ErrorCode(errorRequestCanceled))
+		return nil, nil
+	}
+	buf := &bytes.Buffer{}
+	utils.WriteVarInt(buf, streamTypePushStream)
+	utils.WriteVarInt(buf, pushID)
+	if _, err := str.Write(buf.Bytes()); err != nil {
+		return nil, err
+	}
+	m.streams[pushID] = str
+	return str, nil
+}
+
+// closeStream is called when the response on a push stream was completely written.
+func (m *pushManager) closeStream(pushID uint64) {
+	m.mutex.Lock()
+	str, ok := m.streams[pushID]
+	delete(m.streams, pushID)
+	m.mutex.Unlock()
+
+	if ok {
+		str.Close()
+	}
+}
+
+// push sends a PUSH_PROMISE on the request stream, and serves the promised request on a push stream.
+// The PUSH_PROMISE is written to w, which buffers the HEADERS and DATA frames written to the request stream.
+func (s *Server) push(pushes *pushManager, w *bufio.Writer, req *http.Request, target string, opts *http.PushOptions) error {
+	if opts == nil {
+		opts = &http.PushOptions{}
+	}
+	method := opts.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+	// Only safe and cacheable methods can be pushed.
+	if method != http.MethodGet && method != http.MethodHead {
+		return fmt.Errorf("http3: method %s is not allowed for pushes", method)
+	}
+	u, err := url.Parse(target)
+	if err != nil {
+		return err
+	}
+	if u.Scheme == "" {
+		if !strings.HasPrefix(target, "/") {
+			return fmt.Errorf("http3: target must be an absolute URL or an absolute path: %q", target)
+		}
+		u.Scheme = "https"
+		u.Host = req.Host
+	} else if u.Scheme != "https" {
+		return fmt.Errorf("http3: cannot push URL with scheme %s", u.Scheme)
+	}
+	if u.Host == "" {
+		return errors.New("http3: URL must have a host")
+	}
+	for k := range opts.Header {
+		if strings.HasPrefix(k, ":") {
+			return fmt.Errorf("http3: promised request headers cannot include pseudo header %q", k)
+		}
+	}
+
+	pushID, err := pushes.newPushID()
+	if err != nil {
+		return err
+	}
+
+	headerBlock := &bytes.Buffer{}
+	enc := qpack.NewEncoder(headerBlock)
+	enc.WriteField(qpack.HeaderField{Name: ":method", Value: method})
+	enc.WriteField(qpack.HeaderField{Name: ":scheme", Value: u.Scheme})
+	enc.WriteField(qpack.HeaderField{Name: ":authority", Value: u.Host})
+	enc.WriteField(qpack.HeaderField{Name: ":path", Value: u.RequestURI()})
+	for k, vv := range opts.Header {
+		for _, v := range vv {
+			enc.WriteField(qpack.HeaderField{Name: strings.ToLower(k), Value: v})
+		}
+	}
+	buf := &bytes.Buffer{}
+	(&pushPromiseFrame{PushID: pushID, Length: uint64(headerBlock.Len())}).Write(buf)
+	buf.Write(headerBlock.Bytes())
+	if _, err := w.Write(buf.Bytes()); err != nil {
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	pushedReq := &http.Request{
+		Method:     method,
+		URL:        u,
+		Proto:      "HTTP/3",
+		ProtoMajor: 3,
+		Header:     opts.Header,
+		Body:       http.NoBody,
+		Host:       u.Host,
+		RequestURI: u.RequestURI(),
+		TLS:        req.TLS,
+		RemoteAddr: req.RemoteAddr,
+	}
+	if pushedReq.Header == nil {
+		pushedReq.Header = http.Header{}
+	}
+	go s.servePush(pushes, pushID, pushedReq)
+	return nil
+}
+
+func (s *Server) servePush(pushes *pushManager, pushID uint64, req *http.Request) {
+	str, err := pushes.openStream(pushID)
+	if err != nil {
+		s.logger.Debugf("Opening push stream for push ID %d failed: %s", pushID, err)
+		return
+	}
+	if str == nil { // the push was canceled by the client
+		return
+	}
+	s.logger.Infof("Pushing %s%s (push ID %d)", req.Host, req.RequestURI, pushID)
+
+	responseWriter := newResponseWriter(str, s.logger)
+	handler := s.Handler
+	if handler == nil {
+		handler = http.DefaultServeMux
+	}
+	var panicked bool
+	func() {
+		defer func() {
+			if p := recover(); p != nil {
+				const size = 64 << 10
+				buf := make([]byte, size)
+				buf = buf[:runtime.Stack(buf, false)]
+				s.logger.Errorf("http: panic serving push: %v\n%s", p, buf)
+				panicked = true
+			}
+		}()
+		handler.ServeHTTP(responseWriter, req.WithContext(str.Context()))
+	}()
+	if panicked {
+		responseWriter.WriteHeader(500)
+	} else {
+		responseWriter.WriteHeader(200)
+		responseWriter.writeTrailers()
+	}
+	responseWriter.Flush()
+	pushes.closeStream(pushID)
+}
@@ -0,0 +1,240 @@
+package http3
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+
+	"github.com/golang/mock/gomock"
+	quic "github.com/lucas-clemente/quic-go"
+	mockquic "github.com/lucas-clemente/quic-go/internal/mocks/quic"
+	"github.com/lucas-clemente/quic-go/internal/utils"
+	"github.com/marten-seemann/qpack"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Server Push", func() {
+	var sess *mockquic.MockSession
+
+	BeforeEach(func() {
+		sess = mockquic.NewMockSession(mockCtrl)
+	})
+
+	Context("managing push IDs", func() {
+		It("doesn't push if push is disabled", func() {
+			m := newPushManager(sess, 0)
+			Expect(m.handleFrame(&maxPushIDFrame{PushID: 10})).To(Succeed())
+			_, err := m.newPushID()
+			Expect(err).To(MatchError(http.ErrNotSupported))
+		})
+
+		It("doesn't push before receiving a MAX_PUSH_ID frame", func() {
+			m := newPushManager(sess, 10)
+			_, err := m.newPushID()
+			Expect(err).To(MatchError(http.ErrNotSupported))
+		})
+
+		It("allocates push IDs up to the maximum push ID", func() {
+			m := newPushManager(sess, 10)
+			Expect(m.handleFrame(&maxPushIDFrame{PushID: 1})).To(Succeed())
+			Expect(m.newPushID()).To(BeEquivalentTo(0))
+			Expect(m.newPushID()).To(BeEquivalentTo(1))
+			_, err := m.newPushID()
+			Expect(err).To(MatchError(errPushLimitReached))
+			Expect(m.handleFrame(&maxPushIDFrame{PushID: 2})).To(Succeed())
+			Expect(m.newPushID()).To(BeEquivalentTo(2))
+		})
+
+		It("doesn't promise more than the configured number of pushes", func() {
+			m := newPushManager(sess, 2)
+			Expect(m.handleFrame(&maxPushIDFrame{PushID: 100})).To(Succeed())
+			Expect(m.newPushID()).To(BeEquivalentTo(0))
+			Expect(m.newPushID()).To(BeEquivalentTo(1))
+			_, err := m.newPushID()
+			Expect(err).To(MatchError(errPushLimitReached))
+		})
+
+		It("rejects MAX_PUSH_ID frames that reduce the maximum push ID", func() {
+			m := newPushManager(sess, 10)
+			Expect(m.handleFrame(&maxPushIDFrame{PushID: 5})).To(Succeed())
+			Expect(m.handleFrame(&maxPushIDFrame{PushID: 4})).To(MatchError("MAX_PUSH_ID reduced the maximum push ID (from 5 to 4)"))
+		})
+
+		It("rejects CANCEL_PUSH frames for push IDs exceeding the maximum push ID", func() {
+			m := newPushManager(sess, 10)
+			Expect(m.handleFrame(&cancelPushFrame{PushID: 0})).To(HaveOccurred())
+			Expect(m.handleFrame(&maxPushIDFrame{PushID: 5})).To(Succeed())
+			Expect(m.handleFrame(&cancelPushFrame{PushID: 6})).To(MatchError("CANCEL_PUSH for push ID 6, which exceeds the maximum push ID"))
+		})
+
+		It("ignores CANCEL_PUSH frames for push IDs that weren't promised", func() {
+			m := newPushManager(sess, 10)
+			Expect(m.handleFrame(&maxPushIDFrame{PushID: 1 << 40})).To(Succeed())
+			for i := uint64(0); i < 100; i++ {
+				Expect(m.handleFrame(&cancelPushFrame{PushID: i << 30})).To(Succeed())
+			}
+			Expect(m.canceled).To(BeEmpty())
+		})
+
+		It("cancels push streams", func() {
+			m := newPushManager(sess, 10)
+			Expect(m.handleFrame(&maxPushIDFrame{PushID: 5})).To(Succeed())
+			Expect(m.newPushID()).To(BeZero())
+			str := mockquic.NewMockStream(mockCtrl)
+			sess.EXPECT().OpenUniStreamSync().Return(str, nil)
+			str.EXPECT().Write([]byte{streamTypePushStream, 0})
+			Expect(m.openStream(0)).To(Equal(str))
+			str.EXPECT().CancelWrite(quic.ErrorCode(errorRequestCanceled))
+			Expect(m.handleFrame(&cancelPushFrame{PushID: 0})).To(Succeed())
+			// the stream is not closed when the response is written
+			m.closeStream(0)
+		})
+
+		It("doesn't open push streams for pushes that were canceled", func() {
+			m := newPushManager(sess, 10)
+			Expect(m.handleFrame(&maxPushIDFrame{PushID: 5})).To(Succeed())
+			Expect(m.newPushID()).To(BeZero())
+			Expect(m.handleFrame(&cancelPushFrame{PushID: 0})).To(Succeed())
+			str := mockquic.NewMockStream(mockCtrl)
+			sess.EXPECT().OpenUniStreamSync().Return(str, nil)
+			str.EXPECT().CancelWrite(quic.ErrorCode(errorRequestCanceled))
+			Expect(m.openStream(0)).To(BeNil())
+		})
+	})
+
+	Context("pushing", func() {
+		var (
+			s      *Server
+			pushes *pushManager
+			reqBuf *bytes.Buffer
+			req    *http.Request
+		)
+
+		decodeHeaders := func(r io.Reader, l uint64) map[string]string {
+			data := make([]byte, l)
+			_, err := io.ReadFull(r, data)
+			Expect(err).ToNot(HaveOccurred())
+			hfs, err := qpack.NewDecoder(nil).DecodeFull(data)
+			Expect(err).ToNot(HaveOccurred())
+			fields := make(map[string]string)
+			for _, hf := range hfs {
+				fields[hf.Name] = hf.Value
+			}
+			return fields
+		}
+
+		BeforeEach(func() {
+			s = &Server{
+				Server: &http.Server{},
+				logger: utils.DefaultLogger,
+			}
+			pushes = newPushManager(sess, 10)
+			Expect(pushes.handleFrame(&maxPushIDFrame{PushID: 10})).To(Succeed())
+			reqBuf = &bytes.Buffer{}
+			var err error
+			req, err = http.NewRequest("GET", "https://www.example.com/index.html", nil)
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		It("sends a PUSH_PROMISE and serves the response on a push stream", func() {
+			s.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				defer GinkgoRecover()
+				Expect(r.Method).To(Equal(http.MethodGet))
+				Expect(r.URL.Path).To(Equal("/style.css"))
+				Expect(r.Host).To(Equal("www.example.com"))
+				Expect(r.Header.Get("Accept-Encoding")).To(Equal("gzip"))
+				w.Write([]byte("body{}"))
+			})
+			pushStr := mockquic.NewMockStream(mockCtrl)
+			pushBuf := &bytes.Buffer{}
+			closed := make(chan struct{})
+			sess.EXPECT().OpenUniStreamSync().Return(pushStr, nil)
+			pushStr.EXPECT().Context().Return(context.Background())
+			pushStr.EXPECT().Write(gomock.Any()).DoAndReturn(pushBuf.Write).AnyTimes()
+			pushStr.EXPECT().Close().Do(func() { close(closed) })
+
+			Expect(s.push(pushes, bufio.NewWriter(reqBuf), req, "/style.css", &http.PushOptions{
+				Header: http.Header{"Accept-Encoding": []string{"gzip"}},
+			})).To(Succeed())
+
+			// check the PUSH_PROMISE frame
+			t, err := utils.ReadVarInt(reqBuf)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(t).To(BeEquivalentTo(0x5))
+			l, err := utils.ReadVarInt(reqBuf)
+			Expect(err).ToNot(HaveOccurred())
+			pushID, err := utils.ReadVarInt(reqBuf)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(pushID).To(BeZero())
+			hfs := decodeHeaders(reqBuf, l-1)
+			Expect(hfs).To(HaveKeyWithValue(":method", "GET"))
+			Expect(hfs).To(HaveKeyWithValue(":scheme", "https"))
+			Expect(hfs).To(HaveKeyWithValue(":authority", "www.example.com"))
+			Expect(hfs).To(HaveKeyWithValue(":path", "/style.css"))
+			Expect(hfs).To(HaveKeyWithValue("accept-encoding", "gzip"))
+
+			// check the push stream
+			Eventually(closed).Should(BeClosed())
+			streamType, err := utils.ReadVarInt(pushBuf)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(streamType).To(BeEquivalentTo(streamTypePushStream))
+			pushID, err = utils.ReadVarInt(pushBuf)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(pushID).To(BeZero())
+			f, err := parseNextFrame(pushBuf)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(f).To(BeAssignableToTypeOf(&headersFrame{}))
+			Expect(decodeHeaders(pushBuf, f.(*headersFrame).Length)).To(HaveKeyWithValue(":status", "200"))
+			f, err = parseNextFrame(pushBuf)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(f).To(Equal(&dataFrame{Length: 6}))
+			Expect(pushBuf.Bytes()).To(Equal([]byte("body{}")))
+		})
+
+		It("pushes absolute URLs", func() {
+			s.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+			pushStr := mockquic.NewMockStream(mockCtrl)
+			closed := make(chan struct{})
+			sess.EXPECT().OpenUniStreamSync().Return(pushStr, nil)
+			pushStr.EXPECT().Context().Return(context.Background())
+			pushStr.EXPECT().Write(gomock.Any()).AnyTimes()
+			pushStr.EXPECT().Close().Do(func() { close(closed) })
+			Expect(s.push(pushes, bufio.NewWriter(reqBuf), req, "https://static.example.com/main.js?v=2", nil)).To(Succeed())
+			_, err := utils.ReadVarInt(reqBuf) // type
+			Expect(err).ToNot(HaveOccurred())
+			l, err := utils.ReadVarInt(reqBuf)
+			Expect(err).ToNot(HaveOccurred())
+			_, err = utils.ReadVarInt(reqBuf) // push ID
+			Expect(err).ToNot(HaveOccurred())
+			hfs := decodeHeaders(reqBuf, l-1)
+			Expect(hfs).To(HaveKeyWithValue(":authority", "static.example.com"))
+			Expect(hfs).To(HaveKeyWithValue(":path", "/main.js?v=2"))
+			Eventually(closed).Should(BeClosed())
+		})
+
+		It("refuses to push requests with a body", func() {
+			err := s.push(pushes, bufio.NewWriter(reqBuf), req, "/upload", &http.PushOptions{Method: http.MethodPost})
+			Expect(err).To(MatchError("http3: method POST is not allowed for pushes"))
+			Expect(reqBuf.Len()).To(BeZero())
+		})
+
+		It("refuses to push relative paths", func() {
+			err := s.push(pushes, bufio.NewWriter(reqBuf), req, "style.css", nil)
+			Expect(err).To(MatchError(`http3: target must be an absolute URL or an absolute path: "style.css"`))
+		})
+
+		It("refuses to push URLs with a different scheme", func() {
+			err := s.push(pushes, bufio.NewWriter(reqBuf), req, "http://www.example.com/style.css", nil)
+			Expect(err).To(MatchError("http3: cannot push URL with scheme http"))
+		})
+
+		It("returns an error if pushing is not supported", func() {
+			rw := newResponseWriter(&bytes.Buffer{}, utils.DefaultLogger)
+			Expect(rw.Push("/style.css", nil)).To(MatchError(http.ErrNotSupported))
+		})
+	})
+})
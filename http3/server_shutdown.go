@@ -0,0 +1,156 @@
+package http3
+
+import (
+	"bytes"
+	"context"
+	"sync"
+
+	quic "github.com/lucas-clemente/quic-go"
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+	"github.com/lucas-clemente/quic-go/internal/utils"
+)
+
+// A serverSession keeps track of the request streams accepted on a session,
+// such that the session can be shut down gracefully.
+type serverSession struct {
+	mutex sync.Mutex
+
+	logger utils.Logger
+
+	controlStr quic.SendStream // nil until the control stream was opened
+
+	// nextStreamID is the lowest stream ID that wasn't accepted yet
+	nextStreamID protocol.StreamID
+
+	goingAway bool
+	// goAwayStreamID is the stream ID sent in the GOAWAY frame.
+	// Requests on this and higher stream IDs are rejected.
+	goAwayStreamID protocol.StreamID
+	goAwaySent     bool
+}
+
+func newServerSession(logger utils.Logger) *serverSession {
+	return &serverSession{logger: logger}
+}
+
+// setControlStream is called once the control stream has been opened.
+// If the session is already going away, the GOAWAY frame is sent on it.
+func (s *serverSession) setControlStream(str quic.SendStream) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.controlStr = str
+	s.maybeSendGoAway()
+}
+
+// acceptRequest is called for every request stream accepted.
+// It returns false if the request must be rejected, because the stream ID exceeds the limit sent in the GOAWAY frame.
+func (s *serverSession) acceptRequest(id protocol.StreamID) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.goingAway && id >= s.goAwayStreamID {
+		return false
+	}
+	if id >= s.nextStreamID {
+		s.nextStreamID = id + 4
+	}
+	return true
+}
+
+// goAway initiates a graceful shutdown of the session.
+// All requests accepted so far are served, later requests are rejected.
+// The session is not closed: the client closes it once it doesn't need it any more.
+// Closing it here could cut off responses that haven't been completely sent yet.
+func (s *serverSession) goAway() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.goingAway {
+		return
+	}
+	s.goingAway = true
+	s.goAwayStreamID = s.nextStreamID
+	s.maybeSendGoAway()
+}
+
+// maybeSendGoAway sends the GOAWAY frame, if the session is going away and the control stream was opened.
+// It must be called with the mutex held.
+func (s *serverSession) maybeSendGoAway() {
+	if !s.goingAway || s.goAwaySent || s.controlStr == nil {
+		return
+	}
+	s.goAwaySent = true
+	buf := &bytes.Buffer{}
+	(&goAwayFrame{StreamID: s.goAwayStreamID}).Write(buf)
+	if _, err := s.controlStr.Write(buf.Bytes()); err != nil {
+		s.logger.Debugf("Sending GOAWAY failed: %s", err)
+	}
+}
+
+// Shutdown gracefully shuts down the server.
+// It stops accepting new sessions and sends a GOAWAY frame on all sessions.
+// Requests that were received before the GOAWAY are served, later requests are rejected.
+// Clients close the session once they have received all responses.
+// Shutdown waits until all sessions have been closed, or until the context is canceled.
+// In that case, the remaining sessions are closed, and the context's error is returned.
+// Shutdown in combination with ListenAndServe() (instead of Serve()) may race if it is called before a UDP socket is established.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.listenerMutex.Lock()
+	s.closed = true
+	listeners := s.listeners
+	s.listeners = nil
+	s.generateAltSvcHeader()
+	sessions := make([]*serverSession, 0, len(s.sessions))
+	for sess := range s.sessions {
+		sessions = append(sessions, sess)
+	}
+	s.listenerMutex.Unlock()
+
+	if len(listeners) == 0 {
+		return nil
+	}
+	for _, sess := range sessions {
+		sess.goAway()
+	}
+	var err error
+	for _, ln := range listeners {
+		if serr := ln.Shutdown(ctx); serr != nil && err == nil {
+			err = serr
+		}
+	}
+	return err
+}
+
+// goAway marks the server as closed, and sends a GOAWAY frame on all sessions.
+// It is used by the MuxListener, which passes sessions to the server without a listener.
+func (s *Server) goAway() {
+	s.listenerMutex.Lock()
+	s.closed = true
+	sessions := make([]*serverSession, 0, len(s.sessions))
+	for sess := range s.sessions {
+		sessions = append(sessions, sess)
+	}
+	s.listenerMutex.Unlock()
+
+	for _, sess := range sessions {
+		sess.goAway()
+	}
+}
+
+func (s *Server) addSession(sess *serverSession) {
+	s.listenerMutex.Lock()
+	if s.sessions == nil {
+		s.sessions = make(map[*serverSession]struct{})
+	}
+	s.sessions[sess] = struct{}{}
+	goAway := s.closed
+	s.listenerMutex.Unlock()
+	// The session was accepted after Shutdown was called.
+	if goAway {
+		sess.goAway()
+	}
+}
+
+func (s *Server) removeSession(sess *serverSession) {
+	s.listenerMutex.Lock()
+	delete(s.sessions, sess)
+	s.listenerMutex.Unlock()
+}
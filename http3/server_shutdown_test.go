@@ -0,0 +1,113 @@
+package http3
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+
+	"github.com/golang/mock/gomock"
+	quic "github.com/lucas-clemente/quic-go"
+	mockquic "github.com/lucas-clemente/quic-go/internal/mocks/quic"
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+	"github.com/lucas-clemente/quic-go/internal/utils"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// shutdownListener is a quic.Listener that records calls to Shutdown
+type shutdownListener struct {
+	quic.Listener
+	shutdownCalled chan context.Context
+}
+
+func (l *shutdownListener) Shutdown(ctx context.Context) error {
+	l.shutdownCalled <- ctx
+	return nil
+}
+
+var _ = Describe("Server Shutdown", func() {
+	var controlStr *mockquic.MockStream
+
+	goAway := func(id protocol.StreamID) []byte {
+		buf := &bytes.Buffer{}
+		(&goAwayFrame{StreamID: id}).Write(buf)
+		return buf.Bytes()
+	}
+
+	BeforeEach(func() {
+		controlStr = mockquic.NewMockStream(mockCtrl)
+	})
+
+	Context("sending GOAWAY", func() {
+		It("sends the ID of the next stream, and rejects requests on higher streams", func() {
+			sess := newServerSession(utils.DefaultLogger)
+			sess.setControlStream(controlStr)
+			Expect(sess.acceptRequest(0)).To(BeTrue())
+			Expect(sess.acceptRequest(8)).To(BeTrue())
+			Expect(sess.acceptRequest(4)).To(BeTrue())
+			controlStr.EXPECT().Write(goAway(12))
+			sess.goAway()
+			Expect(sess.acceptRequest(12)).To(BeFalse())
+			Expect(sess.acceptRequest(16)).To(BeFalse())
+		})
+
+		It("sends a GOAWAY with stream ID 0 if no request was received", func() {
+			sess := newServerSession(utils.DefaultLogger)
+			sess.setControlStream(controlStr)
+			controlStr.EXPECT().Write(goAway(0))
+			sess.goAway()
+			Expect(sess.acceptRequest(0)).To(BeFalse())
+		})
+
+		It("sends the GOAWAY once the control stream is opened", func() {
+			sess := newServerSession(utils.DefaultLogger)
+			Expect(sess.acceptRequest(0)).To(BeTrue())
+			sess.goAway()
+			controlStr.EXPECT().Write(goAway(4))
+			sess.setControlStream(controlStr)
+		})
+
+		It("only sends a single GOAWAY", func() {
+			sess := newServerSession(utils.DefaultLogger)
+			sess.setControlStream(controlStr)
+			controlStr.EXPECT().Write(gomock.Any())
+			sess.goAway()
+			sess.goAway()
+		})
+	})
+
+	Context("shutting down", func() {
+		var s *Server
+
+		BeforeEach(func() {
+			s = &Server{
+				Server: &http.Server{},
+				logger: utils.DefaultLogger,
+			}
+		})
+
+		It("sends a GOAWAY on all sessions and shuts down the listener", func() {
+			ln := &shutdownListener{shutdownCalled: make(chan context.Context, 1)}
+			s.listeners = []quic.Listener{ln}
+			sess := newServerSession(utils.DefaultLogger)
+			sess.setControlStream(controlStr)
+			s.addSession(sess)
+			controlStr.EXPECT().Write(goAway(0))
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			Expect(s.Shutdown(ctx)).To(Succeed())
+			Expect(ln.shutdownCalled).To(Receive(Equal(ctx)))
+			Expect(s.ListenAndServe()).To(MatchError("Server is already closed"))
+		})
+
+		It("sends a GOAWAY on sessions accepted after Shutdown was called", func() {
+			s.listeners = []quic.Listener{&shutdownListener{shutdownCalled: make(chan context.Context, 1)}}
+			Expect(s.Shutdown(context.Background())).To(Succeed())
+			sess := newServerSession(utils.DefaultLogger)
+			sess.setControlStream(controlStr)
+			controlStr.EXPECT().Write(goAway(0))
+			s.addSession(sess)
+		})
+	})
+})
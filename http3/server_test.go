@@ -7,6 +7,8 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
+	"net"
 	"net/http"
 	"strings"
 	"time"
@@ -46,7 +48,7 @@ var _ = Describe("Server", func() {
 
 	Context("handling requests", func() {
 		var (
-			qpackDecoder       *qpack.Decoder
+			sess               *mockquic.MockSession
 			str                *mockquic.MockStream
 			exampleGetRequest  *http.Request
 			examplePostRequest *http.Request
@@ -103,8 +105,13 @@ var _ = Describe("Server", func() {
 			examplePostRequest, err = http.NewRequest("POST", "https://www.example.com", bytes.NewReader([]byte("foobar")))
 			Expect(err).ToNot(HaveOccurred())
 
-			qpackDecoder = qpack.NewDecoder(nil)
 			str = mockquic.NewMockStream(mockCtrl)
+			sess = mockquic.NewMockSession(mockCtrl)
+			sess.EXPECT().ConnectionState().Return(tls.ConnectionState{NegotiatedProtocol: nextProtoH3}).AnyTimes()
+			sess.EXPECT().ConnectionStats().Return(quic.ConnectionStats{SmoothedRTT: 42 * time.Millisecond}).AnyTimes()
+			sess.EXPECT().ConnectionID().Return("deadbeef").AnyTimes()
+			sess.EXPECT().LocalAddr().Return(&net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 443}).AnyTimes()
+			sess.EXPECT().RemoteAddr().Return(&net.UDPAddr{IP: net.IPv4(192, 168, 0, 1), Port: 1337}).AnyTimes()
 		})
 
 		It("calls the HTTP handler function", func() {
@@ -119,12 +126,100 @@ var _ = Describe("Server", func() {
 				return len(p), nil
 			}).AnyTimes()
 
-			Expect(s.handleRequest(str, qpackDecoder)).To(Succeed())
+			Expect(s.handleRequest(sess, str, nil, nil)).To(Succeed())
 			var req *http.Request
 			Eventually(requestChan).Should(Receive(&req))
 			Expect(req.Host).To(Equal("www.example.com"))
 		})
 
+		It("exposes the connection state to the handler", func() {
+			requestChan := make(chan *http.Request, 1)
+			s.Handler = http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+				requestChan <- r
+			})
+
+			setRequest(encodeRequest(exampleGetRequest))
+			str.EXPECT().Context().Return(reqContext)
+			str.EXPECT().Write(gomock.Any()).AnyTimes()
+
+			Expect(s.handleRequest(sess, str, nil, nil)).To(Succeed())
+			var req *http.Request
+			Eventually(requestChan).Should(Receive(&req))
+			// the fields set by net/http
+			Expect(req.TLS).ToNot(BeNil())
+			Expect(req.TLS.NegotiatedProtocol).To(Equal(nextProtoH3))
+			Expect(req.RemoteAddr).To(Equal("192.168.0.1:1337"))
+			Expect(req.Context().Value(http.ServerContextKey)).To(Equal(s.Server))
+			Expect(req.Context().Value(http.LocalAddrContextKey)).To(Equal(&net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 443}))
+			// the QUIC connection state
+			state, ok := ServerConnectionState(req.Context())
+			Expect(ok).To(BeTrue())
+			Expect(state.TLS.NegotiatedProtocol).To(Equal(nextProtoH3))
+			Expect(state.Stats.SmoothedRTT).To(Equal(42 * time.Millisecond))
+			Expect(state.ConnectionID).To(Equal("deadbeef"))
+			Expect(state.RemoteAddr).To(Equal(&net.UDPAddr{IP: net.IPv4(192, 168, 0, 1), Port: 1337}))
+			_, ok = ServerConnectionState(context.Background())
+			Expect(ok).To(BeFalse())
+		})
+
+		Context("priorities", func() {
+			var requestChan chan *http.Request
+
+			BeforeEach(func() {
+				requestChan = make(chan *http.Request, 1)
+				s.Handler = http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+					requestChan <- r
+				})
+			})
+
+			newPriorityRequest := func(priority string) *http.Request {
+				req, err := http.NewRequest(http.MethodGet, "https://www.example.com", nil)
+				Expect(err).ToNot(HaveOccurred())
+				req.Header.Set("Priority", priority)
+				return req
+			}
+
+			It("applies the priority signaled by the client to the response stream", func() {
+				setRequest(encodeRequest(newPriorityRequest("u=1, i")))
+				str.EXPECT().Context().Return(reqContext)
+				str.EXPECT().Write(gomock.Any()).AnyTimes()
+				str.EXPECT().SetPriority(uint8(1), true)
+
+				Expect(s.handleRequest(sess, str, nil, nil)).To(Succeed())
+				var req *http.Request
+				Eventually(requestChan).Should(Receive(&req))
+				prio, ok := PriorityFromContext(req.Context())
+				Expect(ok).To(BeTrue())
+				Expect(prio).To(Equal(Priority{Urgency: 1, Incremental: true}))
+			})
+
+			It("doesn't apply the priority if IgnorePriority is set", func() {
+				s.IgnorePriority = true
+				setRequest(encodeRequest(newPriorityRequest("u=1")))
+				str.EXPECT().Context().Return(reqContext)
+				str.EXPECT().Write(gomock.Any()).AnyTimes()
+
+				Expect(s.handleRequest(sess, str, nil, nil)).To(Succeed())
+				var req *http.Request
+				Eventually(requestChan).Should(Receive(&req))
+				prio, ok := PriorityFromContext(req.Context())
+				Expect(ok).To(BeTrue())
+				Expect(prio).To(Equal(Priority{Urgency: 1}))
+			})
+
+			It("doesn't set a priority if the client didn't signal one", func() {
+				setRequest(encodeRequest(exampleGetRequest))
+				str.EXPECT().Context().Return(reqContext)
+				str.EXPECT().Write(gomock.Any()).AnyTimes()
+
+				Expect(s.handleRequest(sess, str, nil, nil)).To(Succeed())
+				var req *http.Request
+				Eventually(requestChan).Should(Receive(&req))
+				_, ok := PriorityFromContext(req.Context())
+				Expect(ok).To(BeFalse())
+			})
+		})
+
 		It("returns 200 with an empty handler", func() {
 			s.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
 
@@ -135,9 +230,102 @@ var _ = Describe("Server", func() {
 				return responseBuf.Write(p)
 			}).AnyTimes()
 
-			Expect(s.handleRequest(str, qpackDecoder)).To(Succeed())
+			Expect(s.handleRequest(sess, str, nil, nil)).To(Succeed())
+			hfs := decodeHeader(responseBuf)
+			Expect(hfs).To(HaveKeyWithValue(":status", []string{"200"}))
+		})
+
+		It("sends flushed data before the handler returns", func() {
+			eventReceived := make(chan struct{})
+			s.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/event-stream")
+				w.Write([]byte("data: first event\n\n"))
+				w.(http.Flusher).Flush()
+				<-eventReceived
+				w.Write([]byte("data: second event\n\n"))
+			})
+
+			responseChan := make(chan []byte, 10)
+			setRequest(encodeRequest(exampleGetRequest))
+			str.EXPECT().Context().Return(reqContext)
+			str.EXPECT().Write(gomock.Any()).DoAndReturn(func(p []byte) (int, error) {
+				b := make([]byte, len(p))
+				copy(b, p)
+				responseChan <- b
+				return len(p), nil
+			}).AnyTimes()
+
+			done := make(chan struct{})
+			go func() {
+				defer GinkgoRecover()
+				defer close(done)
+				Expect(s.handleRequest(sess, str, nil, nil)).To(Succeed())
+			}()
+
+			var data []byte
+			Eventually(responseChan).Should(Receive(&data))
+			responseBuf := bytes.NewBuffer(data)
+			hfs := decodeHeader(responseBuf)
+			Expect(hfs).To(HaveKeyWithValue(":status", []string{"200"}))
+			Expect(hfs).To(HaveKeyWithValue("content-type", []string{"text/event-stream"}))
+			f, err := parseNextFrame(responseBuf)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(f).To(Equal(&dataFrame{Length: 19}))
+			Expect(responseBuf.String()).To(Equal("data: first event\n\n"))
+			Consistently(done).ShouldNot(BeClosed())
+			close(eventReceived)
+			Eventually(done).Should(BeClosed())
+		})
+
+		It("delivers request trailers to the handler", func() {
+			handlerCalled := make(chan struct{})
+			s.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				defer GinkgoRecover()
+				defer close(handlerCalled)
+				// the values are only available once the body was read
+				Expect(r.Trailer).To(Equal(http.Header{"Grpc-Status": nil}))
+				data, err := ioutil.ReadAll(r.Body)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(data).To(Equal([]byte("foobar")))
+				Expect(r.Trailer).To(Equal(http.Header{"Grpc-Status": []string{"0"}}))
+			})
+
+			examplePostRequest.ContentLength = -1 // send a chunked body
+			examplePostRequest.Trailer = http.Header{"Grpc-Status": []string{"0"}}
+			setRequest(encodeRequest(examplePostRequest))
+			str.EXPECT().Context().Return(reqContext)
+			str.EXPECT().Write(gomock.Any()).DoAndReturn(func(p []byte) (int, error) {
+				return len(p), nil
+			}).AnyTimes()
+
+			Expect(s.handleRequest(sess, str, nil, nil)).To(Succeed())
+			Expect(handlerCalled).To(BeClosed())
+		})
+
+		It("sends response trailers", func() {
+			s.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Trailer", "Grpc-Status")
+				w.Write([]byte("foobar"))
+				w.Header().Set("Grpc-Status", "0")
+			})
+
+			responseBuf := &bytes.Buffer{}
+			setRequest(encodeRequest(exampleGetRequest))
+			str.EXPECT().Context().Return(reqContext)
+			str.EXPECT().Write(gomock.Any()).DoAndReturn(func(p []byte) (int, error) {
+				return responseBuf.Write(p)
+			}).AnyTimes()
+
+			Expect(s.handleRequest(sess, str, nil, nil)).To(Succeed())
 			hfs := decodeHeader(responseBuf)
 			Expect(hfs).To(HaveKeyWithValue(":status", []string{"200"}))
+			Expect(hfs).To(HaveKeyWithValue("trailer", []string{"Grpc-Status"}))
+			f, err := parseNextFrame(responseBuf)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(f).To(Equal(&dataFrame{Length: 6}))
+			responseBuf.Next(6)
+			Expect(decodeHeader(responseBuf)).To(Equal(map[string][]string{"grpc-status": {"0"}}))
+			Expect(responseBuf.Len()).To(BeZero())
 		})
 
 		It("handles a panicking handler", func() {
@@ -153,7 +341,7 @@ var _ = Describe("Server", func() {
 			}).AnyTimes()
 			str.EXPECT().CancelRead(gomock.Any())
 
-			Expect(s.handleRequest(str, qpackDecoder)).To(Succeed())
+			Expect(s.handleRequest(sess, str, nil, nil)).To(Succeed())
 			hfs := decodeHeader(responseBuf)
 			Expect(hfs).To(HaveKeyWithValue(":status", []string{"500"}))
 		})
@@ -176,7 +364,7 @@ var _ = Describe("Server", func() {
 			}).AnyTimes()
 			str.EXPECT().CancelRead(quic.ErrorCode(errorEarlyResponse))
 
-			Expect(s.handleRequest(str, qpackDecoder)).To(Succeed())
+			Expect(s.handleRequest(sess, str, nil, nil)).To(Succeed())
 			hfs := decodeHeader(responseBuf)
 			Expect(hfs).To(HaveKeyWithValue(":status", []string{"200"}))
 		})
@@ -196,7 +384,7 @@ var _ = Describe("Server", func() {
 			}).AnyTimes()
 			str.EXPECT().CancelRead(quic.ErrorCode(errorEarlyResponse))
 
-			Expect(s.handleRequest(str, qpackDecoder)).To(Succeed())
+			Expect(s.handleRequest(sess, str, nil, nil)).To(Succeed())
 			Eventually(handlerCalled).Should(BeClosed())
 		})
 
@@ -210,7 +398,7 @@ var _ = Describe("Server", func() {
 			str.EXPECT().Read(gomock.Any()).Return(0, testErr)
 			str.EXPECT().CancelWrite(quic.ErrorCode(errorRequestCanceled))
 
-			Expect(s.handleRequest(str, qpackDecoder)).To(MatchError(testErr))
+			Expect(s.handleRequest(sess, str, nil, nil)).To(MatchError(testErr))
 			Consistently(handlerCalled).ShouldNot(BeClosed())
 		})
 
@@ -231,10 +419,338 @@ var _ = Describe("Server", func() {
 			}).AnyTimes()
 			str.EXPECT().CancelRead(quic.ErrorCode(errorEarlyResponse))
 
-			Expect(s.handleRequest(str, qpackDecoder)).To(Succeed())
+			Expect(s.handleRequest(sess, str, nil, nil)).To(Succeed())
 			Eventually(handlerCalled).Should(BeClosed())
 		})
 
+		Context("Expect: 100-continue", func() {
+			BeforeEach(func() {
+				examplePostRequest.Header.Set("Expect", "100-continue")
+			})
+
+			It("sends a 100 Continue when the handler reads the body", func() {
+				s.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					defer GinkgoRecover()
+					Expect(r.Header).ToNot(HaveKey("Expect"))
+					data, err := ioutil.ReadAll(r.Body)
+					Expect(err).ToNot(HaveOccurred())
+					Expect(data).To(Equal([]byte("foobar")))
+				})
+
+				responseBuf := &bytes.Buffer{}
+				setRequest(encodeRequest(examplePostRequest))
+				str.EXPECT().Context().Return(reqContext)
+				str.EXPECT().Write(gomock.Any()).DoAndReturn(func(p []byte) (int, error) {
+					return responseBuf.Write(p)
+				}).AnyTimes()
+
+				Expect(s.handleRequest(sess, str, nil, nil)).To(Succeed())
+				Expect(decodeHeader(responseBuf)).To(Equal(map[string][]string{":status": {"100"}}))
+				hfs := decodeHeader(responseBuf)
+				Expect(hfs).To(HaveKeyWithValue(":status", []string{"200"}))
+			})
+
+			It("doesn't send a 100 Continue when the handler responds without reading the body", func() {
+				s.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					w.WriteHeader(http.StatusForbidden)
+				})
+
+				responseBuf := &bytes.Buffer{}
+				setRequest(encodeRequest(examplePostRequest))
+				str.EXPECT().Context().Return(reqContext)
+				str.EXPECT().Write(gomock.Any()).DoAndReturn(func(p []byte) (int, error) {
+					return responseBuf.Write(p)
+				}).AnyTimes()
+				str.EXPECT().CancelRead(quic.ErrorCode(errorEarlyResponse))
+
+				Expect(s.handleRequest(sess, str, nil, nil)).To(Succeed())
+				hfs := decodeHeader(responseBuf)
+				Expect(hfs).To(HaveKeyWithValue(":status", []string{"403"}))
+				Expect(responseBuf.Len()).To(BeZero())
+			})
+
+			It("rejects unsupported expectations", func() {
+				examplePostRequest.Header.Set("Expect", "something-else")
+				var handlerCalled bool
+				s.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					handlerCalled = true
+				})
+
+				responseBuf := &bytes.Buffer{}
+				setRequest(encodeRequest(examplePostRequest))
+				str.EXPECT().Write(gomock.Any()).DoAndReturn(func(p []byte) (int, error) {
+					return responseBuf.Write(p)
+				}).AnyTimes()
+				str.EXPECT().CancelRead(quic.ErrorCode(errorEarlyResponse))
+
+				Expect(s.handleRequest(sess, str, nil, nil)).To(Succeed())
+				hfs := decodeHeader(responseBuf)
+				Expect(hfs).To(HaveKeyWithValue(":status", []string{"417"}))
+				Expect(handlerCalled).To(BeFalse())
+			})
+		})
+
+		Context("CONNECT requests", func() {
+			It("handles CONNECT requests", func() {
+				s.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					defer GinkgoRecover()
+					Expect(r.Method).To(Equal(http.MethodConnect))
+					Expect(r.Host).To(Equal("www.example.com:443"))
+					Expect(r.URL.Host).To(Equal("www.example.com:443"))
+					Expect(r.RequestURI).To(Equal("www.example.com:443"))
+					w.WriteHeader(http.StatusOK)
+					w.(http.Flusher).Flush()
+					data, err := ioutil.ReadAll(r.Body)
+					Expect(err).ToNot(HaveOccurred())
+					w.Write(bytes.ToUpper(data))
+				})
+
+				req, err := http.NewRequest(http.MethodConnect, "https://proxy.example.com", nil)
+				Expect(err).ToNot(HaveOccurred())
+				req.Host = "www.example.com:443"
+				buf := bytes.NewBuffer(encodeRequest(req))
+				(&dataFrame{Length: 6}).Write(buf)
+				buf.Write([]byte("foobar"))
+				setRequest(buf.Bytes())
+				responseBuf := &bytes.Buffer{}
+				str.EXPECT().Context().Return(reqContext)
+				str.EXPECT().Write(gomock.Any()).DoAndReturn(responseBuf.Write).AnyTimes()
+
+				Expect(s.handleRequest(sess, str, nil, nil)).To(Succeed())
+				hfs := decodeHeader(responseBuf)
+				Expect(hfs).To(HaveKeyWithValue(":status", []string{"200"}))
+				f, err := parseNextFrame(responseBuf)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(f).To(Equal(&dataFrame{Length: 6}))
+				Expect(responseBuf.String()).To(Equal("FOOBAR"))
+			})
+
+			It("rejects CONNECT requests that contain a :path", func() {
+				headerBuf := &bytes.Buffer{}
+				enc := qpack.NewEncoder(headerBuf)
+				enc.WriteField(qpack.HeaderField{Name: ":method", Value: http.MethodConnect})
+				enc.WriteField(qpack.HeaderField{Name: ":authority", Value: "www.example.com:443"})
+				enc.WriteField(qpack.HeaderField{Name: ":path", Value: "/"})
+				buf := &bytes.Buffer{}
+				(&headersFrame{Length: uint64(headerBuf.Len())}).Write(buf)
+				buf.Write(headerBuf.Bytes())
+				setRequest(buf.Bytes())
+				Expect(s.handleRequest(sess, str, nil, nil)).To(MatchError(":path must be empty and :authority must not be empty for CONNECT requests"))
+			})
+		})
+
+		Context("WebTransport", func() {
+			var webTransport *webTransportManager
+
+			BeforeEach(func() {
+				webTransport = newWebTransportManager(sess, utils.DefaultLogger)
+				str.EXPECT().StreamID().Return(protocol.StreamID(4)).AnyTimes()
+			})
+
+			encodeExtendedConnectRequest := func(path string) []byte {
+				req, err := http.NewRequest(http.MethodConnect, "https://www.example.com"+path, nil)
+				Expect(err).ToNot(HaveOccurred())
+				req.Header.Set(":protocol", webTransportProtocol)
+				return encodeRequest(req)
+			}
+
+			It("establishes sessions", func() {
+				requestChan := make(chan *http.Request, 1)
+				sessChan := make(chan *WebTransportSession, 1)
+				s.HandleWebTransport("/webtransport", func(wsess *WebTransportSession, r *http.Request) {
+					requestChan <- r
+					sessChan <- wsess
+				})
+
+				// The client keeps the CONNECT stream open until it closes the session.
+				data := bytes.NewBuffer(encodeExtendedConnectRequest("/webtransport"))
+				closeSession := make(chan struct{})
+				str.EXPECT().Read(gomock.Any()).DoAndReturn(func(p []byte) (int, error) {
+					if data.Len() == 0 {
+						<-closeSession
+						return 0, io.EOF
+					}
+					return data.Read(p)
+				}).AnyTimes()
+				str.EXPECT().Context().Return(reqContext)
+				responseBuf := &bytes.Buffer{}
+				str.EXPECT().Write(gomock.Any()).DoAndReturn(responseBuf.Write).AnyTimes()
+
+				Expect(s.handleRequest(sess, str, nil, webTransport)).To(MatchError(errHijacked))
+				hfs := decodeHeader(responseBuf)
+				Expect(hfs).To(HaveKeyWithValue(":status", []string{"200"}))
+				var req *http.Request
+				Expect(requestChan).To(Receive(&req))
+				Expect(req.Method).To(Equal(http.MethodConnect))
+				Expect(req.Host).To(Equal("www.example.com"))
+				Expect(req.URL.Path).To(Equal("/webtransport"))
+				Expect(req.Header.Get(":protocol")).To(Equal(webTransportProtocol))
+				var wsess *WebTransportSession
+				Expect(sessChan).To(Receive(&wsess))
+				_, ok := webTransport.getSession(4)
+				Expect(ok).To(BeTrue())
+
+				// the client closes the session
+				str.EXPECT().CancelRead(quic.ErrorCode(errorNoError))
+				str.EXPECT().Close()
+				close(closeSession)
+				Eventually(wsess.Context().Done()).Should(BeClosed())
+				Expect(req.Context().Done()).To(BeClosed())
+			})
+
+			It("rejects sessions for paths without a handler", func() {
+				s.HandleWebTransport("/webtransport", func(*WebTransportSession, *http.Request) {
+					Fail("handler should not be called")
+				})
+				setRequest(encodeExtendedConnectRequest("/foobar"))
+				str.EXPECT().Context().Return(reqContext)
+				responseBuf := &bytes.Buffer{}
+				str.EXPECT().Write(gomock.Any()).DoAndReturn(responseBuf.Write).AnyTimes()
+				str.EXPECT().CancelRead(quic.ErrorCode(errorEarlyResponse))
+
+				Expect(s.handleRequest(sess, str, nil, webTransport)).To(Succeed())
+				hfs := decodeHeader(responseBuf)
+				Expect(hfs).To(HaveKeyWithValue(":status", []string{"404"}))
+				_, ok := webTransport.getSession(4)
+				Expect(ok).To(BeFalse())
+			})
+
+			It("rejects extended CONNECT requests if WebTransport is disabled", func() {
+				setRequest(encodeExtendedConnectRequest("/webtransport"))
+				str.EXPECT().Context().Return(reqContext)
+				responseBuf := &bytes.Buffer{}
+				str.EXPECT().Write(gomock.Any()).DoAndReturn(responseBuf.Write).AnyTimes()
+				str.EXPECT().CancelRead(quic.ErrorCode(errorEarlyResponse))
+
+				Expect(s.handleRequest(sess, str, nil, nil)).To(Succeed())
+				hfs := decodeHeader(responseBuf)
+				Expect(hfs).To(HaveKeyWithValue(":status", []string{"501"}))
+			})
+
+			It("passes streams to the WebTransport session", func() {
+				requestStr := mockquic.NewMockStream(mockCtrl)
+				requestStr.EXPECT().StreamID().Return(protocol.StreamID(8)).AnyTimes()
+				wsess := webTransport.addSession(requestStr, nil)
+				buf := &bytes.Buffer{}
+				(&webTransportStreamFrame{SessionID: 8}).Write(buf)
+				setRequest(buf.Bytes())
+
+				Expect(s.handleRequest(sess, str, nil, webTransport)).To(MatchError(errHijacked))
+				Expect(wsess.AcceptStream()).To(Equal(str))
+			})
+
+			It("rejects streams starting with a WEBTRANSPORT_STREAM frame, if WebTransport is disabled", func() {
+				buf := &bytes.Buffer{}
+				(&webTransportStreamFrame{SessionID: 8}).Write(buf)
+				setRequest(buf.Bytes())
+				str.EXPECT().CancelWrite(quic.ErrorCode(errorUnexpectedFrame))
+
+				Expect(s.handleRequest(sess, str, nil, nil)).To(MatchError("expected first frame to be a headers frame"))
+			})
+		})
+
+		Context("limiting the header size", func() {
+			var requestData []byte
+
+			// headerListSize calculates the size of the header list, as defined for SETTINGS_MAX_HEADER_LIST_SIZE
+			headerListSize := func(data []byte) int {
+				r := bytes.NewReader(data)
+				frame, err := parseNextFrame(r)
+				Expect(err).ToNot(HaveOccurred())
+				headerBlock := make([]byte, frame.(*headersFrame).Length)
+				_, err = io.ReadFull(r, headerBlock)
+				Expect(err).ToNot(HaveOccurred())
+				hfs, err := qpack.NewDecoder(nil).DecodeFull(headerBlock)
+				Expect(err).ToNot(HaveOccurred())
+				var size int
+				for _, hf := range hfs {
+					size += len(hf.Name) + len(hf.Value) + 32
+				}
+				return size
+			}
+
+			BeforeEach(func() {
+				exampleGetRequest.Header.Set("foo", strings.Repeat("a", 1000))
+				requestData = encodeRequest(exampleGetRequest)
+			})
+
+			It("accepts a request with headers just under the limit", func() {
+				s.Server.MaxHeaderBytes = headerListSize(requestData)
+				requestChan := make(chan *http.Request, 1)
+				s.Handler = http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+					requestChan <- r
+				})
+				setRequest(requestData)
+				str.EXPECT().Context().Return(reqContext)
+				str.EXPECT().Write(gomock.Any()).DoAndReturn(func(p []byte) (int, error) {
+					return len(p), nil
+				}).AnyTimes()
+
+				Expect(s.handleRequest(sess, str, nil, nil)).To(Succeed())
+				var req *http.Request
+				Eventually(requestChan).Should(Receive(&req))
+				Expect(req.Header.Get("foo")).To(HaveLen(1000))
+				Expect(s.Stats().HeadersTooLarge).To(BeZero())
+			})
+
+			It("rejects a request if the decoded headers exceed the limit", func() {
+				s.Server.MaxHeaderBytes = headerListSize(requestData) - 1
+				s.Handler = http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+					Fail("handler should not be called")
+				})
+				setRequest(requestData)
+				str.EXPECT().CancelRead(quic.ErrorCode(errorExcessiveLoad))
+				str.EXPECT().CancelWrite(quic.ErrorCode(errorExcessiveLoad))
+
+				Expect(s.handleRequest(sess, str, nil, nil)).To(MatchError(errHeaderTooLarge))
+				Expect(s.Stats().HeadersTooLarge).To(BeEquivalentTo(1))
+			})
+
+			It("rejects a request if the HEADERS frame exceeds the limit, without reading the header block", func() {
+				s.Server.MaxHeaderBytes = 100
+				s.Handler = http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+					Fail("handler should not be called")
+				})
+				buf := &bytes.Buffer{}
+				(&headersFrame{Length: 101}).Write(buf)
+				setRequest(buf.Bytes())
+				str.EXPECT().CancelRead(quic.ErrorCode(errorExcessiveLoad))
+				str.EXPECT().CancelWrite(quic.ErrorCode(errorExcessiveLoad))
+
+				Expect(s.handleRequest(sess, str, nil, nil)).To(MatchError(errHeaderTooLarge))
+				Expect(s.Stats().HeadersTooLarge).To(BeEquivalentTo(1))
+			})
+		})
+
+		It("hands the stream to a handler that hijacks it", func() {
+			hijacked := make(chan quic.Stream, 1)
+			s.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				defer GinkgoRecover()
+				w.Header().Set("foo", "bar")
+				w.WriteHeader(http.StatusOK)
+				str, err := w.(Hijacker).HijackStream()
+				Expect(err).ToNot(HaveOccurred())
+				_, err = str.Write([]byte("raw data"))
+				Expect(err).ToNot(HaveOccurred())
+				hijacked <- str
+			})
+
+			responseBuf := &bytes.Buffer{}
+			setRequest(encodeRequest(exampleGetRequest))
+			str.EXPECT().Context().Return(reqContext)
+			str.EXPECT().Write(gomock.Any()).DoAndReturn(func(p []byte) (int, error) {
+				return responseBuf.Write(p)
+			}).AnyTimes()
+			// no calls to Close, CancelRead or CancelWrite
+
+			Expect(s.handleRequest(sess, str, nil, nil)).To(MatchError(errHijacked))
+			Expect(hijacked).To(Receive(Equal(str)))
+			hfs := decodeHeader(responseBuf)
+			Expect(hfs).To(HaveKeyWithValue(":status", []string{"200"}))
+			Expect(hfs).To(HaveKeyWithValue("foo", []string{"bar"}))
+			Expect(responseBuf.String()).To(Equal("raw data"))
+		})
+
 		It("cancels the request context when the stream is closed", func() {
 			handlerCalled := make(chan struct{})
 			s.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -253,7 +769,37 @@ var _ = Describe("Server", func() {
 			}).AnyTimes()
 			str.EXPECT().CancelRead(quic.ErrorCode(errorEarlyResponse))
 
-			Expect(s.handleRequest(str, qpackDecoder)).To(Succeed())
+			Expect(s.handleRequest(sess, str, nil, nil)).To(Succeed())
+			Eventually(handlerCalled).Should(BeClosed())
+		})
+
+		It("cancels the request context when the client resets the stream", func() {
+			handlerCalled := make(chan struct{})
+			s.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				defer GinkgoRecover()
+				Expect(r.Context().Err()).ToNot(HaveOccurred())
+				_, err := ioutil.ReadAll(r.Body)
+				Expect(err).To(HaveOccurred())
+				Expect(r.Context().Done()).To(BeClosed())
+				_, err = w.Write([]byte("foobar"))
+				Expect(err).To(MatchError(context.Canceled))
+				close(handlerCalled)
+			})
+			buf := bytes.NewBuffer(encodeRequest(examplePostRequest))
+			buf.Truncate(buf.Len() - 3) // the client resets the stream before sending the complete body
+			str.EXPECT().Read(gomock.Any()).DoAndReturn(func(p []byte) (int, error) {
+				if buf.Len() == 0 {
+					return 0, &mockStreamError{code: quic.ErrorCode(errorRequestCanceled)}
+				}
+				return buf.Read(p)
+			}).AnyTimes()
+			str.EXPECT().Context().Return(reqContext)
+			str.EXPECT().Write(gomock.Any()).DoAndReturn(func(p []byte) (int, error) {
+				return len(p), nil
+			}).AnyTimes()
+			str.EXPECT().CancelRead(quic.ErrorCode(errorEarlyResponse))
+
+			Expect(s.handleRequest(sess, str, nil, nil)).To(Succeed())
 			Eventually(handlerCalled).Should(BeClosed())
 		})
 	})
@@ -261,19 +807,22 @@ var _ = Describe("Server", func() {
 	Context("setting http headers", func() {
 		var expected http.Header
 
-		getExpectedHeader := func(versions []protocol.VersionNumber) http.Header {
+		getExpectedHeader := func(versions []protocol.VersionNumber, ports ...int) http.Header {
 			var versionsAsString []string
 			for _, v := range versions {
 				versionsAsString = append(versionsAsString, v.ToAltSvc())
 			}
-			return http.Header{
-				"Alt-Svc": {fmt.Sprintf(`quic=":443"; ma=2592000; v="%s"`, strings.Join(versionsAsString, ","))},
+			var values []string
+			for _, port := range ports {
+				values = append(values, fmt.Sprintf(`h3-19=":%d"; ma=2592000`, port))
+				values = append(values, fmt.Sprintf(`quic=":%d"; ma=2592000; v="%s"`, port, strings.Join(versionsAsString, ",")))
 			}
+			return http.Header{"Alt-Svc": {strings.Join(values, ",")}}
 		}
 
 		BeforeEach(func() {
-			Expect(getExpectedHeader([]protocol.VersionNumber{99, 90, 9})).To(Equal(http.Header{"Alt-Svc": {`quic=":443"; ma=2592000; v="99,90,9"`}}))
-			expected = getExpectedHeader(protocol.SupportedVersions)
+			Expect(getExpectedHeader([]protocol.VersionNumber{99, 90, 9}, 443)).To(Equal(http.Header{"Alt-Svc": {`h3-19=":443"; ma=2592000,quic=":443"; ma=2592000; v="99,90,9"`}}))
+			expected = getExpectedHeader(protocol.SupportedVersions, 443)
 		})
 
 		It("sets proper headers with numeric port", func() {
@@ -306,6 +855,60 @@ var _ = Describe("Server", func() {
 			Expect(s.SetQuicHeaders(hdr)).To(Succeed())
 			Expect(hdr).To(Equal(expected))
 		})
+
+		It("advertises the versions from the quic.Config", func() {
+			s.Server.Addr = ":443"
+			s.QuicConfig = &quic.Config{Versions: []protocol.VersionNumber{protocol.VersionTLS}}
+			hdr := http.Header{}
+			Expect(s.SetQuicHeaders(hdr)).To(Succeed())
+			Expect(hdr).To(Equal(getExpectedHeader([]protocol.VersionNumber{protocol.VersionTLS}, 443)))
+		})
+
+		It("errors when listening on port 0, before the server is serving", func() {
+			s.Server.Addr = "localhost:0"
+			Expect(s.SetQuicHeaders(http.Header{})).To(MatchError("http3: can't advertise port 0, the server is not serving yet"))
+		})
+
+		Context("serving", func() {
+			serve := func() (int, <-chan error) {
+				conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 0})
+				Expect(err).ToNot(HaveOccurred())
+				errChan := make(chan error, 1)
+				go func(s *Server) {
+					errChan <- s.Serve(conn)
+					conn.Close()
+				}(s)
+				return conn.LocalAddr().(*net.UDPAddr).Port, errChan
+			}
+
+			getHeader := func() http.Header {
+				hdr := http.Header{}
+				s.SetQuicHeaders(hdr)
+				return hdr
+			}
+
+			BeforeEach(func() {
+				s.Server.Addr = "localhost:0"
+			})
+
+			It("advertises the port of the listener", func() {
+				port, errChan := serve()
+				Eventually(getHeader).Should(Equal(getExpectedHeader(protocol.SupportedVersions, port)))
+				Expect(s.Close()).To(Succeed())
+				Eventually(errChan).Should(Receive())
+				Expect(s.SetQuicHeaders(http.Header{})).To(HaveOccurred())
+			})
+
+			It("advertises the ports of multiple listeners", func() {
+				port1, errChan1 := serve()
+				Eventually(getHeader).Should(Equal(getExpectedHeader(protocol.SupportedVersions, port1)))
+				port2, errChan2 := serve()
+				Eventually(getHeader).Should(Equal(getExpectedHeader(protocol.SupportedVersions, port1, port2)))
+				Expect(s.Close()).To(Succeed())
+				Eventually(errChan1).Should(Receive())
+				Eventually(errChan2).Should(Receive())
+			})
+		})
 	})
 
 	It("errors when ListenAndServe is called with s.Server nil", func() {
@@ -335,18 +938,22 @@ var _ = Describe("Server", func() {
 			Expect(s.Close()).To(Succeed())
 		})
 
-		It("may only be called once", func() {
-			cErr := make(chan error)
+		It("may be called multiple times", func() {
+			cErr := make(chan error, 2)
 			for i := 0; i < 2; i++ {
-				go func() {
-					defer GinkgoRecover()
-					if err := s.ListenAndServe(); err != nil {
-						cErr <- err
-					}
-				}()
+				go func(s *Server) {
+					cErr <- s.ListenAndServe()
+				}(s)
 			}
-			Eventually(cErr).Should(Receive(MatchError("ListenAndServe may only be called once")))
+			Eventually(func() int {
+				s.listenerMutex.Lock()
+				defer s.listenerMutex.Unlock()
+				return len(s.listeners)
+			}).Should(Equal(2))
+			Consistently(cErr).ShouldNot(Receive())
 			Expect(s.Close()).To(Succeed())
+			Eventually(cErr).Should(Receive())
+			Eventually(cErr).Should(Receive())
 		})
 
 		It("uses the quic.Config to start the quic server", func() {
@@ -360,6 +967,20 @@ var _ = Describe("Server", func() {
 			Expect(s.ListenAndServe()).To(HaveOccurred())
 			Expect(receivedConf).To(Equal(conf))
 		})
+
+		It("sets the ALPN for HTTP/3", func() {
+			var receivedConf *tls.Config
+			quicListenAddr = func(addr string, tlsConf *tls.Config, config *quic.Config) (quic.Listener, error) {
+				receivedConf = tlsConf
+				return nil, errors.New("listen err")
+			}
+			s.TLSConfig = &tls.Config{ServerName: "foo.bar"}
+			Expect(s.ListenAndServe()).To(HaveOccurred())
+			Expect(receivedConf.NextProtos).To(Equal([]string{nextProtoH3}))
+			Expect(receivedConf.ServerName).To(Equal("foo.bar"))
+			// the tls.Config passed by the user is not modified
+			Expect(s.TLSConfig.NextProtos).To(BeEmpty())
+		})
 	})
 
 	Context("ListenAndServeTLS", func() {
@@ -371,18 +992,18 @@ var _ = Describe("Server", func() {
 			Expect(s.Close()).To(Succeed())
 		})
 
-		It("may only be called once", func() {
-			cErr := make(chan error)
-			for i := 0; i < 2; i++ {
-				go func() {
-					defer GinkgoRecover()
-					if err := s.ListenAndServeTLS(testdata.GetCertificatePaths()); err != nil {
-						cErr <- err
-					}
-				}()
-			}
-			Eventually(cErr).Should(Receive(MatchError("ListenAndServe may only be called once")))
+		It("starts the server", func() {
+			cErr := make(chan error, 1)
+			go func(s *Server) {
+				cErr <- s.ListenAndServeTLS(testdata.GetCertificatePaths())
+			}(s)
+			Eventually(func() int {
+				s.listenerMutex.Lock()
+				defer s.listenerMutex.Unlock()
+				return len(s.listeners)
+			}).Should(Equal(1))
 			Expect(s.Close()).To(Succeed())
+			Eventually(cErr).Should(Receive())
 		})
 	})
 
@@ -0,0 +1,64 @@
+package http3
+
+import (
+	"bytes"
+	"errors"
+	"io"
+
+	quic "github.com/lucas-clemente/quic-go"
+)
+
+var errTunnelNotWritable = errors.New("http3: the request body is sent on the tunnel")
+
+// A tunnel is the body of the response to a CONNECT request.
+// The client reads the data sent by the proxy from the tunnel, and writes data to the tunnel.
+// It implements io.ReadWriteCloser.
+type tunnel struct {
+	io.ReadCloser // the response body
+
+	str quic.Stream
+	// writable is false if the CONNECT request had a body.
+	// In that case, the body is sent on the tunnel.
+	writable bool
+}
+
+var _ io.ReadWriteCloser = &tunnel{}
+
+func newTunnel(body io.ReadCloser, str quic.Stream, writable bool) *tunnel {
+	return &tunnel{
+		ReadCloser: body,
+		str:        str,
+		writable:   writable,
+	}
+}
+
+// Write sends p in a DATA frame.
+func (t *tunnel) Write(p []byte) (int, error) {
+	if !t.writable {
+		return 0, errTunnelNotWritable
+	}
+	buf := &bytes.Buffer{}
+	(&dataFrame{Length: uint64(len(p))}).Write(buf)
+	buf.Write(p)
+	if _, err := t.str.Write(buf.Bytes()); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// CloseWrite closes the write direction of the tunnel.
+// Data sent by the proxy can still be read.
+func (t *tunnel) CloseWrite() error {
+	if !t.writable {
+		return errTunnelNotWritable
+	}
+	return t.str.Close()
+}
+
+// Close closes the tunnel in both directions.
+func (t *tunnel) Close() error {
+	if t.writable {
+		t.str.Close()
+	}
+	return t.ReadCloser.Close()
+}
@@ -0,0 +1,286 @@
+package http3
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync"
+
+	quic "github.com/lucas-clemente/quic-go"
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+	"github.com/lucas-clemente/quic-go/internal/utils"
+)
+
+// webTransportProtocol is the value of the :protocol pseudo-header of the extended CONNECT request
+// that establishes a WebTransport session.
+const webTransportProtocol = "webtransport"
+
+const (
+	// settingEnableConnectProtocol is the SETTINGS_ENABLE_CONNECT_PROTOCOL setting (RFC 8441).
+	settingEnableConnectProtocol = 0x8
+	// settingEnableWebTransport is the SETTINGS_ENABLE_WEBTRANSPORT setting.
+	settingEnableWebTransport = 0x2b603742
+)
+
+// frameTypeWebTransportStream is sent at the beginning of a bidirectional WebTransport stream, followed by the session ID.
+const frameTypeWebTransportStream = 0x41
+
+// streamTypeWebTransportDatagram is the stream type of a unidirectional stream carrying a single WebTransport datagram.
+const streamTypeWebTransportDatagram = 0x54
+
+const (
+	// maxWebTransportDatagramSize is the maximum size of a WebTransport datagram.
+	maxWebTransportDatagramSize = 1 << 16
+	// maxQueuedWebTransportDatagrams is the maximum number of received datagrams that are queued for a session.
+	// When the queue is full, datagrams are dropped.
+	maxQueuedWebTransportDatagrams = 32
+	// maxQueuedWebTransportStreams is the maximum number of streams that are queued for a session.
+	// When the queue is full, the peer's streams are only accepted once the application calls AcceptStream.
+	maxQueuedWebTransportStreams = 16
+)
+
+var errWebTransportSessionClosed = errors.New("http3: WebTransport session closed")
+
+// A WebTransportHandler handles a WebTransport session.
+// It is called with the session and the extended CONNECT request that established it.
+// The session is not closed when the handler returns, the handler is responsible for calling Close.
+type WebTransportHandler func(*WebTransportSession, *http.Request)
+
+// A WebTransportSession is a WebTransport session, established by an extended CONNECT request.
+// Streams and datagrams are associated with the session by the stream ID of the CONNECT request, the session ID.
+// The session is closed when either endpoint closes the CONNECT request stream.
+//
+// Warning: This is an experimental implementation, pinned to the wire format of this version of quic-go.
+// It doesn't interoperate with other WebTransport implementations.
+// Until DATAGRAM frames are supported, every datagram is sent on a new unidirectional stream.
+// This means that datagrams are retransmitted when lost, and might be reordered.
+type WebTransportSession struct {
+	sessionID  protocol.StreamID
+	qsess      quic.Session
+	requestStr quic.Stream
+
+	acceptQueue   chan quic.Stream
+	datagramQueue chan []byte
+
+	ctx       context.Context
+	cancel    context.CancelFunc
+	closeOnce sync.Once
+	// onClose is called when the session is closed.
+	onClose func()
+
+	logger utils.Logger
+}
+
+func newWebTransportSession(qsess quic.Session, requestStr quic.Stream, onClose func(), logger utils.Logger) *WebTransportSession {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &WebTransportSession{
+		sessionID:     requestStr.StreamID(),
+		qsess:         qsess,
+		requestStr:    requestStr,
+		acceptQueue:   make(chan quic.Stream, maxQueuedWebTransportStreams),
+		datagramQueue: make(chan []byte, maxQueuedWebTransportDatagrams),
+		ctx:           ctx,
+		cancel:        cancel,
+		onClose:       onClose,
+		logger:        logger,
+	}
+}
+
+// run reads from the CONNECT request stream until the peer closes it, and then closes the session.
+func (s *WebTransportSession) run() {
+	// After the response headers, the request stream doesn't carry any data.
+	_, err := io.Copy(ioutil.Discard, s.requestStr)
+	if err != nil {
+		s.logger.Debugf("WebTransport session %d: reading from the CONNECT stream failed: %s", s.sessionID, err)
+	}
+	s.Close()
+}
+
+// OpenStream opens a new bidirectional stream that belongs to this session.
+// It blocks until the peer's stream limit allows opening a new stream.
+func (s *WebTransportSession) OpenStream() (quic.Stream, error) {
+	if s.ctx.Err() != nil {
+		return nil, errWebTransportSessionClosed
+	}
+	str, err := s.qsess.OpenStreamSync()
+	if err != nil {
+		return nil, err
+	}
+	buf := &bytes.Buffer{}
+	(&webTransportStreamFrame{SessionID: s.sessionID}).Write(buf)
+	if _, err := str.Write(buf.Bytes()); err != nil {
+		return nil, err
+	}
+	return str, nil
+}
+
+// AcceptStream returns the next bidirectional stream opened by the peer for this session,
+// blocking until one is available, or until the session is closed.
+func (s *WebTransportSession) AcceptStream() (quic.Stream, error) {
+	select {
+	case str := <-s.acceptQueue:
+		return str, nil
+	case <-s.ctx.Done():
+		return nil, errWebTransportSessionClosed
+	}
+}
+
+// SendDatagram sends a datagram.
+func (s *WebTransportSession) SendDatagram(p []byte) error {
+	if len(p) > maxWebTransportDatagramSize {
+		return fmt.Errorf("http3: WebTransport datagram too large (%d bytes, maximum %d bytes)", len(p), maxWebTransportDatagramSize)
+	}
+	if s.ctx.Err() != nil {
+		return errWebTransportSessionClosed
+	}
+	str, err := s.qsess.OpenUniStream()
+	if err != nil {
+		return err
+	}
+	buf := bytes.NewBuffer(make([]byte, 0, 16+len(p)))
+	utils.WriteVarInt(buf, streamTypeWebTransportDatagram)
+	utils.WriteVarInt(buf, uint64(s.sessionID))
+	buf.Write(p)
+	if _, err := str.Write(buf.Bytes()); err != nil {
+		return err
+	}
+	return str.Close()
+}
+
+// ReceiveDatagram returns the next datagram sent by the peer,
+// blocking until one is available, or until the session is closed.
+func (s *WebTransportSession) ReceiveDatagram() ([]byte, error) {
+	select {
+	case p := <-s.datagramQueue:
+		return p, nil
+	case <-s.ctx.Done():
+		return nil, errWebTransportSessionClosed
+	}
+}
+
+// Context returns a context that is canceled when the session is closed.
+func (s *WebTransportSession) Context() context.Context {
+	return s.ctx
+}
+
+// Close closes the session, by closing the CONNECT request stream.
+// Streams that were opened or accepted are not affected.
+func (s *WebTransportSession) Close() error {
+	s.closeOnce.Do(func() {
+		s.cancel()
+		s.requestStr.CancelRead(quic.ErrorCode(errorNoError))
+		s.requestStr.Close()
+		s.onClose()
+	})
+	return nil
+}
+
+// handleStream queues a stream opened by the peer.
+func (s *WebTransportSession) handleStream(str quic.Stream) {
+	select {
+	case s.acceptQueue <- str:
+	case <-s.ctx.Done():
+		str.CancelRead(quic.ErrorCode(errorRequestCanceled))
+		str.CancelWrite(quic.ErrorCode(errorRequestCanceled))
+	}
+}
+
+// handleDatagram queues a datagram sent by the peer.
+// If the queue is full, the datagram is dropped.
+func (s *WebTransportSession) handleDatagram(p []byte) {
+	select {
+	case s.datagramQueue <- p:
+	default:
+		s.logger.Debugf("WebTransport session %d: dropping datagram, since the queue is full", s.sessionID)
+	}
+}
+
+// The webTransportManager keeps track of the WebTransport sessions on a QUIC connection,
+// and assigns the peer's streams and datagrams to them.
+type webTransportManager struct {
+	sess quic.Session
+
+	mutex    sync.Mutex
+	sessions map[protocol.StreamID]*WebTransportSession
+
+	logger utils.Logger
+}
+
+func newWebTransportManager(sess quic.Session, logger utils.Logger) *webTransportManager {
+	return &webTransportManager{
+		sess:     sess,
+		sessions: make(map[protocol.StreamID]*WebTransportSession),
+		logger:   logger,
+	}
+}
+
+// addSession creates a session that uses str as the CONNECT request stream.
+// The session must be added before the CONNECT request (on the client side) or the response (on the server side) is sent,
+// such that streams and datagrams sent by the peer right away can be assigned to the session.
+// onClose is called when the session is closed. It may be nil.
+func (m *webTransportManager) addSession(str quic.Stream, onClose func()) *WebTransportSession {
+	id := str.StreamID()
+	wsess := newWebTransportSession(m.sess, str, func() {
+		m.mutex.Lock()
+		delete(m.sessions, id)
+		m.mutex.Unlock()
+		if onClose != nil {
+			onClose()
+		}
+	}, m.logger)
+	m.mutex.Lock()
+	m.sessions[id] = wsess
+	m.mutex.Unlock()
+	return wsess
+}
+
+func (m *webTransportManager) getSession(id protocol.StreamID) (*WebTransportSession, bool) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	wsess, ok := m.sessions[id]
+	return wsess, ok
+}
+
+// handleStream handles a bidirectional stream opened by the peer.
+// The WEBTRANSPORT_STREAM frame and the session ID were already read from the stream.
+// It blocks until the stream was accepted, or until the session is closed.
+func (m *webTransportManager) handleStream(str quic.Stream, sessionID protocol.StreamID) {
+	wsess, ok := m.getSession(sessionID)
+	if !ok {
+		m.logger.Debugf("Received stream %d for unknown WebTransport session %d", str.StreamID(), sessionID)
+		str.CancelRead(quic.ErrorCode(errorRequestCanceled))
+		str.CancelWrite(quic.ErrorCode(errorRequestCanceled))
+		return
+	}
+	wsess.handleStream(str)
+}
+
+// handleDatagramStream reads a datagram from a unidirectional stream opened by the peer.
+// The stream type was already read from the stream.
+func (m *webTransportManager) handleDatagramStream(str quic.ReceiveStream) {
+	id, err := utils.ReadVarInt(&byteReaderImpl{str})
+	if err != nil {
+		m.logger.Debugf("Reading the WebTransport session ID on stream %d failed: %s", str.StreamID(), err)
+		return
+	}
+	data, err := ioutil.ReadAll(io.LimitReader(str, maxWebTransportDatagramSize+1))
+	if err != nil {
+		m.logger.Debugf("Reading the WebTransport datagram on stream %d failed: %s", str.StreamID(), err)
+		return
+	}
+	if len(data) > maxWebTransportDatagramSize {
+		m.logger.Debugf("Received a WebTransport datagram larger than %d bytes on stream %d", maxWebTransportDatagramSize, str.StreamID())
+		str.CancelRead(quic.ErrorCode(errorExcessiveLoad))
+		return
+	}
+	wsess, ok := m.getSession(protocol.StreamID(id))
+	if !ok {
+		m.logger.Debugf("Received datagram for unknown WebTransport session %d", id)
+		return
+	}
+	wsess.handleDatagram(data)
+}
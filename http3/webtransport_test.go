@@ -0,0 +1,177 @@
+package http3
+
+import (
+	"bytes"
+	"io"
+
+	"github.com/golang/mock/gomock"
+	quic "github.com/lucas-clemente/quic-go"
+	mockquic "github.com/lucas-clemente/quic-go/internal/mocks/quic"
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+	"github.com/lucas-clemente/quic-go/internal/utils"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("WebTransport", func() {
+	var (
+		sess       *mockquic.MockSession
+		m          *webTransportManager
+		requestStr *mockquic.MockStream
+	)
+
+	BeforeEach(func() {
+		sess = mockquic.NewMockSession(mockCtrl)
+		m = newWebTransportManager(sess, utils.DefaultLogger)
+		requestStr = mockquic.NewMockStream(mockCtrl)
+		requestStr.EXPECT().StreamID().Return(protocol.StreamID(4)).AnyTimes()
+	})
+
+	expectClose := func() {
+		requestStr.EXPECT().CancelRead(quic.ErrorCode(errorNoError))
+		requestStr.EXPECT().Close()
+	}
+
+	// newDatagramStream creates a unidirectional stream carrying a datagram, with the stream type already consumed.
+	newDatagramStream := func(sessionID protocol.StreamID, p []byte) *mockquic.MockStream {
+		buf := &bytes.Buffer{}
+		utils.WriteVarInt(buf, uint64(sessionID))
+		buf.Write(p)
+		str := mockquic.NewMockStream(mockCtrl)
+		str.EXPECT().StreamID().AnyTimes()
+		str.EXPECT().Read(gomock.Any()).DoAndReturn(buf.Read).AnyTimes()
+		return str
+	}
+
+	It("opens streams", func() {
+		wsess := m.addSession(requestStr, nil)
+		str := mockquic.NewMockStream(mockCtrl)
+		sess.EXPECT().OpenStreamSync().Return(str, nil)
+		buf := &bytes.Buffer{}
+		str.EXPECT().Write(gomock.Any()).DoAndReturn(buf.Write)
+		Expect(wsess.OpenStream()).To(Equal(str))
+		f, err := parseNextFrame(buf)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(f).To(Equal(&webTransportStreamFrame{SessionID: 4}))
+		Expect(buf.Len()).To(BeZero())
+	})
+
+	It("accepts streams", func() {
+		wsess := m.addSession(requestStr, nil)
+		str := mockquic.NewMockStream(mockCtrl)
+		m.handleStream(str, 4)
+		Expect(wsess.AcceptStream()).To(Equal(str))
+	})
+
+	It("resets streams for unknown sessions", func() {
+		m.addSession(requestStr, nil)
+		str := mockquic.NewMockStream(mockCtrl)
+		str.EXPECT().StreamID().AnyTimes()
+		str.EXPECT().CancelRead(quic.ErrorCode(errorRequestCanceled))
+		str.EXPECT().CancelWrite(quic.ErrorCode(errorRequestCanceled))
+		m.handleStream(str, 8)
+	})
+
+	It("sends datagrams", func() {
+		wsess := m.addSession(requestStr, nil)
+		str := mockquic.NewMockStream(mockCtrl)
+		sess.EXPECT().OpenUniStream().Return(str, nil)
+		buf := &bytes.Buffer{}
+		gomock.InOrder(
+			str.EXPECT().Write(gomock.Any()).DoAndReturn(buf.Write),
+			str.EXPECT().Close(),
+		)
+		Expect(wsess.SendDatagram([]byte("foobar"))).To(Succeed())
+		streamType, err := utils.ReadVarInt(buf)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(streamType).To(BeEquivalentTo(streamTypeWebTransportDatagram))
+		sessionID, err := utils.ReadVarInt(buf)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(sessionID).To(BeEquivalentTo(4))
+		Expect(buf.Bytes()).To(Equal([]byte("foobar")))
+	})
+
+	It("refuses to send datagrams that are too large", func() {
+		wsess := m.addSession(requestStr, nil)
+		err := wsess.SendDatagram(make([]byte, maxWebTransportDatagramSize+1))
+		Expect(err).To(MatchError("http3: WebTransport datagram too large (65537 bytes, maximum 65536 bytes)"))
+	})
+
+	It("receives datagrams", func() {
+		wsess := m.addSession(requestStr, nil)
+		m.handleDatagramStream(newDatagramStream(4, []byte("foobar")))
+		Expect(wsess.ReceiveDatagram()).To(Equal([]byte("foobar")))
+	})
+
+	It("drops datagrams for unknown sessions", func() {
+		wsess := m.addSession(requestStr, nil)
+		m.handleDatagramStream(newDatagramStream(8, []byte("foobar")))
+		Expect(wsess.datagramQueue).To(BeEmpty())
+	})
+
+	It("drops datagrams when the queue is full", func() {
+		wsess := m.addSession(requestStr, nil)
+		for i := 0; i < maxQueuedWebTransportDatagrams+1; i++ {
+			m.handleDatagramStream(newDatagramStream(4, []byte{byte(i)}))
+		}
+		Expect(wsess.datagramQueue).To(HaveLen(maxQueuedWebTransportDatagrams))
+		Expect(wsess.ReceiveDatagram()).To(Equal([]byte{0}))
+	})
+
+	It("rejects datagrams that are too large", func() {
+		wsess := m.addSession(requestStr, nil)
+		str := newDatagramStream(4, make([]byte, maxWebTransportDatagramSize+1))
+		str.EXPECT().CancelRead(quic.ErrorCode(errorExcessiveLoad))
+		m.handleDatagramStream(str)
+		Expect(wsess.datagramQueue).To(BeEmpty())
+	})
+
+	It("closes", func() {
+		var closed bool
+		wsess := m.addSession(requestStr, func() { closed = true })
+		expectClose()
+		Expect(wsess.Close()).To(Succeed())
+		Expect(closed).To(BeTrue())
+		Expect(wsess.Context().Done()).To(BeClosed())
+		Expect(wsess.Close()).To(Succeed()) // no-op
+		_, err := wsess.AcceptStream()
+		Expect(err).To(MatchError(errWebTransportSessionClosed))
+		_, err = wsess.ReceiveDatagram()
+		Expect(err).To(MatchError(errWebTransportSessionClosed))
+		_, err = wsess.OpenStream()
+		Expect(err).To(MatchError(errWebTransportSessionClosed))
+		Expect(wsess.SendDatagram([]byte("foobar"))).To(MatchError(errWebTransportSessionClosed))
+		// the session was removed
+		_, ok := m.getSession(4)
+		Expect(ok).To(BeFalse())
+	})
+
+	It("closes when the peer closes the CONNECT stream", func() {
+		wsess := m.addSession(requestStr, nil)
+		requestStr.EXPECT().Read(gomock.Any()).Return(0, io.EOF)
+		expectClose()
+		wsess.run()
+		Expect(wsess.Context().Done()).To(BeClosed())
+	})
+
+	It("resets streams that are not accepted before the session is closed", func() {
+		wsess := m.addSession(requestStr, nil)
+		for i := 0; i < maxQueuedWebTransportStreams; i++ {
+			m.handleStream(mockquic.NewMockStream(mockCtrl), 4)
+		}
+		str := mockquic.NewMockStream(mockCtrl)
+		str.EXPECT().CancelRead(quic.ErrorCode(errorRequestCanceled))
+		str.EXPECT().CancelWrite(quic.ErrorCode(errorRequestCanceled))
+		done := make(chan struct{})
+		go func() {
+			defer GinkgoRecover()
+			defer close(done)
+			m.handleStream(str, 4)
+		}()
+		Consistently(done).ShouldNot(BeClosed())
+		expectClose()
+		Expect(wsess.Close()).To(Succeed())
+		Eventually(done).Should(BeClosed())
+	})
+})
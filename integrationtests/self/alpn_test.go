@@ -0,0 +1,96 @@
+package self_test
+
+import (
+	"fmt"
+	"net"
+
+	quic "github.com/lucas-clemente/quic-go"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ALPN tests", func() {
+	It("negotiates an application protocol", func() {
+		ln, err := quic.ListenAddr("localhost:0", getTLSConfig(), nil)
+		Expect(err).ToNot(HaveOccurred())
+		defer ln.Close()
+
+		done := make(chan struct{})
+		go func() {
+			defer GinkgoRecover()
+			sess, proto, err := ln.AcceptWithProtocol()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(proto).To(Equal(alpn))
+			Expect(sess.ConnectionState().NegotiatedProtocol).To(Equal(alpn))
+			close(done)
+		}()
+
+		sess, err := quic.DialAddr(
+			fmt.Sprintf("localhost:%d", ln.Addr().(*net.UDPAddr).Port),
+			getTLSClientConfig(),
+			nil,
+		)
+		Expect(err).ToNot(HaveOccurred())
+		defer sess.Close()
+		Expect(sess.ConnectionState().NegotiatedProtocol).To(Equal(alpn))
+		Eventually(done).Should(BeClosed())
+	})
+
+	It("dispatches sessions by the negotiated application protocol", func() {
+		tlsConf := getTLSConfig()
+		tlsConf.NextProtos = []string{"proto1", "proto2"}
+		ln, err := quic.ListenAddr("localhost:0", tlsConf, nil)
+		Expect(err).ToNot(HaveOccurred())
+		defer ln.Close()
+
+		protos := make(chan string, 2)
+		go func() {
+			defer GinkgoRecover()
+			for i := 0; i < 2; i++ {
+				_, proto, err := ln.AcceptWithProtocol()
+				Expect(err).ToNot(HaveOccurred())
+				protos <- proto
+			}
+		}()
+
+		for _, proto := range []string{"proto2", "proto1"} {
+			clientConf := getTLSClientConfig()
+			clientConf.NextProtos = []string{"foobar", proto}
+			sess, err := quic.DialAddr(
+				fmt.Sprintf("localhost:%d", ln.Addr().(*net.UDPAddr).Port),
+				clientConf,
+				nil,
+			)
+			Expect(err).ToNot(HaveOccurred())
+			defer sess.Close()
+			Expect(sess.ConnectionState().NegotiatedProtocol).To(Equal(proto))
+			Eventually(protos).Should(Receive(Equal(proto)))
+		}
+	})
+
+	It("fails the handshake if there's no application protocol in common", func() {
+		ln, err := quic.ListenAddr("localhost:0", getTLSConfig(), nil)
+		Expect(err).ToNot(HaveOccurred())
+		defer ln.Close()
+
+		accepted := make(chan struct{})
+		go func() {
+			defer GinkgoRecover()
+			ln.Accept()
+			close(accepted)
+		}()
+
+		clientConf := getTLSClientConfig()
+		clientConf.NextProtos = []string{"foo", "bar"}
+		_, err = quic.DialAddr(
+			fmt.Sprintf("localhost:%d", ln.Addr().(*net.UDPAddr).Port),
+			clientConf,
+			nil,
+		)
+		Expect(err).To(HaveOccurred())
+		Expect(err).To(BeAssignableToTypeOf(&quic.ALPNError{}))
+		Expect(err.(*quic.ALPNError).Protocols).To(Equal([]string{"foo", "bar"}))
+		Expect(err.Error()).To(ContainSubstring("no application protocol"))
+		Consistently(accepted).ShouldNot(BeClosed())
+	})
+})
@@ -0,0 +1,223 @@
+package self_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"math/big"
+	"net"
+	"time"
+
+	quic "github.com/lucas-clemente/quic-go"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+const (
+	alertBadCertificate      = 42
+	alertCertificateRequired = 116
+)
+
+func generateClientCA() (*x509.Certificate, *ecdsa.PrivateKey) {
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	Expect(err).ToNot(HaveOccurred())
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "quic-go client CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	certDER, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &priv.PublicKey, priv)
+	Expect(err).ToNot(HaveOccurred())
+	ca, err := x509.ParseCertificate(certDER)
+	Expect(err).ToNot(HaveOccurred())
+	return ca, priv
+}
+
+func generateClientCert(ca *x509.Certificate, caPriv *ecdsa.PrivateKey) tls.Certificate {
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	Expect(err).ToNot(HaveOccurred())
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "client"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	certDER, err := x509.CreateCertificate(rand.Reader, tmpl, ca, &priv.PublicKey, caPriv)
+	Expect(err).ToNot(HaveOccurred())
+	return tls.Certificate{
+		Certificate: [][]byte{certDER, ca.Raw},
+		PrivateKey:  priv,
+	}
+}
+
+// closeErrTracer reports the error that a connection was closed with.
+type closeErrTracer struct {
+	connTracer
+	errChan chan<- error
+}
+
+func (t *closeErrTracer) ClosedConnection(err error) {
+	t.errChan <- err
+}
+
+type closeErrTracerFactory chan error
+
+var _ quic.Tracer = closeErrTracerFactory(nil)
+
+func (f closeErrTracerFactory) TracerForConnection(bool, quic.ConnectionID) quic.ConnectionTracer {
+	return &closeErrTracer{errChan: f}
+}
+
+var _ = Describe("Client authentication", func() {
+	var (
+		ca     *x509.Certificate
+		caPriv *ecdsa.PrivateKey
+
+		server          quic.Listener
+		serverTLSConf   *tls.Config
+		serverSessions  chan quic.Session
+		serverCloseErrs closeErrTracerFactory
+	)
+
+	BeforeEach(func() {
+		ca, caPriv = generateClientCA()
+		serverTLSConf = getTLSConfig()
+		serverTLSConf.ClientCAs = x509.NewCertPool()
+		serverTLSConf.ClientCAs.AddCert(ca)
+	})
+
+	runServer := func() {
+		serverCloseErrs = make(closeErrTracerFactory, 1)
+		var err error
+		server, err = quic.ListenAddr("localhost:0", serverTLSConf, &quic.Config{Tracer: serverCloseErrs})
+		Expect(err).ToNot(HaveOccurred())
+		serverSessions = make(chan quic.Session, 1)
+		go func() {
+			defer GinkgoRecover()
+			for {
+				sess, err := server.Accept()
+				if err != nil { // the listener was closed
+					return
+				}
+				serverSessions <- sess
+			}
+		}()
+	}
+
+	AfterEach(func() {
+		Expect(server.Close()).To(Succeed())
+	})
+
+	dial := func(certs ...tls.Certificate) (quic.Session, error) {
+		tlsConf := getTLSClientConfig()
+		tlsConf.Certificates = certs
+		return quic.DialAddr(
+			fmt.Sprintf("localhost:%d", server.Addr().(*net.UDPAddr).Port),
+			tlsConf,
+			nil,
+		)
+	}
+
+	// expectRejected checks that the server aborts the handshake with the given TLS alert.
+	expectRejected := func(alert uint8, certs ...tls.Certificate) {
+		sess, err := dial(certs...)
+		// The server only verifies the client's certificate after the client completed the handshake,
+		// so the error is usually returned when using the session, not by Dial.
+		if err == nil {
+			_, err = sess.AcceptStream()
+		}
+		Expect(err).To(BeAssignableToTypeOf(&quic.CryptoError{}))
+		Expect(err.(*quic.CryptoError).Alert).To(Equal(alert))
+		Expect(err.(*quic.CryptoError).Remote).To(BeTrue())
+
+		var serverErr error
+		Eventually(serverCloseErrs).Should(Receive(&serverErr))
+		Expect(serverErr).To(BeAssignableToTypeOf(&quic.CryptoError{}))
+		Expect(serverErr.(*quic.CryptoError).Alert).To(Equal(alert))
+		Expect(serverErr.(*quic.CryptoError).Remote).To(BeFalse())
+		Consistently(serverSessions).ShouldNot(Receive())
+	}
+
+	Context("with optional client certificates", func() {
+		JustBeforeEach(func() {
+			serverTLSConf.ClientAuth = tls.VerifyClientCertIfGiven
+			runServer()
+		})
+
+		It("accepts clients that don't send a certificate", func() {
+			sess, err := dial()
+			Expect(err).ToNot(HaveOccurred())
+			defer sess.Close()
+			var serverSess quic.Session
+			Eventually(serverSessions).Should(Receive(&serverSess))
+			Expect(serverSess.PeerCertificates()).To(BeEmpty())
+		})
+
+		It("verifies the client's certificate", func() {
+			clientCert := generateClientCert(ca, caPriv)
+			sess, err := dial(clientCert)
+			Expect(err).ToNot(HaveOccurred())
+			defer sess.Close()
+			var serverSess quic.Session
+			Eventually(serverSessions).Should(Receive(&serverSess))
+			Expect(serverSess.PeerCertificates()).To(HaveLen(2))
+			Expect(serverSess.PeerCertificates()[0].Raw).To(Equal(clientCert.Certificate[0]))
+			Expect(serverSess.VerifiedChains()).To(HaveLen(1))
+			Expect(serverSess.VerifiedChains()[0][1].Equal(ca)).To(BeTrue())
+		})
+
+		It("rejects certificates that can't be verified", func() {
+			otherCA, otherCAPriv := generateClientCA()
+			expectRejected(alertBadCertificate, generateClientCert(otherCA, otherCAPriv))
+		})
+	})
+
+	Context("with required client certificates", func() {
+		var verifiedChains chan [][]*x509.Certificate
+
+		JustBeforeEach(func() {
+			serverTLSConf.ClientAuth = tls.RequireAndVerifyClientCert
+			verifiedChains = make(chan [][]*x509.Certificate, 1)
+			serverTLSConf.VerifyPeerCertificate = func(_ [][]byte, chains [][]*x509.Certificate) error {
+				verifiedChains <- chains
+				return nil
+			}
+			runServer()
+		})
+
+		It("accepts clients with a valid certificate", func() {
+			clientCert := generateClientCert(ca, caPriv)
+			sess, err := dial(clientCert)
+			Expect(err).ToNot(HaveOccurred())
+			defer sess.Close()
+			var chains [][]*x509.Certificate
+			Eventually(verifiedChains).Should(Receive(&chains))
+			Expect(chains).To(HaveLen(1))
+			Expect(chains[0][0].Raw).To(Equal(clientCert.Certificate[0]))
+			var serverSess quic.Session
+			Eventually(serverSessions).Should(Receive(&serverSess))
+			Expect(serverSess.ConnectionState().PeerCertificates[0].Raw).To(Equal(clientCert.Certificate[0]))
+			Expect(serverSess.ConnectionState().VerifiedChains).To(Equal(chains))
+		})
+
+		It("rejects clients that don't send a certificate", func() {
+			expectRejected(alertCertificateRequired)
+		})
+
+		It("rejects certificates that can't be verified", func() {
+			otherCA, otherCAPriv := generateClientCA()
+			expectRejected(alertBadCertificate, generateClientCert(otherCA, otherCAPriv))
+		})
+	})
+})
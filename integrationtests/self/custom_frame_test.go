@@ -0,0 +1,91 @@
+package self_test
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+
+	quic "github.com/lucas-clemente/quic-go"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// a made-up frame type, e.g. used by an experimental extension
+const customFrameType = 0x4242
+
+// echoFrame carries a short message, prefixed by a 1-byte length
+type echoFrame struct {
+	msg []byte
+}
+
+var _ quic.CustomFrame = &echoFrame{}
+
+func (f *echoFrame) FrameType() uint64 { return customFrameType }
+
+func (f *echoFrame) Write(b *bytes.Buffer) error {
+	b.WriteByte(byte(len(f.msg)))
+	b.Write(f.msg)
+	return nil
+}
+
+func (f *echoFrame) Length() quic.ByteCount { return 1 + quic.ByteCount(len(f.msg)) }
+
+func decodeEchoFrame(data []byte) (quic.CustomFrame, error) {
+	if len(data) == 0 || int(data[0]) > len(data)-1 {
+		return nil, errors.New("echo frame too short")
+	}
+	return &echoFrame{msg: append([]byte{}, data[1:1+data[0]]...)}, nil
+}
+
+var _ = Describe("Custom Frames", func() {
+	It("exchanges custom frames", func() {
+		serverConf := &quic.Config{
+			OnCustomFrame: func(sess quic.Session, f quic.CustomFrame) {
+				defer GinkgoRecover()
+				Expect(sess.SendCustomFrame(&echoFrame{msg: append([]byte("echo: "), f.(*echoFrame).msg...)})).To(Succeed())
+			},
+		}
+		serverConf.RegisterFrameType(customFrameType, decodeEchoFrame)
+		ln, err := quic.ListenAddr("localhost:0", getTLSConfig(), serverConf)
+		Expect(err).ToNot(HaveOccurred())
+		defer ln.Close()
+
+		go func() {
+			defer GinkgoRecover()
+			_, err := ln.Accept()
+			Expect(err).ToNot(HaveOccurred())
+		}()
+
+		received := make(chan []byte, 1)
+		clientConf := &quic.Config{
+			OnCustomFrame: func(_ quic.Session, f quic.CustomFrame) { received <- f.(*echoFrame).msg },
+		}
+		clientConf.RegisterFrameType(customFrameType, decodeEchoFrame)
+		sess, err := quic.DialAddr(
+			fmt.Sprintf("localhost:%d", ln.Addr().(*net.UDPAddr).Port),
+			getTLSClientConfig(),
+			clientConf,
+		)
+		Expect(err).ToNot(HaveOccurred())
+		defer sess.Close()
+		Expect(sess.SendCustomFrame(&echoFrame{msg: []byte("foobar")})).To(Succeed())
+		Eventually(received).Should(Receive(Equal([]byte("echo: foobar"))))
+	})
+
+	It("closes the connection when receiving a frame of a type that wasn't registered", func() {
+		ln, err := quic.ListenAddr("localhost:0", getTLSConfig(), nil)
+		Expect(err).ToNot(HaveOccurred())
+		defer ln.Close()
+
+		sess, err := quic.DialAddr(
+			fmt.Sprintf("localhost:%d", ln.Addr().(*net.UDPAddr).Port),
+			getTLSClientConfig(),
+			nil,
+		)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(sess.SendCustomFrame(&echoFrame{msg: []byte("foobar")})).To(Succeed())
+		_, err = sess.AcceptStream()
+		Expect(err).To(MatchError(ContainSubstring("FRAME_ENCODING_ERROR")))
+	})
+})
@@ -0,0 +1,67 @@
+package self_test
+
+import (
+	"fmt"
+	"net"
+
+	quic "github.com/lucas-clemente/quic-go"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Custom Transport Parameters", func() {
+	// a made-up transport parameter, e.g. used by an experimental extension
+	const paramID = 0x4242
+
+	It("exchanges custom transport parameters", func() {
+		ln, err := quic.ListenAddr(
+			"localhost:0",
+			getTLSConfig(),
+			&quic.Config{CustomTransportParameters: map[uint64][]byte{paramID: []byte("server")}},
+		)
+		Expect(err).ToNot(HaveOccurred())
+		defer ln.Close()
+
+		serverParams := make(chan map[uint64][]byte, 1)
+		go func() {
+			defer GinkgoRecover()
+			sess, err := ln.Accept()
+			Expect(err).ToNot(HaveOccurred())
+			serverParams <- sess.PeerTransportParameters()
+		}()
+
+		sess, err := quic.DialAddr(
+			fmt.Sprintf("localhost:%d", ln.Addr().(*net.UDPAddr).Port),
+			getTLSClientConfig(),
+			&quic.Config{CustomTransportParameters: map[uint64][]byte{paramID: []byte("client")}},
+		)
+		Expect(err).ToNot(HaveOccurred())
+		defer sess.Close()
+		Expect(sess.PeerTransportParameters()).To(Equal(map[uint64][]byte{paramID: []byte("server")}))
+		Eventually(serverParams).Should(Receive(Equal(map[uint64][]byte{paramID: []byte("client")})))
+	})
+
+	It("doesn't return any custom transport parameters, if the peer didn't send any", func() {
+		ln, err := quic.ListenAddr("localhost:0", getTLSConfig(), nil)
+		Expect(err).ToNot(HaveOccurred())
+		defer ln.Close()
+
+		serverParams := make(chan map[uint64][]byte, 1)
+		go func() {
+			defer GinkgoRecover()
+			sess, err := ln.Accept()
+			Expect(err).ToNot(HaveOccurred())
+			serverParams <- sess.PeerTransportParameters()
+		}()
+
+		sess, err := quic.DialAddr(
+			fmt.Sprintf("localhost:%d", ln.Addr().(*net.UDPAddr).Port),
+			getTLSClientConfig(),
+			&quic.Config{CustomTransportParameters: map[uint64][]byte{paramID: []byte("client")}},
+		)
+		Expect(err).ToNot(HaveOccurred())
+		defer sess.Close()
+		Expect(sess.PeerTransportParameters()).To(BeNil())
+		Eventually(serverParams).Should(Receive(Equal(map[uint64][]byte{paramID: []byte("client")})))
+	})
+})
@@ -0,0 +1,103 @@
+package self_test
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"time"
+
+	quic "github.com/lucas-clemente/quic-go"
+	quicproxy "github.com/lucas-clemente/quic-go/integrationtests/tools/proxy"
+	"github.com/lucas-clemente/quic-go/integrationtests/tools/testserver"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Accepting sessions early", func() {
+	const rtt = 200 * time.Millisecond
+
+	var (
+		ln    quic.Listener
+		proxy *quicproxy.QuicProxy
+	)
+
+	startListenerAndProxy := func(dropCallback quicproxy.DropCallback) {
+		var err error
+		// don't send a Retry, so that the handshake only takes 1 RTT
+		ln, err = quic.ListenAddr("localhost:0", getTLSConfig(), &quic.Config{
+			AcceptCookie: func(net.Addr, *quic.Cookie) bool { return true },
+		})
+		Expect(err).ToNot(HaveOccurred())
+		proxy, err = quicproxy.NewQuicProxy("localhost:0", &quicproxy.Opts{
+			RemoteAddr:  ln.Addr().String(),
+			DelayPacket: func(quicproxy.Direction, uint64) time.Duration { return rtt / 2 },
+			DropPacket:  dropCallback,
+		})
+		Expect(err).ToNot(HaveOccurred())
+	}
+
+	AfterEach(func() {
+		Expect(proxy.Close()).To(Succeed())
+		Expect(ln.Close()).To(Succeed())
+	})
+
+	// runServer accepts a session early, and sends data on a unidirectional stream.
+	runServer := func(data []byte) {
+		go func() {
+			defer GinkgoRecover()
+			sess, err := ln.AcceptEarly(context.Background())
+			Expect(err).ToNot(HaveOccurred())
+			Expect(sess.HandshakeComplete().Err()).ToNot(HaveOccurred())
+			str, err := sess.OpenUniStream()
+			Expect(err).ToNot(HaveOccurred())
+			_, err = str.Write(data)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(str.Close()).To(Succeed())
+			Eventually(sess.HandshakeComplete().Done(), 5*time.Second).Should(BeClosed())
+			Expect(sess.ConnectionState().HandshakeComplete).To(BeTrue())
+		}()
+	}
+
+	dial := func() quic.Session {
+		sess, err := quic.DialAddr(
+			fmt.Sprintf("localhost:%d", proxy.LocalPort()),
+			getTLSClientConfig(),
+			nil,
+		)
+		Expect(err).ToNot(HaveOccurred())
+		return sess
+	}
+
+	It("sends 0.5-RTT data", func() {
+		startListenerAndProxy(nil)
+		runServer([]byte("foobar"))
+
+		startTime := time.Now()
+		sess := dial()
+		str, err := sess.AcceptUniStream()
+		Expect(err).ToNot(HaveOccurred())
+		data, err := ioutil.ReadAll(str)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(data).To(Equal([]byte("foobar")))
+		// The data arrives together with the server's first flight.
+		// If it was sent after the handshake completed, this would take at least 1.5 RTTs.
+		Expect(time.Since(startTime)).To(BeNumerically("<", rtt*3/2))
+		Expect(sess.Close()).To(Succeed())
+	})
+
+	It("retransmits 0.5-RTT data that was lost", func() {
+		startListenerAndProxy(func(d quicproxy.Direction, p uint64) bool {
+			return d == quicproxy.DirectionOutgoing && p >= 3 && p%3 == 0 && p < 20
+		})
+		runServer(testserver.PRData)
+
+		sess := dial()
+		str, err := sess.AcceptUniStream()
+		Expect(err).ToNot(HaveOccurred())
+		data, err := ioutil.ReadAll(str)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(data).To(Equal(testserver.PRData))
+		Expect(sess.Close()).To(Succeed())
+	})
+})
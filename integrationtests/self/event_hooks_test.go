@@ -0,0 +1,124 @@
+package self_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"sync"
+
+	quic "github.com/lucas-clemente/quic-go"
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// eventRecorder records the events reported by the EventHooks.
+type eventRecorder struct {
+	mutex             sync.Mutex
+	handshakeComplete int
+	opened            []quic.StreamID
+	closed            []quic.StreamID
+	closeErrs         []error
+}
+
+func (r *eventRecorder) hooks() quic.EventHooks {
+	return quic.EventHooks{
+		OnHandshakeComplete: func(quic.Session) {
+			r.mutex.Lock()
+			r.handshakeComplete++
+			r.mutex.Unlock()
+		},
+		OnStreamOpened: func(id quic.StreamID) {
+			r.mutex.Lock()
+			r.opened = append(r.opened, id)
+			r.mutex.Unlock()
+		},
+		OnStreamClosed: func(id quic.StreamID, err error) {
+			r.mutex.Lock()
+			r.closed = append(r.closed, id)
+			r.closeErrs = append(r.closeErrs, err)
+			r.mutex.Unlock()
+		},
+	}
+}
+
+func (r *eventRecorder) numHandshakeComplete() int {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.handshakeComplete
+}
+
+func (r *eventRecorder) openedStreams() []quic.StreamID {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return append([]quic.StreamID(nil), r.opened...)
+}
+
+func (r *eventRecorder) closedStreams() []quic.StreamID {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return append([]quic.StreamID(nil), r.closed...)
+}
+
+func (r *eventRecorder) closeErrors() []error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return append([]error(nil), r.closeErrs...)
+}
+
+var _ = Describe("Event hooks", func() {
+	for _, v := range []protocol.VersionNumber{protocol.VersionTLS} {
+		version := v
+
+		Context(fmt.Sprintf("with QUIC %s", version), func() {
+			It("reports the handshake completion, and opened and closed streams", func() {
+				serverEvents := &eventRecorder{}
+				server, err := quic.ListenAddr(
+					"localhost:0",
+					getTLSConfig(),
+					&quic.Config{Versions: []protocol.VersionNumber{version}, EventHooks: serverEvents.hooks()},
+				)
+				Expect(err).ToNot(HaveOccurred())
+				defer server.Close()
+
+				go func() {
+					defer GinkgoRecover()
+					sess, err := server.Accept()
+					Expect(err).ToNot(HaveOccurred())
+					str, err := sess.AcceptStream()
+					Expect(err).ToNot(HaveOccurred())
+					data, err := ioutil.ReadAll(str)
+					Expect(err).ToNot(HaveOccurred())
+					_, err = str.Write(data)
+					Expect(err).ToNot(HaveOccurred())
+					Expect(str.Close()).To(Succeed())
+				}()
+
+				clientEvents := &eventRecorder{}
+				sess, err := quic.DialAddr(
+					fmt.Sprintf("localhost:%d", server.Addr().(*net.UDPAddr).Port),
+					getTLSClientConfig(),
+					&quic.Config{Versions: []protocol.VersionNumber{version}, EventHooks: clientEvents.hooks()},
+				)
+				Expect(err).ToNot(HaveOccurred())
+				defer sess.Close()
+				str, err := sess.OpenStream()
+				Expect(err).ToNot(HaveOccurred())
+				_, err = str.Write([]byte("foobar"))
+				Expect(err).ToNot(HaveOccurred())
+				Expect(str.Close()).To(Succeed())
+				data, err := ioutil.ReadAll(str)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(data).To(Equal([]byte("foobar")))
+
+				for _, events := range []*eventRecorder{clientEvents, serverEvents} {
+					Eventually(events.numHandshakeComplete).Should(Equal(1))
+					Expect(events.openedStreams()).To(Equal([]quic.StreamID{str.StreamID()}))
+					Eventually(events.closedStreams).Should(Equal([]quic.StreamID{str.StreamID()}))
+					Expect(events.closeErrors()).To(Equal([]error{nil}))
+				}
+			})
+		})
+	}
+})
@@ -0,0 +1,69 @@
+package self_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+
+	quic "github.com/lucas-clemente/quic-go"
+	"github.com/lucas-clemente/quic-go/integrationtests/tools/testserver"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("GREASE", func() {
+	runTest := func(serverGrease, clientGrease bool) {
+		ln, err := quic.ListenAddr(
+			"localhost:0",
+			getTLSConfig(),
+			&quic.Config{EnableFrameGreasing: serverGrease},
+		)
+		Expect(err).ToNot(HaveOccurred())
+		defer ln.Close()
+
+		done := make(chan struct{})
+		go func() {
+			defer GinkgoRecover()
+			defer close(done)
+			sess, err := ln.Accept()
+			Expect(err).ToNot(HaveOccurred())
+			str, err := sess.AcceptStream()
+			Expect(err).ToNot(HaveOccurred())
+			data, err := ioutil.ReadAll(str)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(data).To(Equal(testserver.PRData))
+			_, err = str.Write(testserver.PRData)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(str.Close()).To(Succeed())
+		}()
+
+		sess, err := quic.DialAddr(
+			fmt.Sprintf("localhost:%d", ln.Addr().(*net.UDPAddr).Port),
+			getTLSClientConfig(),
+			&quic.Config{EnableFrameGreasing: clientGrease},
+		)
+		Expect(err).ToNot(HaveOccurred())
+		defer sess.Close()
+		str, err := sess.OpenStream()
+		Expect(err).ToNot(HaveOccurred())
+		_, err = str.Write(testserver.PRData)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(str.Close()).To(Succeed())
+		data, err := ioutil.ReadAll(str)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(data).To(Equal(testserver.PRData))
+		Eventually(done).Should(BeClosed())
+	}
+
+	It("transfers data when both peers send GREASE frames", func() {
+		runTest(true, true)
+	})
+
+	It("doesn't send GREASE frames to a client that didn't enable them", func() {
+		runTest(true, false)
+	})
+
+	It("doesn't send GREASE frames to a server that didn't enable them", func() {
+		runTest(false, true)
+	})
+})
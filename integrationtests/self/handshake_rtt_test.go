@@ -9,7 +9,6 @@ import (
 	quicproxy "github.com/lucas-clemente/quic-go/integrationtests/tools/proxy"
 	"github.com/lucas-clemente/quic-go/internal/protocol"
 
-	"github.com/lucas-clemente/quic-go/internal/testdata"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 )
@@ -29,7 +28,7 @@ var _ = Describe("Handshake RTT tests", func() {
 	BeforeEach(func() {
 		acceptStopped = make(chan struct{})
 		serverConfig = &quic.Config{}
-		serverTLSConfig = testdata.GetTLSConfig()
+		serverTLSConfig = getTLSConfig()
 	})
 
 	AfterEach(func() {
@@ -97,6 +96,7 @@ var _ = Describe("Handshake RTT tests", func() {
 		clientTLSConfig = &tls.Config{
 			InsecureSkipVerify: true,
 			ServerName:         "localhost",
+			NextProtos:         []string{alpn},
 		}
 	})
 
@@ -1,7 +1,9 @@
 package self_test
 
 import (
+	"bytes"
 	"crypto/tls"
+	"errors"
 	"fmt"
 	"net"
 	"time"
@@ -31,7 +33,7 @@ var _ = Describe("Handshake tests", func() {
 		server = nil
 		acceptStopped = make(chan struct{})
 		serverConfig = &quic.Config{}
-		tlsServerConf = testdata.GetTLSConfig()
+		tlsServerConf = getTLSConfig()
 	})
 
 	AfterEach(func() {
@@ -78,7 +80,7 @@ var _ = Describe("Handshake tests", func() {
 				serverConfig.Versions = []protocol.VersionNumber{7, 8, protocol.SupportedVersions[0], 9}
 				server := runServer()
 				defer server.Close()
-				sess, err := quic.DialAddr(server.Addr().String(), &tls.Config{InsecureSkipVerify: true}, nil)
+				sess, err := quic.DialAddr(server.Addr().String(), &tls.Config{InsecureSkipVerify: true, NextProtos: []string{alpn}}, nil)
 				Expect(err).ToNot(HaveOccurred())
 				Expect(sess.(versioner).GetVersion()).To(Equal(protocol.SupportedVersions[0]))
 				Expect(sess.Close()).To(Succeed())
@@ -93,7 +95,7 @@ var _ = Describe("Handshake tests", func() {
 				conf := &quic.Config{
 					Versions: []protocol.VersionNumber{7, 8, 9, protocol.SupportedVersions[0], 10},
 				}
-				sess, err := quic.DialAddr(server.Addr().String(), &tls.Config{InsecureSkipVerify: true}, conf)
+				sess, err := quic.DialAddr(server.Addr().String(), &tls.Config{InsecureSkipVerify: true, NextProtos: []string{alpn}}, conf)
 				Expect(err).ToNot(HaveOccurred())
 				Expect(sess.(versioner).GetVersion()).To(Equal(protocol.SupportedVersions[0]))
 				Expect(sess.Close()).To(Succeed())
@@ -113,7 +115,7 @@ var _ = Describe("Handshake tests", func() {
 
 				BeforeEach(func() {
 					serverConfig.Versions = []protocol.VersionNumber{version}
-					tlsConf = &tls.Config{RootCAs: testdata.GetRootCA()}
+					tlsConf = getTLSClientConfig()
 					clientConfig = &quic.Config{
 						Versions: []protocol.VersionNumber{version},
 					}
@@ -141,6 +143,56 @@ var _ = Describe("Handshake tests", func() {
 					Expect(err).To(MatchError("CRYPTO_ERROR: x509: cannot validate certificate for 127.0.0.1 because it doesn't contain any IP SANs"))
 				})
 
+				It("returns the certificate chain presented by the client", func() {
+					ln, err := quic.ListenAddr(
+						"localhost:0",
+						&tls.Config{
+							Certificates: getTLSConfig().Certificates,
+							ClientAuth:   tls.RequireAndVerifyClientCert,
+							ClientCAs:    testdata.GetRootCA(),
+							NextProtos:   []string{alpn},
+						},
+						serverConfig,
+					)
+					Expect(err).ToNot(HaveOccurred())
+					defer ln.Close()
+
+					serverSess := make(chan quic.Session, 1)
+					go func() {
+						defer GinkgoRecover()
+						sess, err := ln.Accept()
+						if err != nil { // the listener was closed
+							return
+						}
+						serverSess <- sess
+					}()
+
+					clientCert := getTLSConfig().Certificates[0]
+					tlsConf.Certificates = []tls.Certificate{clientCert}
+					sess, err := quic.DialAddr(
+						fmt.Sprintf("localhost:%d", ln.Addr().(*net.UDPAddr).Port),
+						tlsConf,
+						clientConfig,
+					)
+					Expect(err).ToNot(HaveOccurred())
+					defer sess.Close()
+					// the client sees the server's certificate
+					Expect(sess.PeerCertificates()).ToNot(BeEmpty())
+					Expect(sess.PeerCommonName()).To(Equal("localhost"))
+
+					var ssess quic.Session
+					Eventually(serverSess).Should(Receive(&ssess))
+					certs := ssess.PeerCertificates()
+					Expect(certs).To(HaveLen(len(clientCert.Certificate)))
+					for i, cert := range certs {
+						Expect(cert.Raw).To(Equal(clientCert.Certificate[i]))
+					}
+					Expect(ssess.VerifiedChains()).ToNot(BeEmpty())
+					Expect(ssess.VerifiedChains()[0][0].Raw).To(Equal(clientCert.Certificate[0]))
+					Expect(ssess.PeerCommonName()).To(Equal("localhost"))
+					Expect(ssess.ConnectionState().PeerCertificates).To(Equal(certs))
+				})
+
 				It("fails the handshake if the client fails to provide the requested client cert", func() {
 					tlsServerConf.ClientAuth = tls.RequireAndVerifyClientCert
 					sess, err := quic.DialAddr(
@@ -160,7 +212,38 @@ var _ = Describe("Handshake tests", func() {
 						}()
 						Eventually(errChan).Should(Receive(&err))
 					}
-					Expect(err).To(MatchError("CRYPTO_ERROR: tls: bad certificate"))
+					Expect(err).To(MatchError("CRYPTO_ERROR: tls: certificate required"))
+				})
+
+				Context("pinning the certificate", func() {
+					pinCertificate := func(pin []byte) func(tls.ConnectionState, quic.Session) error {
+						return func(state tls.ConnectionState, _ quic.Session) error {
+							if len(state.PeerCertificates) == 0 || !bytes.Equal(state.PeerCertificates[0].Raw, pin) {
+								return errors.New("unknown certificate")
+							}
+							return nil
+						}
+					}
+
+					It("accepts the pinned certificate", func() {
+						clientConfig.VerifyConnection = pinCertificate(tlsServerConf.Certificates[0].Certificate[0])
+						_, err := quic.DialAddr(
+							fmt.Sprintf("localhost:%d", server.Addr().(*net.UDPAddr).Port),
+							tlsConf,
+							clientConfig,
+						)
+						Expect(err).ToNot(HaveOccurred())
+					})
+
+					It("rejects a certificate that doesn't match the pin", func() {
+						clientConfig.VerifyConnection = pinCertificate([]byte("foobar"))
+						_, err := quic.DialAddr(
+							fmt.Sprintf("localhost:%d", server.Addr().(*net.UDPAddr).Port),
+							tlsConf,
+							clientConfig,
+						)
+						Expect(err).To(MatchError("CRYPTO_ERROR: unknown certificate"))
+					})
 				})
 
 				It("uses the ServerName in the tls.Config", func() {
@@ -176,13 +259,52 @@ var _ = Describe("Handshake tests", func() {
 		}
 	})
 
+	It("exports the same keying material on both endpoints", func() {
+		ln, err := quic.ListenAddr("localhost:0", tlsServerConf, serverConfig)
+		Expect(err).ToNot(HaveOccurred())
+		defer ln.Close()
+
+		serverSessChan := make(chan quic.Session, 1)
+		go func() {
+			defer GinkgoRecover()
+			sess, err := ln.Accept()
+			Expect(err).ToNot(HaveOccurred())
+			serverSessChan <- sess
+		}()
+
+		sess, err := quic.DialAddr(
+			fmt.Sprintf("localhost:%d", ln.Addr().(*net.UDPAddr).Port),
+			getTLSClientConfig(),
+			nil,
+		)
+		Expect(err).ToNot(HaveOccurred())
+		defer sess.Close()
+		var serverSess quic.Session
+		Eventually(serverSessChan).Should(Receive(&serverSess))
+
+		clientKey, err := sess.ExportKeyingMaterial("EXPORTER-quic-go-test", []byte("context"), 32)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(clientKey).To(HaveLen(32))
+		serverKey, err := serverSess.ExportKeyingMaterial("EXPORTER-quic-go-test", []byte("context"), 32)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(serverKey).To(Equal(clientKey))
+		// a different label leads to different keying material
+		otherKey, err := sess.ExportKeyingMaterial("EXPORTER-quic-go-other", []byte("context"), 32)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(otherKey).ToNot(Equal(clientKey))
+		// so does a different context
+		otherKey, err = sess.ExportKeyingMaterial("EXPORTER-quic-go-test", []byte("other context"), 32)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(otherKey).ToNot(Equal(clientKey))
+	})
+
 	Context("rate limiting", func() {
 		var server quic.Listener
 
 		dial := func() (quic.Session, error) {
 			return quic.DialAddr(
 				fmt.Sprintf("localhost:%d", server.Addr().(*net.UDPAddr).Port),
-				&tls.Config{RootCAs: testdata.GetRootCA()},
+				getTLSClientConfig(),
 				nil,
 			)
 		}
@@ -191,7 +313,7 @@ var _ = Describe("Handshake tests", func() {
 			serverConfig.AcceptCookie = func(net.Addr, *quic.Cookie) bool { return true }
 			var err error
 			// start the server, but don't call Accept
-			server, err = quic.ListenAddr("localhost:0", testdata.GetTLSConfig(), serverConfig)
+			server, err = quic.ListenAddr("localhost:0", getTLSConfig(), serverConfig)
 			Expect(err).ToNot(HaveOccurred())
 		})
 
@@ -200,7 +322,7 @@ var _ = Describe("Handshake tests", func() {
 		})
 
 		It("rejects new connection attempts if connections don't get accepted", func() {
-			for i := 0; i < protocol.MaxAcceptQueueSize; i++ {
+			for i := 0; i < protocol.DefaultAcceptQueueLength; i++ {
 				sess, err := dial()
 				Expect(err).ToNot(HaveOccurred())
 				defer sess.Close()
@@ -229,7 +351,7 @@ var _ = Describe("Handshake tests", func() {
 			firstSess, err := dial()
 			Expect(err).ToNot(HaveOccurred())
 
-			for i := 1; i < protocol.MaxAcceptQueueSize; i++ {
+			for i := 1; i < protocol.DefaultAcceptQueueLength; i++ {
 				sess, err := dial()
 				Expect(err).ToNot(HaveOccurred())
 				defer sess.Close()
@@ -254,5 +376,20 @@ var _ = Describe("Handshake tests", func() {
 			Expect(err.(*qerr.QuicError).ErrorCode).To(Equal(qerr.ServerBusy))
 		})
 
+		It("keeps the number of queued sessions bounded if sessions are never accepted", func() {
+			const num = 3 * protocol.DefaultAcceptQueueLength
+			var refused int
+			for i := 0; i < num; i++ {
+				sess, err := dial()
+				if err != nil {
+					Expect(err.(*qerr.QuicError).ErrorCode).To(Equal(qerr.ServerBusy))
+					refused++
+					continue
+				}
+				defer sess.Close()
+			}
+			Expect(refused).To(BeNumerically(">=", num-protocol.DefaultAcceptQueueLength))
+			Expect(server.Stats().RefusedSessions).To(BeEquivalentTo(refused))
+		})
 	})
 })
@@ -3,10 +3,16 @@ package self_test
 import (
 	"bytes"
 	"compress/gzip"
+	"context"
 	"crypto/tls"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"net"
 	"net/http"
+	"net/http/httptrace"
+	"net/textproto"
+	"strconv"
 	"time"
 
 	quic "github.com/lucas-clemente/quic-go"
@@ -94,6 +100,108 @@ var _ = Describe("HTTP tests", func() {
 				Expect(resp.Header.Get("lorem")).To(Equal("ipsum"))
 			})
 
+			It("exposes the connection state", func() {
+				http.HandleFunc("/connstate", func(w http.ResponseWriter, r *http.Request) {
+					defer GinkgoRecover()
+					Expect(r.TLS).ToNot(BeNil())
+					Expect(r.TLS.HandshakeComplete).To(BeTrue())
+					Expect(r.RemoteAddr).ToNot(BeEmpty())
+					state, ok := http3.ServerConnectionState(r.Context())
+					Expect(ok).To(BeTrue())
+					Expect(state.Stats.SmoothedRTT).ToNot(BeZero())
+					w.Write([]byte(state.TLS.NegotiatedProtocol))
+				})
+
+				resp, err := client.Get("https://localhost:" + testserver.Port() + "/connstate")
+				Expect(err).ToNot(HaveOccurred())
+				Expect(resp.StatusCode).To(Equal(200))
+				body, err := ioutil.ReadAll(resp.Body)
+				Expect(err).ToNot(HaveOccurred())
+				state, ok := http3.ResponseConnectionState(resp)
+				Expect(ok).To(BeTrue())
+				Expect(string(body)).To(Equal(state.TLS.NegotiatedProtocol))
+				Expect(state.RemoteAddr.String()).To(HaveSuffix(testserver.Port()))
+			})
+
+			It("sends 103 Early Hints before the response", func() {
+				http.HandleFunc("/earlyhints", func(w http.ResponseWriter, r *http.Request) {
+					defer GinkgoRecover()
+					w.Header().Set("Link", "</style.css>; rel=preload; as=style")
+					w.WriteHeader(103)
+					w.Header().Del("Link")
+					w.Header().Set("Content-Type", "text/plain")
+					w.Write([]byte("foobar"))
+				})
+
+				var earlyHints []textproto.MIMEHeader
+				trace := &httptrace.ClientTrace{
+					Got1xxResponse: func(code int, header textproto.MIMEHeader) error {
+						defer GinkgoRecover()
+						Expect(code).To(Equal(103))
+						earlyHints = append(earlyHints, header)
+						return nil
+					},
+				}
+				req, err := http.NewRequest(http.MethodGet, "https://localhost:"+testserver.Port()+"/earlyhints", nil)
+				Expect(err).ToNot(HaveOccurred())
+				resp, err := client.Do(req.WithContext(httptrace.WithClientTrace(context.Background(), trace)))
+				Expect(err).ToNot(HaveOccurred())
+				Expect(earlyHints).To(HaveLen(1))
+				Expect(earlyHints[0].Get("Link")).To(Equal("</style.css>; rel=preload; as=style"))
+				Expect(resp.StatusCode).To(Equal(200))
+				Expect(resp.Header.Get("Link")).To(BeEmpty())
+				Expect(resp.Header.Get("Content-Type")).To(Equal("text/plain"))
+				body, err := ioutil.ReadAll(gbytes.TimeoutReader(resp.Body, 3*time.Second))
+				Expect(err).ToNot(HaveOccurred())
+				Expect(string(body)).To(Equal("foobar"))
+			})
+
+			It("serves high priority responses first", func() {
+				http.HandleFunc("/priority", func(w http.ResponseWriter, r *http.Request) {
+					defer GinkgoRecover()
+					prio, ok := http3.PriorityFromContext(r.Context())
+					Expect(ok).To(BeTrue())
+					l, err := strconv.Atoi(r.URL.Query().Get("len"))
+					Expect(err).ToNot(HaveOccurred())
+					w.Header().Set("Urgency", strconv.Itoa(int(prio.Urgency)))
+					w.Write(testserver.GeneratePRData(l)) // don't check the error here. Stream may be reset.
+				})
+
+				get := func(l int, urgency uint8) *http.Response {
+					req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("https://localhost:%s/priority?len=%d", testserver.Port(), l), nil)
+					Expect(err).ToNot(HaveOccurred())
+					resp, err := client.Do(req.WithContext(http3.WithPriority(context.Background(), urgency, false)))
+					Expect(err).ToNot(HaveOccurred())
+					Expect(resp.StatusCode).To(Equal(200))
+					Expect(resp.Header.Get("Urgency")).To(Equal(strconv.Itoa(int(urgency))))
+					return resp
+				}
+				readAll := func(resp *http.Response, l int, done chan<- time.Time) {
+					defer GinkgoRecover()
+					body, err := ioutil.ReadAll(gbytes.TimeoutReader(resp.Body, 20*time.Second))
+					Expect(err).ToNot(HaveOccurred())
+					Expect(body).To(HaveLen(l))
+					done <- time.Now()
+				}
+
+				const largeLen = 5 << 20
+				const smallLen = 100 << 10
+				large := get(largeLen, 7)
+				// make sure that the large response is already being sent
+				_, err := io.ReadFull(large.Body, make([]byte, 1000))
+				Expect(err).ToNot(HaveOccurred())
+				small := get(smallLen, 0)
+
+				largeDone := make(chan time.Time, 1)
+				smallDone := make(chan time.Time, 1)
+				go readAll(large, largeLen-1000, largeDone)
+				go readAll(small, smallLen, smallDone)
+				var largeTime, smallTime time.Time
+				Eventually(largeDone, 30*time.Second).Should(Receive(&largeTime))
+				Eventually(smallDone).Should(Receive(&smallTime))
+				Expect(smallTime).To(BeTemporally("<", largeTime))
+			})
+
 			It("downloads a small file", func() {
 				resp, err := client.Get("https://localhost:" + testserver.Port() + "/prdata")
 				Expect(err).ToNot(HaveOccurred())
@@ -162,6 +270,353 @@ var _ = Describe("HTTP tests", func() {
 				Expect(body).To(Equal(testserver.PRData))
 			})
 
+			It("streams a request body of unknown length", func() {
+				pr, pw := io.Pipe()
+				go func() {
+					defer GinkgoRecover()
+					defer pw.Close()
+					data := testserver.PRData
+					for len(data) > 0 {
+						n := 1000
+						if n > len(data) {
+							n = len(data)
+						}
+						_, err := pw.Write(data[:n])
+						Expect(err).ToNot(HaveOccurred())
+						data = data[n:]
+					}
+				}()
+				resp, err := client.Post("https://localhost:"+testserver.Port()+"/echo", "application/octet-stream", pr)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(resp.StatusCode).To(Equal(200))
+				body, err := ioutil.ReadAll(gbytes.TimeoutReader(resp.Body, 5*time.Second))
+				Expect(err).ToNot(HaveOccurred())
+				Expect(body).To(Equal(testserver.PRData))
+			})
+
+			It("aborts the upload when the server responds with an error", func() {
+				http.HandleFunc("/forbidden", func(w http.ResponseWriter, r *http.Request) {
+					w.WriteHeader(http.StatusForbidden)
+				})
+
+				pr, pw := io.Pipe()
+				writeErr := make(chan error, 1)
+				go func() {
+					defer GinkgoRecover()
+					// never finish the body
+					for {
+						if _, err := pw.Write([]byte("foobar")); err != nil {
+							writeErr <- err
+							return
+						}
+					}
+				}()
+				resp, err := client.Post("https://localhost:"+testserver.Port()+"/forbidden", "application/octet-stream", pr)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(resp.StatusCode).To(Equal(http.StatusForbidden))
+				Eventually(writeErr).Should(Receive(Equal(io.ErrClosedPipe)))
+			})
+
+			It("uses Expect: 100-continue", func() {
+				req, err := http.NewRequest("POST", "https://localhost:"+testserver.Port()+"/echo", bytes.NewReader([]byte("Hello, world!")))
+				Expect(err).ToNot(HaveOccurred())
+				req.Header.Set("Expect", "100-continue")
+				start := time.Now()
+				resp, err := client.Do(req)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(resp.StatusCode).To(Equal(200))
+				body, err := ioutil.ReadAll(gbytes.TimeoutReader(resp.Body, 5*time.Second))
+				Expect(err).ToNot(HaveOccurred())
+				Expect(body).To(Equal([]byte("Hello, world!")))
+				// the client didn't wait for the timeout, but sent the body after receiving the 100 Continue
+				Expect(time.Since(start)).To(BeNumerically("<", 500*time.Millisecond))
+			})
+
+			It("sends trailers", func() {
+				http.HandleFunc("/trailers", func(w http.ResponseWriter, r *http.Request) {
+					defer GinkgoRecover()
+					Expect(r.Trailer).To(HaveKey("Request-Checksum"))
+					body, err := ioutil.ReadAll(r.Body)
+					Expect(err).ToNot(HaveOccurred())
+					Expect(body).To(Equal([]byte("foobar")))
+					Expect(r.Trailer.Get("Request-Checksum")).To(Equal("foobar"))
+
+					w.Header().Set("Trailer", "Response-Checksum, Empty")
+					for _, chunk := range []string{"lorem", "ipsum", "dolor"} {
+						w.Write([]byte(chunk))
+						w.(http.Flusher).Flush()
+					}
+					w.Header().Set("Response-Checksum", "loremipsumdolor")
+				})
+
+				pr, pw := io.Pipe()
+				go func() {
+					defer GinkgoRecover()
+					pw.Write([]byte("foo"))
+					pw.Write([]byte("bar"))
+					pw.Close()
+				}()
+				req, err := http.NewRequest(http.MethodPost, "https://localhost:"+testserver.Port()+"/trailers", pr)
+				Expect(err).ToNot(HaveOccurred())
+				req.Trailer = http.Header{"Request-Checksum": []string{"foobar"}}
+				resp, err := client.Do(req)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(resp.StatusCode).To(Equal(200))
+				Expect(resp.Trailer).To(Equal(http.Header{"Response-Checksum": nil, "Empty": nil}))
+				body, err := ioutil.ReadAll(gbytes.TimeoutReader(resp.Body, 3*time.Second))
+				Expect(err).ToNot(HaveOccurred())
+				Expect(string(body)).To(Equal("loremipsumdolor"))
+				Expect(resp.Trailer).To(Equal(http.Header{
+					"Response-Checksum": []string{"loremipsumdolor"},
+					"Empty":             nil,
+				}))
+			})
+
+			It("hijacks the request stream", func() {
+				http.HandleFunc("/hijack", func(w http.ResponseWriter, r *http.Request) {
+					defer GinkgoRecover()
+					w.WriteHeader(200)
+					str, err := w.(http3.Hijacker).HijackStream()
+					Expect(err).ToNot(HaveOccurred())
+					data, err := ioutil.ReadAll(str)
+					Expect(err).ToNot(HaveOccurred())
+					_, err = str.Write(bytes.ToUpper(data))
+					Expect(err).ToNot(HaveOccurred())
+					Expect(str.Close()).To(Succeed())
+				})
+
+				req, err := http.NewRequest(http.MethodGet, "https://localhost:"+testserver.Port()+"/hijack", nil)
+				Expect(err).ToNot(HaveOccurred())
+				resp, err := client.Transport.(*http3.RoundTripper).RoundTripOpt(req, http3.RoundTripOpt{HijackStream: true})
+				Expect(err).ToNot(HaveOccurred())
+				Expect(resp.StatusCode).To(Equal(200))
+				str, err := resp.Body.(http3.Hijacker).HijackStream()
+				Expect(err).ToNot(HaveOccurred())
+				_, err = str.Write([]byte("foobar"))
+				Expect(err).ToNot(HaveOccurred())
+				Expect(str.Close()).To(Succeed())
+				data, err := ioutil.ReadAll(gbytes.TimeoutReader(str, 3*time.Second))
+				Expect(err).ToNot(HaveOccurred())
+				Expect(data).To(Equal([]byte("FOOBAR")))
+			})
+
+			It("tunnels a TCP connection using CONNECT", func() {
+				// a TCP echo server
+				ln, err := net.Listen("tcp", "127.0.0.1:0")
+				Expect(err).ToNot(HaveOccurred())
+				defer ln.Close()
+				go func() {
+					defer GinkgoRecover()
+					conn, err := ln.Accept()
+					Expect(err).ToNot(HaveOccurred())
+					io.Copy(conn, conn)
+					conn.Close()
+				}()
+
+				proxy := &http3.Server{
+					Server: &http.Server{
+						TLSConfig: testdata.GetTLSConfig(),
+						Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+							defer GinkgoRecover()
+							Expect(r.Method).To(Equal(http.MethodConnect))
+							conn, err := net.Dial("tcp", r.Host)
+							Expect(err).ToNot(HaveOccurred())
+							defer conn.Close()
+							w.WriteHeader(http.StatusOK)
+							w.(http.Flusher).Flush()
+							go func() {
+								io.Copy(conn, r.Body)
+								conn.(*net.TCPConn).CloseWrite()
+							}()
+							b := make([]byte, 1024)
+							for {
+								n, err := conn.Read(b)
+								if n > 0 {
+									w.Write(b[:n])
+									w.(http.Flusher).Flush()
+								}
+								if err != nil {
+									return
+								}
+							}
+						}),
+					},
+				}
+				udpConn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+				Expect(err).ToNot(HaveOccurred())
+				defer udpConn.Close()
+				go proxy.Serve(udpConn)
+				defer proxy.Close()
+
+				req, err := http.NewRequest(http.MethodConnect, fmt.Sprintf("https://localhost:%d", udpConn.LocalAddr().(*net.UDPAddr).Port), nil)
+				Expect(err).ToNot(HaveOccurred())
+				req.Host = ln.Addr().String()
+				resp, err := client.Do(req)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(resp.StatusCode).To(Equal(200))
+				tunnel := resp.Body.(io.ReadWriteCloser)
+				_, err = tunnel.Write([]byte("foobar"))
+				Expect(err).ToNot(HaveOccurred())
+				data := make([]byte, 6)
+				_, err = io.ReadFull(gbytes.TimeoutReader(tunnel, 3*time.Second), data)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(data).To(Equal([]byte("foobar")))
+				_, err = tunnel.Write([]byte("lorem ipsum"))
+				Expect(err).ToNot(HaveOccurred())
+				Expect(tunnel.(interface{ CloseWrite() error }).CloseWrite()).To(Succeed())
+				// the echo server closes the connection after echoing all data
+				data, err = ioutil.ReadAll(gbytes.TimeoutReader(tunnel, 3*time.Second))
+				Expect(err).ToNot(HaveOccurred())
+				Expect(data).To(Equal([]byte("lorem ipsum")))
+				Expect(tunnel.Close()).To(Succeed())
+			})
+
+			It("establishes WebTransport sessions", func() {
+				server := &http3.Server{
+					Server:             &http.Server{TLSConfig: testdata.GetTLSConfig()},
+					EnableWebTransport: true,
+				}
+				serverSessClosed := make(chan struct{})
+				server.HandleWebTransport("/webtransport", func(sess *http3.WebTransportSession, r *http.Request) {
+					defer GinkgoRecover()
+					Expect(r.Header.Get("Origin")).To(Equal("https://example.com"))
+					// echo the client's stream on a stream opened by the server
+					str, err := sess.AcceptStream()
+					Expect(err).ToNot(HaveOccurred())
+					data, err := ioutil.ReadAll(gbytes.TimeoutReader(str, 3*time.Second))
+					Expect(err).ToNot(HaveOccurred())
+					Expect(str.Close()).To(Succeed())
+					rstr, err := sess.OpenStream()
+					Expect(err).ToNot(HaveOccurred())
+					_, err = rstr.Write(bytes.ToUpper(data))
+					Expect(err).ToNot(HaveOccurred())
+					Expect(rstr.Close()).To(Succeed())
+					// echo the client's datagram
+					p, err := sess.ReceiveDatagram()
+					Expect(err).ToNot(HaveOccurred())
+					Expect(sess.SendDatagram(bytes.ToUpper(p))).To(Succeed())
+					// the client closes the session
+					Eventually(sess.Context().Done(), 3*time.Second).Should(BeClosed())
+					close(serverSessClosed)
+				})
+				udpConn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+				Expect(err).ToNot(HaveOccurred())
+				defer udpConn.Close()
+				go server.Serve(udpConn)
+				defer server.Close()
+
+				rt := &http3.RoundTripper{
+					TLSClientConfig:    &tls.Config{RootCAs: testdata.GetRootCA()},
+					QuicConfig:         &quic.Config{Versions: []protocol.VersionNumber{version}},
+					EnableWebTransport: true,
+				}
+				defer rt.Close()
+				url := fmt.Sprintf("https://localhost:%d", udpConn.LocalAddr().(*net.UDPAddr).Port)
+				// no handler registered for this path
+				resp, _, err := rt.DialWebTransport(context.Background(), url+"/unknown", nil)
+				Expect(err).To(HaveOccurred())
+				Expect(resp.StatusCode).To(Equal(http.StatusNotFound))
+
+				resp, sess, err := rt.DialWebTransport(context.Background(), url+"/webtransport", http.Header{"Origin": []string{"https://example.com"}})
+				Expect(err).ToNot(HaveOccurred())
+				Expect(resp.StatusCode).To(Equal(http.StatusOK))
+				str, err := sess.OpenStream()
+				Expect(err).ToNot(HaveOccurred())
+				_, err = str.Write([]byte("foobar"))
+				Expect(err).ToNot(HaveOccurred())
+				Expect(str.Close()).To(Succeed())
+				rstr, err := sess.AcceptStream()
+				Expect(err).ToNot(HaveOccurred())
+				data, err := ioutil.ReadAll(gbytes.TimeoutReader(rstr, 3*time.Second))
+				Expect(err).ToNot(HaveOccurred())
+				Expect(data).To(Equal([]byte("FOOBAR")))
+
+				Expect(sess.SendDatagram([]byte("lorem ipsum"))).To(Succeed())
+				p, err := sess.ReceiveDatagram()
+				Expect(err).ToNot(HaveOccurred())
+				Expect(p).To(Equal([]byte("LOREM IPSUM")))
+				Expect(sess.Close()).To(Succeed())
+				Expect(sess.Context().Done()).To(BeClosed())
+				Eventually(serverSessClosed).Should(BeClosed())
+			})
+
+			It("shuts down gracefully", func() {
+				handlerStarted := make(chan struct{})
+				unblock := make(chan struct{})
+				http.HandleFunc("/shutdown", func(w http.ResponseWriter, r *http.Request) {
+					defer GinkgoRecover()
+					close(handlerStarted)
+					<-unblock
+					w.Write([]byte("done"))
+				})
+
+				done := make(chan struct{})
+				go func() {
+					defer GinkgoRecover()
+					defer close(done)
+					resp, err := client.Get("https://localhost:" + testserver.Port() + "/shutdown")
+					Expect(err).ToNot(HaveOccurred())
+					Expect(resp.StatusCode).To(Equal(200))
+					body, err := ioutil.ReadAll(gbytes.TimeoutReader(resp.Body, 3*time.Second))
+					Expect(err).ToNot(HaveOccurred())
+					Expect(string(body)).To(Equal("done"))
+					Expect(resp.Body.Close()).To(Succeed())
+				}()
+
+				Eventually(handlerStarted).Should(BeClosed())
+				shutdownErr := make(chan error, 1)
+				go func() {
+					ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+					defer cancel()
+					shutdownErr <- testserver.ShutdownQuicServer(ctx)
+				}()
+				// the server waits for the request to complete
+				Consistently(shutdownErr, 200*time.Millisecond).ShouldNot(Receive())
+				close(unblock)
+				Eventually(done).Should(BeClosed())
+				// the client closes the session after receiving the response
+				Eventually(shutdownErr, 5*time.Second).Should(Receive(BeNil()))
+			})
+
+			It("cancels requests", func() {
+				handlerCanceled := make(chan struct{})
+				http.HandleFunc("/cancel", func(w http.ResponseWriter, r *http.Request) {
+					defer GinkgoRecover()
+					defer close(handlerCanceled)
+					// stream the response, until the client cancels the request
+					for {
+						if _, err := w.Write([]byte("foobar")); err != nil {
+							break
+						}
+						w.(http.Flusher).Flush()
+						select {
+						case <-r.Context().Done():
+						case <-time.After(10 * time.Millisecond):
+							continue
+						}
+						break
+					}
+					Eventually(r.Context().Done()).Should(BeClosed())
+					_, err := w.Write([]byte("foobar"))
+					Expect(err).To(HaveOccurred())
+				})
+
+				ctx, cancel := context.WithCancel(context.Background())
+				req, err := http.NewRequest(http.MethodGet, "https://localhost:"+testserver.Port()+"/cancel", nil)
+				Expect(err).ToNot(HaveOccurred())
+				resp, err := client.Do(req.WithContext(ctx))
+				Expect(err).ToNot(HaveOccurred())
+				Expect(resp.StatusCode).To(Equal(200))
+				data := make([]byte, 6)
+				_, err = io.ReadFull(resp.Body, data)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(data).To(Equal([]byte("foobar")))
+				cancel()
+				_, err = ioutil.ReadAll(gbytes.TimeoutReader(resp.Body, 3*time.Second))
+				Expect(err).To(MatchError(context.Canceled))
+				Eventually(handlerCanceled).Should(BeClosed())
+			})
+
 			It("uses gzip compression", func() {
 				http.HandleFunc("/gzipped/hello", func(w http.ResponseWriter, r *http.Request) {
 					defer GinkgoRecover()
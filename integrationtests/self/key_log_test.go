@@ -0,0 +1,139 @@
+package self_test
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"strings"
+	"sync"
+
+	quic "github.com/lucas-clemente/quic-go"
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+	"github.com/lucas-clemente/quic-go/internal/testdata"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// lockedBuffer is a bytes.Buffer that can be used concurrently.
+type lockedBuffer struct {
+	mutex sync.Mutex
+	buf   bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.buf.String()
+}
+
+type keyLogLine struct {
+	clientRandom []byte
+	secret       []byte
+}
+
+// parseKeyLog parses a key log in the NSS Key Log Format.
+// It returns the lines indexed by their label.
+func parseKeyLog(keyLog string) map[string]keyLogLine {
+	lines := make(map[string]keyLogLine)
+	scanner := bufio.NewScanner(strings.NewReader(keyLog))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		ExpectWithOffset(1, fields).To(HaveLen(3))
+		clientRandom, err := hex.DecodeString(fields[1])
+		ExpectWithOffset(1, err).ToNot(HaveOccurred())
+		secret, err := hex.DecodeString(fields[2])
+		ExpectWithOffset(1, err).ToNot(HaveOccurred())
+		ExpectWithOffset(1, lines).ToNot(HaveKey(fields[0]))
+		lines[fields[0]] = keyLogLine{clientRandom: clientRandom, secret: secret}
+	}
+	ExpectWithOffset(1, scanner.Err()).ToNot(HaveOccurred())
+	return lines
+}
+
+var _ = Describe("Key Log", func() {
+	labels := []string{
+		"CLIENT_HANDSHAKE_TRAFFIC_SECRET",
+		"SERVER_HANDSHAKE_TRAFFIC_SECRET",
+		"CLIENT_TRAFFIC_SECRET_0",
+		"SERVER_TRAFFIC_SECRET_0",
+	}
+
+	for _, v := range []protocol.VersionNumber{protocol.VersionTLS} {
+		version := v
+
+		Context(fmt.Sprintf("with QUIC %s", version), func() {
+			It("writes the traffic secrets", func() {
+				serverKeyLog := &lockedBuffer{}
+				tlsConf := getTLSConfig()
+				tlsConf.KeyLogWriter = serverKeyLog
+				server, err := quic.ListenAddr(
+					"localhost:0",
+					tlsConf,
+					&quic.Config{Versions: []protocol.VersionNumber{version}},
+				)
+				Expect(err).ToNot(HaveOccurred())
+				defer server.Close()
+
+				go func() {
+					defer GinkgoRecover()
+					sess, err := server.Accept()
+					Expect(err).ToNot(HaveOccurred())
+					str, err := sess.OpenUniStream()
+					Expect(err).ToNot(HaveOccurred())
+					_, err = str.Write([]byte("foobar"))
+					Expect(err).ToNot(HaveOccurred())
+					Expect(str.Close()).To(Succeed())
+				}()
+
+				clientKeyLog := &lockedBuffer{}
+				sess, err := quic.DialAddr(
+					fmt.Sprintf("localhost:%d", server.Addr().(*net.UDPAddr).Port),
+					&tls.Config{
+						RootCAs:      testdata.GetRootCA(),
+						KeyLogWriter: clientKeyLog,
+						NextProtos:   []string{alpn},
+					},
+					&quic.Config{Versions: []protocol.VersionNumber{version}},
+				)
+				Expect(err).ToNot(HaveOccurred())
+				defer sess.Close()
+				str, err := sess.AcceptUniStream()
+				Expect(err).ToNot(HaveOccurred())
+				data, err := ioutil.ReadAll(str)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(data).To(Equal([]byte("foobar")))
+
+				// The size of the secrets is the output size of the hash function of the cipher suite.
+				secretSize := 32
+				if sess.ConnectionState().CipherSuite == tls.TLS_AES_256_GCM_SHA384 {
+					secretSize = 48
+				}
+				clientLines := parseKeyLog(clientKeyLog.String())
+				// The server writes its last secret after receiving the client's Finished.
+				Eventually(func() int { return len(parseKeyLog(serverKeyLog.String())) }).Should(Equal(len(labels)))
+				serverLines := parseKeyLog(serverKeyLog.String())
+				Expect(clientLines).To(HaveLen(len(labels)))
+				for _, label := range labels {
+					Expect(clientLines).To(HaveKey(label))
+					line := clientLines[label]
+					Expect(line.clientRandom).To(HaveLen(32))
+					Expect(line.clientRandom).To(Equal(clientLines[labels[0]].clientRandom))
+					Expect(line.secret).To(HaveLen(secretSize))
+					// client and server must log the same secrets
+					Expect(serverLines[label]).To(Equal(line))
+				}
+			})
+		})
+	}
+})
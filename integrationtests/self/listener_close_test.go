@@ -0,0 +1,77 @@
+package self_test
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"time"
+
+	quic "github.com/lucas-clemente/quic-go"
+	"github.com/lucas-clemente/quic-go/integrationtests/tools/testserver"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Closing the listener", func() {
+	var ln quic.Listener
+
+	BeforeEach(func() {
+		var err error
+		ln, err = quic.ListenAddr("localhost:0", getTLSConfig(), nil)
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	dial := func() quic.Session {
+		sess, err := quic.DialAddr(
+			fmt.Sprintf("localhost:%d", ln.Addr().(*net.UDPAddr).Port),
+			getTLSClientConfig(),
+			nil,
+		)
+		Expect(err).ToNot(HaveOccurred())
+		return sess
+	}
+
+	It("completes a transfer after the listener was closed", func() {
+		go func() {
+			defer GinkgoRecover()
+			sess, err := ln.Accept()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(ln.Close()).To(Succeed())
+			_, err = ln.Accept()
+			Expect(err).To(HaveOccurred())
+			str, err := sess.OpenStream()
+			Expect(err).ToNot(HaveOccurred())
+			_, err = str.Write(testserver.PRData)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(str.Close()).To(Succeed())
+		}()
+
+		sess := dial()
+		str, err := sess.AcceptStream()
+		Expect(err).ToNot(HaveOccurred())
+		data, err := ioutil.ReadAll(str)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(data).To(Equal(testserver.PRData))
+		Expect(sess.Close()).To(Succeed())
+	})
+
+	It("closes the remaining sessions on Shutdown", func() {
+		accepted := make(chan struct{})
+		go func() {
+			defer GinkgoRecover()
+			_, err := ln.Accept()
+			Expect(err).ToNot(HaveOccurred())
+			close(accepted)
+		}()
+
+		sess := dial()
+		Eventually(accepted).Should(BeClosed())
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		Expect(ln.Shutdown(ctx)).To(MatchError(context.DeadlineExceeded))
+		// the server closed the session
+		_, err := sess.AcceptStream()
+		Expect(err).To(HaveOccurred())
+	})
+})
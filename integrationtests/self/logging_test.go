@@ -0,0 +1,140 @@
+package self_test
+
+import (
+	"bufio"
+	"crypto/rand"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"strings"
+	"sync"
+
+	quic "github.com/lucas-clemente/quic-go"
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// debugConnIDGenerator enables debug logging for the connection IDs it generates,
+// until stopDebugging is called.
+// This includes the connection ID used for the Retry, if the server sends one.
+type debugConnIDGenerator struct {
+	logger *quic.StandardLogger
+
+	mutex   sync.Mutex
+	stopped bool
+	connIDs []quic.ConnectionID
+}
+
+func (g *debugConnIDGenerator) GenerateConnectionID() (quic.ConnectionID, error) {
+	b := make([]byte, g.ConnectionIDLen())
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	connID := quic.ConnectionID(b)
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	if !g.stopped {
+		g.connIDs = append(g.connIDs, connID)
+		g.logger.SetConnectionLevel(connID, quic.LogLevelDebug)
+	}
+	return connID, nil
+}
+
+func (g *debugConnIDGenerator) ConnectionIDLen() int { return 8 }
+
+func (g *debugConnIDGenerator) stopDebugging() {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	g.stopped = true
+}
+
+func (g *debugConnIDGenerator) debugConnIDs() []quic.ConnectionID {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	return g.connIDs
+}
+
+var _ = Describe("Logging", func() {
+	for _, v := range []protocol.VersionNumber{protocol.VersionTLS} {
+		version := v
+
+		Context(fmt.Sprintf("with QUIC %s", version), func() {
+			It("enables debug logging for a single connection", func() {
+				buf := &lockedBuffer{}
+				logger := quic.NewStandardLogger(buf, quic.LogLevelError)
+				connIDGenerator := &debugConnIDGenerator{logger: logger}
+				server, err := quic.ListenAddr(
+					"localhost:0",
+					getTLSConfig(),
+					&quic.Config{
+						Versions:              []protocol.VersionNumber{version},
+						ConnectionIDGenerator: connIDGenerator,
+						Logger:                logger,
+					},
+				)
+				Expect(err).ToNot(HaveOccurred())
+				defer server.Close()
+
+				go func() {
+					defer GinkgoRecover()
+					for {
+						sess, err := server.Accept()
+						if err != nil {
+							return
+						}
+						go func() {
+							defer GinkgoRecover()
+							str, err := sess.AcceptStream()
+							Expect(err).ToNot(HaveOccurred())
+							_, err = str.Write([]byte("foobar"))
+							Expect(err).ToNot(HaveOccurred())
+							Expect(str.Close()).To(Succeed())
+						}()
+					}
+				}()
+
+				for i := 0; i < 2; i++ {
+					sess, err := quic.DialAddr(
+						fmt.Sprintf("localhost:%d", server.Addr().(*net.UDPAddr).Port),
+						getTLSClientConfig(),
+						&quic.Config{Versions: []protocol.VersionNumber{version}},
+					)
+					Expect(err).ToNot(HaveOccurred())
+					// only debug the first connection
+					connIDGenerator.stopDebugging()
+					str, err := sess.OpenStreamSync()
+					Expect(err).ToNot(HaveOccurred())
+					_, err = str.Write([]byte("ping"))
+					Expect(err).ToNot(HaveOccurred())
+					data, err := ioutil.ReadAll(str)
+					Expect(err).ToNot(HaveOccurred())
+					Expect(data).To(Equal([]byte("foobar")))
+					Expect(sess.Close()).To(Succeed())
+				}
+
+				connIDs := connIDGenerator.debugConnIDs()
+				Expect(connIDs).ToNot(BeEmpty())
+				var numDebugMessages int
+				scanner := bufio.NewScanner(strings.NewReader(buf.String()))
+				for scanner.Scan() {
+					line := scanner.Text()
+					if !strings.Contains(line, "level=debug") {
+						continue
+					}
+					numDebugMessages++
+					var isDebugConn bool
+					for _, connID := range connIDs {
+						if strings.Contains(line, "perspective=server conn="+connID.String()) {
+							isDebugConn = true
+						}
+					}
+					Expect(isDebugConn).To(BeTrue(), line)
+				}
+				Expect(scanner.Err()).ToNot(HaveOccurred())
+				Expect(numDebugMessages).ToNot(BeZero())
+			})
+		})
+	}
+})
@@ -0,0 +1,76 @@
+package self_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+
+	quic "github.com/lucas-clemente/quic-go"
+	"github.com/lucas-clemente/quic-go/integrationtests/tools/testserver"
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Metrics", func() {
+	for _, v := range []protocol.VersionNumber{protocol.VersionTLS} {
+		version := v
+
+		Context(fmt.Sprintf("with QUIC %s", version), func() {
+			It("collects metrics", func() {
+				serverMetrics := &quic.Metrics{}
+				server, err := quic.ListenAddr(
+					"localhost:0",
+					getTLSConfig(),
+					&quic.Config{Versions: []protocol.VersionNumber{version}, MetricsCollector: serverMetrics},
+				)
+				Expect(err).ToNot(HaveOccurred())
+				defer server.Close()
+
+				serverSessClosed := make(chan struct{})
+				go func() {
+					defer GinkgoRecover()
+					sess, err := server.Accept()
+					Expect(err).ToNot(HaveOccurred())
+					str, err := sess.OpenUniStream()
+					Expect(err).ToNot(HaveOccurred())
+					_, err = str.Write(testserver.PRData)
+					Expect(err).ToNot(HaveOccurred())
+					Expect(str.Close()).To(Succeed())
+					<-sess.Context().Done()
+					close(serverSessClosed)
+				}()
+
+				clientMetrics := &quic.Metrics{}
+				sess, err := quic.DialAddr(
+					fmt.Sprintf("localhost:%d", server.Addr().(*net.UDPAddr).Port),
+					getTLSClientConfig(),
+					&quic.Config{Versions: []protocol.VersionNumber{version}, MetricsCollector: clientMetrics},
+				)
+				Expect(err).ToNot(HaveOccurred())
+				str, err := sess.AcceptUniStream()
+				Expect(err).ToNot(HaveOccurred())
+				data, err := ioutil.ReadAll(str)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(data).To(Equal(testserver.PRData))
+				Expect(sess.Close()).To(Succeed())
+				Eventually(serverSessClosed).Should(BeClosed())
+
+				for _, m := range []*quic.Metrics{clientMetrics, serverMetrics} {
+					snapshot := m.Snapshot()
+					Expect(snapshot.ConnectionsStarted).To(BeEquivalentTo(1))
+					Expect(snapshot.HandshakesCompleted).To(BeEquivalentTo(1))
+					Expect(snapshot.TotalHandshakeDuration).ToNot(BeZero())
+					for _, encLevel := range []quic.EncryptionLevel{protocol.EncryptionInitial, protocol.EncryptionHandshake, protocol.Encryption1RTT} {
+						Expect(snapshot.PacketsSent).To(HaveKey(encLevel))
+						Expect(snapshot.PacketsReceived).To(HaveKey(encLevel))
+					}
+				}
+				Expect(clientMetrics.Snapshot().BytesReceived[protocol.Encryption1RTT]).To(BeNumerically(">", len(testserver.PRData)))
+				Expect(clientMetrics.Snapshot().ConnectionsClosed).To(Equal(map[quic.ConnectionCloseReason]uint64{quic.CloseReasonLocal: 1}))
+				Eventually(func() map[quic.ConnectionCloseReason]uint64 { return serverMetrics.Snapshot().ConnectionsClosed }).Should(Equal(map[quic.ConnectionCloseReason]uint64{quic.CloseReasonRemote: 1}))
+			})
+		})
+	}
+})
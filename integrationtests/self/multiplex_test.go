@@ -1,7 +1,6 @@
 package self_test
 
 import (
-	"crypto/tls"
 	"fmt"
 	"io/ioutil"
 	"net"
@@ -12,7 +11,6 @@ import (
 	"github.com/lucas-clemente/quic-go/integrationtests/tools/testlog"
 	"github.com/lucas-clemente/quic-go/integrationtests/tools/testserver"
 	"github.com/lucas-clemente/quic-go/internal/protocol"
-	"github.com/lucas-clemente/quic-go/internal/testdata"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
@@ -48,7 +46,7 @@ var _ = Describe("Multiplexing", func() {
 					conn,
 					addr,
 					fmt.Sprintf("localhost:%d", addr.(*net.UDPAddr).Port),
-					&tls.Config{RootCAs: testdata.GetRootCA()},
+					getTLSClientConfig(),
 					&quic.Config{Versions: []protocol.VersionNumber{version}},
 				)
 				Expect(err).ToNot(HaveOccurred())
@@ -63,7 +61,7 @@ var _ = Describe("Multiplexing", func() {
 				getListener := func() quic.Listener {
 					ln, err := quic.ListenAddr(
 						"localhost:0",
-						testdata.GetTLSConfig(),
+						getTLSConfig(),
 						&quic.Config{Versions: []protocol.VersionNumber{version}},
 					)
 					Expect(err).ToNot(HaveOccurred())
@@ -146,7 +144,7 @@ var _ = Describe("Multiplexing", func() {
 
 					server, err := quic.Listen(
 						conn,
-						testdata.GetTLSConfig(),
+						getTLSConfig(),
 						&quic.Config{Versions: []protocol.VersionNumber{version}},
 					)
 					Expect(err).ToNot(HaveOccurred())
@@ -182,7 +180,7 @@ var _ = Describe("Multiplexing", func() {
 
 					server1, err := quic.Listen(
 						conn1,
-						testdata.GetTLSConfig(),
+						getTLSConfig(),
 						&quic.Config{Versions: []protocol.VersionNumber{version}},
 					)
 					Expect(err).ToNot(HaveOccurred())
@@ -191,7 +189,7 @@ var _ = Describe("Multiplexing", func() {
 
 					server2, err := quic.Listen(
 						conn2,
-						testdata.GetTLSConfig(),
+						getTLSConfig(),
 						&quic.Config{Versions: []protocol.VersionNumber{version}},
 					)
 					Expect(err).ToNot(HaveOccurred())
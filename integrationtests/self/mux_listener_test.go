@@ -0,0 +1,115 @@
+package self_test
+
+import (
+	"crypto/tls"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+
+	quic "github.com/lucas-clemente/quic-go"
+	"github.com/lucas-clemente/quic-go/http3"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("MuxListener", func() {
+	var (
+		mux        *http3.MuxListener
+		serverAddr string
+	)
+
+	textHandler := func(text string) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			io.WriteString(w, text)
+		})
+	}
+
+	BeforeEach(func() {
+		mux = &http3.MuxListener{TLSConfig: getTLSConfig()}
+		mux.Handle("foo.example.com", textHandler("foo"))
+		mux.Handle("bar.example.com", textHandler("bar"))
+		mux.HandleALPN("echo", func(sess quic.Session) {
+			defer GinkgoRecover()
+			str, err := sess.AcceptStream()
+			Expect(err).ToNot(HaveOccurred())
+			_, err = io.Copy(str, str)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(str.Close()).To(Succeed())
+			<-sess.Context().Done()
+		})
+		conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 0})
+		Expect(err).ToNot(HaveOccurred())
+		serverAddr = conn.LocalAddr().String()
+		go mux.Serve(conn)
+	})
+
+	AfterEach(func() {
+		Expect(mux.Close()).To(Succeed())
+	})
+
+	// The test certificate is only valid for localhost, so we can't verify it for other server names.
+	getClientTLSConfig := func(serverName string, nextProtos ...string) *tls.Config {
+		return &tls.Config{
+			ServerName:         serverName,
+			InsecureSkipVerify: true,
+			NextProtos:         nextProtos,
+		}
+	}
+
+	get := func(host string) (string, error) {
+		client := &http.Client{
+			Transport: &http3.RoundTripper{
+				TLSClientConfig: getClientTLSConfig(host),
+				Dial: func(_, _ string, tlsConf *tls.Config, conf *quic.Config) (quic.Session, error) {
+					return quic.DialAddr(serverAddr, tlsConf, conf)
+				},
+			},
+		}
+		defer client.Transport.(*http3.RoundTripper).Close()
+		rsp, err := client.Get(fmt.Sprintf("https://%s/", host))
+		if err != nil {
+			return "", err
+		}
+		defer rsp.Body.Close()
+		body, err := ioutil.ReadAll(rsp.Body)
+		return string(body), err
+	}
+
+	It("routes HTTP/3 requests by the server name", func() {
+		Expect(get("foo.example.com")).To(Equal("foo"))
+		Expect(get("bar.example.com")).To(Equal("bar"))
+	})
+
+	It("rejects HTTP/3 connections to unknown server names, unless there's a default handler", func() {
+		_, err := get("baz.example.com")
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("no application protocol"))
+
+		mux.HandleDefault(textHandler("default"))
+		Expect(get("baz.example.com")).To(Equal("default"))
+		Expect(get("foo.example.com")).To(Equal("foo"))
+	})
+
+	It("routes sessions by the application protocol", func() {
+		sess, err := quic.DialAddr(serverAddr, getClientTLSConfig("foo.example.com", "echo"), nil)
+		Expect(err).ToNot(HaveOccurred())
+		defer sess.Close()
+		Expect(sess.ConnectionState().NegotiatedProtocol).To(Equal("echo"))
+		str, err := sess.OpenStream()
+		Expect(err).ToNot(HaveOccurred())
+		_, err = str.Write([]byte("foobar"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(str.Close()).To(Succeed())
+		data, err := ioutil.ReadAll(str)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(data).To(Equal([]byte("foobar")))
+	})
+
+	It("fails the handshake if there's no handler for any of the client's application protocols", func() {
+		_, err := quic.DialAddr(serverAddr, getClientTLSConfig("foo.example.com", "chat"), nil)
+		Expect(err).To(BeAssignableToTypeOf(&quic.ALPNError{}))
+	})
+})
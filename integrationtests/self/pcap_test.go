@@ -0,0 +1,130 @@
+package self_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"net"
+
+	quic "github.com/lucas-clemente/quic-go"
+	"github.com/lucas-clemente/quic-go/integrationtests/tools/testserver"
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type udpDatagram struct {
+	srcPort, dstPort uint16
+	payload          []byte
+}
+
+// parsePcapUDP parses a pcap file, and returns the UDP datagrams contained in it.
+func parsePcapUDP(data []byte) []udpDatagram {
+	ExpectWithOffset(1, len(data)).To(BeNumerically(">=", 24))
+	ExpectWithOffset(1, binary.LittleEndian.Uint32(data[0:4])).To(BeEquivalentTo(0xa1b2c3d4))
+	ExpectWithOffset(1, binary.LittleEndian.Uint32(data[20:24])).To(BeEquivalentTo(101)) // raw IP
+	data = data[24:]
+	var datagrams []udpDatagram
+	for len(data) > 0 {
+		capLen := binary.LittleEndian.Uint32(data[8:12])
+		packet := data[16 : 16+capLen]
+		data = data[16+capLen:]
+		var udp []byte
+		switch packet[0] >> 4 {
+		case 4:
+			udp = packet[20:]
+		case 6:
+			udp = packet[40:]
+		default:
+			Fail(fmt.Sprintf("invalid IP version: %d", packet[0]>>4))
+		}
+		ExpectWithOffset(1, binary.BigEndian.Uint16(udp[4:6])).To(BeEquivalentTo(len(udp)))
+		datagrams = append(datagrams, udpDatagram{
+			srcPort: binary.BigEndian.Uint16(udp[0:2]),
+			dstPort: binary.BigEndian.Uint16(udp[2:4]),
+			payload: udp[8:],
+		})
+	}
+	return datagrams
+}
+
+var _ = Describe("Packet Capture", func() {
+	for _, v := range []protocol.VersionNumber{protocol.VersionTLS} {
+		version := v
+
+		Context(fmt.Sprintf("with QUIC %s", version), func() {
+			It("writes a pcap file", func() {
+				serverPcap := &lockedBuffer{}
+				server, err := quic.ListenAddr(
+					"localhost:0",
+					getTLSConfig(),
+					&quic.Config{
+						Versions:       []protocol.VersionNumber{version},
+						PacketCapturer: quic.NewPcapWriter(serverPcap, 0),
+					},
+				)
+				Expect(err).ToNot(HaveOccurred())
+				defer server.Close()
+				serverPort := server.Addr().(*net.UDPAddr).Port
+
+				serverSessClosed := make(chan struct{})
+				go func() {
+					defer GinkgoRecover()
+					sess, err := server.Accept()
+					Expect(err).ToNot(HaveOccurred())
+					str, err := sess.OpenUniStream()
+					Expect(err).ToNot(HaveOccurred())
+					_, err = str.Write(testserver.PRData)
+					Expect(err).ToNot(HaveOccurred())
+					Expect(str.Close()).To(Succeed())
+					<-sess.Context().Done()
+					close(serverSessClosed)
+				}()
+
+				clientPcap := &lockedBuffer{}
+				sess, err := quic.DialAddr(
+					fmt.Sprintf("localhost:%d", serverPort),
+					getTLSClientConfig(),
+					&quic.Config{
+						Versions:       []protocol.VersionNumber{version},
+						PacketCapturer: quic.NewPcapWriter(clientPcap, 0),
+					},
+				)
+				Expect(err).ToNot(HaveOccurred())
+				str, err := sess.AcceptUniStream()
+				Expect(err).ToNot(HaveOccurred())
+				data, err := ioutil.ReadAll(str)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(data).To(Equal(testserver.PRData))
+				Expect(sess.Close()).To(Succeed())
+				Eventually(serverSessClosed).Should(BeClosed())
+
+				clientDatagrams := parsePcapUDP([]byte(clientPcap.String()))
+				serverDatagrams := parsePcapUDP([]byte(serverPcap.String()))
+				var numBytesReceived int
+				for _, d := range clientDatagrams {
+					if d.srcPort == uint16(serverPort) {
+						numBytesReceived += len(d.payload)
+					}
+				}
+				Expect(numBytesReceived).To(BeNumerically(">", len(testserver.PRData)))
+				// the first datagram is the client's Initial
+				Expect(clientDatagrams[0].dstPort).To(BeEquivalentTo(serverPort))
+				Expect(clientDatagrams[0].payload[0] & 0x80).ToNot(BeZero()) // long header
+				Expect(len(clientDatagrams[0].payload)).To(BeNumerically(">=", protocol.MinInitialPacketSize))
+				// The server receives the same bytes.
+				// This is not necessarily the first datagram sent by the client, since the server might have sent a Retry.
+				Expect(serverDatagrams[0].dstPort).To(BeEquivalentTo(serverPort))
+				var found bool
+				for _, d := range clientDatagrams {
+					if bytes.Equal(d.payload, serverDatagrams[0].payload) {
+						found = true
+					}
+				}
+				Expect(found).To(BeTrue())
+			})
+		})
+	}
+})
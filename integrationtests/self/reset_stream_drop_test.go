@@ -0,0 +1,122 @@
+package self_test
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"sync/atomic"
+	"time"
+
+	quic "github.com/lucas-clemente/quic-go"
+	quicproxy "github.com/lucas-clemente/quic-go/integrationtests/tools/proxy"
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Lost RESET_STREAM frames", func() {
+	for _, v := range protocol.SupportedVersions {
+		version := v
+
+		Context(fmt.Sprintf("with QUIC version %s", version), func() {
+			It("retransmits RESET_STREAM frames", func() {
+				ln, err := quic.ListenAddr(
+					"localhost:0",
+					getTLSConfig(),
+					&quic.Config{Versions: []protocol.VersionNumber{version}},
+				)
+				Expect(err).ToNot(HaveOccurred())
+				defer ln.Close()
+
+				// When set to 1, the next packet sent in this direction is dropped.
+				var dropNextIncoming, dropNextOutgoing int32
+				var numDroppedIncoming, numDroppedOutgoing int32
+				proxy, err := quicproxy.NewQuicProxy("localhost:0", &quicproxy.Opts{
+					RemoteAddr: fmt.Sprintf("localhost:%d", ln.Addr().(*net.UDPAddr).Port),
+					DelayPacket: func(quicproxy.Direction, uint64) time.Duration {
+						return 5 * time.Millisecond // 10ms RTT
+					},
+					DropPacket: func(dir quicproxy.Direction, _ uint64) bool {
+						if dir == quicproxy.DirectionIncoming && atomic.CompareAndSwapInt32(&dropNextIncoming, 1, 0) {
+							atomic.AddInt32(&numDroppedIncoming, 1)
+							return true
+						}
+						if dir == quicproxy.DirectionOutgoing && atomic.CompareAndSwapInt32(&dropNextOutgoing, 1, 0) {
+							atomic.AddInt32(&numDroppedOutgoing, 1)
+							return true
+						}
+						return false
+					},
+				})
+				Expect(err).ToNot(HaveOccurred())
+				defer proxy.Close()
+
+				serverStrChan := make(chan quic.Stream, 1)
+				go func() {
+					defer GinkgoRecover()
+					sess, err := ln.Accept()
+					Expect(err).ToNot(HaveOccurred())
+					str, err := sess.AcceptStream()
+					Expect(err).ToNot(HaveOccurred())
+					_, err = io.ReadFull(str, make([]byte, 6))
+					Expect(err).ToNot(HaveOccurred())
+					_, err = str.Write([]byte("foobar"))
+					Expect(err).ToNot(HaveOccurred())
+					serverStrChan <- str
+				}()
+
+				sess, err := quic.DialAddr(
+					fmt.Sprintf("localhost:%d", proxy.LocalPort()),
+					getTLSClientConfig(),
+					&quic.Config{Versions: []protocol.VersionNumber{version}},
+				)
+				Expect(err).ToNot(HaveOccurred())
+				defer sess.Close()
+				str, err := sess.OpenStreamSync()
+				Expect(err).ToNot(HaveOccurred())
+				_, err = str.Write([]byte("foobar"))
+				Expect(err).ToNot(HaveOccurred())
+				_, err = io.ReadFull(str, make([]byte, 6))
+				Expect(err).ToNot(HaveOccurred())
+				var serverStr quic.Stream
+				Eventually(serverStrChan).Should(Receive(&serverStr))
+				// wait until all ACKs have been sent, so that the next packet contains the RESET_STREAM frame
+				time.Sleep(50 * time.Millisecond)
+
+				// The client resets the stream. The packet containing the RESET_STREAM is lost.
+				atomic.StoreInt32(&dropNextIncoming, 1)
+				str.CancelWrite(1234)
+				serverReadErr := make(chan error, 1)
+				go func() {
+					_, err := serverStr.Read(make([]byte, 6))
+					serverReadErr <- err
+				}()
+				var readErr error
+				Eventually(serverReadErr, 5*time.Second).Should(Receive(&readErr))
+				Expect(readErr).To(HaveOccurred())
+				streamErr, ok := readErr.(quic.StreamError)
+				Expect(ok).To(BeTrue())
+				Expect(streamErr.ErrorCode()).To(BeEquivalentTo(1234))
+				Expect(atomic.LoadInt32(&numDroppedIncoming)).To(BeEquivalentTo(1))
+
+				time.Sleep(50 * time.Millisecond)
+
+				// The server resets the stream. The packet containing the RESET_STREAM is lost.
+				atomic.StoreInt32(&dropNextOutgoing, 1)
+				serverStr.CancelWrite(4321)
+				clientReadErr := make(chan error, 1)
+				go func() {
+					_, err := str.Read(make([]byte, 6))
+					clientReadErr <- err
+				}()
+				Eventually(clientReadErr, 5*time.Second).Should(Receive(&readErr))
+				Expect(readErr).To(HaveOccurred())
+				streamErr, ok = readErr.(quic.StreamError)
+				Expect(ok).To(BeTrue())
+				Expect(streamErr.ErrorCode()).To(BeEquivalentTo(4321))
+				Expect(atomic.LoadInt32(&numDroppedOutgoing)).To(BeEquivalentTo(1))
+			})
+		})
+	}
+})
@@ -48,11 +48,12 @@ func (c *clientSessionCache) Put(sessionKey string, cs *tls.ClientSessionState)
 
 var _ = Describe("TLS session resumption", func() {
 	It("uses session resumption", func() {
-		server, err := quic.ListenAddr("localhost:0", testdata.GetTLSConfig(), nil)
+		server, err := quic.ListenAddr("localhost:0", getTLSConfig(), nil)
 		Expect(err).ToNot(HaveOccurred())
 		defer server.Close()
 
 		done := make(chan struct{})
+		serverKeyChan := make(chan []byte, 1)
 		go func() {
 			defer close(done)
 			defer GinkgoRecover()
@@ -63,6 +64,9 @@ var _ = Describe("TLS session resumption", func() {
 			sess, err = server.Accept()
 			Expect(err).ToNot(HaveOccurred())
 			Expect(sess.ConnectionState().DidResume).To(BeTrue())
+			key, err := sess.ExportKeyingMaterial("EXPORTER-quic-go-test", nil, 32)
+			Expect(err).ToNot(HaveOccurred())
+			serverKeyChan <- key
 		}()
 
 		gets := make(chan string, 100)
@@ -71,6 +75,7 @@ var _ = Describe("TLS session resumption", func() {
 		tlsConf := &tls.Config{
 			RootCAs:            testdata.GetRootCA(),
 			ClientSessionCache: cache,
+			NextProtos:         []string{alpn},
 		}
 		sess, err := quic.DialAddr(
 			fmt.Sprintf("localhost:%d", server.Addr().(*net.UDPAddr).Port),
@@ -90,6 +95,12 @@ var _ = Describe("TLS session resumption", func() {
 		Expect(err).ToNot(HaveOccurred())
 		Expect(gets).To(Receive(Equal(sessionKey)))
 		Expect(sess.ConnectionState().DidResume).To(BeTrue())
+		// the exported keying material is derived from the resumed session
+		clientKey, err := sess.ExportKeyingMaterial("EXPORTER-quic-go-test", nil, 32)
+		Expect(err).ToNot(HaveOccurred())
+		var serverKey []byte
+		Eventually(serverKeyChan).Should(Receive(&serverKey))
+		Expect(serverKey).To(Equal(clientKey))
 
 		Eventually(done).Should(BeClosed())
 	})
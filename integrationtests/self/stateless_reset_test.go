@@ -25,8 +25,10 @@ var _ = Describe("Stateless Resets", func() {
 			statelessResetKey := make([]byte, 32)
 			rand.Read(statelessResetKey)
 			serverConfig := &quic.Config{StatelessResetKey: statelessResetKey}
+			tlsConf := testdata.GetTLSConfig()
+			tlsConf.NextProtos = []string{"quic-go integration tests"}
 
-			ln, err := quic.ListenAddr("localhost:0", testdata.GetTLSConfig(), serverConfig)
+			ln, err := quic.ListenAddr("localhost:0", tlsConf, serverConfig)
 			Expect(err).ToNot(HaveOccurred())
 			serverPort := ln.Addr().(*net.UDPAddr).Port
 
@@ -57,7 +59,10 @@ var _ = Describe("Stateless Resets", func() {
 
 			sess, err := quic.DialAddr(
 				fmt.Sprintf("localhost:%d", proxy.LocalPort()),
-				&tls.Config{RootCAs: testdata.GetRootCA()},
+				&tls.Config{
+					RootCAs:    testdata.GetRootCA(),
+					NextProtos: []string{"quic-go integration tests"},
+				},
 				&quic.Config{
 					ConnectionIDLength: connIDLen,
 					IdleTimeout:        2 * time.Second,
@@ -78,7 +83,7 @@ var _ = Describe("Stateless Resets", func() {
 
 			ln2, err := quic.ListenAddr(
 				fmt.Sprintf("localhost:%d", serverPort),
-				testdata.GetTLSConfig(),
+				tlsConf,
 				serverConfig,
 			)
 			Expect(err).ToNot(HaveOccurred())
@@ -0,0 +1,164 @@
+package self_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"sync"
+
+	quic "github.com/lucas-clemente/quic-go"
+	"github.com/lucas-clemente/quic-go/integrationtests/tools/testserver"
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// connTracer counts the events of a single connection.
+// Since all methods are called from the run loop of the connection, it doesn't need a mutex.
+// The counters are only read after the connection was closed.
+type connTracer struct {
+	started         bool
+	packetsSent     int
+	packetsReceived int
+	metricsUpdates  int
+	closed          bool
+
+	streamsOpened       int
+	streamBytesSent     quic.ByteCount
+	streamBytesReceived quic.ByteCount
+	// the sum of the final sizes of all closed streams
+	streamFinalSizes quic.ByteCount
+}
+
+var _ quic.ConnectionTracer = &connTracer{}
+
+func (t *connTracer) StartedConnection(net.Addr, net.Addr, quic.VersionNumber, quic.ConnectionID, quic.ConnectionID) {
+	t.started = true
+}
+
+func (t *connTracer) SentPacket(*quic.ExtendedHeader, quic.ByteCount, *quic.AckFrame, []quic.Frame) {
+	t.packetsSent++
+}
+
+func (t *connTracer) ReceivedPacket(*quic.ExtendedHeader, quic.ByteCount, []quic.Frame) {
+	t.packetsReceived++
+}
+
+func (t *connTracer) DroppedPacket(quic.ByteCount, quic.PacketDropReason) {}
+
+func (t *connTracer) LostPacket(quic.EncryptionLevel, quic.PacketNumber, quic.PacketLossTrigger) {}
+
+func (t *connTracer) UpdatedMetrics(*quic.RTTStats, quic.ByteCount, quic.ByteCount) {
+	t.metricsUpdates++
+}
+
+func (t *connTracer) StreamOpened(quic.StreamID, bool) {
+	t.streamsOpened++
+}
+
+func (t *connTracer) StreamDataMoved(_ quic.StreamID, bytes quic.ByteCount, direction quic.StreamDataDirection) {
+	if direction == quic.StreamDataSent {
+		t.streamBytesSent += bytes
+	} else {
+		t.streamBytesReceived += bytes
+	}
+}
+
+func (t *connTracer) StreamReset(quic.StreamID, quic.ErrorCode, bool) {}
+
+func (t *connTracer) StreamClosed(_ quic.StreamID, sendFinalSize, receiveFinalSize quic.ByteCount) {
+	t.streamFinalSizes += sendFinalSize + receiveFinalSize
+}
+
+func (t *connTracer) ClosedConnection(error) {
+	t.closed = true
+}
+
+type tracer struct {
+	mutex       sync.Mutex
+	connTracers []*connTracer
+}
+
+var _ quic.Tracer = &tracer{}
+
+func (t *tracer) TracerForConnection(bool, quic.ConnectionID) quic.ConnectionTracer {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	ct := &connTracer{}
+	t.connTracers = append(t.connTracers, ct)
+	return ct
+}
+
+func (t *tracer) getConnTracers() []*connTracer {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return append([]*connTracer(nil), t.connTracers...)
+}
+
+var _ = Describe("Tracer", func() {
+	for _, v := range []protocol.VersionNumber{protocol.VersionTLS} {
+		version := v
+
+		Context(fmt.Sprintf("with QUIC %s", version), func() {
+			It("traces connections", func() {
+				serverTracer := &tracer{}
+				server, err := quic.ListenAddr(
+					"localhost:0",
+					getTLSConfig(),
+					&quic.Config{Versions: []protocol.VersionNumber{version}, Tracer: serverTracer},
+				)
+				Expect(err).ToNot(HaveOccurred())
+				defer server.Close()
+
+				serverSessClosed := make(chan struct{})
+				go func() {
+					defer GinkgoRecover()
+					sess, err := server.Accept()
+					Expect(err).ToNot(HaveOccurred())
+					str, err := sess.OpenUniStream()
+					Expect(err).ToNot(HaveOccurred())
+					_, err = str.Write(testserver.PRData)
+					Expect(err).ToNot(HaveOccurred())
+					Expect(str.Close()).To(Succeed())
+					<-sess.Context().Done()
+					close(serverSessClosed)
+				}()
+
+				clientTracer := &tracer{}
+				sess, err := quic.DialAddr(
+					fmt.Sprintf("localhost:%d", server.Addr().(*net.UDPAddr).Port),
+					getTLSClientConfig(),
+					&quic.Config{Versions: []protocol.VersionNumber{version}, Tracer: clientTracer},
+				)
+				Expect(err).ToNot(HaveOccurred())
+				str, err := sess.AcceptUniStream()
+				Expect(err).ToNot(HaveOccurred())
+				data, err := ioutil.ReadAll(str)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(data).To(Equal(testserver.PRData))
+				Expect(sess.Close()).To(Succeed())
+				Eventually(serverSessClosed).Should(BeClosed())
+
+				for _, t := range []*tracer{clientTracer, serverTracer} {
+					connTracers := t.getConnTracers()
+					Expect(connTracers).To(HaveLen(1))
+					ct := connTracers[0]
+					Expect(ct.started).To(BeTrue())
+					Expect(ct.packetsSent).ToNot(BeZero())
+					Expect(ct.packetsReceived).ToNot(BeZero())
+					Expect(ct.metricsUpdates).ToNot(BeZero())
+					Expect(ct.closed).To(BeTrue())
+					Expect(ct.streamsOpened).To(Equal(1))
+					Expect(ct.streamFinalSizes).To(Equal(quic.ByteCount(len(testserver.PRData))))
+				}
+				serverConnTracer := serverTracer.getConnTracers()[0]
+				Expect(serverConnTracer.streamBytesSent).To(BeNumerically(">=", len(testserver.PRData)))
+				Expect(serverConnTracer.streamBytesReceived).To(BeZero())
+				clientConnTracer := clientTracer.getConnTracers()[0]
+				Expect(clientConnTracer.streamBytesSent).To(BeZero())
+				Expect(clientConnTracer.streamBytesReceived).To(BeNumerically(">=", len(testserver.PRData)))
+			})
+		})
+	}
+})
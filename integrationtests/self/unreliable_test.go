@@ -0,0 +1,105 @@
+package self_test
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+
+	quic "github.com/lucas-clemente/quic-go"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Unreliable messages", func() {
+	It("sends messages on streams if the peer doesn't support DATAGRAM frames", func() {
+		const num = 20
+		ln, err := quic.ListenAddr("localhost:0", getTLSConfig(), nil)
+		Expect(err).ToNot(HaveOccurred())
+		defer ln.Close()
+
+		received := make(chan string, num)
+		go func() {
+			defer GinkgoRecover()
+			sess, err := ln.Accept()
+			Expect(err).ToNot(HaveOccurred())
+			for i := 0; i < num; i++ {
+				str, err := sess.AcceptUniStream()
+				Expect(err).ToNot(HaveOccurred())
+				var length uint32
+				Expect(binary.Read(str, binary.BigEndian, &length)).To(Succeed())
+				msg := make([]byte, length)
+				_, err = io.ReadFull(str, msg)
+				Expect(err).ToNot(HaveOccurred())
+				rest, err := ioutil.ReadAll(str)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(rest).To(BeEmpty())
+				received <- string(msg)
+			}
+		}()
+
+		sess, err := quic.DialAddr(
+			fmt.Sprintf("localhost:%d", ln.Addr().(*net.UDPAddr).Port),
+			getTLSClientConfig(),
+			nil,
+		)
+		Expect(err).ToNot(HaveOccurred())
+		var expected []string
+		for i := 0; i < num; i++ {
+			msg := fmt.Sprintf("message %d", i)
+			expected = append(expected, msg)
+			Expect(sess.SendUnreliable([]byte(msg))).To(Succeed())
+		}
+		var msgs []string
+		for i := 0; i < num; i++ {
+			var msg string
+			Eventually(received).Should(Receive(&msg))
+			msgs = append(msgs, msg)
+		}
+		Expect(msgs).To(ConsistOf(expected))
+		Expect(sess.Close()).To(Succeed())
+	})
+
+	It("sends messages in DATAGRAM frames if the peer supports them", func() {
+		const num = 20
+		ln, err := quic.ListenAddr("localhost:0", getTLSConfig(), &quic.Config{EnableDatagrams: true})
+		Expect(err).ToNot(HaveOccurred())
+		defer ln.Close()
+
+		received := make(chan string, num)
+		go func() {
+			defer GinkgoRecover()
+			sess, err := ln.Accept()
+			Expect(err).ToNot(HaveOccurred())
+			for {
+				msg, err := sess.ReceiveUnreliable(context.Background())
+				if err != nil {
+					return
+				}
+				received <- string(msg)
+			}
+		}()
+
+		sess, err := quic.DialAddr(
+			fmt.Sprintf("localhost:%d", ln.Addr().(*net.UDPAddr).Port),
+			getTLSClientConfig(),
+			nil,
+		)
+		Expect(err).ToNot(HaveOccurred())
+		for i := 0; i < num; i++ {
+			Expect(sess.SendUnreliable([]byte(fmt.Sprintf("message %d", i)))).To(Succeed())
+		}
+		// DATAGRAM frames are unreliable, but no packets are lost on the loopback interface
+		var msgs []string
+		for i := 0; i < num; i++ {
+			var msg string
+			Eventually(received).Should(Receive(&msg))
+			msgs = append(msgs, msg)
+		}
+		Expect(msgs).To(HaveLen(num))
+		Expect(msgs[0]).To(Equal("message 0"))
+		Expect(sess.Close()).To(Succeed())
+	})
+})
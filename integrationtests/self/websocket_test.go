@@ -0,0 +1,58 @@
+package self_test
+
+import (
+	"io/ioutil"
+	"net"
+	"net/http/httptest"
+	"strings"
+
+	quic "github.com/lucas-clemente/quic-go"
+	"github.com/lucas-clemente/quic-go/integrationtests/tools/testserver"
+	"github.com/lucas-clemente/quic-go/transport/websocket"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("WebSocket transport", func() {
+	It("transfers data over a WebSocket connection", func() {
+		ln := websocket.NewListener()
+		httpServer := httptest.NewServer(ln)
+		defer httpServer.Close()
+		server, err := quic.Listen(ln, getTLSConfig(), nil)
+		Expect(err).ToNot(HaveOccurred())
+		defer server.Close()
+
+		go func() {
+			defer GinkgoRecover()
+			sess, err := server.Accept()
+			Expect(err).ToNot(HaveOccurred())
+			str, err := sess.OpenStream()
+			Expect(err).ToNot(HaveOccurred())
+			_, err = str.Write(testserver.PRData)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(str.Close()).To(Succeed())
+		}()
+
+		httpAddr := strings.TrimPrefix(httpServer.URL, "http://")
+		conn, err := (&websocket.Dialer{}).Dial("ws://" + httpAddr)
+		Expect(err).ToNot(HaveOccurred())
+		defer conn.Close()
+		_, port, err := net.SplitHostPort(httpAddr)
+		Expect(err).ToNot(HaveOccurred())
+		sess, err := quic.Dial(
+			conn,
+			conn.RemoteAddr(),
+			"localhost:"+port,
+			getTLSClientConfig(),
+			nil,
+		)
+		Expect(err).ToNot(HaveOccurred())
+		str, err := sess.AcceptStream()
+		Expect(err).ToNot(HaveOccurred())
+		data, err := ioutil.ReadAll(str)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(data).To(Equal(testserver.PRData))
+		Expect(sess.Close()).To(Succeed())
+	})
+})
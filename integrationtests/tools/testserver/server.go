@@ -1,6 +1,7 @@
 package testserver
 
 import (
+	"context"
 	"io"
 	"io/ioutil"
 	"net"
@@ -108,6 +109,11 @@ func StopQuicServer() {
 	Eventually(stoppedServing).Should(BeClosed())
 }
 
+// ShutdownQuicServer gracefully shuts down the http3.Server.
+func ShutdownQuicServer(ctx context.Context) error {
+	return server.Shutdown(ctx)
+}
+
 // Port returns the UDP port of the QUIC server.
 func Port() string {
 	return port
@@ -3,11 +3,13 @@ package quic
 import (
 	"context"
 	"crypto/tls"
+	"crypto/x509"
 	"io"
 	"net"
 	"time"
 
 	"github.com/lucas-clemente/quic-go/internal/protocol"
+	"golang.org/x/time/rate"
 )
 
 // The StreamID is the ID of a QUIC stream.
@@ -16,12 +18,62 @@ type StreamID = protocol.StreamID
 // A VersionNumber is a QUIC version number.
 type VersionNumber = protocol.VersionNumber
 
+// A ConnectionID is a QUIC connection ID.
+type ConnectionID = protocol.ConnectionID
+
+// A ByteCount is a number of bytes.
+type ByteCount = protocol.ByteCount
+
+// The EncryptionLevel is the encryption level of a packet.
+type EncryptionLevel = protocol.EncryptionLevel
+
 // A Cookie can be used to verify the ownership of the client address.
 type Cookie struct {
+	// IsRetryToken says if the Cookie was issued in a Retry packet, or in a NEW_TOKEN frame.
+	IsRetryToken bool
+	// For Cookies issued in a Retry packet, this is the client's IP address.
+	// For Cookies issued in a NEW_TOKEN frame, this is the prefix of the client's IP address in CIDR notation
+	// (a /24 for IPv4, and a /64 for IPv6 addresses).
 	RemoteAddr string
 	SentTime   time.Time
 }
 
+// A ClientToken is a token received by the client in a NEW_TOKEN frame.
+// It can be sent to the server when connecting again later, allowing the client to skip the Retry.
+type ClientToken struct {
+	data []byte
+}
+
+// A TokenStore stores the tokens received by the client, so they can be used for subsequent connections.
+type TokenStore interface {
+	// Pop searches for a token for the given key.
+	// The key is the server name (if set in the tls.Config), or the server address.
+	// If a token is found, it is removed from the store.
+	// It returns nil if no token is found.
+	Pop(key string) (token *ClientToken)
+
+	// Put adds a token to the store.
+	// A single key might be associated with multiple tokens.
+	Put(key string, token *ClientToken)
+}
+
+// A Decision is the result of Config.VerifySourceAddress.
+// It determines how the server handles a new connection attempt.
+type Decision uint8
+
+const (
+	// DecisionAccept accepts the connection attempt, without validating the client's address.
+	DecisionAccept Decision = iota
+	// DecisionRequireValidation requires the client to prove ownership of its address.
+	// Unless the client already presented a valid token, a Retry is sent.
+	DecisionRequireValidation
+	// DecisionReject refuses the connection attempt.
+	// The server sends a CONNECTION_CLOSE with a SERVER_BUSY error.
+	DecisionReject
+	// DecisionDrop silently drops the packet.
+	DecisionDrop
+)
+
 // An ErrorCode is an application-defined error code.
 type ErrorCode = protocol.ApplicationErrorCode
 
@@ -38,6 +90,10 @@ type Stream interface {
 	// the net.Error interface, and Timeout() will be true.
 	io.Reader
 	// Write writes data to the stream.
+	// Data is copied into a send buffer of up to 16 KB per stream, and Write returns as soon as all of p was buffered.
+	// Consecutive writes are coalesced, and sent in a single STREAM frame.
+	// A nil error therefore doesn't mean that the data was sent, or received by the peer.
+	// If p doesn't fit into the send buffer, Write blocks until enough data was sent to buffer the rest.
 	// Write can be made to time out and return a net.Error with Timeout() == true
 	// after a fixed time limit; see SetDeadline and SetWriteDeadline.
 	// If the stream was canceled by the peer, the error implements the StreamError
@@ -50,16 +106,49 @@ type Stream interface {
 	// It must not be called concurrently with Write.
 	// It must not be called after calling CancelWrite.
 	io.Closer
+	// CloseWrite closes the write-direction of the stream, like a TCP half-close.
+	// It is equivalent to Close: a FIN is sent after all data written so far, while the stream can still be read from.
+	CloseWrite() error
+	// WaitForPeerFIN blocks until the peer closed the write-direction of its stream,
+	// and all data up to the FIN was received.
+	// It doesn't consume any data, the data can still be read using Read.
+	// It returns an error if the stream was reset by the peer, if CancelRead was called,
+	// if the session was closed, or if the context is done.
+	WaitForPeerFIN(ctx context.Context) error
 	// CancelWrite aborts sending on this stream.
 	// Data already written, but not yet delivered to the peer is not guaranteed to be delivered reliably.
 	// Write will unblock immediately, and future calls to Write will fail.
 	// When called multiple times or after closing the stream it is a no-op.
 	CancelWrite(ErrorCode)
+	// SetPriority sets the priority of the stream, using the urgency and incremental parameters of RFC 9218.
+	// The priority determines how data is scheduled when multiple streams have data to send.
+	// Streams with a lower urgency (0 to 7, 3 by default) are served first.
+	// Incremental streams with the same urgency share the bandwidth (this is the default),
+	// non-incremental streams are served one after the other.
+	SetPriority(urgency uint8, incremental bool)
+	// GrantedCredit returns the connection-level send credit donated to this stream (see Session.DonateStreamSendCredit),
+	// that hasn't been used for sending data yet.
+	GrantedCredit() ByteCount
 	// CancelRead aborts receiving on this stream.
 	// It will ask the peer to stop transmitting stream data.
 	// Read will unblock immediately, and future Read calls will fail.
 	// When called multiple times or after reading the io.EOF it is a no-op.
 	CancelRead(ErrorCode)
+	// ReadAvailable returns the number of bytes that can be read without blocking.
+	ReadAvailable() int
+	// SetReadNotifyThreshold sets the number of bytes that need to be available for reading
+	// before Config.OnReadAvailable is called for this stream.
+	// The callback is called whenever data is received and at least n bytes are available,
+	// as well as when the end of the stream becomes available.
+	// If n bytes are already available, the callback is called immediately.
+	// A value of 0 disables the notification.
+	SetReadNotifyThreshold(n int)
+	// ReorderStats returns statistics about STREAM frames received out of order.
+	// A reordering event occurs whenever a frame arrives after data at higher offsets was already received.
+	// The depth is the maximum amount of data that was received beyond the end of such a frame,
+	// i.e. the amount of data that had to be buffered because it was received out of order.
+	// Flow control window updates for this stream leave room for this depth.
+	ReorderStats() (depth ByteCount, events uint64)
 	// The context is canceled as soon as the write-side of the stream is closed.
 	// This happens when Close() or CancelWrite() is called, or when the peer
 	// cancels the read-side of their stream.
@@ -89,6 +178,14 @@ type ReceiveStream interface {
 	io.Reader
 	// see Stream.CancelRead
 	CancelRead(ErrorCode)
+	// see Stream.WaitForPeerFIN
+	WaitForPeerFIN(ctx context.Context) error
+	// see Stream.ReadAvailable
+	ReadAvailable() int
+	// see Stream.SetReadNotifyThreshold
+	SetReadNotifyThreshold(n int)
+	// see Stream.ReorderStats
+	ReorderStats() (depth ByteCount, events uint64)
 	// see Stream.SetReadDealine
 	SetReadDeadline(t time.Time) error
 }
@@ -101,8 +198,14 @@ type SendStream interface {
 	io.Writer
 	// see Stream.Close
 	io.Closer
+	// see Stream.CloseWrite
+	CloseWrite() error
 	// see Stream.CancelWrite
 	CancelWrite(ErrorCode)
+	// see Stream.SetPriority
+	SetPriority(urgency uint8, incremental bool)
+	// see Stream.GrantedCredit
+	GrantedCredit() ByteCount
 	// see Stream.Context
 	Context() context.Context
 	// see Stream.SetWriteDeadline
@@ -148,6 +251,27 @@ type Session interface {
 	// If the error is non-nil, it satisfies the net.Error interface.
 	// If the session was closed due to a timeout, Timeout() will be true.
 	OpenUniStreamSync() (SendStream, error)
+	// SendUnreliable sends an unreliable message.
+	// If the peer doesn't support DATAGRAM frames, the message is sent on a new unidirectional stream.
+	// See DatagramOrStreamSender for details.
+	SendUnreliable(payload []byte) error
+	// ReceiveUnreliable returns the next message received in a DATAGRAM frame.
+	// It blocks until a message is received, the context is done, or the session is closed.
+	// DATAGRAM frames are only received if Config.EnableDatagrams is set.
+	// Messages that the peer sent on streams (see DatagramOrStreamSender) are accepted using AcceptUniStream.
+	// If the application doesn't read the messages fast enough, newly received DATAGRAM frames are dropped.
+	ReceiveUnreliable(ctx context.Context) ([]byte, error)
+	// DonateStreamSendCredit reserves n bytes of the connection-level send window for stream to,
+	// such that data on this stream isn't blocked by other streams using up the connection's send window.
+	// The credit is taken from the send window available to stream from: the credit donated to stream from,
+	// and the part of the send window that isn't reserved for any stream.
+	// Stream to doesn't need to be opened yet, e.g. to reserve send window for a push stream before it is opened.
+	// It returns an error if stream to was already closed, or if its ID exceeds the peer's stream limit.
+	// Stream from must be open. If it wasn't opened yet, it can only donate the credit that was donated to it.
+	// Credit that is not used by stream to is only returned when the stream is completed,
+	// or when it is donated to another stream.
+	// Warning: This API should not be considered stable and might change soon.
+	DonateStreamSendCredit(from, to StreamID, n ByteCount) error
 	// LocalAddr returns the local address.
 	LocalAddr() net.Addr
 	// RemoteAddr returns the address of the peer.
@@ -160,9 +284,191 @@ type Session interface {
 	// The context is cancelled when the session is closed.
 	// Warning: This API should not be considered stable and might change soon.
 	Context() context.Context
+	// ConnectionID returns the hex-encoded connection ID chosen by the server.
+	// Both endpoints return the same value, which allows correlating log lines.
+	// Until the client receives the first packet from the server, it returns the connection ID chosen by the client.
+	// The ID is also available from the Context, see ConnectionIDFromContext.
+	ConnectionID() string
+	// OriginalDestConnectionID returns the hex-encoded destination connection ID
+	// that the client used in its first Initial packet.
+	OriginalDestConnectionID() string
+	// PeerTransportParameters returns the transport parameters sent by the peer that quic-go doesn't use,
+	// e.g. those of experimental extensions (see Config.CustomTransportParameters).
+	// It returns nil until the peer's transport parameters have been received.
+	// Warning: This API should not be considered stable and might change soon.
+	PeerTransportParameters() map[uint64][]byte
+	// SendCustomFrame queues a frame of a QUIC extension for sending (see CustomFrame).
+	// It returns an error if the frame type is defined by QUIC, or if the frame is larger than 1000 bytes.
+	// Custom frames are sent in the order they were queued.
+	// Warning: This API should not be considered stable and might change soon.
+	SendCustomFrame(frame CustomFrame) error
 	// ConnectionState returns basic details about the QUIC connection.
+	// The application protocol negotiated using ALPN is available as NegotiatedProtocol,
+	// once the handshake has completed.
 	// Warning: This API should not be considered stable and might change soon.
 	ConnectionState() tls.ConnectionState
+	// ExportKeyingMaterial exports keying material from the TLS session, as defined in RFC 5705
+	// (see tls.ConnectionState.ExportKeyingMaterial).
+	// Both endpoints derive the same keying material for the same label and context,
+	// which allows binding application-level authentication to the QUIC connection.
+	// It returns an error until the handshake has completed.
+	ExportKeyingMaterial(label string, context []byte, length int) ([]byte, error)
+	// PeerCertificates returns the certificate chain presented by the peer, leaf certificate first.
+	// On the server side, the client only presents a certificate if it was requested (see tls.Config.ClientAuth).
+	// It returns nil until the handshake has completed.
+	// This is a shortcut for ConnectionState().PeerCertificates.
+	PeerCertificates() []*x509.Certificate
+	// VerifiedChains returns the verified certificate chains of the peer, see tls.ConnectionState.VerifiedChains.
+	// It returns nil if the peer's certificate wasn't verified.
+	VerifiedChains() [][]*x509.Certificate
+	// PeerCommonName returns the common name of the peer's leaf certificate,
+	// or an empty string if the peer didn't present a certificate.
+	PeerCommonName() string
+	// ConnectionStats returns statistics about the QUIC connection.
+	// It is cheap, and can be called at any time. After the session was closed, it returns the final statistics.
+	// Warning: This API should not be considered stable and might change soon.
+	ConnectionStats() ConnectionStats
+	// SendPing sends a PING frame, which the peer acknowledges.
+	// To prevent flooding the peer with PINGs, only one PING can be pending at any time:
+	// If the PING sent before wasn't acknowledged yet, ErrPingPending is returned, and no PING is sent.
+	SendPing() error
+	// PingRoundTrip sends a PING frame, and returns the time until it was acknowledged.
+	// If a PING is already pending (see SendPing), it waits for that PING to be acknowledged instead.
+	// It returns an error if the context is done, or if the session is closed, before the PING is acknowledged.
+	PingRoundTrip(ctx context.Context) (time.Duration, error)
+}
+
+// An EarlySession is a session that is still handshaking.
+// It is returned by Listener.AcceptEarly as soon as the server has sent its first flight.
+// Data sent on its streams is encrypted with the 1-RTT keys, and can be sent before the handshake completes (0.5-RTT data).
+// Warning: Until the handshake completes, the client's Finished message hasn't been received.
+// The client isn't authenticated yet, and its identity (e.g. from a client certificate) must not be trusted.
+type EarlySession interface {
+	Session
+
+	// HandshakeComplete returns a context that is canceled when the handshake completes, or when it fails.
+	// Use Context().Err() to check if the session was closed before the handshake completed.
+	HandshakeComplete() context.Context
+}
+
+// ConnectionStats contains statistics about a QUIC connection.
+// Except for the UDP buffer sizes, the estimated bandwidth and the dropped packets,
+// the statistics are a consistent snapshot that is updated every time the session processes an event,
+// e.g. after receiving a packet or sending packets.
+type ConnectionStats struct {
+	// UDPReceiveBufferSize is the effective size of the receive buffer of the UDP socket, as reported by the kernel.
+	// It is 0 if the size can't be determined.
+	UDPReceiveBufferSize int
+	// UDPSendBufferSize is the effective size of the send buffer of the UDP socket, as reported by the kernel.
+	// It is 0 if the size can't be determined.
+	UDPSendBufferSize int
+	// EstimatedBandwidthBps is the estimated bandwidth of the path to the peer, in bytes per second.
+	// It is derived from the rate at which sent data is acknowledged, smoothed over multiple ACKs.
+	// It is 0 until the first estimate is available.
+	EstimatedBandwidthBps float64
+	// SmoothedRTT is the smoothed round-trip time to the peer.
+	// It is 0 until the first RTT sample was taken.
+	SmoothedRTT time.Duration
+	// MinRTT is the minimum round-trip time observed on the connection.
+	// It is 0 until the first RTT sample was taken.
+	MinRTT time.Duration
+	// LatestRTT is the most recent RTT sample.
+	LatestRTT time.Duration
+	// RTTVariance is the mean deviation of the RTT samples.
+	RTTVariance time.Duration
+	// RecentRTTSamples are the most recent RTT samples (up to 10), starting with the oldest one.
+	// They can be used to calculate the jitter.
+	RecentRTTSamples []time.Duration
+	// CongestionWindow is the current congestion window.
+	CongestionWindow ByteCount
+	// BytesInFlight is the number of bytes sent, but neither acknowledged nor declared lost yet.
+	BytesInFlight ByteCount
+	// PacketsSent and BytesSent count all packets sent, including retransmissions.
+	PacketsSent uint64
+	BytesSent   ByteCount
+	// PacketsReceived and BytesReceived count the packets received that were successfully decrypted.
+	PacketsReceived uint64
+	BytesReceived   ByteCount
+	// PacketsLost and BytesLost count the packets declared lost.
+	PacketsLost uint64
+	BytesLost   ByteCount
+	// PacketLossRate is the fraction of the packets sent that were declared lost,
+	// as an exponentially weighted moving average over the last 10 RTTs.
+	// It is 0 until the first packet is acknowledged or declared lost.
+	PacketLossRate float64
+	// PacketsRetransmitted and BytesRetransmitted count the packets sent as retransmissions, and as probe packets.
+	PacketsRetransmitted uint64
+	BytesRetransmitted   ByteCount
+	// SpuriousLosses is the number of packets that were declared lost, but acknowledged by the peer later.
+	SpuriousLosses uint64
+	// SpuriousRetransmissions is the number of lost packets that were retransmitted, but acknowledged by the peer later.
+	// The retransmission of these packets was unnecessary.
+	SpuriousRetransmissions uint64
+	// ProbeTimeouts is the number of times the crypto retransmission timer or the probe timeout (PTO) fired.
+	ProbeTimeouts uint64
+	// MaxPacketSize is the maximum size of the packets sent, taking into account the max_packet_size transport parameter of the peer.
+	MaxPacketSize ByteCount
+	// LargestPacketSent is the size of the largest packet sent so far.
+	LargestPacketSent ByteCount
+	// LocalStreamsOpened and RemoteStreamsOpened count the streams opened by us and by the peer.
+	// Streams opened implicitly by the peer are included.
+	LocalStreamsOpened  uint64
+	RemoteStreamsOpened uint64
+	// LocalStreamsClosed and RemoteStreamsClosed count the streams opened by us and by the peer
+	// that have completed in both directions.
+	LocalStreamsClosed  uint64
+	RemoteStreamsClosed uint64
+	// HandshakeDuration is the time it took to complete the handshake.
+	// It is 0 if the handshake hasn't completed yet.
+	HandshakeDuration time.Duration
+	// DroppedPackets is the number of packets received on the connection that were dropped, by drop reason.
+	// Reasons that no packets were dropped for are omitted.
+	DroppedPackets map[PacketDropReason]uint64
+}
+
+// A ConnectionIDGenerator generates connection IDs.
+type ConnectionIDGenerator interface {
+	// GenerateConnectionID generates a new connection ID.
+	// The connection ID must have a length of ConnectionIDLen() bytes.
+	GenerateConnectionID() (ConnectionID, error)
+	// ConnectionIDLen returns the length of the connection IDs generated.
+	// It must return a constant value between 4 and 18.
+	ConnectionIDLen() int
+}
+
+// A PaddingStrategy determines how many bytes of padding are added to a packet.
+// Padding makes it harder for an on-path observer to infer the size of the messages sent on a connection.
+// Padding counts towards the congestion window, and costs bandwidth.
+type PaddingStrategy interface {
+	// PaddingLen returns the number of bytes of padding to add to a packet of size packetSize.
+	// The packet is never padded beyond maxPacketSize.
+	PaddingLen(packetSize, maxPacketSize ByteCount) ByteCount
+}
+
+// EventHooks are called when certain events happen on a connection.
+// They allow collecting metrics (e.g. for Prometheus or StatsD) without the overhead of a full event log.
+// All hooks are called synchronously, and must return quickly.
+// Unless noted otherwise, they are called from the session's run loop.
+// Every hook may be nil.
+type EventHooks struct {
+	// OnHandshakeComplete is called when the handshake completes.
+	OnHandshakeComplete func(sess Session)
+	// OnPacketLost is called when a packet is declared lost.
+	OnPacketLost func(pn PacketNumber, encLevel EncryptionLevel)
+	// OnCongestionEvent is called when the congestion controller reduces the congestion window in response to packet loss.
+	OnCongestionEvent func(newCWND ByteCount)
+	// OnStreamOpened is called when a stream is opened.
+	// For streams opened by the application, it is called from the goroutine that opened the stream.
+	// When the peer opens a stream, OnStreamOpened is also called for all streams with lower stream IDs
+	// of the same type that weren't opened yet, since they are opened implicitly.
+	OnStreamOpened func(id StreamID)
+	// OnStreamClosed is called when both directions of a stream are completed,
+	// i.e. all data was sent and acknowledged, and read by the application,
+	// or the stream was canceled or reset.
+	// err is nil if the stream was completed gracefully, and the cancelation error otherwise.
+	// It may be called from the goroutine that completed the stream, e.g. by calling Read or CancelRead.
+	// It is not called for streams that are still open when the session is closed.
+	OnStreamClosed func(id StreamID, err error)
 }
 
 // Config contains all configuration data needed for a QUIC server or client.
@@ -178,6 +484,13 @@ type Config struct {
 	// If used for a server, or dialing on a packet conn, a 4 byte connection ID will be used.
 	// When dialing on a packet conn, the ConnectionIDLength value must be the same for every Dial call.
 	ConnectionIDLength int
+	// ConnectionIDGenerator generates the connection IDs chosen by this endpoint.
+	// This can be used to encode routing information into connection IDs,
+	// such that a load balancer can route all packets of a connection to the same backend.
+	// The length of the connection IDs is determined by ConnectionIDGenerator.ConnectionIDLen(),
+	// ConnectionIDLength must either be unset or match this length.
+	// If not set, random connection IDs are used.
+	ConnectionIDGenerator ConnectionIDGenerator
 	// HandshakeTimeout is the maximum duration that the cryptographic handshake may take.
 	// If the timeout is exceeded, the connection is closed.
 	// If this value is zero, the timeout is set to 10 seconds.
@@ -187,11 +500,59 @@ type Config struct {
 	// If the timeout is exceeded, the connection is closed.
 	// If this value is zero, the timeout is set to 30 seconds.
 	IdleTimeout time.Duration
-	// AcceptCookie determines if a Cookie is accepted.
-	// It is called with cookie = nil if the client didn't send an Cookie.
-	// If not set, it verifies that the address matches, and that the Cookie was issued within the last 24 hours.
+	// IdleTimeoutMultiplier scales the idle timeout with the smoothed RTT of the connection,
+	// such that connections on high latency paths don't time out prematurely.
+	// The idle timeout used is max(IdleTimeout, IdleTimeoutMultiplier * smoothed RTT).
+	// When dialing, the handshake timeout is scaled as well: max(HandshakeTimeout, IdleTimeoutMultiplier * smoothed RTT).
+	// A server never scales the handshake timeout, since the RTT is controlled by the client.
+	// The transport parameters are sent before the RTT is known. If MaxIdleTimeout is set, it is advertised to the peer.
+	// Otherwise, the peer might close the connection after IdleTimeout, before the scaled idle timeout expires.
+	// If this value is zero, a multiplier of 30 is used.
+	// To disable scaling with the RTT, set it to a negative value.
+	IdleTimeoutMultiplier float64
+	// MinIdleTimeout is the lower bound for the idle timeout.
+	// If this value is zero, the idle timeout is not bounded from below.
+	MinIdleTimeout time.Duration
+	// MaxIdleTimeout is the upper bound for the idle timeout.
+	// It takes precedence over MinIdleTimeout.
+	// If this value is zero, the idle timeout is not bounded from above.
+	MaxIdleTimeout time.Duration
+	// DisableHappyEyeballs disables racing of IPv6 and IPv4 connection attempts in DialAddr.
+	// By default, if a hostname resolves to both IPv6 and IPv4 addresses, DialAddr first tries IPv6,
+	// and starts a parallel attempt using IPv4 if the server doesn't respond within HappyEyeballsDelay.
+	// This option is only valid for the client.
+	DisableHappyEyeballs bool
+	// HappyEyeballsDelay is the time DialAddr waits for a response before starting the connection attempt on the other address family.
+	// If this value is zero, the delay is set to 250ms.
+	// This option is only valid for the client.
+	HappyEyeballsDelay time.Duration
+	// AcceptCookie determines if a Cookie issued in a Retry packet is accepted.
+	// It is called with cookie = nil if the client didn't send an Cookie, or if the Cookie couldn't be decoded.
+	// Cookies issued in NEW_TOKEN frames are validated using the NewTokenValidity.
+	// If not set, it verifies that the address matches, and that the Cookie was issued within the RetryTokenValidity.
 	// This option is only valid for the server.
 	AcceptCookie func(clientAddr net.Addr, cookie *Cookie) bool
+	// RetryTokenValidity is the time that a Cookie issued in a Retry packet is accepted by the default AcceptCookie.
+	// Cookies are only used to complete the handshake directly after a Retry, so they don't need to be valid for long.
+	// Limiting their validity prevents replaying them from spoofed addresses later.
+	// If this value is zero, it will default to 30 seconds.
+	// This option is only valid for the server, and has no effect if AcceptCookie is set.
+	RetryTokenValidity time.Duration
+	// VerifySourceAddress decides how to handle a connection attempt, before any cryptographic work is done.
+	// It is called for every Initial packet that would create a new session.
+	// cookie is the Cookie sent by the client, or nil if the client didn't send a Cookie that could be decoded.
+	// The Cookie's validity is determined by AcceptCookie (or by the NewTokenValidity, for Cookies issued in NEW_TOKEN frames),
+	// so that DecisionRequireValidation only leads to a Retry if the client's address wasn't validated yet.
+	// VerifySourceAddress is called concurrently, and must return quickly.
+	// If not set, every connection attempt requires validation.
+	// This option is only valid for the server.
+	VerifySourceAddress func(clientAddr net.Addr, cookie *Cookie) Decision
+	// VerifyConnection is called after the TLS handshake completed, but before the session is returned to the application
+	// (i.e. before Dial returns on the client, and before Accept returns the session on the server).
+	// It receives the TLS connection state (e.g. the peer's certificate chain and the negotiated ALPN) and the session.
+	// This can be used to pin certificates.
+	// If it returns an error, the session is closed with a certificate_required TLS alert.
+	VerifyConnection func(state tls.ConnectionState, sess Session) error
 	// MaxReceiveStreamFlowControlWindow is the maximum stream-level flow control window for receiving data.
 	// If this value is zero, it will default to 1 MB for the server and 6 MB for the client.
 	MaxReceiveStreamFlowControlWindow uint64
@@ -209,16 +570,208 @@ type Config struct {
 	// The StatelessResetKey is used to generate stateless reset tokens.
 	// If no key is configured, sending of stateless resets is disabled.
 	StatelessResetKey []byte
+	// TokenKey is used to encrypt and authenticate the address validation tokens (Cookies) issued in Retry packets and NEW_TOKEN frames.
+	// Servers sharing the same key accept each other's tokens, and tokens stay valid when the server is restarted.
+	// If a key is configured (using TokenKey or GetTokenKeys), the server sends a token to the client in a NEW_TOKEN frame
+	// after completing the handshake. When the client presents a valid token in the Initial packet of a new connection,
+	// its address is considered validated, and no Retry is sent. Clients presenting an invalid token are sent a Retry.
+	// If no key is configured, a random key is generated for every listener, and no NEW_TOKEN frames are sent.
+	// This option is only valid for the server.
+	TokenKey [32]byte
+	// GetTokenKeys allows rotating the TokenKey without restarting the server.
+	// It returns the key used to protect new tokens, and the key that was used before the last rotation.
+	// Tokens protected with either key are accepted. If previous is zero, only the current key is used.
+	// GetTokenKeys is called concurrently, every time a token is issued or validated, and must return quickly.
+	// If set, TokenKey is ignored.
+	// This option is only valid for the server.
+	GetTokenKeys func() (current, previous [32]byte)
+	// NewTokenValidity is the time that a token issued in a NEW_TOKEN frame is accepted.
+	// These tokens are used by clients when connecting again later, so they are valid for a longer time than tokens issued in Retry packets.
+	// Besides the issuance time, the server verifies that the client connects from the same network (the same /24 for IPv4, or /64 for IPv6).
+	// If this value is zero, it will default to 24 hours.
+	// This option is only valid for the server.
+	NewTokenValidity time.Duration
+	// TokenStore is used to store the tokens received in NEW_TOKEN frames.
+	// When dialing a server that a token was received from before, the token is sent in the Initial packet,
+	// allowing the client to skip the Retry.
+	// If not set, tokens received in NEW_TOKEN frames are ignored.
+	// This option is only valid for the client.
+	TokenStore TokenStore
+	// AcceptQueueLength is the maximum number of sessions that completed the handshake, but weren't accepted yet.
+	// If the queue is full, new connection attempts are refused with a SERVER_BUSY error,
+	// before any cryptographic work is done.
+	// Sessions that complete the handshake while the queue is full are closed with the same error.
+	// If not set, it will default to 32. It must not be negative.
+	// This option is only valid for the server.
+	AcceptQueueLength int
+	// RetryHandshakeThreshold and RetryInitialRateThreshold enable load-adaptive address validation.
+	// If one of them is set, clients rejected by AcceptCookie are only sent a Retry when the server is under load,
+	// i.e. if more than RetryHandshakeThreshold sessions are currently handshaking,
+	// or if more than RetryInitialRateThreshold Initial packets without a valid Cookie are received per second.
+	// Otherwise, these clients are served directly.
+	// Retry mode is left when both values drop below half of the respective threshold.
+	// If neither is set, a Retry is sent whenever AcceptCookie rejects a client.
+	// This option is only valid for the server.
+	RetryHandshakeThreshold int
+	// See RetryHandshakeThreshold.
+	RetryInitialRateThreshold int
+	// InitialCryptoRateLimit limits the rate (per second) at which Initial packets starting a new handshake are processed.
+	// Starting a handshake requires parsing the ClientHello, which is relatively expensive.
+	// Initial packets exceeding the rate limit are dropped before any cryptographic work is done.
+	// If not set, the rate is not limited.
+	// This option is only valid for the server.
+	InitialCryptoRateLimit rate.Limit
+	// MaxInitialsPerIPPerInterval is the maximum number of Initial packets starting a new handshake
+	// that are processed per 100ms from a single IP address.
+	// Initial packets exceeding this budget are dropped without any further processing,
+	// so that a single host flooding the server with Initial packets can't exhaust its CPU.
+	// If not set, it will default to 100. A negative value disables the limit.
+	// This option is only valid for the server.
+	MaxInitialsPerIPPerInterval int
+	// MaxIdleConnectionAge enables pruning of idle connections.
+	// If set, the server periodically (every MaxIdleConnectionAge/2) closes all sessions that didn't receive any packet
+	// for longer than MaxIdleConnectionAge, starting with the least recently used one.
+	// Pruned sessions are closed with a NO_ERROR CONNECTION_CLOSE with the reason "idle timeout".
+	// If not set, sessions are only closed when the IdleTimeout expires.
+	// This option is only valid for the server.
+	MaxIdleConnectionAge time.Duration
+	// MaxConnectionSendBufferBytes is the maximum number of bytes buffered in the send buffers of all streams of a connection.
+	// When this limit is reached, calls to Write block until data has been sent.
+	// If this value is zero, it will default to 4 MB.
+	MaxConnectionSendBufferBytes uint64
+	// MaxBurstPackets is the maximum number of packets sent in a single burst.
+	// When the congestion window opens up (e.g. after a quiet period), the session would otherwise send
+	// a full congestion window at once, delaying packets of other sessions sharing the same network interface.
+	// After sending a burst, the session yields to other goroutines before continuing to send.
+	// If not set, it will default to 10.
+	MaxBurstPackets int
+	// OnReadAvailable is called when enough data is available for reading on a stream,
+	// see Stream.SetReadNotifyThreshold.
+	// This allows serving many streams without using a goroutine per stream that blocks in Read.
+	// It must not block.
+	OnReadAvailable func(str ReceiveStream, available int)
+	// EventHooks are called when certain events happen on a connection, see EventHooks.
+	EventHooks EventHooks
+	// Tracer is used to trace packet- and frame-level events of connections.
+	// If nil, connections are not traced.
+	Tracer Tracer
+	// MetricsCollector collects aggregated metrics of all connections of a Listener or a Dialer.
+	// The same MetricsCollector may be used for multiple Listeners and Dialers.
+	// If nil, no metrics are collected.
+	MetricsCollector MetricsCollector
+	// PacketCapturer captures the raw UDP datagrams sent and received by connections, see PcapWriter.
+	// If nil, datagrams are not captured.
+	PacketCapturer PacketCapturer
+	// Logger receives the log messages of the Listener or the Dialer, and of all its connections.
+	// Messages logged by a connection carry its connection ID and the perspective.
+	// If nil, messages are logged to stderr, according to the QUIC_GO_LOG_LEVEL environment variable.
+	Logger Logger
 	// KeepAlive defines whether this peer will periodically send a packet to keep the connection alive.
 	KeepAlive bool
+	// PaddingStrategy determines how packets are padded.
+	// The client's Initial packets are always padded to 1200 bytes, independent of this setting.
+	// If not set, packets are not padded.
+	PaddingStrategy PaddingStrategy
+	// ObfuscateStreamFingerprint randomizes the delay of ACKs,
+	// such that the timing of ACKs reveals less about the packets received.
+	// It is typically combined with a PaddingStrategy.
+	ObfuscateStreamFingerprint bool
+	// EnableDatagrams advertises support for DATAGRAM frames (the max_datagram_frame_size transport parameter).
+	// Received DATAGRAM frames are read using Session.ReceiveUnreliable.
+	// If not set, receiving a DATAGRAM frame closes the connection with a PROTOCOL_VIOLATION.
+	EnableDatagrams bool
+	// EnableFrameGreasing enables GREASE frames.
+	// These are frames of a reserved frame type that don't carry any content,
+	// and are added to some 1-RTT packets to exercise the peer's handling of unknown frame types.
+	// Reserving these frame types is a quic-go convention, not part of the QUIC specification.
+	// If enabled, quic-go advertises that it ignores GREASE frames using a private transport parameter,
+	// and only sends GREASE frames if the peer advertised the same.
+	// If not enabled, receiving a GREASE frame closes the connection with a FRAME_ENCODING_ERROR,
+	// like any other unknown frame type.
+	// Independent of this setting, a reserved transport parameter is sent during the handshake.
+	EnableFrameGreasing bool
+	// CustomTransportParameters are sent to the peer in addition to the transport parameters used by quic-go,
+	// e.g. to negotiate an experimental extension.
+	// The IDs must fit into 16 bits, and must not collide with the transport parameters defined by the QUIC specification.
+	// The peer's custom transport parameters can be read using Session.PeerTransportParameters.
+	CustomTransportParameters map[uint64][]byte
+	// OnCustomFrame is called for every frame received of a frame type registered using RegisterFrameType.
+	// It is called from the session's run loop, and must return quickly.
+	// Warning: This API should not be considered stable and might change soon.
+	OnCustomFrame func(sess Session, frame CustomFrame)
+	// UDPReceiveBufferSize is the size that the receive and send buffers of the UDP socket are set to.
+	// This only applies to UDP sockets created by quic-go (i.e. when using ListenAddr and DialAddr).
+	// For other sockets, use SetUDPBufferSizes.
+	// If not set, it will default to 2 MB.
+	UDPReceiveBufferSize int
+
+	// testingTB is set by EnableErrorInjection
+	testingTB TB
+	// customFrameTypes are set by RegisterFrameType
+	customFrameTypes map[uint64]CustomFrameDecoder
 }
 
 // A Listener for incoming QUIC connections
 type Listener interface {
-	// Close the server. All active sessions will be closed.
+	// Close stops accepting new sessions.
+	// Sessions that were already accepted are not closed, and can continue to be used until they are closed.
+	// Sessions that were not yet accepted are closed.
 	Close() error
+	// Shutdown closes the listener and waits until all sessions have been closed.
+	// If the context is canceled before that, the remaining sessions are closed.
+	// Warning: This API should not be considered stable and might change soon.
+	Shutdown(ctx context.Context) error
 	// Addr returns the local network addr that the server is listening on.
 	Addr() net.Addr
 	// Accept returns new sessions. It should be called in a loop.
 	Accept() (Session, error)
+	// AcceptWithProtocol returns new sessions, together with the application protocol negotiated using ALPN.
+	// It can be used to dispatch sessions to different application logic, if the server supports multiple protocols.
+	// The protocol is also available from Session.ConnectionState().NegotiatedProtocol.
+	AcceptWithProtocol() (Session, string, error)
+	// AcceptEarly returns new sessions as soon as the server has sent its first flight,
+	// before the handshake completes. It should be called in a loop.
+	// Sessions returned by AcceptEarly are not returned by Accept.
+	// See EarlySession for the security implications.
+	AcceptEarly(ctx context.Context) (EarlySession, error)
+	// Stats returns statistics about the listener.
+	// Warning: This API should not be considered stable and might change soon.
+	Stats() ListenerStats
+	// ActiveConnections returns the number of sessions created by this listener that are still running.
+	ActiveConnections() int
+}
+
+// ListenerStats contains statistics about a Listener.
+// The counters are cumulative since the listener was created.
+// RetryActive and HandshakingSessions describe the state of the listener at the time Stats was called,
+// and might already have changed when they are read.
+type ListenerStats struct {
+	// RefusedSessions is the number of connection attempts that were refused because the accept queue was full.
+	RefusedSessions uint64
+	// RetryActive says if the server sent Retries to clients rejected by AcceptCookie when Stats was called.
+	// The server switches Retries on and off depending on its load, so this is only a snapshot.
+	// It is only set if load-adaptive address validation is enabled (see Config.RetryHandshakeThreshold).
+	RetryActive bool
+	// HandshakingSessions is the number of sessions that were handshaking when Stats was called.
+	// It is only tracked if load-adaptive address validation is enabled (see Config.RetryHandshakeThreshold).
+	HandshakingSessions int
+	// DroppedInitials is the number of Initial packets dropped because the Config.InitialCryptoRateLimit was exceeded.
+	DroppedInitials uint64
+	// RejectedInitials is the number of Initial packets rejected or dropped by Config.VerifySourceAddress.
+	RejectedInitials uint64
+	// OverBudgetInitials is the number of Initial packets dropped because the sending IP address
+	// exceeded the Config.MaxInitialsPerIPPerInterval.
+	OverBudgetInitials uint64
+	// DroppedPackets is the number of packets dropped before they could be passed to a session, by drop reason,
+	// e.g. packets with an unknown connection ID, or using an unsupported QUIC version.
+	// Packets counted in DroppedInitials, RejectedInitials and OverBudgetInitials are not included.
+	// Reasons that no packets were dropped for are omitted.
+	DroppedPackets map[PacketDropReason]uint64
+}
+
+// A TB is the subset of testing.TB used by the error injection methods.
+// It is defined here to avoid importing the testing package.
+type TB interface {
+	Helper()
+	Logf(format string, args ...interface{})
 }
@@ -16,8 +16,11 @@ func stripNonAckElicitingFrames(fs []wire.Frame) []wire.Frame {
 // IsFrameAckEliciting returns true if the frame is ack-eliciting.
 func IsFrameAckEliciting(f wire.Frame) bool {
 	switch f.(type) {
-	case *wire.AckFrame:
+	case *wire.AckFrame, *wire.GreaseFrame:
 		return false
+	case *wire.DatagramFrame:
+		// DATAGRAM frames are ack-eliciting, even though they are not subject to flow control
+		return true
 	default:
 		return true
 	}
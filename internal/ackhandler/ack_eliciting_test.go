@@ -12,9 +12,12 @@ var _ = Describe("ack-eliciting frames", func() {
 	for fl, el := range map[wire.Frame]bool{
 		&wire.AckFrame{}:             false,
 		&wire.DataBlockedFrame{}:     true,
+		&wire.DatagramFrame{}:        true,
 		&wire.ConnectionCloseFrame{}: true,
+		&wire.GreaseFrame{}:          false,
 		&wire.PingFrame{}:            true,
 		&wire.ResetStreamFrame{}:     true,
+		&wire.StopSendingFrame{}:     true,
 		&wire.StreamFrame{}:          true,
 		&wire.MaxDataFrame{}:         true,
 		&wire.MaxStreamDataFrame{}:   true,
@@ -0,0 +1,24 @@
+// +build internal_test
+
+package ackhandler
+
+import (
+	"fmt"
+
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+)
+
+// DeclareLost declares an outstanding 1-RTT packet lost, without waiting for loss detection.
+// It is only used for error injection, and only available in builds with the internal_test build tag.
+func (h *sentPacketHandler) DeclareLost(pn protocol.PacketNumber) error {
+	p := h.oneRTTPackets.history.GetPacket(pn)
+	if p == nil {
+		return fmt.Errorf("packet %#x is not outstanding", pn)
+	}
+	h.logger.Debugf("Declaring packet %#x lost", pn)
+	if err := h.onPacketLost(p, h.oneRTTPackets, h.bytesInFlight, PacketLossInjected); err != nil {
+		return err
+	}
+	h.updateLossDetectionAlarm()
+	return nil
+}
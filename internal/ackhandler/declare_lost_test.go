@@ -0,0 +1,80 @@
+// +build internal_test
+
+package ackhandler
+
+import (
+	"time"
+
+	"github.com/lucas-clemente/quic-go/internal/congestion"
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+	"github.com/lucas-clemente/quic-go/internal/utils"
+	"github.com/lucas-clemente/quic-go/internal/wire"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Declaring packets lost", func() {
+	var handler *sentPacketHandler
+
+	BeforeEach(func() {
+		handler = NewSentPacketHandler(42, &congestion.RTTStats{}, nil, nil, nil, utils.DefaultLogger).(*sentPacketHandler)
+		handler.SetHandshakeComplete()
+	})
+
+	getPacket := func(pn protocol.PacketNumber) *Packet {
+		if el, ok := handler.oneRTTPackets.history.packetMap[pn]; ok {
+			return &el.Value
+		}
+		return nil
+	}
+
+	expectInPacketHistory := func(expected []protocol.PacketNumber) {
+		ExpectWithOffset(1, handler.oneRTTPackets.history.Len()).To(Equal(len(expected)))
+		for _, p := range expected {
+			ExpectWithOffset(1, handler.oneRTTPackets.history.packetMap).To(HaveKey(p))
+		}
+	}
+
+	It("declares packets lost", func() {
+		handler.SentPacket(ackElicitingPacket(&Packet{PacketNumber: 1, EncryptionLevel: protocol.Encryption1RTT}))
+		handler.SentPacket(ackElicitingPacket(&Packet{PacketNumber: 2, EncryptionLevel: protocol.Encryption1RTT}))
+		bytesInFlight := handler.bytesInFlight
+		Expect(handler.DeclareLost(2)).To(Succeed())
+		Expect(handler.bytesInFlight).To(Equal(bytesInFlight - getPacket(1).Length))
+		expectInPacketHistory([]protocol.PacketNumber{1})
+		p := handler.DequeuePacketForRetransmission()
+		Expect(p).ToNot(BeNil())
+		Expect(p.PacketNumber).To(Equal(protocol.PacketNumber(2)))
+		Expect(handler.DequeuePacketForRetransmission()).To(BeNil())
+	})
+
+	It("reports lost packets", func() {
+		type lostPacket struct {
+			pn       protocol.PacketNumber
+			encLevel protocol.EncryptionLevel
+			trigger  PacketLossTrigger
+		}
+		var lost []lostPacket
+		handler.lostPacketCallback = func(pn protocol.PacketNumber, encLevel protocol.EncryptionLevel, trigger PacketLossTrigger) {
+			lost = append(lost, lostPacket{pn: pn, encLevel: encLevel, trigger: trigger})
+		}
+		now := time.Now()
+		handler.SentPacket(ackElicitingPacket(&Packet{PacketNumber: 1, SendTime: now.Add(-time.Hour), EncryptionLevel: protocol.Encryption1RTT}))
+		handler.SentPacket(ackElicitingPacket(&Packet{PacketNumber: 2, SendTime: now.Add(-time.Hour), EncryptionLevel: protocol.Encryption1RTT}))
+		handler.SentPacket(ackElicitingPacket(&Packet{PacketNumber: 3, SendTime: now.Add(-time.Second), EncryptionLevel: protocol.Encryption1RTT}))
+		handler.SentPacket(ackElicitingPacket(&Packet{PacketNumber: 4, SendTime: now, EncryptionLevel: protocol.Encryption1RTT}))
+		ack := &wire.AckFrame{AckRanges: []wire.AckRange{{Smallest: 3, Largest: 3}}}
+		Expect(handler.ReceivedAck(ack, 1, protocol.Encryption1RTT, now)).To(Succeed())
+		Expect(handler.DeclareLost(4)).To(Succeed())
+		Expect(lost).To(Equal([]lostPacket{
+			{pn: 1, encLevel: protocol.Encryption1RTT, trigger: PacketLossTimeThreshold},
+			{pn: 2, encLevel: protocol.Encryption1RTT, trigger: PacketLossTimeThreshold},
+			{pn: 4, encLevel: protocol.Encryption1RTT, trigger: PacketLossInjected},
+		}))
+	})
+
+	It("errors when declaring a packet lost that is not outstanding", func() {
+		handler.SentPacket(ackElicitingPacket(&Packet{PacketNumber: 1, EncryptionLevel: protocol.Encryption1RTT}))
+		Expect(handler.DeclareLost(2)).To(MatchError("packet 0x2 is not outstanding"))
+	})
+})
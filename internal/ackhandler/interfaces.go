@@ -3,6 +3,7 @@ package ackhandler
 import (
 	"time"
 
+	"github.com/lucas-clemente/quic-go/internal/congestion"
 	"github.com/lucas-clemente/quic-go/internal/protocol"
 	"github.com/lucas-clemente/quic-go/internal/wire"
 )
@@ -14,6 +15,9 @@ type SentPacketHandler interface {
 	SentPacketsAsRetransmission(packets []*Packet, retransmissionOf protocol.PacketNumber)
 	ReceivedAck(ackFrame *wire.AckFrame, withPacketNumber protocol.PacketNumber, encLevel protocol.EncryptionLevel, recvTime time.Time) error
 	SetHandshakeComplete()
+	// DropPackets drops all packets of the Initial or the Handshake packet number space.
+	// It is called when the keys for this encryption level are dropped.
+	DropPackets(protocol.EncryptionLevel)
 	ResetForRetry() error
 
 	// The SendMode determines if and what kind of packets can be sent.
@@ -31,6 +35,8 @@ type SentPacketHandler interface {
 	// only to be called once the handshake is complete
 	GetLowestPacketNotConfirmedAcked() protocol.PacketNumber
 	DequeuePacketForRetransmission() *Packet
+	// DequeueProbePacket returns the packet that should be retransmitted as a probe packet.
+	// It returns nil if there is no packet that could be retransmitted.
 	DequeueProbePacket() (*Packet, error)
 
 	PeekPacketNumber(protocol.EncryptionLevel) (protocol.PacketNumber, protocol.PacketNumberLen)
@@ -38,12 +44,57 @@ type SentPacketHandler interface {
 
 	GetAlarmTimeout() time.Time
 	OnAlarm() error
+
+	// DeliveryRate returns the smoothed delivery rate, in bytes per second.
+	// It returns 0 if no estimate is available yet.
+	// It is safe to call it concurrently with the other methods.
+	DeliveryRate() float64
+
+	GetCongestionWindow() protocol.ByteCount
+	GetBytesInFlight() protocol.ByteCount
+	GetSlowStartThreshold() protocol.ByteCount
+	GetCongestionState() congestion.State
+	GetStats() SentPacketStats
+}
+
+// SentPacketStats are statistics about the packets sent by the SentPacketHandler.
+type SentPacketStats struct {
+	// PacketsLost and BytesLost count the packets that were declared lost.
+	PacketsLost uint64
+	BytesLost   protocol.ByteCount
+	// PacketsRetransmitted and BytesRetransmitted count the packets that were sent as a retransmission,
+	// either of a lost packet, or as a probe packet.
+	PacketsRetransmitted uint64
+	BytesRetransmitted   protocol.ByteCount
+	// ProbeTimeouts is the number of times the crypto retransmission timer or the PTO fired.
+	ProbeTimeouts uint64
+	// SpuriousLosses is the number of packets that were declared lost, but were acknowledged later.
+	SpuriousLosses uint64
+	// SpuriousRetransmissions is the number of lost packets that were retransmitted, but were acknowledged later.
+	SpuriousRetransmissions uint64
+	// PacketLossRate is the fraction of packets declared lost,
+	// as an exponentially weighted moving average over the last 10 RTTs.
+	PacketLossRate float64
 }
 
+// A PacketLossTrigger is the reason why a packet was declared lost.
+type PacketLossTrigger uint8
+
+const (
+	// PacketLossTimeThreshold is used when a packet was sent too long before a packet that was acknowledged.
+	PacketLossTimeThreshold PacketLossTrigger = iota
+	// PacketLossInjected is used when a packet was declared lost by error injection.
+	PacketLossInjected
+)
+
 // ReceivedPacketHandler handles ACKs needed to send for incoming packets
 type ReceivedPacketHandler interface {
 	ReceivedPacket(pn protocol.PacketNumber, encLevel protocol.EncryptionLevel, rcvTime time.Time, shouldInstigateAck bool) error
 	IgnoreBelow(protocol.PacketNumber)
+	// IsPotentiallyDuplicate says if a packet might have been received before.
+	IsPotentiallyDuplicate(protocol.PacketNumber, protocol.EncryptionLevel) bool
+	// DropPackets drops the state for the Initial or the Handshake packet number space.
+	DropPackets(protocol.EncryptionLevel)
 
 	GetAlarmTimeout() time.Time
 	GetAckFrame(protocol.EncryptionLevel) *wire.AckFrame
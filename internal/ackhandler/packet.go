@@ -15,6 +15,9 @@ type Packet struct {
 	Length          protocol.ByteCount
 	EncryptionLevel protocol.EncryptionLevel
 	SendTime        time.Time
+	// CryptoDataChecksums contains a checksum of the data of every CRYPTO frame, indexed by its offset.
+	// It is only set when built with the debug build tag.
+	CryptoDataChecksums map[protocol.ByteCount]uint64
 
 	largestAcked protocol.PacketNumber // if the packet contains an ACK, the LargestAcked value of that ACK
 
@@ -26,4 +29,9 @@ type Packet struct {
 	retransmittedAs         []protocol.PacketNumber
 	isRetransmission        bool // we need a separate bool here because 0 is a valid packet number
 	retransmissionOf        protocol.PacketNumber
+
+	// the state of the delivery rate estimation when this packet was sent
+	delivered     protocol.ByteCount
+	deliveredTime time.Time
+	firstSentTime time.Time
 }
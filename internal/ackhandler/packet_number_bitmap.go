@@ -0,0 +1,68 @@
+package ackhandler
+
+import (
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+)
+
+// packetNumberBitmapSize is the number of packet numbers tracked by the packetNumberBitmap
+const packetNumberBitmapSize = 128
+
+// The packetNumberBitmap tracks which of the most recent packet numbers of a packet number space were received.
+// It covers a sliding window of packetNumberBitmapSize packet numbers, ending at the largest packet number received.
+// For packet numbers inside this window, it says exactly if a packet was received before.
+type packetNumberBitmap struct {
+	// bit i is set if packet largest-i was received
+	// bits[0] holds the bits 0 to 63, bits[1] the bits 64 to 127
+	bits       [2]uint64
+	largest    protocol.PacketNumber
+	hasLargest bool
+}
+
+// InWindow says if a packet number is inside the window covered by the bitmap.
+// Packet numbers larger than the largest packet number received are not inside the window.
+func (b *packetNumberBitmap) InWindow(pn protocol.PacketNumber) bool {
+	return b.hasLargest && pn <= b.largest && b.largest-pn < packetNumberBitmapSize
+}
+
+// IsDuplicate says if a packet number is inside the window and was already received.
+func (b *packetNumberBitmap) IsDuplicate(pn protocol.PacketNumber) bool {
+	if !b.InWindow(pn) {
+		return false
+	}
+	i := uint(b.largest - pn)
+	return b.bits[i/64]&(1<<(i%64)) != 0
+}
+
+// Add marks a packet number as received.
+// If it is larger than the largest packet number received so far, the window slides forward.
+// Packet numbers below the window are ignored.
+func (b *packetNumberBitmap) Add(pn protocol.PacketNumber) {
+	if !b.hasLargest || pn > b.largest {
+		if b.hasLargest {
+			b.shift(uint64(pn - b.largest))
+		}
+		b.largest = pn
+		b.hasLargest = true
+		b.bits[0] |= 1
+		return
+	}
+	if !b.InWindow(pn) {
+		return
+	}
+	i := uint(b.largest - pn)
+	b.bits[i/64] |= 1 << (i % 64)
+}
+
+// shift moves all bits by n positions towards the end of the window
+func (b *packetNumberBitmap) shift(n uint64) {
+	switch {
+	case n >= packetNumberBitmapSize:
+		b.bits[0], b.bits[1] = 0, 0
+	case n >= 64:
+		b.bits[1] = b.bits[0] << (n - 64)
+		b.bits[0] = 0
+	default:
+		b.bits[1] = b.bits[1]<<n | b.bits[0]>>(64-n)
+		b.bits[0] <<= n
+	}
+}
@@ -0,0 +1,90 @@
+package ackhandler
+
+import (
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Packet Number Bitmap", func() {
+	var b *packetNumberBitmap
+
+	BeforeEach(func() {
+		b = &packetNumberBitmap{}
+	})
+
+	It("doesn't report duplicates before any packet was added", func() {
+		Expect(b.InWindow(0)).To(BeFalse())
+		Expect(b.IsDuplicate(0)).To(BeFalse())
+	})
+
+	It("detects duplicates", func() {
+		b.Add(0)
+		b.Add(2)
+		Expect(b.IsDuplicate(0)).To(BeTrue())
+		Expect(b.IsDuplicate(1)).To(BeFalse())
+		Expect(b.IsDuplicate(2)).To(BeTrue())
+		Expect(b.IsDuplicate(3)).To(BeFalse())
+	})
+
+	It("adds reordered packets", func() {
+		b.Add(100)
+		b.Add(42)
+		Expect(b.IsDuplicate(42)).To(BeTrue())
+		Expect(b.IsDuplicate(43)).To(BeFalse())
+		Expect(b.IsDuplicate(100)).To(BeTrue())
+	})
+
+	It("slides the window", func() {
+		b.Add(10)
+		b.Add(11)
+		b.Add(20)
+		Expect(b.InWindow(10)).To(BeTrue())
+		b.Add(10 + packetNumberBitmapSize - 1)
+		Expect(b.InWindow(10)).To(BeTrue())
+		Expect(b.IsDuplicate(10)).To(BeTrue())
+		b.Add(10 + packetNumberBitmapSize)
+		Expect(b.InWindow(10)).To(BeFalse())
+		Expect(b.IsDuplicate(10)).To(BeFalse())
+		Expect(b.IsDuplicate(11)).To(BeTrue())
+		Expect(b.IsDuplicate(12)).To(BeFalse())
+		Expect(b.IsDuplicate(20)).To(BeTrue())
+	})
+
+	It("ignores packets below the window", func() {
+		b.Add(1000)
+		b.Add(1000 - packetNumberBitmapSize)
+		Expect(b.IsDuplicate(1000 - packetNumberBitmapSize)).To(BeFalse())
+		Expect(b.IsDuplicate(1000 - packetNumberBitmapSize + 1)).To(BeFalse())
+	})
+
+	It("clears the bitmap when the window slides by more than its size", func() {
+		b.Add(5)
+		b.Add(6)
+		b.Add(6 + packetNumberBitmapSize + 1)
+		Expect(b.IsDuplicate(6)).To(BeFalse())
+		Expect(b.bits).To(Equal([2]uint64{1, 0}))
+	})
+
+	It("tracks the same packets as a map, if packets are reordered", func() {
+		received := make(map[protocol.PacketNumber]bool)
+		var largest protocol.PacketNumber
+		for i := 0; i < 5000; i++ {
+			pn := protocol.PacketNumber(i) + protocol.PacketNumber(i*7919%61) - 30
+			if pn < 0 {
+				pn = 0
+			}
+			if pn > largest {
+				largest = pn
+			}
+			if largest-pn < packetNumberBitmapSize {
+				received[pn] = true
+			}
+			b.Add(pn)
+		}
+		for pn := largest - packetNumberBitmapSize + 1; pn <= largest; pn++ {
+			Expect(b.IsDuplicate(pn)).To(Equal(received[pn]))
+		}
+	})
+})
@@ -44,13 +44,14 @@ var _ ReceivedPacketHandler = &receivedPacketHandler{}
 // NewReceivedPacketHandler creates a new receivedPacketHandler
 func NewReceivedPacketHandler(
 	rttStats *congestion.RTTStats,
+	randomizeAckDelay bool,
 	logger utils.Logger,
 	version protocol.VersionNumber,
 ) ReceivedPacketHandler {
 	return &receivedPacketHandler{
-		initialPackets:   newReceivedPacketTracker(rttStats, logger, version),
-		handshakePackets: newReceivedPacketTracker(rttStats, logger, version),
-		oneRTTPackets:    newReceivedPacketTracker(rttStats, logger, version),
+		initialPackets:   newReceivedPacketTracker(rttStats, randomizeAckDelay, logger, version),
+		handshakePackets: newReceivedPacketTracker(rttStats, randomizeAckDelay, logger, version),
+		oneRTTPackets:    newReceivedPacketTracker(rttStats, randomizeAckDelay, logger, version),
 	}
 }
 
@@ -62,8 +63,14 @@ func (h *receivedPacketHandler) ReceivedPacket(
 ) error {
 	switch encLevel {
 	case protocol.EncryptionInitial:
+		if h.initialPackets == nil {
+			return nil
+		}
 		return h.initialPackets.ReceivedPacket(pn, rcvTime, shouldInstigateAck)
 	case protocol.EncryptionHandshake:
+		if h.handshakePackets == nil {
+			return nil
+		}
 		return h.handshakePackets.ReceivedPacket(pn, rcvTime, shouldInstigateAck)
 	case protocol.Encryption1RTT:
 		return h.oneRTTPackets.ReceivedPacket(pn, rcvTime, shouldInstigateAck)
@@ -77,9 +84,48 @@ func (h *receivedPacketHandler) IgnoreBelow(pn protocol.PacketNumber) {
 	h.oneRTTPackets.IgnoreBelow(pn)
 }
 
+// IsPotentiallyDuplicate says if a packet might have been received before.
+// Duplicate packets should be dropped without processing them.
+func (h *receivedPacketHandler) IsPotentiallyDuplicate(pn protocol.PacketNumber, encLevel protocol.EncryptionLevel) bool {
+	switch encLevel {
+	case protocol.EncryptionInitial:
+		if h.initialPackets == nil {
+			return false
+		}
+		return h.initialPackets.IsPotentiallyDuplicate(pn)
+	case protocol.EncryptionHandshake:
+		if h.handshakePackets == nil {
+			return false
+		}
+		return h.handshakePackets.IsPotentiallyDuplicate(pn)
+	case protocol.Encryption1RTT:
+		return h.oneRTTPackets.IsPotentiallyDuplicate(pn)
+	default:
+		return false
+	}
+}
+
+// DropPackets drops the state for the Initial or the Handshake packet number space.
+// No ACKs are generated for this packet number space afterwards.
+func (h *receivedPacketHandler) DropPackets(encLevel protocol.EncryptionLevel) {
+	switch encLevel {
+	case protocol.EncryptionInitial:
+		h.initialPackets = nil
+	case protocol.EncryptionHandshake:
+		h.handshakePackets = nil
+	default:
+		panic(fmt.Sprintf("Cannot drop keys for encryption level %s", encLevel))
+	}
+}
+
 func (h *receivedPacketHandler) GetAlarmTimeout() time.Time {
-	initialAlarm := h.initialPackets.GetAlarmTimeout()
-	handshakeAlarm := h.handshakePackets.GetAlarmTimeout()
+	var initialAlarm, handshakeAlarm time.Time
+	if h.initialPackets != nil {
+		initialAlarm = h.initialPackets.GetAlarmTimeout()
+	}
+	if h.handshakePackets != nil {
+		handshakeAlarm = h.handshakePackets.GetAlarmTimeout()
+	}
 	oneRTTAlarm := h.oneRTTPackets.GetAlarmTimeout()
 	return utils.MinNonZeroTime(utils.MinNonZeroTime(initialAlarm, handshakeAlarm), oneRTTAlarm)
 }
@@ -87,8 +133,14 @@ func (h *receivedPacketHandler) GetAlarmTimeout() time.Time {
 func (h *receivedPacketHandler) GetAckFrame(encLevel protocol.EncryptionLevel) *wire.AckFrame {
 	switch encLevel {
 	case protocol.EncryptionInitial:
+		if h.initialPackets == nil {
+			return nil
+		}
 		return h.initialPackets.GetAckFrame()
 	case protocol.EncryptionHandshake:
+		if h.handshakePackets == nil {
+			return nil
+		}
 		return h.handshakePackets.GetAckFrame()
 	case protocol.Encryption1RTT:
 		return h.oneRTTPackets.GetAckFrame()
@@ -18,6 +18,7 @@ var _ = Describe("Received Packet Handler", func() {
 	BeforeEach(func() {
 		handler = NewReceivedPacketHandler(
 			&congestion.RTTStats{},
+			false,
 			utils.DefaultLogger,
 			protocol.VersionWhatever,
 		)
@@ -44,4 +45,41 @@ var _ = Describe("Received Packet Handler", func() {
 		Expect(oneRTTAck.AckRanges).To(HaveLen(1))
 		Expect(oneRTTAck.AckRanges[0]).To(Equal(wire.AckRange{Smallest: 4, Largest: 5}))
 	})
+
+	It("detects duplicates per packet number space", func() {
+		now := time.Now()
+		Expect(handler.ReceivedPacket(2, protocol.EncryptionInitial, now, true)).To(Succeed())
+		Expect(handler.ReceivedPacket(3, protocol.EncryptionHandshake, now, true)).To(Succeed())
+		Expect(handler.ReceivedPacket(4, protocol.Encryption1RTT, now, true)).To(Succeed())
+		Expect(handler.IsPotentiallyDuplicate(2, protocol.EncryptionInitial)).To(BeTrue())
+		Expect(handler.IsPotentiallyDuplicate(2, protocol.EncryptionHandshake)).To(BeFalse())
+		Expect(handler.IsPotentiallyDuplicate(3, protocol.EncryptionHandshake)).To(BeTrue())
+		Expect(handler.IsPotentiallyDuplicate(3, protocol.Encryption1RTT)).To(BeFalse())
+		Expect(handler.IsPotentiallyDuplicate(4, protocol.Encryption1RTT)).To(BeTrue())
+		handler.DropPackets(protocol.EncryptionInitial)
+		Expect(handler.IsPotentiallyDuplicate(2, protocol.EncryptionInitial)).To(BeFalse())
+	})
+
+	It("drops Initial packets", func() {
+		now := time.Now()
+		Expect(handler.ReceivedPacket(2, protocol.EncryptionInitial, now, true)).To(Succeed())
+		Expect(handler.ReceivedPacket(1, protocol.EncryptionHandshake, now, true)).To(Succeed())
+		handler.DropPackets(protocol.EncryptionInitial)
+		Expect(handler.GetAckFrame(protocol.EncryptionInitial)).To(BeNil())
+		Expect(handler.GetAckFrame(protocol.EncryptionHandshake)).ToNot(BeNil())
+		// packets received after dropping the packet number space are ignored
+		Expect(handler.ReceivedPacket(3, protocol.EncryptionInitial, now, true)).To(Succeed())
+		Expect(handler.GetAckFrame(protocol.EncryptionInitial)).To(BeNil())
+	})
+
+	It("drops Handshake packets", func() {
+		Expect(handler.ReceivedPacket(1, protocol.EncryptionHandshake, time.Now(), true)).To(Succeed())
+		handler.DropPackets(protocol.EncryptionHandshake)
+		Expect(handler.GetAlarmTimeout()).To(BeZero())
+		Expect(handler.GetAckFrame(protocol.EncryptionHandshake)).To(BeNil())
+	})
+
+	It("refuses to drop 1-RTT packets", func() {
+		Expect(func() { handler.DropPackets(protocol.Encryption1RTT) }).To(Panic())
+	})
 })
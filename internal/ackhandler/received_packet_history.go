@@ -96,6 +96,24 @@ func (h *receivedPacketHistory) DeleteBelow(p protocol.PacketNumber) {
 	}
 }
 
+// IsPotentiallyDuplicate says if a packet with packet number p might have been received before.
+// Packets below the lowest packet number that is still tracked are considered duplicates,
+// since it's not possible to tell if they were received.
+func (h *receivedPacketHistory) IsPotentiallyDuplicate(p protocol.PacketNumber) bool {
+	if p < h.lowestInReceivedPacketNumbers {
+		return true
+	}
+	for el := h.ranges.Back(); el != nil; el = el.Prev() {
+		if p > el.Value.End {
+			return false
+		}
+		if p >= el.Value.Start {
+			return true
+		}
+	}
+	return false
+}
+
 // GetAckRanges gets a slice of all AckRanges that can be used in an AckFrame
 func (h *receivedPacketHistory) GetAckRanges() []wire.AckRange {
 	if h.ranges.Len() == 0 {
@@ -198,6 +198,35 @@ var _ = Describe("receivedPacketHistory", func() {
 		})
 	})
 
+	Context("duplicate detection", func() {
+		It("doesn't declare packets duplicates if the history is empty", func() {
+			Expect(hist.IsPotentiallyDuplicate(5)).To(BeFalse())
+		})
+
+		It("detects duplicates in existing ranges", func() {
+			hist.ReceivedPacket(4)
+			hist.ReceivedPacket(5)
+			hist.ReceivedPacket(6)
+			hist.ReceivedPacket(10)
+			Expect(hist.IsPotentiallyDuplicate(3)).To(BeFalse())
+			Expect(hist.IsPotentiallyDuplicate(4)).To(BeTrue())
+			Expect(hist.IsPotentiallyDuplicate(6)).To(BeTrue())
+			Expect(hist.IsPotentiallyDuplicate(7)).To(BeFalse())
+			Expect(hist.IsPotentiallyDuplicate(10)).To(BeTrue())
+			Expect(hist.IsPotentiallyDuplicate(11)).To(BeFalse())
+		})
+
+		It("declares packets below the deleted ranges duplicates", func() {
+			hist.ReceivedPacket(4)
+			hist.ReceivedPacket(10)
+			hist.DeleteBelow(8)
+			Expect(hist.IsPotentiallyDuplicate(4)).To(BeTrue())
+			Expect(hist.IsPotentiallyDuplicate(7)).To(BeTrue())
+			Expect(hist.IsPotentiallyDuplicate(8)).To(BeFalse())
+			Expect(hist.IsPotentiallyDuplicate(10)).To(BeTrue())
+		})
+	})
+
 	Context("ACK range export", func() {
 		It("returns nil if there are no ranges", func() {
 			Expect(hist.GetAckRanges()).To(BeNil())
@@ -1,6 +1,8 @@
 package ackhandler
 
 import (
+	"crypto/rand"
+	"encoding/binary"
 	"time"
 
 	"github.com/lucas-clemente/quic-go/internal/congestion"
@@ -15,9 +17,13 @@ type receivedPacketTracker struct {
 	largestObservedReceivedTime time.Time
 
 	packetHistory *receivedPacketHistory
+	// recentlyReceived tracks the most recent packet numbers, for duplicate detection
+	recentlyReceived packetNumberBitmap
 
 	ackSendDelay time.Duration
 	rttStats     *congestion.RTTStats
+	// randomizeAckDelay makes the ACK timing less predictable
+	randomizeAckDelay bool
 
 	packetsReceivedSinceLastAck             int
 	ackElicitingPacketsReceivedSinceLastAck int
@@ -32,19 +38,22 @@ type receivedPacketTracker struct {
 
 func newReceivedPacketTracker(
 	rttStats *congestion.RTTStats,
+	randomizeAckDelay bool,
 	logger utils.Logger,
 	version protocol.VersionNumber,
 ) *receivedPacketTracker {
 	return &receivedPacketTracker{
-		packetHistory: newReceivedPacketHistory(),
-		ackSendDelay:  ackSendDelay,
-		rttStats:      rttStats,
-		logger:        logger,
-		version:       version,
+		packetHistory:     newReceivedPacketHistory(),
+		ackSendDelay:      ackSendDelay,
+		rttStats:          rttStats,
+		randomizeAckDelay: randomizeAckDelay,
+		logger:            logger,
+		version:           version,
 	}
 }
 
 func (h *receivedPacketTracker) ReceivedPacket(packetNumber protocol.PacketNumber, rcvTime time.Time, shouldInstigateAck bool) error {
+	h.recentlyReceived.Add(packetNumber)
 	if packetNumber < h.ignoreBelow {
 		return nil
 	}
@@ -75,6 +84,20 @@ func (h *receivedPacketTracker) IgnoreBelow(p protocol.PacketNumber) {
 	}
 }
 
+// IsPotentiallyDuplicate says if a packet might have been received before.
+// For recent packets, this is looked up in the bitmap.
+// For older packets, the packet history is used.
+func (h *receivedPacketTracker) IsPotentiallyDuplicate(pn protocol.PacketNumber) bool {
+	// We don't track packets below ignoreBelow any more.
+	if pn < h.ignoreBelow {
+		return true
+	}
+	if h.recentlyReceived.InWindow(pn) {
+		return h.recentlyReceived.IsDuplicate(pn)
+	}
+	return h.packetHistory.IsPotentiallyDuplicate(pn)
+}
+
 // isMissing says if a packet was reported missing in the last ACK.
 func (h *receivedPacketTracker) isMissing(p protocol.PacketNumber) bool {
 	if h.lastAck == nil || p < h.ignoreBelow {
@@ -127,7 +150,7 @@ func (h *receivedPacketTracker) maybeQueueAck(packetNumber protocol.PacketNumber
 			} else if h.ackAlarm.IsZero() {
 				// wait for the minimum of the ack decimation delay or the delayed ack time before sending an ack
 				ackDelay := utils.MinDuration(ackSendDelay, time.Duration(float64(h.rttStats.MinRTT())*float64(ackDecimationDelay)))
-				h.ackAlarm = rcvTime.Add(ackDelay)
+				h.ackAlarm = h.getAckAlarm(rcvTime, ackDelay)
 				if h.logger.Debug() {
 					h.logger.Debugf("\tSetting ACK timer to min(1/4 min-RTT, max ack delay): %s (%s from now)", ackDelay, time.Until(h.ackAlarm))
 				}
@@ -143,14 +166,14 @@ func (h *receivedPacketTracker) maybeQueueAck(packetNumber protocol.PacketNumber
 				if h.logger.Debug() {
 					h.logger.Debugf("\tSetting ACK timer to max ack delay: %s", ackSendDelay)
 				}
-				h.ackAlarm = rcvTime.Add(ackSendDelay)
+				h.ackAlarm = h.getAckAlarm(rcvTime, ackSendDelay)
 			}
 		}
 		// If there are new missing packets to report, set a short timer to send an ACK.
 		if h.hasNewMissingPackets() {
 			// wait the minimum of 1/8 min RTT and the existing ack time
 			ackDelay := time.Duration(float64(h.rttStats.MinRTT()) * float64(shortAckDecimationDelay))
-			ackTime := rcvTime.Add(ackDelay)
+			ackTime := h.getAckAlarm(rcvTime, ackDelay)
 			if h.ackAlarm.IsZero() || h.ackAlarm.After(ackTime) {
 				h.ackAlarm = ackTime
 				if h.logger.Debug() {
@@ -166,6 +189,18 @@ func (h *receivedPacketTracker) maybeQueueAck(packetNumber protocol.PacketNumber
 	}
 }
 
+// getAckAlarm calculates when the ACK alarm for a packet received at rcvTime fires.
+// If the ACK delay is randomized, the alarm fires after a random duration between ackDelay/2 and ackDelay.
+// It never fires later than ackDelay, so we never exceed the max_ack_delay.
+func (h *receivedPacketTracker) getAckAlarm(rcvTime time.Time, ackDelay time.Duration) time.Time {
+	if h.randomizeAckDelay && ackDelay > 0 {
+		b := make([]byte, 8)
+		rand.Read(b) // ignore the error here. Failure to read random data doesn't break anything
+		ackDelay = ackDelay/2 + time.Duration(binary.BigEndian.Uint64(b)%uint64(ackDelay-ackDelay/2+1))
+	}
+	return rcvTime.Add(ackDelay)
+}
+
 func (h *receivedPacketTracker) GetAckFrame() *wire.AckFrame {
 	now := time.Now()
 	if !h.ackQueued && (h.ackAlarm.IsZero() || h.ackAlarm.After(now)) {
@@ -20,7 +20,7 @@ var _ = Describe("Received Packet Tracker", func() {
 
 	BeforeEach(func() {
 		rttStats = &congestion.RTTStats{}
-		tracker = newReceivedPacketTracker(rttStats, utils.DefaultLogger, protocol.VersionWhatever)
+		tracker = newReceivedPacketTracker(rttStats, false, utils.DefaultLogger, protocol.VersionWhatever)
 	})
 
 	Context("accepting packets", func() {
@@ -74,6 +74,33 @@ var _ = Describe("Received Packet Tracker", func() {
 		})
 	})
 
+	Context("detecting duplicates", func() {
+		It("detects duplicates of recent packets", func() {
+			Expect(tracker.IsPotentiallyDuplicate(0)).To(BeFalse())
+			Expect(tracker.ReceivedPacket(10, time.Now(), true)).To(Succeed())
+			Expect(tracker.ReceivedPacket(12, time.Now(), true)).To(Succeed())
+			Expect(tracker.IsPotentiallyDuplicate(10)).To(BeTrue())
+			Expect(tracker.IsPotentiallyDuplicate(11)).To(BeFalse())
+			Expect(tracker.IsPotentiallyDuplicate(12)).To(BeTrue())
+			Expect(tracker.IsPotentiallyDuplicate(13)).To(BeFalse())
+		})
+
+		It("uses the packet history for packets older than the bitmap window", func() {
+			Expect(tracker.ReceivedPacket(10, time.Now(), true)).To(Succeed())
+			Expect(tracker.ReceivedPacket(10+packetNumberBitmapSize+5, time.Now(), true)).To(Succeed())
+			Expect(tracker.recentlyReceived.InWindow(10)).To(BeFalse())
+			Expect(tracker.IsPotentiallyDuplicate(10)).To(BeTrue())
+			Expect(tracker.IsPotentiallyDuplicate(11)).To(BeFalse())
+		})
+
+		It("treats packets below the ignore threshold as duplicates", func() {
+			Expect(tracker.ReceivedPacket(10, time.Now(), true)).To(Succeed())
+			tracker.IgnoreBelow(8)
+			Expect(tracker.IsPotentiallyDuplicate(7)).To(BeTrue())
+			Expect(tracker.IsPotentiallyDuplicate(9)).To(BeFalse())
+		})
+	})
+
 	Context("ACKs", func() {
 		Context("queueing ACKs", func() {
 			receiveAndAck10Packets := func() {
@@ -154,6 +181,25 @@ var _ = Describe("Received Packet Tracker", func() {
 				Expect(tracker.GetAlarmTimeout()).To(Equal(rcvTime.Add(ackSendDelay)))
 			})
 
+			It("randomizes the ACK delay", func() {
+				tracker.randomizeAckDelay = true
+				receiveAndAck10Packets()
+				delays := make(map[time.Duration]struct{})
+				// stay below minReceivedBeforeAckDecimation
+				for i := 0; i < 40; i++ {
+					rcvTime := time.Now()
+					Expect(tracker.ReceivedPacket(protocol.PacketNumber(11+2*i), rcvTime, true)).To(Succeed())
+					Expect(tracker.ackQueued).To(BeFalse())
+					delay := tracker.GetAlarmTimeout().Sub(rcvTime)
+					Expect(delay).To(And(BeNumerically(">=", ackSendDelay/2), BeNumerically("<=", ackSendDelay)))
+					delays[delay] = struct{}{}
+					Expect(tracker.ReceivedPacket(protocol.PacketNumber(12+2*i), rcvTime, true)).To(Succeed())
+					Expect(tracker.ackQueued).To(BeTrue())
+					Expect(tracker.GetAckFrame()).ToNot(BeNil())
+				}
+				Expect(len(delays)).To(BeNumerically(">", 1))
+			})
+
 			It("queues an ACK if it was reported missing before", func() {
 				receiveAndAck10Packets()
 				err := tracker.ReceivedPacket(11, time.Time{}, true)
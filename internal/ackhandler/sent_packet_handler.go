@@ -1,9 +1,9 @@
 package ackhandler
 
 import (
-	"errors"
 	"fmt"
 	"math"
+	"sync/atomic"
 	"time"
 
 	"github.com/lucas-clemente/quic-go/internal/congestion"
@@ -19,14 +19,33 @@ const (
 	timeThreshold = 9.0 / 8
 	// Timer granularity. The timer will not be set to a value smaller than granularity.
 	granularity = time.Millisecond
+	// The weight of a new sample when smoothing the delivery rate.
+	deliveryRateAlpha = 1.0 / 8
+	// The time constant of the packet loss rate, in RTTs.
+	lossRateWindow = 10
 )
 
+// A lostPacketEntry is a lost packet that is tracked to detect spurious losses.
+type lostPacketEntry struct {
+	pn protocol.PacketNumber
+	// retransmitted is set when the frames of the packet were sent in a retransmission
+	retransmitted bool
+}
+
 type packetNumberSpace struct {
 	history *sentPacketHistory
 	pns     *packetNumberGenerator
 
 	largestAcked protocol.PacketNumber
 	largestSent  protocol.PacketNumber
+	// set when the first ACK frame is received, since 0 is a valid value for largestAcked
+	receivedAck bool
+
+	// the highest ECN counts the peer reported so far
+	ect0, ect1, ecnce uint64
+
+	// the most recently lost packets, used to detect spurious losses
+	lostPackets []lostPacketEntry
 }
 
 func newPacketNumberSpace(initialPN protocol.PacketNumber) *packetNumberSpace {
@@ -36,6 +55,75 @@ func newPacketNumberSpace(initialPN protocol.PacketNumber) *packetNumberSpace {
 	}
 }
 
+// lostPacket remembers the packet number of a lost packet, to detect spurious losses.
+func (s *packetNumberSpace) lostPacket(pn protocol.PacketNumber) {
+	if len(s.lostPackets) >= protocol.MaxTrackedLostPackets {
+		s.lostPackets = s.lostPackets[1:]
+	}
+	s.lostPackets = append(s.lostPackets, lostPacketEntry{pn: pn})
+}
+
+// retransmittedLostPacket remembers that the frames of a lost packet were retransmitted.
+func (s *packetNumberSpace) retransmittedLostPacket(pn protocol.PacketNumber) {
+	for i := len(s.lostPackets) - 1; i >= 0; i-- {
+		if s.lostPackets[i].pn == pn {
+			s.lostPackets[i].retransmitted = true
+			return
+		}
+	}
+}
+
+// detectSpuriousLosses returns the number of lost packets that are acknowledged by an ACK frame,
+// and how many of them were retransmitted.
+// These packets are not tracked any more.
+func (s *packetNumberSpace) detectSpuriousLosses(ackFrame *wire.AckFrame) (uint64 /* spurious losses */, uint64 /* spurious retransmissions */) {
+	if len(s.lostPackets) == 0 {
+		return 0, 0
+	}
+	var losses, retransmissions uint64
+	lostPackets := s.lostPackets[:0]
+	for _, p := range s.lostPackets {
+		if ackFrame.AcksPacket(p.pn) {
+			losses++
+			if p.retransmitted {
+				retransmissions++
+			}
+			continue
+		}
+		lostPackets = append(lostPackets, p)
+	}
+	s.lostPackets = lostPackets
+	return losses, retransmissions
+}
+
+// validateECNCounts validates the ECN counts of an ACK frame, see section 13.4.2 of the transport draft.
+// The counts are cumulative, so they must never decrease.
+// Every counted packet must have been acknowledged, so the sum of the counts can't exceed
+// the number of packets that the ACK ranges (and everything below the lowest range) acknowledge.
+// It must only be called for ACK frames that increase the largest acknowledged packet number:
+// ACK frames can be reordered, and an outdated ACK frame carries lower counts.
+func (s *packetNumberSpace) validateECNCounts(ackFrame *wire.AckFrame) error {
+	if !ackFrame.HasECNCounts() {
+		return nil
+	}
+	if ackFrame.ECT0 < s.ect0 || ackFrame.ECT1 < s.ect1 || ackFrame.ECNCE < s.ecnce {
+		return qerr.Error(qerr.ProtocolViolation, "Received an ACK with decreasing ECN counts")
+	}
+	numAcked := uint64(ackFrame.LargestAcked()) + 1
+	for i := 1; i < len(ackFrame.AckRanges); i++ {
+		numAcked -= uint64(ackFrame.AckRanges[i-1].Smallest - ackFrame.AckRanges[i].Largest - 1)
+	}
+	sum := ackFrame.ECT0 + ackFrame.ECT1 + ackFrame.ECNCE
+	// check for overflows of the sum
+	if sum < ackFrame.ECT0 || sum < ackFrame.ECT1 || sum < ackFrame.ECNCE || sum > numAcked {
+		return qerr.Error(qerr.ProtocolViolation, "Received an ACK with ECN counts exceeding the number of acknowledged packets")
+	}
+	s.ect0 = ackFrame.ECT0
+	s.ect1 = ackFrame.ECT1
+	s.ecnce = ackFrame.ECNCE
+	return nil
+}
+
 type sentPacketHandler struct {
 	lastSentAckElicitingPacketTime time.Time // only applies to the application-data packet number space
 	lastSentCryptoPacketTime       time.Time
@@ -75,13 +163,41 @@ type sentPacketHandler struct {
 	// The alarm timeout
 	alarm time.Time
 
+	// state used for delivery rate estimation
+	delivered     protocol.ByteCount // the number of bytes acknowledged so far
+	deliveredTime time.Time          // the time when delivered was last updated
+	firstSentTime time.Time          // the send time of the packet that started the current ACK window
+	deliveryRate  uint64             // math.Float64bits of the smoothed delivery rate, to be used as an atomic
+
+	// state used for the packet loss rate estimation:
+	// the number of packets acknowledged and declared lost since the loss rate was last updated
+	lossRateAcked, lossRateLost uint64
+	lossRateUpdated             time.Time
+
+	stats SentPacketStats
+
+	// lostPacketCallback and congestionEventCallback are called when a packet is declared lost,
+	// and when the congestion window is reduced in response to a loss.
+	// probeTimeoutCallback is called when the crypto retransmission timer or the PTO fires.
+	// They may be nil.
+	lostPacketCallback      func(protocol.PacketNumber, protocol.EncryptionLevel, PacketLossTrigger)
+	congestionEventCallback func(protocol.ByteCount)
+	probeTimeoutCallback    func()
+
 	logger utils.Logger
 }
 
-// NewSentPacketHandler creates a new sentPacketHandler
+// NewSentPacketHandler creates a new sentPacketHandler.
+// onPacketLost is called for every packet that is declared lost,
+// onCongestionEvent when this leads to a reduction of the congestion window,
+// and onProbeTimeout when the crypto retransmission timer or the PTO fires.
+// All of them may be nil.
 func NewSentPacketHandler(
 	initialPacketNumber protocol.PacketNumber,
 	rttStats *congestion.RTTStats,
+	onPacketLost func(protocol.PacketNumber, protocol.EncryptionLevel, PacketLossTrigger),
+	onCongestionEvent func(protocol.ByteCount),
+	onProbeTimeout func(),
 	logger utils.Logger,
 ) SentPacketHandler {
 	congestion := congestion.NewCubicSender(
@@ -93,35 +209,65 @@ func NewSentPacketHandler(
 	)
 
 	return &sentPacketHandler{
-		initialPackets:   newPacketNumberSpace(initialPacketNumber),
-		handshakePackets: newPacketNumberSpace(0),
-		oneRTTPackets:    newPacketNumberSpace(0),
-		rttStats:         rttStats,
-		congestion:       congestion,
-		logger:           logger,
+		initialPackets:          newPacketNumberSpace(initialPacketNumber),
+		handshakePackets:        newPacketNumberSpace(0),
+		oneRTTPackets:           newPacketNumberSpace(0),
+		rttStats:                rttStats,
+		congestion:              congestion,
+		lostPacketCallback:      onPacketLost,
+		congestionEventCallback: onCongestionEvent,
+		probeTimeoutCallback:    onProbeTimeout,
+		logger:                  logger,
 	}
 }
 
 func (h *sentPacketHandler) SetHandshakeComplete() {
 	h.logger.Debugf("Handshake complete. Discarding all outstanding crypto packets.")
+	h.dropPackets(protocol.EncryptionInitial)
+	h.dropPackets(protocol.EncryptionHandshake)
+	h.handshakeComplete = true
+	h.updateLossDetectionAlarm()
+}
+
+// DropPackets drops all packets of the Initial or the Handshake packet number space.
+// The packets are neither retransmitted nor declared lost,
+// and they don't count towards the bytes in flight any more.
+func (h *sentPacketHandler) DropPackets(encLevel protocol.EncryptionLevel) {
+	if encLevel == protocol.Encryption1RTT {
+		panic("Cannot drop 1-RTT packets")
+	}
+	h.logger.Debugf("Dropping all outstanding %s packets.", encLevel)
+	h.dropPackets(encLevel)
+	h.updateLossDetectionAlarm()
+}
+
+func (h *sentPacketHandler) dropPackets(encLevel protocol.EncryptionLevel) {
+	// remove outstanding packets from bytes in flight
+	pnSpace := h.getPacketNumberSpace(encLevel)
+	var packets []*Packet
+	pnSpace.history.Iterate(func(p *Packet) (bool, error) {
+		packets = append(packets, p)
+		return true, nil
+	})
+	for _, p := range packets {
+		if p.includedInBytesInFlight {
+			h.bytesInFlight -= p.Length
+		}
+		pnSpace.history.Remove(p.PacketNumber)
+	}
+	// remove packets from the retransmission queue
 	var queue []*Packet
 	for _, packet := range h.retransmissionQueue {
-		if packet.EncryptionLevel == protocol.Encryption1RTT {
+		if packet.EncryptionLevel != encLevel {
 			queue = append(queue, packet)
 		}
 	}
-	for _, pnSpace := range []*packetNumberSpace{h.initialPackets, h.handshakePackets} {
-		var cryptoPackets []*Packet
-		pnSpace.history.Iterate(func(p *Packet) (bool, error) {
-			cryptoPackets = append(cryptoPackets, p)
-			return true, nil
-		})
-		for _, p := range cryptoPackets {
-			pnSpace.history.Remove(p.PacketNumber)
-		}
-	}
 	h.retransmissionQueue = queue
-	h.handshakeComplete = true
+	// The crypto timer backs off exponentially.
+	// Reset it if there are no crypto packets left that could be retransmitted.
+	if !h.hasOutstandingCryptoPackets() {
+		h.cryptoCount = 0
+	}
 }
 
 func (h *sentPacketHandler) SentPacket(packet *Packet) {
@@ -134,11 +280,15 @@ func (h *sentPacketHandler) SentPacket(packet *Packet) {
 func (h *sentPacketHandler) SentPacketsAsRetransmission(packets []*Packet, retransmissionOf protocol.PacketNumber) {
 	var p []*Packet
 	for _, packet := range packets {
+		h.stats.PacketsRetransmitted++
+		h.stats.BytesRetransmitted += packet.Length
 		if isAckEliciting := h.sentPacketImpl(packet); isAckEliciting {
 			p = append(p, packet)
 		}
 	}
-	h.getPacketNumberSpace(p[0].EncryptionLevel).history.SentPacketsAsRetransmission(p, retransmissionOf)
+	pnSpace := h.getPacketNumberSpace(packets[0].EncryptionLevel)
+	pnSpace.retransmittedLostPacket(retransmissionOf)
+	pnSpace.history.SentPacketsAsRetransmission(p, retransmissionOf)
 	h.updateLossDetectionAlarm()
 }
 
@@ -180,6 +330,14 @@ func (h *sentPacketHandler) sentPacketImpl(packet *Packet) bool /* is ack-elicit
 			h.lastSentCryptoPacketTime = packet.SendTime
 		}
 		h.lastSentAckElicitingPacketTime = packet.SendTime
+		if h.bytesInFlight == 0 {
+			// start a new ACK window
+			h.firstSentTime = packet.SendTime
+			h.deliveredTime = packet.SendTime
+		}
+		packet.delivered = h.delivered
+		packet.deliveredTime = h.deliveredTime
+		packet.firstSentTime = h.firstSentTime
 		packet.includedInBytesInFlight = true
 		h.bytesInFlight += packet.Length
 		packet.canBeRetransmitted = true
@@ -201,14 +359,30 @@ func (h *sentPacketHandler) ReceivedAck(ackFrame *wire.AckFrame, withPacketNumbe
 		return qerr.Error(qerr.ProtocolViolation, "Received ACK for an unsent packet")
 	}
 
+	// ACK frames are reordered if the packets carrying them are reordered.
+	// An ACK frame that doesn't increase the largest acknowledged packet number might be outdated.
+	// It is still processed, since it might acknowledge packets that weren't acknowledged before
+	// (packets that were already acknowledged aren't tracked any more).
+	// However, it is not used to validate the ECN counts, nor to take an RTT sample.
+	isNewLargestAcked := !pnSpace.receivedAck || largestAcked > pnSpace.largestAcked
+	pnSpace.receivedAck = true
 	pnSpace.largestAcked = utils.MaxPacketNumber(pnSpace.largestAcked, largestAcked)
 
 	if !pnSpace.pns.Validate(ackFrame) {
 		return qerr.Error(qerr.ProtocolViolation, "Received an ACK for a skipped packet number")
 	}
 
+	if isNewLargestAcked {
+		if err := pnSpace.validateECNCounts(ackFrame); err != nil {
+			return err
+		}
+	}
+	spuriousLosses, spuriousRetransmissions := pnSpace.detectSpuriousLosses(ackFrame)
+	h.stats.SpuriousLosses += spuriousLosses
+	h.stats.SpuriousRetransmissions += spuriousRetransmissions
+
 	// maybe update the RTT
-	if p := pnSpace.history.GetPacket(ackFrame.LargestAcked()); p != nil {
+	if p := pnSpace.history.GetPacket(ackFrame.LargestAcked()); p != nil && isNewLargestAcked {
 		h.rttStats.UpdateRTT(rcvTime.Sub(p.SendTime), ackFrame.DelayTime, rcvTime)
 		if h.logger.Debug() {
 			h.logger.Debugf("\tupdated RTT: %s (σ: %s)", h.rttStats.SmoothedRTT(), h.rttStats.MeanDeviation())
@@ -224,6 +398,7 @@ func (h *sentPacketHandler) ReceivedAck(ackFrame *wire.AckFrame, withPacketNumbe
 		return nil
 	}
 
+	h.lossRateAcked += uint64(len(ackedPackets))
 	priorInFlight := h.bytesInFlight
 	for _, p := range ackedPackets {
 		// largestAcked == 0 either means that the packet didn't contain an ACK, or it just acked packet 0
@@ -239,6 +414,7 @@ func (h *sentPacketHandler) ReceivedAck(ackFrame *wire.AckFrame, withPacketNumbe
 			h.congestion.OnPacketAcked(p.PacketNumber, p.Length, priorInFlight, rcvTime)
 		}
 	}
+	h.updateDeliveryRate(ackedPackets, rcvTime)
 
 	if err := h.detectLostPackets(rcvTime, encLevel, priorInFlight); err != nil {
 		return err
@@ -252,6 +428,61 @@ func (h *sentPacketHandler) ReceivedAck(ackFrame *wire.AckFrame, withPacketNumbe
 	return nil
 }
 
+// updateDeliveryRate takes a delivery rate sample when an ACK is received,
+// following draft-cheng-iccrg-delivery-rate-estimation.
+// The sample is the number of bytes delivered since the most recently sent newly acknowledged packet was sent,
+// divided by the length of the ACK window.
+func (h *sentPacketHandler) updateDeliveryRate(ackedPackets []*Packet, rcvTime time.Time) {
+	var last *Packet
+	for _, p := range ackedPackets {
+		h.delivered += p.Length
+		if last == nil || p.SendTime.After(last.SendTime) {
+			last = p
+		}
+	}
+	h.deliveredTime = rcvTime
+	h.firstSentTime = last.SendTime
+
+	sendElapsed := last.SendTime.Sub(last.firstSentTime)
+	ackElapsed := rcvTime.Sub(last.deliveredTime)
+	interval := utils.MaxDuration(sendElapsed, ackElapsed)
+	// Samples taken over less than an RTT would overestimate the rate, e.g. due to ACK compression.
+	if interval <= 0 || interval < h.rttStats.MinRTT() {
+		return
+	}
+	sample := float64(h.delivered-last.delivered) / interval.Seconds()
+	rate := sample
+	if oldRate := h.DeliveryRate(); oldRate > 0 {
+		rate = oldRate + deliveryRateAlpha*(sample-oldRate)
+	}
+	atomic.StoreUint64(&h.deliveryRate, math.Float64bits(rate))
+}
+
+// updateLossRate takes a loss rate sample from the packets acknowledged and declared lost since the last update.
+// The packet loss rate is an exponentially weighted moving average of these samples,
+// with a time constant of lossRateWindow RTTs.
+func (h *sentPacketHandler) updateLossRate(now time.Time) {
+	n := h.lossRateAcked + h.lossRateLost
+	if n == 0 {
+		return
+	}
+	sample := float64(h.lossRateLost) / float64(n)
+	h.lossRateAcked = 0
+	h.lossRateLost = 0
+	if h.lossRateUpdated.IsZero() {
+		h.stats.PacketLossRate = sample
+	} else {
+		window := lossRateWindow * h.rttStats.SmoothedOrInitialRTT()
+		alpha := math.Max(0, math.Min(1, float64(now.Sub(h.lossRateUpdated))/float64(window)))
+		h.stats.PacketLossRate += alpha * (sample - h.stats.PacketLossRate)
+	}
+	h.lossRateUpdated = now
+}
+
+func (h *sentPacketHandler) DeliveryRate() float64 {
+	return math.Float64frombits(atomic.LoadUint64(&h.deliveryRate))
+}
+
 func (h *sentPacketHandler) GetLowestPacketNotConfirmedAcked() protocol.PacketNumber {
 	return h.lowestNotConfirmedAcked
 }
@@ -373,20 +604,42 @@ func (h *sentPacketHandler) detectLostPackets(
 	}
 
 	for _, p := range lostPackets {
-		// the bytes in flight need to be reduced no matter if this packet will be retransmitted
-		if p.includedInBytesInFlight {
-			h.bytesInFlight -= p.Length
-			h.congestion.OnPacketLost(p.PacketNumber, p.Length, priorInFlight)
+		if err := h.onPacketLost(p, pnSpace, priorInFlight, PacketLossTimeThreshold); err != nil {
+			return err
 		}
-		if p.canBeRetransmitted {
-			// queue the packet for retransmission, and report the loss to the congestion controller
-			if err := h.queuePacketForRetransmission(p, pnSpace); err != nil {
-				return err
+	}
+	h.updateLossRate(now)
+	return nil
+}
+
+func (h *sentPacketHandler) onPacketLost(p *Packet, pnSpace *packetNumberSpace, priorInFlight protocol.ByteCount, trigger PacketLossTrigger) error {
+	h.stats.PacketsLost++
+	h.stats.BytesLost += p.Length
+	h.lossRateLost++
+	pnSpace.lostPacket(p.PacketNumber)
+	// the bytes in flight need to be reduced no matter if this packet will be retransmitted
+	if h.lostPacketCallback != nil {
+		h.lostPacketCallback(p.PacketNumber, p.EncryptionLevel, trigger)
+	}
+	if p.includedInBytesInFlight {
+		h.bytesInFlight -= p.Length
+		if h.congestionEventCallback == nil {
+			h.congestion.OnPacketLost(p.PacketNumber, p.Length, priorInFlight)
+		} else {
+			cwnd := h.congestion.GetCongestionWindow()
+			h.congestion.OnPacketLost(p.PacketNumber, p.Length, priorInFlight)
+			if newCWND := h.congestion.GetCongestionWindow(); newCWND < cwnd {
+				h.congestionEventCallback(newCWND)
 			}
 		}
-		pnSpace.history.Remove(p.PacketNumber)
 	}
-	return nil
+	if p.canBeRetransmitted {
+		// queue the packet for retransmission, and report the loss to the congestion controller
+		if err := h.queuePacketForRetransmission(p, pnSpace); err != nil {
+			return err
+		}
+	}
+	return pnSpace.history.Remove(p.PacketNumber)
 }
 
 func (h *sentPacketHandler) OnAlarm() error {
@@ -410,6 +663,10 @@ func (h *sentPacketHandler) onVerifiedAlarm() error {
 			h.logger.Debugf("Loss detection alarm fired in crypto mode. Crypto count: %d", h.cryptoCount)
 		}
 		h.cryptoCount++
+		h.stats.ProbeTimeouts++
+		if h.probeTimeoutCallback != nil {
+			h.probeTimeoutCallback()
+		}
 		err = h.queueCryptoPacketsForRetransmission()
 	} else if !h.lossTime.IsZero() {
 		if h.logger.Debug() {
@@ -422,7 +679,11 @@ func (h *sentPacketHandler) onVerifiedAlarm() error {
 			h.logger.Debugf("Loss detection alarm fired in PTO mode. PTO count: %d", h.ptoCount)
 		}
 		h.ptoCount++
+		h.stats.ProbeTimeouts++
 		h.numProbesToSend += 2
+		if h.probeTimeoutCallback != nil {
+			h.probeTimeoutCallback()
+		}
 	}
 	return err
 }
@@ -431,6 +692,26 @@ func (h *sentPacketHandler) GetAlarmTimeout() time.Time {
 	return h.alarm
 }
 
+func (h *sentPacketHandler) GetCongestionWindow() protocol.ByteCount {
+	return h.congestion.GetCongestionWindow()
+}
+
+func (h *sentPacketHandler) GetBytesInFlight() protocol.ByteCount {
+	return h.bytesInFlight
+}
+
+func (h *sentPacketHandler) GetSlowStartThreshold() protocol.ByteCount {
+	return h.congestion.GetSlowStartThreshold()
+}
+
+func (h *sentPacketHandler) GetCongestionState() congestion.State {
+	return h.congestion.State()
+}
+
+func (h *sentPacketHandler) GetStats() SentPacketStats {
+	return h.stats
+}
+
 func (h *sentPacketHandler) onPacketAcked(p *Packet, rcvTime time.Time) error {
 	pnSpace := h.getPacketNumberSpace(p.EncryptionLevel)
 	// This happens if a packet and its retransmissions is acked in the same ACK.
@@ -501,7 +782,7 @@ func (h *sentPacketHandler) DequeueProbePacket() (*Packet, error) {
 	if len(h.retransmissionQueue) == 0 {
 		p := pnSpace.history.FirstOutstanding()
 		if p == nil {
-			return nil, errors.New("cannot dequeue a probe packet. No outstanding packets")
+			return nil, nil
 		}
 		if err := h.queuePacketForRetransmission(p, pnSpace); err != nil {
 			return nil, err
@@ -1,6 +1,9 @@
 package ackhandler
 
 import (
+	"math"
+	"sort"
+	"sync/atomic"
 	"time"
 
 	"github.com/golang/mock/gomock"
@@ -49,7 +52,7 @@ var _ = Describe("SentPacketHandler", func() {
 
 	BeforeEach(func() {
 		rttStats := &congestion.RTTStats{}
-		handler = NewSentPacketHandler(42, rttStats, utils.DefaultLogger).(*sentPacketHandler)
+		handler = NewSentPacketHandler(42, rttStats, nil, nil, nil, utils.DefaultLogger).(*sentPacketHandler)
 		handler.SetHandshakeComplete()
 		streamFrame = wire.StreamFrame{
 			StreamID: 5,
@@ -77,6 +80,13 @@ var _ = Describe("SentPacketHandler", func() {
 		ExpectWithOffset(1, r.PacketNumber).To(Equal(pn))
 	}
 
+	// declareLost declares a 1-RTT packet lost, like loss detection would
+	declareLost := func(pn protocol.PacketNumber) {
+		p := getPacket(pn, protocol.Encryption1RTT)
+		ExpectWithOffset(1, p).ToNot(BeNil())
+		ExpectWithOffset(1, handler.onPacketLost(p, handler.oneRTTPackets, handler.bytesInFlight, PacketLossTimeThreshold)).To(Succeed())
+	}
+
 	expectInPacketHistory := func(expected []protocol.PacketNumber, encLevel protocol.EncryptionLevel) {
 		pnSpace := handler.getPacketNumberSpace(encLevel)
 		ExpectWithOffset(1, pnSpace.history.Len()).To(Equal(len(expected)))
@@ -173,6 +183,123 @@ var _ = Describe("SentPacketHandler", func() {
 				Expect(handler.oneRTTPackets.largestAcked).To(Equal(protocol.PacketNumber(3)))
 				Expect(handler.bytesInFlight).To(Equal(protocol.ByteCount(7)))
 			})
+
+			It("processes reordered ACK frames", func() {
+				// the ACK frames the peer sent, in the order it sent them
+				acks := []*wire.AckFrame{
+					{AckRanges: []wire.AckRange{{Smallest: 0, Largest: 3}}, ECT0: 4},
+					{AckRanges: []wire.AckRange{{Smallest: 0, Largest: 5}}, ECT0: 6},
+					{AckRanges: []wire.AckRange{{Smallest: 0, Largest: 7}}, ECT0: 8},
+					{AckRanges: []wire.AckRange{{Smallest: 0, Largest: 8}}, ECT0: 9},
+				}
+				bytesInFlight := handler.bytesInFlight
+				for i := len(acks) - 1; i >= 0; i-- {
+					Expect(handler.ReceivedAck(acks[i], protocol.PacketNumber(100+i), protocol.Encryption1RTT, time.Now())).To(Succeed())
+					Expect(handler.bytesInFlight).To(BeNumerically("<=", bytesInFlight))
+					bytesInFlight = handler.bytesInFlight
+					Expect(handler.oneRTTPackets.largestAcked).To(Equal(protocol.PacketNumber(8)))
+					expectInPacketHistory([]protocol.PacketNumber{9}, protocol.Encryption1RTT)
+					Expect(handler.retransmissionQueue).To(BeEmpty())
+				}
+				Expect(handler.bytesInFlight).To(Equal(protocol.ByteCount(1)))
+				Expect(handler.oneRTTPackets.ect0).To(BeEquivalentTo(9))
+			})
+
+			It("processes newly acknowledged packets in a reordered ACK frame", func() {
+				ack1 := &wire.AckFrame{AckRanges: []wire.AckRange{{Smallest: 0, Largest: 3}}}
+				ack2 := &wire.AckFrame{AckRanges: []wire.AckRange{{Smallest: 6, Largest: 7}}}
+				Expect(handler.ReceivedAck(ack2, 101, protocol.Encryption1RTT, time.Now())).To(Succeed())
+				Expect(handler.ReceivedAck(ack1, 100, protocol.Encryption1RTT, time.Now())).To(Succeed())
+				Expect(handler.oneRTTPackets.largestAcked).To(Equal(protocol.PacketNumber(7)))
+				expectInPacketHistory([]protocol.PacketNumber{4, 5, 8, 9}, protocol.Encryption1RTT)
+				Expect(handler.bytesInFlight).To(Equal(protocol.ByteCount(4)))
+			})
+
+			It("doesn't take an RTT sample from a reordered ACK frame", func() {
+				now := time.Now()
+				getPacket(7, protocol.Encryption1RTT).SendTime = now.Add(-10 * time.Second)
+				getPacket(3, protocol.Encryption1RTT).SendTime = now.Add(-20 * time.Second)
+				ack1 := &wire.AckFrame{AckRanges: []wire.AckRange{{Smallest: 0, Largest: 3}}}
+				ack2 := &wire.AckFrame{AckRanges: []wire.AckRange{{Smallest: 6, Largest: 7}}}
+				Expect(handler.ReceivedAck(ack2, 101, protocol.Encryption1RTT, now)).To(Succeed())
+				Expect(handler.rttStats.LatestRTT()).To(Equal(10 * time.Second))
+				Expect(handler.ReceivedAck(ack1, 100, protocol.Encryption1RTT, now)).To(Succeed())
+				Expect(handler.rttStats.LatestRTT()).To(Equal(10 * time.Second))
+			})
+
+			Context("validating ECN counts", func() {
+				It("accepts ECN counts", func() {
+					ack := &wire.AckFrame{
+						AckRanges: []wire.AckRange{{Smallest: 6, Largest: 9}, {Smallest: 0, Largest: 3}},
+						ECT0:      3,
+						ECT1:      4,
+						ECNCE:     1,
+					}
+					Expect(handler.ReceivedAck(ack, 1, protocol.Encryption1RTT, time.Now())).To(Succeed())
+				})
+
+				It("rejects ECN counts exceeding the number of acknowledged packets", func() {
+					ack := &wire.AckFrame{
+						AckRanges: []wire.AckRange{{Smallest: 6, Largest: 9}, {Smallest: 0, Largest: 3}},
+						ECT0:      5,
+						ECNCE:     4,
+					}
+					err := handler.ReceivedAck(ack, 1, protocol.Encryption1RTT, time.Now())
+					Expect(err).To(MatchError("PROTOCOL_VIOLATION: Received an ACK with ECN counts exceeding the number of acknowledged packets"))
+					Expect(handler.bytesInFlight).To(Equal(protocol.ByteCount(10)))
+				})
+
+				It("rejects a huge CE count", func() {
+					ack := &wire.AckFrame{
+						AckRanges: []wire.AckRange{{Smallest: 0, Largest: 9}},
+						ECNCE:     99999,
+					}
+					err := handler.ReceivedAck(ack, 1, protocol.Encryption1RTT, time.Now())
+					Expect(err).To(MatchError("PROTOCOL_VIOLATION: Received an ACK with ECN counts exceeding the number of acknowledged packets"))
+				})
+
+				It("rejects ECN counts that overflow", func() {
+					ack := &wire.AckFrame{
+						AckRanges: []wire.AckRange{{Smallest: 0, Largest: 9}},
+						ECT0:      1 << 63,
+						ECT1:      1 << 63,
+						ECNCE:     1,
+					}
+					err := handler.ReceivedAck(ack, 1, protocol.Encryption1RTT, time.Now())
+					Expect(err).To(MatchError("PROTOCOL_VIOLATION: Received an ACK with ECN counts exceeding the number of acknowledged packets"))
+				})
+
+				It("doesn't validate the ECN counts of ACK frames that don't increase the largest acknowledged packet", func() {
+					ack := &wire.AckFrame{
+						AckRanges: []wire.AckRange{{Smallest: 0, Largest: 5}},
+						ECT0:      5,
+					}
+					Expect(handler.ReceivedAck(ack, 2, protocol.Encryption1RTT, time.Now())).To(Succeed())
+					// a reordered ACK, with lower ECN counts
+					ack = &wire.AckFrame{
+						AckRanges: []wire.AckRange{{Smallest: 0, Largest: 3}},
+						ECT0:      3,
+					}
+					Expect(handler.ReceivedAck(ack, 1, protocol.Encryption1RTT, time.Now())).To(Succeed())
+					Expect(handler.oneRTTPackets.ect0).To(BeEquivalentTo(5))
+				})
+
+				It("rejects decreasing ECN counts", func() {
+					ack := &wire.AckFrame{
+						AckRanges: []wire.AckRange{{Smallest: 0, Largest: 3}},
+						ECT0:      2,
+						ECNCE:     2,
+					}
+					Expect(handler.ReceivedAck(ack, 1, protocol.Encryption1RTT, time.Now())).To(Succeed())
+					ack = &wire.AckFrame{
+						AckRanges: []wire.AckRange{{Smallest: 0, Largest: 5}},
+						ECT0:      4,
+						ECNCE:     1,
+					}
+					err := handler.ReceivedAck(ack, 2, protocol.Encryption1RTT, time.Now())
+					Expect(err).To(MatchError("PROTOCOL_VIOLATION: Received an ACK with decreasing ECN counts"))
+				})
+			})
 		})
 
 		Context("acks and nacks the right packets", func() {
@@ -459,6 +586,30 @@ var _ = Describe("SentPacketHandler", func() {
 			Expect(err).ToNot(HaveOccurred())
 		})
 
+		It("reports congestion events", func() {
+			var cwnds []protocol.ByteCount
+			handler.congestionEventCallback = func(cwnd protocol.ByteCount) { cwnds = append(cwnds, cwnd) }
+			cong.EXPECT().OnPacketSent(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(3)
+			cong.EXPECT().TimeUntilSend(gomock.Any()).Times(3)
+			handler.SentPacket(ackElicitingPacket(&Packet{PacketNumber: 1, SendTime: time.Now().Add(-time.Hour)}))
+			handler.SentPacket(ackElicitingPacket(&Packet{PacketNumber: 2, SendTime: time.Now().Add(-time.Hour)}))
+			handler.SentPacket(ackElicitingPacket(&Packet{PacketNumber: 3}))
+			// Only the first loss reduces the congestion window.
+			gomock.InOrder(
+				cong.EXPECT().MaybeExitSlowStart(),
+				cong.EXPECT().OnPacketAcked(protocol.PacketNumber(3), gomock.Any(), gomock.Any(), gomock.Any()),
+				cong.EXPECT().GetCongestionWindow().Return(protocol.ByteCount(10000)),
+				cong.EXPECT().OnPacketLost(protocol.PacketNumber(1), gomock.Any(), gomock.Any()),
+				cong.EXPECT().GetCongestionWindow().Return(protocol.ByteCount(5000)),
+				cong.EXPECT().GetCongestionWindow().Return(protocol.ByteCount(5000)),
+				cong.EXPECT().OnPacketLost(protocol.PacketNumber(2), gomock.Any(), gomock.Any()),
+				cong.EXPECT().GetCongestionWindow().Return(protocol.ByteCount(5000)),
+			)
+			ack := &wire.AckFrame{AckRanges: []wire.AckRange{{Smallest: 3, Largest: 3}}}
+			Expect(handler.ReceivedAck(ack, 1, protocol.Encryption1RTT, time.Now())).To(Succeed())
+			Expect(cwnds).To(Equal([]protocol.ByteCount{5000}))
+		})
+
 		It("calls OnPacketAcked and OnPacketLost with the right bytes_in_flight value", func() {
 			cong.EXPECT().OnPacketSent(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(4)
 			cong.EXPECT().TimeUntilSend(gomock.Any()).Times(4)
@@ -506,6 +657,13 @@ var _ = Describe("SentPacketHandler", func() {
 			Expect(handler.SendMode()).To(Equal(SendAck))
 		})
 
+		It("returns the state of the congestion controller", func() {
+			cong.EXPECT().GetSlowStartThreshold().Return(protocol.ByteCount(1337))
+			cong.EXPECT().State().Return(congestion.StateRecovery)
+			Expect(handler.GetSlowStartThreshold()).To(Equal(protocol.ByteCount(1337)))
+			Expect(handler.GetCongestionState()).To(Equal(congestion.StateRecovery))
+		})
+
 		It("doesn't allow retransmission if congestion limited", func() {
 			handler.bytesInFlight = 100
 			handler.retransmissionQueue = []*Packet{{PacketNumber: 3}}
@@ -634,6 +792,8 @@ var _ = Describe("SentPacketHandler", func() {
 		})
 
 		It("gets two probe packets if RTO expires", func() {
+			var probeTimeouts int
+			handler.probeTimeoutCallback = func() { probeTimeouts++ }
 			handler.SentPacket(ackElicitingPacket(&Packet{PacketNumber: 1}))
 			handler.SentPacket(ackElicitingPacket(&Packet{PacketNumber: 2}))
 
@@ -654,6 +814,7 @@ var _ = Describe("SentPacketHandler", func() {
 			Expect(handler.bytesInFlight).To(Equal(protocol.ByteCount(2)))
 
 			Expect(handler.ptoCount).To(BeEquivalentTo(3))
+			Expect(probeTimeouts).To(Equal(3))
 		})
 
 		It("doesn't delete packets transmitted as PTO from the history", func() {
@@ -680,6 +841,12 @@ var _ = Describe("SentPacketHandler", func() {
 			Expect(handler.retransmissionQueue).To(BeEmpty()) // 1 and 2 were already sent as probe packets
 		})
 
+		It("doesn't return a probe packet if there are no packets that could be retransmitted", func() {
+			p, err := handler.DequeueProbePacket()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(p).To(BeNil())
+		})
+
 		It("resets the send mode when it receives an acknowledgement after queueing probe packets", func() {
 			handler.SentPacket(ackElicitingPacket(&Packet{PacketNumber: 1, SendTime: time.Now().Add(-time.Hour)}))
 			handler.rttStats.UpdateRTT(time.Second, 0, time.Now())
@@ -778,12 +945,106 @@ var _ = Describe("SentPacketHandler", func() {
 		})
 	})
 
+	Context("statistics", func() {
+		It("counts lost and retransmitted packets", func() {
+			handler.SentPacket(ackElicitingPacket(&Packet{PacketNumber: 1, Length: 10, EncryptionLevel: protocol.Encryption1RTT}))
+			handler.SentPacket(ackElicitingPacket(&Packet{PacketNumber: 2, Length: 20, EncryptionLevel: protocol.Encryption1RTT}))
+			declareLost(1)
+			declareLost(2)
+			handler.SentPacketsAsRetransmission([]*Packet{ackElicitingPacket(&Packet{PacketNumber: 3, Length: 15})}, 1)
+			Expect(handler.GetStats()).To(Equal(SentPacketStats{
+				PacketsLost:          2,
+				BytesLost:            30,
+				PacketsRetransmitted: 1,
+				BytesRetransmitted:   15,
+			}))
+		})
+
+		It("counts probe timeouts", func() {
+			handler.SentPacket(ackElicitingPacket(&Packet{PacketNumber: 1, SendTime: time.Now().Add(-time.Hour)}))
+			Expect(handler.OnAlarm()).To(Succeed())
+			Expect(handler.OnAlarm()).To(Succeed())
+			Expect(handler.GetStats().ProbeTimeouts).To(BeEquivalentTo(2))
+			// the counter is not reset when an ACK is received
+			ack := &wire.AckFrame{AckRanges: []wire.AckRange{{Smallest: 1, Largest: 1}}}
+			Expect(handler.ReceivedAck(ack, 1, protocol.Encryption1RTT, time.Now())).To(Succeed())
+			Expect(handler.GetStats().ProbeTimeouts).To(BeEquivalentTo(2))
+		})
+
+		It("detects spurious losses", func() {
+			for i := protocol.PacketNumber(1); i <= 4; i++ {
+				handler.SentPacket(ackElicitingPacket(&Packet{PacketNumber: i, EncryptionLevel: protocol.Encryption1RTT}))
+			}
+			declareLost(1)
+			declareLost(2)
+			ack := &wire.AckFrame{AckRanges: []wire.AckRange{{Smallest: 2, Largest: 3}}}
+			Expect(handler.ReceivedAck(ack, 1, protocol.Encryption1RTT, time.Now())).To(Succeed())
+			Expect(handler.GetStats().SpuriousLosses).To(BeEquivalentTo(1))
+			// packet 2 is only counted once
+			ack = &wire.AckFrame{AckRanges: []wire.AckRange{{Smallest: 2, Largest: 4}}}
+			Expect(handler.ReceivedAck(ack, 2, protocol.Encryption1RTT, time.Now())).To(Succeed())
+			Expect(handler.GetStats().SpuriousLosses).To(BeEquivalentTo(1))
+			ack = &wire.AckFrame{AckRanges: []wire.AckRange{{Smallest: 1, Largest: 4}}}
+			Expect(handler.ReceivedAck(ack, 3, protocol.Encryption1RTT, time.Now())).To(Succeed())
+			Expect(handler.GetStats().SpuriousLosses).To(BeEquivalentTo(2))
+		})
+
+		It("detects spurious retransmissions", func() {
+			for i := protocol.PacketNumber(1); i <= 4; i++ {
+				handler.SentPacket(ackElicitingPacket(&Packet{PacketNumber: i, EncryptionLevel: protocol.Encryption1RTT}))
+			}
+			declareLost(1)
+			declareLost(2)
+			// only packet 1 is retransmitted
+			handler.SentPacketsAsRetransmission([]*Packet{ackElicitingPacket(&Packet{PacketNumber: 5, EncryptionLevel: protocol.Encryption1RTT})}, 1)
+			ack := &wire.AckFrame{AckRanges: []wire.AckRange{{Smallest: 1, Largest: 3}}}
+			Expect(handler.ReceivedAck(ack, 1, protocol.Encryption1RTT, time.Now())).To(Succeed())
+			Expect(handler.GetStats().SpuriousLosses).To(BeEquivalentTo(2))
+			Expect(handler.GetStats().SpuriousRetransmissions).To(BeEquivalentTo(1))
+		})
+
+		It("estimates the packet loss rate", func() {
+			now := time.Now()
+			for i := protocol.PacketNumber(1); i <= 10; i++ {
+				sendTime := now.Add(-100 * time.Millisecond)
+				if i <= 4 {
+					sendTime = now.Add(-time.Second)
+				}
+				handler.SentPacket(ackElicitingPacket(&Packet{PacketNumber: i, SendTime: sendTime, EncryptionLevel: protocol.Encryption1RTT}))
+			}
+			// packets 1 to 4 are declared lost
+			ack := &wire.AckFrame{AckRanges: []wire.AckRange{{Smallest: 5, Largest: 10}}}
+			Expect(handler.ReceivedAck(ack, 1, protocol.Encryption1RTT, now)).To(Succeed())
+			Expect(handler.GetStats().PacketsLost).To(BeEquivalentTo(4))
+			Expect(handler.GetStats().PacketLossRate).To(BeNumerically("~", 0.4, 1e-9))
+			// no packets are lost within the next 5 RTTs
+			Expect(handler.rttStats.SmoothedRTT()).To(Equal(100 * time.Millisecond))
+			now = now.Add(500 * time.Millisecond)
+			for i := protocol.PacketNumber(11); i <= 20; i++ {
+				handler.SentPacket(ackElicitingPacket(&Packet{PacketNumber: i, SendTime: now.Add(-100 * time.Millisecond), EncryptionLevel: protocol.Encryption1RTT}))
+			}
+			ack = &wire.AckFrame{AckRanges: []wire.AckRange{{Smallest: 5, Largest: 20}}}
+			Expect(handler.ReceivedAck(ack, 2, protocol.Encryption1RTT, now)).To(Succeed())
+			Expect(handler.GetStats().PacketLossRate).To(BeNumerically("~", 0.2, 1e-9))
+		})
+
+		It("limits the number of lost packets tracked", func() {
+			for i := 0; i < protocol.MaxTrackedLostPackets+5; i++ {
+				handler.oneRTTPackets.lostPacket(protocol.PacketNumber(i))
+			}
+			Expect(handler.oneRTTPackets.lostPackets).To(HaveLen(protocol.MaxTrackedLostPackets))
+			Expect(handler.oneRTTPackets.lostPackets[0].pn).To(Equal(protocol.PacketNumber(5)))
+		})
+	})
+
 	Context("crypto packets", func() {
 		BeforeEach(func() {
 			handler.handshakeComplete = false
 		})
 
 		It("detects the crypto timeout", func() {
+			var probeTimeouts int
+			handler.probeTimeoutCallback = func() { probeTimeouts++ }
 			now := time.Now()
 			sendTime := now.Add(-time.Minute)
 			lastCryptoPacketSendTime := now.Add(-30 * time.Second)
@@ -805,6 +1066,7 @@ var _ = Describe("SentPacketHandler", func() {
 			Expect(p).ToNot(BeNil())
 			Expect(p.PacketNumber).To(Equal(protocol.PacketNumber(3)))
 			Expect(handler.cryptoCount).To(BeEquivalentTo(1))
+			Expect(probeTimeouts).To(Equal(1))
 			handler.SentPacket(cryptoPacket(&Packet{PacketNumber: 4, SendTime: lastCryptoPacketSendTime}))
 			// make sure the exponential backoff is used
 			Expect(handler.GetAlarmTimeout().Sub(lastCryptoPacketSendTime)).To(Equal(4 * time.Minute))
@@ -822,6 +1084,22 @@ var _ = Describe("SentPacketHandler", func() {
 			Expect(err).To(MatchError("PROTOCOL_VIOLATION: Received ACK for an unsent packet"))
 		})
 
+		It("retransmits 1-RTT packets sent before the handshake completes", func() {
+			now := time.Now()
+			handler.SentPacket(cryptoPacket(&Packet{PacketNumber: 1, SendTime: now.Add(-time.Hour), EncryptionLevel: protocol.EncryptionHandshake}))
+			handler.SentPacket(ackElicitingPacket(&Packet{PacketNumber: 1, SendTime: now.Add(-time.Hour), EncryptionLevel: protocol.Encryption1RTT}))
+			handler.SentPacket(ackElicitingPacket(&Packet{PacketNumber: 2, SendTime: now.Add(-time.Second), EncryptionLevel: protocol.Encryption1RTT}))
+			ack := &wire.AckFrame{AckRanges: []wire.AckRange{{Smallest: 2, Largest: 2}}}
+			Expect(handler.ReceivedAck(ack, 1, protocol.Encryption1RTT, now)).To(Succeed())
+			// the handshake completes before the packet is retransmitted
+			handler.SetHandshakeComplete()
+			p := handler.DequeuePacketForRetransmission()
+			Expect(p).ToNot(BeNil())
+			Expect(p.PacketNumber).To(Equal(protocol.PacketNumber(1)))
+			Expect(p.EncryptionLevel).To(Equal(protocol.Encryption1RTT))
+			Expect(handler.DequeuePacketForRetransmission()).To(BeNil())
+		})
+
 		It("deletes crypto packets when the handshake completes", func() {
 			for i := protocol.PacketNumber(0); i < 6; i++ {
 				p := ackElicitingPacket(&Packet{PacketNumber: i, EncryptionLevel: protocol.EncryptionInitial})
@@ -839,6 +1117,122 @@ var _ = Describe("SentPacketHandler", func() {
 			packet := handler.DequeuePacketForRetransmission()
 			Expect(packet).To(BeNil())
 		})
+
+		It("drops Initial packets", func() {
+			for i := protocol.PacketNumber(0); i < 6; i++ {
+				handler.SentPacket(cryptoPacket(&Packet{PacketNumber: i, Length: 10}))
+			}
+			handler.SentPacket(ackElicitingPacket(&Packet{PacketNumber: 0, Length: 10, EncryptionLevel: protocol.EncryptionHandshake}))
+			Expect(handler.bytesInFlight).To(Equal(protocol.ByteCount(70)))
+			handler.queuePacketForRetransmission(getPacket(1, protocol.EncryptionInitial), handler.getPacketNumberSpace(protocol.EncryptionInitial))
+			handler.DropPackets(protocol.EncryptionInitial)
+			Expect(handler.initialPackets.history.Len()).To(BeZero())
+			Expect(handler.handshakePackets.history.Len()).To(Equal(1))
+			Expect(handler.bytesInFlight).To(Equal(protocol.ByteCount(10)))
+			Expect(handler.DequeuePacketForRetransmission()).To(BeNil())
+			Expect(handler.GetAlarmTimeout()).ToNot(BeZero())
+		})
+
+		It("cancels the crypto alarm when dropping the last crypto packets", func() {
+			handler.SentPacket(ackElicitingPacket(&Packet{PacketNumber: 1, Length: 10, EncryptionLevel: protocol.EncryptionHandshake}))
+			Expect(handler.GetAlarmTimeout()).ToNot(BeZero())
+			Expect(handler.OnAlarm()).To(Succeed())
+			Expect(handler.cryptoCount).To(BeEquivalentTo(1))
+			handler.DropPackets(protocol.EncryptionHandshake)
+			Expect(handler.GetAlarmTimeout()).To(BeZero())
+			Expect(handler.cryptoCount).To(BeZero())
+			Expect(handler.bytesInFlight).To(BeZero())
+			Expect(handler.DequeuePacketForRetransmission()).To(BeNil())
+		})
+
+		It("refuses to drop 1-RTT packets", func() {
+			Expect(func() { handler.DropPackets(protocol.Encryption1RTT) }).To(Panic())
+		})
+	})
+
+	Context("delivery rate estimation", func() {
+		const packetSize = 1000
+
+		type event struct {
+			time time.Time
+			send protocol.PacketNumber // 0 for ACKs
+			ack  *wire.AckFrame
+		}
+
+		// simulate sends num packets, one every sendInterval.
+		// The packets are delivered after rtt/2, at most one every bottleneckInterval.
+		// The peer acknowledges every ackEvery packets, and the ACK arrives after rtt/2.
+		simulate := func(num int, sendInterval, bottleneckInterval, rtt time.Duration, ackEvery int) {
+			start := time.Now()
+			var events []event
+			var lastArrival time.Time
+			for i := 1; i <= num; i++ {
+				pn := protocol.PacketNumber(i)
+				sendTime := start.Add(time.Duration(i) * sendInterval)
+				events = append(events, event{time: sendTime, send: pn})
+				arrival := sendTime.Add(rtt / 2)
+				if next := lastArrival.Add(bottleneckInterval); next.After(arrival) {
+					arrival = next
+				}
+				lastArrival = arrival
+				if i%ackEvery == 0 {
+					events = append(events, event{
+						time: arrival.Add(rtt / 2),
+						ack:  &wire.AckFrame{AckRanges: []wire.AckRange{{Smallest: pn - protocol.PacketNumber(ackEvery) + 1, Largest: pn}}},
+					})
+				}
+			}
+			sort.SliceStable(events, func(i, j int) bool { return events[i].time.Before(events[j].time) })
+			for _, e := range events {
+				if e.ack != nil {
+					Expect(handler.ReceivedAck(e.ack, 1, protocol.Encryption1RTT, e.time)).To(Succeed())
+				} else {
+					handler.SentPacket(ackElicitingPacket(&Packet{PacketNumber: e.send, Length: packetSize, SendTime: e.time}))
+				}
+			}
+		}
+
+		It("doesn't have an estimate before receiving an ACK", func() {
+			handler.SentPacket(ackElicitingPacket(&Packet{PacketNumber: 1, Length: packetSize}))
+			Expect(handler.DeliveryRate()).To(BeZero())
+		})
+
+		It("estimates the send rate", func() {
+			// 1000 bytes every millisecond
+			simulate(1000, time.Millisecond, 0, 50*time.Millisecond, 2)
+			Expect(handler.DeliveryRate()).To(BeNumerically("~", 1e6, 0.05e6))
+		})
+
+		It("estimates the send rate, for a different RTT and ACK frequency", func() {
+			// 1000 bytes every 4 milliseconds
+			simulate(500, 4*time.Millisecond, 0, 200*time.Millisecond, 5)
+			Expect(handler.DeliveryRate()).To(BeNumerically("~", 250e3, 12.5e3))
+		})
+
+		It("estimates the bottleneck rate, if the sender is sending too fast", func() {
+			// The sender sends 1000 bytes every 100 microseconds, but the bottleneck only delivers 1000 bytes every millisecond.
+			simulate(2000, 100*time.Microsecond, time.Millisecond, 30*time.Millisecond, 2)
+			Expect(handler.DeliveryRate()).To(BeNumerically("~", 1e6, 0.05e6))
+		})
+
+		It("smoothes the samples", func() {
+			now := time.Now()
+			sendAndAck := func(pn protocol.PacketNumber) {
+				// 2000 bytes are acknowledged after 100ms
+				sendTime := now.Add(time.Duration(pn) * time.Second)
+				handler.SentPacket(ackElicitingPacket(&Packet{PacketNumber: pn, Length: packetSize, SendTime: sendTime}))
+				handler.SentPacket(ackElicitingPacket(&Packet{PacketNumber: pn + 1, Length: packetSize, SendTime: sendTime}))
+				ack := &wire.AckFrame{AckRanges: []wire.AckRange{{Smallest: pn, Largest: pn + 1}}}
+				Expect(handler.ReceivedAck(ack, 1, protocol.Encryption1RTT, sendTime.Add(100*time.Millisecond))).To(Succeed())
+			}
+			// the first sample is used as is
+			sendAndAck(1)
+			Expect(handler.DeliveryRate()).To(BeNumerically("~", 20e3, 1))
+			// subsequent samples are weighted by 1/8
+			atomic.StoreUint64(&handler.deliveryRate, math.Float64bits(100e3))
+			sendAndAck(3)
+			Expect(handler.DeliveryRate()).To(BeNumerically("~", 90e3, 1))
+		})
 	})
 
 	Context("peeking and popping packet number", func() {
@@ -126,6 +126,17 @@ func (c *cubicSender) GetSlowStartThreshold() protocol.ByteCount {
 	return c.slowstartThreshold
 }
 
+// State returns the state of the congestion controller.
+func (c *cubicSender) State() State {
+	if c.InRecovery() {
+		return StateRecovery
+	}
+	if c.InSlowStart() {
+		return StateSlowStart
+	}
+	return StateCongestionAvoidance
+}
+
 func (c *cubicSender) ExitSlowstart() {
 	c.slowstartThreshold = c.congestionWindow
 }
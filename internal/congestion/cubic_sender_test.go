@@ -558,6 +558,29 @@ var _ = Describe("Cubic Sender", func() {
 		Expect(sender.GetCongestionWindow()).To(Equal(expectedSendWindow))
 	})
 
+	It("reports the state", func() {
+		Expect(sender.State()).To(Equal(StateSlowStart))
+		SendAvailableSendWindow()
+		AckNPackets(2)
+		Expect(sender.State()).To(Equal(StateSlowStart))
+		SendAvailableSendWindow()
+		LoseNPackets(1)
+		Expect(sender.State()).To(Equal(StateRecovery))
+		Expect(sender.GetSlowStartThreshold()).To(Equal(sender.GetCongestionWindow()))
+		// ack all outstanding packets, and a packet sent after the loss
+		AckNPackets(int(bytesInFlight / protocol.DefaultTCPMSS))
+		SendAvailableSendWindow()
+		AckNPackets(1)
+		Expect(sender.State()).To(Equal(StateCongestionAvoidance))
+	})
+
+	It("has a string representation for the states", func() {
+		Expect(StateSlowStart.String()).To(Equal("slow start"))
+		Expect(StateCongestionAvoidance.String()).To(Equal("congestion avoidance"))
+		Expect(StateRecovery.String()).To(Equal("recovery"))
+		Expect(State(42).String()).To(Equal("unknown state"))
+	})
+
 	It("reset after connection migration", func() {
 		Expect(sender.GetCongestionWindow()).To(Equal(defaultWindowTCP))
 		Expect(sender.SlowstartThreshold()).To(Equal(MaxCongestionWindow))
@@ -6,11 +6,38 @@ import (
 	"github.com/lucas-clemente/quic-go/internal/protocol"
 )
 
+// A State is the state of the congestion controller.
+type State uint8
+
+const (
+	// StateSlowStart is used during slow start.
+	StateSlowStart State = iota
+	// StateCongestionAvoidance is used after exiting slow start, when not recovering from a loss.
+	StateCongestionAvoidance
+	// StateRecovery is used after a loss, until a packet sent after the loss is acknowledged.
+	StateRecovery
+)
+
+func (s State) String() string {
+	switch s {
+	case StateSlowStart:
+		return "slow start"
+	case StateCongestionAvoidance:
+		return "congestion avoidance"
+	case StateRecovery:
+		return "recovery"
+	default:
+		return "unknown state"
+	}
+}
+
 // A SendAlgorithm performs congestion control and calculates the congestion window
 type SendAlgorithm interface {
 	TimeUntilSend(bytesInFlight protocol.ByteCount) time.Duration
 	OnPacketSent(sentTime time.Time, bytesInFlight protocol.ByteCount, packetNumber protocol.PacketNumber, bytes protocol.ByteCount, isRetransmittable bool)
 	GetCongestionWindow() protocol.ByteCount
+	GetSlowStartThreshold() protocol.ByteCount
+	State() State
 	MaybeExitSlowStart()
 	OnPacketAcked(number protocol.PacketNumber, ackedBytes protocol.ByteCount, priorInFlight protocol.ByteCount, eventTime time.Time)
 	OnPacketLost(number protocol.PacketNumber, lostBytes protocol.ByteCount, priorInFlight protocol.ByteCount)
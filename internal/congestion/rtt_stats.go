@@ -13,6 +13,8 @@ const (
 	oneMinusBeta  float32 = (1 - rttBeta)
 	// The default RTT used before an RTT sample is taken.
 	defaultInitialRTT = 100 * time.Millisecond
+	// The number of RTT samples returned by RecentSamples.
+	numRecentRTTSamples = 10
 )
 
 // RTTStats provides round-trip statistics
@@ -21,6 +23,11 @@ type RTTStats struct {
 	latestRTT     time.Duration
 	smoothedRTT   time.Duration
 	meanDeviation time.Duration
+
+	// recentSamples is a ring buffer of the most recent RTT samples
+	recentSamples    [numRecentRTTSamples]time.Duration
+	nextSample       int // the position in recentSamples where the next sample is written
+	numRecentSamples int
 }
 
 // NewRTTStats makes a properly initialized RTTStats object
@@ -52,6 +59,15 @@ func (r *RTTStats) SmoothedOrInitialRTT() time.Duration {
 // MeanDeviation gets the mean deviation
 func (r *RTTStats) MeanDeviation() time.Duration { return r.meanDeviation }
 
+// AppendRecentSamples appends the most recent RTT samples (up to 10) to b, starting with the oldest one.
+// Like the latest RTT, the samples are corrected for the ACK delay.
+func (r *RTTStats) AppendRecentSamples(b []time.Duration) []time.Duration {
+	for i := 0; i < r.numRecentSamples; i++ {
+		b = append(b, r.recentSamples[(r.nextSample-r.numRecentSamples+i+numRecentRTTSamples)%numRecentRTTSamples])
+	}
+	return b
+}
+
 // UpdateRTT updates the RTT based on a new sample.
 func (r *RTTStats) UpdateRTT(sendDelta, ackDelay time.Duration, now time.Time) {
 	if sendDelta == utils.InfDuration || sendDelta <= 0 {
@@ -74,6 +90,9 @@ func (r *RTTStats) UpdateRTT(sendDelta, ackDelay time.Duration, now time.Time) {
 		sample -= ackDelay
 	}
 	r.latestRTT = sample
+	r.recentSamples[r.nextSample] = sample
+	r.nextSample = (r.nextSample + 1) % numRecentRTTSamples
+	r.numRecentSamples = utils.Min(r.numRecentSamples+1, numRecentRTTSamples)
 	// First time call.
 	if r.smoothedRTT == 0 {
 		r.smoothedRTT = sample
@@ -90,6 +109,7 @@ func (r *RTTStats) OnConnectionMigration() {
 	r.minRTT = 0
 	r.smoothedRTT = 0
 	r.meanDeviation = 0
+	r.numRecentSamples = 0
 }
 
 // ExpireSmoothedMetrics causes the smoothed_rtt to be increased to the latest_rtt if the latest_rtt
@@ -126,6 +126,23 @@ var _ = Describe("RTT stats", func() {
 		Expect(rttStats.LatestRTT()).To(Equal(time.Duration(0)))
 		Expect(rttStats.SmoothedRTT()).To(Equal(time.Duration(0)))
 		Expect(rttStats.MinRTT()).To(Equal(time.Duration(0)))
+		Expect(rttStats.AppendRecentSamples(nil)).To(BeEmpty())
 	})
 
+	It("RecentSamples", func() {
+		Expect(rttStats.AppendRecentSamples(nil)).To(BeEmpty())
+		rttStats.UpdateRTT(100*time.Millisecond, 0, time.Time{})
+		// the sample is corrected for the ACK delay
+		rttStats.UpdateRTT(150*time.Millisecond, 20*time.Millisecond, time.Time{})
+		Expect(rttStats.AppendRecentSamples(nil)).To(Equal([]time.Duration{100 * time.Millisecond, 130 * time.Millisecond}))
+		Expect(rttStats.AppendRecentSamples([]time.Duration{time.Second})).To(Equal([]time.Duration{time.Second, 100 * time.Millisecond, 130 * time.Millisecond}))
+		for i := 1; i <= 15; i++ {
+			rttStats.UpdateRTT(time.Duration(i)*time.Millisecond, 0, time.Time{})
+		}
+		samples := rttStats.AppendRecentSamples(nil)
+		Expect(samples).To(HaveLen(numRecentRTTSamples))
+		for i, s := range samples {
+			Expect(s).To(Equal(time.Duration(i+6) * time.Millisecond))
+		}
+	})
 })
@@ -22,6 +22,9 @@ type baseFlowController struct {
 	receiveWindow        protocol.ByteCount
 	receiveWindowSize    protocol.ByteCount
 	maxReceiveWindowSize protocol.ByteCount
+	// reorderDepth is the maximum amount of data that was received out of order.
+	// It is added to the receive window size when generating window updates.
+	reorderDepth protocol.ByteCount
 
 	epochStartTime   time.Time
 	epochStartOffset protocol.ByteCount
@@ -87,10 +90,16 @@ func (c *baseFlowController) getWindowUpdate() protocol.ByteCount {
 	}
 
 	c.maybeAdjustWindowSize()
-	c.receiveWindow = c.bytesRead + c.receiveWindowSize
+	c.receiveWindow = c.bytesRead + c.windowSizeWithReorderDepth()
 	return c.receiveWindow
 }
 
+// windowSizeWithReorderDepth is the size of the window that is advertised.
+// It leaves room for data that is received out of order, without exceeding the maxReceiveWindowSize.
+func (c *baseFlowController) windowSizeWithReorderDepth() protocol.ByteCount {
+	return utils.MaxByteCount(c.receiveWindowSize, utils.MinByteCount(c.receiveWindowSize+c.reorderDepth, c.maxReceiveWindowSize))
+}
+
 // maybeAdjustWindowSize increases the receiveWindowSize if we're sending updates too often.
 // For details about auto-tuning, see https://docs.google.com/document/d/1SExkMmGiz8VYzV3s9E35JQlJ73vhzCekKkDi85F1qCE/edit?usp=sharing.
 func (c *baseFlowController) maybeAdjustWindowSize() {
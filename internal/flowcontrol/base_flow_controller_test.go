@@ -123,6 +123,28 @@ var _ = Describe("Base Flow controller", func() {
 			Expect(offset).To(BeZero())
 		})
 
+		Context("leaving room for reordered data", func() {
+			BeforeEach(func() {
+				controller.maxReceiveWindowSize = 5000
+				// consume enough data to trigger a window update
+				controller.bytesRead = receiveWindow - receiveWindowSize/4
+			})
+
+			It("adds the reorder depth to the window", func() {
+				controller.reorderDepth = 500
+				offset := controller.getWindowUpdate()
+				Expect(offset).To(Equal(controller.bytesRead + receiveWindowSize + 500))
+				// the window size itself is not changed
+				Expect(controller.receiveWindowSize).To(Equal(receiveWindowSize))
+			})
+
+			It("doesn't exceed the maxReceiveWindowSize", func() {
+				controller.reorderDepth = 10000
+				offset := controller.getWindowUpdate()
+				Expect(offset).To(Equal(controller.bytesRead + controller.maxReceiveWindowSize))
+			})
+		})
+
 		Context("receive window size auto-tuning", func() {
 			var oldWindowSize protocol.ByteCount
 
@@ -2,6 +2,7 @@ package flowcontrol
 
 import (
 	"fmt"
+	"sync"
 
 	"github.com/lucas-clemente/quic-go/internal/congestion"
 	"github.com/lucas-clemente/quic-go/internal/protocol"
@@ -12,6 +13,13 @@ import (
 type connectionFlowController struct {
 	baseFlowController
 
+	// sendMutex protects the send window, the bytes sent and the granted send credit,
+	// since send credit is donated by the application (see DonateSendCredit).
+	sendMutex sync.Mutex
+	// grantedSendCredit is the part of the send window that can only be used by a certain stream
+	grantedSendCredit      map[protocol.StreamID]protocol.ByteCount
+	totalGrantedSendCredit protocol.ByteCount
+
 	queueWindowUpdate func()
 }
 
@@ -39,9 +47,106 @@ func NewConnectionFlowController(
 }
 
 func (c *connectionFlowController) SendWindowSize() protocol.ByteCount {
+	c.sendMutex.Lock()
+	defer c.sendMutex.Unlock()
+
 	return c.baseFlowController.sendWindowSize()
 }
 
+func (c *connectionFlowController) UpdateSendWindow(offset protocol.ByteCount) {
+	c.sendMutex.Lock()
+	c.baseFlowController.UpdateSendWindow(offset)
+	c.sendMutex.Unlock()
+}
+
+func (c *connectionFlowController) AddBytesSent(n protocol.ByteCount) {
+	c.sendMutex.Lock()
+	c.baseFlowController.AddBytesSent(n)
+	c.sendMutex.Unlock()
+}
+
+// sendWindowSizeForStream returns the part of the send window that can be used by a stream:
+// the send window that wasn't granted to any stream, plus the send credit granted to this stream.
+func (c *connectionFlowController) sendWindowSizeForStream(id protocol.StreamID) protocol.ByteCount {
+	c.sendMutex.Lock()
+	defer c.sendMutex.Unlock()
+
+	return c.sendCreditOfStream(id)
+}
+
+func (c *connectionFlowController) sendCreditOfStream(id protocol.StreamID) protocol.ByteCount {
+	sendWindowSize := c.baseFlowController.sendWindowSize()
+	var unreserved protocol.ByteCount
+	if sendWindowSize > c.totalGrantedSendCredit {
+		unreserved = sendWindowSize - c.totalGrantedSendCredit
+	}
+	return utils.MinByteCount(sendWindowSize, unreserved+c.grantedSendCredit[id])
+}
+
+// addBytesSentOnStream adds bytes sent on a stream.
+// The send credit granted to the stream is used up first.
+func (c *connectionFlowController) addBytesSentOnStream(id protocol.StreamID, n protocol.ByteCount) {
+	c.sendMutex.Lock()
+	defer c.sendMutex.Unlock()
+
+	c.baseFlowController.AddBytesSent(n)
+	c.consumeSendCredit(id, n)
+}
+
+func (c *connectionFlowController) consumeSendCredit(id protocol.StreamID, n protocol.ByteCount) {
+	granted, ok := c.grantedSendCredit[id]
+	if !ok {
+		return
+	}
+	consumed := utils.MinByteCount(granted, n)
+	c.totalGrantedSendCredit -= consumed
+	if consumed == granted {
+		delete(c.grantedSendCredit, id)
+	} else {
+		c.grantedSendCredit[id] = granted - consumed
+	}
+}
+
+// DonateSendCredit transfers send credit from one stream to another.
+// The donating stream can donate the send credit granted to it, as well as the send window that wasn't granted to any stream.
+// The send credit granted to a stream can't be used by any other stream.
+func (c *connectionFlowController) DonateSendCredit(from, to protocol.StreamID, n protocol.ByteCount) error {
+	if from == to {
+		return fmt.Errorf("stream %d can't donate send credit to itself", from)
+	}
+
+	c.sendMutex.Lock()
+	defer c.sendMutex.Unlock()
+
+	if available := c.sendCreditOfStream(from); n > available {
+		return fmt.Errorf("stream %d can't donate %d bytes of send credit, only %d bytes available", from, n, available)
+	}
+	// use the send credit granted to the donating stream first
+	c.consumeSendCredit(from, n)
+	if c.grantedSendCredit == nil {
+		c.grantedSendCredit = make(map[protocol.StreamID]protocol.ByteCount)
+	}
+	c.grantedSendCredit[to] += n
+	c.totalGrantedSendCredit += n
+	return nil
+}
+
+// GrantedSendCredit returns the send credit granted to a stream, that hasn't been used yet.
+func (c *connectionFlowController) GrantedSendCredit(id protocol.StreamID) protocol.ByteCount {
+	c.sendMutex.Lock()
+	defer c.sendMutex.Unlock()
+
+	return c.grantedSendCredit[id]
+}
+
+// ReleaseSendCredit makes the unused send credit granted to a stream available to all streams.
+// It is called when the stream is completed.
+func (c *connectionFlowController) ReleaseSendCredit(id protocol.StreamID) {
+	c.sendMutex.Lock()
+	c.consumeSendCredit(id, c.grantedSendCredit[id])
+	c.sendMutex.Unlock()
+}
+
 // IncrementHighestReceived adds an increment to the highestReceived value
 func (c *connectionFlowController) IncrementHighestReceived(increment protocol.ByteCount) error {
 	c.mutex.Lock()
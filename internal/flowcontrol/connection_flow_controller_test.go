@@ -95,6 +95,68 @@ var _ = Describe("Connection Flow controller", func() {
 		})
 	})
 
+	Context("send credit", func() {
+		BeforeEach(func() {
+			controller.UpdateSendWindow(1000)
+		})
+
+		It("donates send credit", func() {
+			Expect(controller.DonateSendCredit(4, 8, 300)).To(Succeed())
+			Expect(controller.GrantedSendCredit(8)).To(Equal(protocol.ByteCount(300)))
+			Expect(controller.GrantedSendCredit(4)).To(BeZero())
+			Expect(controller.SendWindowSize()).To(Equal(protocol.ByteCount(1000)))
+			Expect(controller.sendWindowSizeForStream(8)).To(Equal(protocol.ByteCount(1000)))
+			Expect(controller.sendWindowSizeForStream(4)).To(Equal(protocol.ByteCount(700)))
+			Expect(controller.sendWindowSizeForStream(12)).To(Equal(protocol.ByteCount(700)))
+		})
+
+		It("doesn't allow other streams to use the granted send credit", func() {
+			Expect(controller.DonateSendCredit(4, 8, 300)).To(Succeed())
+			controller.addBytesSentOnStream(4, 700)
+			Expect(controller.sendWindowSizeForStream(4)).To(BeZero())
+			Expect(controller.sendWindowSizeForStream(12)).To(BeZero())
+			Expect(controller.sendWindowSizeForStream(8)).To(Equal(protocol.ByteCount(300)))
+			Expect(controller.GrantedSendCredit(8)).To(Equal(protocol.ByteCount(300)))
+		})
+
+		It("uses up the granted send credit first", func() {
+			Expect(controller.DonateSendCredit(4, 8, 300)).To(Succeed())
+			controller.addBytesSentOnStream(8, 200)
+			Expect(controller.GrantedSendCredit(8)).To(Equal(protocol.ByteCount(100)))
+			Expect(controller.sendWindowSizeForStream(4)).To(Equal(protocol.ByteCount(700)))
+			controller.addBytesSentOnStream(8, 400)
+			Expect(controller.GrantedSendCredit(8)).To(BeZero())
+			Expect(controller.sendWindowSizeForStream(4)).To(Equal(protocol.ByteCount(400)))
+			Expect(controller.sendWindowSizeForStream(8)).To(Equal(protocol.ByteCount(400)))
+		})
+
+		It("donates granted send credit", func() {
+			Expect(controller.DonateSendCredit(4, 8, 300)).To(Succeed())
+			Expect(controller.DonateSendCredit(8, 12, 800)).To(Succeed())
+			Expect(controller.GrantedSendCredit(8)).To(BeZero())
+			Expect(controller.GrantedSendCredit(12)).To(Equal(protocol.ByteCount(800)))
+			Expect(controller.sendWindowSizeForStream(4)).To(Equal(protocol.ByteCount(200)))
+		})
+
+		It("doesn't donate more send credit than available", func() {
+			Expect(controller.DonateSendCredit(4, 8, 300)).To(Succeed())
+			err := controller.DonateSendCredit(4, 12, 701)
+			Expect(err).To(MatchError("stream 4 can't donate 701 bytes of send credit, only 700 bytes available"))
+			Expect(controller.GrantedSendCredit(12)).To(BeZero())
+		})
+
+		It("doesn't allow a stream to donate send credit to itself", func() {
+			Expect(controller.DonateSendCredit(4, 4, 100)).To(MatchError("stream 4 can't donate send credit to itself"))
+		})
+
+		It("releases the send credit", func() {
+			Expect(controller.DonateSendCredit(4, 8, 300)).To(Succeed())
+			controller.ReleaseSendCredit(8)
+			Expect(controller.GrantedSendCredit(8)).To(BeZero())
+			Expect(controller.sendWindowSizeForStream(4)).To(Equal(protocol.ByteCount(1000)))
+		})
+	})
+
 	Context("setting the minimum window size", func() {
 		var (
 			oldWindowSize     protocol.ByteCount
@@ -9,7 +9,6 @@ type flowController interface {
 	AddBytesSent(protocol.ByteCount)
 	// for receiving
 	AddBytesRead(protocol.ByteCount)
-	GetWindowUpdate() protocol.ByteCount // returns 0 if no update is necessary
 	IsNewlyBlocked() (bool, protocol.ByteCount)
 }
 
@@ -21,14 +20,34 @@ type StreamFlowController interface {
 	// final has to be to true if this is the final offset of the stream,
 	// as contained in a STREAM frame with FIN bit, and the RESET_STREAM frame
 	UpdateHighestReceived(offset protocol.ByteCount, final bool) error
+	// UpdateReorderDepth should be called when data was received out of order.
+	// The depth is the amount of data that was received beyond the end of the reordered data.
+	// Window updates leave room for the highest depth observed.
+	UpdateReorderDepth(depth protocol.ByteCount)
+	// GetWindowUpdate returns the new receive window, or 0 if no update is necessary.
+	// buffered is the number of bytes that were received, but not read yet, including data queued behind gaps.
+	// The window is never increased beyond what's needed to buffer at most the maximum receive window size.
+	GetWindowUpdate(buffered protocol.ByteCount) protocol.ByteCount
 	// Abandon should be called when reading from the stream is aborted early,
 	// and there won't be any further calls to AddBytesRead.
 	Abandon()
+	// for sending
+	// GrantedSendCredit returns the connection-level send credit donated to this stream that hasn't been used yet.
+	GrantedSendCredit() protocol.ByteCount
 }
 
 // The ConnectionFlowController is the flow controller for the connection.
 type ConnectionFlowController interface {
 	flowController
+	// for sending
+	// DonateSendCredit reserves n bytes of the connection-level send window for stream to,
+	// taken from the send window available to stream from.
+	DonateSendCredit(from, to protocol.StreamID, n protocol.ByteCount) error
+	GrantedSendCredit(protocol.StreamID) protocol.ByteCount
+	// ReleaseSendCredit should be called when a stream is completed.
+	ReleaseSendCredit(protocol.StreamID)
+	// for receiving
+	GetWindowUpdate() protocol.ByteCount // returns 0 if no update is necessary
 }
 
 type connectionFlowControllerI interface {
@@ -36,6 +55,8 @@ type connectionFlowControllerI interface {
 	// The following two methods are not supposed to be called from outside this packet, but are needed internally
 	// for sending
 	EnsureMinimumWindowSize(protocol.ByteCount)
+	sendWindowSizeForStream(protocol.StreamID) protocol.ByteCount
+	addBytesSentOnStream(protocol.StreamID, protocol.ByteCount)
 	// for receiving
 	IncrementHighestReceived(protocol.ByteCount) error
 }
@@ -89,6 +89,15 @@ func (c *streamFlowController) UpdateHighestReceived(offset protocol.ByteCount,
 	return c.connection.IncrementHighestReceived(increment)
 }
 
+// UpdateReorderDepth updates the reorderDepth value, if the depth is higher.
+func (c *streamFlowController) UpdateReorderDepth(depth protocol.ByteCount) {
+	c.mutex.Lock()
+	if depth > c.reorderDepth {
+		c.reorderDepth = depth
+	}
+	c.mutex.Unlock()
+}
+
 func (c *streamFlowController) AddBytesRead(n protocol.ByteCount) {
 	c.baseFlowController.AddBytesRead(n)
 	c.maybeQueueWindowUpdate()
@@ -103,11 +112,15 @@ func (c *streamFlowController) Abandon() {
 
 func (c *streamFlowController) AddBytesSent(n protocol.ByteCount) {
 	c.baseFlowController.AddBytesSent(n)
-	c.connection.AddBytesSent(n)
+	c.connection.addBytesSentOnStream(c.streamID, n)
 }
 
 func (c *streamFlowController) SendWindowSize() protocol.ByteCount {
-	return utils.MinByteCount(c.baseFlowController.sendWindowSize(), c.connection.SendWindowSize())
+	return utils.MinByteCount(c.baseFlowController.sendWindowSize(), c.connection.sendWindowSizeForStream(c.streamID))
+}
+
+func (c *streamFlowController) GrantedSendCredit() protocol.ByteCount {
+	return c.connection.GrantedSendCredit(c.streamID)
 }
 
 func (c *streamFlowController) maybeQueueWindowUpdate() {
@@ -119,7 +132,7 @@ func (c *streamFlowController) maybeQueueWindowUpdate() {
 	}
 }
 
-func (c *streamFlowController) GetWindowUpdate() protocol.ByteCount {
+func (c *streamFlowController) GetWindowUpdate(buffered protocol.ByteCount) protocol.ByteCount {
 	// don't use defer for unlocking the mutex here, GetWindowUpdate() is called frequently and defer shows up in the profiler
 	c.mutex.Lock()
 	// if we already received the final offset for this stream, the peer won't need any additional flow control credit
@@ -129,7 +142,26 @@ func (c *streamFlowController) GetWindowUpdate() protocol.ByteCount {
 	}
 
 	oldWindowSize := c.receiveWindowSize
+	oldWindow := c.receiveWindow
 	offset := c.baseFlowController.getWindowUpdate()
+	// Don't grant credit that would allow the peer to make us buffer more than maxReceiveWindowSize bytes.
+	// The data between highestReceived and the new offset can still be received,
+	// on top of the buffered data (which includes the data queued behind gaps).
+	if offset > 0 {
+		maxOffset := utils.MaxByteCount(c.highestReceived, c.bytesRead)
+		if buffered < c.maxReceiveWindowSize {
+			maxOffset += c.maxReceiveWindowSize - buffered
+		}
+		if offset > maxOffset {
+			if maxOffset <= oldWindow {
+				c.receiveWindow = oldWindow
+				c.mutex.Unlock()
+				return 0
+			}
+			offset = maxOffset
+			c.receiveWindow = offset
+		}
+	}
 	if c.receiveWindowSize > oldWindowSize { // auto-tuning enlarged the window size
 		c.logger.Debugf("Increasing receive flow control window for stream %d to %d kB", c.streamID, c.receiveWindowSize/(1<<10))
 		c.connection.EnsureMinimumWindowSize(protocol.ByteCount(float64(c.receiveWindowSize) * protocol.ConnectionFlowControlMultiplier))
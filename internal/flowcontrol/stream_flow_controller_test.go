@@ -170,7 +170,7 @@ var _ = Describe("Stream Flow controller", func() {
 				Expect(queuedWindowUpdate).To(BeFalse())
 				controller.AddBytesRead(29)
 				Expect(queuedWindowUpdate).To(BeTrue())
-				Expect(controller.GetWindowUpdate()).ToNot(BeZero())
+				Expect(controller.GetWindowUpdate(0)).ToNot(BeZero())
 				queuedWindowUpdate = false
 				controller.AddBytesRead(1)
 				Expect(queuedWindowUpdate).To(BeFalse())
@@ -182,12 +182,40 @@ var _ = Describe("Stream Flow controller", func() {
 				controller.epochStartOffset = oldOffset
 				controller.epochStartTime = time.Now().Add(-time.Millisecond)
 				controller.AddBytesRead(55)
-				offset := controller.GetWindowUpdate()
+				offset := controller.GetWindowUpdate(0)
 				Expect(offset).To(Equal(oldOffset + 55 + 2*oldWindowSize))
 				Expect(controller.receiveWindowSize).To(Equal(2 * oldWindowSize))
 				Expect(controller.connection.(*connectionFlowController).receiveWindowSize).To(Equal(protocol.ByteCount(float64(controller.receiveWindowSize) * protocol.ConnectionFlowControlMultiplier)))
 			})
 
+			It("leaves room for the highest reorder depth", func() {
+				controller.maxReceiveWindowSize = 1000
+				controller.UpdateReorderDepth(20)
+				controller.UpdateReorderDepth(10) // doesn't decrease the depth
+				controller.AddBytesRead(30)
+				offset := controller.GetWindowUpdate(0)
+				Expect(offset).To(Equal(controller.bytesRead + oldWindowSize + 20))
+			})
+
+			It("doesn't allow the peer to make us buffer more than the maximum receive window", func() {
+				controller.maxReceiveWindowSize = 100
+				Expect(controller.UpdateHighestReceived(100, false)).To(Succeed())
+				controller.AddBytesRead(30)
+				// Flow control already limits the buffered data to the window.
+				// Pretend that more data is buffered, e.g. because the peer left gaps.
+				offset := controller.GetWindowUpdate(80)
+				Expect(offset).To(Equal(protocol.ByteCount(100 + 100 - 80)))
+				Expect(controller.receiveWindow).To(Equal(offset))
+			})
+
+			It("doesn't send a window update if the buffered data already fills the maximum receive window", func() {
+				controller.maxReceiveWindowSize = 100
+				Expect(controller.UpdateHighestReceived(100, false)).To(Succeed())
+				controller.AddBytesRead(30)
+				Expect(controller.GetWindowUpdate(100)).To(BeZero())
+				Expect(controller.receiveWindow).To(Equal(protocol.ByteCount(100)))
+			})
+
 			It("sends a connection-level window update when a large stream is abandoned", func() {
 				Expect(controller.UpdateHighestReceived(90, true)).To(Succeed())
 				Expect(controller.connection.GetWindowUpdate()).To(BeZero())
@@ -199,7 +227,7 @@ var _ = Describe("Stream Flow controller", func() {
 				Expect(controller.UpdateHighestReceived(90, true)).To(Succeed())
 				controller.AddBytesRead(30)
 				Expect(queuedWindowUpdate).To(BeFalse())
-				offset := controller.GetWindowUpdate()
+				offset := controller.GetWindowUpdate(0)
 				Expect(offset).To(BeZero())
 			})
 		})
@@ -228,5 +256,30 @@ var _ = Describe("Stream Flow controller", func() {
 			Expect(blocked).To(BeTrue())
 			Expect(controller.IsNewlyBlocked()).To(BeFalse())
 		})
+
+		It("uses the send credit granted to the stream", func() {
+			conn := controller.connection.(*connectionFlowController)
+			conn.UpdateSendWindow(100)
+			controller.UpdateSendWindow(1000)
+			Expect(conn.DonateSendCredit(4, 10, 60)).To(Succeed())
+			Expect(controller.GrantedSendCredit()).To(Equal(protocol.ByteCount(60)))
+			// another stream uses up the rest of the connection-level window
+			conn.addBytesSentOnStream(4, 40)
+			Expect(controller.SendWindowSize()).To(Equal(protocol.ByteCount(60)))
+			controller.AddBytesSent(20)
+			Expect(controller.GrantedSendCredit()).To(Equal(protocol.ByteCount(40)))
+			Expect(controller.SendWindowSize()).To(Equal(protocol.ByteCount(40)))
+		})
+
+		It("doesn't let other streams use the send credit granted to the stream", func() {
+			conn := controller.connection.(*connectionFlowController)
+			conn.UpdateSendWindow(100)
+			controller.UpdateSendWindow(1000)
+			Expect(conn.DonateSendCredit(10, 4, 80)).To(Succeed())
+			Expect(controller.SendWindowSize()).To(Equal(protocol.ByteCount(20)))
+			controller.AddBytesSent(20)
+			Expect(controller.SendWindowSize()).To(BeZero())
+			Expect(conn.sendWindowSizeForStream(4)).To(Equal(protocol.ByteCount(80)))
+		})
 	})
 })
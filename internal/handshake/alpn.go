@@ -0,0 +1,55 @@
+package handshake
+
+import (
+	"crypto/tls"
+	"fmt"
+
+	"github.com/marten-seemann/qtls"
+)
+
+// QUIC requires the use of ALPN.
+// Unlike TLS on TCP, the handshake fails if the client and the server don't support a common application protocol.
+
+// noApplicationProtocolError is returned when the client and the server don't support a common application protocol.
+type noApplicationProtocolError struct {
+	offered []string
+}
+
+func (e *noApplicationProtocolError) Error() string {
+	return fmt.Sprintf("no application protocol in common with the client (offered: %q)", e.offered)
+}
+
+// requireALPN wraps the GetConfigForClient callback of the server's config,
+// such that the handshake fails if no application protocol can be negotiated.
+func requireALPN(conf *qtls.Config) func(*tls.ClientHelloInfo) (*qtls.Config, error) {
+	getConfigForClient := conf.GetConfigForClient
+	return func(ch *tls.ClientHelloInfo) (*qtls.Config, error) {
+		var newConf *qtls.Config
+		nextProtos := conf.NextProtos
+		if getConfigForClient != nil {
+			var err error
+			newConf, err = getConfigForClient(ch)
+			if err != nil {
+				return nil, err
+			}
+			if newConf != nil {
+				nextProtos = newConf.NextProtos
+			}
+		}
+		if !hasCommonProtocol(ch.SupportedProtos, nextProtos) {
+			return nil, &noApplicationProtocolError{offered: ch.SupportedProtos}
+		}
+		return newConf, nil
+	}
+}
+
+func hasCommonProtocol(offered, supported []string) bool {
+	for _, p := range offered {
+		for _, s := range supported {
+			if p == s {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,21 @@
+package handshake
+
+// TLS 1.3 requires a server that requires client authentication to abort the handshake
+// with a certificate_required alert if the client doesn't send a certificate (RFC 8446, section 4.4.2.4).
+// qtls sends a bad_certificate alert in that case, so we need to check if the client's Certificate message was empty.
+
+const alertBadCertificate = 42
+
+// isEmptyCertificateMessage says if a TLS 1.3 Certificate message doesn't contain any certificates.
+func isEmptyCertificateMessage(data []byte) bool {
+	// 1 byte message type, 3 bytes message length, 1 byte length of the certificate_request_context
+	if len(data) < 5 {
+		return false
+	}
+	// the certificate_request_context is followed by the 3 byte length of the certificate_list
+	offset := 5 + int(data[4])
+	if len(data) < offset+3 {
+		return false
+	}
+	return data[offset] == 0 && data[offset+1] == 0 && data[offset+2] == 0
+}
@@ -12,10 +12,23 @@ import (
 const (
 	cookiePrefixIP byte = iota
 	cookiePrefixString
+	cookiePrefixIPNet
+)
+
+// The prefix lengths of the client address saved in tokens issued in NEW_TOKEN frames.
+// Clients might use a different address when connecting again (e.g. due to a NAT rebinding),
+// so these tokens are bound to the network of the client, not to the exact address.
+const (
+	newTokenPrefixLenIPv4 = 24
+	newTokenPrefixLenIPv6 = 64
 )
 
 // A Cookie is derived from the client address and can be used to verify the ownership of this address.
 type Cookie struct {
+	// IsRetryToken says if the Cookie was issued in a Retry packet, or in a NEW_TOKEN frame.
+	IsRetryToken bool
+	// For Cookies issued in a Retry packet, this is the client's IP address.
+	// For Cookies issued in a NEW_TOKEN frame, this is the prefix of the client's IP address, in CIDR notation.
 	RemoteAddr               string
 	OriginalDestConnectionID protocol.ConnectionID
 	// The time that the Cookie was issued (resolution 1 second)
@@ -24,6 +37,7 @@ type Cookie struct {
 
 // token is the struct that is used for ASN1 serialization and deserialization
 type token struct {
+	IsRetryToken             bool
 	RemoteAddr               []byte
 	OriginalDestConnectionID []byte
 
@@ -35,9 +49,12 @@ type CookieGenerator struct {
 	cookieProtector cookieProtector
 }
 
-// NewCookieGenerator initializes a new CookieGenerator
-func NewCookieGenerator() (*CookieGenerator, error) {
-	cookieProtector, err := newCookieProtector()
+// NewCookieGenerator initializes a new CookieGenerator.
+// getKeys returns the key used to protect new Cookies, and the key used before the last key rotation.
+// Cookies protected with either key are accepted. A zero previous key is not used.
+// If getKeys is nil, a random key is generated.
+func NewCookieGenerator(getKeys func() (current, previous [32]byte)) (*CookieGenerator, error) {
+	cookieProtector, err := newCookieProtector(getKeys)
 	if err != nil {
 		return nil, err
 	}
@@ -46,13 +63,23 @@ func NewCookieGenerator() (*CookieGenerator, error) {
 	}, nil
 }
 
-// NewToken generates a new Cookie for a given source address
-func (g *CookieGenerator) NewToken(raddr net.Addr, origConnID protocol.ConnectionID) ([]byte, error) {
-	data, err := asn1.Marshal(token{
+// NewRetryToken generates a new Cookie for a Retry packet, for a given source address
+func (g *CookieGenerator) NewRetryToken(raddr net.Addr, origConnID protocol.ConnectionID) ([]byte, error) {
+	return g.newToken(token{
+		IsRetryToken:             true,
 		RemoteAddr:               encodeRemoteAddr(raddr),
 		OriginalDestConnectionID: origConnID,
-		Timestamp:                time.Now().Unix(),
 	})
+}
+
+// NewToken generates a new Cookie for a NEW_TOKEN frame, for a given source address
+func (g *CookieGenerator) NewToken(raddr net.Addr) ([]byte, error) {
+	return g.newToken(token{RemoteAddr: encodeRemoteAddrPrefix(raddr)})
+}
+
+func (g *CookieGenerator) newToken(t token) ([]byte, error) {
+	t.Timestamp = time.Now().Unix()
+	data, err := asn1.Marshal(t)
 	if err != nil {
 		return nil, err
 	}
@@ -79,8 +106,9 @@ func (g *CookieGenerator) DecodeToken(encrypted []byte) (*Cookie, error) {
 		return nil, fmt.Errorf("rest when unpacking token: %d", len(rest))
 	}
 	cookie := &Cookie{
-		RemoteAddr: decodeRemoteAddr(t.RemoteAddr),
-		SentTime:   time.Unix(t.Timestamp, 0),
+		IsRetryToken: t.IsRetryToken,
+		RemoteAddr:   decodeRemoteAddr(t.RemoteAddr),
+		SentTime:     time.Unix(t.Timestamp, 0),
 	}
 	if len(t.OriginalDestConnectionID) > 0 {
 		cookie.OriginalDestConnectionID = protocol.ConnectionID(t.OriginalDestConnectionID)
@@ -96,14 +124,40 @@ func encodeRemoteAddr(remoteAddr net.Addr) []byte {
 	return append([]byte{cookiePrefixString}, []byte(remoteAddr.String())...)
 }
 
+// encodeRemoteAddrPrefix encodes the prefix of a remote address such that it can be saved in the Cookie
+func encodeRemoteAddrPrefix(remoteAddr net.Addr) []byte {
+	udpAddr, ok := remoteAddr.(*net.UDPAddr)
+	if !ok {
+		return encodeRemoteAddr(remoteAddr)
+	}
+	ip := udpAddr.IP
+	prefixLen := newTokenPrefixLenIPv6
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+		prefixLen = newTokenPrefixLenIPv4
+	} else if len(ip) != net.IPv6len {
+		return encodeRemoteAddr(remoteAddr)
+	}
+	ip = ip.Mask(net.CIDRMask(prefixLen, 8*len(ip)))
+	return append([]byte{cookiePrefixIPNet, byte(prefixLen)}, ip...)
+}
+
 // decodeRemoteAddr decodes the remote address saved in the Cookie
 func decodeRemoteAddr(data []byte) string {
 	// data will never be empty for a Cookie that we generated. Check it to be on the safe side
 	if len(data) == 0 {
 		return ""
 	}
-	if data[0] == cookiePrefixIP {
+	switch data[0] {
+	case cookiePrefixIP:
 		return net.IP(data[1:]).String()
+	case cookiePrefixIPNet:
+		if len(data) < 2 {
+			return ""
+		}
+		ip := net.IP(data[2:])
+		return (&net.IPNet{IP: ip, Mask: net.CIDRMask(int(data[1]), 8*len(ip))}).String()
+	default:
+		return string(data[1:])
 	}
-	return string(data[1:])
 }
@@ -16,13 +16,13 @@ var _ = Describe("Cookie Generator", func() {
 
 	BeforeEach(func() {
 		var err error
-		cookieGen, err = NewCookieGenerator()
+		cookieGen, err = NewCookieGenerator(nil)
 		Expect(err).ToNot(HaveOccurred())
 	})
 
 	It("generates a Cookie", func() {
 		ip := net.IPv4(127, 0, 0, 1)
-		token, err := cookieGen.NewToken(&net.UDPAddr{IP: ip, Port: 1337}, nil)
+		token, err := cookieGen.NewRetryToken(&net.UDPAddr{IP: ip, Port: 1337}, nil)
 		Expect(err).ToNot(HaveOccurred())
 		Expect(token).ToNot(BeEmpty())
 	})
@@ -35,13 +35,14 @@ var _ = Describe("Cookie Generator", func() {
 
 	It("accepts a valid cookie", func() {
 		ip := net.IPv4(192, 168, 0, 1)
-		token, err := cookieGen.NewToken(
+		token, err := cookieGen.NewRetryToken(
 			&net.UDPAddr{IP: ip, Port: 1337},
 			nil,
 		)
 		Expect(err).ToNot(HaveOccurred())
 		cookie, err := cookieGen.DecodeToken(token)
 		Expect(err).ToNot(HaveOccurred())
+		Expect(cookie.IsRetryToken).To(BeTrue())
 		Expect(cookie.RemoteAddr).To(Equal("192.168.0.1"))
 		// the time resolution of the Cookie is just 1 second
 		// if Cookie generation and this check happen in "different seconds", the difference will be between 1 and 2 seconds
@@ -50,7 +51,7 @@ var _ = Describe("Cookie Generator", func() {
 	})
 
 	It("saves the connection ID", func() {
-		token, err := cookieGen.NewToken(
+		token, err := cookieGen.NewRetryToken(
 			&net.UDPAddr{},
 			protocol.ConnectionID{0xde, 0xad, 0xbe, 0xef},
 		)
@@ -103,7 +104,7 @@ var _ = Describe("Cookie Generator", func() {
 			ip := net.ParseIP(addr)
 			Expect(ip).ToNot(BeNil())
 			raddr := &net.UDPAddr{IP: ip, Port: 1337}
-			token, err := cookieGen.NewToken(raddr, nil)
+			token, err := cookieGen.NewRetryToken(raddr, nil)
 			Expect(err).ToNot(HaveOccurred())
 			cookie, err := cookieGen.DecodeToken(token)
 			Expect(err).ToNot(HaveOccurred())
@@ -116,7 +117,7 @@ var _ = Describe("Cookie Generator", func() {
 
 	It("uses the string representation an address that is not a UDP address", func() {
 		raddr := &net.TCPAddr{IP: net.IPv4(192, 168, 13, 37), Port: 1337}
-		token, err := cookieGen.NewToken(raddr, nil)
+		token, err := cookieGen.NewRetryToken(raddr, nil)
 		Expect(err).ToNot(HaveOccurred())
 		cookie, err := cookieGen.DecodeToken(token)
 		Expect(err).ToNot(HaveOccurred())
@@ -125,4 +126,74 @@ var _ = Describe("Cookie Generator", func() {
 		// if Cookie generation and this check happen in "different seconds", the difference will be between 1 and 2 seconds
 		Expect(cookie.SentTime).To(BeTemporally("~", time.Now(), 2*time.Second))
 	})
+
+	Context("tokens for NEW_TOKEN frames", func() {
+		It("saves the prefix of an IPv4 address", func() {
+			token, err := cookieGen.NewToken(&net.UDPAddr{IP: net.IPv4(192, 168, 13, 37), Port: 1337})
+			Expect(err).ToNot(HaveOccurred())
+			cookie, err := cookieGen.DecodeToken(token)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(cookie.IsRetryToken).To(BeFalse())
+			Expect(cookie.RemoteAddr).To(Equal("192.168.13.0/24"))
+			Expect(cookie.OriginalDestConnectionID).To(BeNil())
+			Expect(cookie.SentTime).To(BeTemporally("~", time.Now(), 2*time.Second))
+		})
+
+		It("saves the prefix of an IPv6 address", func() {
+			token, err := cookieGen.NewToken(&net.UDPAddr{IP: net.ParseIP("2001:db8:1:2:3:4:5:6"), Port: 1337})
+			Expect(err).ToNot(HaveOccurred())
+			cookie, err := cookieGen.DecodeToken(token)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(cookie.IsRetryToken).To(BeFalse())
+			Expect(cookie.RemoteAddr).To(Equal("2001:db8:1:2::/64"))
+		})
+
+		It("uses the string representation an address that is not a UDP address", func() {
+			token, err := cookieGen.NewToken(&net.TCPAddr{IP: net.IPv4(192, 168, 13, 37), Port: 1337})
+			Expect(err).ToNot(HaveOccurred())
+			cookie, err := cookieGen.DecodeToken(token)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(cookie.RemoteAddr).To(Equal("192.168.13.37:1337"))
+		})
+	})
+
+	Context("key rotation", func() {
+		var current, previous [32]byte
+
+		BeforeEach(func() {
+			current = [32]byte{1}
+			previous = [32]byte{}
+			var err error
+			cookieGen, err = NewCookieGenerator(func() ([32]byte, [32]byte) { return current, previous })
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		It("accepts tokens issued with the previous key", func() {
+			token, err := cookieGen.NewRetryToken(&net.UDPAddr{IP: net.IPv4(192, 168, 13, 37)}, nil)
+			Expect(err).ToNot(HaveOccurred())
+			current, previous = [32]byte{2}, current
+			cookie, err := cookieGen.DecodeToken(token)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(cookie.RemoteAddr).To(Equal("192.168.13.37"))
+		})
+
+		It("rejects tokens issued with a key that was rotated out", func() {
+			token, err := cookieGen.NewRetryToken(&net.UDPAddr{IP: net.IPv4(192, 168, 13, 37)}, nil)
+			Expect(err).ToNot(HaveOccurred())
+			current, previous = [32]byte{2}, current
+			current, previous = [32]byte{3}, current
+			_, err = cookieGen.DecodeToken(token)
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("accepts tokens issued by a different generator using the same key", func() {
+			otherGen, err := NewCookieGenerator(func() ([32]byte, [32]byte) { return [32]byte{1}, [32]byte{} })
+			Expect(err).ToNot(HaveOccurred())
+			token, err := otherGen.NewToken(&net.UDPAddr{IP: net.IPv4(192, 168, 13, 37)})
+			Expect(err).ToNot(HaveOccurred())
+			cookie, err := cookieGen.DecodeToken(token)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(cookie.RemoteAddr).To(Equal("192.168.13.0/24"))
+		})
+	})
 })
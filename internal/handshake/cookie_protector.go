@@ -26,16 +26,22 @@ const (
 
 // cookieProtector is used to create and verify a cookie
 type cookieProtectorImpl struct {
-	secret []byte
+	getKeys func() (current, previous [cookieSecretSize]byte)
 }
 
-// newCookieProtector creates a source for source address tokens
-func newCookieProtector() (cookieProtector, error) {
-	secret := make([]byte, cookieSecretSize)
-	if _, err := rand.Read(secret); err != nil {
-		return nil, err
+// newCookieProtector creates a source for source address tokens.
+// getKeys returns the key used to protect new tokens, and the key used before the last key rotation.
+// Tokens protected with either key are accepted. A zero previous key is not used.
+// If getKeys is nil, a random key is generated.
+func newCookieProtector(getKeys func() (current, previous [cookieSecretSize]byte)) (cookieProtector, error) {
+	if getKeys == nil {
+		var secret [cookieSecretSize]byte
+		if _, err := rand.Read(secret[:]); err != nil {
+			return nil, err
+		}
+		getKeys = func() (current, previous [cookieSecretSize]byte) { return secret, [cookieSecretSize]byte{} }
 	}
-	return &cookieProtectorImpl{secret: secret}, nil
+	return &cookieProtectorImpl{getKeys: getKeys}, nil
 }
 
 // NewToken encodes data into a new token.
@@ -44,7 +50,8 @@ func (s *cookieProtectorImpl) NewToken(data []byte) ([]byte, error) {
 	if _, err := rand.Read(nonce); err != nil {
 		return nil, err
 	}
-	aead, aeadNonce, err := s.createAEAD(nonce)
+	current, _ := s.getKeys()
+	aead, aeadNonce, err := s.createAEAD(current[:], nonce)
 	if err != nil {
 		return nil, err
 	}
@@ -56,16 +63,26 @@ func (s *cookieProtectorImpl) DecodeToken(p []byte) ([]byte, error) {
 	if len(p) < cookieNonceSize {
 		return nil, fmt.Errorf("Token too short: %d", len(p))
 	}
+	current, previous := s.getKeys()
+	data, err := s.open(current[:], p)
+	if err != nil && previous != [cookieSecretSize]byte{} {
+		// The token might have been issued before the key was rotated.
+		return s.open(previous[:], p)
+	}
+	return data, err
+}
+
+func (s *cookieProtectorImpl) open(secret, p []byte) ([]byte, error) {
 	nonce := p[:cookieNonceSize]
-	aead, aeadNonce, err := s.createAEAD(nonce)
+	aead, aeadNonce, err := s.createAEAD(secret, nonce)
 	if err != nil {
 		return nil, err
 	}
 	return aead.Open(nil, aeadNonce, p[cookieNonceSize:], nil)
 }
 
-func (s *cookieProtectorImpl) createAEAD(nonce []byte) (cipher.AEAD, []byte, error) {
-	h := hkdf.New(sha256.New, s.secret, nonce, []byte("quic-go cookie source"))
+func (s *cookieProtectorImpl) createAEAD(secret, nonce []byte) (cipher.AEAD, []byte, error) {
+	h := hkdf.New(sha256.New, secret, nonce, []byte("quic-go cookie source"))
 	key := make([]byte, 32) // use a 32 byte key, in order to select AES-256
 	if _, err := io.ReadFull(h, key); err != nil {
 		return nil, nil, err
@@ -10,7 +10,7 @@ var _ = Describe("Cookie Protector", func() {
 
 	BeforeEach(func() {
 		var err error
-		cp, err = newCookieProtector()
+		cp, err = newCookieProtector(nil)
 		Expect(err).ToNot(HaveOccurred())
 	})
 
@@ -36,4 +36,22 @@ var _ = Describe("Cookie Protector", func() {
 		_, err := cp.DecodeToken([]byte("foobar"))
 		Expect(err).To(MatchError("Token too short: 6"))
 	})
+
+	It("uses the current key for new tokens, and accepts tokens protected with the previous key", func() {
+		key1, key2 := [32]byte{1}, [32]byte{2}
+		cp1, err := newCookieProtector(func() ([32]byte, [32]byte) { return key1, [32]byte{} })
+		Expect(err).ToNot(HaveOccurred())
+		cp2, err := newCookieProtector(func() ([32]byte, [32]byte) { return key2, key1 })
+		Expect(err).ToNot(HaveOccurred())
+		token1, err := cp1.NewToken([]byte("foobar"))
+		Expect(err).ToNot(HaveOccurred())
+		decoded, err := cp2.DecodeToken(token1)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(decoded).To(Equal([]byte("foobar")))
+		// cp1 doesn't know key2
+		token2, err := cp2.NewToken([]byte("foobar"))
+		Expect(err).ToNot(HaveOccurred())
+		_, err = cp1.DecodeToken(token2)
+		Expect(err).To(HaveOccurred())
+	})
 })
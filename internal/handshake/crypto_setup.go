@@ -16,6 +16,8 @@ import (
 	"github.com/marten-seemann/qtls"
 )
 
+var errHandshakeNotComplete = errors.New("handshake not complete")
+
 type messageType uint8
 
 // TLS handshake message types.
@@ -58,6 +60,10 @@ func (m messageType) String() string {
 // This can happen when packets arrive out of order.
 var ErrOpenerNotYetAvailable = errors.New("CryptoSetup: opener at this encryption level not yet available")
 
+// ErrKeysDropped is returned when an opener or a sealer is requested for an encryption level,
+// but the corresponding keys have already been dropped.
+var ErrKeysDropped = errors.New("CryptoSetup: keys were already dropped")
+
 type cryptoSetup struct {
 	tlsConf *qtls.Config
 	conn    *qtls.Conn
@@ -68,6 +74,8 @@ type cryptoSetup struct {
 	handleParamsCallback func([]byte)
 
 	alertChan chan uint8
+	// receivedEmptyCertificate is set when the client sends a Certificate message without any certificates
+	receivedEmptyCertificate utils.AtomicBool
 	// HandleData() sends errors on the messageErrChan
 	messageErrChan chan error
 	// handshakeDone is closed as soon as the go routine running qtls.Handshake() returns
@@ -96,13 +104,15 @@ type cryptoSetup struct {
 	readEncLevel  protocol.EncryptionLevel
 	writeEncLevel protocol.EncryptionLevel
 
-	initialStream io.Writer
-	initialOpener Opener
-	initialSealer Sealer
+	initialStream      io.Writer
+	initialOpener      Opener
+	initialSealer      Sealer
+	initialKeysDropped bool
 
-	handshakeStream io.Writer
-	handshakeOpener Opener
-	handshakeSealer Sealer
+	handshakeStream      io.Writer
+	handshakeOpener      Opener
+	handshakeSealer      Sealer
+	handshakeKeysDropped bool
 
 	oneRTTStream io.Writer
 	opener       Opener
@@ -168,6 +178,7 @@ func NewCryptoSetupServer(
 	if err != nil {
 		return nil, err
 	}
+	cs.tlsConf.GetConfigForClient = requireALPN(cs.tlsConf)
 	cs.conn = qtls.Server(newConn(remoteAddr), cs.tlsConf)
 	return cs, nil
 }
@@ -244,9 +255,18 @@ func (h *cryptoSetup) RunHandshake() error {
 		// wait until the Handshake() go routine has returned
 		return errors.New("Handshake aborted")
 	case <-handshakeComplete: // return when the handshake is done
+		if h.perspective == protocol.PerspectiveClient && h.conn.ConnectionState().NegotiatedProtocol == "" {
+			return qerr.Error(qerr.NoApplicationProtocol, "server didn't select an application protocol")
+		}
 		return nil
 	case alert := <-h.alertChan:
 		err := <-handshakeErrChan
+		if _, ok := err.(*noApplicationProtocolError); ok {
+			return qerr.Error(qerr.NoApplicationProtocol, err.Error())
+		}
+		if alert == alertBadCertificate && h.receivedEmptyCertificate.Get() {
+			return qerr.Error(qerr.CertificateRequired, err.Error())
+		}
 		return qerr.CryptoError(alert, err.Error())
 	case err := <-h.messageErrChan:
 		// If the handshake errored because of an error that occurred during HandleData(),
@@ -276,6 +296,10 @@ func (h *cryptoSetup) HandleMessage(data []byte, encLevel protocol.EncryptionLev
 		h.messageErrChan <- err
 		return false
 	}
+	// This needs to happen before qtls processes the message.
+	if h.perspective == protocol.PerspectiveServer && msgType == typeCertificate {
+		h.receivedEmptyCertificate.Set(isEmptyCertificateMessage(data))
+	}
 	h.messageChan <- data
 	switch h.perspective {
 	case protocol.PerspectiveClient:
@@ -532,8 +556,14 @@ func (h *cryptoSetup) GetSealerWithEncryptionLevel(level protocol.EncryptionLeve
 
 	switch level {
 	case protocol.EncryptionInitial:
+		if h.initialKeysDropped {
+			return nil, ErrKeysDropped
+		}
 		return h.initialSealer, nil
 	case protocol.EncryptionHandshake:
+		if h.handshakeKeysDropped {
+			return nil, ErrKeysDropped
+		}
 		if h.handshakeSealer == nil {
 			return nil, errNoSealer
 		}
@@ -554,8 +584,14 @@ func (h *cryptoSetup) GetOpener(level protocol.EncryptionLevel) (Opener, error)
 
 	switch level {
 	case protocol.EncryptionInitial:
+		if h.initialKeysDropped {
+			return nil, ErrKeysDropped
+		}
 		return h.initialOpener, nil
 	case protocol.EncryptionHandshake:
+		if h.handshakeKeysDropped {
+			return nil, ErrKeysDropped
+		}
 		if h.handshakeOpener == nil {
 			return nil, ErrOpenerNotYetAvailable
 		}
@@ -570,6 +606,30 @@ func (h *cryptoSetup) GetOpener(level protocol.EncryptionLevel) (Opener, error)
 	}
 }
 
+// DropInitialKeys drops the Initial keys.
+// Packets can't be sent or received at the Initial encryption level afterwards.
+func (h *cryptoSetup) DropInitialKeys() {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	h.initialOpener = nil
+	h.initialSealer = nil
+	h.initialKeysDropped = true
+	h.logger.Debugf("Dropping Initial keys.")
+}
+
+// DropHandshakeKeys drops the Handshake keys.
+// Packets can't be sent or received at the Handshake encryption level afterwards.
+func (h *cryptoSetup) DropHandshakeKeys() {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	h.handshakeOpener = nil
+	h.handshakeSealer = nil
+	h.handshakeKeysDropped = true
+	h.logger.Debugf("Dropping Handshake keys.")
+}
+
 func (h *cryptoSetup) ConnectionState() tls.ConnectionState {
 	cs := h.conn.ConnectionState()
 	// h.conn is a qtls.Conn, which returns a qtls.ConnectionState.
@@ -579,3 +639,19 @@ func (h *cryptoSetup) ConnectionState() tls.ConnectionState {
 	// In unsafe.go we check that the two objects are actually identical.
 	return *(*tls.ConnectionState)(unsafe.Pointer(&cs))
 }
+
+// ExportKeyingMaterial exports keying material from the TLS session, as defined in RFC 5705.
+// It returns an error if the handshake hasn't completed (successfully) yet.
+func (h *cryptoSetup) ExportKeyingMaterial(label string, context []byte, length int) ([]byte, error) {
+	// Don't call ConnectionState() while qtls is still handshaking, it would block until the handshake is done.
+	select {
+	case <-h.handshakeDone:
+	default:
+		return nil, errHandshakeNotComplete
+	}
+	cs := h.conn.ConnectionState()
+	if !cs.HandshakeComplete {
+		return nil, errHandshakeNotComplete
+	}
+	return cs.ExportKeyingMaterial(label, context, length)
+}
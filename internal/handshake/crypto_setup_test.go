@@ -13,6 +13,7 @@ import (
 	"time"
 
 	"github.com/lucas-clemente/quic-go/internal/protocol"
+	"github.com/lucas-clemente/quic-go/internal/qerr"
 	"github.com/lucas-clemente/quic-go/internal/testdata"
 	"github.com/lucas-clemente/quic-go/internal/utils"
 	"github.com/marten-seemann/qtls"
@@ -63,6 +64,7 @@ var _ = Describe("Crypto Setup TLS", func() {
 		clientConf = &tls.Config{
 			ServerName: "localhost",
 			RootCAs:    testdata.GetRootCA(),
+			NextProtos: []string{"quic-go test"},
 		}
 	})
 
@@ -76,7 +78,7 @@ var _ = Describe("Crypto Setup TLS", func() {
 				return nil, errors.New("GetClientCertificate")
 			},
 			GetConfigForClient: func(ch *tls.ClientHelloInfo) (*tls.Config, error) {
-				return &tls.Config{ServerName: ch.ServerName}, nil
+				return &tls.Config{ServerName: ch.ServerName, NextProtos: []string{"proto"}}, nil
 			},
 		}
 		server, err := NewCryptoSetupServer(
@@ -97,12 +99,15 @@ var _ = Describe("Crypto Setup TLS", func() {
 		Expect(getCertificateErr).To(MatchError("GetCertificate"))
 		_, getClientCertificateErr := qtlsConf.GetClientCertificate(nil)
 		Expect(getClientCertificateErr).To(MatchError("GetClientCertificate"))
-		cconf, err := qtlsConf.GetConfigForClient(&tls.ClientHelloInfo{ServerName: "foo.bar"})
+		cconf, err := qtlsConf.GetConfigForClient(&tls.ClientHelloInfo{ServerName: "foo.bar", SupportedProtos: []string{"proto"}})
 		Expect(err).ToNot(HaveOccurred())
 		Expect(cconf.ServerName).To(Equal("foo.bar"))
 		Expect(cconf.AlternativeRecordLayer).ToNot(BeNil())
 		Expect(cconf.GetExtensions).ToNot(BeNil())
 		Expect(cconf.ReceivedExtensions).ToNot(BeNil())
+		// the config returned by GetConfigForClient doesn't support this protocol
+		_, err = qtlsConf.GetConfigForClient(&tls.ClientHelloInfo{ServerName: "foo.bar", SupportedProtos: []string{"foo"}})
+		Expect(err).To(BeAssignableToTypeOf(&noApplicationProtocolError{}))
 	})
 
 	It("returns Handshake() when an error occurs", func() {
@@ -137,6 +142,27 @@ var _ = Describe("Crypto Setup TLS", func() {
 		}()
 		Eventually(handledMessage).Should(BeClosed())
 		Eventually(done).Should(BeClosed())
+		// the handshake failed, so there's no keying material to export
+		_, err = server.ExportKeyingMaterial("label", nil, 32)
+		Expect(err).To(MatchError(errHandshakeNotComplete))
+	})
+
+	It("refuses to export keying material before the handshake completes", func() {
+		_, cInitialStream, cHandshakeStream := initStreams()
+		client, _, err := NewCryptoSetupClient(
+			cInitialStream,
+			cHandshakeStream,
+			ioutil.Discard,
+			protocol.ConnectionID{},
+			nil,
+			&TransportParameters{},
+			func([]byte) {},
+			&tls.Config{ServerName: "quic.clemente.io"},
+			utils.DefaultLogger.WithPrefix("client"),
+		)
+		Expect(err).ToNot(HaveOccurred())
+		_, err = client.ExportKeyingMaterial("label", nil, 32)
+		Expect(err).To(MatchError(errHandshakeNotComplete))
 	})
 
 	It("returns Handshake() when handling a message fails", func() {
@@ -193,6 +219,50 @@ var _ = Describe("Crypto Setup TLS", func() {
 		Eventually(done).Should(BeClosed())
 	})
 
+	Context("dropping keys", func() {
+		var server CryptoSetup
+
+		BeforeEach(func() {
+			var err error
+			server, err = NewCryptoSetupServer(
+				&bytes.Buffer{},
+				&bytes.Buffer{},
+				ioutil.Discard,
+				protocol.ConnectionID{},
+				nil,
+				&TransportParameters{},
+				func([]byte) {},
+				testdata.GetTLSConfig(),
+				utils.DefaultLogger.WithPrefix("server"),
+			)
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		It("drops the Initial keys", func() {
+			opener, err := server.GetOpener(protocol.EncryptionInitial)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(opener).ToNot(BeNil())
+			server.DropInitialKeys()
+			_, err = server.GetOpener(protocol.EncryptionInitial)
+			Expect(err).To(MatchError(ErrKeysDropped))
+			_, err = server.GetSealerWithEncryptionLevel(protocol.EncryptionInitial)
+			Expect(err).To(MatchError(ErrKeysDropped))
+		})
+
+		It("drops the Handshake keys", func() {
+			_, err := server.GetOpener(protocol.EncryptionHandshake)
+			Expect(err).To(MatchError(ErrOpenerNotYetAvailable))
+			server.DropHandshakeKeys()
+			_, err = server.GetOpener(protocol.EncryptionHandshake)
+			Expect(err).To(MatchError(ErrKeysDropped))
+			_, err = server.GetSealerWithEncryptionLevel(protocol.EncryptionHandshake)
+			Expect(err).To(MatchError(ErrKeysDropped))
+			// the Initial keys are still available
+			_, err = server.GetOpener(protocol.EncryptionInitial)
+			Expect(err).ToNot(HaveOccurred())
+		})
+	})
+
 	Context("doing the handshake", func() {
 		generateCert := func() tls.Certificate {
 			priv, err := rsa.GenerateKey(rand.Reader, 2048)
@@ -246,6 +316,12 @@ var _ = Describe("Crypto Setup TLS", func() {
 			return clientErr, serverErr
 		}
 
+		getServerTLSConfig := func() *tls.Config {
+			conf := testdata.GetTLSConfig()
+			conf.NextProtos = []string{"quic-go test"}
+			return conf
+		}
+
 		handshakeWithTLSConf := func(clientConf, serverConf *tls.Config) (error /* client error */, error /* server error */) {
 			cChunkChan, cInitialStream, cHandshakeStream := initStreams()
 			client, _, err := NewCryptoSetupClient(
@@ -280,14 +356,14 @@ var _ = Describe("Crypto Setup TLS", func() {
 		}
 
 		It("handshakes", func() {
-			serverConf := testdata.GetTLSConfig()
+			serverConf := getServerTLSConfig()
 			clientErr, serverErr := handshakeWithTLSConf(clientConf, serverConf)
 			Expect(clientErr).ToNot(HaveOccurred())
 			Expect(serverErr).ToNot(HaveOccurred())
 		})
 
 		It("performs a HelloRetryRequst", func() {
-			serverConf := testdata.GetTLSConfig()
+			serverConf := getServerTLSConfig()
 			serverConf.CurvePreferences = []tls.CurveID{tls.CurveP384}
 			clientErr, serverErr := handshakeWithTLSConf(clientConf, serverConf)
 			Expect(clientErr).ToNot(HaveOccurred())
@@ -296,13 +372,191 @@ var _ = Describe("Crypto Setup TLS", func() {
 
 		It("handshakes with client auth", func() {
 			clientConf.Certificates = []tls.Certificate{generateCert()}
-			serverConf := testdata.GetTLSConfig()
+			serverConf := getServerTLSConfig()
 			serverConf.ClientAuth = qtls.RequireAnyClientCert
 			clientErr, serverErr := handshakeWithTLSConf(clientConf, serverConf)
 			Expect(clientErr).ToNot(HaveOccurred())
 			Expect(serverErr).ToNot(HaveOccurred())
 		})
 
+		It("verifies the client's certificate", func() {
+			clientCert := generateCert()
+			clientConf.Certificates = []tls.Certificate{clientCert}
+			cert, err := x509.ParseCertificate(clientCert.Certificate[0])
+			Expect(err).ToNot(HaveOccurred())
+			serverConf := getServerTLSConfig()
+			serverConf.ClientAuth = qtls.RequireAndVerifyClientCert
+			serverConf.ClientCAs = x509.NewCertPool()
+			serverConf.ClientCAs.AddCert(cert)
+			var verifiedChains [][]*x509.Certificate
+			serverConf.VerifyPeerCertificate = func(_ [][]byte, chains [][]*x509.Certificate) error {
+				verifiedChains = chains
+				return nil
+			}
+			clientErr, serverErr := handshakeWithTLSConf(clientConf, serverConf)
+			Expect(clientErr).ToNot(HaveOccurred())
+			Expect(serverErr).ToNot(HaveOccurred())
+			Expect(verifiedChains).To(HaveLen(1))
+			Expect(verifiedChains[0][0].Raw).To(Equal(clientCert.Certificate[0]))
+		})
+
+		It("fails the handshake with a certificate_required alert if the client doesn't send a certificate", func() {
+			serverConf := getServerTLSConfig()
+			serverConf.ClientAuth = qtls.RequireAnyClientCert
+			_, serverErr := handshakeWithTLSConf(clientConf, serverConf)
+			Expect(serverErr).To(HaveOccurred())
+			Expect(serverErr.(*qerr.QuicError).ErrorCode).To(Equal(qerr.CertificateRequired))
+			Expect(serverErr.Error()).To(ContainSubstring("client didn't provide a certificate"))
+		})
+
+		It("fails the handshake with a bad_certificate alert if the client's certificate can't be verified", func() {
+			clientConf.Certificates = []tls.Certificate{generateCert()}
+			serverConf := getServerTLSConfig()
+			serverConf.ClientAuth = qtls.RequireAndVerifyClientCert
+			serverConf.ClientCAs = x509.NewCertPool()
+			_, serverErr := handshakeWithTLSConf(clientConf, serverConf)
+			Expect(serverErr).To(HaveOccurred())
+			Expect(serverErr.(*qerr.QuicError).ErrorCode).To(Equal(qerr.ErrorCode(0x100 + 42)))
+			Expect(serverErr.Error()).To(ContainSubstring("failed to verify client's certificate"))
+		})
+
+		It("fails the handshake with a bad_certificate alert if VerifyPeerCertificate rejects the client's certificate", func() {
+			clientConf.Certificates = []tls.Certificate{generateCert()}
+			serverConf := getServerTLSConfig()
+			serverConf.ClientAuth = qtls.RequireAnyClientCert
+			serverConf.VerifyPeerCertificate = func([][]byte, [][]*x509.Certificate) error {
+				return errors.New("unknown device")
+			}
+			_, serverErr := handshakeWithTLSConf(clientConf, serverConf)
+			Expect(serverErr).To(HaveOccurred())
+			Expect(serverErr.(*qerr.QuicError).ErrorCode).To(Equal(qerr.ErrorCode(0x100 + 42)))
+			Expect(serverErr.Error()).To(ContainSubstring("unknown device"))
+		})
+
+		It("negotiates the application protocol", func() {
+			serverConf := getServerTLSConfig()
+			serverConf.NextProtos = []string{"foo", "quic-go test"}
+			clientConf.NextProtos = []string{"bar", "quic-go test"}
+			cChunkChan, cInitialStream, cHandshakeStream := initStreams()
+			client, _, err := NewCryptoSetupClient(
+				cInitialStream,
+				cHandshakeStream,
+				ioutil.Discard,
+				protocol.ConnectionID{},
+				nil,
+				&TransportParameters{},
+				func([]byte) {},
+				clientConf,
+				utils.DefaultLogger.WithPrefix("client"),
+			)
+			Expect(err).ToNot(HaveOccurred())
+
+			sChunkChan, sInitialStream, sHandshakeStream := initStreams()
+			var token [16]byte
+			server, err := NewCryptoSetupServer(
+				sInitialStream,
+				sHandshakeStream,
+				ioutil.Discard,
+				protocol.ConnectionID{},
+				nil,
+				&TransportParameters{StatelessResetToken: &token},
+				func([]byte) {},
+				serverConf,
+				utils.DefaultLogger.WithPrefix("server"),
+			)
+			Expect(err).ToNot(HaveOccurred())
+
+			clientErr, serverErr := handshake(client, cChunkChan, server, sChunkChan)
+			Expect(clientErr).ToNot(HaveOccurred())
+			Expect(serverErr).ToNot(HaveOccurred())
+			Expect(client.ConnectionState().NegotiatedProtocol).To(Equal("quic-go test"))
+			Expect(server.ConnectionState().NegotiatedProtocol).To(Equal("quic-go test"))
+		})
+
+		It("fails the handshake if there's no application protocol in common", func() {
+			clientConf.NextProtos = []string{"bar"}
+			cChunkChan, cInitialStream, cHandshakeStream := initStreams()
+			client, _, err := NewCryptoSetupClient(
+				cInitialStream,
+				cHandshakeStream,
+				ioutil.Discard,
+				protocol.ConnectionID{},
+				nil,
+				&TransportParameters{},
+				func([]byte) {},
+				clientConf,
+				utils.DefaultLogger.WithPrefix("client"),
+			)
+			Expect(err).ToNot(HaveOccurred())
+			go client.RunHandshake()
+			defer client.Close()
+
+			serverConf := getServerTLSConfig()
+			serverConf.NextProtos = []string{"foo"}
+			server, err := NewCryptoSetupServer(
+				&bytes.Buffer{},
+				&bytes.Buffer{},
+				ioutil.Discard,
+				protocol.ConnectionID{},
+				nil,
+				&TransportParameters{},
+				func([]byte) {},
+				serverConf,
+				utils.DefaultLogger.WithPrefix("server"),
+			)
+			Expect(err).ToNot(HaveOccurred())
+			serverErrChan := make(chan error, 1)
+			go func() { serverErrChan <- server.RunHandshake() }()
+			var ch chunk
+			Eventually(cChunkChan).Should(Receive(&ch))
+			server.HandleMessage(ch.data, ch.encLevel)
+			var serverErr error
+			Eventually(serverErrChan).Should(Receive(&serverErr))
+			Expect(serverErr).To(HaveOccurred())
+			Expect(serverErr.(*qerr.QuicError).ErrorCode).To(Equal(qerr.NoApplicationProtocol))
+			Expect(serverErr.Error()).To(ContainSubstring(`offered: ["bar"]`))
+		})
+
+		It("fails the handshake if the server didn't select an application protocol", func() {
+			cChunkChan, cInitialStream, cHandshakeStream := initStreams()
+			client, _, err := NewCryptoSetupClient(
+				cInitialStream,
+				cHandshakeStream,
+				ioutil.Discard,
+				protocol.ConnectionID{},
+				nil,
+				&TransportParameters{},
+				func([]byte) {},
+				clientConf,
+				utils.DefaultLogger.WithPrefix("client"),
+			)
+			Expect(err).ToNot(HaveOccurred())
+
+			sChunkChan, sInitialStream, sHandshakeStream := initStreams()
+			var token [16]byte
+			serverConf := getServerTLSConfig()
+			serverConf.NextProtos = []string{"foo"}
+			server, err := NewCryptoSetupServer(
+				sInitialStream,
+				sHandshakeStream,
+				ioutil.Discard,
+				protocol.ConnectionID{},
+				nil,
+				&TransportParameters{StatelessResetToken: &token},
+				func([]byte) {},
+				serverConf,
+				utils.DefaultLogger.WithPrefix("server"),
+			)
+			Expect(err).ToNot(HaveOccurred())
+			// Simulate a server that (incorrectly) completes the handshake without ALPN.
+			server.(*cryptoSetup).tlsConf.GetConfigForClient = nil
+
+			clientErr, serverErr := handshake(client, cChunkChan, server, sChunkChan)
+			Expect(serverErr).ToNot(HaveOccurred())
+			Expect(clientErr).To(HaveOccurred())
+			Expect(clientErr.(*qerr.QuicError).ErrorCode).To(Equal(qerr.NoApplicationProtocol))
+		})
+
 		It("signals when it has written the ClientHello", func() {
 			cChunkChan, cInitialStream, cHandshakeStream := initStreams()
 			client, chChan, err := NewCryptoSetupClient(
@@ -369,7 +623,7 @@ var _ = Describe("Crypto Setup TLS", func() {
 				nil,
 				sTransportParameters,
 				func(p []byte) { cTransportParametersRcvd = p },
-				testdata.GetTLSConfig(),
+				getServerTLSConfig(),
 				utils.DefaultLogger.WithPrefix("server"),
 			)
 			Expect(err).ToNot(HaveOccurred())
@@ -39,7 +39,7 @@ var _ = Describe("Initial AEAD using AES-GCM", func() {
 		})
 
 		It("computes the client key and IV", func() {
-			clientSecret, _ := computeSecrets(connID)
+			clientSecret, _ := computeSecrets(connID, quicVersion1Salt)
 			Expect(clientSecret).To(Equal(split("8a3515a14ae3c31b9c2d6d5bc58538ca 5cd2baa119087143e60887428dcb52f6")))
 			key, hpKey, iv := computeInitialKeyAndIV(clientSecret)
 			Expect(key).To(Equal(split("98b0d7e5e7a402c67c33f350fa65ea54")))
@@ -48,7 +48,7 @@ var _ = Describe("Initial AEAD using AES-GCM", func() {
 		})
 
 		It("computes the server key and IV", func() {
-			_, serverSecret := computeSecrets(connID)
+			_, serverSecret := computeSecrets(connID, quicVersion1Salt)
 			Expect(serverSecret).To(Equal(split("47b2eaea6c266e32c0697a9e2a898bdf 5c4fb3e5ac34f0e549bf2c58581a3811")))
 			key, hpKey, iv := computeInitialKeyAndIV(serverSecret)
 			Expect(key).To(Equal(split("9a8be902a9bdd91d16064ca118045fb4")))
@@ -87,6 +87,62 @@ var _ = Describe("Initial AEAD using AES-GCM", func() {
 		})
 	})
 
+	// values taken from RFC 9001, Appendix A.
+	// The version 1 Initial salt differs from the draft-19 salt, but the key schedule and the packet protection are the same.
+	// The packets use the RFC 9000 long header format, so only the packet protection is tested here.
+	Context("using the test vectors from RFC 9001", func() {
+		var connID protocol.ConnectionID
+		var salt []byte
+
+		BeforeEach(func() {
+			connID = protocol.ConnectionID(split("0x8394c8f03e515708"))
+			salt = split("0x38762cf7f55934b34d179ae6a4c80cadccbb7f0a")
+		})
+
+		It("computes the client key and IV", func() {
+			clientSecret, _ := computeSecrets(connID, salt)
+			key, hpKey, iv := computeInitialKeyAndIV(clientSecret)
+			Expect(key).To(Equal(split("1f369613dd76d5467730efcbe3b1a22d")))
+			Expect(iv).To(Equal(split("fa044b2f42a3fd3b46fb255c")))
+			Expect(hpKey).To(Equal(split("9f50449e04a0e810283a1e9933adedd2")))
+		})
+
+		It("computes the server key and IV", func() {
+			_, serverSecret := computeSecrets(connID, salt)
+			key, hpKey, iv := computeInitialKeyAndIV(serverSecret)
+			Expect(key).To(Equal(split("cf3a5331653c364c88f0f379b6067e37")))
+			Expect(iv).To(Equal(split("0ac1493ca1905853b0bba03e")))
+			Expect(hpKey).To(Equal(split("c206b8d9b9f0f37644430b490eeaa314")))
+		})
+
+		It("protects the header of the client's Initial", func() {
+			sealer, _, err := newInitialAEAD(connID, protocol.PerspectiveClient, salt)
+			Expect(err).ToNot(HaveOccurred())
+			_, opener, err := newInitialAEAD(connID, protocol.PerspectiveServer, salt)
+			Expect(err).ToNot(HaveOccurred())
+			header := split("c300000001088394c8f03e5157080000449e00000002")
+			sample := split("d1b1c98dd7689fb8ec11d242b123dc9b")
+			sealer.EncryptHeader(sample, &header[0], header[len(header)-4:])
+			Expect(header).To(Equal(split("c000000001088394c8f03e5157080000449e7b9aec34")))
+			opener.DecryptHeader(sample, &header[0], header[len(header)-4:])
+			Expect(header).To(Equal(split("c300000001088394c8f03e5157080000449e00000002")))
+		})
+
+		It("encrypts the server's Initial", func() {
+			sealer, _, err := newInitialAEAD(connID, protocol.PerspectiveServer, salt)
+			Expect(err).ToNot(HaveOccurred())
+			header := split("c1000000010008f067a5502a4262b50040750001")
+			data := split("02000000000600405a020000560303ee fce7f7b37ba1d1632e96677825ddf739 88cfc79825df566dc5430b9a045a1200 130100002e00330024001d00209d3c94 0d89690b84d08a60993c144eca684d10 81287c834d5311bcf32bb9da1a002b00 020304")
+			sealed := sealer.Seal(nil, data, 1, header)
+			sample := sealed[2:18]
+			Expect(sample).To(Equal(split("2cd0991cd25b0aac406a5816b6394100")))
+			sealer.EncryptHeader(sample, &header[0], header[len(header)-2:])
+			Expect(header).To(Equal(split("cf000000010008f067a5502a4262b5004075c0d9")))
+			packet := append(header, sealed...)
+			Expect(packet).To(Equal(split("cf000000010008f067a5502a4262b500 4075c0d95a482cd0991cd25b0aac406a 5816b6394100f37a1c69797554780bb3 8cc5a99f5ede4cf73c3ec2493a1839b3 dbcba3f6ea46c5b7684df3548e7ddeb9 c3bf9c73cc3f3bded74b562bfb19fb84 022f8ef4cdd93795d77d06edbb7aaf2f 58891850abbdca3d20398c276456cbc4 2158407dd074ee")))
+		})
+	})
+
 	It("seals and opens", func() {
 		connectionID := protocol.ConnectionID{0x12, 0x34, 0x56, 0x78, 0x90, 0xab, 0xcd, 0xef}
 		clientSealer, clientOpener, err := NewInitialAEAD(connectionID, protocol.PerspectiveClient)
@@ -37,10 +37,14 @@ type CryptoSetup interface {
 
 	HandleMessage([]byte, protocol.EncryptionLevel) bool
 	ConnectionState() tls.ConnectionState
+	ExportKeyingMaterial(label string, context []byte, length int) ([]byte, error)
 
 	GetSealer() (protocol.EncryptionLevel, Sealer)
 	GetSealerWithEncryptionLevel(protocol.EncryptionLevel) (Sealer, error)
 	GetOpener(protocol.EncryptionLevel) (Opener, error)
+
+	DropInitialKeys()
+	DropHandshakeKeys()
 }
 
 // ConnectionState records basic details about the QUIC connection.
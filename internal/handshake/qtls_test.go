@@ -1,6 +1,7 @@
 package handshake
 
 import (
+	"bytes"
 	"crypto/tls"
 	"errors"
 
@@ -71,6 +72,12 @@ var _ = Describe("qtls.Config generation", func() {
 		Expect(qtlsConf1.SessionTicketKey).To(Equal(qtlsConf2.SessionTicketKey))
 	})
 
+	It("sets the KeyLogWriter", func() {
+		keyLog := &bytes.Buffer{}
+		qtlsConf := tlsConfigToQtlsConfig(&tls.Config{KeyLogWriter: keyLog}, nil, &mockExtensionHandler{})
+		Expect(qtlsConf.KeyLogWriter).To(Equal(keyLog))
+	})
+
 	Context("GetConfigForClient callback", func() {
 		It("doesn't set it if absent", func() {
 			qtlsConf := tlsConfigToQtlsConfig(&tls.Config{}, nil, &mockExtensionHandler{})
@@ -72,6 +72,12 @@ var _ = Describe("Transport Parameters", func() {
 			StatelessResetToken:            &token,
 			OriginalConnectionID:           protocol.ConnectionID{0xde, 0xad, 0xbe, 0xef},
 			AckDelayExponent:               13,
+			MaxDatagramFrameSize:           protocol.ByteCount(getRandomValue()),
+			SupportsGreaseFrames:           true,
+			CustomParameters: map[uint64][]byte{
+				0x1337: []byte("foobar"),
+				0x4242: {},
+			},
 		}
 		data := params.Marshal()
 
@@ -88,6 +94,9 @@ var _ = Describe("Transport Parameters", func() {
 		Expect(p.StatelessResetToken).To(Equal(params.StatelessResetToken))
 		Expect(p.OriginalConnectionID).To(Equal(protocol.ConnectionID{0xde, 0xad, 0xbe, 0xef}))
 		Expect(p.AckDelayExponent).To(Equal(uint8(13)))
+		Expect(p.MaxDatagramFrameSize).To(Equal(params.MaxDatagramFrameSize))
+		Expect(p.SupportsGreaseFrames).To(BeTrue())
+		Expect(p.CustomParameters).To(Equal(params.CustomParameters))
 	})
 
 	It("errors if the transport parameters are too short to contain the length", func() {
@@ -148,6 +157,115 @@ var _ = Describe("Transport Parameters", func() {
 		Expect(p.AckDelayExponent).To(BeEquivalentTo(protocol.DefaultAckDelayExponent))
 	})
 
+	It("doesn't send the max_datagram_frame_size, if datagrams are not supported", func() {
+		data := (&TransportParameters{}).Marshal()
+		dataWithDatagrams := (&TransportParameters{MaxDatagramFrameSize: 1337}).Marshal()
+		Expect(len(dataWithDatagrams)).To(Equal(len(data) + 2 /* parameter ID */ + 2 /* length field */ + 2 /* value */))
+		p := &TransportParameters{}
+		Expect(p.Unmarshal(data, protocol.PerspectiveServer)).To(Succeed())
+		Expect(p.MaxDatagramFrameSize).To(BeZero())
+	})
+
+	It("errors when grease_frames has content", func() {
+		b := &bytes.Buffer{}
+		utils.BigEndian.WriteUint16(b, uint16(greaseFramesParameterID))
+		utils.BigEndian.WriteUint16(b, 1)
+		b.WriteByte(0)
+		Expect((&TransportParameters{}).Unmarshal(prependLength(b.Bytes()), protocol.PerspectiveServer)).To(MatchError("wrong length for grease_frames: 1 (expected empty)"))
+	})
+
+	It("includes the max_datagram_frame_size in the string representation", func() {
+		p := &TransportParameters{MaxDatagramFrameSize: 1337}
+		Expect(p.String()).To(ContainSubstring("MaxDatagramFrameSize: 1337}"))
+	})
+
+	Context("custom transport parameters", func() {
+		It("includes them in the string representation", func() {
+			p := &TransportParameters{CustomParameters: map[uint64][]byte{0x1337: []byte("foo")}}
+			Expect(p.String()).To(ContainSubstring("CustomParameters: map[0x1337:0x666f6f]}"))
+		})
+
+		It("marshals them in a deterministic order", func() {
+			p := &TransportParameters{CustomParameters: map[uint64][]byte{
+				0x1000: []byte("foo"),
+				0x2000: []byte("bar"),
+				0x3000: []byte("baz"),
+			}}
+			// the reserved transport parameter is sent first, and is chosen randomly
+			const reservedLen = 2 /* length */ + 2 /* parameter ID */ + 2 /* length field */ + reservedTransportParameterLen
+			data := p.Marshal()
+			for i := 0; i < 10; i++ {
+				Expect(p.Marshal()[reservedLen:]).To(Equal(data[reservedLen:]))
+			}
+			Expect(bytes.Index(data, []byte("foo"))).To(BeNumerically("<", bytes.Index(data, []byte("bar"))))
+			Expect(bytes.Index(data, []byte("bar"))).To(BeNumerically("<", bytes.Index(data, []byte("baz"))))
+		})
+
+		It("doesn't store unused registered transport parameters", func() {
+			b := &bytes.Buffer{}
+			utils.BigEndian.WriteUint16(b, uint16(preferredAddressParameterID))
+			utils.BigEndian.WriteUint16(b, 6)
+			b.Write([]byte("foobar"))
+			p := &TransportParameters{}
+			Expect(p.Unmarshal(prependLength(b.Bytes()), protocol.PerspectiveServer)).To(Succeed())
+			Expect(p.CustomParameters).To(BeEmpty())
+		})
+
+		It("errors on duplicate custom transport parameters", func() {
+			b := &bytes.Buffer{}
+			for i := 0; i < 2; i++ {
+				utils.BigEndian.WriteUint16(b, 0x1337)
+				utils.BigEndian.WriteUint16(b, 3)
+				b.Write([]byte("foo"))
+			}
+			p := &TransportParameters{}
+			Expect(p.Unmarshal(prependLength(b.Bytes()), protocol.PerspectiveServer)).To(MatchError("received duplicate transport parameter 0x1337"))
+		})
+
+		It("validates custom transport parameters", func() {
+			Expect(ValidateCustomTransportParameters(nil)).To(Succeed())
+			Expect(ValidateCustomTransportParameters(map[uint64][]byte{0x1337: []byte("foobar")})).To(Succeed())
+			Expect(ValidateCustomTransportParameters(map[uint64][]byte{0x10000: nil})).To(MatchError("invalid custom transport parameter ID 0x10000 (maximum 0xffff)"))
+			Expect(ValidateCustomTransportParameters(map[uint64][]byte{0x4: nil})).To(MatchError("custom transport parameter ID 0x4 collides with a registered transport parameter"))
+			Expect(ValidateCustomTransportParameters(map[uint64][]byte{0x20: nil})).To(MatchError("custom transport parameter ID 0x20 collides with a registered transport parameter"))
+			Expect(ValidateCustomTransportParameters(map[uint64][]byte{0x1337: make([]byte, 1<<16)})).To(MatchError("custom transport parameter 0x1337 too long: 65536 bytes"))
+			Expect(ValidateCustomTransportParameters(map[uint64][]byte{31*100 + 27: nil})).To(MatchError("custom transport parameter ID 0xc37 is reserved"))
+		})
+	})
+
+	Context("reserved transport parameters", func() {
+		It("sends a reserved transport parameter", func() {
+			ids := make(map[transportParameterID]struct{})
+			for i := 0; i < 10; i++ {
+				data := (&TransportParameters{}).Marshal()
+				r := bytes.NewReader(data[2:])
+				id, err := utils.BigEndian.ReadUint16(r)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(isReservedTransportParameter(transportParameterID(id))).To(BeTrue())
+				Expect((uint64(id) - 27) % 31).To(BeZero())
+				length, err := utils.BigEndian.ReadUint16(r)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(length).To(BeEquivalentTo(reservedTransportParameterLen))
+				ids[transportParameterID(id)] = struct{}{}
+			}
+			Expect(len(ids)).To(BeNumerically(">", 1))
+		})
+
+		It("ignores reserved transport parameters", func() {
+			b := &bytes.Buffer{}
+			utils.BigEndian.WriteUint16(b, 31*1337+27)
+			utils.BigEndian.WriteUint16(b, 6)
+			b.Write([]byte("foobar"))
+			utils.BigEndian.WriteUint16(b, uint16(initialMaxDataParameterID))
+			utils.BigEndian.WriteUint16(b, uint16(utils.VarIntLen(0x42)))
+			utils.WriteVarInt(b, 0x42)
+			p := &TransportParameters{}
+			Expect(p.Unmarshal(prependLength(b.Bytes()), protocol.PerspectiveServer)).To(Succeed())
+			Expect(p.InitialMaxData).To(Equal(protocol.ByteCount(0x42)))
+			Expect(p.CustomParameters).To(BeEmpty())
+		})
+	})
+
 	It("errors when the varint value has the wrong length", func() {
 		b := &bytes.Buffer{}
 		utils.BigEndian.WriteUint16(b, uint16(initialMaxStreamDataBidiLocalParameterID))
@@ -2,10 +2,12 @@ package handshake
 
 import (
 	"bytes"
+	"crypto/rand"
 	"encoding/binary"
 	"errors"
 	"fmt"
 	"io"
+	"math"
 	"sort"
 	"time"
 
@@ -28,8 +30,58 @@ const (
 	initialMaxStreamsUniParameterID           transportParameterID = 0x9
 	ackDelayExponentParameterID               transportParameterID = 0xa
 	disableMigrationParameterID               transportParameterID = 0xc
+	preferredAddressParameterID               transportParameterID = 0xd
+	maxDatagramFrameSizeParameterID           transportParameterID = 0x20
+	// greaseFramesParameterID is used by quic-go to signal that GREASE frames are ignored.
+	// It is not registered with IANA.
+	greaseFramesParameterID transportParameterID = 0x4752
 )
 
+// isRegisteredTransportParameter says if the transport parameter is defined by the QUIC specification,
+// or by an extension implemented by quic-go.
+func isRegisteredTransportParameter(id transportParameterID) bool {
+	return id <= preferredAddressParameterID || id == maxDatagramFrameSizeParameterID || id == greaseFramesParameterID
+}
+
+// reservedTransportParameterLen is the length of the value of the reserved transport parameter we send.
+// Using a constant length keeps the size of the transport parameters independent of the random choice.
+const reservedTransportParameterLen = 8
+
+// isReservedTransportParameter says if the transport parameter ID is reserved (31 * N + 27).
+// Reserved transport parameters are sent to exercise the peer's handling of unknown transport parameters (GREASE).
+// They don't have any meaning, and are ignored when received.
+func isReservedTransportParameter(id transportParameterID) bool {
+	return id%31 == 27
+}
+
+// generateReservedTransportParameter generates a reserved transport parameter ID and a random value
+func generateReservedTransportParameter() (transportParameterID, []byte) {
+	b := make([]byte, 2+reservedTransportParameterLen)
+	_, _ = rand.Read(b) // ignore the error here. Failure to read random data doesn't break anything
+	n := binary.BigEndian.Uint16(b[:2]) % ((math.MaxUint16-27)/31 + 1)
+	return transportParameterID(31*n + 27), b[2:]
+}
+
+// ValidateCustomTransportParameters checks that custom transport parameters can be sent.
+// Their IDs must fit into 16 bits, and must neither collide with registered nor with reserved transport parameters.
+func ValidateCustomTransportParameters(params map[uint64][]byte) error {
+	for id, val := range params {
+		if id > math.MaxUint16 {
+			return fmt.Errorf("invalid custom transport parameter ID %#x (maximum %#x)", id, math.MaxUint16)
+		}
+		if isRegisteredTransportParameter(transportParameterID(id)) {
+			return fmt.Errorf("custom transport parameter ID %#x collides with a registered transport parameter", id)
+		}
+		if isReservedTransportParameter(transportParameterID(id)) {
+			return fmt.Errorf("custom transport parameter ID %#x is reserved", id)
+		}
+		if len(val) > math.MaxUint16 {
+			return fmt.Errorf("custom transport parameter %#x too long: %d bytes", id, len(val))
+		}
+	}
+	return nil
+}
+
 // TransportParameters are parameters sent to the peer during the handshake
 type TransportParameters struct {
 	InitialMaxStreamDataBidiLocal  protocol.ByteCount
@@ -49,6 +101,17 @@ type TransportParameters struct {
 
 	StatelessResetToken  *[16]byte
 	OriginalConnectionID protocol.ConnectionID
+
+	// MaxDatagramFrameSize is the maximum size of a DATAGRAM frame that the endpoint accepts.
+	// 0 means that DATAGRAM frames are not supported.
+	MaxDatagramFrameSize protocol.ByteCount
+
+	// SupportsGreaseFrames is set if the endpoint ignores GREASE frames (see wire.GreaseFrame).
+	SupportsGreaseFrames bool
+
+	// CustomParameters are transport parameters that are not registered (see ValidateCustomTransportParameters).
+	// They are sent verbatim, and received parameters with unknown IDs are stored here.
+	CustomParameters map[uint64][]byte
 }
 
 // Unmarshal the transport parameters
@@ -83,7 +146,8 @@ func (p *TransportParameters) Unmarshal(data []byte, sentBy protocol.Perspective
 			initialMaxStreamsBidiParameterID,
 			initialMaxStreamsUniParameterID,
 			idleTimeoutParameterID,
-			maxPacketSizeParameterID:
+			maxPacketSizeParameterID,
+			maxDatagramFrameSizeParameterID:
 			if err := p.readNumericTransportParameter(r, paramID, int(paramLen)); err != nil {
 				return err
 			}
@@ -97,6 +161,11 @@ func (p *TransportParameters) Unmarshal(data []byte, sentBy protocol.Perspective
 					return fmt.Errorf("wrong length for disable_migration: %d (expected empty)", paramLen)
 				}
 				p.DisableMigration = true
+			case greaseFramesParameterID:
+				if paramLen != 0 {
+					return fmt.Errorf("wrong length for grease_frames: %d (expected empty)", paramLen)
+				}
+				p.SupportsGreaseFrames = true
 			case statelessResetTokenParameterID:
 				if sentBy == protocol.PerspectiveClient {
 					return errors.New("client sent a stateless_reset_token")
@@ -113,7 +182,16 @@ func (p *TransportParameters) Unmarshal(data []byte, sentBy protocol.Perspective
 				}
 				p.OriginalConnectionID, _ = protocol.ReadConnectionID(r, int(paramLen))
 			default:
-				r.Seek(int64(paramLen), io.SeekCurrent)
+				if isRegisteredTransportParameter(paramID) || isReservedTransportParameter(paramID) {
+					r.Seek(int64(paramLen), io.SeekCurrent)
+					break
+				}
+				if p.CustomParameters == nil {
+					p.CustomParameters = make(map[uint64][]byte)
+				}
+				val := make([]byte, paramLen)
+				r.Read(val)
+				p.CustomParameters[uint64(paramID)] = val
 			}
 		}
 	}
@@ -174,6 +252,8 @@ func (p *TransportParameters) readNumericTransportParameter(
 			return fmt.Errorf("invalid value for ack_delay_exponent: %d (maximum %d)", val, protocol.MaxAckDelayExponent)
 		}
 		p.AckDelayExponent = uint8(val)
+	case maxDatagramFrameSizeParameterID:
+		p.MaxDatagramFrameSize = protocol.ByteCount(val)
 	default:
 		return fmt.Errorf("TransportParameter BUG: transport parameter %d not found", paramID)
 	}
@@ -185,6 +265,11 @@ func (p *TransportParameters) Marshal() []byte {
 	b := &bytes.Buffer{}
 	b.Write([]byte{0, 0}) // length. Will be replaced later
 
+	// a reserved transport parameter (GREASE)
+	reservedID, reservedVal := generateReservedTransportParameter()
+	utils.BigEndian.WriteUint16(b, uint16(reservedID))
+	utils.BigEndian.WriteUint16(b, uint16(len(reservedVal)))
+	b.Write(reservedVal)
 	// initial_max_stream_data_bidi_local
 	utils.BigEndian.WriteUint16(b, uint16(initialMaxStreamDataBidiLocalParameterID))
 	utils.BigEndian.WriteUint16(b, uint16(utils.VarIntLen(uint64(p.InitialMaxStreamDataBidiLocal))))
@@ -230,6 +315,17 @@ func (p *TransportParameters) Marshal() []byte {
 		utils.BigEndian.WriteUint16(b, uint16(disableMigrationParameterID))
 		utils.BigEndian.WriteUint16(b, 0)
 	}
+	// max_datagram_frame_size
+	if p.MaxDatagramFrameSize > 0 {
+		utils.BigEndian.WriteUint16(b, uint16(maxDatagramFrameSizeParameterID))
+		utils.BigEndian.WriteUint16(b, uint16(utils.VarIntLen(uint64(p.MaxDatagramFrameSize))))
+		utils.WriteVarInt(b, uint64(p.MaxDatagramFrameSize))
+	}
+	// grease_frames
+	if p.SupportsGreaseFrames {
+		utils.BigEndian.WriteUint16(b, uint16(greaseFramesParameterID))
+		utils.BigEndian.WriteUint16(b, 0)
+	}
 	if p.StatelessResetToken != nil {
 		utils.BigEndian.WriteUint16(b, uint16(statelessResetTokenParameterID))
 		utils.BigEndian.WriteUint16(b, 16)
@@ -241,6 +337,18 @@ func (p *TransportParameters) Marshal() []byte {
 		utils.BigEndian.WriteUint16(b, uint16(p.OriginalConnectionID.Len()))
 		b.Write(p.OriginalConnectionID.Bytes())
 	}
+	// custom transport parameters, sorted by ID so that the encoding is deterministic
+	customIDs := make([]uint64, 0, len(p.CustomParameters))
+	for id := range p.CustomParameters {
+		customIDs = append(customIDs, id)
+	}
+	sort.Slice(customIDs, func(i, j int) bool { return customIDs[i] < customIDs[j] })
+	for _, id := range customIDs {
+		val := p.CustomParameters[id]
+		utils.BigEndian.WriteUint16(b, uint16(id))
+		utils.BigEndian.WriteUint16(b, uint16(len(val)))
+		b.Write(val)
+	}
 
 	data := b.Bytes()
 	binary.BigEndian.PutUint16(data[:2], uint16(b.Len()-2))
@@ -255,6 +363,17 @@ func (p *TransportParameters) String() string {
 		logString += ", StatelessResetToken: %#x"
 		logParams = append(logParams, *p.StatelessResetToken)
 	}
+	if p.MaxDatagramFrameSize > 0 {
+		logString += ", MaxDatagramFrameSize: %d"
+		logParams = append(logParams, p.MaxDatagramFrameSize)
+	}
+	if p.SupportsGreaseFrames {
+		logString += ", SupportsGreaseFrames: true"
+	}
+	if len(p.CustomParameters) > 0 {
+		logString += ", CustomParameters: %#x"
+		logParams = append(logParams, p.CustomParameters)
+	}
 	logString += "}"
 	return fmt.Sprintf(logString, logParams...)
 }
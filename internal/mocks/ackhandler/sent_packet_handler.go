@@ -10,6 +10,7 @@ import (
 
 	gomock "github.com/golang/mock/gomock"
 	ackhandler "github.com/lucas-clemente/quic-go/internal/ackhandler"
+	congestion "github.com/lucas-clemente/quic-go/internal/congestion"
 	protocol "github.com/lucas-clemente/quic-go/internal/protocol"
 	wire "github.com/lucas-clemente/quic-go/internal/wire"
 )
@@ -37,6 +38,20 @@ func (m *MockSentPacketHandler) EXPECT() *MockSentPacketHandlerMockRecorder {
 	return m.recorder
 }
 
+// DeliveryRate mocks base method
+func (m *MockSentPacketHandler) DeliveryRate() float64 {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeliveryRate")
+	ret0, _ := ret[0].(float64)
+	return ret0
+}
+
+// DeliveryRate indicates an expected call of DeliveryRate
+func (mr *MockSentPacketHandlerMockRecorder) DeliveryRate() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeliveryRate", reflect.TypeOf((*MockSentPacketHandler)(nil).DeliveryRate))
+}
+
 // DequeuePacketForRetransmission mocks base method
 func (m *MockSentPacketHandler) DequeuePacketForRetransmission() *ackhandler.Packet {
 	m.ctrl.T.Helper()
@@ -66,6 +81,18 @@ func (mr *MockSentPacketHandlerMockRecorder) DequeueProbePacket() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DequeueProbePacket", reflect.TypeOf((*MockSentPacketHandler)(nil).DequeueProbePacket))
 }
 
+// DropPackets mocks base method
+func (m *MockSentPacketHandler) DropPackets(arg0 protocol.EncryptionLevel) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "DropPackets", arg0)
+}
+
+// DropPackets indicates an expected call of DropPackets
+func (mr *MockSentPacketHandlerMockRecorder) DropPackets(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DropPackets", reflect.TypeOf((*MockSentPacketHandler)(nil).DropPackets), arg0)
+}
+
 // GetAlarmTimeout mocks base method
 func (m *MockSentPacketHandler) GetAlarmTimeout() time.Time {
 	m.ctrl.T.Helper()
@@ -80,6 +107,48 @@ func (mr *MockSentPacketHandlerMockRecorder) GetAlarmTimeout() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAlarmTimeout", reflect.TypeOf((*MockSentPacketHandler)(nil).GetAlarmTimeout))
 }
 
+// GetBytesInFlight mocks base method
+func (m *MockSentPacketHandler) GetBytesInFlight() protocol.ByteCount {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetBytesInFlight")
+	ret0, _ := ret[0].(protocol.ByteCount)
+	return ret0
+}
+
+// GetBytesInFlight indicates an expected call of GetBytesInFlight
+func (mr *MockSentPacketHandlerMockRecorder) GetBytesInFlight() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetBytesInFlight", reflect.TypeOf((*MockSentPacketHandler)(nil).GetBytesInFlight))
+}
+
+// GetCongestionState mocks base method
+func (m *MockSentPacketHandler) GetCongestionState() congestion.State {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetCongestionState")
+	ret0, _ := ret[0].(congestion.State)
+	return ret0
+}
+
+// GetCongestionState indicates an expected call of GetCongestionState
+func (mr *MockSentPacketHandlerMockRecorder) GetCongestionState() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetCongestionState", reflect.TypeOf((*MockSentPacketHandler)(nil).GetCongestionState))
+}
+
+// GetCongestionWindow mocks base method
+func (m *MockSentPacketHandler) GetCongestionWindow() protocol.ByteCount {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetCongestionWindow")
+	ret0, _ := ret[0].(protocol.ByteCount)
+	return ret0
+}
+
+// GetCongestionWindow indicates an expected call of GetCongestionWindow
+func (mr *MockSentPacketHandlerMockRecorder) GetCongestionWindow() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetCongestionWindow", reflect.TypeOf((*MockSentPacketHandler)(nil).GetCongestionWindow))
+}
+
 // GetLowestPacketNotConfirmedAcked mocks base method
 func (m *MockSentPacketHandler) GetLowestPacketNotConfirmedAcked() protocol.PacketNumber {
 	m.ctrl.T.Helper()
@@ -94,6 +163,34 @@ func (mr *MockSentPacketHandlerMockRecorder) GetLowestPacketNotConfirmedAcked()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetLowestPacketNotConfirmedAcked", reflect.TypeOf((*MockSentPacketHandler)(nil).GetLowestPacketNotConfirmedAcked))
 }
 
+// GetSlowStartThreshold mocks base method
+func (m *MockSentPacketHandler) GetSlowStartThreshold() protocol.ByteCount {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetSlowStartThreshold")
+	ret0, _ := ret[0].(protocol.ByteCount)
+	return ret0
+}
+
+// GetSlowStartThreshold indicates an expected call of GetSlowStartThreshold
+func (mr *MockSentPacketHandlerMockRecorder) GetSlowStartThreshold() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetSlowStartThreshold", reflect.TypeOf((*MockSentPacketHandler)(nil).GetSlowStartThreshold))
+}
+
+// GetStats mocks base method
+func (m *MockSentPacketHandler) GetStats() ackhandler.SentPacketStats {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetStats")
+	ret0, _ := ret[0].(ackhandler.SentPacketStats)
+	return ret0
+}
+
+// GetStats indicates an expected call of GetStats
+func (mr *MockSentPacketHandlerMockRecorder) GetStats() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetStats", reflect.TypeOf((*MockSentPacketHandler)(nil).GetStats))
+}
+
 // OnAlarm mocks base method
 func (m *MockSentPacketHandler) OnAlarm() error {
 	m.ctrl.T.Helper()
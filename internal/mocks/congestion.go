@@ -9,6 +9,7 @@ import (
 	time "time"
 
 	gomock "github.com/golang/mock/gomock"
+	congestion "github.com/lucas-clemente/quic-go/internal/congestion"
 	protocol "github.com/lucas-clemente/quic-go/internal/protocol"
 )
 
@@ -49,6 +50,20 @@ func (mr *MockSendAlgorithmMockRecorder) GetCongestionWindow() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetCongestionWindow", reflect.TypeOf((*MockSendAlgorithm)(nil).GetCongestionWindow))
 }
 
+// GetSlowStartThreshold mocks base method
+func (m *MockSendAlgorithm) GetSlowStartThreshold() protocol.ByteCount {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetSlowStartThreshold")
+	ret0, _ := ret[0].(protocol.ByteCount)
+	return ret0
+}
+
+// GetSlowStartThreshold indicates an expected call of GetSlowStartThreshold
+func (mr *MockSendAlgorithmMockRecorder) GetSlowStartThreshold() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetSlowStartThreshold", reflect.TypeOf((*MockSendAlgorithm)(nil).GetSlowStartThreshold))
+}
+
 // MaybeExitSlowStart mocks base method
 func (m *MockSendAlgorithm) MaybeExitSlowStart() {
 	m.ctrl.T.Helper()
@@ -145,6 +160,20 @@ func (mr *MockSendAlgorithmMockRecorder) SetSlowStartLargeReduction(arg0 interfa
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetSlowStartLargeReduction", reflect.TypeOf((*MockSendAlgorithm)(nil).SetSlowStartLargeReduction), arg0)
 }
 
+// State mocks base method
+func (m *MockSendAlgorithm) State() congestion.State {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "State")
+	ret0, _ := ret[0].(congestion.State)
+	return ret0
+}
+
+// State indicates an expected call of State
+func (mr *MockSendAlgorithmMockRecorder) State() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "State", reflect.TypeOf((*MockSendAlgorithm)(nil).State))
+}
+
 // TimeUntilSend mocks base method
 func (m *MockSendAlgorithm) TimeUntilSend(arg0 protocol.ByteCount) time.Duration {
 	m.ctrl.T.Helper()
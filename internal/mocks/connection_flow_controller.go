@@ -58,6 +58,20 @@ func (mr *MockConnectionFlowControllerMockRecorder) AddBytesSent(arg0 interface{
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddBytesSent", reflect.TypeOf((*MockConnectionFlowController)(nil).AddBytesSent), arg0)
 }
 
+// DonateSendCredit mocks base method
+func (m *MockConnectionFlowController) DonateSendCredit(arg0 protocol.StreamID, arg1 protocol.StreamID, arg2 protocol.ByteCount) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DonateSendCredit", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DonateSendCredit indicates an expected call of DonateSendCredit
+func (mr *MockConnectionFlowControllerMockRecorder) DonateSendCredit(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DonateSendCredit", reflect.TypeOf((*MockConnectionFlowController)(nil).DonateSendCredit), arg0, arg1, arg2)
+}
+
 // GetWindowUpdate mocks base method
 func (m *MockConnectionFlowController) GetWindowUpdate() protocol.ByteCount {
 	m.ctrl.T.Helper()
@@ -72,6 +86,20 @@ func (mr *MockConnectionFlowControllerMockRecorder) GetWindowUpdate() *gomock.Ca
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetWindowUpdate", reflect.TypeOf((*MockConnectionFlowController)(nil).GetWindowUpdate))
 }
 
+// GrantedSendCredit mocks base method
+func (m *MockConnectionFlowController) GrantedSendCredit(arg0 protocol.StreamID) protocol.ByteCount {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GrantedSendCredit", arg0)
+	ret0, _ := ret[0].(protocol.ByteCount)
+	return ret0
+}
+
+// GrantedSendCredit indicates an expected call of GrantedSendCredit
+func (mr *MockConnectionFlowControllerMockRecorder) GrantedSendCredit(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GrantedSendCredit", reflect.TypeOf((*MockConnectionFlowController)(nil).GrantedSendCredit), arg0)
+}
+
 // IsNewlyBlocked mocks base method
 func (m *MockConnectionFlowController) IsNewlyBlocked() (bool, protocol.ByteCount) {
 	m.ctrl.T.Helper()
@@ -87,6 +115,18 @@ func (mr *MockConnectionFlowControllerMockRecorder) IsNewlyBlocked() *gomock.Cal
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "IsNewlyBlocked", reflect.TypeOf((*MockConnectionFlowController)(nil).IsNewlyBlocked))
 }
 
+// ReleaseSendCredit mocks base method
+func (m *MockConnectionFlowController) ReleaseSendCredit(arg0 protocol.StreamID) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "ReleaseSendCredit", arg0)
+}
+
+// ReleaseSendCredit indicates an expected call of ReleaseSendCredit
+func (mr *MockConnectionFlowControllerMockRecorder) ReleaseSendCredit(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReleaseSendCredit", reflect.TypeOf((*MockConnectionFlowController)(nil).ReleaseSendCredit), arg0)
+}
+
 // SendWindowSize mocks base method
 func (m *MockConnectionFlowController) SendWindowSize() protocol.ByteCount {
 	m.ctrl.T.Helper()
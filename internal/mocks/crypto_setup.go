@@ -78,6 +78,45 @@ func (mr *MockCryptoSetupMockRecorder) ConnectionState() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ConnectionState", reflect.TypeOf((*MockCryptoSetup)(nil).ConnectionState))
 }
 
+// DropHandshakeKeys mocks base method
+func (m *MockCryptoSetup) DropHandshakeKeys() {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "DropHandshakeKeys")
+}
+
+// DropHandshakeKeys indicates an expected call of DropHandshakeKeys
+func (mr *MockCryptoSetupMockRecorder) DropHandshakeKeys() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DropHandshakeKeys", reflect.TypeOf((*MockCryptoSetup)(nil).DropHandshakeKeys))
+}
+
+// DropInitialKeys mocks base method
+func (m *MockCryptoSetup) DropInitialKeys() {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "DropInitialKeys")
+}
+
+// DropInitialKeys indicates an expected call of DropInitialKeys
+func (mr *MockCryptoSetupMockRecorder) DropInitialKeys() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DropInitialKeys", reflect.TypeOf((*MockCryptoSetup)(nil).DropInitialKeys))
+}
+
+// ExportKeyingMaterial mocks base method
+func (m *MockCryptoSetup) ExportKeyingMaterial(arg0 string, arg1 []byte, arg2 int) ([]byte, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ExportKeyingMaterial", arg0, arg1, arg2)
+	ret0, _ := ret[0].([]byte)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ExportKeyingMaterial indicates an expected call of ExportKeyingMaterial
+func (mr *MockCryptoSetupMockRecorder) ExportKeyingMaterial(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ExportKeyingMaterial", reflect.TypeOf((*MockCryptoSetup)(nil).ExportKeyingMaterial), arg0, arg1, arg2)
+}
+
 // GetOpener mocks base method
 func (m *MockCryptoSetup) GetOpener(arg0 protocol.EncryptionLevel) (handshake.Opener, error) {
 	m.ctrl.T.Helper()
@@ -7,8 +7,10 @@ package mockquic
 import (
 	context "context"
 	tls "crypto/tls"
+	x509 "crypto/x509"
 	net "net"
 	reflect "reflect"
+	time "time"
 
 	gomock "github.com/golang/mock/gomock"
 	quic_go "github.com/lucas-clemente/quic-go"
@@ -96,6 +98,20 @@ func (mr *MockSessionMockRecorder) CloseWithError(arg0, arg1 interface{}) *gomoc
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CloseWithError", reflect.TypeOf((*MockSession)(nil).CloseWithError), arg0, arg1)
 }
 
+// ConnectionID mocks base method
+func (m *MockSession) ConnectionID() string {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ConnectionID")
+	ret0, _ := ret[0].(string)
+	return ret0
+}
+
+// ConnectionID indicates an expected call of ConnectionID
+func (mr *MockSessionMockRecorder) ConnectionID() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ConnectionID", reflect.TypeOf((*MockSession)(nil).ConnectionID))
+}
+
 // ConnectionState mocks base method
 func (m *MockSession) ConnectionState() tls.ConnectionState {
 	m.ctrl.T.Helper()
@@ -110,6 +126,20 @@ func (mr *MockSessionMockRecorder) ConnectionState() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ConnectionState", reflect.TypeOf((*MockSession)(nil).ConnectionState))
 }
 
+// ConnectionStats mocks base method
+func (m *MockSession) ConnectionStats() quic_go.ConnectionStats {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ConnectionStats")
+	ret0, _ := ret[0].(quic_go.ConnectionStats)
+	return ret0
+}
+
+// ConnectionStats indicates an expected call of ConnectionStats
+func (mr *MockSessionMockRecorder) ConnectionStats() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ConnectionStats", reflect.TypeOf((*MockSession)(nil).ConnectionStats))
+}
+
 // Context mocks base method
 func (m *MockSession) Context() context.Context {
 	m.ctrl.T.Helper()
@@ -124,6 +154,35 @@ func (mr *MockSessionMockRecorder) Context() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Context", reflect.TypeOf((*MockSession)(nil).Context))
 }
 
+// DonateStreamSendCredit mocks base method
+func (m *MockSession) DonateStreamSendCredit(arg0 protocol.StreamID, arg1 protocol.StreamID, arg2 protocol.ByteCount) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DonateStreamSendCredit", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DonateStreamSendCredit indicates an expected call of DonateStreamSendCredit
+func (mr *MockSessionMockRecorder) DonateStreamSendCredit(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DonateStreamSendCredit", reflect.TypeOf((*MockSession)(nil).DonateStreamSendCredit), arg0, arg1, arg2)
+}
+
+// ExportKeyingMaterial mocks base method
+func (m *MockSession) ExportKeyingMaterial(arg0 string, arg1 []byte, arg2 int) ([]byte, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ExportKeyingMaterial", arg0, arg1, arg2)
+	ret0, _ := ret[0].([]byte)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ExportKeyingMaterial indicates an expected call of ExportKeyingMaterial
+func (mr *MockSessionMockRecorder) ExportKeyingMaterial(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ExportKeyingMaterial", reflect.TypeOf((*MockSession)(nil).ExportKeyingMaterial), arg0, arg1, arg2)
+}
+
 // LocalAddr mocks base method
 func (m *MockSession) LocalAddr() net.Addr {
 	m.ctrl.T.Helper()
@@ -198,6 +257,92 @@ func (mr *MockSessionMockRecorder) OpenUniStreamSync() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "OpenUniStreamSync", reflect.TypeOf((*MockSession)(nil).OpenUniStreamSync))
 }
 
+// OriginalDestConnectionID mocks base method
+func (m *MockSession) OriginalDestConnectionID() string {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "OriginalDestConnectionID")
+	ret0, _ := ret[0].(string)
+	return ret0
+}
+
+// OriginalDestConnectionID indicates an expected call of OriginalDestConnectionID
+func (mr *MockSessionMockRecorder) OriginalDestConnectionID() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "OriginalDestConnectionID", reflect.TypeOf((*MockSession)(nil).OriginalDestConnectionID))
+}
+
+// PeerCertificates mocks base method
+func (m *MockSession) PeerCertificates() []*x509.Certificate {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PeerCertificates")
+	ret0, _ := ret[0].([]*x509.Certificate)
+	return ret0
+}
+
+// PeerCertificates indicates an expected call of PeerCertificates
+func (mr *MockSessionMockRecorder) PeerCertificates() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PeerCertificates", reflect.TypeOf((*MockSession)(nil).PeerCertificates))
+}
+
+// PeerCommonName mocks base method
+func (m *MockSession) PeerCommonName() string {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PeerCommonName")
+	ret0, _ := ret[0].(string)
+	return ret0
+}
+
+// PeerCommonName indicates an expected call of PeerCommonName
+func (mr *MockSessionMockRecorder) PeerCommonName() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PeerCommonName", reflect.TypeOf((*MockSession)(nil).PeerCommonName))
+}
+
+// PeerTransportParameters mocks base method
+func (m *MockSession) PeerTransportParameters() map[uint64][]byte {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PeerTransportParameters")
+	ret0, _ := ret[0].(map[uint64][]byte)
+	return ret0
+}
+
+// PeerTransportParameters indicates an expected call of PeerTransportParameters
+func (mr *MockSessionMockRecorder) PeerTransportParameters() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PeerTransportParameters", reflect.TypeOf((*MockSession)(nil).PeerTransportParameters))
+}
+
+// PingRoundTrip mocks base method
+func (m *MockSession) PingRoundTrip(arg0 context.Context) (time.Duration, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PingRoundTrip", arg0)
+	ret0, _ := ret[0].(time.Duration)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// PingRoundTrip indicates an expected call of PingRoundTrip
+func (mr *MockSessionMockRecorder) PingRoundTrip(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PingRoundTrip", reflect.TypeOf((*MockSession)(nil).PingRoundTrip), arg0)
+}
+
+// ReceiveUnreliable mocks base method
+func (m *MockSession) ReceiveUnreliable(arg0 context.Context) ([]byte, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReceiveUnreliable", arg0)
+	ret0, _ := ret[0].([]byte)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ReceiveUnreliable indicates an expected call of ReceiveUnreliable
+func (mr *MockSessionMockRecorder) ReceiveUnreliable(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReceiveUnreliable", reflect.TypeOf((*MockSession)(nil).ReceiveUnreliable), arg0)
+}
+
 // RemoteAddr mocks base method
 func (m *MockSession) RemoteAddr() net.Addr {
 	m.ctrl.T.Helper()
@@ -211,3 +356,59 @@ func (mr *MockSessionMockRecorder) RemoteAddr() *gomock.Call {
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RemoteAddr", reflect.TypeOf((*MockSession)(nil).RemoteAddr))
 }
+
+// SendCustomFrame mocks base method
+func (m *MockSession) SendCustomFrame(arg0 quic_go.CustomFrame) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SendCustomFrame", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SendCustomFrame indicates an expected call of SendCustomFrame
+func (mr *MockSessionMockRecorder) SendCustomFrame(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SendCustomFrame", reflect.TypeOf((*MockSession)(nil).SendCustomFrame), arg0)
+}
+
+// SendPing mocks base method
+func (m *MockSession) SendPing() error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SendPing")
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SendPing indicates an expected call of SendPing
+func (mr *MockSessionMockRecorder) SendPing() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SendPing", reflect.TypeOf((*MockSession)(nil).SendPing))
+}
+
+// SendUnreliable mocks base method
+func (m *MockSession) SendUnreliable(arg0 []byte) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SendUnreliable", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SendUnreliable indicates an expected call of SendUnreliable
+func (mr *MockSessionMockRecorder) SendUnreliable(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SendUnreliable", reflect.TypeOf((*MockSession)(nil).SendUnreliable), arg0)
+}
+
+// VerifiedChains mocks base method
+func (m *MockSession) VerifiedChains() [][]*x509.Certificate {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "VerifiedChains")
+	ret0, _ := ret[0].([][]*x509.Certificate)
+	return ret0
+}
+
+// VerifiedChains indicates an expected call of VerifiedChains
+func (mr *MockSessionMockRecorder) VerifiedChains() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "VerifiedChains", reflect.TypeOf((*MockSession)(nil).VerifiedChains))
+}
@@ -74,6 +74,20 @@ func (mr *MockStreamMockRecorder) Close() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Close", reflect.TypeOf((*MockStream)(nil).Close))
 }
 
+// CloseWrite mocks base method
+func (m *MockStream) CloseWrite() error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CloseWrite")
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CloseWrite indicates an expected call of CloseWrite
+func (mr *MockStreamMockRecorder) CloseWrite() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CloseWrite", reflect.TypeOf((*MockStream)(nil).CloseWrite))
+}
+
 // Context mocks base method
 func (m *MockStream) Context() context.Context {
 	m.ctrl.T.Helper()
@@ -88,6 +102,20 @@ func (mr *MockStreamMockRecorder) Context() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Context", reflect.TypeOf((*MockStream)(nil).Context))
 }
 
+// GrantedCredit mocks base method
+func (m *MockStream) GrantedCredit() protocol.ByteCount {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GrantedCredit")
+	ret0, _ := ret[0].(protocol.ByteCount)
+	return ret0
+}
+
+// GrantedCredit indicates an expected call of GrantedCredit
+func (mr *MockStreamMockRecorder) GrantedCredit() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GrantedCredit", reflect.TypeOf((*MockStream)(nil).GrantedCredit))
+}
+
 // Read mocks base method
 func (m *MockStream) Read(arg0 []byte) (int, error) {
 	m.ctrl.T.Helper()
@@ -103,6 +131,35 @@ func (mr *MockStreamMockRecorder) Read(arg0 interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Read", reflect.TypeOf((*MockStream)(nil).Read), arg0)
 }
 
+// ReadAvailable mocks base method
+func (m *MockStream) ReadAvailable() int {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReadAvailable")
+	ret0, _ := ret[0].(int)
+	return ret0
+}
+
+// ReadAvailable indicates an expected call of ReadAvailable
+func (mr *MockStreamMockRecorder) ReadAvailable() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReadAvailable", reflect.TypeOf((*MockStream)(nil).ReadAvailable))
+}
+
+// ReorderStats mocks base method
+func (m *MockStream) ReorderStats() (protocol.ByteCount, uint64) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReorderStats")
+	ret0, _ := ret[0].(protocol.ByteCount)
+	ret1, _ := ret[1].(uint64)
+	return ret0, ret1
+}
+
+// ReorderStats indicates an expected call of ReorderStats
+func (mr *MockStreamMockRecorder) ReorderStats() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReorderStats", reflect.TypeOf((*MockStream)(nil).ReorderStats))
+}
+
 // SetDeadline mocks base method
 func (m *MockStream) SetDeadline(arg0 time.Time) error {
 	m.ctrl.T.Helper()
@@ -117,6 +174,18 @@ func (mr *MockStreamMockRecorder) SetDeadline(arg0 interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetDeadline", reflect.TypeOf((*MockStream)(nil).SetDeadline), arg0)
 }
 
+// SetPriority mocks base method
+func (m *MockStream) SetPriority(arg0 uint8, arg1 bool) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "SetPriority", arg0, arg1)
+}
+
+// SetPriority indicates an expected call of SetPriority
+func (mr *MockStreamMockRecorder) SetPriority(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetPriority", reflect.TypeOf((*MockStream)(nil).SetPriority), arg0, arg1)
+}
+
 // SetReadDeadline mocks base method
 func (m *MockStream) SetReadDeadline(arg0 time.Time) error {
 	m.ctrl.T.Helper()
@@ -131,6 +200,18 @@ func (mr *MockStreamMockRecorder) SetReadDeadline(arg0 interface{}) *gomock.Call
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetReadDeadline", reflect.TypeOf((*MockStream)(nil).SetReadDeadline), arg0)
 }
 
+// SetReadNotifyThreshold mocks base method
+func (m *MockStream) SetReadNotifyThreshold(arg0 int) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "SetReadNotifyThreshold", arg0)
+}
+
+// SetReadNotifyThreshold indicates an expected call of SetReadNotifyThreshold
+func (mr *MockStreamMockRecorder) SetReadNotifyThreshold(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetReadNotifyThreshold", reflect.TypeOf((*MockStream)(nil).SetReadNotifyThreshold), arg0)
+}
+
 // SetWriteDeadline mocks base method
 func (m *MockStream) SetWriteDeadline(arg0 time.Time) error {
 	m.ctrl.T.Helper()
@@ -159,6 +240,20 @@ func (mr *MockStreamMockRecorder) StreamID() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "StreamID", reflect.TypeOf((*MockStream)(nil).StreamID))
 }
 
+// WaitForPeerFIN mocks base method
+func (m *MockStream) WaitForPeerFIN(arg0 context.Context) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "WaitForPeerFIN", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// WaitForPeerFIN indicates an expected call of WaitForPeerFIN
+func (mr *MockStreamMockRecorder) WaitForPeerFIN(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "WaitForPeerFIN", reflect.TypeOf((*MockStream)(nil).WaitForPeerFIN), arg0)
+}
+
 // Write mocks base method
 func (m *MockStream) Write(arg0 []byte) (int, error) {
 	m.ctrl.T.Helper()
@@ -71,17 +71,31 @@ func (mr *MockStreamFlowControllerMockRecorder) AddBytesSent(arg0 interface{}) *
 }
 
 // GetWindowUpdate mocks base method
-func (m *MockStreamFlowController) GetWindowUpdate() protocol.ByteCount {
+func (m *MockStreamFlowController) GetWindowUpdate(arg0 protocol.ByteCount) protocol.ByteCount {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetWindowUpdate")
+	ret := m.ctrl.Call(m, "GetWindowUpdate", arg0)
 	ret0, _ := ret[0].(protocol.ByteCount)
 	return ret0
 }
 
 // GetWindowUpdate indicates an expected call of GetWindowUpdate
-func (mr *MockStreamFlowControllerMockRecorder) GetWindowUpdate() *gomock.Call {
+func (mr *MockStreamFlowControllerMockRecorder) GetWindowUpdate(arg0 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetWindowUpdate", reflect.TypeOf((*MockStreamFlowController)(nil).GetWindowUpdate))
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetWindowUpdate", reflect.TypeOf((*MockStreamFlowController)(nil).GetWindowUpdate), arg0)
+}
+
+// GrantedSendCredit mocks base method
+func (m *MockStreamFlowController) GrantedSendCredit() protocol.ByteCount {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GrantedSendCredit")
+	ret0, _ := ret[0].(protocol.ByteCount)
+	return ret0
+}
+
+// GrantedSendCredit indicates an expected call of GrantedSendCredit
+func (mr *MockStreamFlowControllerMockRecorder) GrantedSendCredit() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GrantedSendCredit", reflect.TypeOf((*MockStreamFlowController)(nil).GrantedSendCredit))
 }
 
 // IsNewlyBlocked mocks base method
@@ -127,6 +141,18 @@ func (mr *MockStreamFlowControllerMockRecorder) UpdateHighestReceived(arg0, arg1
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateHighestReceived", reflect.TypeOf((*MockStreamFlowController)(nil).UpdateHighestReceived), arg0, arg1)
 }
 
+// UpdateReorderDepth mocks base method
+func (m *MockStreamFlowController) UpdateReorderDepth(arg0 protocol.ByteCount) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "UpdateReorderDepth", arg0)
+}
+
+// UpdateReorderDepth indicates an expected call of UpdateReorderDepth
+func (mr *MockStreamFlowControllerMockRecorder) UpdateReorderDepth(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateReorderDepth", reflect.TypeOf((*MockStreamFlowController)(nil).UpdateReorderDepth), arg0)
+}
+
 // UpdateSendWindow mocks base method
 func (m *MockStreamFlowController) UpdateSendWindow(arg0 protocol.ByteCount) {
 	m.ctrl.T.Helper()
@@ -14,6 +14,11 @@ var _ = Describe("packet number calculation", func() {
 		Expect(DecodePacketNumber(PacketNumberLen2, 0xa82f30ea, 0x9b32)).To(Equal(PacketNumber(0xa82f9b32)))
 	})
 
+	It("works with the encoding examples from RFC 9000", func() {
+		Expect(GetPacketNumberLengthForHeader(0xac5c02, 0xabe8b3)).To(Equal(PacketNumberLen2))
+		Expect(GetPacketNumberLengthForHeader(0xace8fe, 0xabe8b3)).To(Equal(PacketNumberLen3))
+	})
+
 	getEpoch := func(len PacketNumberLen) uint64 {
 		if len > 4 {
 			Fail("invalid packet number len")
@@ -38,12 +38,26 @@ const DefaultMaxReceiveConnectionFlowControlWindow = 15 * (1 << 20) // 12 MB
 // WindowUpdateThreshold is the fraction of the receive window that has to be consumed before an higher offset is advertised to the client
 const WindowUpdateThreshold = 0.25
 
+// DefaultUDPBufferSize is the size that quic-go tries to set the UDP receive and send buffers to
+const DefaultUDPBufferSize = 2 * (1 << 20) // 2 MB
+
 // DefaultMaxIncomingStreams is the maximum number of streams that a peer may open
 const DefaultMaxIncomingStreams = 100
 
 // DefaultMaxIncomingUniStreams is the maximum number of unidirectional streams that a peer may open
 const DefaultMaxIncomingUniStreams = 100
 
+// DefaultMaxBurstPackets is the maximum number of packets that are sent in a single burst
+const DefaultMaxBurstPackets = 10
+
+// DecryptErrorWarningThreshold is the number of packets failing to decrypt within the DecryptErrorWarningInterval
+// that causes a warning to be logged.
+const DecryptErrorWarningThreshold = 10
+
+// DecryptErrorWarningInterval is the interval in which packets failing to decrypt are counted.
+// At most one warning is logged per interval.
+const DecryptErrorWarningInterval = 10 * time.Second
+
 // MaxSessionUnprocessedPackets is the max number of packets stored in each session that are not yet processed.
 const MaxSessionUnprocessedPackets = defaultMaxCongestionWindowPackets
 
@@ -53,12 +67,38 @@ const SkipPacketAveragePeriodLength PacketNumber = 500
 // MaxTrackedSkippedPackets is the maximum number of skipped packet numbers the SentPacketHandler keep track of for Optimistic ACK attack mitigation
 const MaxTrackedSkippedPackets = 10
 
-// MaxAcceptQueueSize is the maximum number of sessions that the server queues for accepting.
+// DefaultAcceptQueueLength is the default maximum number of sessions that the server queues for accepting.
 // If the queue is full, new connection attempts will be rejected.
-const MaxAcceptQueueSize = 32
+const DefaultAcceptQueueLength = 32
+
+// DefaultRetryTokenValidity is the default time that a token issued in a Retry packet is valid
+const DefaultRetryTokenValidity = 30 * time.Second
+
+// DefaultNewTokenValidity is the default time that a token issued in a NEW_TOKEN frame is valid
+const DefaultNewTokenValidity = 24 * time.Hour
+
+// MaxTokenClockSkew is the time that an address validation token may appear to be issued in the future.
+// This allows for adjustments of the server's clock.
+const MaxTokenClockSkew = 10 * time.Second
+
+// RetryInitialRateWindow is the window over which the rate of Initial packets without a valid token is measured,
+// when the server sends Retries depending on the load
+const RetryInitialRateWindow = time.Second
+
+// MinRetryModeDuration is the minimum time the server stays in Retry mode,
+// when the server sends Retries depending on the load
+const MinRetryModeDuration = 5 * time.Second
+
+// DefaultMaxInitialsPerIPPerInterval is the default number of Initial packets that the server processes
+// from a single IP address per InitialsPerIPInterval
+const DefaultMaxInitialsPerIPPerInterval = 100
+
+// InitialsPerIPInterval is the interval over which the number of Initial packets received from a single IP address is counted
+const InitialsPerIPInterval = 100 * time.Millisecond
 
-// CookieExpiryTime is the valid time of a cookie
-const CookieExpiryTime = 24 * time.Hour
+// MaxTrackedLostPackets is the maximum number of packet numbers of lost packets the SentPacketHandler keeps track of,
+// in order to detect spurious losses
+const MaxTrackedLostPackets = 256
 
 // MaxOutstandingSentPackets is maximum number of packets saved for retransmission.
 // When reached, it imposes a soft limit on sending new packets:
@@ -77,6 +117,11 @@ const MaxTrackedReceivedAckRanges = defaultMaxCongestionWindowPackets
 // but no ack-eliciting frames, that we send in a row
 const MaxNonAckElicitingAcks = 19
 
+// GreaseFrameInterval determines how often GREASE frames are sent (if enabled):
+// On average, every GreaseFrameInterval-th 1-RTT packet contains a GREASE frame.
+// It must be a power of 2, and smaller than 256.
+const GreaseFrameInterval = 8
+
 // MaxStreamFrameSorterGaps is the maximum number of gaps between received StreamFrames
 // prevents DoS attacks against the streamFrameSorter
 const MaxStreamFrameSorterGaps = 1000
@@ -94,6 +139,13 @@ const DefaultIdleTimeout = 30 * time.Second
 // DefaultHandshakeTimeout is the default timeout for a connection until the crypto handshake succeeds.
 const DefaultHandshakeTimeout = 10 * time.Second
 
+// DefaultIdleTimeoutMultiplier is the default factor by which the smoothed RTT is multiplied to obtain the minimum idle timeout.
+const DefaultIdleTimeoutMultiplier = 30
+
+// DefaultHappyEyeballsDelay is the default time the client waits for a response from the preferred address family,
+// before starting a connection attempt using the other address family.
+const DefaultHappyEyeballsDelay = 250 * time.Millisecond
+
 // RetiredConnectionIDDeleteTimeout is the time we keep closed sessions around in order to retransmit the CONNECTION_CLOSE.
 // after this time all information about the old connection will be deleted
 const RetiredConnectionIDDeleteTimeout = 5 * time.Second
@@ -104,6 +156,25 @@ const RetiredConnectionIDDeleteTimeout = 5 * time.Second
 // 2. it reduces the head-of-line blocking, when a packet is lost
 const MinStreamFrameSize ByteCount = 128
 
+// DefaultStreamUrgency is the urgency of a stream, if no priority was set (see RFC 9218).
+const DefaultStreamUrgency = 3
+
+// MaxStreamUrgency is the largest urgency value. It is the lowest priority.
+const MaxStreamUrgency = 7
+
+// MaxStreamSendBufferSize is the maximum number of bytes that a send stream buffers.
+// Writes that fit into the send buffer return immediately,
+// and consecutive writes are sent in a single STREAM frame.
+const MaxStreamSendBufferSize ByteCount = 16 * (1 << 10) // 16 KB
+
+// MinStreamSendBufferReservation is the number of bytes that a stream with an empty send buffer can always buffer,
+// even if the connection-level limit of buffered bytes was reached.
+// This guarantees that every stream can make progress.
+const MinStreamSendBufferReservation ByteCount = MaxPacketSizeIPv4
+
+// DefaultMaxConnectionSendBufferSize is the default maximum number of bytes buffered in the send buffers of all streams of a connection
+const DefaultMaxConnectionSendBufferSize = 4 * (1 << 20) // 4 MB
+
 // MaxPostHandshakeCryptoFrameSize is the maximum size of CRYPTO frames
 // we send after the handshake completes.
 const MaxPostHandshakeCryptoFrameSize ByteCount = 1000
@@ -114,6 +185,14 @@ const MaxPostHandshakeCryptoFrameSize ByteCount = 1000
 // but must ensure that a maximum size ACK frame fits into one packet.
 const MaxAckFrameSize ByteCount = 1000
 
+// MaxDatagramSendQueueLen is the maximum number of DATAGRAM frames that are queued for sending.
+// DATAGRAM frames are unreliable, so SendUnreliable returns an error instead of blocking when the queue is full.
+const MaxDatagramSendQueueLen = 32
+
+// MaxDatagramRcvQueueLen is the maximum number of received DATAGRAM frames that are queued until the application reads them.
+// If the queue is full, newly received DATAGRAM frames are dropped.
+const MaxDatagramRcvQueueLen = 128
+
 // MinPacingDelay is the minimum duration that is used for packet pacing
 // If the packet packing frequency is higher, multiple packets might be sent at once.
 // Example: For a packet pacing delay of 20 microseconds, we would send 5 packets at once, wait for 100 microseconds, and so forth.
@@ -58,12 +58,33 @@ const DefaultTCPMSS ByteCount = 1460
 // MinInitialPacketSize is the minimum size an Initial packet is required to have.
 const MinInitialPacketSize = 1200
 
+// MaxDatagramFrameSize is the maximum size of a DATAGRAM frame that we accept.
+// It is sent in the max_datagram_frame_size transport parameter.
+// A DATAGRAM frame can't be split across packets, so there's no point in accepting larger frames.
+const MaxDatagramFrameSize ByteCount = MaxReceivePacketSize
+
+// MaxDatagramSendFrameSize is the maximum size of a DATAGRAM frame that we send.
+// Like MaxCustomFrameSize, it leaves enough space for the packet header and other frames,
+// such that a DATAGRAM frame always fits into a 1-RTT packet.
+const MaxDatagramSendFrameSize ByteCount = 1000
+
+// MaxCustomFrameSize is the maximum size of a frame of a QUIC extension implemented by the application.
+// It leaves enough space for the packet header and other frames (e.g. an ACK frame),
+// such that a custom frame always fits into a 1-RTT packet.
+const MaxCustomFrameSize ByteCount = 1000
+
 // MinStatelessResetSize is the minimum size of a stateless reset packet
 const MinStatelessResetSize = 1 /* first byte */ + 22 /* random bytes */ + 16 /* token */
 
 // MinConnectionIDLenInitial is the minimum length of the destination connection ID on an Initial packet.
 const MinConnectionIDLenInitial = 8
 
+// MinConnectionIDLen is the minimum length of a non-empty connection ID.
+const MinConnectionIDLen = 4
+
+// MaxConnectionIDLen is the maximum length of a connection ID.
+const MaxConnectionIDLen = 18
+
 // MaxStreamCount is the maximum stream count value that can be sent in MAX_STREAMS frames
 // and as the stream count in the transport parameters
 const MaxStreamCount = 1 << 60
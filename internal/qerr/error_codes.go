@@ -25,11 +25,23 @@ const (
 	InvalidMigration        ErrorCode = 0xc
 )
 
+// NoApplicationProtocol is the CRYPTO_ERROR for the TLS no_application_protocol alert.
+// It is used when the client and the server don't support a common application protocol (ALPN).
+const NoApplicationProtocol ErrorCode = 0x100 + 120
+
+// CertificateRequired is the CRYPTO_ERROR for the TLS certificate_required alert.
+// It is used when the server requires a client certificate, but the client didn't send one.
+const CertificateRequired ErrorCode = 0x100 + 116
+
 func (e ErrorCode) isCryptoError() bool {
 	return e >= 0x100 && e < 0x200
 }
 
 func (e ErrorCode) Error() string {
+	if e == CertificateRequired {
+		// The certificate_required alert was introduced in TLS 1.3, and qtls doesn't have a name for it.
+		return fmt.Sprintf("%s: tls: certificate required", e.String())
+	}
 	if e.isCryptoError() {
 		return fmt.Sprintf("%s: %s", e.String(), qtls.Alert(e-0x100).Error())
 	}
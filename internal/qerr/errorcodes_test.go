@@ -34,6 +34,14 @@ var _ = Describe("error codes", func() {
 		}
 	})
 
+	It("has a string representation for the no_application_protocol error", func() {
+		Expect(NoApplicationProtocol.Error()).To(Equal("CRYPTO_ERROR: tls: no application protocol"))
+	})
+
+	It("has a string representation for the certificate_required error", func() {
+		Expect(CertificateRequired.Error()).To(Equal("CRYPTO_ERROR: tls: certificate required"))
+	})
+
 	It("has a string representation for unknown error codes", func() {
 		Expect(ErrorCode(0x1337).String()).To(Equal("unknown error code: 0x1337"))
 	})
@@ -7,7 +7,10 @@ import (
 
 // A QuicError consists of an error code plus a error reason
 type QuicError struct {
-	ErrorCode    ErrorCode
+	ErrorCode ErrorCode
+	// FrameType is the type of the frame that triggered the error, if any.
+	// It is sent in the Frame Type field of the CONNECTION_CLOSE frame.
+	FrameType    uint64
 	ErrorMessage string
 	isTimeout    bool
 }
@@ -22,6 +25,15 @@ func Error(errorCode ErrorCode, errorMessage string) *QuicError {
 	}
 }
 
+// ErrorWithFrameType creates a new QuicError instance for an error triggered by a frame of type frameType
+func ErrorWithFrameType(errorCode ErrorCode, frameType uint64, errorMessage string) *QuicError {
+	return &QuicError{
+		ErrorCode:    errorCode,
+		FrameType:    frameType,
+		ErrorMessage: errorMessage,
+	}
+}
+
 // TimeoutError creates a new QuicError instance for a timeout error
 func TimeoutError(errorMessage string) *QuicError {
 	return &QuicError{
@@ -19,6 +19,12 @@ var _ = Describe("QUIC Transport Errors", func() {
 		Expect(err.Error()).To(Equal("FLOW_CONTROL_ERROR"))
 	})
 
+	It("stores the frame type", func() {
+		err := ErrorWithFrameType(FrameEncodingError, 0x1337, "foobar")
+		Expect(err.FrameType).To(Equal(uint64(0x1337)))
+		Expect(err.Error()).To(Equal("FRAME_ENCODING_ERROR: foobar"))
+	})
+
 	It("has a string representation for timeout errors", func() {
 		err := TimeoutError("foobar")
 		Expect(err.Timeout()).To(BeTrue())
@@ -6,6 +6,8 @@ import (
 	"os"
 	"strings"
 	"time"
+
+	"github.com/lucas-clemente/quic-go/internal/protocol"
 )
 
 // LogLevel of quic-go
@@ -22,6 +24,21 @@ const (
 	LogLevelDebug
 )
 
+func (l LogLevel) String() string {
+	switch l {
+	case LogLevelNothing:
+		return "nothing"
+	case LogLevelError:
+		return "error"
+	case LogLevelInfo:
+		return "info"
+	case LogLevelDebug:
+		return "debug"
+	default:
+		return "unknown log level"
+	}
+}
+
 const logEnv = "QUIC_GO_LOG_LEVEL"
 
 // A Logger logs.
@@ -29,6 +46,9 @@ type Logger interface {
 	SetLogLevel(LogLevel)
 	SetLogTimeFormat(format string)
 	WithPrefix(prefix string) Logger
+	// WithConnection returns a Logger that attaches the connection ID and the perspective,
+	// as well as the additional key value pairs, to every message.
+	WithConnection(pers protocol.Perspective, connID protocol.ConnectionID, keyvals ...interface{}) Logger
 	Debug() bool
 
 	Errorf(format string, args ...interface{})
@@ -104,6 +124,24 @@ func (l *defaultLogger) WithPrefix(prefix string) Logger {
 	}
 }
 
+// WithConnection adds the connection ID and the key value pairs to the prefix.
+// The perspective is omitted, since it is already contained in the prefix
+// of the loggers used by the client and the server.
+func (l *defaultLogger) WithConnection(_ protocol.Perspective, connID protocol.ConnectionID, keyvals ...interface{}) Logger {
+	prefix := "conn=" + formatLogValue(connID)
+	for i := 0; i+1 < len(keyvals); i += 2 {
+		prefix += fmt.Sprintf(" %v=%s", keyvals[i], formatLogValue(keyvals[i+1]))
+	}
+	return l.WithPrefix(prefix)
+}
+
+func formatLogValue(v interface{}) string {
+	if connID, ok := v.(protocol.ConnectionID); ok {
+		return fmt.Sprintf("%x", []byte(connID))
+	}
+	return fmt.Sprint(v)
+}
+
 // Debug returns true if the log level is LogLevelDebug
 func (l *defaultLogger) Debug() bool {
 	return l.logLevel == LogLevelDebug
@@ -6,6 +6,8 @@ import (
 	"os"
 	"time"
 
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 )
@@ -30,6 +32,14 @@ var _ = Describe("Log", func() {
 		Expect(LogLevelDebug).To(BeEquivalentTo(3))
 	})
 
+	It("has a string representation for the log levels", func() {
+		Expect(LogLevelNothing.String()).To(Equal("nothing"))
+		Expect(LogLevelError.String()).To(Equal("error"))
+		Expect(LogLevelInfo.String()).To(Equal("info"))
+		Expect(LogLevelDebug.String()).To(Equal("debug"))
+		Expect(LogLevel(42).String()).To(Equal("unknown log level"))
+	})
+
 	It("log level nothing", func() {
 		DefaultLogger.SetLogLevel(LogLevelNothing)
 		DefaultLogger.Debugf("debug")
@@ -108,6 +118,18 @@ var _ = Describe("Log", func() {
 		Expect(b.String()).To(ContainSubstring("debug"))
 	})
 
+	It("adds the connection ID and key value pairs to the prefix", func() {
+		DefaultLogger.SetLogLevel(LogLevelDebug)
+		connLogger := DefaultLogger.WithPrefix("server").WithConnection(
+			protocol.PerspectiveServer,
+			protocol.ConnectionID{0xde, 0xad, 0xbe, 0xef},
+			"odcid", protocol.ConnectionID{0x13, 0x37},
+			"foo", 42,
+		)
+		connLogger.Debugf("debug")
+		Expect(b.String()).To(ContainSubstring("server conn=deadbeef odcid=1337 foo=42 debug\n"))
+	})
+
 	Context("reading from env", func() {
 		BeforeEach(func() {
 			Expect(DefaultLogger.(*defaultLogger).logLevel).To(Equal(LogLevelNothing))
@@ -0,0 +1,95 @@
+package utils
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+)
+
+// A LogSink receives structured log messages.
+// It has the same methods as the quic.Logger.
+type LogSink interface {
+	Enabled(level LogLevel, connID protocol.ConnectionID) bool
+	Log(level LogLevel, msg string, keyvals ...interface{})
+}
+
+type structuredLogger struct {
+	sink LogSink
+
+	connID  protocol.ConnectionID
+	keyvals []interface{}
+}
+
+var _ Logger = &structuredLogger{}
+
+// NewStructuredLogger creates a Logger that passes all messages to a LogSink.
+// The prefix and the connection are passed as key value pairs.
+func NewStructuredLogger(sink LogSink) Logger {
+	return &structuredLogger{sink: sink}
+}
+
+// SetLogLevel does nothing. The LogSink decides which messages are logged.
+func (l *structuredLogger) SetLogLevel(LogLevel) {}
+
+// SetLogTimeFormat does nothing. The LogSink decides how timestamps are formatted.
+func (l *structuredLogger) SetLogTimeFormat(string) {}
+
+// WithPrefix adds the prefix as the value of the "logger" key.
+// If a prefix is already set, the prefixes are joined by a space.
+func (l *structuredLogger) WithPrefix(prefix string) Logger {
+	keyvals := make([]interface{}, 0, len(l.keyvals)+2)
+	for i := 0; i+1 < len(l.keyvals); i += 2 {
+		if l.keyvals[i] == "logger" {
+			prefix = fmt.Sprintf("%v %s", l.keyvals[i+1], prefix)
+			continue
+		}
+		keyvals = append(keyvals, l.keyvals[i], l.keyvals[i+1])
+	}
+	return &structuredLogger{
+		sink:    l.sink,
+		connID:  l.connID,
+		keyvals: append([]interface{}{"logger", prefix}, keyvals...),
+	}
+}
+
+// WithConnection adds the perspective and the connection ID as the values of the "perspective" and "conn" key.
+// The connection ID is also passed to LogSink.Enabled.
+func (l *structuredLogger) WithConnection(pers protocol.Perspective, connID protocol.ConnectionID, keyvals ...interface{}) Logger {
+	kv := make([]interface{}, 0, len(l.keyvals)+4+len(keyvals))
+	kv = append(kv, l.keyvals...)
+	kv = append(kv, "perspective", strings.ToLower(pers.String()), "conn", connID)
+	kv = append(kv, keyvals...)
+	return &structuredLogger{
+		sink:    l.sink,
+		connID:  connID,
+		keyvals: kv,
+	}
+}
+
+// Debug returns true if debug messages are logged
+func (l *structuredLogger) Debug() bool {
+	return l.sink.Enabled(LogLevelDebug, l.connID)
+}
+
+// Errorf logs something
+func (l *structuredLogger) Errorf(format string, args ...interface{}) {
+	l.log(LogLevelError, format, args...)
+}
+
+// Infof logs something
+func (l *structuredLogger) Infof(format string, args ...interface{}) {
+	l.log(LogLevelInfo, format, args...)
+}
+
+// Debugf logs something
+func (l *structuredLogger) Debugf(format string, args ...interface{}) {
+	l.log(LogLevelDebug, format, args...)
+}
+
+func (l *structuredLogger) log(level LogLevel, format string, args ...interface{}) {
+	if !l.sink.Enabled(level, l.connID) {
+		return
+	}
+	l.sink.Log(level, fmt.Sprintf(format, args...), l.keyvals...)
+}
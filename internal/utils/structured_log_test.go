@@ -0,0 +1,101 @@
+package utils
+
+import (
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type logMessage struct {
+	level   LogLevel
+	msg     string
+	keyvals []interface{}
+}
+
+type mockLogSink struct {
+	level      LogLevel
+	connLevels map[string]LogLevel
+	messages   []logMessage
+}
+
+var _ LogSink = &mockLogSink{}
+
+func (s *mockLogSink) Enabled(level LogLevel, connID protocol.ConnectionID) bool {
+	if l, ok := s.connLevels[string(connID)]; ok {
+		return level <= l
+	}
+	return level <= s.level
+}
+
+func (s *mockLogSink) Log(level LogLevel, msg string, keyvals ...interface{}) {
+	s.messages = append(s.messages, logMessage{level: level, msg: msg, keyvals: keyvals})
+}
+
+var _ = Describe("Structured Logger", func() {
+	var sink *mockLogSink
+
+	BeforeEach(func() {
+		sink = &mockLogSink{connLevels: make(map[string]LogLevel)}
+	})
+
+	It("logs messages that are enabled", func() {
+		sink.level = LogLevelInfo
+		logger := NewStructuredLogger(sink)
+		logger.Debugf("debug %d", 1)
+		logger.Infof("info %d", 2)
+		logger.Errorf("error %d", 3)
+		Expect(sink.messages).To(Equal([]logMessage{
+			{level: LogLevelInfo, msg: "info 2"},
+			{level: LogLevelError, msg: "error 3"},
+		}))
+		Expect(logger.Debug()).To(BeFalse())
+		sink.level = LogLevelDebug
+		Expect(logger.Debug()).To(BeTrue())
+	})
+
+	It("doesn't change the log level", func() {
+		logger := NewStructuredLogger(sink)
+		logger.SetLogLevel(LogLevelDebug)
+		logger.Errorf("error")
+		Expect(sink.messages).To(BeEmpty())
+	})
+
+	It("adds prefixes", func() {
+		sink.level = LogLevelDebug
+		NewStructuredLogger(sink).WithPrefix("foo").WithPrefix("bar").Debugf("debug")
+		Expect(sink.messages).To(HaveLen(1))
+		Expect(sink.messages[0].keyvals).To(Equal([]interface{}{"logger", "foo bar"}))
+	})
+
+	It("adds the connection", func() {
+		sink.level = LogLevelDebug
+		connID := protocol.ConnectionID{0xde, 0xad, 0xbe, 0xef}
+		odcid := protocol.ConnectionID{0x13, 0x37}
+		logger := NewStructuredLogger(sink).WithPrefix("server").WithConnection(protocol.PerspectiveServer, connID, "odcid", odcid)
+		logger.Infof("info")
+		Expect(sink.messages).To(HaveLen(1))
+		Expect(sink.messages[0].keyvals).To(Equal([]interface{}{
+			"logger", "server",
+			"perspective", "server",
+			"conn", connID,
+			"odcid", odcid,
+		}))
+	})
+
+	It("uses the log level of the connection", func() {
+		connID := protocol.ConnectionID{0xde, 0xad, 0xbe, 0xef}
+		sink.connLevels[string(connID)] = LogLevelDebug
+		logger := NewStructuredLogger(sink).WithPrefix("server")
+		connLogger := logger.WithConnection(protocol.PerspectiveServer, connID)
+		otherConnLogger := logger.WithConnection(protocol.PerspectiveServer, protocol.ConnectionID{1, 2, 3, 4})
+		Expect(logger.Debug()).To(BeFalse())
+		Expect(otherConnLogger.Debug()).To(BeFalse())
+		Expect(connLogger.Debug()).To(BeTrue())
+		logger.Debugf("server")
+		otherConnLogger.Debugf("other connection")
+		connLogger.Debugf("connection")
+		Expect(sink.messages).To(HaveLen(1))
+		Expect(sink.messages[0].msg).To(Equal("connection"))
+	})
+})
@@ -2,6 +2,7 @@ package wire
 
 import (
 	"bytes"
+	"fmt"
 	"io"
 	"time"
 
@@ -161,6 +162,9 @@ var _ = Describe("ACK Frame (for IETF QUIC)", func() {
 				Expect(frame.LargestAcked()).To(Equal(protocol.PacketNumber(100)))
 				Expect(frame.LowestAcked()).To(Equal(protocol.PacketNumber(90)))
 				Expect(frame.HasMissingRanges()).To(BeFalse())
+				Expect(frame.ECT0).To(BeEquivalentTo(0x42))
+				Expect(frame.ECT1).To(BeEquivalentTo(0x12345))
+				Expect(frame.ECNCE).To(BeEquivalentTo(0x12345678))
 				Expect(b.Len()).To(BeZero())
 			})
 
@@ -183,6 +187,54 @@ var _ = Describe("ACK Frame (for IETF QUIC)", func() {
 				}
 			})
 
+			It("errors when a count is truncated in the middle of the varint", func() {
+				data := []byte{0x3}
+				data = append(data, encodeVarInt(100)...)    // largest acked
+				data = append(data, encodeVarInt(0)...)      // delay
+				data = append(data, encodeVarInt(0)...)      // num blocks
+				data = append(data, encodeVarInt(10)...)     // first ack block
+				data = append(data, encodeVarInt(0x42)...)   // ECT(0)
+				data = append(data, encodeVarInt(0x1337)...) // ECT(1)
+				data = append(data, encodeVarInt(1<<40)...)  // ECN-CE
+				Expect(encodeVarInt(1 << 40)).To(HaveLen(8)) // make sure that the varint is 8 bytes long
+				_, err := parseAckFrame(bytes.NewReader(data[:len(data)-4]), protocol.AckDelayExponent, versionIETFFrames)
+				Expect(err).To(MatchError(io.EOF))
+			})
+
+			It("parses an ACK_ECN frame with zero counts", func() {
+				data := []byte{0x3}
+				data = append(data, encodeVarInt(100)...) // largest acked
+				data = append(data, encodeVarInt(0)...)   // delay
+				data = append(data, encodeVarInt(0)...)   // num blocks
+				data = append(data, encodeVarInt(10)...)  // first ack block
+				data = append(data, []byte{0, 0, 0}...)   // ECN counts
+				b := bytes.NewReader(data)
+				frame, err := parseAckFrame(b, protocol.AckDelayExponent, versionIETFFrames)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(frame.HasECNCounts()).To(BeFalse())
+				Expect(b.Len()).To(BeZero())
+			})
+
+			for _, c := range []uint64{63, 64, 16383, 16384, 1<<30 - 1, 1 << 30, 1<<62 - 1} {
+				count := c
+
+				It(fmt.Sprintf("writes and parses counts at the varint boundaries: %d", count), func() {
+					f := &AckFrame{
+						AckRanges: []AckRange{{Smallest: 10, Largest: 100}},
+						ECT0:      count,
+						ECT1:      count - 1,
+						ECNCE:     count,
+					}
+					buf := &bytes.Buffer{}
+					Expect(f.Write(buf, versionIETFFrames)).To(Succeed())
+					Expect(f.Length(versionIETFFrames)).To(BeEquivalentTo(buf.Len()))
+					b := bytes.NewReader(buf.Bytes())
+					frame, err := parseAckFrame(b, protocol.AckDelayExponent, versionIETFFrames)
+					Expect(err).ToNot(HaveOccurred())
+					Expect(frame).To(Equal(f))
+					Expect(b.Len()).To(BeZero())
+				})
+			}
 		})
 	})
 
@@ -220,6 +272,24 @@ var _ = Describe("ACK Frame (for IETF QUIC)", func() {
 			Expect(b.Len()).To(BeZero())
 		})
 
+		It("writes a frame with ECN counts", func() {
+			buf := &bytes.Buffer{}
+			f := &AckFrame{
+				AckRanges: []AckRange{{Smallest: 10, Largest: 2000}},
+				ECT0:      13,
+				ECT1:      37,
+				ECNCE:     12345,
+			}
+			Expect(f.Write(buf, versionIETFFrames)).To(Succeed())
+			Expect(f.Length(versionIETFFrames)).To(BeEquivalentTo(buf.Len()))
+			Expect(buf.Bytes()[0]).To(BeEquivalentTo(0x3))
+			b := bytes.NewReader(buf.Bytes())
+			frame, err := parseAckFrame(b, protocol.AckDelayExponent, versionIETFFrames)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(frame).To(Equal(f))
+			Expect(b.Len()).To(BeZero())
+		})
+
 		It("writes a frame that acks many packets", func() {
 			buf := &bytes.Buffer{}
 			f := &AckFrame{
@@ -300,6 +370,30 @@ var _ = Describe("ACK Frame (for IETF QUIC)", func() {
 			Expect(b.Len()).To(BeZero())
 			Expect(len(frame.AckRanges)).To(BeNumerically("<", numRanges)) // make sure we dropped some ranges
 		})
+
+		It("limits the maximum size of the ACK frame, taking into account the ECN counts", func() {
+			buf := &bytes.Buffer{}
+			const numRanges = 1000
+			ackRanges := make([]AckRange, numRanges)
+			for i := protocol.PacketNumber(1); i <= numRanges; i++ {
+				ackRanges[numRanges-i] = AckRange{Smallest: 2 * i, Largest: 2 * i}
+			}
+			f := &AckFrame{
+				AckRanges: ackRanges,
+				ECT0:      1 << 40,
+				ECT1:      1 << 40,
+				ECNCE:     1 << 40,
+			}
+			Expect(f.Write(buf, versionIETFFrames)).To(Succeed())
+			Expect(f.Length(versionIETFFrames)).To(BeEquivalentTo(buf.Len()))
+			Expect(buf.Len()).To(BeNumerically(">", protocol.MaxAckFrameSize-5))
+			Expect(buf.Len()).To(BeNumerically("<=", protocol.MaxAckFrameSize))
+			b := bytes.NewReader(buf.Bytes())
+			frame, err := parseAckFrame(b, protocol.AckDelayExponent, versionIETFFrames)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(frame.ECNCE).To(BeEquivalentTo(1 << 40))
+			Expect(b.Len()).To(BeZero())
+		})
 	})
 
 	Context("ACK range validator", func() {
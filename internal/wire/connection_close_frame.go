@@ -13,7 +13,10 @@ import (
 type ConnectionCloseFrame struct {
 	IsApplicationError bool
 	ErrorCode          qerr.ErrorCode
-	ReasonPhrase       string
+	// FrameType is the type of the frame that triggered the error.
+	// It is only sent for transport errors.
+	FrameType    uint64
+	ReasonPhrase string
 }
 
 func parseConnectionCloseFrame(r *bytes.Reader, version protocol.VersionNumber) (*ConnectionCloseFrame, error) {
@@ -30,9 +33,11 @@ func parseConnectionCloseFrame(r *bytes.Reader, version protocol.VersionNumber)
 	f.ErrorCode = qerr.ErrorCode(ec)
 	// read the Frame Type, if this is not an application error
 	if !f.IsApplicationError {
-		if _, err := utils.ReadVarInt(r); err != nil {
+		ft, err := utils.ReadVarInt(r)
+		if err != nil {
 			return nil, err
 		}
+		f.FrameType = ft
 	}
 	var reasonPhraseLen uint64
 	reasonPhraseLen, err = utils.ReadVarInt(r)
@@ -59,7 +64,7 @@ func parseConnectionCloseFrame(r *bytes.Reader, version protocol.VersionNumber)
 func (f *ConnectionCloseFrame) Length(version protocol.VersionNumber) protocol.ByteCount {
 	length := 1 + 2 + utils.VarIntLen(uint64(len(f.ReasonPhrase))) + protocol.ByteCount(len(f.ReasonPhrase))
 	if !f.IsApplicationError {
-		length++ // for the frame type
+		length += utils.VarIntLen(f.FrameType)
 	}
 	return length
 }
@@ -73,7 +78,7 @@ func (f *ConnectionCloseFrame) Write(b *bytes.Buffer, version protocol.VersionNu
 
 	utils.BigEndian.WriteUint16(b, uint16(f.ErrorCode))
 	if !f.IsApplicationError {
-		utils.WriteVarInt(b, 0)
+		utils.WriteVarInt(b, f.FrameType)
 	}
 	utils.WriteVarInt(b, uint64(len(f.ReasonPhrase)))
 	b.WriteString(f.ReasonPhrase)
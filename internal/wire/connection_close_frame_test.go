@@ -24,6 +24,7 @@ var _ = Describe("CONNECTION_CLOSE Frame", func() {
 			Expect(err).ToNot(HaveOccurred())
 			Expect(frame.IsApplicationError).To(BeFalse())
 			Expect(frame.ErrorCode).To(Equal(qerr.ErrorCode(0x19)))
+			Expect(frame.FrameType).To(Equal(uint64(0x1337)))
 			Expect(frame.ReasonPhrase).To(Equal(reason))
 			Expect(b.Len()).To(BeZero())
 		})
@@ -106,6 +107,20 @@ var _ = Describe("CONNECTION_CLOSE Frame", func() {
 			Expect(b.Bytes()).To(Equal(expected))
 		})
 
+		It("writes a frame with a frame type", func() {
+			b := &bytes.Buffer{}
+			frame := &ConnectionCloseFrame{
+				ErrorCode: 0xdead,
+				FrameType: 0x1337,
+			}
+			Expect(frame.Write(b, versionIETFFrames)).To(Succeed())
+			expected := []byte{0x1c, 0xde, 0xad}
+			expected = append(expected, encodeVarInt(0x1337)...) // frame type
+			expected = append(expected, encodeVarInt(0)...)      // reason phrase length
+			Expect(b.Bytes()).To(Equal(expected))
+			Expect(frame.Length(versionIETFFrames)).To(Equal(protocol.ByteCount(b.Len())))
+		})
+
 		It("writes a frame with an application error code", func() {
 			b := &bytes.Buffer{}
 			frame := &ConnectionCloseFrame{
@@ -0,0 +1,74 @@
+package wire
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+	"github.com/lucas-clemente/quic-go/internal/utils"
+)
+
+// An ExtensionFrame is a frame of a QUIC extension that is implemented outside of quic-go.
+// It is serialized and parsed by the application, quic-go only handles the frame type.
+type ExtensionFrame interface {
+	// FrameType is the type of the frame.
+	FrameType() uint64
+	// Write writes the frame, without the frame type.
+	Write(b *bytes.Buffer) error
+	// Length is the length of the frame, without the frame type.
+	Length() protocol.ByteCount
+}
+
+// An ExtensionFrameDecoder parses an ExtensionFrame.
+// data is the rest of the packet payload following the frame type.
+// The Length of the returned frame is the number of bytes consumed.
+type ExtensionFrameDecoder func(data []byte) (ExtensionFrame, error)
+
+// A CustomFrame carries an ExtensionFrame
+type CustomFrame struct {
+	Frame ExtensionFrame
+}
+
+// IsExtensionFrameType says if a frame type can be used by an extension,
+// i.e. if it is not parsed by quic-go, and not reserved for GREASE frames.
+func IsExtensionFrameType(t uint64) bool {
+	if t <= 0x1d || t == 0x30 || t == 0x31 {
+		return false
+	}
+	return !isGreaseFrameType(t)
+}
+
+func parseCustomFrame(r *bytes.Reader, decode ExtensionFrameDecoder) (*CustomFrame, error) {
+	data := make([]byte, r.Len())
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, err
+	}
+	frame, err := decode(data)
+	if err != nil {
+		return nil, err
+	}
+	if frame == nil {
+		return nil, errors.New("no frame decoded")
+	}
+	length := frame.Length()
+	if length > protocol.ByteCount(len(data)) {
+		return nil, fmt.Errorf("frame length (%d) exceeds the remaining packet payload (%d)", length, len(data))
+	}
+	// rewind the reader to the end of the frame
+	if _, err := r.Seek(int64(length)-int64(len(data)), io.SeekCurrent); err != nil {
+		return nil, err
+	}
+	return &CustomFrame{Frame: frame}, nil
+}
+
+func (f *CustomFrame) Write(b *bytes.Buffer, _ protocol.VersionNumber) error {
+	utils.WriteVarInt(b, f.Frame.FrameType())
+	return f.Frame.Write(b)
+}
+
+// Length of a written frame
+func (f *CustomFrame) Length(_ protocol.VersionNumber) protocol.ByteCount {
+	return utils.VarIntLen(f.Frame.FrameType()) + f.Frame.Length()
+}
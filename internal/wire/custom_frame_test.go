@@ -0,0 +1,163 @@
+package wire
+
+import (
+	"bytes"
+	"errors"
+
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+	"github.com/lucas-clemente/quic-go/internal/qerr"
+	"github.com/lucas-clemente/quic-go/internal/utils"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// testExtensionFrame is a frame that contains a length-prefixed payload
+type testExtensionFrame struct {
+	frameType uint64
+	data      []byte
+}
+
+func (f *testExtensionFrame) FrameType() uint64 { return f.frameType }
+
+func (f *testExtensionFrame) Write(b *bytes.Buffer) error {
+	utils.WriteVarInt(b, uint64(len(f.data)))
+	b.Write(f.data)
+	return nil
+}
+
+func (f *testExtensionFrame) Length() protocol.ByteCount {
+	return utils.VarIntLen(uint64(len(f.data))) + protocol.ByteCount(len(f.data))
+}
+
+func decodeTestExtensionFrame(frameType uint64) ExtensionFrameDecoder {
+	return func(data []byte) (ExtensionFrame, error) {
+		r := bytes.NewReader(data)
+		l, err := utils.ReadVarInt(r)
+		if err != nil {
+			return nil, err
+		}
+		if l > uint64(r.Len()) {
+			return nil, errors.New("data too short")
+		}
+		f := &testExtensionFrame{frameType: frameType, data: make([]byte, l)}
+		r.Read(f.data)
+		return f, nil
+	}
+}
+
+var _ = Describe("Custom frames", func() {
+	It("writes a frame", func() {
+		f := &CustomFrame{Frame: &testExtensionFrame{frameType: 0x42, data: []byte("foobar")}}
+		b := &bytes.Buffer{}
+		Expect(f.Write(b, versionIETFFrames)).To(Succeed())
+		Expect(b.Bytes()).To(Equal(append([]byte{0x40, 0x42, 0x6}, []byte("foobar")...)))
+		Expect(f.Length(versionIETFFrames)).To(BeEquivalentTo(b.Len()))
+	})
+
+	It("says which frame types can be used by extensions", func() {
+		for _, t := range []uint64{0x0, 0x1, 0x8, 0x1d, 0x30, 0x31, 0x1f + 0x1b} {
+			Expect(IsExtensionFrameType(t)).To(BeFalse())
+		}
+		for _, t := range []uint64{0x1e, 0x20, 0x32, 0xaf, 0x1337} {
+			Expect(IsExtensionFrameType(t)).To(BeTrue())
+		}
+	})
+
+	Context("parsing", func() {
+		var parser FrameParser
+
+		BeforeEach(func() {
+			parser = NewFrameParser(
+				false,
+				false,
+				map[uint64]ExtensionFrameDecoder{
+					0x20:   decodeTestExtensionFrame(0x20),
+					0x1337: decodeTestExtensionFrame(0x1337),
+				},
+				protocol.PerspectiveClient,
+				versionIETFFrames,
+			)
+		})
+
+		It("parses frames of registered types", func() {
+			b := &bytes.Buffer{}
+			Expect((&CustomFrame{Frame: &testExtensionFrame{frameType: 0x20, data: []byte("foo")}}).Write(b, versionIETFFrames)).To(Succeed())
+			Expect((&CustomFrame{Frame: &testExtensionFrame{frameType: 0x1337, data: []byte("bar")}}).Write(b, versionIETFFrames)).To(Succeed())
+			Expect((&PingFrame{}).Write(b, versionIETFFrames)).To(Succeed())
+			r := bytes.NewReader(b.Bytes())
+			frame, err := parser.ParseNext(r, protocol.Encryption1RTT)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(frame).To(Equal(&CustomFrame{Frame: &testExtensionFrame{frameType: 0x20, data: []byte("foo")}}))
+			frame, err = parser.ParseNext(r, protocol.Encryption1RTT)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(frame).To(Equal(&CustomFrame{Frame: &testExtensionFrame{frameType: 0x1337, data: []byte("bar")}}))
+			frame, err = parser.ParseNext(r, protocol.Encryption1RTT)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(frame).To(Equal(&PingFrame{}))
+			Expect(r.Len()).To(BeZero())
+		})
+
+		It("errors on frames of types that are not registered", func() {
+			_, err := parser.ParseNext(bytes.NewReader([]byte{0x21, 0x0}), protocol.Encryption1RTT)
+			Expect(err).To(HaveOccurred())
+			qErr := err.(*qerr.QuicError)
+			Expect(qErr.ErrorCode).To(Equal(qerr.FrameEncodingError))
+			Expect(qErr.FrameType).To(BeEquivalentTo(0x21))
+		})
+
+		It("errors when the decoder fails", func() {
+			_, err := parser.ParseNext(bytes.NewReader([]byte{0x20, 0x5, 'f', 'o', 'o'}), protocol.Encryption1RTT)
+			Expect(err).To(HaveOccurred())
+			qErr := err.(*qerr.QuicError)
+			Expect(qErr.ErrorCode).To(Equal(qerr.FrameEncodingError))
+			Expect(qErr.FrameType).To(BeEquivalentTo(0x20))
+			Expect(qErr.ErrorMessage).To(Equal("data too short"))
+		})
+
+		It("errors when the decoded frame is longer than the remaining payload", func() {
+			parser = NewFrameParser(
+				false,
+				false,
+				map[uint64]ExtensionFrameDecoder{
+					0x20: func([]byte) (ExtensionFrame, error) {
+						return &testExtensionFrame{frameType: 0x20, data: []byte("foobar")}, nil
+					},
+				},
+				protocol.PerspectiveClient,
+				versionIETFFrames,
+			)
+			_, err := parser.ParseNext(bytes.NewReader([]byte{0x20, 0x1, 'f'}), protocol.Encryption1RTT)
+			Expect(err).To(HaveOccurred())
+			qErr := err.(*qerr.QuicError)
+			Expect(qErr.ErrorCode).To(Equal(qerr.FrameEncodingError))
+			Expect(qErr.FrameType).To(BeEquivalentTo(0x20))
+			Expect(qErr.ErrorMessage).To(Equal("frame length (7) exceeds the remaining packet payload (2)"))
+		})
+
+		It("rejects custom frames in Handshake packets", func() {
+			_, err := parser.ParseNext(bytes.NewReader([]byte{0x20, 0x0}), protocol.EncryptionHandshake)
+			Expect(err).To(HaveOccurred())
+			qErr := err.(*qerr.QuicError)
+			Expect(qErr.ErrorCode).To(Equal(qerr.ProtocolViolation))
+			Expect(qErr.FrameType).To(BeEquivalentTo(0x20))
+		})
+
+		It("doesn't call the decoder for frames that are not allowed", func() {
+			parser = NewFrameParser(
+				false,
+				false,
+				map[uint64]ExtensionFrameDecoder{
+					0x20: func([]byte) (ExtensionFrame, error) {
+						Fail("didn't expect the decoder to be called")
+						return nil, nil
+					},
+				},
+				protocol.PerspectiveClient,
+				versionIETFFrames,
+			)
+			_, err := parser.ParseNext(bytes.NewReader([]byte{0x20, 0x3, 'f', 'o', 'o'}), protocol.EncryptionInitial)
+			Expect(err).To(HaveOccurred())
+			Expect(err.(*qerr.QuicError).ErrorCode).To(Equal(qerr.ProtocolViolation))
+		})
+	})
+})
@@ -6,21 +6,46 @@ import (
 
 	"github.com/lucas-clemente/quic-go/internal/protocol"
 	"github.com/lucas-clemente/quic-go/internal/qerr"
+	"github.com/lucas-clemente/quic-go/internal/utils"
 )
 
 type frameParser struct {
 	ackDelayExponent uint8
 
-	version protocol.VersionNumber
+	supportsDatagrams    bool
+	supportsGreaseFrames bool
+	customFrameTypes     map[uint64]ExtensionFrameDecoder
+
+	perspective protocol.Perspective
+	version     protocol.VersionNumber
 }
 
 // NewFrameParser creates a new frame parser.
-func NewFrameParser(v protocol.VersionNumber) FrameParser {
-	return &frameParser{version: v}
+// DATAGRAM frames are only accepted if supportsDatagrams is set,
+// i.e. if we advertised the max_datagram_frame_size transport parameter.
+// GREASE frames are only skipped if supportsGreaseFrames is set, i.e. if we advertised the grease_frames transport parameter.
+// Frames of the types in customFrameTypes are parsed using the respective decoder.
+// The perspective is the perspective of the endpoint receiving the frames.
+func NewFrameParser(
+	supportsDatagrams bool,
+	supportsGreaseFrames bool,
+	customFrameTypes map[uint64]ExtensionFrameDecoder,
+	pers protocol.Perspective,
+	v protocol.VersionNumber,
+) FrameParser {
+	return &frameParser{
+		supportsDatagrams:    supportsDatagrams,
+		supportsGreaseFrames: supportsGreaseFrames,
+		customFrameTypes:     customFrameTypes,
+		perspective:          pers,
+		version:              v,
+	}
 }
 
 // ParseNextFrame parses the next frame
-// It skips PADDING frames.
+// It skips PADDING frames, and GREASE frames in 1-RTT packets (if enabled).
+// Frames that are not allowed at the encryption level, or that the peer isn't allowed to send, are rejected.
+// Unknown frame types are a FRAME_ENCODING_ERROR. The error contains the frame type and its offset in the payload.
 func (p *frameParser) ParseNext(r *bytes.Reader, encLevel protocol.EncryptionLevel) (Frame, error) {
 	for r.Len() != 0 {
 		typeByte, _ := r.ReadByte()
@@ -28,6 +53,14 @@ func (p *frameParser) ParseNext(r *bytes.Reader, encLevel protocol.EncryptionLev
 			continue
 		}
 		r.UnreadByte()
+		// GREASE frames are only sent in 1-RTT packets. At other encryption levels,
+		// and if GREASE frames are not enabled, they are treated like any other unknown frame type.
+		// All frame types defined so far are encoded in a single byte, and are smaller than 0x40.
+		// Only check for GREASE frames if the type byte doesn't belong to one of them.
+		if p.supportsGreaseFrames && encLevel == protocol.Encryption1RTT &&
+			(typeByte >= 0x40 || isGreaseFrameType(uint64(typeByte))) && skipGreaseFrame(r) {
+			continue
+		}
 
 		return p.parseFrame(r, typeByte, encLevel)
 	}
@@ -39,59 +72,109 @@ func (p *frameParser) parseFrame(r *bytes.Reader, typeByte byte, encLevel protoc
 	var err error
 	if typeByte&0xf8 == 0x8 {
 		frame, err = parseStreamFrame(r, p.version)
-		if err != nil {
-			return nil, qerr.Error(qerr.FrameEncodingError, err.Error())
+	} else {
+		switch typeByte {
+		case 0x1:
+			frame, err = parsePingFrame(r, p.version)
+		case 0x2, 0x3:
+			ackDelayExponent := p.ackDelayExponent
+			if encLevel != protocol.Encryption1RTT {
+				ackDelayExponent = protocol.DefaultAckDelayExponent
+			}
+			frame, err = parseAckFrame(r, ackDelayExponent, p.version)
+		case 0x4:
+			frame, err = parseResetStreamFrame(r, p.version)
+		case 0x5:
+			frame, err = parseStopSendingFrame(r, p.version)
+		case 0x6:
+			frame, err = parseCryptoFrame(r, p.version)
+		case 0x7:
+			frame, err = parseNewTokenFrame(r, p.version)
+		case 0x10:
+			frame, err = parseMaxDataFrame(r, p.version)
+		case 0x11:
+			frame, err = parseMaxStreamDataFrame(r, p.version)
+		case 0x12, 0x13:
+			frame, err = parseMaxStreamsFrame(r, p.version)
+		case 0x14:
+			frame, err = parseDataBlockedFrame(r, p.version)
+		case 0x15:
+			frame, err = parseStreamDataBlockedFrame(r, p.version)
+		case 0x16, 0x17:
+			frame, err = parseStreamsBlockedFrame(r, p.version)
+		case 0x18:
+			frame, err = parseNewConnectionIDFrame(r, p.version)
+		case 0x19:
+			frame, err = parseRetireConnectionIDFrame(r, p.version)
+		case 0x1a:
+			frame, err = parsePathChallengeFrame(r, p.version)
+		case 0x1b:
+			frame, err = parsePathResponseFrame(r, p.version)
+		case 0x1c, 0x1d:
+			frame, err = parseConnectionCloseFrame(r, p.version)
+		case 0x30, 0x31:
+			if !p.supportsDatagrams {
+				return nil, qerr.ErrorWithFrameType(qerr.ProtocolViolation, uint64(typeByte), "received DATAGRAM frame, but datagrams were not enabled")
+			}
+			frame, err = parseDatagramFrame(r, p.version)
+		default:
+			// The frame type might be encoded in multiple bytes.
+			// Report the offset of the frame in the packet payload, to make it easier to debug broken peers.
+			offset := r.Size() - int64(r.Len())
+			frameType := uint64(typeByte)
+			if ft, err := utils.ReadVarInt(r); err == nil {
+				frameType = ft
+				if decode, ok := p.customFrameTypes[frameType]; ok {
+					return p.parseCustomFrame(r, frameType, decode, encLevel)
+				}
+			}
+			return nil, qerr.ErrorWithFrameType(qerr.FrameEncodingError, frameType, fmt.Sprintf("unknown frame type 0x%x at offset %d", frameType, offset))
 		}
-		return frame, nil
 	}
-	switch typeByte {
-	case 0x1:
-		frame, err = parsePingFrame(r, p.version)
-	case 0x2, 0x3:
-		ackDelayExponent := p.ackDelayExponent
-		if encLevel != protocol.Encryption1RTT {
-			ackDelayExponent = protocol.DefaultAckDelayExponent
+	if err != nil {
+		if qErr, ok := err.(*qerr.QuicError); ok {
+			return nil, qerr.ErrorWithFrameType(qErr.ErrorCode, uint64(typeByte), qErr.ErrorMessage)
 		}
-		frame, err = parseAckFrame(r, ackDelayExponent, p.version)
-	case 0x4:
-		frame, err = parseResetStreamFrame(r, p.version)
-	case 0x5:
-		frame, err = parseStopSendingFrame(r, p.version)
-	case 0x6:
-		frame, err = parseCryptoFrame(r, p.version)
-	case 0x7:
-		frame, err = parseNewTokenFrame(r, p.version)
-	case 0x10:
-		frame, err = parseMaxDataFrame(r, p.version)
-	case 0x11:
-		frame, err = parseMaxStreamDataFrame(r, p.version)
-	case 0x12, 0x13:
-		frame, err = parseMaxStreamsFrame(r, p.version)
-	case 0x14:
-		frame, err = parseDataBlockedFrame(r, p.version)
-	case 0x15:
-		frame, err = parseStreamDataBlockedFrame(r, p.version)
-	case 0x16, 0x17:
-		frame, err = parseStreamsBlockedFrame(r, p.version)
-	case 0x18:
-		frame, err = parseNewConnectionIDFrame(r, p.version)
-	case 0x19:
-		frame, err = parseRetireConnectionIDFrame(r, p.version)
-	case 0x1a:
-		frame, err = parsePathChallengeFrame(r, p.version)
-	case 0x1b:
-		frame, err = parsePathResponseFrame(r, p.version)
-	case 0x1c, 0x1d:
-		frame, err = parseConnectionCloseFrame(r, p.version)
-	default:
-		err = fmt.Errorf("unknown type byte 0x%x", typeByte)
+		return nil, qerr.ErrorWithFrameType(qerr.FrameEncodingError, uint64(typeByte), err.Error())
+	}
+	if err := p.validateFrameType(uint64(typeByte), encLevel); err != nil {
+		return nil, err
 	}
+	return frame, nil
+}
+
+// parseCustomFrame parses a frame of a registered extension frame type.
+// The frame type was already consumed.
+func (p *frameParser) parseCustomFrame(r *bytes.Reader, frameType uint64, decode ExtensionFrameDecoder, encLevel protocol.EncryptionLevel) (Frame, error) {
+	// Validate the frame type first, so that the decoder is never called for frames that are not allowed.
+	if err := p.validateFrameType(frameType, encLevel); err != nil {
+		return nil, err
+	}
+	frame, err := parseCustomFrame(r, decode)
 	if err != nil {
-		return nil, qerr.Error(qerr.FrameEncodingError, err.Error())
+		return nil, qerr.ErrorWithFrameType(qerr.FrameEncodingError, frameType, err.Error())
 	}
 	return frame, nil
 }
 
+// validateFrameType checks that a frame type is allowed at an encryption level,
+// and that the peer is allowed to send it.
+// Initial and Handshake packets can only contain PADDING, PING, ACK, CRYPTO and CONNECTION_CLOSE (of type 0x1c) frames.
+// Only servers send NEW_TOKEN frames.
+func (p *frameParser) validateFrameType(frameType uint64, encLevel protocol.EncryptionLevel) error {
+	if encLevel != protocol.Encryption1RTT {
+		switch frameType {
+		case 0x1, 0x2, 0x3, 0x6, 0x1c:
+		default:
+			return qerr.ErrorWithFrameType(qerr.ProtocolViolation, frameType, fmt.Sprintf("frame type 0x%x not allowed in %s packets", frameType, encLevel))
+		}
+	}
+	if frameType == 0x7 && p.perspective == protocol.PerspectiveServer {
+		return qerr.ErrorWithFrameType(qerr.ProtocolViolation, frameType, "received NEW_TOKEN frame from the client")
+	}
+	return nil
+}
+
 func (p *frameParser) SetAckDelayExponent(exp uint8) {
 	p.ackDelayExponent = exp
 }
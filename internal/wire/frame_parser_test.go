@@ -2,10 +2,12 @@ package wire
 
 import (
 	"bytes"
+	"fmt"
 	"time"
 
 	"github.com/lucas-clemente/quic-go/internal/protocol"
 	"github.com/lucas-clemente/quic-go/internal/qerr"
+	"github.com/lucas-clemente/quic-go/internal/utils"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 )
@@ -18,7 +20,7 @@ var _ = Describe("Frame parsing", func() {
 
 	BeforeEach(func() {
 		buf = &bytes.Buffer{}
-		parser = NewFrameParser(versionIETFFrames)
+		parser = NewFrameParser(true, false, nil, protocol.PerspectiveClient, versionIETFFrames)
 	})
 
 	It("returns nil if there's nothing more to read", func() {
@@ -271,9 +273,114 @@ var _ = Describe("Frame parsing", func() {
 		Expect(frame).To(Equal(f))
 	})
 
+	It("unpacks DATAGRAM frames", func() {
+		f := &DatagramFrame{Data: []byte("foobar")}
+		buf := &bytes.Buffer{}
+		Expect(f.Write(buf, versionIETFFrames)).To(Succeed())
+		frame, err := parser.ParseNext(bytes.NewReader(buf.Bytes()), protocol.Encryption1RTT)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(frame).To(Equal(f))
+	})
+
+	It("errors when receiving DATAGRAM frames, if datagrams were not enabled", func() {
+		parser = NewFrameParser(false, false, nil, protocol.PerspectiveClient, versionIETFFrames)
+		f := &DatagramFrame{Data: []byte("foobar")}
+		buf := &bytes.Buffer{}
+		Expect(f.Write(buf, versionIETFFrames)).To(Succeed())
+		_, err := parser.ParseNext(bytes.NewReader(buf.Bytes()), protocol.Encryption1RTT)
+		Expect(err).To(HaveOccurred())
+		Expect(err.(*qerr.QuicError).ErrorCode).To(Equal(qerr.ProtocolViolation))
+	})
+
+	It("skips GREASE frames, if enabled", func() {
+		parser = NewFrameParser(false, true, nil, protocol.PerspectiveClient, versionIETFFrames)
+		f := &PingFrame{}
+		buf := &bytes.Buffer{}
+		Expect((&GreaseFrame{FrameType: 0x1f + 0x1b}).Write(buf, versionIETFFrames)).To(Succeed())
+		Expect((&GreaseFrame{FrameType: 0x1f*500 + 0x1b}).Write(buf, versionIETFFrames)).To(Succeed())
+		Expect(f.Write(buf, versionIETFFrames)).To(Succeed())
+		Expect((&GreaseFrame{FrameType: 0x1f*42 + 0x1b}).Write(buf, versionIETFFrames)).To(Succeed())
+		r := bytes.NewReader(buf.Bytes())
+		frame, err := parser.ParseNext(r, protocol.Encryption1RTT)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(frame).To(Equal(f))
+		frame, err = parser.ParseNext(r, protocol.Encryption1RTT)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(frame).To(BeNil())
+		Expect(r.Len()).To(BeZero())
+	})
+
+	It("errors on GREASE frames, if not enabled", func() {
+		buf := &bytes.Buffer{}
+		Expect((&GreaseFrame{FrameType: 0x1f*42 + 0x1b}).Write(buf, versionIETFFrames)).To(Succeed())
+		_, err := parser.ParseNext(bytes.NewReader(buf.Bytes()), protocol.Encryption1RTT)
+		Expect(err).To(HaveOccurred())
+		Expect(err.(*qerr.QuicError).ErrorCode).To(Equal(qerr.FrameEncodingError))
+		Expect(err.(*qerr.QuicError).FrameType).To(Equal(uint64(0x1f*42 + 0x1b)))
+	})
+
+	It("errors on GREASE frames in Initial and Handshake packets", func() {
+		parser = NewFrameParser(false, true, nil, protocol.PerspectiveClient, versionIETFFrames)
+		for _, encLevel := range []protocol.EncryptionLevel{protocol.EncryptionInitial, protocol.EncryptionHandshake} {
+			buf := &bytes.Buffer{}
+			Expect((&GreaseFrame{FrameType: 0x1f + 0x1b}).Write(buf, versionIETFFrames)).To(Succeed())
+			_, err := parser.ParseNext(bytes.NewReader(buf.Bytes()), encLevel)
+			Expect(err).To(HaveOccurred())
+			Expect(err.(*qerr.QuicError).ErrorCode).To(Equal(qerr.FrameEncodingError))
+		}
+	})
+
+	It("errors on unknown two byte frame types", func() {
+		buf := &bytes.Buffer{}
+		utils.WriteVarInt(buf, 0x1f*500+0x1c)
+		_, err := parser.ParseNext(bytes.NewReader(buf.Bytes()), protocol.Encryption1RTT)
+		Expect(err).To(HaveOccurred())
+		Expect(err.(*qerr.QuicError).ErrorCode).To(Equal(qerr.FrameEncodingError))
+		Expect(err.(*qerr.QuicError).FrameType).To(Equal(uint64(0x1f*500 + 0x1c)))
+	})
+
 	It("errors on invalid type", func() {
-		_, err := parser.ParseNext(bytes.NewReader([]byte{0x42}), protocol.Encryption1RTT)
-		Expect(err).To(MatchError("FRAME_ENCODING_ERROR: unknown type byte 0x42"))
+		_, err := parser.ParseNext(bytes.NewReader([]byte{0x21}), protocol.Encryption1RTT)
+		Expect(err).To(MatchError("FRAME_ENCODING_ERROR: unknown frame type 0x21 at offset 0"))
+		Expect(err.(*qerr.QuicError).FrameType).To(Equal(uint64(0x21)))
+	})
+
+	Context("unknown frame types", func() {
+		// These payloads used to be hard to handle for the parser:
+		// unknown types following valid frames, multi-byte types, and truncated types.
+		for _, t := range []struct {
+			name      string
+			data      []byte
+			frames    []Frame
+			frameType uint64
+			offset    int
+		}{
+			{"after a PING frame", []byte{0x1, 0x21}, []Frame{&PingFrame{}}, 0x21, 1},
+			{"after PADDING", []byte{0x0, 0x0, 0x0, 0x21}, nil, 0x21, 3},
+			{"after a GREASE frame", []byte{0x3a, 0x21}, nil, 0x21, 1},
+			{"encoded in 2 bytes", []byte{0x1, 0x7f, 0xff}, []Frame{&PingFrame{}}, 0x3fff, 1},
+			{"encoded in 4 bytes", []byte{0x80, 0x12, 0x34, 0x56}, nil, 0x123456, 0},
+			{"encoded in 8 bytes", []byte{0xc0, 0, 0, 0, 0, 0, 0x13, 0x37}, nil, 0x1337, 0},
+			{"with a truncated type", []byte{0x1, 0x1, 0x80, 0x12}, []Frame{&PingFrame{}, &PingFrame{}}, 0x80, 2},
+			{"that are adjacent to GREASE types", []byte{0x3b}, nil, 0x3b, 0},
+		} {
+			t := t
+
+			It(fmt.Sprintf("errors on unknown frame types %s", t.name), func() {
+				parser = NewFrameParser(true, true, nil, protocol.PerspectiveClient, versionIETFFrames)
+				r := bytes.NewReader(t.data)
+				for _, f := range t.frames {
+					frame, err := parser.ParseNext(r, protocol.Encryption1RTT)
+					Expect(err).ToNot(HaveOccurred())
+					Expect(frame).To(Equal(f))
+				}
+				_, err := parser.ParseNext(r, protocol.Encryption1RTT)
+				Expect(err).To(HaveOccurred())
+				Expect(err.(*qerr.QuicError).ErrorCode).To(Equal(qerr.FrameEncodingError))
+				Expect(err.(*qerr.QuicError).FrameType).To(Equal(t.frameType))
+				Expect(err.Error()).To(ContainSubstring(fmt.Sprintf("unknown frame type 0x%x at offset %d", t.frameType, t.offset)))
+			})
+		}
 	})
 
 	It("errors on invalid frames", func() {
@@ -286,5 +393,101 @@ var _ = Describe("Frame parsing", func() {
 		_, err := parser.ParseNext(bytes.NewReader(b.Bytes()[:b.Len()-2]), protocol.Encryption1RTT)
 		Expect(err).To(HaveOccurred())
 		Expect(err.(*qerr.QuicError).ErrorCode).To(Equal(qerr.FrameEncodingError))
+		Expect(err.(*qerr.QuicError).FrameType).To(Equal(uint64(0x11)))
+	})
+
+	It("sets the frame type for STREAM frames that overflow the maximum offset", func() {
+		f := &StreamFrame{
+			StreamID:       4,
+			Offset:         protocol.MaxByteCount - 2,
+			Data:           []byte("foobar"),
+			DataLenPresent: true,
+		}
+		b := &bytes.Buffer{}
+		Expect(f.Write(b, versionIETFFrames)).To(Succeed())
+		_, err := parser.ParseNext(bytes.NewReader(b.Bytes()), protocol.Encryption1RTT)
+		Expect(err).To(MatchError("FRAME_ENCODING_ERROR: stream data overflows maximum offset"))
+		Expect(err.(*qerr.QuicError).FrameType).To(Equal(uint64(b.Bytes()[0])))
+	})
+
+	Context("validating frame types", func() {
+		framesByType := map[uint64]Frame{
+			0x1:  &PingFrame{},
+			0x2:  &AckFrame{AckRanges: []AckRange{{Smallest: 1, Largest: 2}}},
+			0x3:  &AckFrame{AckRanges: []AckRange{{Smallest: 1, Largest: 2}}, ECT0: 1},
+			0x4:  &ResetStreamFrame{StreamID: 4, ByteOffset: 42},
+			0x5:  &StopSendingFrame{StreamID: 4},
+			0x6:  &CryptoFrame{Data: []byte("foobar")},
+			0x7:  &NewTokenFrame{Token: []byte("token")},
+			0x8:  &StreamFrame{StreamID: 4, Data: []byte("foobar")},
+			0xf:  &StreamFrame{StreamID: 4, Offset: 42, Data: []byte("foobar"), DataLenPresent: true, FinBit: true},
+			0x10: &MaxDataFrame{ByteOffset: 42},
+			0x11: &MaxStreamDataFrame{StreamID: 4, ByteOffset: 42},
+			0x12: &MaxStreamsFrame{Type: protocol.StreamTypeBidi, MaxStreams: 10},
+			0x13: &MaxStreamsFrame{Type: protocol.StreamTypeUni, MaxStreams: 10},
+			0x14: &DataBlockedFrame{DataLimit: 42},
+			0x15: &StreamDataBlockedFrame{StreamID: 4, DataLimit: 42},
+			0x16: &StreamsBlockedFrame{Type: protocol.StreamTypeBidi, StreamLimit: 10},
+			0x17: &StreamsBlockedFrame{Type: protocol.StreamTypeUni, StreamLimit: 10},
+			0x18: &NewConnectionIDFrame{SequenceNumber: 1, ConnectionID: protocol.ConnectionID{1, 2, 3, 4}},
+			0x19: &RetireConnectionIDFrame{SequenceNumber: 1},
+			0x1a: &PathChallengeFrame{Data: [8]byte{1, 2, 3, 4, 5, 6, 7, 8}},
+			0x1b: &PathResponseFrame{Data: [8]byte{1, 2, 3, 4, 5, 6, 7, 8}},
+			0x1c: &ConnectionCloseFrame{ErrorCode: qerr.InternalError},
+			0x1d: &ConnectionCloseFrame{IsApplicationError: true},
+			0x30: &DatagramFrame{Data: []byte("foobar")},
+			0x31: &DatagramFrame{Data: []byte("foobar"), DataLenPresent: true},
+		}
+
+		// allowedInLongHeaderPackets lists the frame types allowed in Initial and Handshake packets
+		allowedInLongHeaderPackets := map[uint64]bool{0x1: true, 0x2: true, 0x3: true, 0x6: true, 0x1c: true}
+
+		for ft := range framesByType {
+			frameType := ft
+
+			for _, el := range []protocol.EncryptionLevel{protocol.EncryptionInitial, protocol.EncryptionHandshake, protocol.Encryption1RTT} {
+				encLevel := el
+
+				for _, pers := range []protocol.Perspective{protocol.PerspectiveClient, protocol.PerspectiveServer} {
+					perspective := pers
+					allowed := encLevel == protocol.Encryption1RTT || allowedInLongHeaderPackets[frameType]
+					if frameType == 0x7 && perspective == protocol.PerspectiveServer {
+						allowed = false
+					}
+
+					It(fmt.Sprintf("validates frame type %#x in %s packets, received by the %s", frameType, encLevel, perspective), func() {
+						parser := NewFrameParser(true, false, nil, perspective, versionIETFFrames)
+						b := &bytes.Buffer{}
+						Expect(framesByType[frameType].Write(b, versionIETFFrames)).To(Succeed())
+						Expect(b.Bytes()[0]).To(BeEquivalentTo(frameType))
+						frame, err := parser.ParseNext(bytes.NewReader(b.Bytes()), encLevel)
+						if allowed {
+							Expect(err).ToNot(HaveOccurred())
+							Expect(frame).ToNot(BeNil())
+							return
+						}
+						Expect(err).To(HaveOccurred())
+						qErr := err.(*qerr.QuicError)
+						Expect(qErr.ErrorCode).To(Equal(qerr.ProtocolViolation))
+						Expect(qErr.FrameType).To(Equal(frameType))
+					})
+				}
+			}
+		}
+
+		It("rejects frames in Initial packets", func() {
+			b := &bytes.Buffer{}
+			Expect((&MaxDataFrame{ByteOffset: 42}).Write(b, versionIETFFrames)).To(Succeed())
+			_, err := parser.ParseNext(bytes.NewReader(b.Bytes()), protocol.EncryptionInitial)
+			Expect(err).To(MatchError("PROTOCOL_VIOLATION: frame type 0x10 not allowed in Initial packets"))
+		})
+
+		It("rejects NEW_TOKEN frames sent by the client", func() {
+			parser := NewFrameParser(false, false, nil, protocol.PerspectiveServer, versionIETFFrames)
+			b := &bytes.Buffer{}
+			Expect((&NewTokenFrame{Token: []byte("foobar")}).Write(b, versionIETFFrames)).To(Succeed())
+			_, err := parser.ParseNext(bytes.NewReader(b.Bytes()), protocol.Encryption1RTT)
+			Expect(err).To(MatchError("PROTOCOL_VIOLATION: received NEW_TOKEN frame from the client"))
+		})
 	})
 })
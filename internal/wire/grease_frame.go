@@ -0,0 +1,63 @@
+package wire
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"io"
+
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+	"github.com/lucas-clemente/quic-go/internal/utils"
+)
+
+// maxGreaseFrameTypeN limits the frame types of GREASE frames, such that they can be encoded in 2 bytes
+const maxGreaseFrameTypeN = (1<<14 - 1 - 0x1b) / 0x1f
+
+// A GreaseFrame is a frame of a reserved frame type (0x1f * N + 0x1b).
+// It doesn't carry any content, and is ignored by the receiver.
+// It is sent to exercise the peer's handling of unknown frame types.
+// Reserving these frame types is a quic-go convention, not part of the QUIC specification.
+// Both endpoints have to negotiate it using the grease_frames transport parameter,
+// since other implementations might use these frame types for extension frames.
+type GreaseFrame struct {
+	FrameType uint64
+}
+
+// NewGreaseFrame creates a GREASE frame with a random reserved frame type
+func NewGreaseFrame() *GreaseFrame {
+	b := make([]byte, 2)
+	_, _ = rand.Read(b) // ignore the error here. Failure to read random data doesn't break anything
+	// N = 0 is not used, since 0x1b is the frame type of the PATH_RESPONSE frame
+	n := 1 + uint64(binary.BigEndian.Uint16(b))%maxGreaseFrameTypeN
+	return &GreaseFrame{FrameType: 0x1f*n + 0x1b}
+}
+
+// isGreaseFrameType says if a frame type is reserved for GREASE frames.
+// This is a private convention that both endpoints must negotiate (see GreaseFrame).
+// Frame types registered with RegisterFrameType could collide with it,
+// which is why IsExtensionFrameType rejects these types.
+func isGreaseFrameType(t uint64) bool {
+	return t != 0x1b && t%0x1f == 0x1b
+}
+
+// skipGreaseFrame consumes the next frame, if it is a GREASE frame.
+// Otherwise, it doesn't consume any data and returns false.
+func skipGreaseFrame(r *bytes.Reader) bool {
+	startLen := r.Len()
+	frameType, err := utils.ReadVarInt(r)
+	if err == nil && isGreaseFrameType(frameType) {
+		return true
+	}
+	r.Seek(int64(r.Len()-startLen), io.SeekCurrent)
+	return false
+}
+
+func (f *GreaseFrame) Write(b *bytes.Buffer, _ protocol.VersionNumber) error {
+	utils.WriteVarInt(b, f.FrameType)
+	return nil
+}
+
+// Length of a written frame
+func (f *GreaseFrame) Length(_ protocol.VersionNumber) protocol.ByteCount {
+	return utils.VarIntLen(f.FrameType)
+}
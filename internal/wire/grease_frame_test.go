@@ -0,0 +1,48 @@
+package wire
+
+import (
+	"bytes"
+
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+	"github.com/lucas-clemente/quic-go/internal/utils"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("GREASE frame", func() {
+	It("generates random reserved frame types", func() {
+		frameTypes := make(map[uint64]struct{})
+		for i := 0; i < 100; i++ {
+			f := NewGreaseFrame()
+			Expect(isGreaseFrameType(f.FrameType)).To(BeTrue())
+			Expect((f.FrameType - 0x1b) % 0x1f).To(BeZero())
+			Expect(f.FrameType).ToNot(BeEquivalentTo(0x1b))
+			Expect(f.Length(versionIETFFrames)).To(BeNumerically("<=", 2))
+			frameTypes[f.FrameType] = struct{}{}
+		}
+		Expect(len(frameTypes)).To(BeNumerically(">", 1))
+	})
+
+	It("writes a frame", func() {
+		f := &GreaseFrame{FrameType: 0x1f*100 + 0x1b}
+		b := &bytes.Buffer{}
+		Expect(f.Write(b, versionIETFFrames)).To(Succeed())
+		expected := &bytes.Buffer{}
+		utils.WriteVarInt(expected, 0x1f*100+0x1b)
+		Expect(b.Bytes()).To(Equal(expected.Bytes()))
+		Expect(f.Length(versionIETFFrames)).To(BeEquivalentTo(2))
+	})
+
+	It("has the correct length for a single byte frame type", func() {
+		f := &GreaseFrame{FrameType: 0x1f + 0x1b}
+		b := &bytes.Buffer{}
+		Expect(f.Write(b, versionIETFFrames)).To(Succeed())
+		Expect(b.Bytes()).To(Equal([]byte{0x3a}))
+		Expect(f.Length(protocol.VersionWhatever)).To(BeEquivalentTo(1))
+	})
+
+	It("doesn't treat PATH_RESPONSE as a GREASE frame", func() {
+		Expect(isGreaseFrameType(0x1b)).To(BeFalse())
+		Expect(isGreaseFrameType(0x1c)).To(BeFalse())
+	})
+})
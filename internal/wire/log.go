@@ -35,8 +35,12 @@ func LogFrame(logger utils.Logger, frame Frame, sent bool) {
 		}
 	case *NewConnectionIDFrame:
 		logger.Debugf("\t%s &wire.NewConnectionIDFrame{SequenceNumber: %d, ConnectionID: %s, StatelessResetToken: %#x}", dir, f.SequenceNumber, f.ConnectionID, f.StatelessResetToken)
+	case *DatagramFrame:
+		logger.Debugf("\t%s &wire.DatagramFrame{DataLenPresent: %t, Data length: 0x%x}", dir, f.DataLenPresent, len(f.Data))
 	case *NewTokenFrame:
 		logger.Debugf("\t%s &wire.NewTokenFrame{Token: %#x}", dir, f.Token)
+	case *CustomFrame:
+		logger.Debugf("\t%s &wire.CustomFrame{FrameType: %#x, Length: %d}", dir, f.Frame.FrameType(), f.Frame.Length())
 	default:
 		logger.Debugf("\t%s %#v", dir, frame)
 	}
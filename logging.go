@@ -0,0 +1,160 @@
+package quic
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/lucas-clemente/quic-go/internal/utils"
+)
+
+// LogLevel is the level of a log message.
+type LogLevel = utils.LogLevel
+
+const (
+	// LogLevelNothing disables logging.
+	LogLevelNothing = utils.LogLevelNothing
+	// LogLevelError is used for errors.
+	LogLevelError = utils.LogLevelError
+	// LogLevelInfo is used for informational messages, e.g. for every packet sent and received.
+	LogLevelInfo = utils.LogLevelInfo
+	// LogLevelDebug is used for debug messages, e.g. for the contents of every packet.
+	LogLevelDebug = utils.LogLevelDebug
+)
+
+// A Logger receives structured log messages from quic-go.
+// It must be safe for concurrent use.
+// StandardLogger is an implementation that writes the messages to an io.Writer.
+type Logger interface {
+	// Enabled says if messages of a certain level are logged.
+	// It is called before a message is formatted, so it is called very often, and should return quickly.
+	// connID is the connection ID that is logged as the value of the "conn" key.
+	// It is nil for messages that don't belong to a connection.
+	Enabled(level LogLevel, connID ConnectionID) bool
+	// Log logs a message.
+	// keyvals contains alternating keys and values, e.g. the connection ID (key "conn")
+	// and the perspective (key "perspective") for all messages logged by a connection.
+	// It must not be retained or modified.
+	Log(level LogLevel, msg string, keyvals ...interface{})
+}
+
+var _ utils.LogSink = Logger(nil)
+
+// newLogger creates the logger used by a Listener or a Dialer.
+// If the Config doesn't contain a Logger, the default logger (configured by the QUIC_GO_LOG_LEVEL environment variable) is used.
+func newLogger(config *Config, prefix string) utils.Logger {
+	if config.Logger == nil {
+		return utils.DefaultLogger.WithPrefix(prefix)
+	}
+	return utils.NewStructuredLogger(config.Logger).WithPrefix(prefix)
+}
+
+// StandardLogger is a Logger that writes one line per message to an io.Writer,
+// using the logfmt format (key=value pairs).
+// The log level can be changed at any time, globally as well as for single connections.
+type StandardLogger struct {
+	level          uint32 // accessed atomically
+	numConnLevels  int32  // accessed atomically
+	connLevelMutex sync.RWMutex
+	connLevels     map[string]LogLevel
+
+	mutex      sync.Mutex
+	out        io.Writer
+	timeFormat string
+}
+
+var _ Logger = &StandardLogger{}
+
+// NewStandardLogger creates a new StandardLogger, logging all messages up to level to out.
+func NewStandardLogger(out io.Writer, level LogLevel) *StandardLogger {
+	return &StandardLogger{
+		out:        out,
+		level:      uint32(level),
+		connLevels: make(map[string]LogLevel),
+		timeFormat: time.RFC3339Nano,
+	}
+}
+
+// SetLevel sets the log level.
+// It doesn't apply to connections that have their own log level.
+func (l *StandardLogger) SetLevel(level LogLevel) {
+	atomic.StoreUint32(&l.level, uint32(level))
+}
+
+// SetConnectionLevel sets the log level for a single connection, e.g. to enable debug logging
+// for this connection on an otherwise quiet server.
+// The connection is identified by the connection ID logged as the value of the "conn" key.
+// It may be called before the connection is established.
+func (l *StandardLogger) SetConnectionLevel(connID ConnectionID, level LogLevel) {
+	l.connLevelMutex.Lock()
+	defer l.connLevelMutex.Unlock()
+	l.connLevels[string(connID)] = level
+	atomic.StoreInt32(&l.numConnLevels, int32(len(l.connLevels)))
+}
+
+// ResetConnectionLevel removes the log level set for a single connection by SetConnectionLevel.
+func (l *StandardLogger) ResetConnectionLevel(connID ConnectionID) {
+	l.connLevelMutex.Lock()
+	defer l.connLevelMutex.Unlock()
+	delete(l.connLevels, string(connID))
+	atomic.StoreInt32(&l.numConnLevels, int32(len(l.connLevels)))
+}
+
+// SetTimeFormat sets the format of the timestamp.
+// An empty string disables the logging of timestamps.
+func (l *StandardLogger) SetTimeFormat(format string) {
+	l.mutex.Lock()
+	l.timeFormat = format
+	l.mutex.Unlock()
+}
+
+// Enabled implements the Logger interface.
+func (l *StandardLogger) Enabled(level LogLevel, connID ConnectionID) bool {
+	if connID != nil && atomic.LoadInt32(&l.numConnLevels) > 0 {
+		l.connLevelMutex.RLock()
+		connLevel, ok := l.connLevels[string(connID)]
+		l.connLevelMutex.RUnlock()
+		if ok {
+			return level != LogLevelNothing && level <= connLevel
+		}
+	}
+	return level != LogLevelNothing && level <= LogLevel(atomic.LoadUint32(&l.level))
+}
+
+// Log implements the Logger interface.
+func (l *StandardLogger) Log(level LogLevel, msg string, keyvals ...interface{}) {
+	buf := &bytes.Buffer{}
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if len(l.timeFormat) > 0 {
+		writeLogValue(buf, "time", time.Now().Format(l.timeFormat))
+		buf.WriteByte(' ')
+	}
+	writeLogValue(buf, "level", level.String())
+	buf.WriteByte(' ')
+	writeLogValue(buf, "msg", msg)
+	for i := 0; i < len(keyvals); i += 2 {
+		buf.WriteByte(' ')
+		if i+1 == len(keyvals) {
+			writeLogValue(buf, fmt.Sprint(keyvals[i]), "(missing)")
+			break
+		}
+		writeLogValue(buf, fmt.Sprint(keyvals[i]), fmt.Sprint(keyvals[i+1]))
+	}
+	buf.WriteByte('\n')
+	l.out.Write(buf.Bytes())
+}
+
+func writeLogValue(buf *bytes.Buffer, key, value string) {
+	buf.WriteString(key)
+	buf.WriteByte('=')
+	if value == "" || strings.ContainsAny(value, " =\"\n\t") {
+		value = strconv.Quote(value)
+	}
+	buf.WriteString(value)
+}
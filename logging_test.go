@@ -0,0 +1,108 @@
+package quic
+
+import (
+	"bytes"
+	"strings"
+	"time"
+
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+	"github.com/lucas-clemente/quic-go/internal/utils"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Logging", func() {
+	Context("creating the logger", func() {
+		It("uses the default logger if no Logger is set", func() {
+			logger := newLogger(&Config{}, "server")
+			Expect(logger).To(Equal(utils.DefaultLogger.WithPrefix("server")))
+		})
+
+		It("uses the Logger", func() {
+			buf := &bytes.Buffer{}
+			l := NewStandardLogger(buf, LogLevelInfo)
+			l.SetTimeFormat("")
+			logger := newLogger(&Config{Logger: l}, "server")
+			logger.WithConnection(protocol.PerspectiveServer, protocol.ConnectionID{0xde, 0xad, 0xbe, 0xef}).Infof("foo %s", "bar")
+			Expect(buf.String()).To(Equal("level=info msg=\"foo bar\" logger=server perspective=server conn=0xdeadbeef\n"))
+		})
+	})
+
+	Context("StandardLogger", func() {
+		var (
+			buf    *bytes.Buffer
+			logger *StandardLogger
+		)
+
+		BeforeEach(func() {
+			buf = &bytes.Buffer{}
+			logger = NewStandardLogger(buf, LogLevelInfo)
+			logger.SetTimeFormat("")
+		})
+
+		It("says which levels are enabled", func() {
+			Expect(logger.Enabled(LogLevelError, nil)).To(BeTrue())
+			Expect(logger.Enabled(LogLevelInfo, nil)).To(BeTrue())
+			Expect(logger.Enabled(LogLevelDebug, nil)).To(BeFalse())
+			Expect(logger.Enabled(LogLevelNothing, nil)).To(BeFalse())
+		})
+
+		It("disables logging", func() {
+			logger.SetLevel(LogLevelNothing)
+			Expect(logger.Enabled(LogLevelError, nil)).To(BeFalse())
+		})
+
+		It("changes the log level", func() {
+			logger.SetLevel(LogLevelDebug)
+			Expect(logger.Enabled(LogLevelDebug, nil)).To(BeTrue())
+			logger.SetLevel(LogLevelError)
+			Expect(logger.Enabled(LogLevelInfo, nil)).To(BeFalse())
+			Expect(logger.Enabled(LogLevelError, nil)).To(BeTrue())
+		})
+
+		It("sets the log level for a single connection", func() {
+			connID := protocol.ConnectionID{0xde, 0xad, 0xbe, 0xef}
+			logger.SetLevel(LogLevelError)
+			logger.SetConnectionLevel(connID, LogLevelDebug)
+			Expect(logger.Enabled(LogLevelDebug, connID)).To(BeTrue())
+			Expect(logger.Enabled(LogLevelDebug, protocol.ConnectionID{1, 2, 3, 4})).To(BeFalse())
+			Expect(logger.Enabled(LogLevelInfo, nil)).To(BeFalse())
+			logger.ResetConnectionLevel(connID)
+			Expect(logger.Enabled(LogLevelDebug, connID)).To(BeFalse())
+			Expect(logger.Enabled(LogLevelError, connID)).To(BeTrue())
+		})
+
+		It("quiets a single connection", func() {
+			connID := protocol.ConnectionID{0xde, 0xad, 0xbe, 0xef}
+			logger.SetConnectionLevel(connID, LogLevelNothing)
+			Expect(logger.Enabled(LogLevelError, connID)).To(BeFalse())
+			Expect(logger.Enabled(LogLevelError, nil)).To(BeTrue())
+		})
+
+		It("logs key value pairs", func() {
+			logger.Log(LogLevelError, "foobar", "conn", protocol.ConnectionID{0xca, 0xfe}, "count", 42)
+			Expect(buf.String()).To(Equal("level=error msg=foobar conn=0xcafe count=42\n"))
+		})
+
+		It("quotes values", func() {
+			logger.Log(LogLevelInfo, `say "hello"`, "empty", "", "equal", "a=b")
+			Expect(buf.String()).To(Equal(`level=info msg="say \"hello\"" empty="" equal="a=b"` + "\n"))
+		})
+
+		It("logs keys without a value", func() {
+			logger.Log(LogLevelInfo, "foobar", "key")
+			Expect(buf.String()).To(Equal("level=info msg=foobar key=(missing)\n"))
+		})
+
+		It("logs a timestamp", func() {
+			logger.SetTimeFormat(time.RFC3339Nano)
+			logger.Log(LogLevelInfo, "foobar")
+			Expect(buf.String()).To(HavePrefix("time="))
+			timestamp := strings.TrimPrefix(strings.Split(buf.String(), " ")[0], "time=")
+			t, err := time.Parse(time.RFC3339Nano, timestamp)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(t).To(BeTemporally("~", time.Now(), time.Second))
+		})
+	})
+})
@@ -0,0 +1,245 @@
+package quic
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+	"github.com/lucas-clemente/quic-go/internal/qerr"
+)
+
+// A ConnectionCloseReason is the reason why a connection was closed.
+type ConnectionCloseReason uint8
+
+const (
+	// CloseReasonLocal is used when the connection was closed by calling Close.
+	CloseReasonLocal ConnectionCloseReason = iota
+	// CloseReasonLocalError is used when the connection was closed locally due to an error,
+	// e.g. a protocol violation by the peer or a failed handshake, or by calling CloseWithError.
+	CloseReasonLocalError
+	// CloseReasonRemote is used when the peer closed the connection.
+	CloseReasonRemote
+	// CloseReasonIdleTimeout is used when the connection timed out after the handshake completed.
+	CloseReasonIdleTimeout
+	// CloseReasonHandshakeTimeout is used when the handshake didn't complete in time.
+	CloseReasonHandshakeTimeout
+	// CloseReasonStatelessReset is used when the peer sent a stateless reset.
+	CloseReasonStatelessReset
+)
+
+const numConnectionCloseReasons = int(CloseReasonStatelessReset) + 1
+
+func (r ConnectionCloseReason) String() string {
+	switch r {
+	case CloseReasonLocal:
+		return "local"
+	case CloseReasonLocalError:
+		return "local error"
+	case CloseReasonRemote:
+		return "remote"
+	case CloseReasonIdleTimeout:
+		return "idle timeout"
+	case CloseReasonHandshakeTimeout:
+		return "handshake timeout"
+	case CloseReasonStatelessReset:
+		return "stateless reset"
+	default:
+		return "unknown close reason"
+	}
+}
+
+// A MetricsCollector collects aggregated metrics of all connections of a Listener or a Dialer.
+// Other than the ConnectionTracer, it is not created per connection: the same MetricsCollector is used by all connections.
+// Implementations therefore must be safe for concurrent use.
+// The methods are called synchronously (mostly from the run loops of the connections), so they must return quickly,
+// and they should not allocate. Metrics is an implementation that uses atomic counters.
+type MetricsCollector interface {
+	// ConnectionStarted is called when a new connection is started.
+	ConnectionStarted()
+	// HandshakeCompleted is called when the handshake of a connection completes.
+	// duration is the time since the connection was started.
+	HandshakeCompleted(duration time.Duration)
+	// ConnectionClosed is called when a connection is closed.
+	ConnectionClosed(reason ConnectionCloseReason)
+	// SentPacket is called for every packet sent.
+	SentPacket(encLevel EncryptionLevel, size ByteCount)
+	// ReceivedPacket is called for every packet received and successfully decrypted.
+	ReceivedPacket(encLevel EncryptionLevel, size ByteCount)
+	// LostPacket is called when a packet is declared lost.
+	LostPacket(encLevel EncryptionLevel)
+	// ProbeTimeout is called when the crypto retransmission timer or the probe timeout (PTO) fires.
+	ProbeTimeout()
+	// StatelessResetSent is called when the server sends a stateless reset.
+	StatelessResetSent()
+	// VersionNegotiation is called when the server sends, or the client receives, a Version Negotiation packet.
+	VersionNegotiation()
+}
+
+// The encryption levels are used as an index into the counters of Metrics.
+const numEncryptionLevels = int(protocol.Encryption1RTT) + 1
+
+// Metrics is a MetricsCollector that counts events using atomic counters.
+// The zero value is ready to use.
+// Snapshot returns the current values, e.g. to export them to a monitoring system.
+type Metrics struct {
+	// All fields are accessed atomically.
+	// They are 64 bits wide, so they are 64-bit aligned on 32-bit platforms as well.
+	connectionsStarted  uint64
+	handshakesCompleted uint64
+	handshakeDuration   int64
+	connectionsClosed   [numConnectionCloseReasons]uint64
+	packetsSent         [numEncryptionLevels]uint64
+	bytesSent           [numEncryptionLevels]uint64
+	packetsReceived     [numEncryptionLevels]uint64
+	bytesReceived       [numEncryptionLevels]uint64
+	packetsLost         [numEncryptionLevels]uint64
+	probeTimeouts       uint64
+	statelessResetsSent uint64
+	versionNegotiations uint64
+}
+
+var _ MetricsCollector = &Metrics{}
+
+// MetricsSnapshot contains the values of the counters of Metrics at one point in time.
+type MetricsSnapshot struct {
+	ConnectionsStarted  uint64
+	HandshakesCompleted uint64
+	// TotalHandshakeDuration is the sum of the durations of all completed handshakes.
+	TotalHandshakeDuration time.Duration
+	ConnectionsClosed      map[ConnectionCloseReason]uint64
+
+	PacketsSent     map[EncryptionLevel]uint64
+	BytesSent       map[EncryptionLevel]ByteCount
+	PacketsReceived map[EncryptionLevel]uint64
+	BytesReceived   map[EncryptionLevel]ByteCount
+	PacketsLost     map[EncryptionLevel]uint64
+
+	ProbeTimeouts       uint64
+	StatelessResetsSent uint64
+	VersionNegotiations uint64
+}
+
+// ConnectionStarted implements the MetricsCollector interface.
+func (m *Metrics) ConnectionStarted() {
+	atomic.AddUint64(&m.connectionsStarted, 1)
+}
+
+// HandshakeCompleted implements the MetricsCollector interface.
+func (m *Metrics) HandshakeCompleted(duration time.Duration) {
+	atomic.AddUint64(&m.handshakesCompleted, 1)
+	atomic.AddInt64(&m.handshakeDuration, int64(duration))
+}
+
+// ConnectionClosed implements the MetricsCollector interface.
+func (m *Metrics) ConnectionClosed(reason ConnectionCloseReason) {
+	if int(reason) < numConnectionCloseReasons {
+		atomic.AddUint64(&m.connectionsClosed[reason], 1)
+	}
+}
+
+// SentPacket implements the MetricsCollector interface.
+func (m *Metrics) SentPacket(encLevel EncryptionLevel, size ByteCount) {
+	if encLevel >= 0 && int(encLevel) < numEncryptionLevels {
+		atomic.AddUint64(&m.packetsSent[encLevel], 1)
+		atomic.AddUint64(&m.bytesSent[encLevel], uint64(size))
+	}
+}
+
+// ReceivedPacket implements the MetricsCollector interface.
+func (m *Metrics) ReceivedPacket(encLevel EncryptionLevel, size ByteCount) {
+	if encLevel >= 0 && int(encLevel) < numEncryptionLevels {
+		atomic.AddUint64(&m.packetsReceived[encLevel], 1)
+		atomic.AddUint64(&m.bytesReceived[encLevel], uint64(size))
+	}
+}
+
+// LostPacket implements the MetricsCollector interface.
+func (m *Metrics) LostPacket(encLevel EncryptionLevel) {
+	if encLevel >= 0 && int(encLevel) < numEncryptionLevels {
+		atomic.AddUint64(&m.packetsLost[encLevel], 1)
+	}
+}
+
+// ProbeTimeout implements the MetricsCollector interface.
+func (m *Metrics) ProbeTimeout() {
+	atomic.AddUint64(&m.probeTimeouts, 1)
+}
+
+// StatelessResetSent implements the MetricsCollector interface.
+func (m *Metrics) StatelessResetSent() {
+	atomic.AddUint64(&m.statelessResetsSent, 1)
+}
+
+// VersionNegotiation implements the MetricsCollector interface.
+func (m *Metrics) VersionNegotiation() {
+	atomic.AddUint64(&m.versionNegotiations, 1)
+}
+
+// Snapshot returns the current values of the counters.
+// The counters are read one after the other, so the snapshot might not be consistent
+// if events are recorded concurrently.
+func (m *Metrics) Snapshot() MetricsSnapshot {
+	s := MetricsSnapshot{
+		ConnectionsStarted:     atomic.LoadUint64(&m.connectionsStarted),
+		HandshakesCompleted:    atomic.LoadUint64(&m.handshakesCompleted),
+		TotalHandshakeDuration: time.Duration(atomic.LoadInt64(&m.handshakeDuration)),
+		ConnectionsClosed:      make(map[ConnectionCloseReason]uint64, numConnectionCloseReasons),
+		PacketsSent:            make(map[EncryptionLevel]uint64, numEncryptionLevels),
+		BytesSent:              make(map[EncryptionLevel]ByteCount, numEncryptionLevels),
+		PacketsReceived:        make(map[EncryptionLevel]uint64, numEncryptionLevels),
+		BytesReceived:          make(map[EncryptionLevel]ByteCount, numEncryptionLevels),
+		PacketsLost:            make(map[EncryptionLevel]uint64, numEncryptionLevels),
+		ProbeTimeouts:          atomic.LoadUint64(&m.probeTimeouts),
+		StatelessResetsSent:    atomic.LoadUint64(&m.statelessResetsSent),
+		VersionNegotiations:    atomic.LoadUint64(&m.versionNegotiations),
+	}
+	for i := 0; i < numConnectionCloseReasons; i++ {
+		if n := atomic.LoadUint64(&m.connectionsClosed[i]); n > 0 {
+			s.ConnectionsClosed[ConnectionCloseReason(i)] = n
+		}
+	}
+	for i := 0; i < numEncryptionLevels; i++ {
+		encLevel := EncryptionLevel(i)
+		if n := atomic.LoadUint64(&m.packetsSent[i]); n > 0 {
+			s.PacketsSent[encLevel] = n
+			s.BytesSent[encLevel] = ByteCount(atomic.LoadUint64(&m.bytesSent[i]))
+		}
+		if n := atomic.LoadUint64(&m.packetsReceived[i]); n > 0 {
+			s.PacketsReceived[encLevel] = n
+			s.BytesReceived[encLevel] = ByteCount(atomic.LoadUint64(&m.bytesReceived[i]))
+		}
+		if n := atomic.LoadUint64(&m.packetsLost[i]); n > 0 {
+			s.PacketsLost[encLevel] = n
+		}
+	}
+	return s
+}
+
+// closeReason determines why the session was closed.
+func (s *session) closeReason(closeErr closeError) ConnectionCloseReason {
+	if closeErr.remote {
+		return CloseReasonRemote
+	}
+	if closeErr.err == nil {
+		return CloseReasonLocal
+	}
+	if closeErr.err == errStatelessReset {
+		return CloseReasonStatelessReset
+	}
+	if qErr, ok := closeErr.err.(*qerr.QuicError); ok && qErr.Timeout() {
+		if s.handshakeComplete {
+			return CloseReasonIdleTimeout
+		}
+		return CloseReasonHandshakeTimeout
+	}
+	return CloseReasonLocalError
+}
+
+// onProbeTimeout returns the callback used by the sent packet handler when the crypto retransmission timer or the PTO fires.
+// It returns nil if no MetricsCollector is set.
+func (s *session) onProbeTimeout() func() {
+	if s.config.MetricsCollector == nil {
+		return nil
+	}
+	return s.config.MetricsCollector.ProbeTimeout
+}
@@ -0,0 +1,112 @@
+package quic
+
+import (
+	"sync"
+	"time"
+
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Metrics", func() {
+	It("has a string representation for the close reasons", func() {
+		Expect(CloseReasonLocal.String()).To(Equal("local"))
+		Expect(CloseReasonIdleTimeout.String()).To(Equal("idle timeout"))
+		Expect(CloseReasonStatelessReset.String()).To(Equal("stateless reset"))
+		Expect(ConnectionCloseReason(100).String()).To(Equal("unknown close reason"))
+	})
+
+	It("returns an empty snapshot", func() {
+		snapshot := (&Metrics{}).Snapshot()
+		Expect(snapshot.ConnectionsStarted).To(BeZero())
+		Expect(snapshot.ConnectionsClosed).To(BeEmpty())
+		Expect(snapshot.PacketsSent).To(BeEmpty())
+		Expect(snapshot.BytesReceived).To(BeEmpty())
+	})
+
+	It("counts connections", func() {
+		m := &Metrics{}
+		m.ConnectionStarted()
+		m.ConnectionStarted()
+		m.HandshakeCompleted(time.Second)
+		m.HandshakeCompleted(2 * time.Second)
+		m.ConnectionClosed(CloseReasonRemote)
+		m.ConnectionClosed(CloseReasonIdleTimeout)
+		m.ConnectionClosed(CloseReasonIdleTimeout)
+		snapshot := m.Snapshot()
+		Expect(snapshot.ConnectionsStarted).To(BeEquivalentTo(2))
+		Expect(snapshot.HandshakesCompleted).To(BeEquivalentTo(2))
+		Expect(snapshot.TotalHandshakeDuration).To(Equal(3 * time.Second))
+		Expect(snapshot.ConnectionsClosed).To(Equal(map[ConnectionCloseReason]uint64{
+			CloseReasonRemote:      1,
+			CloseReasonIdleTimeout: 2,
+		}))
+	})
+
+	It("counts packets and bytes per encryption level", func() {
+		m := &Metrics{}
+		m.SentPacket(protocol.EncryptionInitial, 1200)
+		m.SentPacket(protocol.Encryption1RTT, 100)
+		m.SentPacket(protocol.Encryption1RTT, 200)
+		m.ReceivedPacket(protocol.EncryptionHandshake, 1000)
+		m.LostPacket(protocol.Encryption1RTT)
+		snapshot := m.Snapshot()
+		Expect(snapshot.PacketsSent).To(Equal(map[EncryptionLevel]uint64{
+			protocol.EncryptionInitial: 1,
+			protocol.Encryption1RTT:    2,
+		}))
+		Expect(snapshot.BytesSent).To(Equal(map[EncryptionLevel]ByteCount{
+			protocol.EncryptionInitial: 1200,
+			protocol.Encryption1RTT:    300,
+		}))
+		Expect(snapshot.PacketsReceived).To(Equal(map[EncryptionLevel]uint64{protocol.EncryptionHandshake: 1}))
+		Expect(snapshot.BytesReceived).To(Equal(map[EncryptionLevel]ByteCount{protocol.EncryptionHandshake: 1000}))
+		Expect(snapshot.PacketsLost).To(Equal(map[EncryptionLevel]uint64{protocol.Encryption1RTT: 1}))
+	})
+
+	It("ignores invalid encryption levels and close reasons", func() {
+		m := &Metrics{}
+		m.SentPacket(protocol.EncryptionLevel(-1), 100)
+		m.ReceivedPacket(protocol.EncryptionLevel(42), 100)
+		m.LostPacket(protocol.EncryptionLevel(42))
+		m.ConnectionClosed(ConnectionCloseReason(100))
+		snapshot := m.Snapshot()
+		Expect(snapshot.PacketsSent).To(BeEmpty())
+		Expect(snapshot.PacketsReceived).To(BeEmpty())
+		Expect(snapshot.PacketsLost).To(BeEmpty())
+		Expect(snapshot.ConnectionsClosed).To(BeEmpty())
+	})
+
+	It("counts probe timeouts, stateless resets and Version Negotiation packets", func() {
+		m := &Metrics{}
+		m.ProbeTimeout()
+		m.StatelessResetSent()
+		m.StatelessResetSent()
+		m.VersionNegotiation()
+		snapshot := m.Snapshot()
+		Expect(snapshot.ProbeTimeouts).To(BeEquivalentTo(1))
+		Expect(snapshot.StatelessResetsSent).To(BeEquivalentTo(2))
+		Expect(snapshot.VersionNegotiations).To(BeEquivalentTo(1))
+	})
+
+	It("is safe for concurrent use", func() {
+		m := &Metrics{}
+		const num = 100
+		var wg sync.WaitGroup
+		wg.Add(num)
+		for i := 0; i < num; i++ {
+			go func() {
+				defer wg.Done()
+				m.ConnectionStarted()
+				m.SentPacket(protocol.Encryption1RTT, 10)
+				m.Snapshot()
+			}()
+		}
+		wg.Wait()
+		snapshot := m.Snapshot()
+		Expect(snapshot.ConnectionsStarted).To(BeEquivalentTo(num))
+		Expect(snapshot.BytesSent[protocol.Encryption1RTT]).To(BeEquivalentTo(10 * num))
+	})
+})
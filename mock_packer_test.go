@@ -121,6 +121,18 @@ func (mr *MockPackerMockRecorder) PackRetransmission(arg0 interface{}) *gomock.C
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PackRetransmission", reflect.TypeOf((*MockPacker)(nil).PackRetransmission), arg0)
 }
 
+// QueuePing mocks base method
+func (m *MockPacker) QueuePing() {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "QueuePing")
+}
+
+// QueuePing indicates an expected call of QueuePing
+func (mr *MockPackerMockRecorder) QueuePing() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "QueuePing", reflect.TypeOf((*MockPacker)(nil).QueuePing))
+}
+
 // SetToken mocks base method
 func (m *MockPacker) SetToken(arg0 []byte) {
 	m.ctrl.T.Helper()
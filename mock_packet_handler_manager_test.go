@@ -5,6 +5,7 @@
 package quic
 
 import (
+	net "net"
 	reflect "reflect"
 
 	gomock "github.com/golang/mock/gomock"
@@ -46,6 +47,20 @@ func (mr *MockPacketHandlerManagerMockRecorder) Add(arg0, arg1 interface{}) *gom
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Add", reflect.TypeOf((*MockPacketHandlerManager)(nil).Add), arg0, arg1)
 }
 
+// AddListenConn mocks base method
+func (m *MockPacketHandlerManager) AddListenConn(arg0 net.PacketConn) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AddListenConn", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// AddListenConn indicates an expected call of AddListenConn
+func (mr *MockPacketHandlerManagerMockRecorder) AddListenConn(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddListenConn", reflect.TypeOf((*MockPacketHandlerManager)(nil).AddListenConn), arg0)
+}
+
 // AddResetToken mocks base method
 func (m *MockPacketHandlerManager) AddResetToken(arg0 [16]byte, arg1 packetHandler) {
 	m.ctrl.T.Helper()
@@ -7,8 +7,10 @@ package quic
 import (
 	context "context"
 	tls "crypto/tls"
+	x509 "crypto/x509"
 	net "net"
 	reflect "reflect"
+	time "time"
 
 	gomock "github.com/golang/mock/gomock"
 	protocol "github.com/lucas-clemente/quic-go/internal/protocol"
@@ -95,6 +97,20 @@ func (mr *MockQuicSessionMockRecorder) CloseWithError(arg0, arg1 interface{}) *g
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CloseWithError", reflect.TypeOf((*MockQuicSession)(nil).CloseWithError), arg0, arg1)
 }
 
+// ConnectionID mocks base method
+func (m *MockQuicSession) ConnectionID() string {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ConnectionID")
+	ret0, _ := ret[0].(string)
+	return ret0
+}
+
+// ConnectionID indicates an expected call of ConnectionID
+func (mr *MockQuicSessionMockRecorder) ConnectionID() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ConnectionID", reflect.TypeOf((*MockQuicSession)(nil).ConnectionID))
+}
+
 // ConnectionState mocks base method
 func (m *MockQuicSession) ConnectionState() tls.ConnectionState {
 	m.ctrl.T.Helper()
@@ -109,6 +125,20 @@ func (mr *MockQuicSessionMockRecorder) ConnectionState() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ConnectionState", reflect.TypeOf((*MockQuicSession)(nil).ConnectionState))
 }
 
+// ConnectionStats mocks base method
+func (m *MockQuicSession) ConnectionStats() ConnectionStats {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ConnectionStats")
+	ret0, _ := ret[0].(ConnectionStats)
+	return ret0
+}
+
+// ConnectionStats indicates an expected call of ConnectionStats
+func (mr *MockQuicSessionMockRecorder) ConnectionStats() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ConnectionStats", reflect.TypeOf((*MockQuicSession)(nil).ConnectionStats))
+}
+
 // Context mocks base method
 func (m *MockQuicSession) Context() context.Context {
 	m.ctrl.T.Helper()
@@ -123,6 +153,35 @@ func (mr *MockQuicSessionMockRecorder) Context() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Context", reflect.TypeOf((*MockQuicSession)(nil).Context))
 }
 
+// DonateStreamSendCredit mocks base method
+func (m *MockQuicSession) DonateStreamSendCredit(arg0 protocol.StreamID, arg1 protocol.StreamID, arg2 protocol.ByteCount) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DonateStreamSendCredit", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DonateStreamSendCredit indicates an expected call of DonateStreamSendCredit
+func (mr *MockQuicSessionMockRecorder) DonateStreamSendCredit(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DonateStreamSendCredit", reflect.TypeOf((*MockQuicSession)(nil).DonateStreamSendCredit), arg0, arg1, arg2)
+}
+
+// ExportKeyingMaterial mocks base method
+func (m *MockQuicSession) ExportKeyingMaterial(arg0 string, arg1 []byte, arg2 int) ([]byte, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ExportKeyingMaterial", arg0, arg1, arg2)
+	ret0, _ := ret[0].([]byte)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ExportKeyingMaterial indicates an expected call of ExportKeyingMaterial
+func (mr *MockQuicSessionMockRecorder) ExportKeyingMaterial(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ExportKeyingMaterial", reflect.TypeOf((*MockQuicSession)(nil).ExportKeyingMaterial), arg0, arg1, arg2)
+}
+
 // GetVersion mocks base method
 func (m *MockQuicSession) GetVersion() protocol.VersionNumber {
 	m.ctrl.T.Helper()
@@ -137,6 +196,20 @@ func (mr *MockQuicSessionMockRecorder) GetVersion() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetVersion", reflect.TypeOf((*MockQuicSession)(nil).GetVersion))
 }
 
+// HandshakeComplete mocks base method
+func (m *MockQuicSession) HandshakeComplete() context.Context {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "HandshakeComplete")
+	ret0, _ := ret[0].(context.Context)
+	return ret0
+}
+
+// HandshakeComplete indicates an expected call of HandshakeComplete
+func (mr *MockQuicSessionMockRecorder) HandshakeComplete() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "HandshakeComplete", reflect.TypeOf((*MockQuicSession)(nil).HandshakeComplete))
+}
+
 // LocalAddr mocks base method
 func (m *MockQuicSession) LocalAddr() net.Addr {
 	m.ctrl.T.Helper()
@@ -211,6 +284,92 @@ func (mr *MockQuicSessionMockRecorder) OpenUniStreamSync() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "OpenUniStreamSync", reflect.TypeOf((*MockQuicSession)(nil).OpenUniStreamSync))
 }
 
+// OriginalDestConnectionID mocks base method
+func (m *MockQuicSession) OriginalDestConnectionID() string {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "OriginalDestConnectionID")
+	ret0, _ := ret[0].(string)
+	return ret0
+}
+
+// OriginalDestConnectionID indicates an expected call of OriginalDestConnectionID
+func (mr *MockQuicSessionMockRecorder) OriginalDestConnectionID() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "OriginalDestConnectionID", reflect.TypeOf((*MockQuicSession)(nil).OriginalDestConnectionID))
+}
+
+// PeerCertificates mocks base method
+func (m *MockQuicSession) PeerCertificates() []*x509.Certificate {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PeerCertificates")
+	ret0, _ := ret[0].([]*x509.Certificate)
+	return ret0
+}
+
+// PeerCertificates indicates an expected call of PeerCertificates
+func (mr *MockQuicSessionMockRecorder) PeerCertificates() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PeerCertificates", reflect.TypeOf((*MockQuicSession)(nil).PeerCertificates))
+}
+
+// PeerCommonName mocks base method
+func (m *MockQuicSession) PeerCommonName() string {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PeerCommonName")
+	ret0, _ := ret[0].(string)
+	return ret0
+}
+
+// PeerCommonName indicates an expected call of PeerCommonName
+func (mr *MockQuicSessionMockRecorder) PeerCommonName() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PeerCommonName", reflect.TypeOf((*MockQuicSession)(nil).PeerCommonName))
+}
+
+// PeerTransportParameters mocks base method
+func (m *MockQuicSession) PeerTransportParameters() map[uint64][]byte {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PeerTransportParameters")
+	ret0, _ := ret[0].(map[uint64][]byte)
+	return ret0
+}
+
+// PeerTransportParameters indicates an expected call of PeerTransportParameters
+func (mr *MockQuicSessionMockRecorder) PeerTransportParameters() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PeerTransportParameters", reflect.TypeOf((*MockQuicSession)(nil).PeerTransportParameters))
+}
+
+// PingRoundTrip mocks base method
+func (m *MockQuicSession) PingRoundTrip(arg0 context.Context) (time.Duration, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PingRoundTrip", arg0)
+	ret0, _ := ret[0].(time.Duration)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// PingRoundTrip indicates an expected call of PingRoundTrip
+func (mr *MockQuicSessionMockRecorder) PingRoundTrip(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PingRoundTrip", reflect.TypeOf((*MockQuicSession)(nil).PingRoundTrip), arg0)
+}
+
+// ReceiveUnreliable mocks base method
+func (m *MockQuicSession) ReceiveUnreliable(arg0 context.Context) ([]byte, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReceiveUnreliable", arg0)
+	ret0, _ := ret[0].([]byte)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ReceiveUnreliable indicates an expected call of ReceiveUnreliable
+func (mr *MockQuicSessionMockRecorder) ReceiveUnreliable(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReceiveUnreliable", reflect.TypeOf((*MockQuicSession)(nil).ReceiveUnreliable), arg0)
+}
+
 // RemoteAddr mocks base method
 func (m *MockQuicSession) RemoteAddr() net.Addr {
 	m.ctrl.T.Helper()
@@ -225,6 +384,62 @@ func (mr *MockQuicSessionMockRecorder) RemoteAddr() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RemoteAddr", reflect.TypeOf((*MockQuicSession)(nil).RemoteAddr))
 }
 
+// SendCustomFrame mocks base method
+func (m *MockQuicSession) SendCustomFrame(arg0 CustomFrame) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SendCustomFrame", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SendCustomFrame indicates an expected call of SendCustomFrame
+func (mr *MockQuicSessionMockRecorder) SendCustomFrame(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SendCustomFrame", reflect.TypeOf((*MockQuicSession)(nil).SendCustomFrame), arg0)
+}
+
+// SendPing mocks base method
+func (m *MockQuicSession) SendPing() error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SendPing")
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SendPing indicates an expected call of SendPing
+func (mr *MockQuicSessionMockRecorder) SendPing() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SendPing", reflect.TypeOf((*MockQuicSession)(nil).SendPing))
+}
+
+// SendUnreliable mocks base method
+func (m *MockQuicSession) SendUnreliable(arg0 []byte) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SendUnreliable", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SendUnreliable indicates an expected call of SendUnreliable
+func (mr *MockQuicSessionMockRecorder) SendUnreliable(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SendUnreliable", reflect.TypeOf((*MockQuicSession)(nil).SendUnreliable), arg0)
+}
+
+// VerifiedChains mocks base method
+func (m *MockQuicSession) VerifiedChains() [][]*x509.Certificate {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "VerifiedChains")
+	ret0, _ := ret[0].([][]*x509.Certificate)
+	return ret0
+}
+
+// VerifiedChains indicates an expected call of VerifiedChains
+func (mr *MockQuicSessionMockRecorder) VerifiedChains() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "VerifiedChains", reflect.TypeOf((*MockQuicSession)(nil).VerifiedChains))
+}
+
 // closeForRecreating mocks base method
 func (m *MockQuicSession) closeForRecreating() protocol.PacketNumber {
 	m.ctrl.T.Helper()
@@ -239,6 +454,18 @@ func (mr *MockQuicSessionMockRecorder) closeForRecreating() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "closeForRecreating", reflect.TypeOf((*MockQuicSession)(nil).closeForRecreating))
 }
 
+// closeLocal mocks base method
+func (m *MockQuicSession) closeLocal(arg0 error) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "closeLocal", arg0)
+}
+
+// closeLocal indicates an expected call of closeLocal
+func (mr *MockQuicSessionMockRecorder) closeLocal(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "closeLocal", reflect.TypeOf((*MockQuicSession)(nil).closeLocal), arg0)
+}
+
 // closeRemote mocks base method
 func (m *MockQuicSession) closeRemote(arg0 error) {
 	m.ctrl.T.Helper()
@@ -289,6 +516,20 @@ func (mr *MockQuicSessionMockRecorder) handlePacket(arg0 interface{}) *gomock.Ca
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "handlePacket", reflect.TypeOf((*MockQuicSession)(nil).handlePacket), arg0)
 }
 
+// lastActivityTime mocks base method
+func (m *MockQuicSession) lastActivityTime() time.Time {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "lastActivityTime")
+	ret0, _ := ret[0].(time.Time)
+	return ret0
+}
+
+// lastActivityTime indicates an expected call of lastActivityTime
+func (mr *MockQuicSessionMockRecorder) lastActivityTime() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "lastActivityTime", reflect.TypeOf((*MockQuicSession)(nil).lastActivityTime))
+}
+
 // run mocks base method
 func (m *MockQuicSession) run() error {
 	m.ctrl.T.Helper()
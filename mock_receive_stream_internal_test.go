@@ -5,6 +5,7 @@
 package quic
 
 import (
+	context "context"
 	reflect "reflect"
 	time "time"
 
@@ -63,6 +64,35 @@ func (mr *MockReceiveStreamIMockRecorder) Read(arg0 interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Read", reflect.TypeOf((*MockReceiveStreamI)(nil).Read), arg0)
 }
 
+// ReadAvailable mocks base method
+func (m *MockReceiveStreamI) ReadAvailable() int {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReadAvailable")
+	ret0, _ := ret[0].(int)
+	return ret0
+}
+
+// ReadAvailable indicates an expected call of ReadAvailable
+func (mr *MockReceiveStreamIMockRecorder) ReadAvailable() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReadAvailable", reflect.TypeOf((*MockReceiveStreamI)(nil).ReadAvailable))
+}
+
+// ReorderStats mocks base method
+func (m *MockReceiveStreamI) ReorderStats() (protocol.ByteCount, uint64) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReorderStats")
+	ret0, _ := ret[0].(protocol.ByteCount)
+	ret1, _ := ret[1].(uint64)
+	return ret0, ret1
+}
+
+// ReorderStats indicates an expected call of ReorderStats
+func (mr *MockReceiveStreamIMockRecorder) ReorderStats() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReorderStats", reflect.TypeOf((*MockReceiveStreamI)(nil).ReorderStats))
+}
+
 // SetReadDeadline mocks base method
 func (m *MockReceiveStreamI) SetReadDeadline(arg0 time.Time) error {
 	m.ctrl.T.Helper()
@@ -77,6 +107,18 @@ func (mr *MockReceiveStreamIMockRecorder) SetReadDeadline(arg0 interface{}) *gom
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetReadDeadline", reflect.TypeOf((*MockReceiveStreamI)(nil).SetReadDeadline), arg0)
 }
 
+// SetReadNotifyThreshold mocks base method
+func (m *MockReceiveStreamI) SetReadNotifyThreshold(arg0 int) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "SetReadNotifyThreshold", arg0)
+}
+
+// SetReadNotifyThreshold indicates an expected call of SetReadNotifyThreshold
+func (mr *MockReceiveStreamIMockRecorder) SetReadNotifyThreshold(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetReadNotifyThreshold", reflect.TypeOf((*MockReceiveStreamI)(nil).SetReadNotifyThreshold), arg0)
+}
+
 // StreamID mocks base method
 func (m *MockReceiveStreamI) StreamID() protocol.StreamID {
 	m.ctrl.T.Helper()
@@ -91,6 +133,20 @@ func (mr *MockReceiveStreamIMockRecorder) StreamID() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "StreamID", reflect.TypeOf((*MockReceiveStreamI)(nil).StreamID))
 }
 
+// WaitForPeerFIN mocks base method
+func (m *MockReceiveStreamI) WaitForPeerFIN(arg0 context.Context) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "WaitForPeerFIN", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// WaitForPeerFIN indicates an expected call of WaitForPeerFIN
+func (mr *MockReceiveStreamIMockRecorder) WaitForPeerFIN(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "WaitForPeerFIN", reflect.TypeOf((*MockReceiveStreamI)(nil).WaitForPeerFIN), arg0)
+}
+
 // closeForShutdown mocks base method
 func (m *MockReceiveStreamI) closeForShutdown(arg0 error) {
 	m.ctrl.T.Helper()
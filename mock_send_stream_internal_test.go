@@ -63,6 +63,20 @@ func (mr *MockSendStreamIMockRecorder) Close() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Close", reflect.TypeOf((*MockSendStreamI)(nil).Close))
 }
 
+// CloseWrite mocks base method
+func (m *MockSendStreamI) CloseWrite() error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CloseWrite")
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CloseWrite indicates an expected call of CloseWrite
+func (mr *MockSendStreamIMockRecorder) CloseWrite() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CloseWrite", reflect.TypeOf((*MockSendStreamI)(nil).CloseWrite))
+}
+
 // Context mocks base method
 func (m *MockSendStreamI) Context() context.Context {
 	m.ctrl.T.Helper()
@@ -77,6 +91,32 @@ func (mr *MockSendStreamIMockRecorder) Context() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Context", reflect.TypeOf((*MockSendStreamI)(nil).Context))
 }
 
+// GrantedCredit mocks base method
+func (m *MockSendStreamI) GrantedCredit() protocol.ByteCount {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GrantedCredit")
+	ret0, _ := ret[0].(protocol.ByteCount)
+	return ret0
+}
+
+// GrantedCredit indicates an expected call of GrantedCredit
+func (mr *MockSendStreamIMockRecorder) GrantedCredit() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GrantedCredit", reflect.TypeOf((*MockSendStreamI)(nil).GrantedCredit))
+}
+
+// SetPriority mocks base method
+func (m *MockSendStreamI) SetPriority(arg0 uint8, arg1 bool) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "SetPriority", arg0, arg1)
+}
+
+// SetPriority indicates an expected call of SetPriority
+func (mr *MockSendStreamIMockRecorder) SetPriority(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetPriority", reflect.TypeOf((*MockSendStreamI)(nil).SetPriority), arg0, arg1)
+}
+
 // SetWriteDeadline mocks base method
 func (m *MockSendStreamI) SetWriteDeadline(arg0 time.Time) error {
 	m.ctrl.T.Helper()
@@ -46,8 +46,20 @@ func (mr *MockSessionRunnerMockRecorder) AddResetToken(arg0, arg1 interface{}) *
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddResetToken", reflect.TypeOf((*MockSessionRunner)(nil).AddResetToken), arg0, arg1)
 }
 
+// OnEarlySessionReady mocks base method
+func (m *MockSessionRunner) OnEarlySessionReady(arg0 quicSession) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "OnEarlySessionReady", arg0)
+}
+
+// OnEarlySessionReady indicates an expected call of OnEarlySessionReady
+func (mr *MockSessionRunnerMockRecorder) OnEarlySessionReady(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "OnEarlySessionReady", reflect.TypeOf((*MockSessionRunner)(nil).OnEarlySessionReady), arg0)
+}
+
 // OnHandshakeComplete mocks base method
-func (m *MockSessionRunner) OnHandshakeComplete(arg0 Session) {
+func (m *MockSessionRunner) OnHandshakeComplete(arg0 quicSession) {
 	m.ctrl.T.Helper()
 	m.ctrl.Call(m, "OnHandshakeComplete", arg0)
 }
@@ -75,6 +75,20 @@ func (mr *MockStreamIMockRecorder) Close() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Close", reflect.TypeOf((*MockStreamI)(nil).Close))
 }
 
+// CloseWrite mocks base method
+func (m *MockStreamI) CloseWrite() error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CloseWrite")
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CloseWrite indicates an expected call of CloseWrite
+func (mr *MockStreamIMockRecorder) CloseWrite() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CloseWrite", reflect.TypeOf((*MockStreamI)(nil).CloseWrite))
+}
+
 // Context mocks base method
 func (m *MockStreamI) Context() context.Context {
 	m.ctrl.T.Helper()
@@ -89,6 +103,20 @@ func (mr *MockStreamIMockRecorder) Context() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Context", reflect.TypeOf((*MockStreamI)(nil).Context))
 }
 
+// GrantedCredit mocks base method
+func (m *MockStreamI) GrantedCredit() protocol.ByteCount {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GrantedCredit")
+	ret0, _ := ret[0].(protocol.ByteCount)
+	return ret0
+}
+
+// GrantedCredit indicates an expected call of GrantedCredit
+func (mr *MockStreamIMockRecorder) GrantedCredit() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GrantedCredit", reflect.TypeOf((*MockStreamI)(nil).GrantedCredit))
+}
+
 // Read mocks base method
 func (m *MockStreamI) Read(arg0 []byte) (int, error) {
 	m.ctrl.T.Helper()
@@ -104,6 +132,35 @@ func (mr *MockStreamIMockRecorder) Read(arg0 interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Read", reflect.TypeOf((*MockStreamI)(nil).Read), arg0)
 }
 
+// ReadAvailable mocks base method
+func (m *MockStreamI) ReadAvailable() int {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReadAvailable")
+	ret0, _ := ret[0].(int)
+	return ret0
+}
+
+// ReadAvailable indicates an expected call of ReadAvailable
+func (mr *MockStreamIMockRecorder) ReadAvailable() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReadAvailable", reflect.TypeOf((*MockStreamI)(nil).ReadAvailable))
+}
+
+// ReorderStats mocks base method
+func (m *MockStreamI) ReorderStats() (protocol.ByteCount, uint64) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReorderStats")
+	ret0, _ := ret[0].(protocol.ByteCount)
+	ret1, _ := ret[1].(uint64)
+	return ret0, ret1
+}
+
+// ReorderStats indicates an expected call of ReorderStats
+func (mr *MockStreamIMockRecorder) ReorderStats() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReorderStats", reflect.TypeOf((*MockStreamI)(nil).ReorderStats))
+}
+
 // SetDeadline mocks base method
 func (m *MockStreamI) SetDeadline(arg0 time.Time) error {
 	m.ctrl.T.Helper()
@@ -118,6 +175,18 @@ func (mr *MockStreamIMockRecorder) SetDeadline(arg0 interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetDeadline", reflect.TypeOf((*MockStreamI)(nil).SetDeadline), arg0)
 }
 
+// SetPriority mocks base method
+func (m *MockStreamI) SetPriority(arg0 uint8, arg1 bool) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "SetPriority", arg0, arg1)
+}
+
+// SetPriority indicates an expected call of SetPriority
+func (mr *MockStreamIMockRecorder) SetPriority(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetPriority", reflect.TypeOf((*MockStreamI)(nil).SetPriority), arg0, arg1)
+}
+
 // SetReadDeadline mocks base method
 func (m *MockStreamI) SetReadDeadline(arg0 time.Time) error {
 	m.ctrl.T.Helper()
@@ -132,6 +201,18 @@ func (mr *MockStreamIMockRecorder) SetReadDeadline(arg0 interface{}) *gomock.Cal
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetReadDeadline", reflect.TypeOf((*MockStreamI)(nil).SetReadDeadline), arg0)
 }
 
+// SetReadNotifyThreshold mocks base method
+func (m *MockStreamI) SetReadNotifyThreshold(arg0 int) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "SetReadNotifyThreshold", arg0)
+}
+
+// SetReadNotifyThreshold indicates an expected call of SetReadNotifyThreshold
+func (mr *MockStreamIMockRecorder) SetReadNotifyThreshold(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetReadNotifyThreshold", reflect.TypeOf((*MockStreamI)(nil).SetReadNotifyThreshold), arg0)
+}
+
 // SetWriteDeadline mocks base method
 func (m *MockStreamI) SetWriteDeadline(arg0 time.Time) error {
 	m.ctrl.T.Helper()
@@ -160,6 +241,20 @@ func (mr *MockStreamIMockRecorder) StreamID() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "StreamID", reflect.TypeOf((*MockStreamI)(nil).StreamID))
 }
 
+// WaitForPeerFIN mocks base method
+func (m *MockStreamI) WaitForPeerFIN(arg0 context.Context) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "WaitForPeerFIN", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// WaitForPeerFIN indicates an expected call of WaitForPeerFIN
+func (mr *MockStreamIMockRecorder) WaitForPeerFIN(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "WaitForPeerFIN", reflect.TypeOf((*MockStreamI)(nil).WaitForPeerFIN), arg0)
+}
+
 // Write mocks base method
 func (m *MockStreamI) Write(arg0 []byte) (int, error) {
 	m.ctrl.T.Helper()
@@ -196,6 +196,20 @@ func (mr *MockStreamManagerMockRecorder) OpenUniStreamSync() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "OpenUniStreamSync", reflect.TypeOf((*MockStreamManager)(nil).OpenUniStreamSync))
 }
 
+// SendStreamState mocks base method
+func (m *MockStreamManager) SendStreamState(arg0 protocol.StreamID) streamState {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SendStreamState", arg0)
+	ret0, _ := ret[0].(streamState)
+	return ret0
+}
+
+// SendStreamState indicates an expected call of SendStreamState
+func (mr *MockStreamManagerMockRecorder) SendStreamState(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SendStreamState", reflect.TypeOf((*MockStreamManager)(nil).SendStreamState), arg0)
+}
+
 // UpdateLimits mocks base method
 func (m *MockStreamManager) UpdateLimits(arg0 *handshake.TransportParameters) error {
 	m.ctrl.T.Helper()
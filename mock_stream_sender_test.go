@@ -47,16 +47,28 @@ func (mr *MockStreamSenderMockRecorder) onHasStreamData(arg0 interface{}) *gomoc
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "onHasStreamData", reflect.TypeOf((*MockStreamSender)(nil).onHasStreamData), arg0)
 }
 
+// onReadAvailable mocks base method
+func (m *MockStreamSender) onReadAvailable(arg0 ReceiveStream, arg1 int) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "onReadAvailable", arg0, arg1)
+}
+
+// onReadAvailable indicates an expected call of onReadAvailable
+func (mr *MockStreamSenderMockRecorder) onReadAvailable(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "onReadAvailable", reflect.TypeOf((*MockStreamSender)(nil).onReadAvailable), arg0, arg1)
+}
+
 // onStreamCompleted mocks base method
-func (m *MockStreamSender) onStreamCompleted(arg0 protocol.StreamID) {
+func (m *MockStreamSender) onStreamCompleted(arg0 protocol.StreamID, arg1 error) {
 	m.ctrl.T.Helper()
-	m.ctrl.Call(m, "onStreamCompleted", arg0)
+	m.ctrl.Call(m, "onStreamCompleted", arg0, arg1)
 }
 
 // onStreamCompleted indicates an expected call of onStreamCompleted
-func (mr *MockStreamSenderMockRecorder) onStreamCompleted(arg0 interface{}) *gomock.Call {
+func (mr *MockStreamSenderMockRecorder) onStreamCompleted(arg0, arg1 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "onStreamCompleted", reflect.TypeOf((*MockStreamSender)(nil).onStreamCompleted), arg0)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "onStreamCompleted", reflect.TypeOf((*MockStreamSender)(nil).onStreamCompleted), arg0, arg1)
 }
 
 // queueControlFrame mocks base method
@@ -70,3 +82,29 @@ func (mr *MockStreamSenderMockRecorder) queueControlFrame(arg0 interface{}) *gom
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "queueControlFrame", reflect.TypeOf((*MockStreamSender)(nil).queueControlFrame), arg0)
 }
+
+// setStreamPriority mocks base method
+func (m *MockStreamSender) setStreamPriority(arg0 protocol.StreamID, arg1 uint8, arg2 bool) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "setStreamPriority", arg0, arg1, arg2)
+}
+
+// setStreamPriority indicates an expected call of setStreamPriority
+func (mr *MockStreamSenderMockRecorder) setStreamPriority(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "setStreamPriority", reflect.TypeOf((*MockStreamSender)(nil).setStreamPriority), arg0, arg1, arg2)
+}
+
+// testingTB mocks base method
+func (m *MockStreamSender) testingTB() TB {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "testingTB")
+	ret0, _ := ret[0].(TB)
+	return ret0
+}
+
+// testingTB indicates an expected call of testingTB
+func (mr *MockStreamSenderMockRecorder) testingTB() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "testingTB", reflect.TypeOf((*MockStreamSender)(nil).testingTB))
+}
@@ -47,6 +47,18 @@ func (mr *MockUnknownPacketHandlerMockRecorder) closeWithError(arg0 interface{})
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "closeWithError", reflect.TypeOf((*MockUnknownPacketHandler)(nil).closeWithError), arg0)
 }
 
+// droppedPacket mocks base method
+func (m *MockUnknownPacketHandler) droppedPacket(arg0 PacketDropReason) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "droppedPacket", arg0)
+}
+
+// droppedPacket indicates an expected call of droppedPacket
+func (mr *MockUnknownPacketHandlerMockRecorder) droppedPacket(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "droppedPacket", reflect.TypeOf((*MockUnknownPacketHandler)(nil).droppedPacket), arg0)
+}
+
 // handlePacket mocks base method
 func (m *MockUnknownPacketHandler) handlePacket(arg0 *receivedPacket) {
 	m.ctrl.T.Helper()
@@ -58,3 +70,15 @@ func (mr *MockUnknownPacketHandlerMockRecorder) handlePacket(arg0 interface{}) *
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "handlePacket", reflect.TypeOf((*MockUnknownPacketHandler)(nil).handlePacket), arg0)
 }
+
+// sentStatelessReset mocks base method
+func (m *MockUnknownPacketHandler) sentStatelessReset() {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "sentStatelessReset")
+}
+
+// sentStatelessReset indicates an expected call of sentStatelessReset
+func (mr *MockUnknownPacketHandlerMockRecorder) sentStatelessReset() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "sentStatelessReset", reflect.TypeOf((*MockUnknownPacketHandler)(nil).sentStatelessReset))
+}
@@ -19,3 +19,5 @@ package quic
 //go:generate sh -c "./mockgen_private.sh quic mock_unknown_packet_handler_test.go github.com/lucas-clemente/quic-go unknownPacketHandler"
 //go:generate sh -c "./mockgen_private.sh quic mock_packet_handler_manager_test.go github.com/lucas-clemente/quic-go packetHandlerManager"
 //go:generate sh -c "./mockgen_private.sh quic mock_multiplexer_test.go github.com/lucas-clemente/quic-go multiplexer"
+//go:generate sh -c "mockgen -package quic -self_package quic -destination mock_connection_tracer_test.go github.com/lucas-clemente/quic-go ConnectionTracer && sed -i '' 's/quic_go.//g' mock_connection_tracer_test.go && goimports -w mock_connection_tracer_test.go"
+//go:generate sh -c "mockgen -package quic -self_package quic -destination mock_connection_capture_test.go github.com/lucas-clemente/quic-go ConnectionCapture && sed -i '' 's/quic_go.//g' mock_connection_capture_test.go && goimports -w mock_connection_capture_test.go"
@@ -0,0 +1,69 @@
+package quic
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+)
+
+// packetDropCounters counts the dropped packets by drop reason.
+// It is safe for concurrent use.
+type packetDropCounters [numPacketDropReasons]uint64
+
+func (c *packetDropCounters) Add(reason PacketDropReason) {
+	atomic.AddUint64(&c[reason], 1)
+}
+
+// Snapshot returns the number of dropped packets for every reason that at least one packet was dropped for.
+// It returns nil if no packets were dropped.
+func (c *packetDropCounters) Snapshot() map[PacketDropReason]uint64 {
+	var m map[PacketDropReason]uint64
+	for i := range c {
+		n := atomic.LoadUint64(&c[i])
+		if n == 0 {
+			continue
+		}
+		if m == nil {
+			m = make(map[PacketDropReason]uint64)
+		}
+		m[PacketDropReason(i)] = n
+	}
+	return m
+}
+
+// droppedPacket is called from the run loop when a packet is dropped.
+func (s *session) droppedPacket(p *receivedPacket, reason PacketDropReason) {
+	s.droppedPackets.Add(reason)
+	if reason == PacketDropPayloadDecryptError && s.decryptErrors.ReceivedDecryptError(p.rcvTime) {
+		s.logger.Errorf("Warning: %d packets failed to decrypt in the last %s. This might be caused by a bug in the key update or the header protection.", s.decryptErrors.count, protocol.DecryptErrorWarningInterval)
+	}
+	if s.tracer != nil {
+		s.tracer.DroppedPacket(protocol.ByteCount(len(p.data)), reason)
+	}
+}
+
+// The decryptErrorMonitor detects an abnormal rate of packets that fail to decrypt.
+// A few undecryptable packets are expected (e.g. packets injected by an attacker, or corrupted on the path),
+// but a high rate often indicates a bug in the key update or the header protection.
+type decryptErrorMonitor struct {
+	intervalStart time.Time
+	count         int
+	warned        bool
+}
+
+// ReceivedDecryptError registers a packet that failed to decrypt.
+// It returns true if a warning should be logged, which happens at most once per protocol.DecryptErrorWarningInterval.
+func (m *decryptErrorMonitor) ReceivedDecryptError(now time.Time) bool {
+	if now.Sub(m.intervalStart) >= protocol.DecryptErrorWarningInterval {
+		m.intervalStart = now
+		m.count = 0
+		m.warned = false
+	}
+	m.count++
+	if m.count < protocol.DecryptErrorWarningThreshold || m.warned {
+		return false
+	}
+	m.warned = true
+	return true
+}
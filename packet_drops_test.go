@@ -0,0 +1,76 @@
+package quic
+
+import (
+	"time"
+
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Packet Drops", func() {
+	It("has a string representation for every drop reason", func() {
+		for i := 0; i < numPacketDropReasons; i++ {
+			Expect(PacketDropReason(i).String()).ToNot(Equal("unknown drop reason"))
+		}
+		Expect(PacketDropReason(numPacketDropReasons).String()).To(Equal("unknown drop reason"))
+	})
+
+	Context("counting", func() {
+		It("returns nil if no packets were dropped", func() {
+			var c packetDropCounters
+			Expect(c.Snapshot()).To(BeNil())
+		})
+
+		It("counts by drop reason", func() {
+			var c packetDropCounters
+			c.Add(PacketDropDuplicate)
+			c.Add(PacketDropUnsupportedVersion)
+			c.Add(PacketDropDuplicate)
+			Expect(c.Snapshot()).To(Equal(map[PacketDropReason]uint64{
+				PacketDropDuplicate:          2,
+				PacketDropUnsupportedVersion: 1,
+			}))
+		})
+	})
+
+	Context("detecting an abnormal rate of decryption errors", func() {
+		var m *decryptErrorMonitor
+
+		BeforeEach(func() {
+			m = &decryptErrorMonitor{}
+		})
+
+		It("warns when the threshold is reached", func() {
+			now := time.Now()
+			for i := 0; i < protocol.DecryptErrorWarningThreshold-1; i++ {
+				Expect(m.ReceivedDecryptError(now)).To(BeFalse())
+			}
+			Expect(m.ReceivedDecryptError(now)).To(BeTrue())
+		})
+
+		It("warns only once per interval", func() {
+			now := time.Now()
+			for i := 0; i < protocol.DecryptErrorWarningThreshold; i++ {
+				m.ReceivedDecryptError(now)
+			}
+			for i := 0; i < protocol.DecryptErrorWarningThreshold; i++ {
+				Expect(m.ReceivedDecryptError(now.Add(protocol.DecryptErrorWarningInterval / 2))).To(BeFalse())
+			}
+			later := now.Add(protocol.DecryptErrorWarningInterval)
+			for i := 0; i < protocol.DecryptErrorWarningThreshold-1; i++ {
+				Expect(m.ReceivedDecryptError(later)).To(BeFalse())
+			}
+			Expect(m.ReceivedDecryptError(later)).To(BeTrue())
+		})
+
+		It("doesn't warn if the decryption errors are spread over multiple intervals", func() {
+			now := time.Now()
+			for i := 0; i < 3*protocol.DecryptErrorWarningThreshold; i++ {
+				t := now.Add(time.Duration(i) * protocol.DecryptErrorWarningInterval / protocol.DecryptErrorWarningThreshold * 2)
+				Expect(m.ReceivedDecryptError(t)).To(BeFalse())
+			}
+		})
+	})
+})
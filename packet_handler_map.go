@@ -15,21 +15,37 @@ import (
 	"github.com/lucas-clemente/quic-go/internal/wire"
 )
 
+// packetHandlerMapShards is the number of shards of the packetHandlerMap.
+// It must be a power of 2.
+const packetHandlerMapShards = 16
+
+// A packetHandlerShard stores a part of the packet handlers and stateless reset tokens.
+// Packets for different shards can be handled without contending for the same lock.
+type packetHandlerShard struct {
+	mutex sync.RWMutex
+
+	handlers    map[string] /* string(ConnectionID)*/ packetHandler
+	resetTokens map[[16]byte] /* stateless reset token */ packetHandler
+}
+
 // The packetHandlerMap stores packetHandlers, identified by connection ID.
 // It is used:
 // * by the server to store sessions
 // * when multiplexing outgoing connections to store clients
+// To reduce lock contention, the handlers are split into shards by a hash of their connection ID.
+// The mutex only protects the server and the state of the map.
 type packetHandlerMap struct {
 	mutex sync.RWMutex
 
-	conn      net.PacketConn
-	connIDLen int
+	conn            net.PacketConn
+	additionalConns []net.PacketConn // conns added with AddListenConn, owned by the packetHandlerMap
+	connIDLen       int
 
-	handlers    map[string] /* string(ConnectionID)*/ packetHandler
-	resetTokens map[[16]byte] /* stateless reset token */ packetHandler
-	server      unknownPacketHandler
+	shards [packetHandlerMapShards]packetHandlerShard
+	server unknownPacketHandler
 
-	listening chan struct{} // is closed when listen returns
+	listeners sync.WaitGroup
+	listening chan struct{} // is closed when all listen loops have returned
 	closed    bool
 
 	deleteRetiredSessionsAfter time.Duration
@@ -52,21 +68,62 @@ func newPacketHandlerMap(
 		conn:                       conn,
 		connIDLen:                  connIDLen,
 		listening:                  make(chan struct{}),
-		handlers:                   make(map[string]packetHandler),
-		resetTokens:                make(map[[16]byte]packetHandler),
 		deleteRetiredSessionsAfter: protocol.RetiredConnectionIDDeleteTimeout,
 		statelessResetEnabled:      len(statelessResetKey) > 0,
 		statelessResetHasher:       hmac.New(sha256.New, statelessResetKey),
 		logger:                     logger,
 	}
-	go m.listen()
+	for i := range m.shards {
+		m.shards[i].handlers = make(map[string]packetHandler)
+		m.shards[i].resetTokens = make(map[[16]byte]packetHandler)
+	}
+	m.listeners.Add(1)
+	go m.listen(conn)
+	go func() {
+		m.listeners.Wait()
+		close(m.listening)
+	}()
 	return m
 }
 
-func (h *packetHandlerMap) Add(id protocol.ConnectionID, handler packetHandler) {
+// AddListenConn adds another conn that packets are read from.
+// It is used to read from multiple sockets bound to the same address using SO_REUSEPORT.
+// Packets are passed to the packet handlers regardless of the conn they were received on.
+// The conn is closed when the packetHandlerMap is closed.
+func (h *packetHandlerMap) AddListenConn(conn net.PacketConn) error {
 	h.mutex.Lock()
-	h.handlers[string(id)] = handler
-	h.mutex.Unlock()
+	defer h.mutex.Unlock()
+	if h.closed {
+		return errors.New("packet handler map already closed")
+	}
+	h.additionalConns = append(h.additionalConns, conn)
+	h.listeners.Add(1)
+	go h.listen(conn)
+	return nil
+}
+
+// shardForConnID returns the shard that stores the handler for a connection ID.
+// It uses the FNV-1a hash of the connection ID.
+func (h *packetHandlerMap) shardForConnID(id string) *packetHandlerShard {
+	hash := uint32(2166136261)
+	for i := 0; i < len(id); i++ {
+		hash ^= uint32(id[i])
+		hash *= 16777619
+	}
+	return &h.shards[hash&(packetHandlerMapShards-1)]
+}
+
+// shardForResetToken returns the shard that stores the handler for a stateless reset token.
+// Stateless reset tokens are indistinguishable from random, so there's no need to hash them.
+func (h *packetHandlerMap) shardForResetToken(token [16]byte) *packetHandlerShard {
+	return &h.shards[token[0]&(packetHandlerMapShards-1)]
+}
+
+func (h *packetHandlerMap) Add(id protocol.ConnectionID, handler packetHandler) {
+	shard := h.shardForConnID(string(id))
+	shard.mutex.Lock()
+	shard.handlers[string(id)] = handler
+	shard.mutex.Unlock()
 }
 
 func (h *packetHandlerMap) Remove(id protocol.ConnectionID) {
@@ -74,9 +131,10 @@ func (h *packetHandlerMap) Remove(id protocol.ConnectionID) {
 }
 
 func (h *packetHandlerMap) removeByConnectionIDAsString(id string) {
-	h.mutex.Lock()
-	delete(h.handlers, id)
-	h.mutex.Unlock()
+	shard := h.shardForConnID(id)
+	shard.mutex.Lock()
+	delete(shard.handlers, id)
+	shard.mutex.Unlock()
 }
 
 func (h *packetHandlerMap) Retire(id protocol.ConnectionID) {
@@ -90,15 +148,17 @@ func (h *packetHandlerMap) retireByConnectionIDAsString(id string) {
 }
 
 func (h *packetHandlerMap) AddResetToken(token [16]byte, handler packetHandler) {
-	h.mutex.Lock()
-	h.resetTokens[token] = handler
-	h.mutex.Unlock()
+	shard := h.shardForResetToken(token)
+	shard.mutex.Lock()
+	shard.resetTokens[token] = handler
+	shard.mutex.Unlock()
 }
 
 func (h *packetHandlerMap) RemoveResetToken(token [16]byte) {
-	h.mutex.Lock()
-	delete(h.resetTokens, token)
-	h.mutex.Unlock()
+	shard := h.shardForResetToken(token)
+	shard.mutex.Lock()
+	delete(shard.resetTokens, token)
+	shard.mutex.Unlock()
 }
 
 func (h *packetHandlerMap) SetServer(s unknownPacketHandler) {
@@ -107,23 +167,12 @@ func (h *packetHandlerMap) SetServer(s unknownPacketHandler) {
 	h.mutex.Unlock()
 }
 
+// CloseServer stops passing packets with unknown connection IDs to the server.
+// Sessions that were already created by the server are not closed.
 func (h *packetHandlerMap) CloseServer() {
 	h.mutex.Lock()
 	h.server = nil
-	var wg sync.WaitGroup
-	for id, handler := range h.handlers {
-		if handler.getPerspective() == protocol.PerspectiveServer {
-			wg.Add(1)
-			go func(id string, handler packetHandler) {
-				// session.Close() blocks until the CONNECTION_CLOSE has been sent and the run-loop has stopped
-				_ = handler.Close()
-				h.retireByConnectionIDAsString(id)
-				wg.Done()
-			}(id, handler)
-		}
-	}
 	h.mutex.Unlock()
-	wg.Wait()
 }
 
 // Close the underlying connection and wait until listen() has returned.
@@ -144,39 +193,49 @@ func (h *packetHandlerMap) close(e error) error {
 	h.closed = true
 
 	var wg sync.WaitGroup
-	for _, handler := range h.handlers {
-		wg.Add(1)
-		go func(handler packetHandler) {
-			handler.destroy(e)
-			wg.Done()
-		}(handler)
+	for i := range h.shards {
+		shard := &h.shards[i]
+		shard.mutex.RLock()
+		for _, handler := range shard.handlers {
+			wg.Add(1)
+			go func(handler packetHandler) {
+				handler.destroy(e)
+				wg.Done()
+			}(handler)
+		}
+		shard.mutex.RUnlock()
 	}
 
 	if h.server != nil {
 		h.server.closeWithError(e)
 	}
+	// make the listen loops of the additional conns return
+	for _, c := range h.additionalConns {
+		c.Close()
+	}
 	h.mutex.Unlock()
 	wg.Wait()
 	return getMultiplexer().RemoveConn(h.conn)
 }
 
-func (h *packetHandlerMap) listen() {
-	defer close(h.listening)
+func (h *packetHandlerMap) listen(conn net.PacketConn) {
+	defer h.listeners.Done()
 	for {
 		buffer := getPacketBuffer()
 		data := buffer.Slice
 		// The packet size should not exceed protocol.MaxReceivePacketSize bytes
 		// If it does, we only read a truncated packet, which will then end up undecryptable
-		n, addr, err := h.conn.ReadFrom(data)
+		n, addr, err := conn.ReadFrom(data)
 		if err != nil {
 			h.close(err)
 			return
 		}
-		h.handlePacket(addr, buffer, data[:n])
+		h.handlePacket(conn, addr, buffer, data[:n])
 	}
 }
 
 func (h *packetHandlerMap) handlePacket(
+	conn net.PacketConn,
 	addr net.Addr,
 	buffer *packetBuffer,
 	data []byte,
@@ -184,33 +243,39 @@ func (h *packetHandlerMap) handlePacket(
 	connID, err := wire.ParseConnectionID(data, h.connIDLen)
 	if err != nil {
 		h.logger.Debugf("error parsing connection ID on packet from %s: %s", addr, err)
+		h.droppedPacket(PacketDropHeaderParseError)
 		return
 	}
 	rcvTime := time.Now()
 
-	h.mutex.RLock()
-	defer h.mutex.RUnlock()
-
 	if isStatelessReset := h.maybeHandleStatelessReset(data); isStatelessReset {
 		return
 	}
 
-	handler, handlerFound := h.handlers[string(connID)]
-
 	p := &receivedPacket{
+		conn:       conn,
 		remoteAddr: addr,
 		rcvTime:    rcvTime,
 		buffer:     buffer,
 		data:       data,
 	}
+	shard := h.shardForConnID(string(connID))
+	shard.mutex.RLock()
+	handler, handlerFound := shard.handlers[string(connID)]
 	if handlerFound { // existing session
 		handler.handlePacket(p)
+		shard.mutex.RUnlock()
 		return
 	}
+	shard.mutex.RUnlock()
 	if data[0]&0x80 == 0 {
+		h.droppedPacket(PacketDropUnknownConnectionID)
 		go h.maybeSendStatelessReset(p, connID)
 		return
 	}
+
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
 	if h.server == nil { // no server set
 		h.logger.Debugf("received a packet with an unexpected connection ID %s", connID)
 		return
@@ -218,6 +283,17 @@ func (h *packetHandlerMap) handlePacket(
 	h.server.handlePacket(p)
 }
 
+// droppedPacket reports a dropped packet to the server, if there is one.
+func (h *packetHandlerMap) droppedPacket(reason PacketDropReason) {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+	if h.server != nil {
+		h.server.droppedPacket(reason)
+	}
+}
+
+var errStatelessReset = errors.New("received a stateless reset")
+
 func (h *packetHandlerMap) maybeHandleStatelessReset(data []byte) bool {
 	// stateless resets are always short header packets
 	if data[0]&0x80 != 0 {
@@ -229,9 +305,13 @@ func (h *packetHandlerMap) maybeHandleStatelessReset(data []byte) bool {
 
 	var token [16]byte
 	copy(token[:], data[len(data)-16:])
-	if sess, ok := h.resetTokens[token]; ok {
+	shard := h.shardForResetToken(token)
+	shard.mutex.RLock()
+	sess, ok := shard.resetTokens[token]
+	shard.mutex.RUnlock()
+	if ok {
 		h.logger.Debugf("Received a stateless retry with token %#x. Closing session.", token)
-		go sess.destroy(errors.New("received a stateless reset"))
+		go sess.destroy(errStatelessReset)
 		return true
 	}
 	return false
@@ -268,7 +348,17 @@ func (h *packetHandlerMap) maybeSendStatelessReset(p *receivedPacket, connID pro
 	rand.Read(data)
 	data[0] = (data[0] & 0x7f) | 0x40
 	data = append(data, token[:]...)
-	if _, err := h.conn.WriteTo(data, p.remoteAddr); err != nil {
+	conn := h.conn
+	if p.conn != nil {
+		conn = p.conn
+	}
+	if _, err := conn.WriteTo(data, p.remoteAddr); err != nil {
 		h.logger.Debugf("Error sending Stateless Reset: %s", err)
+		return
+	}
+	h.mutex.RLock()
+	if h.server != nil {
+		h.server.sentStatelessReset()
 	}
+	h.mutex.RUnlock()
 }
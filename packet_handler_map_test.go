@@ -5,6 +5,8 @@ import (
 	"crypto/rand"
 	"errors"
 	"net"
+	"sync"
+	"testing"
 	"time"
 
 	"github.com/golang/mock/gomock"
@@ -56,10 +58,15 @@ var _ = Describe("Packet Handler Map", func() {
 	AfterEach(func() {
 		// delete sessions and the server before closing
 		// They might be mock implementations, and we'd have to register the expected calls before otherwise.
-		handler.mutex.Lock()
-		for connID := range handler.handlers {
-			delete(handler.handlers, connID)
+		for i := range handler.shards {
+			shard := &handler.shards[i]
+			shard.mutex.Lock()
+			for connID := range shard.handlers {
+				delete(shard.handlers, connID)
+			}
+			shard.mutex.Unlock()
 		}
+		handler.mutex.Lock()
 		handler.server = nil
 		handler.mutex.Unlock()
 		handler.Close()
@@ -121,8 +128,57 @@ var _ = Describe("Packet Handler Map", func() {
 			Eventually(handledPacket2).Should(BeClosed())
 		})
 
+		It("distributes the packet handlers across shards", func() {
+			const num = 200
+			handled := make(chan protocol.ConnectionID, num)
+			var connIDs []protocol.ConnectionID
+			for i := 0; i < num; i++ {
+				connID := make(protocol.ConnectionID, 8)
+				rand.Read(connID)
+				connIDs = append(connIDs, connID)
+				packetHandler := NewMockPacketHandler(mockCtrl)
+				packetHandler.EXPECT().handlePacket(gomock.Any()).Do(func(p *receivedPacket) {
+					connID, err := wire.ParseConnectionID(p.data, 0)
+					Expect(err).ToNot(HaveOccurred())
+					handled <- connID
+				})
+				handler.Add(connID, packetHandler)
+			}
+			for i := range handler.shards {
+				Expect(handler.shards[i].handlers).ToNot(BeEmpty())
+			}
+			for _, connID := range connIDs {
+				handler.handlePacket(nil, nil, nil, getPacket(connID))
+				Expect(handled).To(Receive(Equal(connID)))
+			}
+		})
+
+		It("handles packets received on additional conns", func() {
+			conn2 := newMockPacketConn()
+			Expect(handler.AddListenConn(conn2)).To(Succeed())
+			connID := protocol.ConnectionID{1, 2, 3, 4, 5, 6, 7, 8}
+			packetHandler := NewMockPacketHandler(mockCtrl)
+			handledPacket := make(chan struct{})
+			packetHandler.EXPECT().handlePacket(gomock.Any()).Do(func(p *receivedPacket) {
+				Expect(p.conn).To(Equal(conn2))
+				close(handledPacket)
+			})
+			handler.Add(connID, packetHandler)
+			conn2.dataToRead <- getPacket(connID)
+			Eventually(handledPacket).Should(BeClosed())
+		})
+
+		It("closes additional conns when closing", func() {
+			conn2 := newMockPacketConn()
+			Expect(handler.AddListenConn(conn2)).To(Succeed())
+			Expect(handler.Close()).To(Succeed())
+			Eventually(handler.listening).Should(BeClosed())
+			Expect(conn2.closed).To(BeTrue())
+			Expect(handler.AddListenConn(newMockPacketConn())).To(MatchError("packet handler map already closed"))
+		})
+
 		It("drops unparseable packets", func() {
-			handler.handlePacket(nil, nil, []byte{0, 1, 2, 3})
+			handler.handlePacket(nil, nil, nil, []byte{0, 1, 2, 3})
 		})
 
 		It("deletes removed sessions immediately", func() {
@@ -130,7 +186,7 @@ var _ = Describe("Packet Handler Map", func() {
 			connID := protocol.ConnectionID{1, 2, 3, 4, 5, 6, 7, 8}
 			handler.Add(connID, NewMockPacketHandler(mockCtrl))
 			handler.Remove(connID)
-			handler.handlePacket(nil, nil, getPacket(connID))
+			handler.handlePacket(nil, nil, nil, getPacket(connID))
 			// don't EXPECT any calls to handlePacket of the MockPacketHandler
 		})
 
@@ -140,7 +196,7 @@ var _ = Describe("Packet Handler Map", func() {
 			handler.Add(connID, NewMockPacketHandler(mockCtrl))
 			handler.Retire(connID)
 			time.Sleep(scaleDuration(30 * time.Millisecond))
-			handler.handlePacket(nil, nil, getPacket(connID))
+			handler.handlePacket(nil, nil, nil, getPacket(connID))
 			// don't EXPECT any calls to handlePacket of the MockPacketHandler
 		})
 
@@ -154,13 +210,13 @@ var _ = Describe("Packet Handler Map", func() {
 			})
 			handler.Add(connID, packetHandler)
 			handler.Retire(connID)
-			handler.handlePacket(nil, nil, getPacket(connID))
+			handler.handlePacket(nil, nil, nil, getPacket(connID))
 			Eventually(handled).Should(BeClosed())
 		})
 
 		It("drops packets for unknown receivers", func() {
 			connID := protocol.ConnectionID{1, 2, 3, 4, 5, 6, 7, 8}
-			handler.handlePacket(nil, nil, getPacket(connID))
+			handler.handlePacket(nil, nil, nil, getPacket(connID))
 		})
 
 		It("closes the packet handlers when reading from the conn fails", func() {
@@ -187,15 +243,27 @@ var _ = Describe("Packet Handler Map", func() {
 				Expect(cid).To(Equal(connID))
 			})
 			handler.SetServer(server)
-			handler.handlePacket(nil, nil, p)
+			handler.handlePacket(nil, nil, nil, p)
+		})
+
+		It("tells the server about unparseable packets", func() {
+			server := NewMockUnknownPacketHandler(mockCtrl)
+			server.EXPECT().droppedPacket(PacketDropHeaderParseError)
+			handler.SetServer(server)
+			handler.handlePacket(nil, nil, nil, []byte{0x80, 1, 2, 3})
 		})
 
-		It("closes all server sessions", func() {
+		It("tells the server about short header packets with unknown connection IDs", func() {
+			server := NewMockUnknownPacketHandler(mockCtrl)
+			server.EXPECT().droppedPacket(PacketDropUnknownConnectionID)
+			handler.SetServer(server)
+			handler.handlePacket(nil, nil, getPacketBuffer(), append([]byte{0x40}, make([]byte, 20)...))
+		})
+
+		It("doesn't close sessions when the server is closed", func() {
+			// don't EXPECT any calls to Close
 			clientSess := NewMockPacketHandler(mockCtrl)
-			clientSess.EXPECT().getPerspective().Return(protocol.PerspectiveClient)
 			serverSess := NewMockPacketHandler(mockCtrl)
-			serverSess.EXPECT().getPerspective().Return(protocol.PerspectiveServer)
-			serverSess.EXPECT().Close()
 
 			handler.Add(protocol.ConnectionID{1, 1, 1, 1}, clientSess)
 			handler.Add(protocol.ConnectionID{2, 2, 2, 2}, serverSess)
@@ -209,7 +277,7 @@ var _ = Describe("Packet Handler Map", func() {
 			// don't EXPECT any calls to server.handlePacket
 			handler.SetServer(server)
 			handler.CloseServer()
-			handler.handlePacket(nil, nil, p)
+			handler.handlePacket(nil, nil, nil, p)
 		})
 	})
 
@@ -260,7 +328,7 @@ var _ = Describe("Packet Handler Map", func() {
 				p := append([]byte{0x40} /* short header packet */, connID.Bytes()...)
 				p = append(p, make([]byte, 50)...)
 				p = append(p, token[:]...)
-				handler.handlePacket(nil, nil, p)
+				handler.handlePacket(nil, nil, nil, p)
 				// destroy() would be called from a separate go routine
 				// make sure we give it enough time to be called to cause an error here
 				time.Sleep(scaleDuration(25 * time.Millisecond))
@@ -285,7 +353,7 @@ var _ = Describe("Packet Handler Map", func() {
 			It("sends stateless resets", func() {
 				addr := &net.UDPAddr{IP: net.IPv4(192, 168, 0, 1), Port: 1337}
 				p := append([]byte{40}, make([]byte, 100)...)
-				handler.handlePacket(addr, getPacketBuffer(), p)
+				handler.handlePacket(nil, addr, getPacketBuffer(), p)
 				var reset mockPacketConnWrite
 				Eventually(conn.dataWritten).Should(Receive(&reset))
 				Expect(reset.to).To(Equal(addr))
@@ -293,10 +361,32 @@ var _ = Describe("Packet Handler Map", func() {
 				Expect(reset.data).To(HaveLen(protocol.MinStatelessResetSize))
 			})
 
+			It("tells the server when it sends a stateless reset", func() {
+				server := NewMockUnknownPacketHandler(mockCtrl)
+				handler.SetServer(server)
+				done := make(chan struct{})
+				server.EXPECT().droppedPacket(PacketDropUnknownConnectionID)
+				server.EXPECT().sentStatelessReset().Do(func() { close(done) })
+				addr := &net.UDPAddr{IP: net.IPv4(192, 168, 0, 1), Port: 1337}
+				p := append([]byte{40}, make([]byte, 100)...)
+				handler.handlePacket(nil, addr, getPacketBuffer(), p)
+				Eventually(conn.dataWritten).Should(Receive())
+				Eventually(done).Should(BeClosed())
+			})
+
+			It("sends stateless resets on the conn the packet was received on", func() {
+				conn2 := newMockPacketConn()
+				addr := &net.UDPAddr{IP: net.IPv4(192, 168, 0, 1), Port: 1337}
+				p := append([]byte{40}, make([]byte, 100)...)
+				handler.handlePacket(conn2, addr, getPacketBuffer(), p)
+				Eventually(conn2.dataWritten).Should(Receive())
+				Consistently(conn.dataWritten).ShouldNot(Receive())
+			})
+
 			It("doesn't send stateless resets for small packets", func() {
 				addr := &net.UDPAddr{IP: net.IPv4(192, 168, 0, 1), Port: 1337}
 				p := append([]byte{40}, make([]byte, protocol.MinStatelessResetSize-2)...)
-				handler.handlePacket(addr, getPacketBuffer(), p)
+				handler.handlePacket(nil, addr, getPacketBuffer(), p)
 				Consistently(conn.dataWritten).ShouldNot(Receive())
 			})
 		})
@@ -305,9 +395,50 @@ var _ = Describe("Packet Handler Map", func() {
 			It("doesn't send stateless resets", func() {
 				addr := &net.UDPAddr{IP: net.IPv4(192, 168, 0, 1), Port: 1337}
 				p := append([]byte{40}, make([]byte, 100)...)
-				handler.handlePacket(addr, getPacketBuffer(), p)
+				handler.handlePacket(nil, addr, getPacketBuffer(), p)
 				Consistently(conn.dataWritten).ShouldNot(Receive())
 			})
 		})
 	})
 })
+
+type benchmarkPacketHandler struct{}
+
+func (h *benchmarkPacketHandler) handlePacket(*receivedPacket) {}
+func (h *benchmarkPacketHandler) Close() error                 { return nil }
+func (h *benchmarkPacketHandler) destroy(error)                {}
+func (h *benchmarkPacketHandler) getPerspective() protocol.Perspective {
+	return protocol.PerspectiveServer
+}
+
+// BenchmarkPacketHandlerMapContended passes packets for 1000 sessions to the packetHandlerMap from 8 go routines.
+func BenchmarkPacketHandlerMapContended(b *testing.B) {
+	const (
+		numSessions   = 1000
+		numGoroutines = 8
+	)
+	handler := newPacketHandlerMap(newMockPacketConn(), 8, nil, utils.DefaultLogger).(*packetHandlerMap)
+	defer handler.Close()
+
+	packets := make([][]byte, numSessions)
+	for i := range packets {
+		connID := make(protocol.ConnectionID, 8)
+		rand.Read(connID)
+		handler.Add(connID, &benchmarkPacketHandler{})
+		// a short header packet, large enough to be checked for stateless resets
+		packets[i] = append(append([]byte{0x40}, connID...), make([]byte, 100)...)
+	}
+
+	b.ResetTimer()
+	var wg sync.WaitGroup
+	wg.Add(numGoroutines)
+	for g := 0; g < numGoroutines; g++ {
+		go func(g int) {
+			defer wg.Done()
+			for i := g; i < b.N; i += numGoroutines {
+				handler.handlePacket(nil, nil, nil, packets[i%numSessions])
+			}
+		}(g)
+	}
+	wg.Wait()
+}
@@ -2,8 +2,10 @@ package quic
 
 import (
 	"bytes"
+	"crypto/rand"
 	"errors"
 	"fmt"
+	"hash/fnv"
 	"net"
 	"time"
 
@@ -19,6 +21,7 @@ type packer interface {
 	MaybePackAckPacket() (*packedPacket, error)
 	PackRetransmission(packet *ackhandler.Packet) ([]*packedPacket, error)
 	PackConnectionClose(*wire.ConnectionCloseFrame) (*packedPacket, error)
+	QueuePing()
 
 	HandleTransportParameters(*handshake.TransportParameters)
 	SetToken([]byte)
@@ -30,6 +33,9 @@ type packedPacket struct {
 	raw    []byte
 	frames []wire.Frame
 
+	// only set when built with the debug build tag, see ackhandler.Packet.CryptoDataChecksums
+	cryptoDataChecksums map[protocol.ByteCount]uint64
+
 	buffer *packetBuffer
 }
 
@@ -52,14 +58,62 @@ func (p *packedPacket) IsAckEliciting() bool {
 }
 
 func (p *packedPacket) ToAckHandlerPacket() *ackhandler.Packet {
+	checksums := p.cryptoDataChecksums
+	if debugChecks && checksums == nil {
+		checksums = getCryptoDataChecksums(p.frames)
+	}
 	return &ackhandler.Packet{
-		PacketNumber:    p.header.PacketNumber,
-		PacketType:      p.header.Type,
-		Frames:          p.frames,
-		Length:          protocol.ByteCount(len(p.raw)),
-		EncryptionLevel: p.EncryptionLevel(),
-		SendTime:        time.Now(),
+		PacketNumber:        p.header.PacketNumber,
+		PacketType:          p.header.Type,
+		Frames:              p.frames,
+		Length:              protocol.ByteCount(len(p.raw)),
+		EncryptionLevel:     p.EncryptionLevel(),
+		SendTime:            time.Now(),
+		CryptoDataChecksums: checksums,
+	}
+}
+
+// getCryptoDataChecksums calculates a checksum of the data of every CRYPTO frame.
+// It returns nil if there are no CRYPTO frames.
+func getCryptoDataChecksums(frames []wire.Frame) map[protocol.ByteCount]uint64 {
+	var checksums map[protocol.ByteCount]uint64
+	for _, f := range frames {
+		cf, ok := f.(*wire.CryptoFrame)
+		if !ok {
+			continue
+		}
+		if checksums == nil {
+			checksums = make(map[protocol.ByteCount]uint64)
+		}
+		checksums[cf.Offset] = cryptoDataChecksum(cf.Data)
+	}
+	return checksums
+}
+
+func cryptoDataChecksum(data []byte) uint64 {
+	h := fnv.New64a()
+	h.Write(data)
+	return h.Sum64()
+}
+
+// checkCryptoRetransmission checks that the data of the CRYPTO frames of a packet that is retransmitted
+// is still identical to the data that was sent originally.
+// TLS relies on the retransmitted data being exactly the same, so a mismatch means that the data was modified after it was sent.
+func checkCryptoRetransmission(packet *ackhandler.Packet) error {
+	for _, f := range packet.Frames {
+		cf, ok := f.(*wire.CryptoFrame)
+		if !ok {
+			continue
+		}
+		checksum, ok := packet.CryptoDataChecksums[cf.Offset]
+		if !ok {
+			continue
+		}
+		if cryptoDataChecksum(cf.Data) != checksum {
+			return fmt.Errorf("packetPacker BUG: data of the CRYPTO frame at offset %d (%d bytes, %s) in packet %#x changed since it was first sent", cf.Offset, len(cf.Data), packet.EncryptionLevel, packet.PacketNumber)
+		}
 	}
+	return nil
 }
 
 func getMaxPacketSize(addr net.Addr) protocol.ByteCount {
@@ -117,6 +171,15 @@ type packetPacker struct {
 
 	maxPacketSize          protocol.ByteCount
 	numNonAckElicitingAcks int
+	// pingRequired is set when the next packet has to contain a PING frame,
+	// either to keep the connection alive, or as a probe packet.
+	pingRequired bool
+
+	paddingStrategy PaddingStrategy
+	// greaseFrames is set if GREASE frames are enabled.
+	// They are only added to 1-RTT packets if the peer signalled that it ignores them.
+	greaseFrames             bool
+	peerSupportsGreaseFrames bool
 }
 
 var _ packer = &packetPacker{}
@@ -131,9 +194,14 @@ func newPacketPacker(
 	cryptoSetup sealingManager,
 	framer frameSource,
 	acks ackFrameSource,
+	paddingStrategy PaddingStrategy,
+	greaseFrames bool,
 	perspective protocol.Perspective,
 	version protocol.VersionNumber,
 ) *packetPacker {
+	if paddingStrategy == nil {
+		paddingStrategy = NoPadding
+	}
 	return &packetPacker{
 		cryptoSetup:     cryptoSetup,
 		destConnID:      destConnID,
@@ -146,6 +214,8 @@ func newPacketPacker(
 		acks:            acks,
 		pnManager:       packetNumberManager,
 		maxPacketSize:   getMaxPacketSize(remoteAddr),
+		paddingStrategy: paddingStrategy,
+		greaseFrames:    greaseFrames,
 	}
 }
 
@@ -172,13 +242,23 @@ func (p *packetPacker) MaybePackAckPacket() (*packedPacket, error) {
 // PackRetransmission packs a retransmission
 // For packets sent after completion of the handshake, it might happen that 2 packets have to be sent.
 // This can happen e.g. when a longer packet number is used in the header.
+// If the packet only contained DATAGRAM frames, no packets are returned.
 func (p *packetPacker) PackRetransmission(packet *ackhandler.Packet) ([]*packedPacket, error) {
+	if debugChecks {
+		if err := checkCryptoRetransmission(packet); err != nil {
+			return nil, err
+		}
+	}
 	var controlFrames []wire.Frame
 	var streamFrames []*wire.StreamFrame
 	for _, f := range packet.Frames {
 		// CRYPTO frames are treated as control frames here.
 		// Since we're making sure that the header can never be larger for a retransmission,
 		// we never have to split CRYPTO frames.
+		// DATAGRAM frames are unreliable, and never retransmitted.
+		if _, ok := f.(*wire.DatagramFrame); ok {
+			continue
+		}
 		if sf, ok := f.(*wire.StreamFrame); ok {
 			sf.DataLenPresent = true
 			streamFrames = append(streamFrames, sf)
@@ -237,11 +317,21 @@ func (p *packetPacker) PackRetransmission(packet *ackhandler.Packet) ([]*packedP
 		if err != nil {
 			return nil, err
 		}
+		// Keep the checksums of the original transmission.
+		// Otherwise they'd be calculated from the data that is retransmitted now.
+		p.cryptoDataChecksums = packet.CryptoDataChecksums
 		packets = append(packets, p)
 	}
 	return packets, nil
 }
 
+// QueuePing makes sure that the next packet packed by PackPacket contains a PING frame.
+// The PING is added before all control and STREAM frames,
+// such that it is sent immediately, even if there's a lot of data queued.
+func (p *packetPacker) QueuePing() {
+	p.pingRequired = true
+}
+
 // PackPacket packs a new packet
 // the other controlFrames are sent in the next packet, but might be queued and sent in the next packet if the packet would overflow MaxPacketSize otherwise
 func (p *packetPacker) PackPacket() (*packedPacket, error) {
@@ -270,7 +360,9 @@ func (p *packetPacker) PackPacket() (*packedPacket, error) {
 	if len(frames) == 0 {
 		return nil, nil
 	}
-	// check if this packet only contains an ACK
+	// Check if this packet only contains an ACK.
+	// In that case, every MaxNonAckElicitingAcks packets, a PING is added at the end of the packet,
+	// so that we receive ACKs for our ACKs.
 	if !ackhandler.HasAckElicitingFrames(frames) {
 		if p.numNonAckElicitingAcks >= protocol.MaxNonAckElicitingAcks {
 			frames = append(frames, &wire.PingFrame{})
@@ -336,6 +428,22 @@ func (p *packetPacker) composeNextPacket(maxFrameSize protocol.ByteCount) ([]wir
 		length += ack.Length(p.version)
 	}
 
+	// A required PING goes before all other frames, so that it can't be crowded out by control frames or STREAM data.
+	if p.pingRequired {
+		ping := &wire.PingFrame{}
+		frames = append(frames, ping)
+		length += ping.Length(p.version)
+		p.pingRequired = false
+	}
+
+	// Reserve space for a GREASE frame now.
+	// It is only added if the packet ends up containing ack-eliciting frames.
+	var grease *wire.GreaseFrame
+	if p.greaseFrames && p.peerSupportsGreaseFrames && shouldSendGreaseFrame() {
+		grease = wire.NewGreaseFrame()
+		length += grease.Length(p.version)
+	}
+
 	var lengthAdded protocol.ByteCount
 	frames, lengthAdded = p.framer.AppendControlFrames(frames, maxFrameSize-length)
 	length += lengthAdded
@@ -353,9 +461,26 @@ func (p *packetPacker) composeNextPacket(maxFrameSize protocol.ByteCount) ([]wir
 			sf.DataLenPresent = false
 		}
 	}
+	if grease != nil && ackhandler.HasAckElicitingFrames(frames) {
+		// The last STREAM frame doesn't have a length field, so the GREASE frame can't be appended.
+		// Insert it right after the ACK frame instead.
+		pos := 0
+		if _, ok := frames[0].(*wire.AckFrame); ok {
+			pos = 1
+		}
+		frames = append(frames[:pos], append([]wire.Frame{grease}, frames[pos:]...)...)
+	}
 	return frames, nil
 }
 
+// shouldSendGreaseFrame randomly decides if a GREASE frame is added to a packet,
+// such that on average every protocol.GreaseFrameInterval-th packet contains one.
+func shouldSendGreaseFrame() bool {
+	b := make([]byte, 1)
+	_, _ = rand.Read(b) // ignore the error here. Failure to read random data doesn't break anything
+	return b[0]%protocol.GreaseFrameInterval == 0
+}
+
 func (p *packetPacker) getHeader(encLevel protocol.EncryptionLevel) *wire.ExtendedHeader {
 	pn, pnLen := p.pnManager.PeekPacketNumber(encLevel)
 	header := &wire.ExtendedHeader{}
@@ -394,23 +519,20 @@ func (p *packetPacker) writeAndSealPacket(
 	packetBuffer := getPacketBuffer()
 	buffer := bytes.NewBuffer(packetBuffer.Slice[:0])
 
-	addPaddingForInitial := p.perspective == protocol.PerspectiveClient && header.Type == protocol.PacketTypeInitial
+	// Both client and server pad their Initial packets.
+	// The server drops its Initial keys (and stops sending Initial packets) as soon as it receives
+	// a Handshake packet, i.e. once the client's address is validated.
+	addPaddingForInitial := header.Type == protocol.PacketTypeInitial
 
-	if header.IsLongHeader {
-		if p.perspective == protocol.PerspectiveClient && header.Type == protocol.PacketTypeInitial {
-			header.Token = p.token
-		}
-		if addPaddingForInitial {
-			headerLen := header.GetLength(p.version)
-			header.Length = protocol.ByteCount(header.PacketNumberLen) + protocol.MinInitialPacketSize - headerLen
-		} else {
-			// long header packets always use 4 byte packet number, so we never need to pad short payloads
-			length := protocol.ByteCount(sealer.Overhead()) + protocol.ByteCount(header.PacketNumberLen)
-			for _, frame := range frames {
-				length += frame.Length(p.version)
-			}
-			header.Length = length
-		}
+	if header.IsLongHeader && p.perspective == protocol.PerspectiveClient && header.Type == protocol.PacketTypeInitial {
+		header.Token = p.token
+	}
+	var paddingLen protocol.ByteCount
+	if addPaddingForInitial {
+		headerLen := header.GetLength(p.version)
+		header.Length = protocol.ByteCount(header.PacketNumberLen) + protocol.MinInitialPacketSize - headerLen
+	} else {
+		paddingLen = p.getPaddingLen(header, frames, protocol.ByteCount(sealer.Overhead()))
 	}
 
 	if err := header.Write(buffer, p.version); err != nil {
@@ -430,13 +552,10 @@ func (p *packetPacker) writeAndSealPacket(
 		if sf, ok := lastFrame.(*wire.StreamFrame); ok {
 			sf.DataLenPresent = true
 		}
-	} else {
-		payloadLen := buffer.Len() - payloadOffset + int(lastFrame.Length(p.version))
-		if paddingLen := 4 - int(header.PacketNumberLen) - payloadLen; paddingLen > 0 {
-			// Pad the packet such that packet number length + payload length is 4 bytes.
-			// This is needed to enable the peer to get a 16 byte sample for header protection.
-			buffer.Write(bytes.Repeat([]byte{0}, paddingLen))
-		}
+	} else if paddingLen > 0 {
+		// Write the padding before the last frame.
+		// This way, the last STREAM frame doesn't need a data length.
+		buffer.Write(bytes.Repeat([]byte{0}, int(paddingLen)))
 	}
 	if err := lastFrame.Write(buffer, p.version); err != nil {
 		return nil, err
@@ -476,6 +595,41 @@ func (p *packetPacker) writeAndSealPacket(
 	}, nil
 }
 
+// getPaddingLen determines the number of bytes of padding for a packet,
+// and sets the length field for long header packets.
+func (p *packetPacker) getPaddingLen(header *wire.ExtendedHeader, frames []wire.Frame, sealerOverhead protocol.ByteCount) protocol.ByteCount {
+	var payloadLen protocol.ByteCount
+	for _, frame := range frames {
+		payloadLen += frame.Length(p.version)
+	}
+	var paddingLen protocol.ByteCount
+	// Pad the packet such that packet number length + payload length is 4 bytes.
+	// This is needed to enable the peer to get a 16 byte sample for header protection.
+	// Long header packets always use 4 byte packet number, so we never need to pad short payloads.
+	if l := protocol.ByteCount(header.PacketNumberLen) + payloadLen; l < 4 {
+		paddingLen = 4 - l
+	}
+	if header.IsLongHeader {
+		header.Length = sealerOverhead + protocol.ByteCount(header.PacketNumberLen) + payloadLen
+	}
+	headerLen := header.GetLength(p.version)
+	packetSize := headerLen + payloadLen + sealerOverhead
+	if packetSize >= p.maxPacketSize {
+		return paddingLen
+	}
+	strategyPadding := utils.MinByteCount(p.paddingStrategy.PaddingLen(packetSize, p.maxPacketSize), p.maxPacketSize-packetSize)
+	paddingLen = utils.MaxByteCount(paddingLen, strategyPadding)
+	if header.IsLongHeader && paddingLen > 0 {
+		header.Length += paddingLen
+		// Padding might have increased the size of the length field.
+		if diff := header.GetLength(p.version) - headerLen; diff > 0 && paddingLen > diff {
+			paddingLen -= diff
+			header.Length -= diff
+		}
+	}
+	return paddingLen
+}
+
 func (p *packetPacker) ChangeDestConnectionID(connID protocol.ConnectionID) {
 	p.destConnID = connID
 }
@@ -488,4 +642,5 @@ func (p *packetPacker) HandleTransportParameters(params *handshake.TransportPara
 	if params.MaxPacketSize != 0 {
 		p.maxPacketSize = utils.MinByteCount(p.maxPacketSize, params.MaxPacketSize)
 	}
+	p.peerSupportsGreaseFrames = params.SupportsGreaseFrames
 }
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"math/rand"
 	"net"
+	"testing"
 
 	"github.com/golang/mock/gomock"
 	"github.com/lucas-clemente/quic-go/internal/ackhandler"
@@ -75,6 +76,8 @@ var _ = Describe("Packet packer", func() {
 			sealingManager,
 			framer,
 			ackFramer,
+			nil,
+			false,
 			protocol.PerspectiveServer,
 			version,
 		)
@@ -420,6 +423,127 @@ var _ = Describe("Packet packer", func() {
 				})
 			})
 
+			Context("required PING frames", func() {
+				It("adds the PING before control and STREAM frames", func() {
+					packer.QueuePing()
+					pnManager.EXPECT().PeekPacketNumber(protocol.Encryption1RTT).Return(protocol.PacketNumber(0x42), protocol.PacketNumberLen2)
+					pnManager.EXPECT().PopPacketNumber(protocol.Encryption1RTT).Return(protocol.PacketNumber(0x42))
+					sealingManager.EXPECT().GetSealer().Return(protocol.Encryption1RTT, sealer)
+					ack := &wire.AckFrame{AckRanges: []wire.AckRange{{Smallest: 1, Largest: 10}}}
+					ackFramer.EXPECT().GetAckFrame(protocol.Encryption1RTT).Return(ack)
+					mdf := &wire.MaxDataFrame{ByteOffset: 0x1337}
+					expectAppendControlFrames(mdf)
+					sf := &wire.StreamFrame{StreamID: 5, Data: []byte("foobar")}
+					expectAppendStreamFrames(sf)
+					p, err := packer.PackPacket()
+					Expect(err).ToNot(HaveOccurred())
+					Expect(p.frames).To(Equal([]wire.Frame{ack, &wire.PingFrame{}, mdf, sf}))
+				})
+
+				It("packs a PING-only packet, and only adds the PING once", func() {
+					packer.QueuePing()
+					pnManager.EXPECT().PeekPacketNumber(protocol.Encryption1RTT).Return(protocol.PacketNumber(0x42), protocol.PacketNumberLen2).Times(2)
+					pnManager.EXPECT().PopPacketNumber(protocol.Encryption1RTT).Return(protocol.PacketNumber(0x42))
+					sealingManager.EXPECT().GetSealer().Return(protocol.Encryption1RTT, sealer).Times(2)
+					ackFramer.EXPECT().GetAckFrame(protocol.Encryption1RTT).Times(2)
+					expectAppendControlFrames()
+					expectAppendStreamFrames()
+					p, err := packer.PackPacket()
+					Expect(err).ToNot(HaveOccurred())
+					Expect(p.frames).To(Equal([]wire.Frame{&wire.PingFrame{}}))
+					expectAppendControlFrames()
+					expectAppendStreamFrames()
+					p, err = packer.PackPacket()
+					Expect(err).ToNot(HaveOccurred())
+					Expect(p).To(BeNil())
+				})
+			})
+
+			Context("GREASE frames", func() {
+				BeforeEach(func() {
+					packer.greaseFrames = true
+					packer.HandleTransportParameters(&handshake.TransportParameters{SupportsGreaseFrames: true})
+				})
+
+				It("adds GREASE frames to some packets", func() {
+					const num = 20 * protocol.GreaseFrameInterval
+					pnManager.EXPECT().PeekPacketNumber(protocol.Encryption1RTT).Return(protocol.PacketNumber(0x42), protocol.PacketNumberLen2).Times(num)
+					pnManager.EXPECT().PopPacketNumber(protocol.Encryption1RTT).Return(protocol.PacketNumber(0x42)).Times(num)
+					sealingManager.EXPECT().GetSealer().Return(protocol.Encryption1RTT, sealer).Times(num)
+					ack := &wire.AckFrame{AckRanges: []wire.AckRange{{Smallest: 1, Largest: 10}}}
+					ackFramer.EXPECT().GetAckFrame(protocol.Encryption1RTT).Return(ack).Times(num)
+					var numGreased int
+					for i := 0; i < num; i++ {
+						expectAppendControlFrames()
+						sf := &wire.StreamFrame{StreamID: 5, Data: []byte("foobar")}
+						expectAppendStreamFrames(sf)
+						p, err := packer.PackPacket()
+						Expect(err).ToNot(HaveOccurred())
+						Expect(p.frames[0]).To(Equal(ack))
+						Expect(p.frames[len(p.frames)-1]).To(Equal(sf))
+						if len(p.frames) == 2 {
+							continue
+						}
+						numGreased++
+						Expect(p.frames).To(HaveLen(3))
+						Expect(p.frames[1]).To(BeAssignableToTypeOf(&wire.GreaseFrame{}))
+						// make sure that the receiver skips the GREASE frame
+						p.raw = p.raw[:len(p.raw)-sealer.Overhead()]
+						hdr, _, _, err := wire.ParsePacket(p.raw, len(packer.destConnID))
+						Expect(err).ToNot(HaveOccurred())
+						r := bytes.NewReader(p.raw)
+						_, err = hdr.ParseExtended(r, packer.version)
+						Expect(err).ToNot(HaveOccurred())
+						frameParser := wire.NewFrameParser(false, true, nil, packer.perspective.Opposite(), packer.version)
+						frame, err := frameParser.ParseNext(r, protocol.Encryption1RTT)
+						Expect(err).ToNot(HaveOccurred())
+						Expect(frame).To(BeAssignableToTypeOf(&wire.AckFrame{}))
+						frame, err = frameParser.ParseNext(r, protocol.Encryption1RTT)
+						Expect(err).ToNot(HaveOccurred())
+						Expect(frame).To(Equal(sf))
+						Expect(r.Len()).To(BeZero())
+					}
+					Expect(numGreased).To(And(
+						BeNumerically(">", 0),
+						BeNumerically("<", num/2),
+					))
+				})
+
+				It("doesn't add GREASE frames to packets that only contain an ACK", func() {
+					// after MaxNonAckElicitingAcks packets, a PING would be added
+					const num = protocol.MaxNonAckElicitingAcks
+					pnManager.EXPECT().PeekPacketNumber(protocol.Encryption1RTT).Return(protocol.PacketNumber(0x42), protocol.PacketNumberLen2).Times(num)
+					pnManager.EXPECT().PopPacketNumber(protocol.Encryption1RTT).Return(protocol.PacketNumber(0x42)).Times(num)
+					sealingManager.EXPECT().GetSealer().Return(protocol.Encryption1RTT, sealer).Times(num)
+					ack := &wire.AckFrame{AckRanges: []wire.AckRange{{Smallest: 1, Largest: 10}}}
+					ackFramer.EXPECT().GetAckFrame(protocol.Encryption1RTT).Return(ack).Times(num)
+					for i := 0; i < num; i++ {
+						expectAppendControlFrames()
+						expectAppendStreamFrames()
+						p, err := packer.PackPacket()
+						Expect(err).ToNot(HaveOccurred())
+						Expect(p.frames).To(Equal([]wire.Frame{ack}))
+					}
+				})
+
+				It("doesn't add GREASE frames if the peer doesn't support them", func() {
+					packer.HandleTransportParameters(&handshake.TransportParameters{})
+					const num = 20 * protocol.GreaseFrameInterval
+					pnManager.EXPECT().PeekPacketNumber(protocol.Encryption1RTT).Return(protocol.PacketNumber(0x42), protocol.PacketNumberLen2).Times(num)
+					pnManager.EXPECT().PopPacketNumber(protocol.Encryption1RTT).Return(protocol.PacketNumber(0x42)).Times(num)
+					sealingManager.EXPECT().GetSealer().Return(protocol.Encryption1RTT, sealer).Times(num)
+					ackFramer.EXPECT().GetAckFrame(protocol.Encryption1RTT).Times(num)
+					for i := 0; i < num; i++ {
+						expectAppendControlFrames()
+						sf := &wire.StreamFrame{StreamID: 5, Data: []byte("foobar")}
+						expectAppendStreamFrames(sf)
+						p, err := packer.PackPacket()
+						Expect(err).ToNot(HaveOccurred())
+						Expect(p.frames).To(Equal([]wire.Frame{sf}))
+					}
+				})
+			})
+
 			Context("STREAM frame handling", func() {
 				It("does not split a STREAM frame with maximum size", func() {
 					pnManager.EXPECT().PeekPacketNumber(protocol.Encryption1RTT).Return(protocol.PacketNumber(0x42), protocol.PacketNumberLen2)
@@ -499,6 +623,30 @@ var _ = Describe("Packet packer", func() {
 					Expect(p.frames).To(Equal(frames))
 				})
 
+				It("doesn't retransmit DATAGRAM frames", func() {
+					pnManager.EXPECT().PeekPacketNumber(protocol.Encryption1RTT).Return(protocol.PacketNumber(0x42), protocol.PacketNumberLen2)
+					pnManager.EXPECT().PopPacketNumber(protocol.Encryption1RTT).Return(protocol.PacketNumber(0x42))
+					sealingManager.EXPECT().GetSealerWithEncryptionLevel(protocol.Encryption1RTT).Return(sealer, nil)
+					mdf := &wire.MaxDataFrame{ByteOffset: 0x1234}
+					packets, err := packer.PackRetransmission(&ackhandler.Packet{
+						EncryptionLevel: protocol.Encryption1RTT,
+						Frames:          []wire.Frame{mdf, &wire.DatagramFrame{Data: []byte("foobar")}},
+					})
+					Expect(err).ToNot(HaveOccurred())
+					Expect(packets).To(HaveLen(1))
+					Expect(packets[0].frames).To(Equal([]wire.Frame{mdf}))
+				})
+
+				It("doesn't pack a retransmission if the packet only contained DATAGRAM frames", func() {
+					sealingManager.EXPECT().GetSealerWithEncryptionLevel(protocol.Encryption1RTT).Return(sealer, nil)
+					packets, err := packer.PackRetransmission(&ackhandler.Packet{
+						EncryptionLevel: protocol.Encryption1RTT,
+						Frames:          []wire.Frame{&wire.DatagramFrame{Data: []byte("foobar")}},
+					})
+					Expect(err).ToNot(HaveOccurred())
+					Expect(packets).To(BeEmpty())
+				})
+
 				It("packs two packets for retransmission if the original packet contained many control frames", func() {
 					pnManager.EXPECT().PeekPacketNumber(protocol.Encryption1RTT).Return(protocol.PacketNumber(0x42), protocol.PacketNumberLen2).Times(2)
 					pnManager.EXPECT().PopPacketNumber(protocol.Encryption1RTT).Return(protocol.PacketNumber(0x42)).Times(2)
@@ -701,6 +849,75 @@ var _ = Describe("Packet packer", func() {
 			})
 		})
 
+		Context("padding", func() {
+			BeforeEach(func() {
+				initialStream.EXPECT().HasData().AnyTimes()
+				ackFramer.EXPECT().GetAckFrame(protocol.EncryptionInitial).AnyTimes()
+				ackFramer.EXPECT().GetAckFrame(protocol.EncryptionHandshake).AnyTimes()
+			})
+
+			It("pads short header packets according to the padding strategy", func() {
+				packer.paddingStrategy = FixedSize(500)
+				handshakeStream.EXPECT().HasData()
+				pnManager.EXPECT().PeekPacketNumber(protocol.Encryption1RTT).Return(protocol.PacketNumber(0x42), protocol.PacketNumberLen2)
+				pnManager.EXPECT().PopPacketNumber(protocol.Encryption1RTT).Return(protocol.PacketNumber(0x42))
+				sealingManager.EXPECT().GetSealer().Return(protocol.Encryption1RTT, sealer)
+				ackFramer.EXPECT().GetAckFrame(protocol.Encryption1RTT)
+				expectAppendControlFrames()
+				f := &wire.StreamFrame{
+					StreamID: 5,
+					Data:     []byte("foobar"),
+				}
+				expectAppendStreamFrames(f)
+				p, err := packer.PackPacket()
+				Expect(err).ToNot(HaveOccurred())
+				Expect(p.raw).To(HaveLen(500))
+				Expect(p.frames).To(Equal([]wire.Frame{f}))
+				// cut off the tag that the mock sealer added
+				p.raw = p.raw[:len(p.raw)-sealer.Overhead()]
+				hdr, _, _, err := wire.ParsePacket(p.raw, len(packer.destConnID))
+				Expect(err).ToNot(HaveOccurred())
+				r := bytes.NewReader(p.raw)
+				_, err = hdr.ParseExtended(r, packer.version)
+				Expect(err).ToNot(HaveOccurred())
+				// the PADDING frames are written before the STREAM frame,
+				// so the STREAM frame doesn't need a data length
+				frame, err := wire.NewFrameParser(false, false, nil, packer.perspective.Opposite(), packer.version).ParseNext(r, protocol.Encryption1RTT)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(frame).To(Equal(f))
+				Expect(r.Len()).To(BeZero())
+			})
+
+			It("pads long header packets according to the padding strategy", func() {
+				packer.paddingStrategy = FixedSize(500)
+				pnManager.EXPECT().PeekPacketNumber(protocol.EncryptionHandshake).Return(protocol.PacketNumber(0x42), protocol.PacketNumberLen4)
+				pnManager.EXPECT().PopPacketNumber(protocol.EncryptionHandshake).Return(protocol.PacketNumber(0x42))
+				sealingManager.EXPECT().GetSealerWithEncryptionLevel(protocol.EncryptionHandshake).Return(sealer, nil)
+				f := &wire.CryptoFrame{Data: []byte("foobar")}
+				handshakeStream.EXPECT().HasData().Return(true)
+				handshakeStream.EXPECT().PopCryptoFrame(gomock.Any()).Return(f)
+				p, err := packer.PackPacket()
+				Expect(err).ToNot(HaveOccurred())
+				Expect(p.header.IsLongHeader).To(BeTrue())
+				Expect(p.raw).To(HaveLen(500))
+				Expect(p.frames).To(Equal([]wire.Frame{f}))
+				checkLength(p.raw)
+			})
+
+			It("doesn't pad beyond the maximum packet size", func() {
+				packer.paddingStrategy = RandomPadding(10000, 20000)
+				pnManager.EXPECT().PeekPacketNumber(protocol.EncryptionHandshake).Return(protocol.PacketNumber(0x42), protocol.PacketNumberLen4)
+				pnManager.EXPECT().PopPacketNumber(protocol.EncryptionHandshake).Return(protocol.PacketNumber(0x42))
+				sealingManager.EXPECT().GetSealerWithEncryptionLevel(protocol.EncryptionHandshake).Return(sealer, nil)
+				handshakeStream.EXPECT().HasData().Return(true)
+				handshakeStream.EXPECT().PopCryptoFrame(gomock.Any()).Return(&wire.CryptoFrame{Data: []byte("foobar")})
+				p, err := packer.PackPacket()
+				Expect(err).ToNot(HaveOccurred())
+				Expect(p.raw).To(HaveLen(int(packer.maxPacketSize)))
+				checkLength(p.raw)
+			})
+		})
+
 		Context("packing crypto packets", func() {
 			It("sets the length", func() {
 				pnManager.EXPECT().PeekPacketNumber(protocol.EncryptionInitial).Return(protocol.PacketNumber(0x42), protocol.PacketNumberLen2)
@@ -788,6 +1005,22 @@ var _ = Describe("Packet packer", func() {
 				Expect(cf.Data).To(Equal([]byte("foobar")))
 			})
 
+			It("pads Initial packets sent by the server", func() {
+				f := &wire.CryptoFrame{Data: []byte("foobar")}
+				pnManager.EXPECT().PeekPacketNumber(protocol.EncryptionInitial).Return(protocol.PacketNumber(0x42), protocol.PacketNumberLen2)
+				pnManager.EXPECT().PopPacketNumber(protocol.EncryptionInitial).Return(protocol.PacketNumber(0x42))
+				sealingManager.EXPECT().GetSealerWithEncryptionLevel(protocol.EncryptionInitial).Return(sealer, nil)
+				ackFramer.EXPECT().GetAckFrame(protocol.EncryptionInitial)
+				initialStream.EXPECT().HasData().Return(true)
+				initialStream.EXPECT().PopCryptoFrame(gomock.Any()).Return(f)
+				packer.perspective = protocol.PerspectiveServer
+				packet, err := packer.PackPacket()
+				Expect(err).ToNot(HaveOccurred())
+				Expect(packet.header.Token).To(BeEmpty())
+				Expect(packet.raw).To(HaveLen(protocol.MinInitialPacketSize))
+				Expect(packet.frames).To(Equal([]wire.Frame{f}))
+			})
+
 			It("pads if payload length + packet number length is smaller than 4", func() {
 				f := &wire.StreamFrame{
 					StreamID: 0x10, // small stream ID, such that only a single byte is consumed
@@ -820,7 +1053,7 @@ var _ = Describe("Packet packer", func() {
 				Expect(err).ToNot(HaveOccurred())
 				Expect(firstPayloadByte).To(Equal(byte(0)))
 				// ... followed by the stream frame
-				frameParser := wire.NewFrameParser(packer.version)
+				frameParser := wire.NewFrameParser(false, false, nil, packer.perspective.Opposite(), packer.version)
 				frame, err := frameParser.ParseNext(r, protocol.Encryption1RTT)
 				Expect(err).ToNot(HaveOccurred())
 				Expect(frame).To(Equal(f))
@@ -903,7 +1136,211 @@ var _ = Describe("Packet packer", func() {
 					Expect(p.header.Token).To(Equal(token))
 					Expect(p.raw).To(HaveLen(protocol.MinInitialPacketSize))
 				})
+
+				Context("checking the CRYPTO data", func() {
+					It("calculates checksums of the CRYPTO data", func() {
+						Expect(getCryptoDataChecksums([]wire.Frame{sf})).To(BeNil())
+						checksums := getCryptoDataChecksums([]wire.Frame{
+							&wire.CryptoFrame{Data: []byte("foo")},
+							sf,
+							&wire.CryptoFrame{Offset: 3, Data: []byte("bar")},
+						})
+						Expect(checksums).To(HaveLen(2))
+						Expect(checksums).To(HaveKeyWithValue(protocol.ByteCount(0), cryptoDataChecksum([]byte("foo"))))
+						Expect(checksums).To(HaveKeyWithValue(protocol.ByteCount(3), cryptoDataChecksum([]byte("bar"))))
+					})
+
+					It("accepts unmodified CRYPTO data", func() {
+						frames := []wire.Frame{&wire.CryptoFrame{Data: []byte("foo")}, sf}
+						Expect(checkCryptoRetransmission(&ackhandler.Packet{
+							Frames:              frames,
+							CryptoDataChecksums: getCryptoDataChecksums(frames),
+						})).To(Succeed())
+					})
+
+					It("doesn't check CRYPTO frames without a checksum", func() {
+						Expect(checkCryptoRetransmission(&ackhandler.Packet{
+							Frames: []wire.Frame{&wire.CryptoFrame{Data: []byte("foo")}},
+						})).To(Succeed())
+					})
+
+					It("detects modified CRYPTO data", func() {
+						f := &wire.CryptoFrame{Offset: 0x100, Data: []byte("foobar")}
+						packet := &ackhandler.Packet{
+							PacketNumber:        0x42,
+							EncryptionLevel:     protocol.EncryptionHandshake,
+							Frames:              []wire.Frame{f},
+							CryptoDataChecksums: getCryptoDataChecksums([]wire.Frame{f}),
+						}
+						f.Data[3] = 'B'
+						err := checkCryptoRetransmission(packet)
+						Expect(err).To(MatchError("packetPacker BUG: data of the CRYPTO frame at offset 256 (6 bytes, Handshake) in packet 0x42 changed since it was first sent"))
+					})
+
+					It("keeps the checksums of the original packet when packing a retransmission", func() {
+						f := &wire.CryptoFrame{Data: []byte("foo")}
+						checksums := map[protocol.ByteCount]uint64{0: cryptoDataChecksum([]byte("foo"))}
+						pnManager.EXPECT().PeekPacketNumber(protocol.EncryptionInitial).Return(protocol.PacketNumber(0x42), protocol.PacketNumberLen2)
+						pnManager.EXPECT().PopPacketNumber(protocol.EncryptionInitial).Return(protocol.PacketNumber(0x42))
+						sealingManager.EXPECT().GetSealerWithEncryptionLevel(protocol.EncryptionInitial).Return(sealer, nil)
+						packets, err := packer.PackRetransmission(&ackhandler.Packet{
+							EncryptionLevel:     protocol.EncryptionInitial,
+							Frames:              []wire.Frame{f},
+							CryptoDataChecksums: checksums,
+						})
+						Expect(err).ToNot(HaveOccurred())
+						Expect(packets).To(HaveLen(1))
+						Expect(packets[0].ToAckHandlerPacket().CryptoDataChecksums).To(Equal(checksums))
+					})
+
+					It("refuses to retransmit modified CRYPTO data, when built with the debug build tag", func() {
+						if !debugChecks {
+							Skip("CRYPTO data is only checked when built with the debug build tag")
+						}
+						f := &wire.CryptoFrame{Data: []byte("foo")}
+						packet := (&packedPacket{
+							header: &wire.ExtendedHeader{Header: wire.Header{IsLongHeader: true, Type: protocol.PacketTypeInitial}},
+							frames: []wire.Frame{f},
+						}).ToAckHandlerPacket()
+						Expect(packet.CryptoDataChecksums).To(HaveLen(1))
+						f.Data = []byte("bar")
+						_, err := packer.PackRetransmission(packet)
+						Expect(err).To(MatchError(ContainSubstring("data of the CRYPTO frame at offset 0 (3 bytes, Initial)")))
+					})
+				})
 			})
 		})
 	})
 })
+
+type benchmarkPacketNumberManager struct {
+	pn protocol.PacketNumber
+}
+
+func (m *benchmarkPacketNumberManager) PeekPacketNumber(protocol.EncryptionLevel) (protocol.PacketNumber, protocol.PacketNumberLen) {
+	return m.pn, protocol.PacketNumberLen2
+}
+
+func (m *benchmarkPacketNumberManager) PopPacketNumber(protocol.EncryptionLevel) protocol.PacketNumber {
+	pn := m.pn
+	m.pn++
+	return pn
+}
+
+// BenchmarkWriteAndSealPacket packs a full-sized 1-RTT packet containing a single STREAM frame.
+// This includes writing the header and the frame, encrypting the payload, and applying header protection.
+func BenchmarkWriteAndSealPacket(b *testing.B) {
+	connID := protocol.ConnectionID{0xde, 0xad, 0xbe, 0xef, 0xca, 0xfe, 0x13, 0x37}
+	sealer, _, err := handshake.NewInitialAEAD(connID, protocol.PerspectiveServer)
+	if err != nil {
+		b.Fatal(err)
+	}
+	packer := newPacketPacker(
+		connID,
+		connID,
+		nil,
+		nil,
+		&benchmarkPacketNumberManager{},
+		&net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)},
+		nil,
+		nil,
+		nil,
+		nil,
+		false,
+		protocol.PerspectiveServer,
+		protocol.VersionTLS,
+	)
+	frame := &wire.StreamFrame{StreamID: 4}
+	frame.Data = make([]byte, frame.MaxDataLen(packer.maxPacketSize-packer.getHeader(protocol.Encryption1RTT).GetLength(packer.version)-protocol.ByteCount(sealer.Overhead()), packer.version))
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		p, err := packer.writeAndSealPacket(packer.getHeader(protocol.Encryption1RTT), []wire.Frame{frame}, protocol.Encryption1RTT, sealer)
+		if err != nil {
+			b.Fatal(err)
+		}
+		p.buffer.Release()
+	}
+}
+
+type benchmarkSealingManager struct {
+	sealer handshake.Sealer
+}
+
+func (m *benchmarkSealingManager) GetSealer() (protocol.EncryptionLevel, handshake.Sealer) {
+	return protocol.Encryption1RTT, m.sealer
+}
+
+func (m *benchmarkSealingManager) GetSealerWithEncryptionLevel(protocol.EncryptionLevel) (handshake.Sealer, error) {
+	return m.sealer, nil
+}
+
+type benchmarkAckFrameSource struct{}
+
+func (benchmarkAckFrameSource) GetAckFrame(protocol.EncryptionLevel) *wire.AckFrame { return nil }
+
+// benchmarkFrameSource sends the data buffered in a single stream send buffer.
+type benchmarkFrameSource struct {
+	sendBuf *streamSendBuffer
+}
+
+func (s *benchmarkFrameSource) AppendControlFrames(frames []wire.Frame, _ protocol.ByteCount) ([]wire.Frame, protocol.ByteCount) {
+	return frames, 0
+}
+
+func (s *benchmarkFrameSource) AppendStreamFrames(frames []wire.Frame, maxLen protocol.ByteCount) []wire.Frame {
+	if f := s.sendBuf.Coalesce(maxLen); f != nil {
+		frames = append(frames, f)
+	}
+	return frames
+}
+
+// BenchmarkPacketPackerThroughput measures how many 1-RTT packets PackPacket packs per second,
+// when there's always stream data to send.
+// Every operation is one call to PackPacket, so the allocations are reported per packet.
+func BenchmarkPacketPackerThroughput(b *testing.B) {
+	connID := protocol.ConnectionID{0xde, 0xad, 0xbe, 0xef, 0xca, 0xfe, 0x13, 0x37}
+	sealer, _, err := handshake.NewInitialAEAD(connID, protocol.PerspectiveServer)
+	if err != nil {
+		b.Fatal(err)
+	}
+	frameSource := &benchmarkFrameSource{
+		sendBuf: newStreamSendBuffer(4, newBenchmarkStreamFlowController(4), nil, protocol.VersionTLS),
+	}
+	packer := newPacketPacker(
+		connID,
+		connID,
+		newCryptoStream(),
+		newCryptoStream(),
+		&benchmarkPacketNumberManager{},
+		&net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)},
+		&benchmarkSealingManager{sealer: sealer},
+		frameSource,
+		benchmarkAckFrameSource{},
+		nil,
+		false,
+		protocol.PerspectiveServer,
+		protocol.VersionTLS,
+	)
+	data := make([]byte, 1<<20)
+
+	b.SetBytes(int64(packer.maxPacketSize))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if frameSource.sendBuf.Len() == 0 {
+			b.StopTimer()
+			frameSource.sendBuf.Write(data)
+			b.StartTimer()
+		}
+		p, err := packer.PackPacket()
+		if err != nil {
+			b.Fatal(err)
+		}
+		if p == nil {
+			b.Fatal("expected a packet")
+		}
+		p.buffer.Release()
+	}
+}
@@ -55,29 +55,14 @@ func (u *packetUnpacker) Unpack(hdr *wire.Header, data []byte) (*unpackedPacket,
 		return nil, err
 	}
 	hdrLen := int(hdr.ParsedLen())
-	if len(data) < hdrLen+4+16 {
-		return nil, fmt.Errorf("Packet too small. Expected at least 20 bytes after the header, got %d", len(data)-hdrLen)
+	if err := removeHeaderProtection(data, hdrLen, opener); err != nil {
+		return nil, err
 	}
-	// The packet number can be up to 4 bytes long, but we won't know the length until we decrypt it.
-	// 1. save a copy of the 4 bytes
-	origPNBytes := make([]byte, 4)
-	copy(origPNBytes, data[hdrLen:hdrLen+4])
-	// 2. decrypt the header, assuming a 4 byte packet number
-	opener.DecryptHeader(
-		data[hdrLen+4:hdrLen+4+16],
-		&data[0],
-		data[hdrLen:hdrLen+4],
-	)
-	// 3. parse the header (and learn the actual length of the packet number)
 	extHdr, err := hdr.ParseExtended(r, u.version)
 	if err != nil {
 		return nil, fmt.Errorf("error parsing extended header: %s", err)
 	}
 	extHdrLen := hdrLen + int(extHdr.PacketNumberLen)
-	// 4. if the packet number is shorter than 4 bytes, replace the remaining bytes with the copy we saved earlier
-	if extHdr.PacketNumberLen != protocol.PacketNumberLen4 {
-		copy(data[extHdrLen:hdrLen+4], origPNBytes[int(extHdr.PacketNumberLen):])
-	}
 
 	pn := protocol.DecodePacketNumber(
 		extHdr.PacketNumberLen,
@@ -100,3 +85,28 @@ func (u *packetUnpacker) Unpack(hdr *wire.Header, data []byte) (*unpackedPacket,
 		data:            decrypted,
 	}, nil
 }
+
+// removeHeaderProtection removes the header protection of a packet in place.
+// pnOffset is the offset of the (protected) packet number in data.
+func removeHeaderProtection(data []byte, pnOffset int, opener handshake.Opener) error {
+	if len(data) < pnOffset+4+16 {
+		return fmt.Errorf("Packet too small. Expected at least 20 bytes after the header, got %d", len(data)-pnOffset)
+	}
+	// The packet number can be up to 4 bytes long, but we won't know the length until we decrypt it.
+	// 1. save a copy of the 4 bytes
+	var origPNBytes [4]byte
+	copy(origPNBytes[:], data[pnOffset:pnOffset+4])
+	// 2. decrypt the header, assuming a 4 byte packet number
+	opener.DecryptHeader(
+		data[pnOffset+4:pnOffset+4+16],
+		&data[0],
+		data[pnOffset:pnOffset+4],
+	)
+	// 3. the two least significant bits of the first byte now contain the actual packet number length
+	pnLen := int(data[0]&0x3) + 1
+	// 4. if the packet number is shorter than 4 bytes, replace the remaining bytes with the copy we saved earlier
+	if pnLen != 4 {
+		copy(data[pnOffset+pnLen:pnOffset+4], origPNBytes[pnLen:])
+	}
+	return nil
+}
@@ -3,6 +3,8 @@ package quic
 import (
 	"bytes"
 	"errors"
+	"fmt"
+	"testing"
 
 	"github.com/golang/mock/gomock"
 	"github.com/lucas-clemente/quic-go/internal/handshake"
@@ -181,4 +183,75 @@ var _ = Describe("Packet Unpacker", func() {
 		Expect(err).ToNot(HaveOccurred())
 		Expect(packet.packetNumber).To(Equal(protocol.PacketNumber(0x1338)))
 	})
+
+	Context("removing header protection", func() {
+		// getProtectedPacket returns a packet with a short header, and its protected version
+		getProtectedPacket := func(pnLen protocol.PacketNumberLen) ([]byte, []byte, int) {
+			extHdr := &wire.ExtendedHeader{
+				Header:          wire.Header{DestConnectionID: connID},
+				PacketNumber:    0x1337,
+				PacketNumberLen: pnLen,
+			}
+			buf := &bytes.Buffer{}
+			ExpectWithOffset(1, extHdr.Write(buf, version)).To(Succeed())
+			pnOffset := buf.Len() - int(pnLen)
+			buf.Write(payload)
+			data := buf.Bytes()
+			protected := append([]byte{}, data...)
+			sealer, _, err := handshake.NewInitialAEAD(connID, protocol.PerspectiveClient)
+			ExpectWithOffset(1, err).ToNot(HaveOccurred())
+			sealer.EncryptHeader(protected[pnOffset+4:pnOffset+4+16], &protected[0], protected[pnOffset:pnOffset+int(pnLen)])
+			return data, protected, pnOffset
+		}
+
+		for _, l := range []protocol.PacketNumberLen{1, 2, 3, 4} {
+			pnLen := l
+
+			It(fmt.Sprintf("removes header protection, for %d byte packet numbers", pnLen), func() {
+				data, protected, pnOffset := getProtectedPacket(pnLen)
+				Expect(protected).ToNot(Equal(data))
+				_, opener, err := handshake.NewInitialAEAD(connID, protocol.PerspectiveServer)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(removeHeaderProtection(protected, pnOffset, opener)).To(Succeed())
+				Expect(protected).To(Equal(data))
+			})
+		}
+	})
 })
+
+func BenchmarkRemoveHeaderProtection(b *testing.B) {
+	connID := protocol.ConnectionID{0xde, 0xad, 0xbe, 0xef, 0xca, 0xfe, 0x13, 0x37}
+	sealer, _, err := handshake.NewInitialAEAD(connID, protocol.PerspectiveClient)
+	if err != nil {
+		b.Fatal(err)
+	}
+	_, opener, err := handshake.NewInitialAEAD(connID, protocol.PerspectiveServer)
+	if err != nil {
+		b.Fatal(err)
+	}
+	extHdr := &wire.ExtendedHeader{
+		Header:          wire.Header{DestConnectionID: connID},
+		PacketNumber:    0x1337,
+		PacketNumberLen: protocol.PacketNumberLen2,
+	}
+	buf := &bytes.Buffer{}
+	if err := extHdr.Write(buf, protocol.VersionTLS); err != nil {
+		b.Fatal(err)
+	}
+	pnOffset := buf.Len() - int(extHdr.PacketNumberLen)
+	buf.Write(make([]byte, protocol.MaxPacketSizeIPv4-buf.Len()))
+	protected := buf.Bytes()
+	sealer.EncryptHeader(protected[pnOffset+4:pnOffset+4+16], &protected[0], protected[pnOffset:pnOffset+2])
+	data := make([]byte, len(protected))
+	copy(data, protected)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		// header protection is removed in place, so restore the protected header
+		copy(data[:pnOffset+4], protected[:pnOffset+4])
+		if err := removeHeaderProtection(data, pnOffset, opener); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
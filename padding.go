@@ -0,0 +1,66 @@
+package quic
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+)
+
+type noPadding struct{}
+
+// NoPadding doesn't pad packets.
+// This is the default.
+var NoPadding PaddingStrategy = noPadding{}
+
+func (noPadding) PaddingLen(_, _ ByteCount) ByteCount { return 0 }
+
+type fixedSizePadding struct {
+	targetSize ByteCount
+}
+
+// FixedSize pads all packets to targetSize.
+// Packets that are larger than targetSize are padded to the maximum packet size.
+// This hides the packet sizes completely, but consumes more bandwidth than RandomPadding.
+func FixedSize(targetSize ByteCount) PaddingStrategy {
+	return &fixedSizePadding{targetSize: targetSize}
+}
+
+func (p *fixedSizePadding) PaddingLen(packetSize, maxPacketSize ByteCount) ByteCount {
+	if packetSize >= maxPacketSize {
+		return 0
+	}
+	if packetSize > p.targetSize || p.targetSize > maxPacketSize {
+		return maxPacketSize - packetSize
+	}
+	return p.targetSize - packetSize
+}
+
+type randomPadding struct {
+	minPad, maxPad int
+}
+
+// RandomPadding adds between minPad and maxPad (inclusive) bytes of padding to every packet.
+// The padding length is chosen using cryptographic random.
+// It panics if minPad is negative, or if maxPad is smaller than minPad.
+func RandomPadding(minPad, maxPad int) PaddingStrategy {
+	if minPad < 0 || maxPad < minPad {
+		panic(fmt.Sprintf("invalid padding range: [%d, %d]", minPad, maxPad))
+	}
+	return &randomPadding{minPad: minPad, maxPad: maxPad}
+}
+
+func (p *randomPadding) PaddingLen(packetSize, maxPacketSize ByteCount) ByteCount {
+	if packetSize >= maxPacketSize {
+		return 0
+	}
+	padding := ByteCount(p.minPad)
+	if p.maxPad > p.minPad {
+		b := make([]byte, 4)
+		rand.Read(b) // ignore the error here. Failure to read random data doesn't break anything
+		padding += ByteCount(binary.BigEndian.Uint32(b) % uint32(p.maxPad-p.minPad+1))
+	}
+	if packetSize+padding > maxPacketSize {
+		return maxPacketSize - packetSize
+	}
+	return padding
+}
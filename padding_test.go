@@ -0,0 +1,54 @@
+package quic
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Padding Strategies", func() {
+	It("doesn't pad", func() {
+		Expect(NoPadding.PaddingLen(100, 1000)).To(BeZero())
+	})
+
+	Context("fixed size padding", func() {
+		It("pads packets to the target size", func() {
+			Expect(FixedSize(500).PaddingLen(100, 1000)).To(BeEquivalentTo(400))
+			Expect(FixedSize(500).PaddingLen(500, 1000)).To(BeZero())
+		})
+
+		It("pads packets larger than the target size to the maximum packet size", func() {
+			Expect(FixedSize(500).PaddingLen(600, 1000)).To(BeEquivalentTo(400))
+		})
+
+		It("doesn't pad beyond the maximum packet size", func() {
+			Expect(FixedSize(2000).PaddingLen(600, 1000)).To(BeEquivalentTo(400))
+			Expect(FixedSize(2000).PaddingLen(1000, 1000)).To(BeZero())
+		})
+	})
+
+	Context("random padding", func() {
+		It("pads with a random length", func() {
+			p := RandomPadding(10, 20)
+			lengths := make(map[ByteCount]int)
+			for i := 0; i < 1000; i++ {
+				l := p.PaddingLen(100, 1000)
+				Expect(l).To(And(BeNumerically(">=", 10), BeNumerically("<=", 20)))
+				lengths[l]++
+			}
+			Expect(lengths).To(HaveLen(11))
+		})
+
+		It("pads with a fixed length if the range is empty", func() {
+			Expect(RandomPadding(10, 10).PaddingLen(100, 1000)).To(BeEquivalentTo(10))
+		})
+
+		It("doesn't pad beyond the maximum packet size", func() {
+			Expect(RandomPadding(100, 200).PaddingLen(950, 1000)).To(BeEquivalentTo(50))
+		})
+
+		It("panics for invalid ranges", func() {
+			Expect(func() { RandomPadding(-1, 10) }).To(Panic())
+			Expect(func() { RandomPadding(10, 9) }).To(Panic())
+		})
+	})
+})
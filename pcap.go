@@ -0,0 +1,229 @@
+package quic
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	pcapMagicNumber = 0xa1b2c3d4 // timestamps in microseconds
+	pcapSnapLen     = 65535
+	// LINKTYPE_RAW: the packets start with an IPv4 or an IPv6 header
+	pcapLinkTypeRaw = 101
+
+	ipv4HeaderLen = 20
+	ipv6HeaderLen = 40
+	udpHeaderLen  = 8
+	ipProtocolUDP = 17
+	ipTTL         = 64
+)
+
+// PcapWriter is a PacketCapturer that writes the datagrams of all connections to an io.Writer,
+// in the pcap format, such that they can be opened by tools like Wireshark and tcpdump.
+// Since the datagrams are captured above the UDP socket, IP and UDP headers are fabricated.
+// To decrypt the QUIC packets, the TLS secrets need to be logged using the tls.Config's KeyLogWriter.
+type PcapWriter struct {
+	maxBytesPerConnection ByteCount
+
+	mutex         sync.Mutex
+	out           io.Writer
+	headerWritten bool
+	err           error
+	buf           []byte
+}
+
+var _ PacketCapturer = &PcapWriter{}
+
+// NewPcapWriter creates a new PcapWriter.
+// At most maxBytesPerConnection bytes of UDP payload are captured per connection,
+// further datagrams are not written. If 0, the size of the capture is not limited.
+func NewPcapWriter(out io.Writer, maxBytesPerConnection ByteCount) *PcapWriter {
+	return &PcapWriter{
+		out:                   out,
+		maxBytesPerConnection: maxBytesPerConnection,
+	}
+}
+
+// CaptureConnection implements the PacketCapturer interface.
+func (w *PcapWriter) CaptureConnection(bool, ConnectionID) ConnectionCapture {
+	return &pcapConnectionCapture{writer: w}
+}
+
+// Err returns the first error that occurred when writing to the io.Writer.
+// Once an error occurred, no more datagrams are written.
+func (w *PcapWriter) Err() error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	return w.err
+}
+
+func (w *PcapWriter) writeDatagram(t time.Time, src, dst net.Addr, data []byte) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if w.err != nil {
+		return
+	}
+	if !w.headerWritten {
+		w.headerWritten = true
+		hdr := make([]byte, 24)
+		binary.LittleEndian.PutUint32(hdr[0:4], pcapMagicNumber)
+		binary.LittleEndian.PutUint16(hdr[4:6], 2) // major version
+		binary.LittleEndian.PutUint16(hdr[6:8], 4) // minor version
+		// time zone offset (4 bytes) and timestamp accuracy (4 bytes) are 0
+		binary.LittleEndian.PutUint32(hdr[16:20], pcapSnapLen)
+		binary.LittleEndian.PutUint32(hdr[20:24], pcapLinkTypeRaw)
+		if _, err := w.out.Write(hdr); err != nil {
+			w.err = err
+			return
+		}
+	}
+	w.buf = appendIPPacket(w.buf[:0], src, dst, data)
+	rec := make([]byte, 16)
+	binary.LittleEndian.PutUint32(rec[0:4], uint32(t.Unix()))
+	binary.LittleEndian.PutUint32(rec[4:8], uint32(t.Nanosecond()/1000))
+	binary.LittleEndian.PutUint32(rec[8:12], uint32(len(w.buf)))  // captured length
+	binary.LittleEndian.PutUint32(rec[12:16], uint32(len(w.buf))) // original length
+	if _, err := w.out.Write(rec); err != nil {
+		w.err = err
+		return
+	}
+	if _, err := w.out.Write(w.buf); err != nil {
+		w.err = err
+	}
+}
+
+type pcapConnectionCapture struct {
+	writer *PcapWriter
+
+	mutex    sync.Mutex
+	numBytes ByteCount
+}
+
+var _ ConnectionCapture = &pcapConnectionCapture{}
+
+func (c *pcapConnectionCapture) SentDatagram(t time.Time, local, remote net.Addr, data []byte) {
+	if c.allow(data) {
+		c.writer.writeDatagram(t, local, remote, data)
+	}
+}
+
+func (c *pcapConnectionCapture) ReceivedDatagram(t time.Time, local, remote net.Addr, data []byte) {
+	if c.allow(data) {
+		c.writer.writeDatagram(t, remote, local, data)
+	}
+}
+
+func (c *pcapConnectionCapture) Close() {}
+
+// allow says if a datagram can be captured without exceeding the size limit
+func (c *pcapConnectionCapture) allow(data []byte) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if max := c.writer.maxBytesPerConnection; max > 0 && c.numBytes+ByteCount(len(data)) > max {
+		return false
+	}
+	c.numBytes += ByteCount(len(data))
+	return true
+}
+
+// appendIPPacket appends an IP packet containing a UDP datagram.
+// If both addresses are IPv4 addresses, an IPv4 header is used, otherwise an IPv6 header.
+// Addresses that are not UDP addresses are replaced by the unspecified address.
+func appendIPPacket(b []byte, src, dst net.Addr, data []byte) []byte {
+	srcIP, srcPort := splitUDPAddr(src)
+	dstIP, dstPort := splitUDPAddr(dst)
+	udpLen := udpHeaderLen + len(data)
+
+	src4, dst4 := srcIP.To4(), dstIP.To4()
+	if isIPv4(srcIP, src4) && isIPv4(dstIP, dst4) {
+		if src4 == nil {
+			src4 = net.IPv4zero.To4()
+		}
+		if dst4 == nil {
+			dst4 = net.IPv4zero.To4()
+		}
+		start := len(b)
+		b = append(b,
+			0x45, 0, // version 4, header length 20, no DSCP / ECN
+			byte((ipv4HeaderLen+udpLen)>>8), byte(ipv4HeaderLen+udpLen),
+			0, 0, // identification
+			0x40, 0, // don't fragment
+			ipTTL, ipProtocolUDP,
+			0, 0, // header checksum
+		)
+		b = append(b, src4...)
+		b = append(b, dst4...)
+		binary.BigEndian.PutUint16(b[start+10:], ^foldChecksum(sumBytes(0, b[start:])))
+		pseudoHeaderSum := sumBytes(sumBytes(0, src4), dst4) + ipProtocolUDP + uint32(udpLen)
+		return appendUDPDatagram(b, pseudoHeaderSum, srcPort, dstPort, data)
+	}
+
+	src16, dst16 := srcIP.To16(), dstIP.To16()
+	if src16 == nil {
+		src16 = net.IPv6unspecified
+	}
+	if dst16 == nil {
+		dst16 = net.IPv6unspecified
+	}
+	b = append(b,
+		0x60, 0, 0, 0, // version 6, no traffic class, no flow label
+		byte(udpLen>>8), byte(udpLen),
+		ipProtocolUDP, ipTTL,
+	)
+	b = append(b, src16...)
+	b = append(b, dst16...)
+	pseudoHeaderSum := sumBytes(sumBytes(0, src16), dst16) + ipProtocolUDP + uint32(udpLen)
+	return appendUDPDatagram(b, pseudoHeaderSum, srcPort, dstPort, data)
+}
+
+func appendUDPDatagram(b []byte, pseudoHeaderSum uint32, srcPort, dstPort int, data []byte) []byte {
+	udpLen := udpHeaderLen + len(data)
+	start := len(b)
+	b = append(b,
+		byte(srcPort>>8), byte(srcPort),
+		byte(dstPort>>8), byte(dstPort),
+		byte(udpLen>>8), byte(udpLen),
+		0, 0, // checksum
+	)
+	b = append(b, data...)
+	checksum := ^foldChecksum(sumBytes(pseudoHeaderSum, b[start:]))
+	if checksum == 0 {
+		checksum = 0xffff
+	}
+	binary.BigEndian.PutUint16(b[start+6:], checksum)
+	return b
+}
+
+// isIPv4 says if an IP (and its 4 byte representation ip4) can be represented as an IPv4 address.
+// The unspecified IPv6 address (e.g. used when listening on all interfaces) is treated as an IPv4 address.
+func isIPv4(ip, ip4 net.IP) bool {
+	return ip4 != nil || ip == nil || ip.Equal(net.IPv6unspecified)
+}
+
+func splitUDPAddr(addr net.Addr) (net.IP, int) {
+	if udpAddr, ok := addr.(*net.UDPAddr); ok {
+		return udpAddr.IP, udpAddr.Port
+	}
+	return nil, 0
+}
+
+// sumBytes adds the data, interpreted as a sequence of 16 bit big endian numbers, to sum.
+func sumBytes(sum uint32, data []byte) uint32 {
+	for i := 0; i+1 < len(data); i += 2 {
+		sum += uint32(data[i])<<8 | uint32(data[i+1])
+	}
+	if len(data)%2 == 1 {
+		sum += uint32(data[len(data)-1]) << 8
+	}
+	return sum
+}
+
+func foldChecksum(sum uint32) uint16 {
+	for sum > 0xffff {
+		sum = (sum >> 16) + (sum & 0xffff)
+	}
+	return uint16(sum)
+}
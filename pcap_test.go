@@ -0,0 +1,175 @@
+package quic
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"net"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type pcapRecord struct {
+	time time.Time
+	data []byte
+}
+
+// parsePcap parses a pcap file, and checks that the global header is valid.
+func parsePcap(data []byte) []pcapRecord {
+	ExpectWithOffset(1, len(data)).To(BeNumerically(">=", 24))
+	ExpectWithOffset(1, binary.LittleEndian.Uint32(data[0:4])).To(BeEquivalentTo(0xa1b2c3d4))
+	ExpectWithOffset(1, binary.LittleEndian.Uint16(data[4:6])).To(BeEquivalentTo(2))
+	ExpectWithOffset(1, binary.LittleEndian.Uint16(data[6:8])).To(BeEquivalentTo(4))
+	ExpectWithOffset(1, binary.LittleEndian.Uint32(data[20:24])).To(BeEquivalentTo(101))
+	data = data[24:]
+	var records []pcapRecord
+	for len(data) > 0 {
+		ExpectWithOffset(1, len(data)).To(BeNumerically(">=", 16))
+		sec := binary.LittleEndian.Uint32(data[0:4])
+		usec := binary.LittleEndian.Uint32(data[4:8])
+		capLen := binary.LittleEndian.Uint32(data[8:12])
+		ExpectWithOffset(1, binary.LittleEndian.Uint32(data[12:16])).To(Equal(capLen))
+		data = data[16:]
+		ExpectWithOffset(1, len(data)).To(BeNumerically(">=", capLen))
+		records = append(records, pcapRecord{
+			time: time.Unix(int64(sec), int64(usec)*1000),
+			data: data[:capLen],
+		})
+		data = data[capLen:]
+	}
+	return records
+}
+
+var _ = Describe("pcap", func() {
+	var (
+		buf    *bytes.Buffer
+		writer *PcapWriter
+	)
+
+	local4 := &net.UDPAddr{IP: net.IPv4(192, 168, 1, 1), Port: 443}
+	remote4 := &net.UDPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 1337}
+
+	BeforeEach(func() {
+		buf = &bytes.Buffer{}
+		writer = NewPcapWriter(buf, 0)
+	})
+
+	It("doesn't write anything if no datagrams are captured", func() {
+		writer.CaptureConnection(true, nil).Close()
+		Expect(buf.Len()).To(BeZero())
+	})
+
+	It("writes IPv4 packets", func() {
+		capture := writer.CaptureConnection(false, nil)
+		t := time.Now()
+		capture.ReceivedDatagram(t, local4, remote4, []byte("foobar"))
+		capture.SentDatagram(t.Add(time.Second), local4, remote4, []byte("lorem ipsum"))
+		records := parsePcap(buf.Bytes())
+		Expect(records).To(HaveLen(2))
+		Expect(records[0].time).To(BeTemporally("~", t, time.Microsecond))
+		Expect(records[1].time).To(BeTemporally("~", t.Add(time.Second), time.Microsecond))
+
+		p := records[0].data
+		Expect(p).To(HaveLen(20 + 8 + 6))
+		Expect(p[0]).To(Equal(byte(0x45)))
+		Expect(binary.BigEndian.Uint16(p[2:4])).To(BeEquivalentTo(len(p)))
+		Expect(p[9]).To(BeEquivalentTo(17)) // UDP
+		Expect(foldChecksum(sumBytes(0, p[:20]))).To(BeEquivalentTo(0xffff))
+		Expect(net.IP(p[12:16]).Equal(remote4.IP)).To(BeTrue())
+		Expect(net.IP(p[16:20]).Equal(local4.IP)).To(BeTrue())
+		udp := p[20:]
+		Expect(binary.BigEndian.Uint16(udp[0:2])).To(BeEquivalentTo(1337))
+		Expect(binary.BigEndian.Uint16(udp[2:4])).To(BeEquivalentTo(443))
+		Expect(binary.BigEndian.Uint16(udp[4:6])).To(BeEquivalentTo(8 + 6))
+		pseudoHeaderSum := sumBytes(sumBytes(0, p[12:16]), p[16:20]) + 17 + uint32(len(udp))
+		Expect(foldChecksum(sumBytes(pseudoHeaderSum, udp))).To(BeEquivalentTo(0xffff))
+		Expect(udp[8:]).To(Equal([]byte("foobar")))
+
+		p = records[1].data
+		Expect(net.IP(p[12:16]).Equal(local4.IP)).To(BeTrue())
+		Expect(net.IP(p[16:20]).Equal(remote4.IP)).To(BeTrue())
+		Expect(binary.BigEndian.Uint16(p[20:22])).To(BeEquivalentTo(443))
+		Expect(binary.BigEndian.Uint16(p[22:24])).To(BeEquivalentTo(1337))
+		Expect(p[28:]).To(Equal([]byte("lorem ipsum")))
+	})
+
+	It("uses IPv4 if the local address is the unspecified address", func() {
+		capture := writer.CaptureConnection(false, nil)
+		capture.SentDatagram(time.Now(), &net.UDPAddr{IP: net.IPv6unspecified, Port: 443}, remote4, []byte("foobar"))
+		records := parsePcap(buf.Bytes())
+		Expect(records).To(HaveLen(1))
+		p := records[0].data
+		Expect(p[0]).To(Equal(byte(0x45)))
+		Expect(net.IP(p[12:16]).Equal(net.IPv4zero)).To(BeTrue())
+	})
+
+	It("writes IPv6 packets", func() {
+		local := &net.UDPAddr{IP: net.ParseIP("2001:db8::1"), Port: 443}
+		remote := &net.UDPAddr{IP: net.ParseIP("2001:db8::2"), Port: 1337}
+		capture := writer.CaptureConnection(true, nil)
+		capture.SentDatagram(time.Now(), local, remote, []byte("foobar"))
+		records := parsePcap(buf.Bytes())
+		Expect(records).To(HaveLen(1))
+		p := records[0].data
+		Expect(p).To(HaveLen(40 + 8 + 6))
+		Expect(p[0] >> 4).To(BeEquivalentTo(6))
+		Expect(binary.BigEndian.Uint16(p[4:6])).To(BeEquivalentTo(8 + 6))
+		Expect(p[6]).To(BeEquivalentTo(17)) // UDP
+		Expect(net.IP(p[8:24]).Equal(local.IP)).To(BeTrue())
+		Expect(net.IP(p[24:40]).Equal(remote.IP)).To(BeTrue())
+		udp := p[40:]
+		Expect(binary.BigEndian.Uint16(udp[0:2])).To(BeEquivalentTo(443))
+		Expect(binary.BigEndian.Uint16(udp[2:4])).To(BeEquivalentTo(1337))
+		pseudoHeaderSum := sumBytes(sumBytes(0, p[8:24]), p[24:40]) + 17 + uint32(len(udp))
+		Expect(foldChecksum(sumBytes(pseudoHeaderSum, udp))).To(BeEquivalentTo(0xffff))
+		Expect(udp[8:]).To(Equal([]byte("foobar")))
+	})
+
+	It("doesn't retain the data", func() {
+		capture := writer.CaptureConnection(true, nil)
+		data := []byte("foobar")
+		capture.SentDatagram(time.Now(), local4, remote4, data)
+		copy(data, "raboof")
+		Expect(parsePcap(buf.Bytes())[0].data[28:]).To(Equal([]byte("foobar")))
+	})
+
+	It("limits the size of the capture per connection", func() {
+		writer = NewPcapWriter(buf, 10)
+		capture1 := writer.CaptureConnection(true, nil)
+		capture2 := writer.CaptureConnection(true, nil)
+		capture1.SentDatagram(time.Now(), local4, remote4, []byte("foo"))
+		capture1.ReceivedDatagram(time.Now(), local4, remote4, []byte("foobar"))
+		capture1.SentDatagram(time.Now(), local4, remote4, []byte("foo")) // exceeds the limit
+		capture1.SentDatagram(time.Now(), local4, remote4, []byte("f"))
+		capture2.SentDatagram(time.Now(), local4, remote4, []byte("foobar"))
+		records := parsePcap(buf.Bytes())
+		Expect(records).To(HaveLen(4))
+		Expect(records[0].data[28:]).To(Equal([]byte("foo")))
+		Expect(records[1].data[28:]).To(Equal([]byte("foobar")))
+		Expect(records[2].data[28:]).To(Equal([]byte("f")))
+		Expect(records[3].data[28:]).To(Equal([]byte("foobar")))
+	})
+
+	It("stops writing after an error", func() {
+		testErr := errors.New("test error")
+		w := &errorWriter{err: testErr}
+		writer = NewPcapWriter(w, 0)
+		capture := writer.CaptureConnection(true, nil)
+		capture.SentDatagram(time.Now(), local4, remote4, []byte("foobar"))
+		capture.SentDatagram(time.Now(), local4, remote4, []byte("foobar"))
+		Expect(w.numWrites).To(Equal(1))
+		Expect(writer.Err()).To(MatchError(testErr))
+	})
+})
+
+type errorWriter struct {
+	err       error
+	numWrites int
+}
+
+func (w *errorWriter) Write(p []byte) (int, error) {
+	w.numWrites++
+	return 0, w.err
+}
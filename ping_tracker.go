@@ -0,0 +1,86 @@
+package quic
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+	"github.com/lucas-clemente/quic-go/internal/wire"
+)
+
+// ErrPingPending is returned by Session.SendPing if the PING sent before wasn't acknowledged yet.
+var ErrPingPending = errors.New("a PING is already pending")
+
+var errSessionClosedBeforePingAcked = errors.New("session closed before the PING was acknowledged")
+
+// An outstandingPing is a PING frame sent by the application, that wasn't acknowledged yet.
+type outstandingPing struct {
+	// The PING frame is identified by its address.
+	// Pointers to separately allocated zero-size values (like a PingFrame) are not guaranteed to be distinct,
+	// so the frame is allocated as the first field of the outstandingPing.
+	frame wire.PingFrame
+	// The packets the PING frame was sent in.
+	// The frame is sent again when a packet containing it is retransmitted.
+	packetNumbers []protocol.PacketNumber
+	sentTimes     []time.Time
+
+	done chan struct{} // closed when the PING is acknowledged
+	rtt  time.Duration // the time between sending the PING and receiving the ACK, set when done is closed
+}
+
+// The pingTracker tracks the PING frames sent by the application.
+// To prevent the application from flooding the peer with PINGs, at most one PING can be outstanding at any time.
+// Since a PING is only acknowledged after (at least) one RTT, at most one PING is sent per RTT.
+type pingTracker struct {
+	mutex sync.Mutex
+	ping  *outstandingPing // nil if no PING is outstanding
+}
+
+// Ping returns the outstanding PING.
+// If no PING is outstanding, a new one is created, which the caller has to queue for sending.
+func (t *pingTracker) Ping() (p *outstandingPing, isNew bool) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if t.ping != nil {
+		return t.ping, false
+	}
+	t.ping = &outstandingPing{done: make(chan struct{})}
+	return t.ping, true
+}
+
+// SentPacket is called for every packet sent.
+func (t *pingTracker) SentPacket(pn protocol.PacketNumber, frames []wire.Frame, sendTime time.Time) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if t.ping == nil {
+		return
+	}
+	for _, f := range frames {
+		if f == wire.Frame(&t.ping.frame) {
+			t.ping.packetNumbers = append(t.ping.packetNumbers, pn)
+			t.ping.sentTimes = append(t.ping.sentTimes, sendTime)
+			return
+		}
+	}
+}
+
+// ReceivedAck is called for every ACK frame received for 1-RTT packets.
+func (t *pingTracker) ReceivedAck(ack *wire.AckFrame, rcvTime time.Time) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if t.ping == nil {
+		return
+	}
+	for i, pn := range t.ping.packetNumbers {
+		if ack.AcksPacket(pn) {
+			t.ping.rtt = rcvTime.Sub(t.ping.sentTimes[i])
+			close(t.ping.done)
+			t.ping = nil
+			return
+		}
+	}
+}
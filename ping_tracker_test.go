@@ -0,0 +1,77 @@
+package quic
+
+import (
+	"time"
+
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+	"github.com/lucas-clemente/quic-go/internal/wire"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("PING tracker", func() {
+	var tracker *pingTracker
+
+	BeforeEach(func() {
+		tracker = &pingTracker{}
+	})
+
+	ackFor := func(pns ...protocol.PacketNumber) *wire.AckFrame {
+		ack := &wire.AckFrame{}
+		for i := len(pns) - 1; i >= 0; i-- {
+			ack.AckRanges = append(ack.AckRanges, wire.AckRange{Smallest: pns[i], Largest: pns[i]})
+		}
+		return ack
+	}
+
+	It("creates a new PING, if none is outstanding", func() {
+		p, isNew := tracker.Ping()
+		Expect(isNew).To(BeTrue())
+		Expect(p).ToNot(BeNil())
+		p2, isNew := tracker.Ping()
+		Expect(isNew).To(BeFalse())
+		Expect(p2).To(Equal(p))
+	})
+
+	It("completes the PING when the packet containing it is acknowledged", func() {
+		p, _ := tracker.Ping()
+		now := time.Now()
+		tracker.SentPacket(10, []wire.Frame{&wire.MaxDataFrame{}}, now.Add(-time.Second))
+		tracker.SentPacket(11, []wire.Frame{&wire.MaxDataFrame{}, &p.frame}, now.Add(-time.Second))
+		tracker.SentPacket(12, []wire.Frame{&wire.PingFrame{}}, now.Add(-time.Second))
+		tracker.ReceivedAck(ackFor(10, 12), now)
+		Expect(p.done).ToNot(BeClosed())
+		tracker.ReceivedAck(ackFor(11), now.Add(-100*time.Millisecond))
+		Expect(p.done).To(BeClosed())
+		Expect(p.rtt).To(Equal(900 * time.Millisecond))
+		// now a new PING can be sent
+		_, isNew := tracker.Ping()
+		Expect(isNew).To(BeTrue())
+	})
+
+	It("doesn't confuse the PING with other PING frames", func() {
+		p, _ := tracker.Ping()
+		tracker.SentPacket(10, []wire.Frame{&wire.PingFrame{}}, time.Now())
+		tracker.SentPacket(11, []wire.Frame{new(wire.PingFrame)}, time.Now())
+		tracker.ReceivedAck(ackFor(10, 11), time.Now())
+		Expect(p.done).ToNot(BeClosed())
+	})
+
+	It("measures the RTT from the transmission that was acknowledged", func() {
+		p, _ := tracker.Ping()
+		now := time.Now()
+		tracker.SentPacket(10, []wire.Frame{&p.frame}, now.Add(-time.Second))
+		// the packet was declared lost, and the PING was retransmitted
+		tracker.SentPacket(15, []wire.Frame{&p.frame}, now.Add(-200*time.Millisecond))
+		tracker.ReceivedAck(ackFor(15), now)
+		Expect(p.done).To(BeClosed())
+		Expect(p.rtt).To(Equal(200 * time.Millisecond))
+	})
+
+	It("ignores ACKs when no PING is outstanding", func() {
+		tracker.SentPacket(10, []wire.Frame{&wire.PingFrame{}}, time.Now())
+		tracker.ReceivedAck(ackFor(10), time.Now())
+		_, isNew := tracker.Ping()
+		Expect(isNew).To(BeTrue())
+	})
+})
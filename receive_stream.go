@@ -1,6 +1,7 @@
 package quic
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"sync"
@@ -44,10 +45,22 @@ type receiveStream struct {
 	finRead           bool // set once we read a frame with a FinBit
 	canceledRead      bool // set when CancelRead() is called
 	resetRemotely     bool // set when HandleResetStreamFrame() is called
+	allDataReceived   bool // set once all data up to the final offset was received
 
 	readChan chan struct{}
+	// finChan is closed when all data up to the final offset was received,
+	// or when the stream is canceled, reset or closed
+	finChan  chan struct{}
 	deadline time.Time
 
+	// the highest offset received, used to detect reordering
+	highestReceived         protocol.ByteCount
+	maxObservedReorderDepth protocol.ByteCount
+	reorderEvents           uint64
+
+	readNotifyThreshold int
+	notifyStream        ReceiveStream // the stream passed to the OnReadAvailable callback
+
 	flowController flowcontrol.StreamFlowController
 	version        protocol.VersionNumber
 }
@@ -61,15 +74,18 @@ func newReceiveStream(
 	flowController flowcontrol.StreamFlowController,
 	version protocol.VersionNumber,
 ) *receiveStream {
-	return &receiveStream{
+	s := &receiveStream{
 		streamID:       streamID,
 		sender:         sender,
 		flowController: flowController,
 		frameQueue:     newFrameSorter(),
 		readChan:       make(chan struct{}, 1),
+		finChan:        make(chan struct{}),
 		finalOffset:    protocol.MaxByteCount,
 		version:        version,
 	}
+	s.notifyStream = s
+	return s
 }
 
 func (s *receiveStream) StreamID() protocol.StreamID {
@@ -183,6 +199,36 @@ func (s *receiveStream) readImpl(p []byte) (bool /*stream completed */, int, err
 	return false, bytesRead, nil
 }
 
+func (s *receiveStream) ReadAvailable() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.readAvailable()
+}
+
+func (s *receiveStream) readAvailable() int {
+	if s.finRead || s.canceledRead || s.resetRemotely || s.closedForShutdown {
+		return 0
+	}
+	return len(s.currentFrame) - s.readPosInFrame + int(s.frameQueue.ContiguousLen())
+}
+
+// finAvailable says if all data up to the final offset is available for reading
+func (s *receiveStream) finAvailable() bool {
+	return s.readOffset+protocol.ByteCount(s.readAvailable()) == s.finalOffset
+}
+
+func (s *receiveStream) SetReadNotifyThreshold(n int) {
+	s.mutex.Lock()
+	s.readNotifyThreshold = n
+	available := s.readAvailable()
+	notify := n > 0 && (available >= n || (available > 0 && s.finAvailable()))
+	s.mutex.Unlock()
+
+	if notify {
+		s.sender.onReadAvailable(s.notifyStream, available)
+	}
+}
+
 func (s *receiveStream) dequeueNextFrame() {
 	var offset protocol.ByteCount
 	offset, s.currentFrame = s.frameQueue.Pop()
@@ -207,6 +253,7 @@ func (s *receiveStream) cancelReadImpl(errorCode protocol.ApplicationErrorCode)
 	s.canceledRead = true
 	s.cancelReadErr = fmt.Errorf("Read on stream %d canceled with error code %d", s.streamID, errorCode)
 	s.signalRead()
+	s.closeFinChan()
 	s.sender.queueControlFrame(&wire.StopSendingFrame{
 		StreamID:  s.streamID,
 		ErrorCode: errorCode,
@@ -217,9 +264,26 @@ func (s *receiveStream) cancelReadImpl(errorCode protocol.ApplicationErrorCode)
 
 func (s *receiveStream) handleStreamFrame(frame *wire.StreamFrame) error {
 	s.mutex.Lock()
+	// Determining the amount of data available requires walking the frame queue,
+	// so only do this if the application asked to be notified.
+	var availableBefore int
+	var finAvailableBefore bool
+	if s.readNotifyThreshold > 0 {
+		availableBefore, finAvailableBefore = s.readAvailable(), s.finAvailable()
+	}
 	completed, err := s.handleStreamFrameImpl(frame)
+	var notify bool
+	var available int
+	if err == nil && s.readNotifyThreshold > 0 {
+		available = s.readAvailable()
+		notify = (available > availableBefore && available >= s.readNotifyThreshold) ||
+			(!finAvailableBefore && s.finAvailable())
+	}
 	s.mutex.Unlock()
 
+	if notify {
+		s.sender.onReadAvailable(s.notifyStream, available)
+	}
 	if completed {
 		s.streamCompleted()
 	}
@@ -237,13 +301,40 @@ func (s *receiveStream) handleStreamFrameImpl(frame *wire.StreamFrame) (bool /*
 	if s.canceledRead {
 		return frame.FinBit, nil
 	}
+	s.updateReorderStats(maxOffset)
 	if err := s.frameQueue.Push(frame.Data, frame.Offset); err != nil {
 		return false, err
 	}
+	if !s.allDataReceived && s.finalOffset != protocol.MaxByteCount && (s.finRead || s.finAvailable()) {
+		s.allDataReceived = true
+		s.closeFinChan()
+	}
 	s.signalRead()
 	return false, nil
 }
 
+// updateReorderStats records a reordering event if a frame arrives after data at higher offsets was already received.
+// The depth is the amount of data that was received beyond the end of the frame.
+// Frames that only contain data that was already dequeued are retransmissions, not reordering.
+func (s *receiveStream) updateReorderStats(maxOffset protocol.ByteCount) {
+	if maxOffset < s.highestReceived && maxOffset > s.frameQueue.readPos {
+		s.reorderEvents++
+		if depth := s.highestReceived - maxOffset; depth > s.maxObservedReorderDepth {
+			s.maxObservedReorderDepth = depth
+			s.flowController.UpdateReorderDepth(depth)
+		}
+	}
+	if maxOffset > s.highestReceived {
+		s.highestReceived = maxOffset
+	}
+}
+
+func (s *receiveStream) ReorderStats() (protocol.ByteCount, uint64) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.maxObservedReorderDepth, s.reorderEvents
+}
+
 func (s *receiveStream) handleResetStreamFrame(frame *wire.ResetStreamFrame) error {
 	s.mutex.Lock()
 	completed, err := s.handleResetStreamFrameImpl(frame)
@@ -274,9 +365,40 @@ func (s *receiveStream) handleResetStreamFrameImpl(frame *wire.ResetStreamFrame)
 		error:     fmt.Errorf("Stream %d was reset with error code %d", s.streamID, frame.ErrorCode),
 	}
 	s.signalRead()
+	s.closeFinChan()
 	return true, nil
 }
 
+func (s *receiveStream) WaitForPeerFIN(ctx context.Context) error {
+	select {
+	case <-s.finChan:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.resetRemotely {
+		return s.resetRemotelyErr
+	}
+	if s.canceledRead {
+		return s.cancelReadErr
+	}
+	if s.allDataReceived {
+		return nil
+	}
+	return s.closeForShutdownErr
+}
+
+// must be called after locking the mutex
+func (s *receiveStream) closeFinChan() {
+	select {
+	case <-s.finChan:
+	default:
+		close(s.finChan)
+	}
+}
+
 func (s *receiveStream) CloseRemote(offset protocol.ByteCount) {
 	s.handleStreamFrame(&wire.StreamFrame{FinBit: true, Offset: offset})
 }
@@ -296,23 +418,34 @@ func (s *receiveStream) closeForShutdown(err error) {
 	s.mutex.Lock()
 	s.closedForShutdown = true
 	s.closeForShutdownErr = err
+	s.closeFinChan()
 	s.mutex.Unlock()
 	s.signalRead()
 }
 
 func (s *receiveStream) getWindowUpdate() protocol.ByteCount {
-	return s.flowController.GetWindowUpdate()
+	s.mutex.Lock()
+	buffered := protocol.ByteCount(s.readAvailable()) + s.frameQueue.GapBytes()
+	s.mutex.Unlock()
+	return s.flowController.GetWindowUpdate(buffered)
 }
 
 func (s *receiveStream) streamCompleted() {
 	s.mutex.Lock()
 	finRead := s.finRead
+	// If the FIN wasn't read, the stream was canceled or reset.
+	var err error
+	if s.cancelReadErr != nil {
+		err = s.cancelReadErr
+	} else if s.resetRemotelyErr != nil {
+		err = s.resetRemotelyErr
+	}
 	s.mutex.Unlock()
 
 	if !finRead {
 		s.flowController.Abandon()
 	}
-	s.sender.onStreamCompleted(s.streamID)
+	s.sender.onStreamCompleted(s.streamID, err)
 }
 
 // signalRead performs a non-blocking send on the readChan
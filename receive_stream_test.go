@@ -1,14 +1,20 @@
 package quic
 
 import (
+	"context"
 	"errors"
 	"io"
+	"io/ioutil"
 	"runtime"
 	"time"
 
 	"github.com/golang/mock/gomock"
+	"github.com/lucas-clemente/quic-go/internal/congestion"
+	"github.com/lucas-clemente/quic-go/internal/flowcontrol"
 	"github.com/lucas-clemente/quic-go/internal/mocks"
 	"github.com/lucas-clemente/quic-go/internal/protocol"
+	"github.com/lucas-clemente/quic-go/internal/qerr"
+	"github.com/lucas-clemente/quic-go/internal/utils"
 	"github.com/lucas-clemente/quic-go/internal/wire"
 
 	. "github.com/onsi/ginkgo"
@@ -142,6 +148,7 @@ var _ = Describe("Receive Stream", func() {
 		It("handles STREAM frames in wrong order", func() {
 			mockFC.EXPECT().UpdateHighestReceived(protocol.ByteCount(2), false)
 			mockFC.EXPECT().UpdateHighestReceived(protocol.ByteCount(4), false)
+			mockFC.EXPECT().UpdateReorderDepth(protocol.ByteCount(2))
 			mockFC.EXPECT().AddBytesRead(protocol.ByteCount(2)).Times(2)
 			frame1 := wire.StreamFrame{
 				Offset: 2,
@@ -334,7 +341,7 @@ var _ = Describe("Receive Stream", func() {
 						Data:   []byte{0xDE, 0xAD, 0xBE, 0xEF},
 						FinBit: true,
 					})
-					mockSender.EXPECT().onStreamCompleted(streamID)
+					mockSender.EXPECT().onStreamCompleted(streamID, nil)
 					b := make([]byte, 4)
 					n, err := strWithTimeout.Read(b)
 					Expect(err).To(MatchError(io.EOF))
@@ -348,6 +355,7 @@ var _ = Describe("Receive Stream", func() {
 				It("handles out-of-order frames", func() {
 					mockFC.EXPECT().UpdateHighestReceived(protocol.ByteCount(2), false)
 					mockFC.EXPECT().UpdateHighestReceived(protocol.ByteCount(4), true)
+					mockFC.EXPECT().UpdateReorderDepth(protocol.ByteCount(2))
 					mockFC.EXPECT().AddBytesRead(protocol.ByteCount(2)).Times(2)
 					frame1 := wire.StreamFrame{
 						Offset: 2,
@@ -362,7 +370,7 @@ var _ = Describe("Receive Stream", func() {
 					Expect(err).ToNot(HaveOccurred())
 					err = str.handleStreamFrame(&frame2)
 					Expect(err).ToNot(HaveOccurred())
-					mockSender.EXPECT().onStreamCompleted(streamID)
+					mockSender.EXPECT().onStreamCompleted(streamID, nil)
 					b := make([]byte, 4)
 					n, err := strWithTimeout.Read(b)
 					Expect(err).To(MatchError(io.EOF))
@@ -382,7 +390,7 @@ var _ = Describe("Receive Stream", func() {
 						FinBit: true,
 					})
 					Expect(err).ToNot(HaveOccurred())
-					mockSender.EXPECT().onStreamCompleted(streamID)
+					mockSender.EXPECT().onStreamCompleted(streamID, nil)
 					b := make([]byte, 4)
 					n, err := strWithTimeout.Read(b)
 					Expect(err).To(MatchError(io.EOF))
@@ -398,7 +406,7 @@ var _ = Describe("Receive Stream", func() {
 						FinBit: true,
 					})
 					Expect(err).ToNot(HaveOccurred())
-					mockSender.EXPECT().onStreamCompleted(streamID)
+					mockSender.EXPECT().onStreamCompleted(streamID, nil)
 					b := make([]byte, 4)
 					n, err := strWithTimeout.Read(b)
 					Expect(n).To(BeZero())
@@ -410,7 +418,7 @@ var _ = Describe("Receive Stream", func() {
 				mockFC.EXPECT().UpdateHighestReceived(protocol.ByteCount(0), true)
 				mockFC.EXPECT().AddBytesRead(protocol.ByteCount(0))
 				str.CloseRemote(0)
-				mockSender.EXPECT().onStreamCompleted(streamID)
+				mockSender.EXPECT().onStreamCompleted(streamID, nil)
 				b := make([]byte, 8)
 				n, err := strWithTimeout.Read(b)
 				Expect(n).To(BeZero())
@@ -494,7 +502,7 @@ var _ = Describe("Receive Stream", func() {
 					Data:     []byte("foobar"),
 					FinBit:   true,
 				})).To(Succeed())
-				mockSender.EXPECT().onStreamCompleted(streamID)
+				mockSender.EXPECT().onStreamCompleted(streamID, nil)
 				_, err := strWithTimeout.Read(make([]byte, 100))
 				Expect(err).To(MatchError(io.EOF))
 				str.CancelRead(1234)
@@ -505,7 +513,7 @@ var _ = Describe("Receive Stream", func() {
 					mockFC.EXPECT().UpdateHighestReceived(protocol.ByteCount(42), true),
 					mockFC.EXPECT().Abandon(),
 				)
-				mockSender.EXPECT().onStreamCompleted(streamID)
+				mockSender.EXPECT().onStreamCompleted(streamID, gomock.Not(gomock.Nil()))
 				Expect(str.handleResetStreamFrame(&wire.ResetStreamFrame{
 					StreamID:   streamID,
 					ByteOffset: 42,
@@ -521,7 +529,7 @@ var _ = Describe("Receive Stream", func() {
 				})).To(Succeed())
 				mockFC.EXPECT().Abandon()
 				mockSender.EXPECT().queueControlFrame(gomock.Any())
-				mockSender.EXPECT().onStreamCompleted(streamID)
+				mockSender.EXPECT().onStreamCompleted(streamID, gomock.Not(gomock.Nil()))
 				str.CancelRead(1234)
 			})
 
@@ -532,7 +540,7 @@ var _ = Describe("Receive Stream", func() {
 					mockFC.EXPECT().UpdateHighestReceived(protocol.ByteCount(1000), true),
 					mockFC.EXPECT().Abandon(),
 				)
-				mockSender.EXPECT().onStreamCompleted(streamID)
+				mockSender.EXPECT().onStreamCompleted(streamID, gomock.Not(gomock.Nil()))
 				Expect(str.handleStreamFrame(&wire.StreamFrame{
 					Offset: 1000,
 					FinBit: true,
@@ -559,7 +567,7 @@ var _ = Describe("Receive Stream", func() {
 					close(done)
 				}()
 				Consistently(done).ShouldNot(BeClosed())
-				mockSender.EXPECT().onStreamCompleted(streamID)
+				mockSender.EXPECT().onStreamCompleted(streamID, gomock.Not(gomock.Nil()))
 				gomock.InOrder(
 					mockFC.EXPECT().UpdateHighestReceived(protocol.ByteCount(42), true),
 					mockFC.EXPECT().Abandon(),
@@ -569,7 +577,7 @@ var _ = Describe("Receive Stream", func() {
 			})
 
 			It("doesn't allow further calls to Read", func() {
-				mockSender.EXPECT().onStreamCompleted(streamID)
+				mockSender.EXPECT().onStreamCompleted(streamID, gomock.Not(gomock.Nil()))
 				gomock.InOrder(
 					mockFC.EXPECT().UpdateHighestReceived(protocol.ByteCount(42), true),
 					mockFC.EXPECT().Abandon(),
@@ -590,7 +598,7 @@ var _ = Describe("Receive Stream", func() {
 			})
 
 			It("ignores duplicate RESET_STREAM frames", func() {
-				mockSender.EXPECT().onStreamCompleted(streamID)
+				mockSender.EXPECT().onStreamCompleted(streamID, gomock.Not(gomock.Nil()))
 				mockFC.EXPECT().Abandon()
 				mockFC.EXPECT().UpdateHighestReceived(protocol.ByteCount(42), true).Times(2)
 				Expect(str.handleResetStreamFrame(rst)).To(Succeed())
@@ -605,6 +613,199 @@ var _ = Describe("Receive Stream", func() {
 		})
 	})
 
+	Context("waiting for the peer's FIN", func() {
+		It("returns when all data up to the FIN was received", func() {
+			mockFC.EXPECT().UpdateHighestReceived(protocol.ByteCount(6), true)
+			mockFC.EXPECT().UpdateHighestReceived(protocol.ByteCount(2), false)
+			mockFC.EXPECT().UpdateReorderDepth(protocol.ByteCount(4))
+			done := make(chan struct{})
+			go func() {
+				defer GinkgoRecover()
+				Expect(str.WaitForPeerFIN(context.Background())).To(Succeed())
+				close(done)
+			}()
+			Expect(str.handleStreamFrame(&wire.StreamFrame{
+				Offset: 2,
+				Data:   []byte("obar"),
+				FinBit: true,
+			})).To(Succeed())
+			// the first two bytes are still missing
+			Consistently(done).ShouldNot(BeClosed())
+			Expect(str.handleStreamFrame(&wire.StreamFrame{Data: []byte("fo")})).To(Succeed())
+			Eventually(done).Should(BeClosed())
+			// the data can still be read
+			mockFC.EXPECT().AddBytesRead(gomock.Any()).AnyTimes()
+			mockSender.EXPECT().onStreamCompleted(streamID, nil)
+			data, err := ioutil.ReadAll(strWithTimeout)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(data).To(Equal([]byte("foobar")))
+			Expect(str.WaitForPeerFIN(context.Background())).To(Succeed())
+		})
+
+		It("returns when the context is canceled", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			done := make(chan struct{})
+			go func() {
+				defer GinkgoRecover()
+				Expect(str.WaitForPeerFIN(ctx)).To(MatchError(context.Canceled))
+				close(done)
+			}()
+			Consistently(done).ShouldNot(BeClosed())
+			cancel()
+			Eventually(done).Should(BeClosed())
+		})
+
+		It("returns an error when the stream is reset", func() {
+			mockSender.EXPECT().onStreamCompleted(streamID, gomock.Not(gomock.Nil()))
+			mockFC.EXPECT().UpdateHighestReceived(protocol.ByteCount(42), true)
+			mockFC.EXPECT().Abandon()
+			done := make(chan struct{})
+			go func() {
+				defer GinkgoRecover()
+				err := str.WaitForPeerFIN(context.Background())
+				Expect(err).To(MatchError("Stream 1337 was reset with error code 1234"))
+				Expect(err).To(BeAssignableToTypeOf(streamCanceledError{}))
+				close(done)
+			}()
+			Consistently(done).ShouldNot(BeClosed())
+			Expect(str.handleResetStreamFrame(&wire.ResetStreamFrame{
+				StreamID:   streamID,
+				ByteOffset: 42,
+				ErrorCode:  1234,
+			})).To(Succeed())
+			Eventually(done).Should(BeClosed())
+		})
+
+		It("returns an error when reading is canceled", func() {
+			mockSender.EXPECT().queueControlFrame(gomock.Any())
+			str.CancelRead(1234)
+			Expect(str.WaitForPeerFIN(context.Background())).To(MatchError("Read on stream 1337 canceled with error code 1234"))
+		})
+
+		It("returns an error when the stream is closed for shutdown", func() {
+			testErr := errors.New("test error")
+			str.closeForShutdown(testErr)
+			Expect(str.WaitForPeerFIN(context.Background())).To(MatchError(testErr))
+		})
+	})
+
+	Context("read notifications", func() {
+		It("says how many bytes can be read without blocking", func() {
+			mockFC.EXPECT().UpdateHighestReceived(gomock.Any(), false).Times(3)
+			mockFC.EXPECT().UpdateReorderDepth(protocol.ByteCount(3))
+			mockFC.EXPECT().AddBytesRead(protocol.ByteCount(2))
+			Expect(str.ReadAvailable()).To(BeZero())
+			Expect(str.handleStreamFrame(&wire.StreamFrame{Data: []byte("foo")})).To(Succeed())
+			Expect(str.handleStreamFrame(&wire.StreamFrame{Offset: 6, Data: []byte("baz")})).To(Succeed())
+			Expect(str.ReadAvailable()).To(Equal(3))
+			Expect(str.handleStreamFrame(&wire.StreamFrame{Offset: 3, Data: []byte("bar")})).To(Succeed())
+			Expect(str.ReadAvailable()).To(Equal(9))
+			n, err := strWithTimeout.Read(make([]byte, 2))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(n).To(Equal(2))
+			Expect(str.ReadAvailable()).To(Equal(7))
+		})
+
+		It("doesn't report any data after the stream was canceled", func() {
+			mockFC.EXPECT().UpdateHighestReceived(protocol.ByteCount(3), false)
+			mockSender.EXPECT().queueControlFrame(gomock.Any())
+			Expect(str.handleStreamFrame(&wire.StreamFrame{Data: []byte("foo")})).To(Succeed())
+			str.CancelRead(1234)
+			Expect(str.ReadAvailable()).To(BeZero())
+		})
+
+		It("notifies when the threshold is reached", func() {
+			mockFC.EXPECT().UpdateHighestReceived(gomock.Any(), false).Times(4)
+			mockFC.EXPECT().UpdateReorderDepth(protocol.ByteCount(3))
+			str.SetReadNotifyThreshold(5)
+			Expect(str.handleStreamFrame(&wire.StreamFrame{Data: []byte("foo")})).To(Succeed())
+			// data after a gap is not available for reading
+			Expect(str.handleStreamFrame(&wire.StreamFrame{Offset: 6, Data: []byte("baz")})).To(Succeed())
+			mockSender.EXPECT().onReadAvailable(str, 9)
+			Expect(str.handleStreamFrame(&wire.StreamFrame{Offset: 3, Data: []byte("bar")})).To(Succeed())
+			// duplicate data doesn't trigger a notification
+			Expect(str.handleStreamFrame(&wire.StreamFrame{Offset: 3, Data: []byte("bar")})).To(Succeed())
+		})
+
+		It("notifies when the end of the stream is available", func() {
+			mockFC.EXPECT().UpdateHighestReceived(protocol.ByteCount(3), true)
+			mockSender.EXPECT().onReadAvailable(str, 3)
+			str.SetReadNotifyThreshold(100)
+			Expect(str.handleStreamFrame(&wire.StreamFrame{Data: []byte("foo"), FinBit: true})).To(Succeed())
+		})
+
+		It("notifies immediately, if enough data is already available", func() {
+			mockFC.EXPECT().UpdateHighestReceived(protocol.ByteCount(6), false)
+			Expect(str.handleStreamFrame(&wire.StreamFrame{Data: []byte("foobar")})).To(Succeed())
+			mockSender.EXPECT().onReadAvailable(str, 6)
+			str.SetReadNotifyThreshold(4)
+			str.SetReadNotifyThreshold(10)
+		})
+
+		It("doesn't notify when the threshold is 0", func() {
+			mockFC.EXPECT().UpdateHighestReceived(protocol.ByteCount(6), false)
+			str.SetReadNotifyThreshold(0)
+			Expect(str.handleStreamFrame(&wire.StreamFrame{Data: []byte("foobar")})).To(Succeed())
+		})
+	})
+
+	Context("reordering statistics", func() {
+		const frameLen = 100
+
+		// receive delivers frames of frameLen bytes each, in the given order.
+		receive := func(order ...int) {
+			for _, i := range order {
+				Expect(str.handleStreamFrame(&wire.StreamFrame{
+					Offset: protocol.ByteCount(i * frameLen),
+					Data:   make([]byte, frameLen),
+				})).To(Succeed())
+			}
+		}
+
+		BeforeEach(func() {
+			mockFC.EXPECT().UpdateHighestReceived(gomock.Any(), false).AnyTimes()
+		})
+
+		It("doesn't report reordering for in-order data", func() {
+			receive(0, 1, 2, 3, 4, 5)
+			depth, events := str.ReorderStats()
+			Expect(depth).To(BeZero())
+			Expect(events).To(BeZero())
+		})
+
+		It("measures the depth of a frame delayed by 5 packets", func() {
+			mockFC.EXPECT().UpdateReorderDepth(protocol.ByteCount(5 * frameLen))
+			receive(1, 2, 3, 4, 5, 0)
+			depth, events := str.ReorderStats()
+			Expect(depth).To(Equal(protocol.ByteCount(5 * frameLen)))
+			Expect(events).To(BeEquivalentTo(1))
+		})
+
+		It("counts every reordered frame, and keeps the maximum depth", func() {
+			gomock.InOrder(
+				mockFC.EXPECT().UpdateReorderDepth(protocol.ByteCount(2*frameLen)),
+				mockFC.EXPECT().UpdateReorderDepth(protocol.ByteCount(5*frameLen)),
+			)
+			receive(1, 2, 0)          // depth 2
+			receive(4, 5, 6, 7, 8, 3) // depth 5
+			receive(10, 11, 9)        // depth 2
+			depth, events := str.ReorderStats()
+			Expect(depth).To(Equal(protocol.ByteCount(5 * frameLen)))
+			Expect(events).To(BeEquivalentTo(3))
+		})
+
+		It("doesn't count retransmissions of data that was already read", func() {
+			mockFC.EXPECT().AddBytesRead(protocol.ByteCount(frameLen))
+			receive(0)
+			_, err := strWithTimeout.Read(make([]byte, frameLen))
+			Expect(err).ToNot(HaveOccurred())
+			receive(1, 2, 3, 4, 5, 0)
+			depth, events := str.ReorderStats()
+			Expect(depth).To(BeZero())
+			Expect(events).To(BeZero())
+		})
+	})
+
 	Context("flow control", func() {
 		It("errors when a STREAM frame causes a flow control violation", func() {
 			testErr := errors.New("flow control violation")
@@ -618,8 +819,42 @@ var _ = Describe("Receive Stream", func() {
 		})
 
 		It("gets a window update", func() {
-			mockFC.EXPECT().GetWindowUpdate().Return(protocol.ByteCount(0x100))
+			mockFC.EXPECT().GetWindowUpdate(protocol.ByteCount(0)).Return(protocol.ByteCount(0x100))
 			Expect(str.getWindowUpdate()).To(Equal(protocol.ByteCount(0x100)))
 		})
+
+		It("doesn't grant credit for data queued behind a gap", func() {
+			const window = 1000
+			rttStats := &congestion.RTTStats{}
+			fc := flowcontrol.NewStreamFlowController(
+				streamID,
+				flowcontrol.NewConnectionFlowController(10*window, 10*window, func() {}, rttStats, utils.DefaultLogger),
+				window,
+				window,
+				0,
+				func(protocol.StreamID) {},
+				rttStats,
+				utils.DefaultLogger,
+			)
+			str = newReceiveStream(streamID, mockSender, fc, protocol.VersionWhatever)
+			// the peer fills the whole window, except for the first byte
+			Expect(str.handleStreamFrame(&wire.StreamFrame{Offset: 1, Data: make([]byte, window-1)})).To(Succeed())
+			Expect(str.frameQueue.GapBytes()).To(BeEquivalentTo(window - 1))
+			Expect(str.getWindowUpdate()).To(BeZero())
+			// fill the gap, and read half of the data
+			Expect(str.handleStreamFrame(&wire.StreamFrame{Data: []byte{0}})).To(Succeed())
+			Expect(str.frameQueue.GapBytes()).To(BeZero())
+			n, err := str.Read(make([]byte, window/2))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(n).To(Equal(window / 2))
+			// credit is only granted for the data that was read
+			Expect(str.getWindowUpdate()).To(BeEquivalentTo(window/2 + window))
+			// the peer can't send any data beyond that, no matter how many gaps it leaves
+			Expect(str.handleStreamFrame(&wire.StreamFrame{Offset: window + window/2 - 1, Data: []byte{0}})).To(Succeed())
+			Expect(str.frameQueue.GapBytes()).To(BeEquivalentTo(1))
+			err = str.handleStreamFrame(&wire.StreamFrame{Offset: window + window/2, Data: []byte{0}})
+			Expect(err).To(HaveOccurred())
+			Expect(err.(*qerr.QuicError).ErrorCode).To(Equal(qerr.FlowControlError))
+		})
 	})
 })
@@ -0,0 +1,31 @@
+// +build linux
+
+package quic
+
+import (
+	"context"
+	"net"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+const reusePortSupported = true
+
+// listenUDPReusePort creates a UDP socket with SO_REUSEPORT set.
+// Multiple of these sockets can be bound to the same address,
+// and the kernel distributes incoming packets between them, based on a hash of the 4-tuple.
+func listenUDPReusePort(addr string) (net.PacketConn, error) {
+	lc := net.ListenConfig{
+		Control: func(_, _ string, c syscall.RawConn) error {
+			var err error
+			if cerr := c.Control(func(fd uintptr) {
+				err = unix.SetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_REUSEPORT, 1)
+			}); cerr != nil {
+				return cerr
+			}
+			return err
+		},
+	}
+	return lc.ListenPacket(context.Background(), "udp", addr)
+}
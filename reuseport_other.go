@@ -0,0 +1,14 @@
+// +build !linux
+
+package quic
+
+import (
+	"errors"
+	"net"
+)
+
+const reusePortSupported = false
+
+func listenUDPReusePort(string) (net.PacketConn, error) {
+	return nil, errors.New("SO_REUSEPORT not supported on this platform")
+}
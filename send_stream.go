@@ -40,7 +40,9 @@ type sendStream struct {
 	canceledWrite     bool // set when CancelWrite() is called, or a STOP_SENDING frame is received
 	finSent           bool // set when a STREAM_FRAME with FIN bit has b
 
+	// dataForWriting is the data passed to Write, that didn't fit into the sendBuffer yet
 	dataForWriting []byte
+	sendBuffer     *streamSendBuffer
 
 	writeChan chan struct{}
 	deadline  time.Time
@@ -57,12 +59,14 @@ func newSendStream(
 	streamID protocol.StreamID,
 	sender streamSender,
 	flowController flowcontrol.StreamFlowController,
+	connSendBuffer *connectionSendBuffer,
 	version protocol.VersionNumber,
 ) *sendStream {
 	s := &sendStream{
 		streamID:       streamID,
 		sender:         sender,
 		flowController: flowController,
+		sendBuffer:     newStreamSendBuffer(streamID, flowController, connSendBuffer, version),
 		writeChan:      make(chan struct{}, 1),
 		version:        version,
 	}
@@ -102,7 +106,13 @@ func (s *sendStream) Write(p []byte) (int, error) {
 		notifiedSender bool
 	)
 	for {
+		// Copy as much data as possible into the send buffer.
+		// Write returns as soon as all data was buffered.
+		s.fillSendBuffer()
 		bytesWritten = len(p) - len(s.dataForWriting)
+		if s.dataForWriting == nil || s.canceledWrite || s.closedForShutdown {
+			break
+		}
 		deadline := s.deadline
 		if !deadline.IsZero() {
 			if !time.Now().Before(deadline) {
@@ -114,9 +124,6 @@ func (s *sendStream) Write(p []byte) (int, error) {
 			}
 			deadlineTimer.Reset(deadline)
 		}
-		if s.dataForWriting == nil || s.canceledWrite || s.closedForShutdown {
-			break
-		}
 
 		s.mutex.Unlock()
 		if !notifiedSender {
@@ -136,13 +143,36 @@ func (s *sendStream) Write(p []byte) (int, error) {
 	}
 
 	if s.closeForShutdownErr != nil {
+		s.dataForWriting = nil
 		return bytesWritten, s.closeForShutdownErr
 	} else if s.cancelWriteErr != nil {
+		s.dataForWriting = nil
 		return bytesWritten, s.cancelWriteErr
 	}
+	if !notifiedSender {
+		s.mutex.Unlock()
+		s.sender.onHasStreamData(s.streamID) // must be called without holding the mutex
+		s.mutex.Lock()
+	}
 	return bytesWritten, nil
 }
 
+// fillSendBuffer moves as much data from dataForWriting to the send buffer as fits.
+func (s *sendStream) fillSendBuffer() {
+	if s.dataForWriting == nil || s.canceledWrite || s.closedForShutdown {
+		return
+	}
+	n := utils.MinByteCount(protocol.ByteCount(len(s.dataForWriting)), s.sendBuffer.Available())
+	if n == 0 {
+		return
+	}
+	s.sendBuffer.Write(s.dataForWriting[:n])
+	s.dataForWriting = s.dataForWriting[n:]
+	if len(s.dataForWriting) == 0 {
+		s.dataForWriting = nil
+	}
+}
+
 // popStreamFrame returns the next STREAM frame that is supposed to be sent on this stream
 // maxBytes is the maximum length this frame (including frame header) will have.
 func (s *sendStream) popStreamFrame(maxBytes protocol.ByteCount) (*wire.StreamFrame, bool /* has more data to send */) {
@@ -151,7 +181,7 @@ func (s *sendStream) popStreamFrame(maxBytes protocol.ByteCount) (*wire.StreamFr
 	s.mutex.Unlock()
 
 	if completed {
-		s.sender.onStreamCompleted(s.streamID)
+		s.sender.onStreamCompleted(s.streamID, nil)
 	}
 	return frame, hasMoreData
 }
@@ -166,19 +196,23 @@ func (s *sendStream) popStreamFrameImpl(maxBytes protocol.ByteCount) (bool /* co
 		Offset:         s.writeOffset,
 		DataLenPresent: true,
 	}
-	maxDataLen := frame.MaxDataLen(maxBytes, s.version)
-	if maxDataLen == 0 { // a STREAM frame must have at least one byte of data
-		return false, nil, s.dataForWriting != nil
+	if frame.MaxDataLen(maxBytes, s.version) == 0 { // a STREAM frame must have at least one byte of data
+		return false, nil, s.hasDataImpl()
 	}
-	frame.Data, frame.FinBit = s.getDataForWriting(maxDataLen)
-	if len(frame.Data) == 0 && !frame.FinBit {
+	if s.sendBuffer.Len() == 0 {
+		if !s.finishedWriting || s.finSent {
+			return false, nil, false
+		}
+		frame.FinBit = true
+		s.finSent = true
+		return true, frame, false
+	}
+
+	frame = s.sendBuffer.Coalesce(maxBytes)
+	if frame == nil {
 		// this can happen if:
-		// - popStreamFrame is called but there's no data for writing
 		// - there's data for writing, but the stream is stream-level flow control blocked
 		// - there's data for writing, but the stream is connection-level flow control blocked
-		if s.dataForWriting == nil {
-			return false, nil, false
-		}
 		if isBlocked, offset := s.flowController.IsNewlyBlocked(); isBlocked {
 			s.sender.queueControlFrame(&wire.StreamDataBlockedFrame{
 				StreamID:  s.streamID,
@@ -188,43 +222,30 @@ func (s *sendStream) popStreamFrameImpl(maxBytes protocol.ByteCount) (bool /* co
 		}
 		return false, nil, true
 	}
-	if frame.FinBit {
+	s.writeOffset += frame.DataLen()
+	// Now that there's space in the send buffer again, move over data from a blocked Write call.
+	if s.dataForWriting != nil {
+		s.fillSendBuffer()
+		if s.dataForWriting == nil {
+			s.signalWrite()
+		}
+	}
+	if s.finishedWriting && !s.hasDataImpl() {
+		frame.FinBit = true
 		s.finSent = true
 	}
-	return frame.FinBit, frame, s.dataForWriting != nil
+	return frame.FinBit, frame, s.hasDataImpl()
 }
 
 func (s *sendStream) hasData() bool {
 	s.mutex.Lock()
-	hasData := len(s.dataForWriting) > 0
+	hasData := s.hasDataImpl()
 	s.mutex.Unlock()
 	return hasData
 }
 
-func (s *sendStream) getDataForWriting(maxBytes protocol.ByteCount) ([]byte, bool /* should send FIN */) {
-	if s.dataForWriting == nil {
-		return nil, s.finishedWriting && !s.finSent
-	}
-
-	maxBytes = utils.MinByteCount(maxBytes, s.flowController.SendWindowSize())
-	if maxBytes == 0 {
-		return nil, false
-	}
-
-	var ret []byte
-	if protocol.ByteCount(len(s.dataForWriting)) > maxBytes {
-		ret = make([]byte, int(maxBytes))
-		copy(ret, s.dataForWriting[:maxBytes])
-		s.dataForWriting = s.dataForWriting[maxBytes:]
-	} else {
-		ret = make([]byte, len(s.dataForWriting))
-		copy(ret, s.dataForWriting)
-		s.dataForWriting = nil
-		s.signalWrite()
-	}
-	s.writeOffset += protocol.ByteCount(len(ret))
-	s.flowController.AddBytesSent(protocol.ByteCount(len(ret)))
-	return ret, s.finishedWriting && s.dataForWriting == nil && !s.finSent
+func (s *sendStream) hasDataImpl() bool {
+	return s.sendBuffer.Len() > 0 || len(s.dataForWriting) > 0
 }
 
 func (s *sendStream) Close() error {
@@ -241,13 +262,19 @@ func (s *sendStream) Close() error {
 	return nil
 }
 
+// CloseWrite is equivalent to Close.
+func (s *sendStream) CloseWrite() error {
+	return s.Close()
+}
+
 func (s *sendStream) CancelWrite(errorCode protocol.ApplicationErrorCode) {
+	writeErr := fmt.Errorf("Write on stream %d canceled with error code %d", s.streamID, errorCode)
 	s.mutex.Lock()
-	completed := s.cancelWriteImpl(errorCode, fmt.Errorf("Write on stream %d canceled with error code %d", s.streamID, errorCode))
+	completed := s.cancelWriteImpl(errorCode, writeErr)
 	s.mutex.Unlock()
 
 	if completed {
-		s.sender.onStreamCompleted(s.streamID) // must be called without holding the mutex
+		s.sender.onStreamCompleted(s.streamID, writeErr) // must be called without holding the mutex
 	}
 }
 
@@ -258,6 +285,7 @@ func (s *sendStream) cancelWriteImpl(errorCode protocol.ApplicationErrorCode, wr
 	}
 	s.canceledWrite = true
 	s.cancelWriteErr = writeErr
+	s.sendBuffer.Reset()
 	s.signalWrite()
 	s.sender.queueControlFrame(&wire.ResetStreamFrame{
 		StreamID:   s.streamID,
@@ -269,9 +297,24 @@ func (s *sendStream) cancelWriteImpl(errorCode protocol.ApplicationErrorCode, wr
 	return true
 }
 
+func (s *sendStream) GrantedCredit() protocol.ByteCount {
+	return s.flowController.GrantedSendCredit()
+}
+
+func (s *sendStream) SetPriority(urgency uint8, incremental bool) {
+	s.mutex.Lock()
+	// Once all data was sent, the stream is removed from the framer.
+	completed := s.finSent || s.canceledWrite || s.closedForShutdown
+	s.mutex.Unlock()
+
+	if !completed {
+		s.sender.setStreamPriority(s.streamID, urgency, incremental) // must be called without holding the mutex
+	}
+}
+
 func (s *sendStream) handleMaxStreamDataFrame(frame *wire.MaxStreamDataFrame) {
 	s.mutex.Lock()
-	hasStreamData := s.dataForWriting != nil
+	hasStreamData := s.hasDataImpl()
 	s.mutex.Unlock()
 
 	s.flowController.UpdateSendWindow(frame.ByteOffset)
@@ -283,10 +326,11 @@ func (s *sendStream) handleMaxStreamDataFrame(frame *wire.MaxStreamDataFrame) {
 func (s *sendStream) handleStopSendingFrame(frame *wire.StopSendingFrame) {
 	s.mutex.Lock()
 	completed := s.handleStopSendingFrameImpl(frame)
+	writeErr := s.cancelWriteErr
 	s.mutex.Unlock()
 
 	if completed {
-		s.sender.onStreamCompleted(s.streamID)
+		s.sender.onStreamCompleted(s.streamID, writeErr)
 	}
 }
 
@@ -318,6 +362,7 @@ func (s *sendStream) closeForShutdown(err error) {
 	s.mutex.Lock()
 	s.closedForShutdown = true
 	s.closeForShutdownErr = err
+	s.sendBuffer.Reset()
 	s.mutex.Unlock()
 	s.signalWrite()
 	s.ctxCancel()
@@ -30,18 +30,29 @@ var _ = Describe("Send Stream", func() {
 	BeforeEach(func() {
 		mockSender = NewMockStreamSender(mockCtrl)
 		mockFC = mocks.NewMockStreamFlowController(mockCtrl)
-		str = newSendStream(streamID, mockSender, mockFC, protocol.VersionWhatever)
+		str = newSendStream(streamID, mockSender, mockFC, nil, protocol.VersionWhatever)
 
 		timeout := scaleDuration(250 * time.Millisecond)
 		strWithTimeout = gbytes.TimeoutWriter(str, timeout)
 	})
 
+	// the number of bytes that Write copies into the send buffer before blocking
+	const bufferSize = int(protocol.MaxStreamSendBufferSize)
+
 	waitForWrite := func() {
+		EventuallyWithOffset(0, func() bool {
+			str.mutex.Lock()
+			defer str.mutex.Unlock()
+			return str.hasDataImpl()
+		}).Should(BeTrue())
+	}
+
+	// waitForBlockedWrite waits until Write blocked, since the send buffer is full
+	waitForBlockedWrite := func() {
 		EventuallyWithOffset(0, func() []byte {
 			str.mutex.Lock()
-			data := str.dataForWriting
-			str.mutex.Unlock()
-			return data
+			defer str.mutex.Unlock()
+			return str.dataForWriting
 		}).ShouldNot(BeEmpty())
 	}
 
@@ -49,6 +60,11 @@ var _ = Describe("Send Stream", func() {
 		Expect(str.StreamID()).To(Equal(protocol.StreamID(1337)))
 	})
 
+	It("gets the send credit granted to the stream", func() {
+		mockFC.EXPECT().GrantedSendCredit().Return(protocol.ByteCount(1234))
+		Expect(str.GrantedCredit()).To(Equal(protocol.ByteCount(1234)))
+	})
+
 	Context("writing", func() {
 		It("writes and gets all data at once", func() {
 			mockSender.EXPECT().onHasStreamData(streamID)
@@ -69,7 +85,62 @@ var _ = Describe("Send Stream", func() {
 			Expect(f.Offset).To(BeZero())
 			Expect(f.DataLenPresent).To(BeTrue())
 			Expect(str.writeOffset).To(Equal(protocol.ByteCount(6)))
-			Expect(str.dataForWriting).To(BeNil())
+			Expect(str.sendBuffer.Len()).To(BeZero())
+			Eventually(done).Should(BeClosed())
+		})
+
+		It("returns from Write as soon as the data was buffered", func() {
+			mockSender.EXPECT().onHasStreamData(streamID)
+			n, err := strWithTimeout.Write([]byte("foobar"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(n).To(Equal(6))
+			Expect(str.sendBuffer.Len()).To(Equal(protocol.ByteCount(6)))
+		})
+
+		It("coalesces consecutive writes into a single STREAM frame", func() {
+			mockSender.EXPECT().onHasStreamData(streamID).Times(3)
+			mockFC.EXPECT().SendWindowSize().Return(protocol.ByteCount(9999))
+			mockFC.EXPECT().AddBytesSent(protocol.ByteCount(9))
+			for _, d := range []string{"foo", "bar", "baz"} {
+				_, err := strWithTimeout.Write([]byte(d))
+				Expect(err).ToNot(HaveOccurred())
+			}
+			f, hasMoreData := str.popStreamFrame(1000)
+			Expect(f).ToNot(BeNil())
+			Expect(f.Data).To(Equal([]byte("foobarbaz")))
+			Expect(f.Offset).To(BeZero())
+			Expect(hasMoreData).To(BeFalse())
+		})
+
+		It("blocks Write when the send buffer is full", func() {
+			mockSender.EXPECT().onHasStreamData(streamID)
+			mockFC.EXPECT().SendWindowSize().Return(protocol.MaxByteCount).AnyTimes()
+			mockFC.EXPECT().AddBytesSent(gomock.Any()).AnyTimes()
+			data := make([]byte, bufferSize+1000)
+			for i := range data {
+				data[i] = byte(i)
+			}
+			done := make(chan struct{})
+			go func() {
+				defer GinkgoRecover()
+				n, err := strWithTimeout.Write(data)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(n).To(Equal(len(data)))
+				close(done)
+			}()
+			waitForBlockedWrite()
+			Consistently(done).ShouldNot(BeClosed())
+			var received []byte
+			for {
+				f, hasMoreData := str.popStreamFrame(1000)
+				Expect(f).ToNot(BeNil())
+				Expect(f.Offset).To(Equal(protocol.ByteCount(len(received))))
+				received = append(received, f.Data...)
+				if !hasMoreData {
+					break
+				}
+			}
+			Expect(received).To(Equal(data))
 			Eventually(done).Should(BeClosed())
 		})
 
@@ -185,34 +256,18 @@ var _ = Describe("Send Stream", func() {
 					DataLimit: 12,
 				})
 				mockSender.EXPECT().onHasStreamData(streamID)
-				done := make(chan struct{})
-				go func() {
-					defer GinkgoRecover()
-					_, err := str.Write([]byte("foobar"))
-					Expect(err).ToNot(HaveOccurred())
-					close(done)
-				}()
-				waitForWrite()
+				_, err := strWithTimeout.Write([]byte("foobar"))
+				Expect(err).ToNot(HaveOccurred())
 				f, hasMoreData := str.popStreamFrame(1000)
 				Expect(f).To(BeNil())
 				Expect(hasMoreData).To(BeFalse())
-				// make the Write go routine return
-				str.closeForShutdown(nil)
-				Eventually(done).Should(BeClosed())
 			})
 
 			It("says that it doesn't have any more data, when it is flow control blocked", func() {
 				frameHeaderSize := protocol.ByteCount(4)
 				mockSender.EXPECT().onHasStreamData(streamID)
-
-				done := make(chan struct{})
-				go func() {
-					defer GinkgoRecover()
-					_, err := str.Write([]byte("foobar"))
-					Expect(err).ToNot(HaveOccurred())
-					close(done)
-				}()
-				waitForWrite()
+				_, err := strWithTimeout.Write([]byte("foobar"))
+				Expect(err).ToNot(HaveOccurred())
 
 				// first pop a STREAM frame of the maximum size allowed by flow control
 				mockFC.EXPECT().SendWindowSize().Return(protocol.ByteCount(3))
@@ -232,9 +287,6 @@ var _ = Describe("Send Stream", func() {
 				f, hasMoreData = str.popStreamFrame(1000)
 				Expect(f).To(BeNil())
 				Expect(hasMoreData).To(BeFalse())
-				// make the Write go routine return
-				str.closeForShutdown(nil)
-				Eventually(done).Should(BeClosed())
 			})
 		})
 
@@ -250,9 +302,9 @@ var _ = Describe("Send Stream", func() {
 				mockSender.EXPECT().onHasStreamData(streamID)
 				deadline := time.Now().Add(scaleDuration(50 * time.Millisecond))
 				str.SetWriteDeadline(deadline)
-				n, err := strWithTimeout.Write([]byte("foobar"))
+				n, err := strWithTimeout.Write(make([]byte, bufferSize+6))
 				Expect(err).To(MatchError(errDeadline))
-				Expect(n).To(BeZero())
+				Expect(n).To(Equal(bufferSize))
 				Expect(time.Now()).To(BeTemporally("~", deadline, scaleDuration(20*time.Millisecond)))
 			})
 
@@ -262,7 +314,7 @@ var _ = Describe("Send Stream", func() {
 				done := make(chan struct{})
 				go func() {
 					defer GinkgoRecover()
-					_, err := str.Write([]byte("foobar"))
+					_, err := str.Write(make([]byte, bufferSize+6))
 					Expect(err).To(MatchError(errDeadline))
 					close(done)
 				}()
@@ -282,40 +334,48 @@ var _ = Describe("Send Stream", func() {
 				go func() {
 					defer GinkgoRecover()
 					var err error
-					n, err = strWithTimeout.Write(bytes.Repeat([]byte{0}, 100))
+					n, err = strWithTimeout.Write(bytes.Repeat([]byte{0}, bufferSize+100))
 					Expect(err).To(MatchError(errDeadline))
 					Expect(time.Now()).To(BeTemporally("~", deadline, scaleDuration(20*time.Millisecond)))
 					close(writeReturned)
 				}()
-				waitForWrite()
+				waitForBlockedWrite()
 				frame, hasMoreData := str.popStreamFrame(50)
 				Expect(frame).ToNot(BeNil())
 				Expect(hasMoreData).To(BeTrue())
 				Eventually(writeReturned, scaleDuration(80*time.Millisecond)).Should(BeClosed())
-				Expect(n).To(BeEquivalentTo(frame.DataLen()))
+				Expect(n).To(BeEquivalentTo(bufferSize + int(frame.DataLen())))
 			})
 
 			It("doesn't pop any data after the deadline expired", func() {
 				mockSender.EXPECT().onHasStreamData(streamID)
 				mockFC.EXPECT().SendWindowSize().Return(protocol.ByteCount(10000)).AnyTimes()
-				mockFC.EXPECT().AddBytesSent(gomock.Any())
+				mockFC.EXPECT().AddBytesSent(gomock.Any()).AnyTimes()
 				deadline := time.Now().Add(scaleDuration(50 * time.Millisecond))
 				str.SetWriteDeadline(deadline)
 				writeReturned := make(chan struct{})
 				go func() {
 					defer GinkgoRecover()
-					_, err := strWithTimeout.Write(bytes.Repeat([]byte{0}, 100))
+					_, err := strWithTimeout.Write(bytes.Repeat([]byte{0}, bufferSize+100))
 					Expect(err).To(MatchError(errDeadline))
 					close(writeReturned)
 				}()
-				waitForWrite()
+				waitForBlockedWrite()
 				frame, hasMoreData := str.popStreamFrame(50)
 				Expect(frame).ToNot(BeNil())
 				Expect(hasMoreData).To(BeTrue())
 				Eventually(writeReturned, scaleDuration(80*time.Millisecond)).Should(BeClosed())
-				frame, hasMoreData = str.popStreamFrame(50)
-				Expect(frame).To(BeNil())
+				// only the data that was buffered before the deadline expired is sent
+				var bytesPopped protocol.ByteCount
+				for {
+					frame, hasMoreData = str.popStreamFrame(1000)
+					if frame == nil {
+						break
+					}
+					bytesPopped += frame.DataLen()
+				}
 				Expect(hasMoreData).To(BeFalse())
+				Expect(bytesPopped).To(Equal(protocol.ByteCount(bufferSize)))
 			})
 
 			It("doesn't unblock if the deadline is changed before the first one expires", func() {
@@ -333,9 +393,9 @@ var _ = Describe("Send Stream", func() {
 					close(done)
 				}()
 				runtime.Gosched()
-				n, err := strWithTimeout.Write([]byte("foobar"))
+				n, err := strWithTimeout.Write(make([]byte, bufferSize+6))
 				Expect(err).To(MatchError(errDeadline))
-				Expect(n).To(BeZero())
+				Expect(n).To(Equal(bufferSize))
 				Expect(time.Now()).To(BeTemporally("~", deadline2, scaleDuration(20*time.Millisecond)))
 				Eventually(done).Should(BeClosed())
 			})
@@ -355,7 +415,7 @@ var _ = Describe("Send Stream", func() {
 				}()
 				str.SetWriteDeadline(deadline1)
 				runtime.Gosched()
-				_, err := strWithTimeout.Write([]byte("foobar"))
+				_, err := strWithTimeout.Write(make([]byte, bufferSize+6))
 				Expect(err).To(MatchError(errDeadline))
 				Expect(time.Now()).To(BeTemporally("~", deadline2, scaleDuration(20*time.Millisecond)))
 				Eventually(done).Should(BeClosed())
@@ -377,7 +437,7 @@ var _ = Describe("Send Stream", func() {
 				done := make(chan struct{})
 				go func() {
 					defer GinkgoRecover()
-					_, err := strWithTimeout.Write([]byte("foobar"))
+					_, err := strWithTimeout.Write(make([]byte, bufferSize+6))
 					Expect(err).To(MatchError("test done"))
 					close(done)
 				}()
@@ -400,7 +460,7 @@ var _ = Describe("Send Stream", func() {
 
 			It("allows FIN", func() {
 				mockSender.EXPECT().onHasStreamData(streamID)
-				mockSender.EXPECT().onStreamCompleted(streamID)
+				mockSender.EXPECT().onStreamCompleted(streamID, nil)
 				str.Close()
 				f, hasMoreData := str.popStreamFrame(1000)
 				Expect(f).ToNot(BeNil())
@@ -409,18 +469,29 @@ var _ = Describe("Send Stream", func() {
 				Expect(hasMoreData).To(BeFalse())
 			})
 
+			It("sends a FIN when the write-direction is closed", func() {
+				mockSender.EXPECT().onHasStreamData(streamID)
+				mockSender.EXPECT().onStreamCompleted(streamID, nil)
+				Expect(str.CloseWrite()).To(Succeed())
+				f, _ := str.popStreamFrame(1000)
+				Expect(f).ToNot(BeNil())
+				Expect(f.FinBit).To(BeTrue())
+				_, err := strWithTimeout.Write([]byte("foobar"))
+				Expect(err).To(MatchError("write on closed stream 1337"))
+			})
+
 			It("doesn't send a FIN when there's still data", func() {
 				mockSender.EXPECT().onHasStreamData(streamID)
 				frameHeaderLen := protocol.ByteCount(4)
 				mockFC.EXPECT().SendWindowSize().Return(protocol.ByteCount(9999)).Times(2)
 				mockFC.EXPECT().AddBytesSent(gomock.Any()).Times(2)
-				str.dataForWriting = []byte("foobar")
+				str.sendBuffer.Write([]byte("foobar"))
 				Expect(str.Close()).To(Succeed())
 				f, _ := str.popStreamFrame(3 + frameHeaderLen)
 				Expect(f).ToNot(BeNil())
 				Expect(f.Data).To(Equal([]byte("foo")))
 				Expect(f.FinBit).To(BeFalse())
-				mockSender.EXPECT().onStreamCompleted(streamID)
+				mockSender.EXPECT().onStreamCompleted(streamID, nil)
 				f, _ = str.popStreamFrame(100)
 				Expect(f.Data).To(Equal([]byte("bar")))
 				Expect(f.FinBit).To(BeTrue())
@@ -435,7 +506,7 @@ var _ = Describe("Send Stream", func() {
 
 			It("doesn't allow FIN twice", func() {
 				mockSender.EXPECT().onHasStreamData(streamID)
-				mockSender.EXPECT().onStreamCompleted(streamID)
+				mockSender.EXPECT().onStreamCompleted(streamID, nil)
 				str.Close()
 				f, _ := str.popStreamFrame(1000)
 				Expect(f).ToNot(BeNil())
@@ -464,11 +535,11 @@ var _ = Describe("Send Stream", func() {
 				done := make(chan struct{})
 				go func() {
 					defer GinkgoRecover()
-					_, err := strWithTimeout.Write(bytes.Repeat([]byte{0}, 500))
+					_, err := strWithTimeout.Write(bytes.Repeat([]byte{0}, bufferSize+500))
 					Expect(err).To(MatchError(testErr))
 					close(done)
 				}()
-				waitForWrite()
+				waitForBlockedWrite()
 				frame, hasMoreData := str.popStreamFrame(50) // get a STREAM frame containing some data, but not all
 				Expect(frame).ToNot(BeNil())
 				Expect(hasMoreData).To(BeTrue())
@@ -502,21 +573,36 @@ var _ = Describe("Send Stream", func() {
 			done := make(chan struct{})
 			go func() {
 				defer GinkgoRecover()
-				_, err := str.Write([]byte("foobar"))
-				Expect(err).ToNot(HaveOccurred())
+				_, err := str.Write(make([]byte, bufferSize+6))
+				Expect(err).To(MatchError("shutdown"))
 				close(done)
 			}()
-			waitForWrite()
+			waitForBlockedWrite()
 			str.handleMaxStreamDataFrame(&wire.MaxStreamDataFrame{
 				StreamID:   streamID,
 				ByteOffset: 42,
 			})
 			// make sure the Write go routine returns
-			str.closeForShutdown(nil)
+			str.closeForShutdown(errors.New("shutdown"))
 			Eventually(done).Should(BeClosed())
 		})
 	})
 
+	Context("priorities", func() {
+		It("sets the priority", func() {
+			mockSender.EXPECT().setStreamPriority(streamID, uint8(1), false)
+			str.SetPriority(1, false)
+		})
+
+		It("doesn't set the priority after the stream was canceled", func() {
+			mockSender.EXPECT().queueControlFrame(gomock.Any())
+			mockSender.EXPECT().onStreamCompleted(streamID, gomock.Not(gomock.Nil()))
+			str.CancelWrite(1234)
+			// don't EXPECT any calls to setStreamPriority
+			str.SetPriority(1, false)
+		})
+	})
+
 	Context("stream cancelations", func() {
 		Context("canceling writing", func() {
 			It("queues a RESET_STREAM frame", func() {
@@ -525,14 +611,14 @@ var _ = Describe("Send Stream", func() {
 					ByteOffset: 1234,
 					ErrorCode:  9876,
 				})
-				mockSender.EXPECT().onStreamCompleted(streamID)
+				mockSender.EXPECT().onStreamCompleted(streamID, gomock.Not(gomock.Nil()))
 				str.writeOffset = 1234
 				str.CancelWrite(9876)
 			})
 
 			It("unblocks Write", func() {
 				mockSender.EXPECT().onHasStreamData(streamID)
-				mockSender.EXPECT().onStreamCompleted(streamID)
+				mockSender.EXPECT().onStreamCompleted(streamID, gomock.Not(gomock.Nil()))
 				mockSender.EXPECT().queueControlFrame(gomock.Any())
 				mockFC.EXPECT().SendWindowSize().Return(protocol.MaxByteCount)
 				mockFC.EXPECT().AddBytesSent(gomock.Any())
@@ -541,32 +627,32 @@ var _ = Describe("Send Stream", func() {
 				go func() {
 					defer GinkgoRecover()
 					var err error
-					n, err = strWithTimeout.Write(bytes.Repeat([]byte{0}, 100))
+					n, err = strWithTimeout.Write(bytes.Repeat([]byte{0}, bufferSize+100))
 					Expect(err).To(MatchError("Write on stream 1337 canceled with error code 1234"))
 					close(writeReturned)
 				}()
-				waitForWrite()
+				waitForBlockedWrite()
 				frame, _ := str.popStreamFrame(50)
 				Expect(frame).ToNot(BeNil())
 				str.CancelWrite(1234)
 				Eventually(writeReturned).Should(BeClosed())
-				Expect(n).To(BeEquivalentTo(frame.DataLen()))
+				Expect(n).To(BeEquivalentTo(bufferSize + int(frame.DataLen())))
 			})
 
 			It("doesn't pop STREAM frames after being canceled", func() {
 				mockSender.EXPECT().onHasStreamData(streamID)
-				mockSender.EXPECT().onStreamCompleted(streamID)
+				mockSender.EXPECT().onStreamCompleted(streamID, gomock.Not(gomock.Nil()))
 				mockSender.EXPECT().queueControlFrame(gomock.Any())
 				mockFC.EXPECT().SendWindowSize().Return(protocol.MaxByteCount)
 				mockFC.EXPECT().AddBytesSent(gomock.Any())
 				writeReturned := make(chan struct{})
 				go func() {
 					defer GinkgoRecover()
-					_, err := strWithTimeout.Write(bytes.Repeat([]byte{0}, 100))
+					_, err := strWithTimeout.Write(bytes.Repeat([]byte{0}, bufferSize+100))
 					Expect(err).To(MatchError("Write on stream 1337 canceled with error code 1234"))
 					close(writeReturned)
 				}()
-				waitForWrite()
+				waitForBlockedWrite()
 				frame, hasMoreData := str.popStreamFrame(50)
 				Expect(hasMoreData).To(BeTrue())
 				Expect(frame).ToNot(BeNil())
@@ -579,7 +665,7 @@ var _ = Describe("Send Stream", func() {
 
 			It("cancels the context", func() {
 				mockSender.EXPECT().queueControlFrame(gomock.Any())
-				mockSender.EXPECT().onStreamCompleted(streamID)
+				mockSender.EXPECT().onStreamCompleted(streamID, gomock.Not(gomock.Nil()))
 				Expect(str.Context().Done()).ToNot(BeClosed())
 				str.CancelWrite(1234)
 				Expect(str.Context().Done()).To(BeClosed())
@@ -587,7 +673,7 @@ var _ = Describe("Send Stream", func() {
 
 			It("doesn't allow further calls to Write", func() {
 				mockSender.EXPECT().queueControlFrame(gomock.Any())
-				mockSender.EXPECT().onStreamCompleted(streamID)
+				mockSender.EXPECT().onStreamCompleted(streamID, gomock.Not(gomock.Nil()))
 				str.CancelWrite(1234)
 				_, err := strWithTimeout.Write([]byte("foobar"))
 				Expect(err).To(MatchError("Write on stream 1337 canceled with error code 1234"))
@@ -595,7 +681,7 @@ var _ = Describe("Send Stream", func() {
 
 			It("only cancels once", func() {
 				mockSender.EXPECT().queueControlFrame(&wire.ResetStreamFrame{StreamID: streamID, ErrorCode: 1234})
-				mockSender.EXPECT().onStreamCompleted(streamID)
+				mockSender.EXPECT().onStreamCompleted(streamID, gomock.Not(gomock.Nil()))
 				str.CancelWrite(1234)
 				str.CancelWrite(4321)
 			})
@@ -614,7 +700,7 @@ var _ = Describe("Send Stream", func() {
 					StreamID:  streamID,
 					ErrorCode: errorCodeStopping,
 				})
-				mockSender.EXPECT().onStreamCompleted(streamID)
+				mockSender.EXPECT().onStreamCompleted(streamID, gomock.Not(gomock.Nil()))
 				str.handleStopSendingFrame(&wire.StopSendingFrame{
 					StreamID:  streamID,
 					ErrorCode: 101,
@@ -627,15 +713,15 @@ var _ = Describe("Send Stream", func() {
 				done := make(chan struct{})
 				go func() {
 					defer GinkgoRecover()
-					_, err := str.Write([]byte("foobar"))
+					_, err := str.Write(make([]byte, bufferSize+6))
 					Expect(err).To(MatchError("Stream 1337 was reset with error code 123"))
 					Expect(err).To(BeAssignableToTypeOf(streamCanceledError{}))
 					Expect(err.(streamCanceledError).Canceled()).To(BeTrue())
 					Expect(err.(streamCanceledError).ErrorCode()).To(Equal(protocol.ApplicationErrorCode(123)))
 					close(done)
 				}()
-				waitForWrite()
-				mockSender.EXPECT().onStreamCompleted(streamID)
+				waitForBlockedWrite()
+				mockSender.EXPECT().onStreamCompleted(streamID, gomock.Not(gomock.Nil()))
 				str.handleStopSendingFrame(&wire.StopSendingFrame{
 					StreamID:  streamID,
 					ErrorCode: 123,
@@ -645,7 +731,7 @@ var _ = Describe("Send Stream", func() {
 
 			It("doesn't allow further calls to Write", func() {
 				mockSender.EXPECT().queueControlFrame(gomock.Any())
-				mockSender.EXPECT().onStreamCompleted(streamID)
+				mockSender.EXPECT().onStreamCompleted(streamID, gomock.Not(gomock.Nil()))
 				str.handleStopSendingFrame(&wire.StopSendingFrame{
 					StreamID:  streamID,
 					ErrorCode: 123,
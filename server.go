@@ -2,11 +2,14 @@ package quic
 
 import (
 	"bytes"
+	"context"
 	"crypto/tls"
 	"errors"
 	"fmt"
 	"io"
+	"math"
 	"net"
+	"sort"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -16,6 +19,7 @@ import (
 	"github.com/lucas-clemente/quic-go/internal/qerr"
 	"github.com/lucas-clemente/quic-go/internal/utils"
 	"github.com/lucas-clemente/quic-go/internal/wire"
+	"golang.org/x/time/rate"
 )
 
 // packetHandler handles packets
@@ -29,6 +33,10 @@ type packetHandler interface {
 type unknownPacketHandler interface {
 	handlePacket(*receivedPacket)
 	closeWithError(error) error
+	// sentStatelessReset is called when a stateless reset was sent in response to a packet with an unknown connection ID
+	sentStatelessReset()
+	// droppedPacket is called when a packet is dropped before it could be passed to a packet handler
+	droppedPacket(PacketDropReason)
 }
 
 type packetHandlerManager interface {
@@ -39,12 +47,13 @@ type packetHandlerManager interface {
 	AddResetToken([16]byte, packetHandler)
 	RemoveResetToken([16]byte)
 	GetStatelessResetToken(protocol.ConnectionID) [16]byte
+	AddListenConn(net.PacketConn) error
 	SetServer(unknownPacketHandler)
 	CloseServer()
 }
 
 type quicSession interface {
-	Session
+	EarlySession
 	handlePacket(*receivedPacket)
 	GetVersion() protocol.VersionNumber
 	getPerspective() protocol.Perspective
@@ -52,10 +61,13 @@ type quicSession interface {
 	destroy(error)
 	closeForRecreating() protocol.PacketNumber
 	closeRemote(error)
+	closeLocal(error)
+	lastActivityTime() time.Time
 }
 
 type sessionRunner interface {
-	OnHandshakeComplete(Session)
+	OnEarlySessionReady(quicSession)
+	OnHandshakeComplete(quicSession)
 	Retire(protocol.ConnectionID)
 	Remove(protocol.ConnectionID)
 	AddResetToken([16]byte, packetHandler)
@@ -65,10 +77,17 @@ type sessionRunner interface {
 type runner struct {
 	packetHandlerManager
 
-	onHandshakeCompleteImpl func(Session)
+	onEarlySessionReadyImpl func(quicSession) // may be nil
+	onHandshakeCompleteImpl func(quicSession)
 }
 
-func (r *runner) OnHandshakeComplete(s Session) { r.onHandshakeCompleteImpl(s) }
+func (r *runner) OnEarlySessionReady(s quicSession) {
+	if r.onEarlySessionReadyImpl != nil {
+		r.onEarlySessionReadyImpl(s)
+	}
+}
+
+func (r *runner) OnHandshakeComplete(s quicSession) { r.onHandshakeCompleteImpl(s) }
 
 var _ sessionRunner = &runner{}
 
@@ -85,6 +104,9 @@ type server struct {
 	createdPacketConn bool
 
 	cookieGenerator *handshake.CookieGenerator
+	adaptiveRetry   *adaptiveRetry // nil if Retries are not sent depending on the load
+	initialLimiter  *rate.Limiter  // nil if no InitialCryptoRateLimit is configured
+	perIPBudget     *perIPBudget   // nil if MaxInitialsPerIPPerInterval is negative
 
 	sessionHandler packetHandlerManager
 
@@ -95,8 +117,24 @@ type server struct {
 	errorChan   chan struct{}
 	closed      bool
 
-	sessionQueue    chan Session
-	sessionQueueLen int32 // to be used as an atomic
+	// sessions contains all sessions created by this server that are still running.
+	// The value is true if the session was returned by Accept.
+	sessions map[quicSession]bool
+	// drained is closed when the server is closed, and all sessions have been closed
+	drained           chan struct{}
+	drainOnce         sync.Once
+	drainErr          error
+	connErrorOccurred bool // if the conn returned an error, it doesn't need to be closed
+
+	sessionQueue       chan Session
+	sessionQueueLen    int32  // to be used as an atomic
+	refusedSessions    uint64 // to be used as an atomic
+	droppedInitials    uint64 // to be used as an atomic
+	rejectedInitials   uint64 // to be used as an atomic
+	overBudgetInitials uint64 // to be used as an atomic
+	droppedPackets     packetDropCounters
+	// earlySessionQueue is used to pass sessions that are still handshaking to AcceptEarly
+	earlySessionQueue chan quicSession
 
 	sessionRunner sessionRunner
 
@@ -108,6 +146,8 @@ var _ unknownPacketHandler = &server{}
 
 // ListenAddr creates a QUIC server listening on a given address.
 // The tls.Config must not be nil and must contain a certificate configuration.
+// It must set the supported application protocols (NextProtos), unless GetConfigForClient is used.
+// The handshake fails if the client doesn't offer any of them.
 // The quic.Config may be nil, in that case the default values will be used.
 func ListenAddr(addr string, tlsConf *tls.Config, config *Config) (Listener, error) {
 	udpAddr, err := net.ResolveUDPAddr("udp", addr)
@@ -120,9 +160,59 @@ func ListenAddr(addr string, tlsConf *tls.Config, config *Config) (Listener, err
 	}
 	serv, err := listen(conn, tlsConf, config)
 	if err != nil {
+		conn.Close()
 		return nil, err
 	}
 	serv.createdPacketConn = true
+	setUDPBufferSizes(conn, serv.config.UDPReceiveBufferSize, serv.logger)
+	return serv, nil
+}
+
+// ListenAddrReusePort creates a QUIC server listening on a given address, using n UDP sockets.
+// The sockets are bound to the same address using SO_REUSEPORT, and every socket is read from in a separate go routine.
+// This allows scaling the receive path across multiple CPU cores.
+// Packets are passed to the right session, independent of the socket the kernel delivered them to.
+// SO_REUSEPORT is only used on Linux. On other platforms, a single socket is used.
+func ListenAddrReusePort(addr string, tlsConf *tls.Config, config *Config, n int) (Listener, error) {
+	if n <= 1 || !reusePortSupported {
+		return ListenAddr(addr, tlsConf, config)
+	}
+	first, err := listenUDPReusePort(addr)
+	if err != nil {
+		return nil, err
+	}
+	conns := []net.PacketConn{first}
+	for i := 1; i < n; i++ {
+		// use the address of the first socket, in case addr didn't specify a port
+		c, err := listenUDPReusePort(first.LocalAddr().String())
+		if err != nil {
+			for _, c := range conns {
+				c.Close()
+			}
+			return nil, err
+		}
+		conns = append(conns, c)
+	}
+	serv, err := listen(first, tlsConf, config)
+	if err != nil {
+		for _, c := range conns {
+			c.Close()
+		}
+		return nil, err
+	}
+	serv.createdPacketConn = true
+	for i, c := range conns[1:] {
+		if err := serv.sessionHandler.AddListenConn(c); err != nil {
+			serv.Close()
+			for _, c := range conns[i+1:] {
+				c.Close()
+			}
+			return nil, err
+		}
+	}
+	for _, c := range conns {
+		setUDPBufferSizes(c, serv.config.UDPReceiveBufferSize, serv.logger)
+	}
 	return serv, nil
 }
 
@@ -131,16 +221,34 @@ func ListenAddr(addr string, tlsConf *tls.Config, config *Config) (Listener, err
 // The PacketConn can be used for simultaneous calls to Dial.
 // QUIC connection IDs are used for demultiplexing the different connections.
 // The tls.Config must not be nil and must contain a certificate configuration.
+// It must set the supported application protocols (NextProtos), unless GetConfigForClient is used.
+// The handshake fails if the client doesn't offer any of them.
 // The quic.Config may be nil, in that case the default values will be used.
 func Listen(conn net.PacketConn, tlsConf *tls.Config, config *Config) (Listener, error) {
 	return listen(conn, tlsConf, config)
 }
 
 func listen(conn net.PacketConn, tlsConf *tls.Config, config *Config) (*server, error) {
-	// TODO(#1655): only require that tls.Config.Certificates or tls.Config.GetCertificate is set
-	if tlsConf == nil || len(tlsConf.Certificates) == 0 {
+	if tlsConf == nil || (len(tlsConf.Certificates) == 0 && tlsConf.GetCertificate == nil) {
 		return nil, errors.New("quic: Certificates not set in tls.Config")
 	}
+	if err := validateNextProtosServer(tlsConf); err != nil {
+		return nil, err
+	}
+	if err := validateConnectionIDLength(config); err != nil {
+		return nil, err
+	}
+	if err := validateConnectionIDGenerator(config); err != nil {
+		return nil, err
+	}
+	if config != nil {
+		if err := handshake.ValidateCustomTransportParameters(config.CustomTransportParameters); err != nil {
+			return nil, err
+		}
+		if config.AcceptQueueLength < 0 {
+			return nil, fmt.Errorf("invalid AcceptQueueLength: %d", config.AcceptQueueLength)
+		}
+	}
 	config = populateServerConfig(config)
 	for _, v := range config.Versions {
 		if !protocol.IsValidVersion(v) {
@@ -153,19 +261,25 @@ func listen(conn net.PacketConn, tlsConf *tls.Config, config *Config) (*server,
 		return nil, err
 	}
 	s := &server{
-		conn:           conn,
-		tlsConf:        tlsConf,
-		config:         config,
-		sessionHandler: sessionHandler,
-		sessionQueue:   make(chan Session),
-		errorChan:      make(chan struct{}),
-		newSession:     newSession,
-		logger:         utils.DefaultLogger.WithPrefix("server"),
+		conn:              conn,
+		tlsConf:           tlsConf,
+		config:            config,
+		sessionHandler:    sessionHandler,
+		sessionQueue:      make(chan Session),
+		earlySessionQueue: make(chan quicSession),
+		errorChan:         make(chan struct{}),
+		sessions:          make(map[quicSession]bool),
+		drained:           make(chan struct{}),
+		newSession:        newSession,
+		logger:            newLogger(config, "server"),
 	}
 	if err := s.setup(); err != nil {
 		return nil, err
 	}
 	sessionHandler.SetServer(s)
+	if config.MaxIdleConnectionAge > 0 {
+		go s.runIdlePruner()
+	}
 	s.logger.Debugf("Listening for %s connections on %s", conn.LocalAddr().Network(), conn.LocalAddr().String())
 	return s, nil
 }
@@ -173,9 +287,37 @@ func listen(conn net.PacketConn, tlsConf *tls.Config, config *Config) (*server,
 func (s *server) setup() error {
 	s.sessionRunner = &runner{
 		packetHandlerManager: s.sessionHandler,
-		onHandshakeCompleteImpl: func(sess Session) {
+		onEarlySessionReadyImpl: func(sess quicSession) {
+			go func() {
+				select {
+				case s.earlySessionQueue <- sess:
+					// blocks until the session is accepted
+				case <-sess.HandshakeComplete().Done():
+					// Once the handshake completes, the session is passed to Accept and AcceptEarly by onHandshakeComplete.
+					// This also happens if the session is closed.
+				}
+			}()
+		},
+		onHandshakeCompleteImpl: func(sess quicSession) {
+			if s.adaptiveRetry != nil {
+				s.adaptiveRetry.RemoveSession(sess)
+			}
+			s.mutex.Lock()
+			acceptedEarly := s.sessions[sess]
+			s.mutex.Unlock()
+			if acceptedEarly {
+				return
+			}
+			// Sessions might complete the handshake after the accept queue filled up.
+			// Refuse them, so that the number of sessions waiting to be accepted stays bounded.
+			if queueLen := atomic.AddInt32(&s.sessionQueueLen, 1); queueLen > int32(s.config.AcceptQueueLength) {
+				atomic.AddInt32(&s.sessionQueueLen, -1)
+				atomic.AddUint64(&s.refusedSessions, 1)
+				s.logger.Debugf("Refusing session. Accept queue length: %d (max %d)", queueLen-1, s.config.AcceptQueueLength)
+				sess.closeLocal(qerr.Error(qerr.ServerBusy, "accept queue full"))
+				return
+			}
 			go func() {
-				atomic.AddInt32(&s.sessionQueueLen, 1)
 				defer atomic.AddInt32(&s.sessionQueueLen, -1)
 				select {
 				case s.sessionQueue <- sess:
@@ -186,28 +328,66 @@ func (s *server) setup() error {
 			}()
 		},
 	}
-	cookieGenerator, err := handshake.NewCookieGenerator()
+	cookieGenerator, err := handshake.NewCookieGenerator(s.config.GetTokenKeys)
 	if err != nil {
 		return err
 	}
 	s.cookieGenerator = cookieGenerator
+	if s.config.RetryHandshakeThreshold > 0 || s.config.RetryInitialRateThreshold > 0 {
+		s.adaptiveRetry = newAdaptiveRetry(s.config.RetryHandshakeThreshold, s.config.RetryInitialRateThreshold)
+	}
+	if s.config.InitialCryptoRateLimit > 0 {
+		// allow bursts of up to one second worth of Initial packets
+		burst := int(math.Ceil(float64(s.config.InitialCryptoRateLimit)))
+		s.initialLimiter = rate.NewLimiter(s.config.InitialCryptoRateLimit, burst)
+	}
+	if s.config.MaxInitialsPerIPPerInterval > 0 {
+		budget, err := newPerIPBudget(s.config.MaxInitialsPerIPPerInterval, protocol.InitialsPerIPInterval)
+		if err != nil {
+			return err
+		}
+		s.perIPBudget = budget
+	}
 	return nil
 }
 
-var defaultAcceptCookie = func(clientAddr net.Addr, cookie *Cookie) bool {
-	if cookie == nil {
-		return false
+// newDefaultAcceptCookie creates the AcceptCookie function used if none is configured.
+// It accepts Cookies that were issued for the client's address within the validity period.
+// Cookies that appear to be issued in the future are accepted for up to protocol.MaxTokenClockSkew.
+func newDefaultAcceptCookie(validity time.Duration, now func() time.Time) func(net.Addr, *Cookie) bool {
+	return func(clientAddr net.Addr, cookie *Cookie) bool {
+		if cookie == nil {
+			return false
+		}
+		t := now()
+		if t.After(cookie.SentTime.Add(validity)) || cookie.SentTime.After(t.Add(protocol.MaxTokenClockSkew)) {
+			return false
+		}
+		var sourceAddr string
+		if udpAddr, ok := clientAddr.(*net.UDPAddr); ok {
+			sourceAddr = udpAddr.IP.String()
+		} else {
+			sourceAddr = clientAddr.String()
+		}
+		return sourceAddr == cookie.RemoteAddr
 	}
-	if time.Now().After(cookie.SentTime.Add(protocol.CookieExpiryTime)) {
+}
+
+// validateNewToken checks that a Cookie issued in a NEW_TOKEN frame was issued within the validity period,
+// for the network that the client is connecting from.
+func validateNewToken(clientAddr net.Addr, cookie *Cookie, validity time.Duration, now time.Time) bool {
+	if now.After(cookie.SentTime.Add(validity)) || cookie.SentTime.After(now.Add(protocol.MaxTokenClockSkew)) {
 		return false
 	}
-	var sourceAddr string
-	if udpAddr, ok := clientAddr.(*net.UDPAddr); ok {
-		sourceAddr = udpAddr.IP.String()
-	} else {
-		sourceAddr = clientAddr.String()
+	udpAddr, ok := clientAddr.(*net.UDPAddr)
+	if !ok {
+		return clientAddr.String() == cookie.RemoteAddr
 	}
-	return sourceAddr == cookie.RemoteAddr
+	_, prefix, err := net.ParseCIDR(cookie.RemoteAddr)
+	if err != nil {
+		return false
+	}
+	return prefix.Contains(udpAddr.IP)
 }
 
 // populateServerConfig populates fields in the quic.Config with their default values, if none are set
@@ -221,9 +401,22 @@ func populateServerConfig(config *Config) *Config {
 		versions = protocol.SupportedVersions
 	}
 
-	vsa := defaultAcceptCookie
-	if config.AcceptCookie != nil {
-		vsa = config.AcceptCookie
+	retryTokenValidity := config.RetryTokenValidity
+	if retryTokenValidity == 0 {
+		retryTokenValidity = protocol.DefaultRetryTokenValidity
+	}
+	vsa := config.AcceptCookie
+	if vsa == nil {
+		vsa = newDefaultAcceptCookie(retryTokenValidity, time.Now)
+	}
+	getTokenKeys := config.GetTokenKeys
+	if getTokenKeys == nil && config.TokenKey != [32]byte{} {
+		tokenKey := config.TokenKey
+		getTokenKeys = func() (current, previous [32]byte) { return tokenKey, [32]byte{} }
+	}
+	newTokenValidity := config.NewTokenValidity
+	if newTokenValidity == 0 {
+		newTokenValidity = protocol.DefaultNewTokenValidity
 	}
 
 	handshakeTimeout := protocol.DefaultHandshakeTimeout
@@ -234,6 +427,12 @@ func populateServerConfig(config *Config) *Config {
 	if config.IdleTimeout != 0 {
 		idleTimeout = config.IdleTimeout
 	}
+	idleTimeoutMultiplier := config.IdleTimeoutMultiplier
+	if idleTimeoutMultiplier == 0 {
+		idleTimeoutMultiplier = protocol.DefaultIdleTimeoutMultiplier
+	} else if idleTimeoutMultiplier < 0 {
+		idleTimeoutMultiplier = 0
+	}
 
 	maxReceiveStreamFlowControlWindow := config.MaxReceiveStreamFlowControlWindow
 	if maxReceiveStreamFlowControlWindow == 0 {
@@ -243,6 +442,10 @@ func populateServerConfig(config *Config) *Config {
 	if maxReceiveConnectionFlowControlWindow == 0 {
 		maxReceiveConnectionFlowControlWindow = protocol.DefaultMaxReceiveConnectionFlowControlWindow
 	}
+	maxConnectionSendBufferBytes := config.MaxConnectionSendBufferBytes
+	if maxConnectionSendBufferBytes == 0 {
+		maxConnectionSendBufferBytes = protocol.DefaultMaxConnectionSendBufferSize
+	}
 	maxIncomingStreams := config.MaxIncomingStreams
 	if maxIncomingStreams == 0 {
 		maxIncomingStreams = protocol.DefaultMaxIncomingStreams
@@ -255,71 +458,306 @@ func populateServerConfig(config *Config) *Config {
 	} else if maxIncomingUniStreams < 0 {
 		maxIncomingUniStreams = 0
 	}
+	maxBurstPackets := config.MaxBurstPackets
+	if maxBurstPackets <= 0 {
+		maxBurstPackets = protocol.DefaultMaxBurstPackets
+	}
+	connIDGenerator := config.ConnectionIDGenerator
 	connIDLen := config.ConnectionIDLength
-	if connIDLen == 0 {
-		connIDLen = protocol.DefaultConnectionIDLength
+	if connIDGenerator != nil {
+		connIDLen = connIDGenerator.ConnectionIDLen()
+	} else {
+		if connIDLen == 0 {
+			connIDLen = protocol.DefaultConnectionIDLength
+		}
+		connIDGenerator = &randomConnectionIDGenerator{connIDLen: connIDLen}
+	}
+	acceptQueueLength := config.AcceptQueueLength
+	if acceptQueueLength == 0 {
+		acceptQueueLength = protocol.DefaultAcceptQueueLength
+	}
+	maxInitialsPerIP := config.MaxInitialsPerIPPerInterval
+	if maxInitialsPerIP == 0 {
+		maxInitialsPerIP = protocol.DefaultMaxInitialsPerIPPerInterval
 	}
 
 	return &Config{
 		Versions:                              versions,
 		HandshakeTimeout:                      handshakeTimeout,
 		IdleTimeout:                           idleTimeout,
+		IdleTimeoutMultiplier:                 idleTimeoutMultiplier,
+		MinIdleTimeout:                        config.MinIdleTimeout,
+		MaxIdleTimeout:                        config.MaxIdleTimeout,
 		AcceptCookie:                          vsa,
+		RetryTokenValidity:                    retryTokenValidity,
+		VerifySourceAddress:                   config.VerifySourceAddress,
+		VerifyConnection:                      config.VerifyConnection,
 		KeepAlive:                             config.KeepAlive,
+		PaddingStrategy:                       config.PaddingStrategy,
+		ObfuscateStreamFingerprint:            config.ObfuscateStreamFingerprint,
+		EnableDatagrams:                       config.EnableDatagrams,
+		EnableFrameGreasing:                   config.EnableFrameGreasing,
+		CustomTransportParameters:             config.CustomTransportParameters,
+		OnCustomFrame:                         config.OnCustomFrame,
+		customFrameTypes:                      config.customFrameTypes,
+		OnReadAvailable:                       config.OnReadAvailable,
+		EventHooks:                            config.EventHooks,
+		Tracer:                                config.Tracer,
+		MetricsCollector:                      config.MetricsCollector,
+		Logger:                                config.Logger,
+		PacketCapturer:                        config.PacketCapturer,
+		testingTB:                             config.testingTB,
 		MaxReceiveStreamFlowControlWindow:     maxReceiveStreamFlowControlWindow,
 		MaxReceiveConnectionFlowControlWindow: maxReceiveConnectionFlowControlWindow,
+		MaxConnectionSendBufferBytes:          maxConnectionSendBufferBytes,
 		MaxIncomingStreams:                    maxIncomingStreams,
 		MaxIncomingUniStreams:                 maxIncomingUniStreams,
+		MaxBurstPackets:                       maxBurstPackets,
 		ConnectionIDLength:                    connIDLen,
+		ConnectionIDGenerator:                 connIDGenerator,
 		StatelessResetKey:                     config.StatelessResetKey,
+		TokenKey:                              config.TokenKey,
+		GetTokenKeys:                          getTokenKeys,
+		NewTokenValidity:                      newTokenValidity,
+		AcceptQueueLength:                     acceptQueueLength,
+		RetryHandshakeThreshold:               config.RetryHandshakeThreshold,
+		RetryInitialRateThreshold:             config.RetryInitialRateThreshold,
+		InitialCryptoRateLimit:                config.InitialCryptoRateLimit,
+		MaxInitialsPerIPPerInterval:           maxInitialsPerIP,
+		MaxIdleConnectionAge:                  config.MaxIdleConnectionAge,
+		UDPReceiveBufferSize:                  udpBufferSize(config),
 	}
 }
 
 // Accept returns newly openend sessions
 func (s *server) Accept() (Session, error) {
-	var sess Session
-	select {
-	case sess = <-s.sessionQueue:
-		return sess, nil
-	case <-s.errorChan:
-		return nil, s.serverError
+	for {
+		var sess Session
+		select {
+		case sess = <-s.sessionQueue:
+		case <-s.errorChan:
+			return nil, s.serverError
+		}
+		ok, err := s.markAccepted(sess.(quicSession))
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			return sess, nil
+		}
 	}
 }
 
-// Close the server
-func (s *server) Close() error {
+// AcceptEarly returns sessions as soon as the server sent its first flight.
+// It also returns sessions that completed the handshake before AcceptEarly was called.
+func (s *server) AcceptEarly(ctx context.Context) (EarlySession, error) {
+	for {
+		var sess quicSession
+		select {
+		case sess = <-s.earlySessionQueue:
+		case qs := <-s.sessionQueue:
+			sess = qs.(quicSession)
+		case <-s.errorChan:
+			return nil, s.serverError
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		ok, err := s.markAccepted(sess)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			return sess, nil
+		}
+	}
+}
+
+// markAccepted marks a session as accepted.
+// It returns false if the session was already returned by Accept or AcceptEarly.
+func (s *server) markAccepted(sess quicSession) (bool, error) {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
+	// Close refuses all sessions that were not yet accepted.
 	if s.closed {
-		return nil
+		return false, s.serverError
 	}
-	return s.closeWithMutex()
+	accepted, ok := s.sessions[sess]
+	if accepted {
+		return false, nil
+	}
+	if ok {
+		s.sessions[sess] = true
+	}
+	return true, nil
 }
 
-func (s *server) closeWithMutex() error {
+// Close stops accepting new sessions.
+// Sessions that were already accepted are not closed.
+// If the server was started with ListenAddr, the UDP connection is closed once all sessions have been closed.
+func (s *server) Close() error {
+	s.mutex.Lock()
+	if s.closed {
+		s.mutex.Unlock()
+		return nil
+	}
+	s.serverError = errors.New("server closed")
+	s.closeWithMutex()
+	// Sessions that were not accepted yet will never be returned by Accept.
+	var refused []quicSession
+	for sess, accepted := range s.sessions {
+		if !accepted {
+			refused = append(refused, sess)
+		}
+	}
+	drained := len(s.sessions) == 0
+	s.mutex.Unlock()
+
 	s.sessionHandler.CloseServer()
-	if s.serverError == nil {
-		s.serverError = errors.New("server closed")
+	for _, sess := range refused {
+		sess.closeLocal(qerr.Error(qerr.ServerBusy, "server closed"))
 	}
-	var err error
-	// If the server was started with ListenAddr, we created the packet conn.
-	// We need to close it in order to make the go routine reading from that conn return.
-	if s.createdPacketConn {
-		err = s.sessionHandler.Close()
+	if drained {
+		s.drain()
+		return s.drainErr
 	}
+	return nil
+}
+
+// Shutdown closes the server (see Close) and waits until all sessions have been closed.
+// If the context is canceled before that, the remaining sessions are closed,
+// and a CONNECTION_CLOSE is sent to the peers.
+func (s *server) Shutdown(ctx context.Context) error {
+	if err := s.Close(); err != nil {
+		return err
+	}
+	select {
+	case <-s.drained:
+		return s.drainErr
+	case <-ctx.Done():
+	}
+	s.mutex.Lock()
+	remaining := make([]quicSession, 0, len(s.sessions))
+	for sess := range s.sessions {
+		remaining = append(remaining, sess)
+	}
+	s.mutex.Unlock()
+	var wg sync.WaitGroup
+	for _, sess := range remaining {
+		wg.Add(1)
+		go func(sess quicSession) {
+			defer wg.Done()
+			// session.Close() blocks until the CONNECTION_CLOSE has been sent and the run-loop has stopped
+			sess.Close()
+		}(sess)
+	}
+	wg.Wait()
+	<-s.drained
+	return ctx.Err()
+}
+
+func (s *server) closeWithMutex() {
 	s.closed = true
 	close(s.errorChan)
-	return err
 }
 
+// closeWithError is called when the UDP connection returned an error.
+// All sessions are destroyed by the packetHandlerMap.
 func (s *server) closeWithError(e error) error {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
+	s.connErrorOccurred = true
 	if s.closed {
 		return nil
 	}
 	s.serverError = e
-	return s.closeWithMutex()
+	s.closeWithMutex()
+	if len(s.sessions) == 0 {
+		go s.drain()
+	}
+	return nil
+}
+
+// addSession adds a new session.
+// It returns false if the server was already closed. The session must then not be run.
+// Checking and adding under the same mutex as Close makes sure that Close refuses all sessions that were not yet accepted.
+func (s *server) addSession(sess quicSession) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.closed {
+		return false
+	}
+	s.sessions[sess] = false
+	return true
+}
+
+func (s *server) removeSession(sess quicSession) {
+	s.mutex.Lock()
+	delete(s.sessions, sess)
+	drained := s.closed && len(s.sessions) == 0
+	s.mutex.Unlock()
+	if drained {
+		s.drain()
+	}
+}
+
+// ActiveConnections returns the number of sessions that are still running
+func (s *server) ActiveConnections() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return len(s.sessions)
+}
+
+// runIdlePruner periodically closes sessions that have been idle for longer than MaxIdleConnectionAge.
+// It returns once the server has been closed and all sessions are gone.
+func (s *server) runIdlePruner() {
+	ticker := time.NewTicker(s.config.MaxIdleConnectionAge / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.drained:
+			return
+		case now := <-ticker.C:
+			s.pruneIdleSessions(now)
+		}
+	}
+}
+
+// pruneIdleSessions closes all sessions that didn't receive a packet since before now - MaxIdleConnectionAge.
+// The least recently used sessions are closed first.
+func (s *server) pruneIdleSessions(now time.Time) {
+	type idleSession struct {
+		sess         quicSession
+		lastActivity time.Time
+	}
+	deadline := now.Add(-s.config.MaxIdleConnectionAge)
+	var idle []idleSession
+	s.mutex.Lock()
+	for sess := range s.sessions {
+		if t := sess.lastActivityTime(); t.Before(deadline) {
+			idle = append(idle, idleSession{sess: sess, lastActivity: t})
+		}
+	}
+	s.mutex.Unlock()
+	sort.Slice(idle, func(i, j int) bool { return idle[i].lastActivity.Before(idle[j].lastActivity) })
+	for _, i := range idle {
+		s.logger.Debugf("Pruning session idle since %s", i.lastActivity)
+		i.sess.closeLocal(qerr.Error(qerr.NoError, "idle timeout"))
+	}
+}
+
+// drain is called after the server was closed, as soon as all sessions have been closed.
+func (s *server) drain() {
+	s.drainOnce.Do(func() {
+		s.mutex.Lock()
+		closeConn := s.createdPacketConn && !s.connErrorOccurred
+		s.mutex.Unlock()
+		// If the server was started with ListenAddr, we created the packet conn.
+		// We need to close it in order to make the go routine reading from that conn return.
+		if closeConn {
+			s.drainErr = s.sessionHandler.Close()
+		}
+		close(s.drained)
+	})
 }
 
 // Addr returns the server's network address
@@ -327,6 +765,21 @@ func (s *server) Addr() net.Addr {
 	return s.conn.LocalAddr()
 }
 
+// Stats returns statistics about the server
+func (s *server) Stats() ListenerStats {
+	stats := ListenerStats{
+		RefusedSessions:    atomic.LoadUint64(&s.refusedSessions),
+		DroppedInitials:    atomic.LoadUint64(&s.droppedInitials),
+		RejectedInitials:   atomic.LoadUint64(&s.rejectedInitials),
+		OverBudgetInitials: atomic.LoadUint64(&s.overBudgetInitials),
+		DroppedPackets:     s.droppedPackets.Snapshot(),
+	}
+	if s.adaptiveRetry != nil {
+		stats.RetryActive, stats.HandshakingSessions = s.adaptiveRetry.Stats()
+	}
+	return stats
+}
+
 func (s *server) handlePacket(p *receivedPacket) {
 	go func() {
 		if shouldReleaseBuffer := s.handlePacketImpl(p); !shouldReleaseBuffer {
@@ -338,6 +791,7 @@ func (s *server) handlePacket(p *receivedPacket) {
 func (s *server) handlePacketImpl(p *receivedPacket) bool /* was the packet passed on to a session */ {
 	if len(p.data) < protocol.MinInitialPacketSize {
 		s.logger.Debugf("Dropping a packet that is too small to be a valid Initial (%d bytes)", len(p.data))
+		s.droppedPackets.Add(PacketDropUnexpectedPacket)
 		return false
 	}
 	// If we're creating a new session, the packet will be passed to the session.
@@ -345,6 +799,7 @@ func (s *server) handlePacketImpl(p *receivedPacket) bool /* was the packet pass
 	hdr, _, _, err := wire.ParsePacket(p.data, s.config.ConnectionIDLength)
 	if err != nil {
 		s.logger.Debugf("Error parsing packet: %s", err)
+		s.droppedPackets.Add(PacketDropHeaderParseError)
 		return false
 	}
 	// Short header packets should never end up here in the first place
@@ -354,12 +809,21 @@ func (s *server) handlePacketImpl(p *receivedPacket) bool /* was the packet pass
 	// send a Version Negotiation Packet if the client is speaking a different protocol version
 	if !protocol.IsSupportedVersion(s.config.Versions, hdr.Version) {
 		s.sendVersionNegotiationPacket(p, hdr)
+		s.droppedPackets.Add(PacketDropUnsupportedVersion)
 		return false
 	}
 	if hdr.IsLongHeader && hdr.Type != protocol.PacketTypeInitial {
 		// Drop long header packets.
 		// There's litte point in sending a Stateless Reset, since the client
 		// might not have received the token yet.
+		s.droppedPackets.Add(PacketDropUnknownConnectionID)
+		return false
+	}
+	// Drop Initials from hosts that send more Initials than their budget allows,
+	// before doing any processing of the packet.
+	if s.perIPBudget != nil && !s.perIPBudget.Allow(p.remoteAddr, p.rcvTime) {
+		s.logger.Debugf("Dropping Initial packet from %s. Per-IP budget exceeded.", p.remoteAddr)
+		atomic.AddUint64(&s.overBudgetInitials, 1)
 		return false
 	}
 
@@ -384,37 +848,83 @@ func (s *server) handleInitialImpl(p *receivedPacket, hdr *wire.Header) (quicSes
 		return nil, nil, errors.New("too short connection ID")
 	}
 
-	var cookie *Cookie
-	var origDestConnectionID protocol.ConnectionID
+	var (
+		origDestConnectionID protocol.ConnectionID
+		cookie               *Cookie
+		validated            bool
+		// Clients presenting an invalid NEW_TOKEN token are always sent a Retry,
+		// even if load-adaptive address validation is enabled.
+		isNewToken bool
+	)
 	if len(hdr.Token) > 0 {
 		c, err := s.cookieGenerator.DecodeToken(hdr.Token)
 		if err == nil {
 			cookie = &Cookie{
-				RemoteAddr: c.RemoteAddr,
-				SentTime:   c.SentTime,
+				IsRetryToken: c.IsRetryToken,
+				RemoteAddr:   c.RemoteAddr,
+				SentTime:     c.SentTime,
 			}
 			origDestConnectionID = c.OriginalDestConnectionID
 		}
 	}
-	if !s.config.AcceptCookie(p.remoteAddr, cookie) {
-		// Log the Initial packet now.
-		// If no Retry is sent, the packet will be logged by the session.
-		(&wire.ExtendedHeader{Header: *hdr}).Log(s.logger)
-		return nil, nil, s.sendRetry(p.remoteAddr, hdr)
+	if cookie != nil && !cookie.IsRetryToken {
+		// This token was issued in a NEW_TOKEN frame on a previous connection.
+		// If it's valid, there's no need to verify the client's address using a Retry.
+		isNewToken = true
+		validated = validateNewToken(p.remoteAddr, cookie, s.config.NewTokenValidity, time.Now())
+	} else {
+		validated = s.config.AcceptCookie(p.remoteAddr, cookie)
+	}
+
+	decision := DecisionRequireValidation
+	if s.config.VerifySourceAddress != nil {
+		decision = s.config.VerifySourceAddress(p.remoteAddr, cookie)
+	}
+	switch decision {
+	case DecisionReject:
+		s.logger.Debugf("Rejecting connection attempt from %s.", p.remoteAddr)
+		atomic.AddUint64(&s.rejectedInitials, 1)
+		return nil, nil, s.sendServerBusy(p, hdr)
+	case DecisionDrop:
+		s.logger.Debugf("Dropping Initial packet from %s.", p.remoteAddr)
+		atomic.AddUint64(&s.rejectedInitials, 1)
+		return nil, nil, nil
+	case DecisionRequireValidation:
+		if isNewToken {
+			if !validated {
+				s.logger.Debugf("Received an invalid address validation token. Sending a Retry.")
+				(&wire.ExtendedHeader{Header: *hdr}).Log(s.logger)
+				return nil, nil, s.sendRetry(p, hdr)
+			}
+			s.logger.Debugf("Received a valid address validation token. Skipping the Retry.")
+		} else if !validated && (s.adaptiveRetry == nil || s.adaptiveRetry.ShouldRetry(time.Now())) {
+			// Log the Initial packet now.
+			// If no Retry is sent, the packet will be logged by the session.
+			(&wire.ExtendedHeader{Header: *hdr}).Log(s.logger)
+			return nil, nil, s.sendRetry(p, hdr)
+		}
 	}
 
-	if queueLen := atomic.LoadInt32(&s.sessionQueueLen); queueLen >= protocol.MaxAcceptQueueSize {
-		s.logger.Debugf("Rejecting new connection. Server currently busy. Accept queue length: %d (max %d)", queueLen, protocol.MaxAcceptQueueSize)
-		return nil, nil, s.sendServerBusy(p.remoteAddr, hdr)
+	if queueLen := atomic.LoadInt32(&s.sessionQueueLen); queueLen >= int32(s.config.AcceptQueueLength) {
+		s.logger.Debugf("Rejecting new connection. Server currently busy. Accept queue length: %d (max %d)", queueLen, s.config.AcceptQueueLength)
+		atomic.AddUint64(&s.refusedSessions, 1)
+		return nil, nil, s.sendServerBusy(p, hdr)
 	}
 
-	connID, err := protocol.GenerateConnectionID(s.config.ConnectionIDLength)
+	// Drop the packet before the session starts processing the ClientHello.
+	if s.initialLimiter != nil && !s.initialLimiter.Allow() {
+		s.logger.Debugf("Dropping Initial packet from %s. Initial CRYPTO rate limit exceeded.", p.remoteAddr)
+		atomic.AddUint64(&s.droppedInitials, 1)
+		return nil, nil, nil
+	}
+
+	connID, err := newConnectionID(s.config.ConnectionIDGenerator)
 	if err != nil {
 		return nil, nil, err
 	}
 	s.logger.Debugf("Changing connection ID to %s.", connID)
 	sess, err := s.createNewSession(
-		p.remoteAddr,
+		&conn{pconn: s.packetConnFor(p), currentAddr: p.remoteAddr},
 		origDestConnectionID,
 		hdr.DestConnectionID,
 		hdr.SrcConnectionID,
@@ -424,12 +934,15 @@ func (s *server) handleInitialImpl(p *receivedPacket, hdr *wire.Header) (quicSes
 	if err != nil {
 		return nil, nil, err
 	}
+	if sess == nil { // the server was closed
+		return nil, nil, nil
+	}
 	sess.handlePacket(p)
 	return sess, connID, nil
 }
 
 func (s *server) createNewSession(
-	remoteAddr net.Addr,
+	sconn connection,
 	origDestConnID protocol.ConnectionID,
 	clientDestConnID protocol.ConnectionID,
 	destConnID protocol.ConnectionID,
@@ -442,16 +955,26 @@ func (s *server) createNewSession(
 		InitialMaxStreamDataBidiRemote: protocol.InitialMaxStreamData,
 		InitialMaxStreamDataUni:        protocol.InitialMaxStreamData,
 		InitialMaxData:                 protocol.InitialMaxData,
-		IdleTimeout:                    s.config.IdleTimeout,
+		IdleTimeout:                    advertisedIdleTimeout(s.config),
 		MaxBidiStreams:                 uint64(s.config.MaxIncomingStreams),
 		MaxUniStreams:                  uint64(s.config.MaxIncomingUniStreams),
 		AckDelayExponent:               protocol.AckDelayExponent,
 		DisableMigration:               true,
 		StatelessResetToken:            &token,
 		OriginalConnectionID:           origDestConnID,
+		SupportsGreaseFrames:           s.config.EnableFrameGreasing,
+		CustomParameters:               s.config.CustomTransportParameters,
+	}
+	if s.config.EnableDatagrams {
+		params.MaxDatagramFrameSize = protocol.MaxDatagramFrameSize
+	}
+	// If a Retry was sent, origDestConnID is the destination connection ID the client initially chose.
+	odcid := clientDestConnID
+	if origDestConnID.Len() > 0 {
+		odcid = origDestConnID
 	}
 	sess, err := s.newSession(
-		&conn{pconn: s.conn, currentAddr: remoteAddr},
+		sconn,
 		s.sessionRunner,
 		clientDestConnID,
 		destConnID,
@@ -459,22 +982,44 @@ func (s *server) createNewSession(
 		s.config,
 		s.tlsConf,
 		params,
-		s.logger,
+		s.logger.WithConnection(protocol.PerspectiveServer, srcConnID, "odcid", odcid),
 		version,
 	)
 	if err != nil {
 		return nil, err
 	}
-	go sess.run()
+	if !s.addSession(sess) {
+		return nil, nil
+	}
+	if s.adaptiveRetry != nil {
+		s.adaptiveRetry.AddSession(sess)
+	}
+	go func() {
+		sess.run()
+		if s.adaptiveRetry != nil {
+			s.adaptiveRetry.RemoveSession(sess)
+		}
+		s.removeSession(sess)
+	}()
 	return sess, nil
 }
 
-func (s *server) sendRetry(remoteAddr net.Addr, hdr *wire.Header) error {
-	token, err := s.cookieGenerator.NewToken(remoteAddr, hdr.DestConnectionID)
+// packetConnFor returns the socket that a packet was received on.
+// Replies need to be sent on the same socket:
+// When using SO_REUSEPORT, the kernel then keeps sending packets of this flow to the same socket.
+func (s *server) packetConnFor(p *receivedPacket) net.PacketConn {
+	if p.conn != nil {
+		return p.conn
+	}
+	return s.conn
+}
+
+func (s *server) sendRetry(p *receivedPacket, hdr *wire.Header) error {
+	token, err := s.cookieGenerator.NewRetryToken(p.remoteAddr, hdr.DestConnectionID)
 	if err != nil {
 		return err
 	}
-	connID, err := protocol.GenerateConnectionID(s.config.ConnectionIDLength)
+	connID, err := newConnectionID(s.config.ConnectionIDGenerator)
 	if err != nil {
 		return err
 	}
@@ -492,13 +1037,13 @@ func (s *server) sendRetry(remoteAddr net.Addr, hdr *wire.Header) error {
 	if err := replyHdr.Write(buf, hdr.Version); err != nil {
 		return err
 	}
-	if _, err := s.conn.WriteTo(buf.Bytes(), remoteAddr); err != nil {
+	if _, err := s.packetConnFor(p).WriteTo(buf.Bytes(), p.remoteAddr); err != nil {
 		s.logger.Debugf("Error sending Retry: %s", err)
 	}
 	return nil
 }
 
-func (s *server) sendServerBusy(remoteAddr net.Addr, hdr *wire.Header) error {
+func (s *server) sendServerBusy(p *receivedPacket, hdr *wire.Header) error {
 	sealer, _, err := handshake.NewInitialAEAD(hdr.DestConnectionID, protocol.PerspectiveServer)
 	if err != nil {
 		return err
@@ -539,7 +1084,7 @@ func (s *server) sendServerBusy(remoteAddr net.Addr, hdr *wire.Header) error {
 
 	replyHdr.Log(s.logger)
 	wire.LogFrame(s.logger, ccf, true)
-	if _, err := s.conn.WriteTo(raw, remoteAddr); err != nil {
+	if _, err := s.packetConnFor(p).WriteTo(raw, p.remoteAddr); err != nil {
 		s.logger.Debugf("Error rejecting connection: %s", err)
 	}
 	return nil
@@ -552,7 +1097,21 @@ func (s *server) sendVersionNegotiationPacket(p *receivedPacket, hdr *wire.Heade
 		s.logger.Debugf("Error composing Version Negotiation: %s", err)
 		return
 	}
-	if _, err := s.conn.WriteTo(data, p.remoteAddr); err != nil {
+	if _, err := s.packetConnFor(p).WriteTo(data, p.remoteAddr); err != nil {
 		s.logger.Debugf("Error sending Version Negotiation: %s", err)
+		return
+	}
+	if s.config.MetricsCollector != nil {
+		s.config.MetricsCollector.VersionNegotiation()
 	}
 }
+
+func (s *server) sentStatelessReset() {
+	if s.config.MetricsCollector != nil {
+		s.config.MetricsCollector.StatelessResetSent()
+	}
+}
+
+func (s *server) droppedPacket(reason PacketDropReason) {
+	s.droppedPackets.Add(reason)
+}
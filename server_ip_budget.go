@@ -0,0 +1,121 @@
+package quic
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	perIPBudgetBuckets = 256
+	perIPBudgetSlots   = 4
+)
+
+type perIPBudgetSlot struct {
+	fingerprint uint64
+	interval    int64 // the interval in which count was last reset
+	count       int
+}
+
+// The perIPBudget limits the number of Initial packets that are processed per interval from a single IP address.
+// It uses a two-level hash:
+// The first hash of the IP address selects a bucket, the second one is stored as a fingerprint in one of the bucket's slots.
+// The table is allocated once, so tracking a new IP address doesn't allocate.
+// Slots are reused when a new interval starts.
+// If all slots of a bucket are in use, the slot with the lowest count is evicted,
+// such that hosts exceeding their budget stay tracked.
+type perIPBudget struct {
+	mutex sync.Mutex
+
+	maxPerInterval int
+	interval       time.Duration
+
+	// the hashes are keyed, such that an attacker can't craft addresses that collide with other hosts
+	bucketKey      uint64
+	fingerprintKey uint64
+
+	buckets [perIPBudgetBuckets][perIPBudgetSlots]perIPBudgetSlot
+}
+
+func newPerIPBudget(maxPerInterval int, interval time.Duration) (*perIPBudget, error) {
+	keys := make([]byte, 16)
+	if _, err := rand.Read(keys); err != nil {
+		return nil, err
+	}
+	return &perIPBudget{
+		maxPerInterval: maxPerInterval,
+		interval:       interval,
+		bucketKey:      binary.BigEndian.Uint64(keys[:8]),
+		fingerprintKey: binary.BigEndian.Uint64(keys[8:]),
+	}, nil
+}
+
+// Allow is called for every Initial packet starting a new handshake.
+// It returns false if the budget of the sender's IP address is exhausted.
+func (b *perIPBudget) Allow(addr net.Addr, now time.Time) bool {
+	ip := ipForBudget(addr)
+	if ip == nil {
+		return true
+	}
+	bucket := &b.buckets[hashIP(b.bucketKey, ip)%perIPBudgetBuckets]
+	fingerprint := hashIP(b.fingerprintKey, ip)
+	interval := now.UnixNano() / int64(b.interval)
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	var slot *perIPBudgetSlot
+	for i := range bucket {
+		s := &bucket[i]
+		if s.interval != interval {
+			s.count = 0
+		}
+		if s.count > 0 && s.fingerprint == fingerprint {
+			slot = s
+			break
+		}
+		if slot == nil || s.count < slot.count {
+			slot = s
+		}
+	}
+	if slot.fingerprint != fingerprint || slot.interval != interval {
+		slot.fingerprint = fingerprint
+		slot.interval = interval
+		slot.count = 0
+	}
+	if slot.count >= b.maxPerInterval {
+		return false
+	}
+	slot.count++
+	return true
+}
+
+// ipForBudget returns the IP address of a remote address.
+// IPv4 addresses are always returned in their 4-byte representation.
+func ipForBudget(addr net.Addr) net.IP {
+	udpAddr, ok := addr.(*net.UDPAddr)
+	if !ok {
+		return nil
+	}
+	if ip4 := udpAddr.IP.To4(); ip4 != nil {
+		return ip4
+	}
+	return udpAddr.IP
+}
+
+// hashIP calculates a keyed FNV-1a hash of an IP address
+func hashIP(key uint64, ip net.IP) uint64 {
+	const prime = 1099511628211
+	h := uint64(14695981039346656037) ^ key
+	for _, b := range ip {
+		h ^= uint64(b)
+		h *= prime
+	}
+	// finalize, so that all bits depend on the input
+	h ^= h >> 33
+	h *= 0xff51afd7ed558ccd
+	h ^= h >> 33
+	return h
+}
@@ -0,0 +1,82 @@
+package quic
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Per-IP Budget", func() {
+	var (
+		b   *perIPBudget
+		now time.Time
+	)
+
+	BeforeEach(func() {
+		var err error
+		b, err = newPerIPBudget(5, 100*time.Millisecond)
+		Expect(err).ToNot(HaveOccurred())
+		now = time.Unix(1000, 0)
+	})
+
+	addr := func(ip net.IP) net.Addr { return &net.UDPAddr{IP: ip, Port: 1234} }
+
+	It("allows packets up to the budget", func() {
+		for i := 0; i < 5; i++ {
+			Expect(b.Allow(addr(net.IPv4(1, 2, 3, 4)), now)).To(BeTrue())
+		}
+		Expect(b.Allow(addr(net.IPv4(1, 2, 3, 4)), now)).To(BeFalse())
+		Expect(b.Allow(addr(net.IPv4(1, 2, 3, 5)), now)).To(BeTrue())
+	})
+
+	It("treats the 4-byte and the 16-byte representation of an IPv4 address the same", func() {
+		for i := 0; i < 5; i++ {
+			Expect(b.Allow(addr(net.IPv4(1, 2, 3, 4)), now)).To(BeTrue())
+		}
+		Expect(b.Allow(addr(net.IP{1, 2, 3, 4}), now)).To(BeFalse())
+	})
+
+	It("tracks IPv6 addresses", func() {
+		ip := net.ParseIP("2001:db8::1")
+		for i := 0; i < 5; i++ {
+			Expect(b.Allow(addr(ip), now)).To(BeTrue())
+		}
+		Expect(b.Allow(addr(ip), now)).To(BeFalse())
+		Expect(b.Allow(addr(net.ParseIP("2001:db8::2")), now)).To(BeTrue())
+	})
+
+	It("resets the budget when a new interval starts", func() {
+		for i := 0; i < 5; i++ {
+			Expect(b.Allow(addr(net.IPv4(1, 2, 3, 4)), now)).To(BeTrue())
+		}
+		Expect(b.Allow(addr(net.IPv4(1, 2, 3, 4)), now.Add(99*time.Millisecond))).To(BeFalse())
+		Expect(b.Allow(addr(net.IPv4(1, 2, 3, 4)), now.Add(100*time.Millisecond))).To(BeTrue())
+	})
+
+	It("allows packets from addresses that are not UDP addresses", func() {
+		for i := 0; i < 10; i++ {
+			Expect(b.Allow(&net.TCPAddr{IP: net.IPv4(1, 2, 3, 4)}, now)).To(BeTrue())
+		}
+	})
+
+	It("keeps tracking hosts exceeding their budget when many other hosts send packets", func() {
+		flooder := addr(net.IPv4(10, 0, 0, 1))
+		for i := 0; i < 5; i++ {
+			Expect(b.Allow(flooder, now)).To(BeTrue())
+		}
+		// more hosts than there are slots in the table
+		for i := 0; i < 4*perIPBudgetBuckets*perIPBudgetSlots; i++ {
+			Expect(b.Allow(addr(net.IPv4(172, 16, byte(i>>8), byte(i))), now)).To(BeTrue())
+		}
+		Expect(b.Allow(flooder, now)).To(BeFalse())
+	})
+
+	It("doesn't allocate", func() {
+		a := addr(net.IPv4(1, 2, 3, 4))
+		allocs := testing.AllocsPerRun(100, func() { b.Allow(a, now) })
+		Expect(allocs).To(BeZero())
+	})
+})
@@ -0,0 +1,97 @@
+package quic
+
+import (
+	"sync"
+	"time"
+
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+	"github.com/lucas-clemente/quic-go/internal/utils"
+)
+
+// The adaptiveRetry decides if a Retry should be sent to clients that didn't present a valid token.
+// A Retry is only sent if the server is under load, i.e.
+// if the number of sessions that are currently handshaking or
+// the rate of Initial packets without a valid token exceeds a threshold.
+// To prevent flapping, Retry mode is only left when both values drop below half of their threshold,
+// and at least protocol.MinRetryModeDuration after it was entered.
+type adaptiveRetry struct {
+	mutex sync.Mutex
+
+	handshakeThreshold   int // 0 if not set
+	initialRateThreshold int // 0 if not set
+
+	handshaking map[quicSession]struct{}
+
+	// the number of Initials without a valid token received in the current and the last window
+	windowStart          time.Time
+	initialsInWindow     int
+	initialsInLastWindow int
+
+	retryActive bool
+	activeSince time.Time
+}
+
+func newAdaptiveRetry(handshakeThreshold, initialRateThreshold int) *adaptiveRetry {
+	return &adaptiveRetry{
+		handshakeThreshold:   handshakeThreshold,
+		initialRateThreshold: initialRateThreshold,
+		handshaking:          make(map[quicSession]struct{}),
+	}
+}
+
+// AddSession is called when a new session is created
+func (r *adaptiveRetry) AddSession(sess quicSession) {
+	r.mutex.Lock()
+	r.handshaking[sess] = struct{}{}
+	r.mutex.Unlock()
+}
+
+// RemoveSession is called when a session completes the handshake, or is closed
+func (r *adaptiveRetry) RemoveSession(sess quicSession) {
+	r.mutex.Lock()
+	delete(r.handshaking, sess)
+	r.mutex.Unlock()
+}
+
+// ShouldRetry is called for every Initial packet that doesn't contain a valid token.
+func (r *adaptiveRetry) ShouldRetry(now time.Time) bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if now.Sub(r.windowStart) >= protocol.RetryInitialRateWindow {
+		if now.Sub(r.windowStart) >= 2*protocol.RetryInitialRateWindow {
+			r.initialsInLastWindow = 0
+		} else {
+			r.initialsInLastWindow = r.initialsInWindow
+		}
+		r.initialsInWindow = 0
+		r.windowStart = now
+	}
+	r.initialsInWindow++
+	rate := utils.Max(r.initialsInWindow, r.initialsInLastWindow)
+
+	if !r.retryActive {
+		if r.exceeds(len(r.handshaking), r.handshakeThreshold) || r.exceeds(rate, r.initialRateThreshold) {
+			r.retryActive = true
+			r.activeSince = now
+		}
+		return r.retryActive
+	}
+	if now.Sub(r.activeSince) >= protocol.MinRetryModeDuration &&
+		!r.exceeds(2*len(r.handshaking), r.handshakeThreshold) &&
+		!r.exceeds(2*rate, r.initialRateThreshold) {
+		r.retryActive = false
+	}
+	return r.retryActive
+}
+
+func (r *adaptiveRetry) exceeds(val, threshold int) bool {
+	return threshold > 0 && val > threshold
+}
+
+// Stats returns if Retry mode is active, and the number of sessions that are currently handshaking
+func (r *adaptiveRetry) Stats() (bool, int) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.retryActive, len(r.handshaking)
+}
@@ -0,0 +1,109 @@
+package quic
+
+import (
+	"time"
+
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Adaptive Retry", func() {
+	var now time.Time
+
+	BeforeEach(func() {
+		now = time.Now()
+	})
+
+	Context("handshake threshold", func() {
+		var r *adaptiveRetry
+
+		BeforeEach(func() {
+			r = newAdaptiveRetry(4, 0)
+		})
+
+		addSessions := func(num int) []quicSession {
+			sessions := make([]quicSession, num)
+			for i := range sessions {
+				sessions[i] = NewMockQuicSession(mockCtrl)
+				r.AddSession(sessions[i])
+			}
+			return sessions
+		}
+
+		It("doesn't retry if the threshold is not exceeded", func() {
+			addSessions(4)
+			Expect(r.ShouldRetry(now)).To(BeFalse())
+			active, handshaking := r.Stats()
+			Expect(active).To(BeFalse())
+			Expect(handshaking).To(Equal(4))
+		})
+
+		It("retries when the threshold is exceeded", func() {
+			addSessions(5)
+			Expect(r.ShouldRetry(now)).To(BeTrue())
+			active, _ := r.Stats()
+			Expect(active).To(BeTrue())
+		})
+
+		It("only leaves Retry mode when dropping below half of the threshold", func() {
+			sessions := addSessions(5)
+			Expect(r.ShouldRetry(now)).To(BeTrue())
+			now = now.Add(protocol.MinRetryModeDuration)
+			r.RemoveSession(sessions[0])
+			r.RemoveSession(sessions[1])
+			Expect(r.ShouldRetry(now)).To(BeTrue())
+			r.RemoveSession(sessions[2])
+			Expect(r.ShouldRetry(now)).To(BeFalse())
+		})
+
+		It("stays in Retry mode for a minimum duration", func() {
+			sessions := addSessions(5)
+			Expect(r.ShouldRetry(now)).To(BeTrue())
+			for _, sess := range sessions {
+				r.RemoveSession(sess)
+			}
+			now = now.Add(protocol.MinRetryModeDuration / 2)
+			Expect(r.ShouldRetry(now)).To(BeTrue())
+			now = now.Add(protocol.MinRetryModeDuration / 2)
+			Expect(r.ShouldRetry(now)).To(BeFalse())
+		})
+	})
+
+	Context("Initial rate threshold", func() {
+		var r *adaptiveRetry
+
+		BeforeEach(func() {
+			r = newAdaptiveRetry(0, 10)
+		})
+
+		It("retries when the threshold is exceeded", func() {
+			for i := 0; i < 10; i++ {
+				Expect(r.ShouldRetry(now)).To(BeFalse())
+			}
+			Expect(r.ShouldRetry(now)).To(BeTrue())
+		})
+
+		It("doesn't retry if the Initials are spread out over time", func() {
+			for i := 0; i < 100; i++ {
+				now = now.Add(protocol.RetryInitialRateWindow / 5)
+				Expect(r.ShouldRetry(now)).To(BeFalse())
+			}
+		})
+
+		It("only leaves Retry mode when the rate drops below half of the threshold", func() {
+			for i := 0; i < 10; i++ {
+				r.ShouldRetry(now)
+			}
+			Expect(r.ShouldRetry(now)).To(BeTrue())
+			for i := 0; i < 6; i++ {
+				Expect(r.ShouldRetry(now.Add(protocol.MinRetryModeDuration - protocol.RetryInitialRateWindow))).To(BeTrue())
+			}
+			now = now.Add(protocol.MinRetryModeDuration)
+			Expect(r.ShouldRetry(now)).To(BeTrue())
+			now = now.Add(2 * protocol.RetryInitialRateWindow)
+			Expect(r.ShouldRetry(now)).To(BeFalse())
+		})
+	})
+})
@@ -5,16 +5,22 @@ import (
 	"context"
 	"crypto/tls"
 	"errors"
+	"io/ioutil"
 	"net"
 	"reflect"
+	"runtime"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/golang/mock/gomock"
 	"github.com/lucas-clemente/quic-go/internal/handshake"
 	"github.com/lucas-clemente/quic-go/internal/protocol"
+	"github.com/lucas-clemente/quic-go/internal/qerr"
 	"github.com/lucas-clemente/quic-go/internal/testdata"
 	"github.com/lucas-clemente/quic-go/internal/utils"
 	"github.com/lucas-clemente/quic-go/internal/wire"
+	"golang.org/x/time/rate"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
@@ -42,6 +48,7 @@ var _ = Describe("Server", func() {
 		conn = newMockPacketConn()
 		conn.addr = &net.UDPAddr{}
 		tlsConf = testdata.GetTLSConfig()
+		tlsConf.NextProtos = []string{"proto1"}
 	})
 
 	It("errors when no tls.Config is given", func() {
@@ -56,6 +63,29 @@ var _ = Describe("Server", func() {
 		Expect(err.Error()).To(ContainSubstring("quic: Certificates not set in tls.Config"))
 	})
 
+	It("accepts a tls.Config that only sets GetCertificate", func() {
+		ln, err := ListenAddr("localhost:0", &tls.Config{
+			GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) { return nil, nil },
+			NextProtos:     []string{"proto1"},
+		}, nil)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(ln.Close()).To(Succeed())
+	})
+
+	It("errors when no application protocols are set in the tls.Config", func() {
+		tlsConf.NextProtos = nil
+		_, err := ListenAddr("localhost:0", tlsConf, nil)
+		Expect(err).To(MatchError("quic: NextProtos not set in tls.Config, and no GetConfigForClient callback set"))
+	})
+
+	It("accepts a tls.Config without application protocols, if GetConfigForClient is set", func() {
+		tlsConf.NextProtos = nil
+		tlsConf.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) { return nil, nil }
+		ln, err := ListenAddr("localhost:0", tlsConf, nil)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(ln.Close()).To(Succeed())
+	})
+
 	It("errors when the Config contains an invalid version", func() {
 		version := protocol.VersionNumber(0x1234)
 		_, err := Listen(nil, tlsConf, &Config{Versions: []protocol.VersionNumber{version}})
@@ -69,8 +99,20 @@ var _ = Describe("Server", func() {
 		Expect(server.config.Versions).To(Equal(protocol.SupportedVersions))
 		Expect(server.config.HandshakeTimeout).To(Equal(protocol.DefaultHandshakeTimeout))
 		Expect(server.config.IdleTimeout).To(Equal(protocol.DefaultIdleTimeout))
-		Expect(reflect.ValueOf(server.config.AcceptCookie)).To(Equal(reflect.ValueOf(defaultAcceptCookie)))
+		Expect(server.config.IdleTimeoutMultiplier).To(Equal(float64(protocol.DefaultIdleTimeoutMultiplier)))
+		Expect(server.config.AcceptCookie).ToNot(BeNil())
+		Expect(server.config.RetryTokenValidity).To(Equal(protocol.DefaultRetryTokenValidity))
 		Expect(server.config.KeepAlive).To(BeFalse())
+		Expect(server.config.GetTokenKeys).To(BeNil())
+		Expect(server.config.NewTokenValidity).To(Equal(protocol.DefaultNewTokenValidity))
+		Expect(server.adaptiveRetry).To(BeNil())
+		Expect(server.initialLimiter).To(BeNil())
+		Expect(server.config.AcceptQueueLength).To(Equal(protocol.DefaultAcceptQueueLength))
+		Expect(server.config.UDPReceiveBufferSize).To(Equal(protocol.DefaultUDPBufferSize))
+		Expect(server.config.MaxConnectionSendBufferBytes).To(BeEquivalentTo(protocol.DefaultMaxConnectionSendBufferSize))
+		Expect(server.config.MaxBurstPackets).To(Equal(protocol.DefaultMaxBurstPackets))
+		Expect(server.config.MaxInitialsPerIPPerInterval).To(Equal(protocol.DefaultMaxInitialsPerIPPerInterval))
+		Expect(server.perIPBudget).ToNot(BeNil())
 		// stop the listener
 		Expect(ln.Close()).To(Succeed())
 	})
@@ -78,14 +120,36 @@ var _ = Describe("Server", func() {
 	It("setups with the right values", func() {
 		supportedVersions := []protocol.VersionNumber{protocol.VersionTLS}
 		acceptCookie := func(_ net.Addr, _ *Cookie) bool { return true }
+		verifyConnection := func(tls.ConnectionState, Session) error { return nil }
 		config := Config{
-			Versions:          supportedVersions,
-			AcceptCookie:      acceptCookie,
-			HandshakeTimeout:  1337 * time.Hour,
-			IdleTimeout:       42 * time.Minute,
-			KeepAlive:         true,
-			StatelessResetKey: []byte("foobar"),
+			Versions:                    supportedVersions,
+			AcceptCookie:                acceptCookie,
+			HandshakeTimeout:            1337 * time.Hour,
+			IdleTimeout:                 42 * time.Minute,
+			IdleTimeoutMultiplier:       10,
+			MinIdleTimeout:              time.Minute,
+			MaxIdleTimeout:              time.Hour,
+			KeepAlive:                   true,
+			StatelessResetKey:           []byte("foobar"),
+			TokenKey:                    [32]byte{1, 2, 3},
+			NewTokenValidity:            time.Hour,
+			AcceptQueueLength:           100,
+			RetryHandshakeThreshold:     10,
+			InitialCryptoRateLimit:      1000,
+			MaxIdleConnectionAge:        time.Hour,
+			RetryTokenValidity:          time.Minute,
+			MaxBurstPackets:             42,
+			MaxInitialsPerIPPerInterval: -1,
+			VerifyConnection:            verifyConnection,
+			MetricsCollector:            &Metrics{},
+			Logger:                      NewStandardLogger(ioutil.Discard, LogLevelDebug),
+			PacketCapturer:              NewPcapWriter(ioutil.Discard, 0),
+			EnableDatagrams:             true,
+			EnableFrameGreasing:         true,
+			CustomTransportParameters:   map[uint64][]byte{0x1337: []byte("foobar")},
+			OnCustomFrame:               func(Session, CustomFrame) {},
 		}
+		config.RegisterFrameType(0x1337, func([]byte) (CustomFrame, error) { return nil, nil })
 		ln, err := Listen(conn, tlsConf, &config)
 		Expect(err).ToNot(HaveOccurred())
 		server := ln.(*server)
@@ -93,13 +157,70 @@ var _ = Describe("Server", func() {
 		Expect(server.config.Versions).To(Equal(supportedVersions))
 		Expect(server.config.HandshakeTimeout).To(Equal(1337 * time.Hour))
 		Expect(server.config.IdleTimeout).To(Equal(42 * time.Minute))
+		Expect(server.config.IdleTimeoutMultiplier).To(Equal(10.0))
+		Expect(server.config.MinIdleTimeout).To(Equal(time.Minute))
+		Expect(server.config.MaxIdleTimeout).To(Equal(time.Hour))
+		Expect(server.config.MetricsCollector).To(BeIdenticalTo(config.MetricsCollector))
+		Expect(server.config.Logger).To(BeIdenticalTo(config.Logger))
+		Expect(server.config.PacketCapturer).To(BeIdenticalTo(config.PacketCapturer))
 		Expect(reflect.ValueOf(server.config.AcceptCookie)).To(Equal(reflect.ValueOf(acceptCookie)))
+		Expect(server.config.RetryTokenValidity).To(Equal(time.Minute))
 		Expect(server.config.KeepAlive).To(BeTrue())
+		Expect(server.config.EnableDatagrams).To(BeTrue())
+		Expect(server.config.EnableFrameGreasing).To(BeTrue())
+		Expect(server.config.CustomTransportParameters).To(Equal(map[uint64][]byte{0x1337: []byte("foobar")}))
+		Expect(server.config.OnCustomFrame).ToNot(BeNil())
+		Expect(server.config.customFrameTypes).To(HaveKey(uint64(0x1337)))
 		Expect(server.config.StatelessResetKey).To(Equal([]byte("foobar")))
+		Expect(server.config.TokenKey).To(Equal([32]byte{1, 2, 3}))
+		Expect(server.config.GetTokenKeys).ToNot(BeNil())
+		current, previous := server.config.GetTokenKeys()
+		Expect(current).To(Equal([32]byte{1, 2, 3}))
+		Expect(previous).To(BeZero())
+		Expect(server.config.NewTokenValidity).To(Equal(time.Hour))
+		Expect(server.config.AcceptQueueLength).To(Equal(100))
+		Expect(server.adaptiveRetry).ToNot(BeNil())
+		Expect(server.config.InitialCryptoRateLimit).To(Equal(rate.Limit(1000)))
+		Expect(server.initialLimiter.Burst()).To(Equal(1000))
+		Expect(server.config.MaxIdleConnectionAge).To(Equal(time.Hour))
+		Expect(server.config.MaxBurstPackets).To(Equal(42))
+		Expect(server.perIPBudget).To(BeNil())
+		Expect(reflect.ValueOf(server.config.VerifyConnection)).To(Equal(reflect.ValueOf(verifyConnection)))
 		// stop the listener
 		Expect(ln.Close()).To(Succeed())
 	})
 
+	It("uses the length of the ConnectionIDGenerator", func() {
+		ln, err := Listen(conn, tlsConf, &Config{ConnectionIDGenerator: &serverIDConnectionIDGenerator{connIDLen: 10}})
+		Expect(err).ToNot(HaveOccurred())
+		server := ln.(*server)
+		Expect(server.config.ConnectionIDLength).To(Equal(10))
+		Expect(ln.Close()).To(Succeed())
+	})
+
+	It("errors if the ConnectionIDLength is invalid", func() {
+		_, err := Listen(conn, tlsConf, &Config{ConnectionIDLength: 19})
+		Expect(err).To(MatchError("invalid ConnectionIDLength: 19 (must be 0, or between 4 and 18)"))
+	})
+
+	It("errors if the ConnectionIDLength doesn't match the ConnectionIDGenerator", func() {
+		_, err := Listen(conn, tlsConf, &Config{
+			ConnectionIDLength:    8,
+			ConnectionIDGenerator: &serverIDConnectionIDGenerator{connIDLen: 10},
+		})
+		Expect(err).To(MatchError("ConnectionIDLength (8) doesn't match the length of the ConnectionIDGenerator (10)"))
+	})
+
+	It("errors if the AcceptQueueLength is negative", func() {
+		_, err := Listen(conn, tlsConf, &Config{AcceptQueueLength: -1})
+		Expect(err).To(MatchError("invalid AcceptQueueLength: -1"))
+	})
+
+	It("errors if the custom transport parameters are invalid", func() {
+		_, err := Listen(conn, tlsConf, &Config{CustomTransportParameters: map[uint64][]byte{1 << 16: nil}})
+		Expect(err).To(MatchError("invalid custom transport parameter ID 0x10000 (maximum 0xffff)"))
+	})
+
 	It("listens on a given address", func() {
 		addr := "127.0.0.1:13579"
 		ln, err := ListenAddr(addr, tlsConf, &Config{})
@@ -110,6 +231,52 @@ var _ = Describe("Server", func() {
 		Expect(ln.Close()).To(Succeed())
 	})
 
+	It("listens on multiple sockets using SO_REUSEPORT", func() {
+		if !reusePortSupported {
+			Skip("SO_REUSEPORT not supported on this platform")
+		}
+		ln, err := ListenAddrReusePort("127.0.0.1:0", tlsConf, &Config{}, 4)
+		Expect(err).ToNot(HaveOccurred())
+		serv := ln.(*server)
+		phm := serv.sessionHandler.(*packetHandlerMap)
+		Expect(phm.additionalConns).To(HaveLen(3))
+		for _, c := range phm.additionalConns {
+			Expect(c.LocalAddr()).To(Equal(serv.Addr()))
+		}
+		Expect(ln.Close()).To(Succeed())
+		Eventually(phm.listening).Should(BeClosed())
+	})
+
+	It("uses a single socket when listening with SO_REUSEPORT on a single socket", func() {
+		ln, err := ListenAddrReusePort("127.0.0.1:0", tlsConf, &Config{}, 1)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(ln.(*server).sessionHandler.(*packetHandlerMap).additionalConns).To(BeEmpty())
+		Expect(ln.Close()).To(Succeed())
+	})
+
+	It("closes the socket if listening fails", func() {
+		addr := "127.0.0.1:13580"
+		_, err := ListenAddr(addr, nil, &Config{})
+		Expect(err).To(HaveOccurred())
+		// the socket was closed, so the port can be used again
+		c, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 13580})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(c.Close()).To(Succeed())
+	})
+
+	It("closes the sockets if listening with SO_REUSEPORT fails", func() {
+		if !reusePortSupported {
+			Skip("SO_REUSEPORT not supported on this platform")
+		}
+		addr := "127.0.0.1:13581"
+		_, err := ListenAddrReusePort(addr, nil, &Config{}, 4)
+		Expect(err).To(HaveOccurred())
+		// Sockets bound with SO_REUSEPORT would prevent binding the port without it.
+		c, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 13581})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(c.Close()).To(Succeed())
+	})
+
 	It("errors if given an invalid address", func() {
 		addr := "127.0.0.1"
 		_, err := ListenAddr(addr, tlsConf, &Config{})
@@ -156,6 +323,7 @@ var _ = Describe("Server", func() {
 			}, make([]byte, protocol.MinInitialPacketSize-100),
 			))
 			Consistently(conn.dataWritten).ShouldNot(Receive())
+			Expect(serv.Stats().DroppedPackets).To(Equal(map[PacketDropReason]uint64{PacketDropUnexpectedPacket: 1}))
 		})
 
 		It("drops packets with a too short connection ID", func() {
@@ -179,6 +347,19 @@ var _ = Describe("Server", func() {
 			))
 		})
 
+		It("counts dropped long header packets with unknown connection IDs", func() {
+			serv.handlePacket(getPacket(
+				&wire.Header{
+					IsLongHeader:     true,
+					Type:             protocol.PacketTypeHandshake,
+					DestConnectionID: protocol.ConnectionID{1, 2, 3, 4, 5, 6, 7, 8},
+					Version:          serv.config.Versions[0],
+				},
+				make([]byte, protocol.MinInitialPacketSize),
+			))
+			Eventually(func() map[PacketDropReason]uint64 { return serv.Stats().DroppedPackets }).Should(Equal(map[PacketDropReason]uint64{PacketDropUnknownConnectionID: 1}))
+		})
+
 		It("decodes the cookie from the Token field", func() {
 			raddr := &net.UDPAddr{
 				IP:   net.IPv4(192, 168, 13, 37),
@@ -191,7 +372,7 @@ var _ = Describe("Server", func() {
 				close(done)
 				return false
 			}
-			token, err := serv.cookieGenerator.NewToken(raddr, nil)
+			token, err := serv.cookieGenerator.NewRetryToken(raddr, nil)
 			Expect(err).ToNot(HaveOccurred())
 			packet := getPacket(&wire.Header{
 				IsLongHeader: true,
@@ -247,6 +428,29 @@ var _ = Describe("Server", func() {
 			Expect(hdr.DestConnectionID).To(Equal(srcConnID))
 			Expect(hdr.SrcConnectionID).To(Equal(destConnID))
 			Expect(hdr.SupportedVersions).ToNot(ContainElement(protocol.VersionNumber(0x42)))
+			Eventually(func() map[PacketDropReason]uint64 { return serv.Stats().DroppedPackets }).Should(Equal(map[PacketDropReason]uint64{PacketDropUnsupportedVersion: 1}))
+		})
+
+		It("counts the Version Negotiation Packets it sends", func() {
+			metrics := &Metrics{}
+			serv.config.MetricsCollector = metrics
+			packet := getPacket(&wire.Header{
+				IsLongHeader:     true,
+				Type:             protocol.PacketTypeInitial,
+				SrcConnectionID:  protocol.ConnectionID{1, 2, 3, 4, 5},
+				DestConnectionID: protocol.ConnectionID{1, 2, 3, 4, 5, 6},
+				Version:          0x42,
+			}, make([]byte, protocol.MinInitialPacketSize))
+			serv.handlePacket(packet)
+			Eventually(conn.dataWritten).Should(Receive())
+			Eventually(func() uint64 { return metrics.Snapshot().VersionNegotiations }).Should(BeEquivalentTo(1))
+		})
+
+		It("counts the stateless resets it sends", func() {
+			metrics := &Metrics{}
+			serv.config.MetricsCollector = metrics
+			serv.sentStatelessReset()
+			Expect(metrics.Snapshot().StatelessResetsSent).To(BeEquivalentTo(1))
 		})
 
 		It("replies with a Retry packet, if a Cookie is required", func() {
@@ -272,6 +476,26 @@ var _ = Describe("Server", func() {
 			Expect(replyHdr.Token).ToNot(BeEmpty())
 		})
 
+		It("replies on the socket that the packet was received on", func() {
+			serv.config.AcceptCookie = func(_ net.Addr, _ *Cookie) bool { return false }
+			hdr := &wire.Header{
+				IsLongHeader:     true,
+				Type:             protocol.PacketTypeInitial,
+				SrcConnectionID:  protocol.ConnectionID{5, 4, 3, 2, 1},
+				DestConnectionID: protocol.ConnectionID{1, 2, 3, 4, 5, 6, 7, 8, 9, 10},
+				Version:          protocol.VersionTLS,
+			}
+			packet := getPacket(hdr, make([]byte, protocol.MinInitialPacketSize))
+			packet.remoteAddr = &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 1337}
+			conn2 := newMockPacketConn()
+			packet.conn = conn2
+			serv.handlePacket(packet)
+			var write mockPacketConnWrite
+			Eventually(conn2.dataWritten).Should(Receive(&write))
+			Expect(parseHeader(write.data).Type).To(Equal(protocol.PacketTypeRetry))
+			Expect(conn.dataWritten).ToNot(Receive())
+		})
+
 		It("creates a session, if no Cookie is required", func() {
 			serv.config.AcceptCookie = func(_ net.Addr, _ *Cookie) bool { return true }
 			hdr := &wire.Header{
@@ -319,6 +543,408 @@ var _ = Describe("Server", func() {
 			Eventually(done).Should(BeClosed())
 		})
 
+		It("uses the ConnectionIDGenerator for the Retry and the session", func() {
+			serv.config.ConnectionIDGenerator = &serverIDConnectionIDGenerator{serverID: [2]byte{0xca, 0xfe}, connIDLen: 8}
+			serv.config.AcceptCookie = func(_ net.Addr, _ *Cookie) bool { return false }
+			hdr := &wire.Header{
+				IsLongHeader:     true,
+				Type:             protocol.PacketTypeInitial,
+				SrcConnectionID:  protocol.ConnectionID{5, 4, 3, 2, 1},
+				DestConnectionID: protocol.ConnectionID{1, 2, 3, 4, 5, 6, 7, 8, 9, 10},
+				Version:          protocol.VersionTLS,
+			}
+			packet := getPacket(hdr, make([]byte, protocol.MinInitialPacketSize))
+			packet.remoteAddr = &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 1337}
+			serv.handlePacket(packet)
+			var write mockPacketConnWrite
+			Eventually(conn.dataWritten).Should(Receive(&write))
+			replyHdr := parseHeader(write.data)
+			Expect(replyHdr.Type).To(Equal(protocol.PacketTypeRetry))
+			Expect(replyHdr.SrcConnectionID).To(HaveLen(8))
+			Expect(replyHdr.SrcConnectionID[:2]).To(Equal(protocol.ConnectionID{0xca, 0xfe}))
+
+			serv.config.AcceptCookie = func(_ net.Addr, _ *Cookie) bool { return true }
+			p := getPacket(hdr, make([]byte, protocol.MinInitialPacketSize))
+			run := make(chan struct{})
+			serv.newSession = func(
+				_ connection,
+				_ sessionRunner,
+				_ protocol.ConnectionID,
+				_ protocol.ConnectionID,
+				srcConnID protocol.ConnectionID,
+				_ *Config,
+				_ *tls.Config,
+				_ *handshake.TransportParameters,
+				_ utils.Logger,
+				_ protocol.VersionNumber,
+			) (quicSession, error) {
+				Expect(srcConnID).To(HaveLen(8))
+				Expect(srcConnID[:2]).To(Equal(protocol.ConnectionID{0xca, 0xfe}))
+				sess := NewMockQuicSession(mockCtrl)
+				sess.EXPECT().handlePacket(p)
+				sess.EXPECT().run().Do(func() { close(run) })
+				return sess, nil
+			}
+			serv.handlePacket(p)
+			Eventually(run).Should(BeClosed())
+		})
+
+		It("serves clients without a Retry if the server is not under load", func() {
+			serv.config.AcceptCookie = func(_ net.Addr, _ *Cookie) bool { return false }
+			serv.adaptiveRetry = newAdaptiveRetry(1, 0)
+			hdr := &wire.Header{
+				IsLongHeader:     true,
+				Type:             protocol.PacketTypeInitial,
+				SrcConnectionID:  protocol.ConnectionID{5, 4, 3, 2, 1},
+				DestConnectionID: protocol.ConnectionID{1, 2, 3, 4, 5, 6, 7, 8, 9, 10},
+				Version:          protocol.VersionTLS,
+			}
+			run := make(chan struct{})
+			started := make(chan struct{}, 2)
+			serv.newSession = func(
+				_ connection,
+				_ sessionRunner,
+				_ protocol.ConnectionID,
+				_ protocol.ConnectionID,
+				_ protocol.ConnectionID,
+				_ *Config,
+				_ *tls.Config,
+				_ *handshake.TransportParameters,
+				_ utils.Logger,
+				_ protocol.VersionNumber,
+			) (quicSession, error) {
+				sess := NewMockQuicSession(mockCtrl)
+				sess.EXPECT().handlePacket(gomock.Any())
+				sess.EXPECT().run().Do(func() {
+					started <- struct{}{}
+					<-run
+				})
+				return sess, nil
+			}
+			defer close(run)
+			// The first two sessions are created without a Retry.
+			for i := 0; i < 2; i++ {
+				p := getPacket(hdr, make([]byte, protocol.MinInitialPacketSize))
+				sess, _, err := serv.handleInitialImpl(p, hdr)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(sess).ToNot(BeNil())
+			}
+			Expect(serv.Stats().HandshakingSessions).To(Equal(2))
+			Expect(serv.Stats().RetryActive).To(BeFalse())
+			// Now the server is under load, and sends a Retry.
+			p := getPacket(hdr, make([]byte, protocol.MinInitialPacketSize))
+			p.remoteAddr = &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 1337}
+			sess, _, err := serv.handleInitialImpl(p, hdr)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(sess).To(BeNil())
+			var write mockPacketConnWrite
+			Eventually(conn.dataWritten).Should(Receive(&write))
+			Expect(parseHeader(write.data).Type).To(Equal(protocol.PacketTypeRetry))
+			Expect(serv.Stats().RetryActive).To(BeTrue())
+			Eventually(started).Should(HaveLen(2))
+		})
+
+		Context("address validation tokens", func() {
+			var (
+				raddr             *net.UDPAddr
+				current, previous [32]byte
+			)
+
+			newToken := func(addr net.Addr) []byte {
+				token, err := serv.cookieGenerator.NewToken(addr)
+				Expect(err).ToNot(HaveOccurred())
+				return token
+			}
+
+			BeforeEach(func() {
+				raddr = &net.UDPAddr{IP: net.IPv4(192, 168, 13, 37), Port: 1337}
+				current, previous = [32]byte{1, 2, 3}, [32]byte{}
+				var err error
+				serv.cookieGenerator, err = handshake.NewCookieGenerator(func() ([32]byte, [32]byte) { return current, previous })
+				Expect(err).ToNot(HaveOccurred())
+				serv.config.AcceptCookie = func(net.Addr, *Cookie) bool {
+					Fail("didn't expect AcceptCookie to be called")
+					return false
+				}
+			})
+
+			expectSession := func(token []byte) {
+				hdr := &wire.Header{
+					IsLongHeader:     true,
+					Type:             protocol.PacketTypeInitial,
+					SrcConnectionID:  protocol.ConnectionID{5, 4, 3, 2, 1},
+					DestConnectionID: protocol.ConnectionID{1, 2, 3, 4, 5, 6, 7, 8, 9, 10},
+					Token:            token,
+					Version:          protocol.VersionTLS,
+				}
+				p := getPacket(hdr, make([]byte, protocol.MinInitialPacketSize))
+				p.remoteAddr = raddr
+				run := make(chan struct{})
+				serv.newSession = func(
+					_ connection,
+					_ sessionRunner,
+					_ protocol.ConnectionID,
+					_ protocol.ConnectionID,
+					_ protocol.ConnectionID,
+					_ *Config,
+					_ *tls.Config,
+					_ *handshake.TransportParameters,
+					_ utils.Logger,
+					_ protocol.VersionNumber,
+				) (quicSession, error) {
+					sess := NewMockQuicSession(mockCtrl)
+					sess.EXPECT().handlePacket(p)
+					sess.EXPECT().run().Do(func() { close(run) })
+					return sess, nil
+				}
+				serv.handlePacket(p)
+				Eventually(run).Should(BeClosed())
+				Consistently(conn.dataWritten).ShouldNot(Receive())
+			}
+
+			It("creates a session without sending a Retry, if the token is valid", func() {
+				expectSession(newToken(raddr))
+			})
+
+			It("creates a session without sending a Retry, if the client uses a different address in the same network", func() {
+				token := newToken(&net.UDPAddr{IP: net.IPv4(192, 168, 13, 38), Port: 4242})
+				expectSession(token)
+			})
+
+			It("accepts tokens issued before the key was rotated", func() {
+				token := newToken(raddr)
+				current, previous = [32]byte{4, 5, 6}, current
+				expectSession(token)
+			})
+
+			It("replies with a Retry packet, if the token is invalid", func() {
+				token := newToken(&net.UDPAddr{IP: net.IPv4(192, 168, 14, 37), Port: 1337})
+				p := getPacket(&wire.Header{
+					IsLongHeader:     true,
+					Type:             protocol.PacketTypeInitial,
+					SrcConnectionID:  protocol.ConnectionID{5, 4, 3, 2, 1},
+					DestConnectionID: protocol.ConnectionID{1, 2, 3, 4, 5, 6, 7, 8, 9, 10},
+					Token:            token,
+					Version:          protocol.VersionTLS,
+				}, make([]byte, protocol.MinInitialPacketSize))
+				p.remoteAddr = raddr
+				serv.handlePacket(p)
+				var write mockPacketConnWrite
+				Eventually(conn.dataWritten).Should(Receive(&write))
+				Expect(parseHeader(write.data).Type).To(Equal(protocol.PacketTypeRetry))
+			})
+		})
+
+		Context("verifying the source address", func() {
+			var (
+				raddr *net.UDPAddr
+				hdr   *wire.Header
+			)
+
+			BeforeEach(func() {
+				raddr = &net.UDPAddr{IP: net.IPv4(192, 168, 13, 37), Port: 1337}
+				hdr = &wire.Header{
+					IsLongHeader:     true,
+					Type:             protocol.PacketTypeInitial,
+					SrcConnectionID:  protocol.ConnectionID{5, 4, 3, 2, 1},
+					DestConnectionID: protocol.ConnectionID{1, 2, 3, 4, 5, 6, 7, 8, 9, 10},
+					Version:          protocol.VersionTLS,
+				}
+			})
+
+			expectSession := func(p *receivedPacket) chan struct{} {
+				run := make(chan struct{})
+				serv.newSession = func(
+					_ connection,
+					_ sessionRunner,
+					_ protocol.ConnectionID,
+					_ protocol.ConnectionID,
+					_ protocol.ConnectionID,
+					_ *Config,
+					_ *tls.Config,
+					_ *handshake.TransportParameters,
+					_ utils.Logger,
+					_ protocol.VersionNumber,
+				) (quicSession, error) {
+					sess := NewMockQuicSession(mockCtrl)
+					sess.EXPECT().handlePacket(p)
+					sess.EXPECT().run().Do(func() { close(run) })
+					return sess, nil
+				}
+				return run
+			}
+
+			It("passes the cookie to the callback", func() {
+				token, err := serv.cookieGenerator.NewRetryToken(raddr, nil)
+				Expect(err).ToNot(HaveOccurred())
+				hdr.Token = token
+				done := make(chan struct{})
+				serv.config.VerifySourceAddress = func(addr net.Addr, cookie *Cookie) Decision {
+					Expect(addr).To(Equal(raddr))
+					Expect(cookie).ToNot(BeNil())
+					Expect(cookie.RemoteAddr).To(Equal("192.168.13.37"))
+					close(done)
+					return DecisionDrop
+				}
+				p := getPacket(hdr, make([]byte, protocol.MinInitialPacketSize))
+				p.remoteAddr = raddr
+				serv.handlePacket(p)
+				Eventually(done).Should(BeClosed())
+			})
+
+			It("drops packets", func() {
+				serv.config.VerifySourceAddress = func(net.Addr, *Cookie) Decision { return DecisionDrop }
+				p := getPacket(hdr, make([]byte, protocol.MinInitialPacketSize))
+				p.remoteAddr = raddr
+				serv.handlePacket(p)
+				Eventually(func() uint64 { return serv.Stats().RejectedInitials }).Should(BeEquivalentTo(1))
+				Consistently(conn.dataWritten).ShouldNot(Receive())
+			})
+
+			It("rejects connection attempts", func() {
+				serv.config.VerifySourceAddress = func(net.Addr, *Cookie) Decision { return DecisionReject }
+				p := getPacket(hdr, make([]byte, protocol.MinInitialPacketSize))
+				p.remoteAddr = raddr
+				serv.handlePacket(p)
+				var reject mockPacketConnWrite
+				Eventually(conn.dataWritten).Should(Receive(&reject))
+				Expect(reject.to).To(Equal(raddr))
+				rejectHdr := parseHeader(reject.data)
+				Expect(rejectHdr.Type).To(Equal(protocol.PacketTypeInitial))
+				Expect(rejectHdr.DestConnectionID).To(Equal(hdr.SrcConnectionID))
+				Expect(rejectHdr.SrcConnectionID).To(Equal(hdr.DestConnectionID))
+				Expect(serv.Stats().RejectedInitials).To(BeEquivalentTo(1))
+			})
+
+			It("accepts connection attempts without validating the address", func() {
+				serv.config.AcceptCookie = func(net.Addr, *Cookie) bool { return false }
+				serv.config.VerifySourceAddress = func(net.Addr, *Cookie) Decision { return DecisionAccept }
+				p := getPacket(hdr, make([]byte, protocol.MinInitialPacketSize))
+				p.remoteAddr = raddr
+				run := expectSession(p)
+				serv.handlePacket(p)
+				Eventually(run).Should(BeClosed())
+				Consistently(conn.dataWritten).ShouldNot(Receive())
+			})
+
+			It("sends a Retry if validation is required", func() {
+				serv.config.AcceptCookie = func(net.Addr, *Cookie) bool { return false }
+				serv.config.VerifySourceAddress = func(net.Addr, *Cookie) Decision { return DecisionRequireValidation }
+				p := getPacket(hdr, make([]byte, protocol.MinInitialPacketSize))
+				p.remoteAddr = raddr
+				serv.handlePacket(p)
+				var write mockPacketConnWrite
+				Eventually(conn.dataWritten).Should(Receive(&write))
+				Expect(parseHeader(write.data).Type).To(Equal(protocol.PacketTypeRetry))
+			})
+
+			It("doesn't send a Retry if validation is required, but the address was already validated", func() {
+				serv.config.AcceptCookie = func(net.Addr, *Cookie) bool { return true }
+				serv.config.VerifySourceAddress = func(net.Addr, *Cookie) Decision { return DecisionRequireValidation }
+				p := getPacket(hdr, make([]byte, protocol.MinInitialPacketSize))
+				p.remoteAddr = raddr
+				run := expectSession(p)
+				serv.handlePacket(p)
+				Eventually(run).Should(BeClosed())
+				Consistently(conn.dataWritten).ShouldNot(Receive())
+			})
+		})
+
+		It("rate limits Initial packets that start a new handshake", func() {
+			serv.config.AcceptCookie = func(_ net.Addr, _ *Cookie) bool { return true }
+			serv.initialLimiter = rate.NewLimiter(100, 100)
+			var numSessions int32
+			serv.newSession = func(
+				_ connection,
+				_ sessionRunner,
+				_ protocol.ConnectionID,
+				_ protocol.ConnectionID,
+				_ protocol.ConnectionID,
+				_ *Config,
+				_ *tls.Config,
+				_ *handshake.TransportParameters,
+				_ utils.Logger,
+				_ protocol.VersionNumber,
+			) (quicSession, error) {
+				atomic.AddInt32(&numSessions, 1)
+				sess := NewMockQuicSession(mockCtrl)
+				sess.EXPECT().handlePacket(gomock.Any())
+				sess.EXPECT().run().AnyTimes()
+				return sess, nil
+			}
+			hdr := &wire.Header{
+				IsLongHeader:     true,
+				Type:             protocol.PacketTypeInitial,
+				SrcConnectionID:  protocol.ConnectionID{5, 4, 3, 2, 1},
+				DestConnectionID: protocol.ConnectionID{1, 2, 3, 4, 5, 6, 7, 8, 9, 10},
+				Version:          protocol.VersionTLS,
+			}
+			// Send 10000 Initial packets at a rate of roughly 10000 packets per second.
+			// The number of handshakes started (and with that, the CPU spent on the handshake)
+			// must be bounded by the rate limit, not by the number of packets.
+			const num = 10000
+			start := time.Now()
+			for i := 0; i < num; i++ {
+				p := getPacket(hdr, make([]byte, protocol.MinInitialPacketSize))
+				p.remoteAddr = &net.UDPAddr{IP: net.IPv4(192, 168, 0, byte(i)), Port: i}
+				_, _, err := serv.handleInitialImpl(p, hdr)
+				Expect(err).ToNot(HaveOccurred())
+				if i%100 == 99 {
+					time.Sleep(10 * time.Millisecond)
+				}
+			}
+			maxSessions := 100 + int32(time.Since(start).Seconds()*100) + 1
+			Expect(atomic.LoadInt32(&numSessions)).To(BeNumerically("<=", maxSessions))
+			Expect(serv.Stats().DroppedInitials).To(BeEquivalentTo(num - atomic.LoadInt32(&numSessions)))
+		})
+
+		It("drops Initial packets from IP addresses exceeding their budget", func() {
+			serv.config.AcceptCookie = func(_ net.Addr, _ *Cookie) bool { return true }
+			sessions := make(map[string]int)
+			serv.newSession = func(
+				conn connection,
+				_ sessionRunner,
+				_ protocol.ConnectionID,
+				_ protocol.ConnectionID,
+				_ protocol.ConnectionID,
+				_ *Config,
+				_ *tls.Config,
+				_ *handshake.TransportParameters,
+				_ utils.Logger,
+				_ protocol.VersionNumber,
+			) (quicSession, error) {
+				sessions[conn.RemoteAddr().(*net.UDPAddr).IP.String()]++
+				sess := NewMockQuicSession(mockCtrl)
+				sess.EXPECT().handlePacket(gomock.Any())
+				sess.EXPECT().run().AnyTimes()
+				return sess, nil
+			}
+			hdr := &wire.Header{
+				IsLongHeader:     true,
+				Type:             protocol.PacketTypeInitial,
+				SrcConnectionID:  protocol.ConnectionID{5, 4, 3, 2, 1},
+				DestConnectionID: protocol.ConnectionID{1, 2, 3, 4, 5, 6, 7, 8, 9, 10},
+				Version:          protocol.VersionTLS,
+			}
+			now := time.Now()
+			const num = 10000
+			for i := 0; i < num; i++ {
+				p := getPacket(hdr, make([]byte, protocol.MinInitialPacketSize))
+				p.remoteAddr = &net.UDPAddr{IP: net.IPv4(192, 168, 0, 1), Port: i}
+				p.rcvTime = now
+				serv.handlePacketImpl(p)
+			}
+			p := getPacket(hdr, make([]byte, protocol.MinInitialPacketSize))
+			p.remoteAddr = &net.UDPAddr{IP: net.IPv4(192, 168, 0, 2), Port: 1337}
+			p.rcvTime = now
+			Expect(serv.handlePacketImpl(p)).To(BeTrue())
+			Expect(sessions).To(Equal(map[string]int{
+				"192.168.0.1": protocol.DefaultMaxInitialsPerIPPerInterval,
+				"192.168.0.2": 1,
+			}))
+			Expect(serv.Stats().OverBudgetInitials).To(BeEquivalentTo(num - protocol.DefaultMaxInitialsPerIPPerInterval))
+		})
+
 		It("rejects new connection attempts if the accept queue is full", func() {
 			serv.config.AcceptCookie = func(_ net.Addr, _ *Cookie) bool { return true }
 			senderAddr := &net.UDPAddr{IP: net.IPv4(1, 2, 3, 4), Port: 42}
@@ -353,8 +979,8 @@ var _ = Describe("Server", func() {
 			}
 
 			var wg sync.WaitGroup
-			wg.Add(protocol.MaxAcceptQueueSize)
-			for i := 0; i < protocol.MaxAcceptQueueSize; i++ {
+			wg.Add(protocol.DefaultAcceptQueueLength)
+			for i := 0; i < protocol.DefaultAcceptQueueLength; i++ {
 				go func() {
 					defer GinkgoRecover()
 					defer wg.Done()
@@ -372,6 +998,39 @@ var _ = Describe("Server", func() {
 			Expect(rejectHdr.Version).To(Equal(hdr.Version))
 			Expect(rejectHdr.DestConnectionID).To(Equal(hdr.SrcConnectionID))
 			Expect(rejectHdr.SrcConnectionID).To(Equal(hdr.DestConnectionID))
+			Expect(serv.Stats().RefusedSessions).To(BeEquivalentTo(1))
+		})
+
+		It("refuses sessions that complete the handshake when the accept queue is full", func() {
+			serv.config.AcceptQueueLength = 3
+			for i := 0; i < 3; i++ {
+				sess := NewMockQuicSession(mockCtrl)
+				sess.EXPECT().Context().Return(context.Background()).AnyTimes()
+				serv.sessionRunner.OnHandshakeComplete(sess)
+			}
+			sess := NewMockQuicSession(mockCtrl)
+			sess.EXPECT().closeLocal(gomock.Any()).Do(func(e error) {
+				Expect(e).To(BeAssignableToTypeOf(&qerr.QuicError{}))
+				Expect(e.(*qerr.QuicError).ErrorCode).To(Equal(qerr.ServerBusy))
+			})
+			serv.sessionRunner.OnHandshakeComplete(sess)
+			Expect(serv.Stats().RefusedSessions).To(BeEquivalentTo(1))
+			Expect(atomic.LoadInt32(&serv.sessionQueueLen)).To(BeEquivalentTo(3))
+		})
+
+		It("doesn't grow without bounds if sessions are never accepted", func() {
+			serv.config.AcceptQueueLength = 10
+			numGoroutines := runtime.NumGoroutine()
+			for i := 0; i < 1000; i++ {
+				sess := NewMockQuicSession(mockCtrl)
+				sess.EXPECT().Context().Return(context.Background()).AnyTimes()
+				sess.EXPECT().closeLocal(gomock.Any()).AnyTimes()
+				serv.sessionRunner.OnHandshakeComplete(sess)
+			}
+			Expect(atomic.LoadInt32(&serv.sessionQueueLen)).To(BeEquivalentTo(10))
+			Expect(serv.Stats().RefusedSessions).To(BeEquivalentTo(990))
+			// Every queued session uses one Go routine.
+			Expect(runtime.NumGoroutine()).To(BeNumerically("<=", numGoroutines+10))
 		})
 
 		It("doesn't accept new sessions if they were closed in the mean time", func() {
@@ -425,7 +1084,6 @@ var _ = Describe("Server", func() {
 			Consistently(done).ShouldNot(BeClosed())
 
 			// make the go routine return
-			sess.EXPECT().getPerspective()
 			Expect(serv.Close()).To(Succeed())
 			Eventually(done).Should(BeClosed())
 		})
@@ -497,15 +1155,83 @@ var _ = Describe("Server", func() {
 				sess.EXPECT().Context().Return(context.Background())
 				return sess, nil
 			}
-			_, err := serv.createNewSession(&net.UDPAddr{}, nil, nil, nil, nil, protocol.VersionWhatever)
+			_, err := serv.createNewSession(nil, nil, nil, nil, nil, protocol.VersionWhatever)
 			Expect(err).ToNot(HaveOccurred())
 			Consistently(done).ShouldNot(BeClosed())
 			close(completeHandshake)
 			Eventually(done).Should(BeClosed())
 		})
 
+		It("accepts new sessions together with the negotiated application protocol", func() {
+			sess := NewMockQuicSession(mockCtrl)
+			sess.EXPECT().ConnectionState().Return(tls.ConnectionState{NegotiatedProtocol: "proto1"})
+
+			done := make(chan struct{})
+			go func() {
+				defer GinkgoRecover()
+				s, proto, err := serv.AcceptWithProtocol()
+				Expect(err).ToNot(HaveOccurred())
+				Expect(s).To(Equal(sess))
+				Expect(proto).To(Equal("proto1"))
+				close(done)
+			}()
+
+			serv.newSession = func(
+				_ connection,
+				runner sessionRunner,
+				_ protocol.ConnectionID,
+				_ protocol.ConnectionID,
+				_ protocol.ConnectionID,
+				_ *Config,
+				_ *tls.Config,
+				_ *handshake.TransportParameters,
+				_ utils.Logger,
+				_ protocol.VersionNumber,
+			) (quicSession, error) {
+				go runner.OnHandshakeComplete(sess)
+				sess.EXPECT().run().Do(func() {})
+				sess.EXPECT().Context().Return(context.Background())
+				return sess, nil
+			}
+			_, err := serv.createNewSession(nil, nil, nil, nil, nil, protocol.VersionWhatever)
+			Expect(err).ToNot(HaveOccurred())
+			Eventually(done).Should(BeClosed())
+		})
+
+		It("doesn't run sessions created after the server was closed", func() {
+			sess := NewMockQuicSession(mockCtrl)
+			serv.newSession = func(
+				_ connection,
+				_ sessionRunner,
+				_ protocol.ConnectionID,
+				_ protocol.ConnectionID,
+				_ protocol.ConnectionID,
+				_ *Config,
+				_ *tls.Config,
+				_ *handshake.TransportParameters,
+				_ utils.Logger,
+				_ protocol.VersionNumber,
+			) (quicSession, error) {
+				// Close the server while the session is being created.
+				Expect(serv.Close()).To(Succeed())
+				return sess, nil
+			}
+			s, err := serv.createNewSession(nil, nil, nil, nil, nil, protocol.VersionWhatever)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(s).To(BeNil())
+			Expect(serv.ActiveConnections()).To(BeZero())
+		})
+
+		It("returns AcceptWithProtocol when an error occurs", func() {
+			testErr := errors.New("test err")
+			Expect(serv.closeWithError(testErr)).To(Succeed())
+			_, _, err := serv.AcceptWithProtocol()
+			Expect(err).To(MatchError(testErr))
+		})
+
 		It("never blocks when calling the onHandshakeComplete callback", func() {
 			const num = 50
+			serv.config.AcceptQueueLength = num
 
 			runs := make(chan struct{}, num)
 			contexts := make(chan struct{}, num)
@@ -530,64 +1256,447 @@ var _ = Describe("Server", func() {
 
 			go func() {
 				for i := 0; i < num; i++ {
-					_, err := serv.createNewSession(&net.UDPAddr{}, nil, nil, nil, nil, protocol.VersionWhatever)
+					_, err := serv.createNewSession(nil, nil, nil, nil, nil, protocol.VersionWhatever)
 					Expect(err).ToNot(HaveOccurred())
 				}
 			}()
 			Eventually(runs).Should(HaveLen(num))
 			Eventually(contexts).Should(HaveLen(num))
 		})
+
+		Context("accepting sessions early", func() {
+			It("accepts sessions before the handshake completes", func() {
+				sess := NewMockQuicSession(mockCtrl)
+				sess.EXPECT().HandshakeComplete().Return(context.Background()).AnyTimes()
+				serv.addSession(sess)
+				serv.sessionRunner.OnEarlySessionReady(sess)
+				ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+				defer cancel()
+				s, err := serv.AcceptEarly(ctx)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(s).To(Equal(sess))
+				// the session is not queued again when the handshake completes
+				serv.sessionRunner.OnHandshakeComplete(sess)
+				Expect(atomic.LoadInt32(&serv.sessionQueueLen)).To(BeZero())
+			})
+
+			It("returns sessions that completed the handshake", func() {
+				sess := NewMockQuicSession(mockCtrl)
+				sess.EXPECT().Context().Return(context.Background())
+				serv.addSession(sess)
+				serv.sessionRunner.OnHandshakeComplete(sess)
+				ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+				defer cancel()
+				s, err := serv.AcceptEarly(ctx)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(s).To(Equal(sess))
+			})
+
+			It("doesn't return a session from Accept that was accepted early", func() {
+				handshakeCtx, handshakeCancel := context.WithCancel(context.Background())
+				sess1 := NewMockQuicSession(mockCtrl)
+				sess1.EXPECT().HandshakeComplete().Return(handshakeCtx).AnyTimes()
+				sess1.EXPECT().Context().Return(context.Background()).AnyTimes()
+				serv.addSession(sess1)
+				serv.sessionRunner.OnEarlySessionReady(sess1)
+				serv.sessionRunner.OnHandshakeComplete(sess1)
+				handshakeCancel()
+				ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+				defer cancel()
+				s, err := serv.AcceptEarly(ctx)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(s).To(Equal(sess1))
+
+				sess2 := NewMockQuicSession(mockCtrl)
+				sess2.EXPECT().Context().Return(context.Background())
+				serv.addSession(sess2)
+				serv.sessionRunner.OnHandshakeComplete(sess2)
+				s2, err := serv.Accept()
+				Expect(err).ToNot(HaveOccurred())
+				Expect(s2).To(Equal(sess2))
+			})
+
+			It("returns when the context is canceled", func() {
+				ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+				defer cancel()
+				_, err := serv.AcceptEarly(ctx)
+				Expect(err).To(MatchError(context.DeadlineExceeded))
+			})
+
+			It("returns when the server is closed", func() {
+				testErr := errors.New("test err")
+				Expect(serv.closeWithError(testErr)).To(Succeed())
+				_, err := serv.AcceptEarly(context.Background())
+				Expect(err).To(MatchError(testErr))
+			})
+		})
+	})
+
+	Context("closing", func() {
+		var (
+			serv   *server
+			phm    *MockPacketHandlerManager
+			closed chan struct{}
+		)
+
+		// newSession creates a session that runs until it is closed.
+		// The error that the session is closed with is sent on the returned channel.
+		newSession := func() (*MockQuicSession, <-chan error) {
+			sessChan := make(chan *MockQuicSession, 1)
+			closeErr := make(chan error, 1)
+			serv.newSession = func(
+				_ connection,
+				_ sessionRunner,
+				_ protocol.ConnectionID,
+				_ protocol.ConnectionID,
+				_ protocol.ConnectionID,
+				_ *Config,
+				_ *tls.Config,
+				_ *handshake.TransportParameters,
+				_ utils.Logger,
+				_ protocol.VersionNumber,
+			) (quicSession, error) {
+				sess := NewMockQuicSession(mockCtrl)
+				done := make(chan struct{})
+				sess.EXPECT().run().Do(func() { <-done })
+				sess.EXPECT().closeLocal(gomock.Any()).Do(func(e error) {
+					closeErr <- e
+					close(done)
+				}).MaxTimes(1)
+				sess.EXPECT().Close().Do(func() {
+					closeErr <- nil
+					close(done)
+				}).MaxTimes(1)
+				sessChan <- sess
+				return sess, nil
+			}
+			_, err := serv.createNewSession(nil, nil, nil, nil, nil, protocol.VersionWhatever)
+			Expect(err).ToNot(HaveOccurred())
+			return <-sessChan, closeErr
+		}
+
+		// accept passes the session to Accept
+		accept := func(sess quicSession) {
+			go func() { serv.sessionQueue <- sess }()
+			s, err := serv.Accept()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(s).To(Equal(sess))
+		}
+
+		BeforeEach(func() {
+			ln, err := Listen(conn, tlsConf, nil)
+			Expect(err).ToNot(HaveOccurred())
+			serv = ln.(*server)
+			serv.createdPacketConn = true
+			phm = NewMockPacketHandlerManager(mockCtrl)
+			serv.sessionHandler.CloseServer()
+			serv.sessionHandler = phm
+			closed = make(chan struct{})
+			phm.EXPECT().GetStatelessResetToken(gomock.Any()).AnyTimes()
+			phm.EXPECT().CloseServer().MaxTimes(1)
+			phm.EXPECT().Close().Do(func() { close(closed) }).MaxTimes(1)
+		})
+
+		It("closes the conn immediately if there are no sessions", func() {
+			Expect(serv.Close()).To(Succeed())
+			Expect(closed).To(BeClosed())
+			_, err := serv.Accept()
+			Expect(err).To(MatchError("server closed"))
+		})
+
+		It("keeps accepted sessions running, and closes the conn when they are closed", func() {
+			sess, _ := newSession()
+			accept(sess)
+			Expect(serv.Close()).To(Succeed())
+			_, err := serv.Accept()
+			Expect(err).To(MatchError("server closed"))
+			Consistently(closed).ShouldNot(BeClosed())
+			// the application closes the session
+			sess.Close()
+			Eventually(closed).Should(BeClosed())
+		})
+
+		It("refuses sessions that were not accepted", func() {
+			accepted, acceptedCloseErr := newSession()
+			accept(accepted)
+			_, refused := newSession()
+			Expect(serv.Close()).To(Succeed())
+			var err error
+			Eventually(refused).Should(Receive(&err))
+			Expect(err.(*qerr.QuicError).ErrorCode).To(Equal(qerr.ServerBusy))
+			// the accepted session is not closed
+			Consistently(closed).ShouldNot(BeClosed())
+			Expect(acceptedCloseErr).ToNot(Receive())
+			accepted.Close()
+			Eventually(closed).Should(BeClosed())
+		})
+
+		It("doesn't close the conn if the server was started with Listen", func() {
+			serv.createdPacketConn = false
+			sess, _ := newSession()
+			accept(sess)
+			Expect(serv.Close()).To(Succeed())
+			sess.Close()
+			Eventually(serv.drained).Should(BeClosed())
+		})
+
+		It("waits for the sessions to be closed when shutting down", func() {
+			sess, _ := newSession()
+			accept(sess)
+			done := make(chan struct{})
+			go func() {
+				defer GinkgoRecover()
+				Expect(serv.Shutdown(context.Background())).To(Succeed())
+				close(done)
+			}()
+			Consistently(done).ShouldNot(BeClosed())
+			sess.Close()
+			Eventually(done).Should(BeClosed())
+			Expect(closed).To(BeClosed())
+		})
+
+		It("counts the active connections", func() {
+			Expect(serv.ActiveConnections()).To(BeZero())
+			sess1, _ := newSession()
+			accept(sess1)
+			sess2, _ := newSession()
+			accept(sess2)
+			Expect(serv.ActiveConnections()).To(Equal(2))
+			sess1.Close()
+			Eventually(serv.ActiveConnections).Should(Equal(1))
+			sess2.Close()
+			Eventually(serv.ActiveConnections).Should(BeZero())
+		})
+
+		It("closes the remaining sessions when the context of Shutdown is canceled", func() {
+			sess1, closeErr1 := newSession()
+			accept(sess1)
+			sess2, closeErr2 := newSession()
+			accept(sess2)
+			ctx, cancel := context.WithTimeout(context.Background(), scaleDuration(20*time.Millisecond))
+			defer cancel()
+			Expect(serv.Shutdown(ctx)).To(MatchError(context.DeadlineExceeded))
+			Expect(closeErr1).To(Receive(BeNil()))
+			Expect(closeErr2).To(Receive(BeNil()))
+			Expect(closed).To(BeClosed())
+		})
+	})
+
+	Context("pruning idle sessions", func() {
+		var serv *server
+
+		// newIdleSession adds a running session that last received a packet at lastActivity
+		newIdleSession := func(lastActivity time.Time) *MockQuicSession {
+			sess := NewMockQuicSession(mockCtrl)
+			sess.EXPECT().lastActivityTime().Return(lastActivity).AnyTimes()
+			serv.addSession(sess)
+			serv.markAccepted(sess)
+			return sess
+		}
+
+		isIdleTimeoutError := func(e error) {
+			defer GinkgoRecover()
+			Expect(e).To(BeAssignableToTypeOf(&qerr.QuicError{}))
+			Expect(e.(*qerr.QuicError).ErrorCode).To(Equal(qerr.NoError))
+			Expect(e.(*qerr.QuicError).ErrorMessage).To(Equal("idle timeout"))
+		}
+
+		AfterEach(func() {
+			serv.mutex.Lock()
+			for sess := range serv.sessions {
+				delete(serv.sessions, sess)
+			}
+			serv.mutex.Unlock()
+			Expect(serv.Close()).To(Succeed())
+			Eventually(serv.drained).Should(BeClosed())
+		})
+
+		It("closes the least recently used sessions first", func() {
+			ln, err := Listen(conn, tlsConf, &Config{MaxIdleConnectionAge: time.Hour})
+			Expect(err).ToNot(HaveOccurred())
+			serv = ln.(*server)
+			now := time.Now()
+			newIdleSession(now.Add(-time.Minute)) // not idle for long enough
+			idle1 := newIdleSession(now.Add(-2 * time.Hour))
+			idle2 := newIdleSession(now.Add(-3 * time.Hour))
+			Expect(serv.ActiveConnections()).To(Equal(3))
+			gomock.InOrder(
+				idle2.EXPECT().closeLocal(gomock.Any()).Do(isIdleTimeoutError),
+				idle1.EXPECT().closeLocal(gomock.Any()).Do(isIdleTimeoutError),
+			)
+			serv.pruneIdleSessions(now)
+		})
+
+		It("periodically prunes idle sessions", func() {
+			ln, err := Listen(conn, tlsConf, &Config{MaxIdleConnectionAge: scaleDuration(20 * time.Millisecond)})
+			Expect(err).ToNot(HaveOccurred())
+			serv = ln.(*server)
+			sess := newIdleSession(time.Now().Add(-time.Hour))
+			closed := make(chan struct{})
+			sess.EXPECT().closeLocal(gomock.Any()).Do(func(e error) {
+				isIdleTimeoutError(e)
+				serv.removeSession(sess)
+				close(closed)
+			})
+			Eventually(closed).Should(BeClosed())
+			Expect(serv.ActiveConnections()).To(BeZero())
+		})
 	})
 })
 
 var _ = Describe("default source address verification", func() {
+	var (
+		now          time.Time
+		acceptCookie func(net.Addr, *Cookie) bool
+	)
+
+	BeforeEach(func() {
+		now = time.Now()
+		acceptCookie = newDefaultAcceptCookie(protocol.DefaultRetryTokenValidity, func() time.Time { return now })
+	})
+
 	It("accepts a token", func() {
 		remoteAddr := &net.UDPAddr{IP: net.IPv4(192, 168, 0, 1)}
 		cookie := &Cookie{
 			RemoteAddr: "192.168.0.1",
-			SentTime:   time.Now().Add(-protocol.CookieExpiryTime).Add(time.Second), // will expire in 1 second
+			SentTime:   now.Add(-protocol.DefaultRetryTokenValidity).Add(time.Second), // will expire in 1 second
 		}
-		Expect(defaultAcceptCookie(remoteAddr, cookie)).To(BeTrue())
+		Expect(acceptCookie(remoteAddr, cookie)).To(BeTrue())
 	})
 
 	It("requests verification if no token is provided", func() {
 		remoteAddr := &net.UDPAddr{IP: net.IPv4(192, 168, 0, 1)}
-		Expect(defaultAcceptCookie(remoteAddr, nil)).To(BeFalse())
+		Expect(acceptCookie(remoteAddr, nil)).To(BeFalse())
 	})
 
 	It("rejects a token if the address doesn't match", func() {
 		remoteAddr := &net.UDPAddr{IP: net.IPv4(192, 168, 0, 1)}
 		cookie := &Cookie{
 			RemoteAddr: "127.0.0.1",
-			SentTime:   time.Now(),
+			SentTime:   now,
 		}
-		Expect(defaultAcceptCookie(remoteAddr, cookie)).To(BeFalse())
+		Expect(acceptCookie(remoteAddr, cookie)).To(BeFalse())
 	})
 
 	It("accepts a token for a remote address is not a UDP address", func() {
 		remoteAddr := &net.TCPAddr{IP: net.IPv4(192, 168, 0, 1), Port: 1337}
 		cookie := &Cookie{
 			RemoteAddr: "192.168.0.1:1337",
-			SentTime:   time.Now(),
+			SentTime:   now,
 		}
-		Expect(defaultAcceptCookie(remoteAddr, cookie)).To(BeTrue())
+		Expect(acceptCookie(remoteAddr, cookie)).To(BeTrue())
 	})
 
 	It("rejects an invalid token for a remote address is not a UDP address", func() {
 		remoteAddr := &net.TCPAddr{IP: net.IPv4(192, 168, 0, 1), Port: 1337}
 		cookie := &Cookie{
 			RemoteAddr: "192.168.0.1:7331", // mismatching port
-			SentTime:   time.Now(),
+			SentTime:   now,
 		}
-		Expect(defaultAcceptCookie(remoteAddr, cookie)).To(BeFalse())
+		Expect(acceptCookie(remoteAddr, cookie)).To(BeFalse())
 	})
 
 	It("rejects an expired token", func() {
 		remoteAddr := &net.UDPAddr{IP: net.IPv4(192, 168, 0, 1)}
 		cookie := &Cookie{
 			RemoteAddr: "192.168.0.1",
-			SentTime:   time.Now().Add(-protocol.CookieExpiryTime).Add(-time.Second), // expired 1 second ago
+			SentTime:   now.Add(-protocol.DefaultRetryTokenValidity).Add(-time.Second), // expired 1 second ago
+		}
+		Expect(acceptCookie(remoteAddr, cookie)).To(BeFalse())
+	})
+
+	It("rejects a token issued by the cookie generator after the validity period", func() {
+		cookieGen, err := handshake.NewCookieGenerator(nil)
+		Expect(err).ToNot(HaveOccurred())
+		remoteAddr := &net.UDPAddr{IP: net.IPv4(192, 168, 0, 1), Port: 1337}
+		token, err := cookieGen.NewRetryToken(remoteAddr, protocol.ConnectionID{1, 2, 3, 4, 5, 6, 7, 8})
+		Expect(err).ToNot(HaveOccurred())
+		c, err := cookieGen.DecodeToken(token)
+		Expect(err).ToNot(HaveOccurred())
+		cookie := &Cookie{RemoteAddr: c.RemoteAddr, SentTime: c.SentTime}
+		Expect(acceptCookie(remoteAddr, cookie)).To(BeTrue())
+		now = now.Add(31 * time.Second)
+		Expect(acceptCookie(remoteAddr, cookie)).To(BeFalse())
+	})
+
+	It("uses the configured validity period", func() {
+		acceptCookie = newDefaultAcceptCookie(time.Minute, func() time.Time { return now })
+		remoteAddr := &net.UDPAddr{IP: net.IPv4(192, 168, 0, 1)}
+		cookie := &Cookie{
+			RemoteAddr: "192.168.0.1",
+			SentTime:   now.Add(-59 * time.Second),
 		}
-		Expect(defaultAcceptCookie(remoteAddr, cookie)).To(BeFalse())
+		Expect(acceptCookie(remoteAddr, cookie)).To(BeTrue())
+		now = now.Add(2 * time.Second)
+		Expect(acceptCookie(remoteAddr, cookie)).To(BeFalse())
+	})
+
+	It("accepts tokens issued slightly in the future", func() {
+		remoteAddr := &net.UDPAddr{IP: net.IPv4(192, 168, 0, 1)}
+		cookie := &Cookie{
+			RemoteAddr: "192.168.0.1",
+			SentTime:   now.Add(protocol.MaxTokenClockSkew).Add(-time.Second),
+		}
+		Expect(acceptCookie(remoteAddr, cookie)).To(BeTrue())
+	})
+
+	It("rejects tokens issued too far in the future", func() {
+		remoteAddr := &net.UDPAddr{IP: net.IPv4(192, 168, 0, 1)}
+		cookie := &Cookie{
+			RemoteAddr: "192.168.0.1",
+			SentTime:   now.Add(protocol.MaxTokenClockSkew).Add(time.Second),
+		}
+		Expect(acceptCookie(remoteAddr, cookie)).To(BeFalse())
+	})
+})
+
+var _ = Describe("validating tokens issued in NEW_TOKEN frames", func() {
+	var now time.Time
+
+	BeforeEach(func() {
+		now = time.Now()
+	})
+
+	It("accepts a token for an address in the same network", func() {
+		cookie := &Cookie{RemoteAddr: "192.168.13.0/24", SentTime: now.Add(-time.Hour)}
+		Expect(validateNewToken(&net.UDPAddr{IP: net.IPv4(192, 168, 13, 37)}, cookie, 24*time.Hour, now)).To(BeTrue())
+		Expect(validateNewToken(&net.UDPAddr{IP: net.IPv4(192, 168, 13, 1)}, cookie, 24*time.Hour, now)).To(BeTrue())
+	})
+
+	It("rejects a token for an address in a different network", func() {
+		cookie := &Cookie{RemoteAddr: "192.168.13.0/24", SentTime: now}
+		Expect(validateNewToken(&net.UDPAddr{IP: net.IPv4(192, 168, 14, 37)}, cookie, 24*time.Hour, now)).To(BeFalse())
+	})
+
+	It("accepts a token for an IPv6 address", func() {
+		cookie := &Cookie{RemoteAddr: "2001:db8:1:2::/64", SentTime: now}
+		Expect(validateNewToken(&net.UDPAddr{IP: net.ParseIP("2001:db8:1:2::42")}, cookie, 24*time.Hour, now)).To(BeTrue())
+		Expect(validateNewToken(&net.UDPAddr{IP: net.ParseIP("2001:db8:1:3::42")}, cookie, 24*time.Hour, now)).To(BeFalse())
+	})
+
+	It("rejects a token that doesn't contain a network", func() {
+		cookie := &Cookie{RemoteAddr: "192.168.13.37", SentTime: now}
+		Expect(validateNewToken(&net.UDPAddr{IP: net.IPv4(192, 168, 13, 37)}, cookie, 24*time.Hour, now)).To(BeFalse())
+	})
+
+	It("validates tokens for a remote address is not a UDP address", func() {
+		remoteAddr := &net.TCPAddr{IP: net.IPv4(192, 168, 0, 1), Port: 1337}
+		Expect(validateNewToken(remoteAddr, &Cookie{RemoteAddr: "192.168.0.1:1337", SentTime: now}, time.Hour, now)).To(BeTrue())
+		Expect(validateNewToken(remoteAddr, &Cookie{RemoteAddr: "192.168.0.1:1338", SentTime: now}, time.Hour, now)).To(BeFalse())
+	})
+
+	It("rejects expired tokens", func() {
+		remoteAddr := &net.UDPAddr{IP: net.IPv4(192, 168, 13, 37)}
+		cookie := &Cookie{RemoteAddr: "192.168.13.0/24", SentTime: now.Add(-time.Hour).Add(time.Second)}
+		Expect(validateNewToken(remoteAddr, cookie, time.Hour, now)).To(BeTrue())
+		Expect(validateNewToken(remoteAddr, cookie, time.Hour, now.Add(2*time.Second))).To(BeFalse())
+	})
+
+	It("rejects tokens issued too far in the future", func() {
+		remoteAddr := &net.UDPAddr{IP: net.IPv4(192, 168, 13, 37)}
+		cookie := &Cookie{RemoteAddr: "192.168.13.0/24", SentTime: now.Add(protocol.MaxTokenClockSkew).Add(-time.Second)}
+		Expect(validateNewToken(remoteAddr, cookie, time.Hour, now)).To(BeTrue())
+		cookie.SentTime = now.Add(protocol.MaxTokenClockSkew).Add(time.Second)
+		Expect(validateNewToken(remoteAddr, cookie, time.Hour, now)).To(BeFalse())
 	})
 })
@@ -4,11 +4,14 @@ import (
 	"bytes"
 	"context"
 	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
 	"net"
 	"reflect"
+	"runtime"
 	"sync"
 	"time"
 
@@ -34,6 +37,7 @@ type streamGetter interface {
 type streamManager interface {
 	GetOrOpenSendStream(protocol.StreamID) (sendStreamI, error)
 	GetOrOpenReceiveStream(protocol.StreamID) (receiveStreamI, error)
+	SendStreamState(protocol.StreamID) streamState
 	OpenStream() (Stream, error)
 	OpenUniStream() (SendStream, error)
 	OpenStreamSync() (Stream, error)
@@ -49,11 +53,15 @@ type streamManager interface {
 type cryptoStreamHandler interface {
 	RunHandshake() error
 	ChangeConnectionID(protocol.ConnectionID) error
+	DropInitialKeys()
+	DropHandshakeKeys()
 	io.Closer
 	ConnectionState() tls.ConnectionState
+	ExportKeyingMaterial(label string, context []byte, length int) ([]byte, error)
 }
 
 type receivedPacket struct {
+	conn       net.PacketConn // the socket the packet was received on
 	remoteAddr net.Addr
 	rcvTime    time.Time
 	data       []byte
@@ -63,6 +71,7 @@ type receivedPacket struct {
 
 func (p *receivedPacket) Clone() *receivedPacket {
 	return &receivedPacket{
+		conn:       p.conn,
 		remoteAddr: p.remoteAddr,
 		rcvTime:    p.rcvTime,
 		data:       p.data,
@@ -86,6 +95,12 @@ type session struct {
 	origDestConnID protocol.ConnectionID // if the server sends a Retry, this is the connection ID we used initially
 	srcConnID      protocol.ConnectionID
 
+	// The connection IDs returned by ConnectionID and OriginalDestConnectionID.
+	// serverConnIDMutex protects serverConnID, since the client learns the server's connection ID when receiving the first packet.
+	serverConnIDMutex    sync.Mutex
+	serverConnID         protocol.ConnectionID
+	clientOrigDestConnID protocol.ConnectionID
+
 	perspective    protocol.Perspective
 	initialVersion protocol.VersionNumber // if version negotiation is performed, this is the version we initially tried
 	version        protocol.VersionNumber
@@ -97,12 +112,25 @@ type session struct {
 
 	rttStats *congestion.RTTStats
 
+	// statsMutex protects stats, the snapshot returned by ConnectionStats.
+	// Most statistics are collected by the run loop, and copied to stats by updateStats after every run loop iteration.
+	statsMutex sync.Mutex
+	stats      ConnectionStats
+	// only accessed from the run loop
+	packetsSent, packetsReceived uint64
+	bytesSent, bytesReceived     protocol.ByteCount
+	largestPacketSent            protocol.ByteCount
+
+	droppedPackets packetDropCounters
+	decryptErrors  decryptErrorMonitor
+
 	cryptoStreamManager   *cryptoStreamManager
 	sentPacketHandler     ackhandler.SentPacketHandler
 	receivedPacketHandler ackhandler.ReceivedPacketHandler
 	framer                framer
 	windowUpdateQueue     *windowUpdateQueue
 	connFlowController    flowcontrol.ConnectionFlowController
+	connSendBuffer        *connectionSendBuffer
 
 	unpacker    unpacker
 	frameParser wire.FrameParser
@@ -123,15 +151,30 @@ type session struct {
 	ctx       context.Context
 	ctxCancel context.CancelFunc
 
+	// testHooks are run on the run loop (only used in builds with the internal_test build tag)
+	testHooks testHooks
+
 	undecryptablePackets []*receivedPacket
 
 	clientHelloWritten    <-chan struct{}
 	handshakeCompleteChan chan struct{} // is closed when the handshake completes
 	handshakeComplete     bool
+	// handshakeCtx is canceled when the handshake completes, or when the session is closed
+	handshakeCtx       context.Context
+	handshakeCtxCancel context.CancelFunc
+	// earlySessionReady is set by the server when it installed the 1-RTT keys.
+	// The runner is notified after the first flight was sent.
+	earlySessionReady bool
 
 	receivedRetry                    bool
 	receivedFirstPacket              bool
 	receivedFirstForwardSecurePacket bool
+	// received1RTTAck is set when the first ACK for a 1-RTT packet is received.
+	// Together with the completion of the handshake, this confirms the handshake.
+	received1RTTAck bool
+
+	droppedInitialKeys   bool
+	droppedHandshakeKeys bool
 
 	sessionCreationTime time.Time
 	// The idle timeout is set based on the max of the time we received the last packet...
@@ -140,13 +183,41 @@ type session struct {
 	firstAckElicitingPacketAfterIdleSentTime time.Time
 	// pacingDeadline is the time when the next packet should be sent
 	pacingDeadline time.Time
+	// lastActivity is the time when the last packet was received.
+	// It is read by the server's idle connection pruner, and therefore protected by lastActivityMutex.
+	lastActivityMutex sync.Mutex
+	lastActivity      time.Time
 
 	peerParams *handshake.TransportParameters
+	// peerCustomParams are the peer's custom transport parameters.
+	// They are set by the handshake, and read by the application.
+	// peerCustomParamsMutex also protects peerMaxDatagramFrameSize.
+	peerCustomParamsMutex    sync.Mutex
+	peerCustomParams         map[uint64][]byte
+	peerMaxDatagramFrameSize protocol.ByteCount
+	// receivedDatagrams holds the payloads of received DATAGRAM frames until the application reads them
+	receivedDatagrams chan []byte
+
+	// cookieGenerator is used to issue a token in a NEW_TOKEN frame after completing the handshake.
+	// It is only set for the server, if a TokenKey is configured.
+	cookieGenerator *handshake.CookieGenerator
+	// tokenStoreKey is the key used to store the tokens received in NEW_TOKEN frames in the Config's TokenStore.
+	// It is only set for the client.
+	tokenStoreKey string
 
 	timer *utils.Timer
 	// keepAlivePingSent stores whether a Ping frame was sent to the peer or not
 	// it is reset as soon as we receive a packet from the peer
 	keepAlivePingSent bool
+	// pingTracker tracks the PING sent by the application
+	pingTracker pingTracker
+
+	// tracer is nil if the connection is not traced
+	tracer ConnectionTracer
+	// streamEvents is only used if the connection is traced
+	streamEvents streamEventQueue
+	// capture is nil if the datagrams of the connection are not captured
+	capture ConnectionCapture
 
 	logger utils.Logger
 }
@@ -166,28 +237,48 @@ var newSession = func(
 	logger utils.Logger,
 	v protocol.VersionNumber,
 ) (quicSession, error) {
+	// If a Retry was sent, the client's original destination connection ID is sent in the transport parameters.
+	origDestConnID := clientDestConnID
+	if params.OriginalConnectionID.Len() > 0 {
+		origDestConnID = params.OriginalConnectionID
+	}
 	s := &session{
 		conn:                  conn,
 		sessionRunner:         runner,
 		config:                conf,
 		srcConnID:             srcConnID,
 		destConnID:            destConnID,
+		serverConnID:          srcConnID,
+		clientOrigDestConnID:  origDestConnID,
 		perspective:           protocol.PerspectiveServer,
 		handshakeCompleteChan: make(chan struct{}),
 		logger:                logger,
 		version:               v,
 	}
+	if conf.Tracer != nil {
+		s.tracer = conf.Tracer.TracerForConnection(false, origDestConnID)
+	}
+	s.setupCapture(false, origDestConnID)
 	s.preSetup()
-	s.sentPacketHandler = ackhandler.NewSentPacketHandler(0, s.rttStats, s.logger)
+	if conf.GetTokenKeys != nil {
+		cookieGenerator, err := handshake.NewCookieGenerator(conf.GetTokenKeys)
+		if err != nil {
+			return nil, err
+		}
+		s.cookieGenerator = cookieGenerator
+	}
+	s.sentPacketHandler = ackhandler.NewSentPacketHandler(0, s.rttStats, s.onPacketLost(), s.config.EventHooks.OnCongestionEvent, s.onProbeTimeout(), s.logger)
 	s.streamsMap = newStreamsMap(
 		s,
 		s.newFlowController,
+		s.connSendBuffer,
+		s.onStreamOpened,
 		uint64(s.config.MaxIncomingStreams),
 		uint64(s.config.MaxIncomingUniStreams),
 		s.perspective,
 		s.version,
 	)
-	s.framer = newFramer(s.streamsMap, s.version)
+	s.framer = newFramer(s.streamsMap, s.connSendBuffer, s.version)
 	initialStream := newCryptoStream()
 	handshakeStream := newCryptoStream()
 	oneRTTStream := newPostHandshakeCryptoStream(s.framer)
@@ -216,6 +307,8 @@ var newSession = func(
 		cs,
 		s.framer,
 		s.receivedPacketHandler,
+		s.config.PaddingStrategy,
+		s.config.EnableFrameGreasing,
 		s.perspective,
 		s.version,
 	)
@@ -248,14 +341,20 @@ var newClientSession = func(
 		config:                conf,
 		srcConnID:             srcConnID,
 		destConnID:            destConnID,
+		serverConnID:          destConnID,
+		clientOrigDestConnID:  destConnID,
 		perspective:           protocol.PerspectiveClient,
 		handshakeCompleteChan: make(chan struct{}),
 		logger:                logger,
 		initialVersion:        initialVersion,
 		version:               v,
 	}
+	if conf.Tracer != nil {
+		s.tracer = conf.Tracer.TracerForConnection(true, destConnID)
+	}
+	s.setupCapture(true, destConnID)
 	s.preSetup()
-	s.sentPacketHandler = ackhandler.NewSentPacketHandler(initialPacketNumber, s.rttStats, s.logger)
+	s.sentPacketHandler = ackhandler.NewSentPacketHandler(initialPacketNumber, s.rttStats, s.onPacketLost(), s.config.EventHooks.OnCongestionEvent, s.onProbeTimeout(), s.logger)
 	initialStream := newCryptoStream()
 	handshakeStream := newCryptoStream()
 	oneRTTStream := newPostHandshakeCryptoStream(s.framer)
@@ -280,12 +379,14 @@ var newClientSession = func(
 	s.streamsMap = newStreamsMap(
 		s,
 		s.newFlowController,
+		s.connSendBuffer,
+		s.onStreamOpened,
 		uint64(s.config.MaxIncomingStreams),
 		uint64(s.config.MaxIncomingUniStreams),
 		s.perspective,
 		s.version,
 	)
-	s.framer = newFramer(s.streamsMap, s.version)
+	s.framer = newFramer(s.streamsMap, s.connSendBuffer, s.version)
 	s.packer = newPacketPacker(
 		s.destConnID,
 		s.srcConnID,
@@ -296,16 +397,30 @@ var newClientSession = func(
 		cs,
 		s.framer,
 		s.receivedPacketHandler,
+		s.config.PaddingStrategy,
+		s.config.EnableFrameGreasing,
 		s.perspective,
 		s.version,
 	)
+	if s.config.TokenStore != nil {
+		if tlsConf != nil {
+			s.tokenStoreKey = tlsConf.ServerName
+		}
+		if len(s.tokenStoreKey) == 0 {
+			s.tokenStoreKey = conn.RemoteAddr().String()
+		}
+		if token := s.config.TokenStore.Pop(s.tokenStoreKey); token != nil {
+			s.packer.SetToken(token.data)
+		}
+	}
 	return s, s.postSetup()
 }
 
 func (s *session) preSetup() {
-	s.frameParser = wire.NewFrameParser(s.version)
+	s.frameParser = wire.NewFrameParser(s.config.EnableDatagrams, s.config.EnableFrameGreasing, s.config.extensionFrameDecoders(), s.perspective, s.version)
 	s.rttStats = &congestion.RTTStats{}
-	s.receivedPacketHandler = ackhandler.NewReceivedPacketHandler(s.rttStats, s.logger, s.version)
+	s.connSendBuffer = newConnectionSendBuffer(protocol.ByteCount(s.config.MaxConnectionSendBufferBytes))
+	s.receivedPacketHandler = ackhandler.NewReceivedPacketHandler(s.rttStats, s.config.ObfuscateStreamFingerprint, s.logger, s.version)
 	s.connFlowController = flowcontrol.NewConnectionFlowController(
 		protocol.InitialMaxData,
 		protocol.ByteCount(s.config.MaxReceiveConnectionFlowControlWindow),
@@ -319,13 +434,21 @@ func (s *session) postSetup() error {
 	s.receivedPackets = make(chan *receivedPacket, protocol.MaxSessionUnprocessedPackets)
 	s.closeChan = make(chan closeError, 1)
 	s.sendingScheduled = make(chan struct{}, 1)
+	s.receivedDatagrams = make(chan []byte, protocol.MaxDatagramRcvQueueLen)
 	s.undecryptablePackets = make([]*receivedPacket, 0, protocol.MaxUndecryptablePackets)
-	s.ctx, s.ctxCancel = context.WithCancel(context.Background())
+	ctx := context.WithValue(context.Background(), connectionIDKey, s)
+	if s.config.testingTB != nil {
+		ctx = context.WithValue(ctx, testingTBKey, s.config.testingTB)
+	}
+	s.ctx, s.ctxCancel = context.WithCancel(ctx)
+	s.handshakeCtx, s.handshakeCtxCancel = context.WithCancel(context.Background())
 
 	s.timer = utils.NewTimer()
 	now := time.Now()
 	s.lastPacketReceivedTime = now
 	s.sessionCreationTime = now
+	s.setLastActivity(now)
+	s.stats.MaxPacketSize = getMaxPacketSize(s.conn.RemoteAddr())
 
 	s.windowUpdateQueue = newWindowUpdateQueue(s.streamsMap, s.connFlowController, s.framer.QueueControlFrame)
 	return nil
@@ -334,12 +457,25 @@ func (s *session) postSetup() error {
 // run the session main loop
 func (s *session) run() error {
 	defer s.ctxCancel()
+	defer s.handshakeCtxCancel()
+
+	if s.tracer != nil {
+		s.tracer.StartedConnection(s.conn.LocalAddr(), s.conn.RemoteAddr(), s.version, s.srcConnID, s.destConnID)
+	}
+	// A client session that is recreated after receiving a Version Negotiation packet is not a new connection.
+	if s.config.MetricsCollector != nil && s.initialVersion == 0 {
+		s.config.MetricsCollector.ConnectionStarted()
+	}
 
 	go func() {
 		if err := s.cryptoStreamHandler.RunHandshake(); err != nil {
 			s.closeLocal(err)
 			return
 		}
+		if err := s.verifyConnection(); err != nil {
+			s.closeLocal(err)
+			return
+		}
 		close(s.handshakeCompleteChan)
 	}()
 	if s.perspective == protocol.PerspectiveClient {
@@ -387,6 +523,7 @@ runLoop:
 		case <-s.handshakeCompleteChan:
 			s.handleHandshakeComplete()
 		}
+		s.runTestHooks()
 
 		now := time.Now()
 		if timeout := s.sentPacketHandler.GetAlarmTimeout(); !timeout.IsZero() && timeout.Before(now) {
@@ -404,7 +541,7 @@ runLoop:
 		if s.config.KeepAlive && !s.keepAlivePingSent && s.handshakeComplete && s.firstAckElicitingPacketAfterIdleSentTime.IsZero() && time.Since(s.lastPacketReceivedTime) >= s.peerParams.IdleTimeout/2 {
 			// send a PING frame since there is no activity in the session
 			s.logger.Debugf("Sending a keep-alive ping to keep the connection alive.")
-			s.framer.QueueControlFrame(&wire.PingFrame{})
+			s.packer.QueuePing()
 			s.keepAlivePingSent = true
 		} else if !pacingDeadline.IsZero() && now.Before(pacingDeadline) {
 			// If we get to this point before the pacing deadline, we should wait until that deadline.
@@ -414,11 +551,11 @@ runLoop:
 			continue
 		}
 
-		if !s.handshakeComplete && now.Sub(s.sessionCreationTime) >= s.config.HandshakeTimeout {
+		if !s.handshakeComplete && now.Sub(s.sessionCreationTime) >= s.handshakeTimeout() {
 			s.destroy(qerr.TimeoutError("Handshake did not complete in time"))
 			continue
 		}
-		if s.handshakeComplete && now.Sub(s.idleTimeoutStartTime()) >= s.config.IdleTimeout {
+		if s.handshakeComplete && now.Sub(s.idleTimeoutStartTime()) >= s.idleTimeout() {
 			s.destroy(qerr.TimeoutError("No recent network activity"))
 			continue
 		}
@@ -426,9 +563,29 @@ runLoop:
 		if err := s.sendPackets(); err != nil {
 			s.closeLocal(err)
 		}
+		if s.earlySessionReady {
+			s.earlySessionReady = false
+			s.sessionRunner.OnEarlySessionReady(s)
+		}
+		if s.tracer != nil {
+			s.streamEvents.Flush(s.tracer)
+		}
+		s.updateStats()
 	}
 
 	s.handleCloseError(closeErr)
+	closeErr.err = toCryptoError(closeErr.err, closeErr.remote)
+	s.updateStats()
+	if s.tracer != nil {
+		s.streamEvents.Flush(s.tracer)
+		s.tracer.ClosedConnection(closeErr.err)
+	}
+	if s.capture != nil {
+		s.capture.Close()
+	}
+	if s.config.MetricsCollector != nil && closeErr.err != errCloseForRecreating {
+		s.config.MetricsCollector.ConnectionClosed(s.closeReason(closeErr))
+	}
 	s.closed.Set(true)
 	s.logger.Infof("Connection %s closed.", s.srcConnID)
 	s.cryptoStreamHandler.Close()
@@ -439,16 +596,199 @@ func (s *session) Context() context.Context {
 	return s.ctx
 }
 
+func (s *session) HandshakeComplete() context.Context {
+	return s.handshakeCtx
+}
+
+type contextKey int
+
+const (
+	// connectionIDKey is the key for the session in the context returned by Session.Context.
+	connectionIDKey contextKey = iota
+	// testingTBKey is the key for the TB used for error injection (see EnableErrorInjection).
+	testingTBKey
+)
+
+// testingTB returns the TB stored in the context of the session.
+// It returns nil if error injection is not enabled.
+func (s *session) testingTB() TB {
+	tb, _ := s.ctx.Value(testingTBKey).(TB)
+	return tb
+}
+
+// ConnectionIDFromContext returns the connection ID of the session that the context belongs to.
+// The context must be derived from the context returned by Session.Context.
+// See Session.ConnectionID for details.
+func ConnectionIDFromContext(ctx context.Context) (string, bool) {
+	s, ok := ctx.Value(connectionIDKey).(*session)
+	if !ok {
+		return "", false
+	}
+	return s.ConnectionID(), true
+}
+
+func (s *session) ConnectionID() string {
+	s.serverConnIDMutex.Lock()
+	defer s.serverConnIDMutex.Unlock()
+	return hex.EncodeToString(s.serverConnID)
+}
+
+func (s *session) setServerConnectionID(connID protocol.ConnectionID) {
+	s.serverConnIDMutex.Lock()
+	s.serverConnID = connID
+	s.serverConnIDMutex.Unlock()
+}
+
+func (s *session) OriginalDestConnectionID() string {
+	return hex.EncodeToString(s.clientOrigDestConnID)
+}
+
+func (s *session) PeerTransportParameters() map[uint64][]byte {
+	s.peerCustomParamsMutex.Lock()
+	defer s.peerCustomParamsMutex.Unlock()
+	if s.peerCustomParams == nil {
+		return nil
+	}
+	// copy the map, so that the application can't modify the session's state
+	params := make(map[uint64][]byte, len(s.peerCustomParams))
+	for id, val := range s.peerCustomParams {
+		params[id] = append([]byte(nil), val...)
+	}
+	return params
+}
+
+func (s *session) DonateStreamSendCredit(from, to protocol.StreamID, n protocol.ByteCount) error {
+	if to.Type() == protocol.StreamTypeUni && to.InitiatedBy() != s.perspective {
+		return fmt.Errorf("can't donate send credit to stream %d, it is a receive-only stream", to)
+	}
+	// Credit can be donated to streams that haven't been opened yet,
+	// e.g. to reserve the send window for a push stream before the push is sent.
+	if s.streamsMap.SendStreamState(to) == streamStateUnavailable {
+		return fmt.Errorf("can't donate send credit to stream %d, it is closed or exceeds the stream limit", to)
+	}
+	switch s.streamsMap.SendStreamState(from) {
+	case streamStateUnavailable:
+		return fmt.Errorf("stream %d can't donate send credit, it is closed or exceeds the stream limit", from)
+	case streamStateNotOpened:
+		// A stream that wasn't opened yet can only pass on the credit donated to it.
+		if granted := s.connFlowController.GrantedSendCredit(from); n > granted {
+			return fmt.Errorf("stream %d can't donate %d bytes of send credit, only %d bytes were donated to it", from, n, granted)
+		}
+	}
+	if err := s.connFlowController.DonateSendCredit(from, to, n); err != nil {
+		return err
+	}
+	// Stream to might have been completed concurrently.
+	// onStreamCompleted deletes the stream before releasing its send credit,
+	// so if the stream still isn't closed here, the credit will be released when it is completed.
+	if s.streamsMap.SendStreamState(to) == streamStateUnavailable {
+		s.connFlowController.ReleaseSendCredit(to)
+		return fmt.Errorf("can't donate send credit to stream %d, it is closed or exceeds the stream limit", to)
+	}
+	// stream to might have been blocked by connection-level flow control
+	s.scheduleSending()
+	return nil
+}
+
+func (s *session) SendPing() error {
+	p, isNew := s.pingTracker.Ping()
+	if !isNew {
+		return ErrPingPending
+	}
+	s.queueControlFrame(&p.frame)
+	return nil
+}
+
+func (s *session) PingRoundTrip(ctx context.Context) (time.Duration, error) {
+	p, isNew := s.pingTracker.Ping()
+	if isNew {
+		s.queueControlFrame(&p.frame)
+	}
+	select {
+	case <-p.done:
+		return p.rtt, nil
+	case <-ctx.Done():
+		return 0, ctx.Err()
+	case <-s.ctx.Done():
+		return 0, errSessionClosedBeforePingAcked
+	}
+}
+
 func (s *session) ConnectionState() tls.ConnectionState {
 	return s.cryptoStreamHandler.ConnectionState()
 }
 
+func (s *session) ExportKeyingMaterial(label string, context []byte, length int) ([]byte, error) {
+	return s.cryptoStreamHandler.ExportKeyingMaterial(label, context, length)
+}
+
+func (s *session) PeerCertificates() []*x509.Certificate {
+	return s.ConnectionState().PeerCertificates
+}
+
+func (s *session) VerifiedChains() [][]*x509.Certificate {
+	return s.ConnectionState().VerifiedChains
+}
+
+func (s *session) PeerCommonName() string {
+	certs := s.PeerCertificates()
+	if len(certs) == 0 {
+		return ""
+	}
+	return certs[0].Subject.CommonName
+}
+
+func (s *session) ConnectionStats() ConnectionStats {
+	s.statsMutex.Lock()
+	stats := s.stats
+	// the slice is reused by updateStats
+	stats.RecentRTTSamples = append([]time.Duration(nil), s.stats.RecentRTTSamples...)
+	s.statsMutex.Unlock()
+	if c, ok := s.conn.(*conn); ok {
+		stats.UDPReceiveBufferSize, stats.UDPSendBufferSize, _ = getUDPBufferSizes(c.pconn)
+	}
+	stats.EstimatedBandwidthBps = s.sentPacketHandler.DeliveryRate()
+	stats.DroppedPackets = s.droppedPackets.Snapshot()
+	return stats
+}
+
+// updateStats takes a snapshot of the statistics collected by the run loop.
+// It must be called from the run loop.
+func (s *session) updateStats() {
+	sphStats := s.sentPacketHandler.GetStats()
+	cwnd := s.sentPacketHandler.GetCongestionWindow()
+	bytesInFlight := s.sentPacketHandler.GetBytesInFlight()
+
+	s.statsMutex.Lock()
+	defer s.statsMutex.Unlock()
+	s.stats.SmoothedRTT = s.rttStats.SmoothedRTT()
+	s.stats.MinRTT = s.rttStats.MinRTT()
+	s.stats.LatestRTT = s.rttStats.LatestRTT()
+	s.stats.RTTVariance = s.rttStats.MeanDeviation()
+	s.stats.RecentRTTSamples = s.rttStats.AppendRecentSamples(s.stats.RecentRTTSamples[:0])
+	s.stats.CongestionWindow = cwnd
+	s.stats.BytesInFlight = bytesInFlight
+	s.stats.PacketsSent = s.packetsSent
+	s.stats.BytesSent = s.bytesSent
+	s.stats.PacketsReceived = s.packetsReceived
+	s.stats.BytesReceived = s.bytesReceived
+	s.stats.PacketsLost = sphStats.PacketsLost
+	s.stats.BytesLost = sphStats.BytesLost
+	s.stats.PacketLossRate = sphStats.PacketLossRate
+	s.stats.PacketsRetransmitted = sphStats.PacketsRetransmitted
+	s.stats.BytesRetransmitted = sphStats.BytesRetransmitted
+	s.stats.SpuriousLosses = sphStats.SpuriousLosses
+	s.stats.SpuriousRetransmissions = sphStats.SpuriousRetransmissions
+	s.stats.ProbeTimeouts = sphStats.ProbeTimeouts
+	s.stats.LargestPacketSent = s.largestPacketSent
+}
+
 func (s *session) maybeResetTimer() {
 	var deadline time.Time
 	if s.config.KeepAlive && s.handshakeComplete && !s.keepAlivePingSent {
 		deadline = s.idleTimeoutStartTime().Add(s.peerParams.IdleTimeout / 2)
 	} else {
-		deadline = s.idleTimeoutStartTime().Add(s.config.IdleTimeout)
+		deadline = s.idleTimeoutStartTime().Add(s.idleTimeout())
 	}
 
 	if ackAlarm := s.receivedPacketHandler.GetAlarmTimeout(); !ackAlarm.IsZero() {
@@ -458,7 +798,7 @@ func (s *session) maybeResetTimer() {
 		deadline = utils.MinTime(deadline, lossTime)
 	}
 	if !s.handshakeComplete {
-		handshakeDeadline := s.sessionCreationTime.Add(s.config.HandshakeTimeout)
+		handshakeDeadline := s.sessionCreationTime.Add(s.handshakeTimeout())
 		deadline = utils.MinTime(deadline, handshakeDeadline)
 	}
 	if !s.pacingDeadline.IsZero() {
@@ -468,14 +808,91 @@ func (s *session) maybeResetTimer() {
 	s.timer.Reset(deadline)
 }
 
+func (s *session) setLastActivity(t time.Time) {
+	s.lastActivityMutex.Lock()
+	s.lastActivity = t
+	s.lastActivityMutex.Unlock()
+}
+
+// lastActivityTime returns the time when the last packet was received
+func (s *session) lastActivityTime() time.Time {
+	s.lastActivityMutex.Lock()
+	defer s.lastActivityMutex.Unlock()
+	return s.lastActivity
+}
+
 func (s *session) idleTimeoutStartTime() time.Time {
 	return utils.MaxTime(s.lastPacketReceivedTime, s.firstAckElicitingPacketAfterIdleSentTime)
 }
 
+// idleTimeout returns the idle timeout, scaled with the smoothed RTT,
+// and bounded by the MinIdleTimeout and MaxIdleTimeout.
+func (s *session) idleTimeout() time.Duration {
+	return boundIdleTimeout(s.config, utils.MaxDuration(s.config.IdleTimeout, s.rttScaledTimeout()))
+}
+
+// handshakeTimeout returns the handshake timeout.
+// The client scales it with the smoothed RTT.
+// The server never does, since the client could inflate the RTT measured during the handshake.
+func (s *session) handshakeTimeout() time.Duration {
+	if s.perspective == protocol.PerspectiveServer {
+		return s.config.HandshakeTimeout
+	}
+	return utils.MaxDuration(s.config.HandshakeTimeout, s.rttScaledTimeout())
+}
+
+// advertisedIdleTimeout returns the idle timeout sent in the transport parameters.
+// When the transport parameters are sent, there's no RTT sample yet.
+// If the idle timeout is scaled with the RTT, the upper bound of the scaled value is advertised,
+// such that the peer doesn't close the connection before we do.
+func advertisedIdleTimeout(config *Config) time.Duration {
+	if config.IdleTimeoutMultiplier > 0 && config.MaxIdleTimeout > 0 {
+		return config.MaxIdleTimeout
+	}
+	return boundIdleTimeout(config, config.IdleTimeout)
+}
+
+func boundIdleTimeout(config *Config, timeout time.Duration) time.Duration {
+	if config.MinIdleTimeout > 0 {
+		timeout = utils.MaxDuration(timeout, config.MinIdleTimeout)
+	}
+	if config.MaxIdleTimeout > 0 {
+		timeout = utils.MinDuration(timeout, config.MaxIdleTimeout)
+	}
+	return timeout
+}
+
+func (s *session) rttScaledTimeout() time.Duration {
+	return time.Duration(s.config.IdleTimeoutMultiplier * float64(s.rttStats.SmoothedRTT()))
+}
+
+// verifyConnection calls the VerifyConnection callback, if set.
+func (s *session) verifyConnection() error {
+	if s.config.VerifyConnection == nil {
+		return nil
+	}
+	if err := s.config.VerifyConnection(s.ConnectionState(), s); err != nil {
+		return qerr.Error(qerr.CertificateRequired, err.Error())
+	}
+	return nil
+}
+
 func (s *session) handleHandshakeComplete() {
 	s.handshakeComplete = true
 	s.handshakeCompleteChan = nil // prevent this case from ever being selected again
+	s.earlySessionReady = false
+	s.handshakeCtxCancel()
 	s.sessionRunner.OnHandshakeComplete(s)
+	if s.config.EventHooks.OnHandshakeComplete != nil {
+		s.config.EventHooks.OnHandshakeComplete(s)
+	}
+	handshakeDuration := time.Since(s.sessionCreationTime)
+	s.statsMutex.Lock()
+	s.stats.HandshakeDuration = handshakeDuration
+	s.statsMutex.Unlock()
+	if s.config.MetricsCollector != nil {
+		s.config.MetricsCollector.HandshakeCompleted(handshakeDuration)
+	}
 
 	// The client completes the handshake first (after sending the CFIN).
 	// We need to make sure they learn about the peer completing the handshake,
@@ -486,7 +903,45 @@ func (s *session) handleHandshakeComplete() {
 	if s.perspective == protocol.PerspectiveServer {
 		s.queueControlFrame(&wire.PingFrame{})
 		s.sentPacketHandler.SetHandshakeComplete()
+		if s.cookieGenerator != nil {
+			token, err := s.cookieGenerator.NewToken(s.RemoteAddr())
+			if err != nil {
+				s.logger.Errorf("Issuing an address validation token failed: %s", err)
+			} else {
+				s.queueControlFrame(&wire.NewTokenFrame{Token: token})
+			}
+		}
+	}
+	if s.received1RTTAck {
+		s.discardHandshakeKeys()
+	}
+}
+
+// discardInitialKeys drops the Initial keys, as well as all state kept for the Initial packet number space.
+// The client drops them when it first sends a Handshake packet,
+// the server when it first successfully processes a Handshake packet.
+func (s *session) discardInitialKeys() {
+	if s.droppedInitialKeys {
+		return
 	}
+	s.droppedInitialKeys = true
+	s.cryptoStreamHandler.DropInitialKeys()
+	s.sentPacketHandler.DropPackets(protocol.EncryptionInitial)
+	s.receivedPacketHandler.DropPackets(protocol.EncryptionInitial)
+}
+
+// discardHandshakeKeys drops the Handshake keys, as well as all state kept for the Handshake packet number space.
+// They are dropped once the handshake is confirmed,
+// i.e. when the handshake is complete and a 1-RTT packet has been acknowledged.
+func (s *session) discardHandshakeKeys() {
+	if s.droppedHandshakeKeys {
+		return
+	}
+	s.discardInitialKeys()
+	s.droppedHandshakeKeys = true
+	s.cryptoStreamHandler.DropHandshakeKeys()
+	s.sentPacketHandler.DropPackets(protocol.EncryptionHandshake)
+	s.receivedPacketHandler.DropPackets(protocol.EncryptionHandshake)
 }
 
 func (s *session) handlePacketImpl(rp *receivedPacket) bool {
@@ -504,11 +959,13 @@ func (s *session) handlePacketImpl(rp *receivedPacket) bool {
 		hdr, packetData, rest, err := wire.ParsePacket(p.data, s.srcConnID.Len())
 		if err != nil {
 			s.logger.Debugf("error parsing packet: %s", err)
+			s.droppedPacket(p, PacketDropHeaderParseError)
 			break
 		}
 
 		if counter > 0 && !hdr.DestConnectionID.Equal(lastConnID) {
 			s.logger.Debugf("coalesced packet has different destination connection ID: %s, expected %s", hdr.DestConnectionID, lastConnID)
+			s.droppedPacket(p, PacketDropUnknownConnectionID)
 			break
 		}
 		lastConnID = hdr.DestConnectionID
@@ -542,6 +999,16 @@ func (s *session) handleSinglePacket(p *receivedPacket, hdr *wire.Header) bool /
 		}
 	}()
 
+	if hdr.IsLongHeader {
+		if err := validatePacketType(hdr.Type, s.connectionState()); err != nil {
+			// Long header packets are not authenticated before they are decrypted.
+			// Closing the connection would allow an attacker to kill it by injecting a single packet.
+			s.logger.Debugf("Dropping packet: %s", err)
+			s.droppedPacket(p, PacketDropUnexpectedPacket)
+			return false
+		}
+	}
+
 	if hdr.Type == protocol.PacketTypeRetry {
 		return s.handleRetryPacket(p, hdr)
 	}
@@ -550,10 +1017,12 @@ func (s *session) handleSinglePacket(p *receivedPacket, hdr *wire.Header) bool /
 	// After this, all packets with a different source connection have to be ignored.
 	if s.receivedFirstPacket && hdr.IsLongHeader && !hdr.SrcConnectionID.Equal(s.destConnID) {
 		s.logger.Debugf("Dropping packet with unexpected source connection ID: %s (expected %s)", hdr.SrcConnectionID, s.destConnID)
+		s.droppedPacket(p, PacketDropUnknownConnectionID)
 		return false
 	}
 	// drop 0-RTT packets
 	if hdr.Type == protocol.PacketType0RTT {
+		s.droppedPacket(p, PacketDropKeyUnavailable)
 		return false
 	}
 
@@ -569,6 +1038,13 @@ func (s *session) handleSinglePacket(p *receivedPacket, hdr *wire.Header) bool /
 		// This might be a packet injected by an attacker.
 		// Drop it.
 		s.logger.Debugf("Dropping packet that could not be unpacked. Unpack error: %s", err)
+		s.droppedPacket(p, PacketDropPayloadDecryptError)
+		return false
+	}
+
+	if s.receivedPacketHandler.IsPotentiallyDuplicate(packet.packetNumber, packet.encryptionLevel) {
+		s.logger.Debugf("Dropping (potentially) duplicate packet %#x (%s).", packet.packetNumber, packet.encryptionLevel)
+		s.droppedPacket(p, PacketDropDuplicate)
 		return false
 	}
 
@@ -577,41 +1053,75 @@ func (s *session) handleSinglePacket(p *receivedPacket, hdr *wire.Header) bool /
 		packet.hdr.Log(s.logger)
 	}
 
-	if err := s.handleUnpackedPacket(packet, p.rcvTime); err != nil {
+	if err := s.handleUnpackedPacket(packet, p.rcvTime, protocol.ByteCount(len(p.data))); err != nil {
 		s.closeLocal(err)
 		return false
 	}
 	return true
 }
 
-func (s *session) handleRetryPacket(p *receivedPacket, hdr *wire.Header) bool /* was this a valid Retry */ {
-	if s.perspective == protocol.PerspectiveServer {
-		s.logger.Debugf("Ignoring Retry.")
-		return false
+// The connectionState is the part of the session's state that determines which long header packet types are valid.
+type connectionState struct {
+	perspective         protocol.Perspective
+	receivedFirstPacket bool
+}
+
+func (s *session) connectionState() connectionState {
+	return connectionState{
+		perspective:         s.perspective,
+		receivedFirstPacket: s.receivedFirstPacket,
 	}
-	if s.receivedFirstPacket {
-		s.logger.Debugf("Ignoring Retry, since we already received a packet.")
-		return false
+}
+
+// validatePacketType checks that a long header packet of the given type can be received in the current state.
+// It returns a PROTOCOL_VIOLATION error for packet types that must never be received, e.g.
+// a Retry packet after the client received a packet from the server, or a 0-RTT packet sent by the server.
+func validatePacketType(pktType protocol.PacketType, state connectionState) error {
+	switch pktType {
+	case protocol.PacketTypeInitial, protocol.PacketTypeHandshake:
+		return nil
+	case protocol.PacketTypeRetry:
+		if state.perspective == protocol.PerspectiveServer {
+			return qerr.Error(qerr.ProtocolViolation, "received a Retry packet from the client")
+		}
+		if state.receivedFirstPacket {
+			return qerr.Error(qerr.ProtocolViolation, "received a Retry packet after receiving a packet from the server")
+		}
+		return nil
+	case protocol.PacketType0RTT:
+		if state.perspective == protocol.PerspectiveClient {
+			return qerr.Error(qerr.ProtocolViolation, "received a 0-RTT packet from the server")
+		}
+		return nil
+	default:
+		return qerr.Error(qerr.ProtocolViolation, fmt.Sprintf("invalid long header packet type: %d", pktType))
 	}
+}
+
+func (s *session) handleRetryPacket(p *receivedPacket, hdr *wire.Header) bool /* was this a valid Retry */ {
 	(&wire.ExtendedHeader{Header: *hdr}).Log(s.logger)
 	if !hdr.OrigDestConnectionID.Equal(s.destConnID) {
 		s.logger.Debugf("Ignoring spoofed Retry. Original Destination Connection ID: %s, expected: %s", hdr.OrigDestConnectionID, s.destConnID)
+		s.droppedPacket(p, PacketDropUnexpectedPacket)
 		return false
 	}
 	if hdr.SrcConnectionID.Equal(s.destConnID) {
 		s.logger.Debugf("Ignoring Retry, since the server didn't change the Source Connection ID.")
+		s.droppedPacket(p, PacketDropUnexpectedPacket)
 		return false
 	}
 	// If a token is already set, this means that we already received a Retry from the server.
 	// Ignore this Retry packet.
 	if s.receivedRetry {
 		s.logger.Debugf("Ignoring Retry, since a Retry was already received.")
+		s.droppedPacket(p, PacketDropUnexpectedPacket)
 		return false
 	}
 	s.logger.Debugf("<- Received Retry")
 	s.logger.Debugf("Switching destination connection ID to: %s", hdr.SrcConnectionID)
 	s.origDestConnID = s.destConnID
 	s.destConnID = hdr.SrcConnectionID
+	s.setServerConnectionID(s.destConnID)
 	s.receivedRetry = true
 	if err := s.sentPacketHandler.ResetForRetry(); err != nil {
 		s.closeLocal(err)
@@ -624,7 +1134,7 @@ func (s *session) handleRetryPacket(p *receivedPacket, hdr *wire.Header) bool /*
 	return true
 }
 
-func (s *session) handleUnpackedPacket(packet *unpackedPacket, rcvTime time.Time) error {
+func (s *session) handleUnpackedPacket(packet *unpackedPacket, rcvTime time.Time, packetSize protocol.ByteCount) error {
 	if len(packet.data) == 0 {
 		return qerr.Error(qerr.ProtocolViolation, "empty packet")
 	}
@@ -633,14 +1143,21 @@ func (s *session) handleUnpackedPacket(packet *unpackedPacket, rcvTime time.Time
 	if s.perspective == protocol.PerspectiveClient && !s.receivedFirstPacket && packet.hdr.IsLongHeader && !packet.hdr.SrcConnectionID.Equal(s.destConnID) {
 		s.logger.Debugf("Received first packet. Switching destination connection ID to: %s", packet.hdr.SrcConnectionID)
 		s.destConnID = packet.hdr.SrcConnectionID
+		s.setServerConnectionID(s.destConnID)
 		s.packer.ChangeDestConnectionID(s.destConnID)
 	}
 
 	s.receivedFirstPacket = true
 	s.lastPacketReceivedTime = rcvTime
 	s.firstAckElicitingPacketAfterIdleSentTime = time.Time{}
+	s.setLastActivity(rcvTime)
 	s.keepAlivePingSent = false
 
+	// Successfully processing a Handshake packet proves that the client received the server's Initial packets.
+	if s.perspective == protocol.PerspectiveServer && packet.encryptionLevel == protocol.EncryptionHandshake {
+		s.discardInitialKeys()
+	}
+
 	// The client completes the handshake first (after sending the CFIN).
 	// We know that the server completed the handshake as soon as we receive a forward-secure packet.
 	if s.perspective == protocol.PerspectiveClient {
@@ -652,6 +1169,7 @@ func (s *session) handleUnpackedPacket(packet *unpackedPacket, rcvTime time.Time
 
 	r := bytes.NewReader(packet.data)
 	var isAckEliciting bool
+	var frames []wire.Frame
 	for {
 		frame, err := s.frameParser.ParseNext(r, packet.encryptionLevel)
 		if err != nil {
@@ -663,10 +1181,21 @@ func (s *session) handleUnpackedPacket(packet *unpackedPacket, rcvTime time.Time
 		if ackhandler.IsFrameAckEliciting(frame) {
 			isAckEliciting = true
 		}
+		if s.tracer != nil {
+			frames = append(frames, frame)
+		}
 		if err := s.handleFrame(frame, packet.packetNumber, packet.encryptionLevel); err != nil {
 			return err
 		}
 	}
+	s.packetsReceived++
+	s.bytesReceived += packetSize
+	if s.tracer != nil {
+		s.tracer.ReceivedPacket(packet.hdr, packetSize, frames)
+	}
+	if s.config.MetricsCollector != nil {
+		s.config.MetricsCollector.ReceivedPacket(packet.encryptionLevel, packetSize)
+	}
 
 	if err := s.receivedPacketHandler.ReceivedPacket(packet.packetNumber, packet.encryptionLevel, rcvTime, isAckEliciting); err != nil {
 		return err
@@ -685,7 +1214,7 @@ func (s *session) handleFrame(f wire.Frame, pn protocol.PacketNumber, encLevel p
 	case *wire.AckFrame:
 		err = s.handleAckFrame(frame, pn, encLevel)
 	case *wire.ConnectionCloseFrame:
-		s.closeRemote(qerr.Error(frame.ErrorCode, frame.ReasonPhrase))
+		s.closeRemote(qerr.ErrorWithFrameType(frame.ErrorCode, frame.FrameType, frame.ReasonPhrase))
 	case *wire.ResetStreamFrame:
 		err = s.handleResetStreamFrame(frame)
 	case *wire.MaxDataFrame:
@@ -705,7 +1234,12 @@ func (s *session) handleFrame(f wire.Frame, pn protocol.PacketNumber, encLevel p
 	case *wire.PathResponseFrame:
 		// since we don't send PATH_CHALLENGEs, we don't expect PATH_RESPONSEs
 		err = errors.New("unexpected PATH_RESPONSE frame")
+	case *wire.DatagramFrame:
+		s.handleDatagramFrame(frame)
 	case *wire.NewTokenFrame:
+		s.handleNewTokenFrame(frame)
+	case *wire.CustomFrame:
+		s.handleCustomFrame(frame)
 	case *wire.NewConnectionIDFrame:
 	case *wire.RetireConnectionIDFrame:
 		// since we don't send new connection IDs, we don't expect retirements
@@ -718,6 +1252,14 @@ func (s *session) handleFrame(f wire.Frame, pn protocol.PacketNumber, encLevel p
 
 // handlePacket is called by the server with a new packet
 func (s *session) handlePacket(p *receivedPacket) {
+	if s.capture != nil {
+		s.capture.ReceivedDatagram(p.rcvTime, s.conn.LocalAddr(), p.remoteAddr, p.data)
+	}
+	s.queuePacket(p)
+}
+
+// queuePacket queues a packet for processing in the run loop.
+func (s *session) queuePacket(p *receivedPacket) {
 	if s.closed.Get() {
 		s.handlePacketAfterClosed(p)
 	}
@@ -726,6 +1268,7 @@ func (s *session) handlePacket(p *receivedPacket) {
 	select {
 	case s.receivedPackets <- p:
 	default:
+		s.droppedPackets.Add(PacketDropBufferFull)
 	}
 }
 
@@ -754,6 +1297,11 @@ func (s *session) handleCryptoFrame(frame *wire.CryptoFrame, encLevel protocol.E
 	}
 	s.logger.Debugf("Handled crypto frame at level %s. encLevelChanged: %t", encLevel, encLevelChanged)
 	if encLevelChanged {
+		// After processing the ClientHello, the server has written its first flight,
+		// and installed the 1-RTT write keys.
+		if s.perspective == protocol.PerspectiveServer && encLevel == protocol.EncryptionInitial && !s.handshakeComplete {
+			s.earlySessionReady = true
+		}
 		s.tryDecryptingQueuedPackets()
 	}
 	return nil
@@ -773,6 +1321,9 @@ func (s *session) handleStreamFrame(frame *wire.StreamFrame, encLevel protocol.E
 		// ignore this StreamFrame
 		return nil
 	}
+	if s.tracer != nil {
+		s.streamEvents.ReceivedStreamFrame(frame)
+	}
 	return str.handleStreamFrame(frame)
 }
 
@@ -806,6 +1357,9 @@ func (s *session) handleResetStreamFrame(frame *wire.ResetStreamFrame) error {
 		// stream is closed and already garbage collected
 		return nil
 	}
+	if s.tracer != nil {
+		s.streamEvents.Reset(frame, true)
+	}
 	return str.handleResetStreamFrame(frame)
 }
 
@@ -822,6 +1376,14 @@ func (s *session) handleStopSendingFrame(frame *wire.StopSendingFrame) error {
 	return nil
 }
 
+func (s *session) handleNewTokenFrame(frame *wire.NewTokenFrame) {
+	// NEW_TOKEN frames sent by the client are rejected when parsing the frame
+	if s.config.TokenStore == nil {
+		return
+	}
+	s.config.TokenStore.Put(s.tokenStoreKey, &ClientToken{data: frame.Token})
+}
+
 func (s *session) handlePathChallengeFrame(frame *wire.PathChallengeFrame) {
 	s.queueControlFrame(&wire.PathResponseFrame{Data: frame.Data})
 }
@@ -830,8 +1392,16 @@ func (s *session) handleAckFrame(frame *wire.AckFrame, pn protocol.PacketNumber,
 	if err := s.sentPacketHandler.ReceivedAck(frame, pn, encLevel, s.lastPacketReceivedTime); err != nil {
 		return err
 	}
+	if s.tracer != nil {
+		s.tracer.UpdatedMetrics(s.rttStats, s.sentPacketHandler.GetCongestionWindow(), s.sentPacketHandler.GetBytesInFlight())
+	}
 	if encLevel == protocol.Encryption1RTT {
+		s.pingTracker.ReceivedAck(frame, s.lastPacketReceivedTime)
 		s.receivedPacketHandler.IgnoreBelow(s.sentPacketHandler.GetLowestPacketNotConfirmedAcked())
+		s.received1RTTAck = true
+		if s.handshakeComplete {
+			s.discardHandshakeKeys()
+		}
 	}
 	return nil
 }
@@ -903,7 +1473,7 @@ func (s *session) handleCloseError(closeErr closeError) {
 		quicErr = qerr.ToQuicError(closeErr.err)
 	}
 
-	s.streamsMap.CloseWithError(quicErr)
+	s.streamsMap.CloseWithError(toCryptoError(quicErr, closeErr.remote))
 
 	if !closeErr.sendClose {
 		return
@@ -932,11 +1502,20 @@ func (s *session) processTransportParameters(data []byte) {
 	}
 	s.logger.Debugf("Received Transport Parameters: %s", params)
 	s.peerParams = params
+	s.peerCustomParamsMutex.Lock()
+	s.peerCustomParams = params.CustomParameters
+	s.peerMaxDatagramFrameSize = params.MaxDatagramFrameSize
+	s.peerCustomParamsMutex.Unlock()
 	if err := s.streamsMap.UpdateLimits(params); err != nil {
 		s.closeLocal(err)
 		return
 	}
 	s.packer.HandleTransportParameters(params)
+	if params.MaxPacketSize != 0 {
+		s.statsMutex.Lock()
+		s.stats.MaxPacketSize = utils.MinByteCount(s.stats.MaxPacketSize, params.MaxPacketSize)
+		s.statsMutex.Unlock()
+	}
 	s.frameParser.SetAckDelayExponent(params.AckDelayExponent)
 	s.connFlowController.UpdateSendWindow(params.InitialMaxData)
 	if params.StatelessResetToken != nil {
@@ -975,6 +1554,10 @@ func (s *session) sendPackets() error {
 	}
 
 	numPackets := s.sentPacketHandler.ShouldSendNumPackets()
+	burstLimited := numPackets > s.config.MaxBurstPackets
+	if burstLimited {
+		numPackets = s.config.MaxBurstPackets
+	}
 	var numPacketsSent int
 sendLoop:
 	for {
@@ -1028,10 +1611,23 @@ sendLoop:
 	// There will probably be more to send when calling sendPacket again.
 	if numPacketsSent == numPackets {
 		s.pacingDeadline = s.sentPacketHandler.TimeUntilSend()
+		if burstLimited {
+			s.endBurst()
+		}
 	}
 	return nil
 }
 
+// endBurst is called when the burst limit was reached, although the congestion controller would allow sending more packets.
+// It yields to other goroutines, and makes sure that the run loop continues sending afterwards.
+func (s *session) endBurst() {
+	runtime.Gosched()
+	// If there's no pacing deadline, the timer won't fire, so we need to wake up the run loop.
+	if s.pacingDeadline.IsZero() {
+		s.scheduleSending()
+	}
+}
+
 func (s *session) maybeSendAckOnlyPacket() error {
 	packet, err := s.packer.MaybePackAckPacket()
 	if err != nil {
@@ -1057,6 +1653,9 @@ func (s *session) maybeSendRetransmission() (bool, error) {
 	if err != nil {
 		return false, err
 	}
+	if len(packets) == 0 { // the packet only contained DATAGRAM frames
+		return true, nil
+	}
 	ackhandlerPackets := make([]*ackhandler.Packet, len(packets))
 	for i, packet := range packets {
 		ackhandlerPackets[i] = packet.ToAckHandlerPacket()
@@ -1075,12 +1674,26 @@ func (s *session) sendProbePacket() error {
 	if err != nil {
 		return err
 	}
+	if p == nil {
+		// There's no packet that could be retransmitted as a probe packet.
+		// Send a new packet containing a PING instead.
+		s.logger.Debugf("Sending a PING as a probe packet.")
+		s.packer.QueuePing()
+		_, err := s.sendPacket()
+		return err
+	}
 	s.logger.Debugf("Sending a retransmission for %#x as a probe packet.", p.PacketNumber)
 
 	packets, err := s.packer.PackRetransmission(p)
 	if err != nil {
 		return err
 	}
+	if len(packets) == 0 {
+		// The packet only contained DATAGRAM frames, which are not retransmitted.
+		s.packer.QueuePing()
+		_, err := s.sendPacket()
+		return err
+	}
 	ackhandlerPackets := make([]*ackhandler.Packet, len(packets))
 	for i, packet := range packets {
 		ackhandlerPackets[i] = packet.ToAckHandlerPacket()
@@ -1111,12 +1724,34 @@ func (s *session) sendPacket() (bool, error) {
 	return true, nil
 }
 
+// sentPacket counts a packet that is sent
+func (s *session) sentPacket(packet *packedPacket) {
+	size := protocol.ByteCount(len(packet.raw))
+	s.packetsSent++
+	s.bytesSent += size
+	s.largestPacketSent = utils.MaxByteCount(s.largestPacketSent, size)
+}
+
 func (s *session) sendPackedPacket(packet *packedPacket) error {
 	defer packet.buffer.Release()
 	if s.firstAckElicitingPacketAfterIdleSentTime.IsZero() && packet.IsAckEliciting() {
 		s.firstAckElicitingPacketAfterIdleSentTime = time.Now()
 	}
+	// The client only sends Handshake packets after it received the server's Initial packets.
+	if s.perspective == protocol.PerspectiveClient && packet.EncryptionLevel() == protocol.EncryptionHandshake {
+		s.discardInitialKeys()
+	}
 	s.logPacket(packet)
+	s.sentPacket(packet)
+	if packet.IsAckEliciting() {
+		s.pingTracker.SentPacket(packet.header.PacketNumber, packet.frames, time.Now())
+	}
+	if s.tracer != nil {
+		s.traceSentPacket(packet)
+	}
+	if s.config.MetricsCollector != nil {
+		s.config.MetricsCollector.SentPacket(packet.EncryptionLevel(), protocol.ByteCount(len(packet.raw)))
+	}
 	return s.conn.Write(packet.raw)
 }
 
@@ -1128,6 +1763,7 @@ func (s *session) sendConnectionClose(quicErr *qerr.QuicError) error {
 	}
 	packet, err := s.packer.PackConnectionClose(&wire.ConnectionCloseFrame{
 		ErrorCode:    quicErr.ErrorCode,
+		FrameType:    quicErr.FrameType,
 		ReasonPhrase: reason,
 	})
 	if err != nil {
@@ -1135,6 +1771,13 @@ func (s *session) sendConnectionClose(quicErr *qerr.QuicError) error {
 	}
 	s.connectionClosePacket = packet
 	s.logPacket(packet)
+	s.sentPacket(packet)
+	if s.tracer != nil {
+		s.traceSentPacket(packet)
+	}
+	if s.config.MetricsCollector != nil {
+		s.config.MetricsCollector.SentPacket(packet.EncryptionLevel(), protocol.ByteCount(len(packet.raw)))
+	}
 	return s.conn.Write(packet.raw)
 }
 
@@ -1227,10 +1870,12 @@ func (s *session) scheduleSending() {
 func (s *session) tryQueueingUndecryptablePacket(p *receivedPacket) {
 	if s.handshakeComplete {
 		s.logger.Debugf("Received undecryptable packet from %s after the handshake (%d bytes)", p.remoteAddr.String(), len(p.data))
+		s.droppedPacket(p, PacketDropKeyUnavailable)
 		return
 	}
 	if len(s.undecryptablePackets)+1 > protocol.MaxUndecryptablePackets {
 		s.logger.Infof("Dropping undecrytable packet (%d bytes). Undecryptable packet queue full.", len(p.data))
+		s.droppedPacket(p, PacketDropKeyUnavailable)
 		return
 	}
 	s.logger.Infof("Queueing packet (%d bytes) for later decryption", len(p.data))
@@ -1239,12 +1884,15 @@ func (s *session) tryQueueingUndecryptablePacket(p *receivedPacket) {
 
 func (s *session) tryDecryptingQueuedPackets() {
 	for _, p := range s.undecryptablePackets {
-		s.handlePacket(p)
+		s.queuePacket(p)
 	}
 	s.undecryptablePackets = s.undecryptablePackets[:0]
 }
 
 func (s *session) queueControlFrame(f wire.Frame) {
+	if rsf, ok := f.(*wire.ResetStreamFrame); ok && s.tracer != nil {
+		s.streamEvents.Reset(rsf, false)
+	}
 	s.framer.QueueControlFrame(f)
 	s.scheduleSending()
 }
@@ -1264,10 +1912,109 @@ func (s *session) onHasStreamData(id protocol.StreamID) {
 	s.scheduleSending()
 }
 
-func (s *session) onStreamCompleted(id protocol.StreamID) {
+func (s *session) setStreamPriority(id protocol.StreamID, urgency uint8, incremental bool) {
+	s.framer.SetStreamPriority(id, urgency, incremental)
+	s.scheduleSending()
+}
+
+func (s *session) onStreamCompleted(id protocol.StreamID, streamErr error) {
+	s.framer.RemoveStream(id)
 	if err := s.streamsMap.DeleteStream(id); err != nil {
 		s.closeLocal(err)
+		return
+	}
+	// The stream needs to be deleted before its send credit is released, see DonateStreamSendCredit.
+	s.connFlowController.ReleaseSendCredit(id)
+	if s.config.EventHooks.OnStreamClosed != nil {
+		s.config.EventHooks.OnStreamClosed(id, streamErr)
+	}
+	s.statsMutex.Lock()
+	if id.InitiatedBy() == s.perspective {
+		s.stats.LocalStreamsClosed++
+	} else {
+		s.stats.RemoteStreamsClosed++
+	}
+	s.statsMutex.Unlock()
+	if s.tracer != nil {
+		s.streamEvents.Closed(id)
+	}
+}
+
+// onStreamOpened is called by the streams map for every stream that is opened
+func (s *session) onStreamOpened(id protocol.StreamID) {
+	if s.config.EventHooks.OnStreamOpened != nil {
+		s.config.EventHooks.OnStreamOpened(id)
+	}
+	remote := id.InitiatedBy() != s.perspective
+	s.statsMutex.Lock()
+	if remote {
+		s.stats.RemoteStreamsOpened++
+	} else {
+		s.stats.LocalStreamsOpened++
+	}
+	s.statsMutex.Unlock()
+	if s.tracer != nil {
+		s.streamEvents.Opened(id, remote)
+	}
+}
+
+func (s *session) onReadAvailable(str ReceiveStream, available int) {
+	if s.config.OnReadAvailable != nil {
+		s.config.OnReadAvailable(str, available)
+	}
+}
+
+func (s *session) SendUnreliable(p []byte) error {
+	return NewDatagramOrStreamSender(s).Send(p)
+}
+
+func (s *session) handleDatagramFrame(f *wire.DatagramFrame) {
+	select {
+	case s.receivedDatagrams <- f.Data:
+	default:
+		// DATAGRAM frames are unreliable. Drop the frame if the application doesn't read them fast enough.
+		s.logger.Debugf("Dropping DATAGRAM frame (%d bytes), the receive queue is full", len(f.Data))
+	}
+}
+
+func (s *session) ReceiveUnreliable(ctx context.Context) ([]byte, error) {
+	// deliver messages that were received before the session was closed
+	select {
+	case p := <-s.receivedDatagrams:
+		return p, nil
+	default:
+	}
+	select {
+	case p := <-s.receivedDatagrams:
+		return p, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-s.ctx.Done():
+		return nil, errSessionClosedBeforeDatagramReceived
+	}
+}
+
+var _ datagramSender = &session{}
+
+func (s *session) datagramsSupported() bool {
+	s.peerCustomParamsMutex.Lock()
+	defer s.peerCustomParamsMutex.Unlock()
+	return s.peerMaxDatagramFrameSize > 0
+}
+
+func (s *session) sendDatagram(p []byte) error {
+	s.peerCustomParamsMutex.Lock()
+	maxFrameSize := utils.MinByteCount(s.peerMaxDatagramFrameSize, protocol.MaxDatagramSendFrameSize)
+	s.peerCustomParamsMutex.Unlock()
+	f := &wire.DatagramFrame{DataLenPresent: true, Data: p}
+	if f.Length(s.version) > maxFrameSize {
+		return fmt.Errorf("message too large for a DATAGRAM frame (%d bytes, maximum frame size: %d bytes)", len(p), maxFrameSize)
 	}
+	if !s.framer.QueueDatagramFrame(f) {
+		return errors.New("too many DATAGRAM frames queued")
+	}
+	s.scheduleSending()
+	return nil
 }
 
 func (s *session) LocalAddr() net.Addr {
@@ -4,7 +4,11 @@ import (
 	"bytes"
 	"context"
 	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
 	"errors"
+	"fmt"
 	"net"
 	"runtime/pprof"
 	"strings"
@@ -15,6 +19,7 @@ import (
 
 	"github.com/golang/mock/gomock"
 	"github.com/lucas-clemente/quic-go/internal/ackhandler"
+	"github.com/lucas-clemente/quic-go/internal/flowcontrol"
 	"github.com/lucas-clemente/quic-go/internal/handshake"
 	"github.com/lucas-clemente/quic-go/internal/mocks"
 	mockackhandler "github.com/lucas-clemente/quic-go/internal/mocks/ackhandler"
@@ -62,6 +67,18 @@ func areSessionsRunning() bool {
 	return strings.Contains(b.String(), "quic-go.(*session).run")
 }
 
+type connectionCapturer struct {
+	isClient bool
+	odcid    protocol.ConnectionID
+	capture  ConnectionCapture
+}
+
+func (c *connectionCapturer) CaptureConnection(isClient bool, odcid ConnectionID) ConnectionCapture {
+	c.isClient = isClient
+	c.odcid = odcid
+	return c.capture
+}
+
 var _ = Describe("Session", func() {
 	var (
 		sess          *session
@@ -173,6 +190,183 @@ var _ = Describe("Session", func() {
 			})
 		})
 
+		Context("sending PINGs", func() {
+			// sendAndAckPing sends the queued PING in a 1-RTT packet, and receives an ACK for it
+			sendAndAckPing := func() {
+				frames, _ := sess.framer.AppendControlFrames(nil, 1000)
+				Expect(frames).To(HaveLen(1))
+				Expect(frames[0]).To(BeAssignableToTypeOf(&wire.PingFrame{}))
+				Expect(sess.sendPackedPacket(&packedPacket{
+					header: &wire.ExtendedHeader{PacketNumber: 42},
+					frames: frames,
+					buffer: getPacketBuffer(),
+				})).To(Succeed())
+				sph := mockackhandler.NewMockSentPacketHandler(mockCtrl)
+				sph.EXPECT().ReceivedAck(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any())
+				sph.EXPECT().GetLowestPacketNotConfirmedAcked()
+				sess.sentPacketHandler = sph
+				rph := mockackhandler.NewMockReceivedPacketHandler(mockCtrl)
+				rph.EXPECT().IgnoreBelow(gomock.Any())
+				sess.receivedPacketHandler = rph
+				sess.lastPacketReceivedTime = time.Now().Add(time.Millisecond)
+				ack := &wire.AckFrame{AckRanges: []wire.AckRange{{Smallest: 40, Largest: 42}}}
+				Expect(sess.handleAckFrame(ack, 1, protocol.Encryption1RTT)).To(Succeed())
+			}
+
+			It("only sends a new PING after the previous one was acknowledged", func() {
+				Expect(sess.SendPing()).To(Succeed())
+				Expect(sess.SendPing()).To(MatchError(ErrPingPending))
+				sendAndAckPing()
+				Expect(sess.SendPing()).To(Succeed())
+			})
+
+			It("measures the round trip time of a PING", func() {
+				rttChan := make(chan time.Duration, 1)
+				go func() {
+					defer GinkgoRecover()
+					rtt, err := sess.PingRoundTrip(context.Background())
+					Expect(err).ToNot(HaveOccurred())
+					rttChan <- rtt
+				}()
+				Eventually(func() int {
+					f := sess.framer.(*framerI)
+					f.controlFrameMutex.Lock()
+					defer f.controlFrameMutex.Unlock()
+					return len(f.controlFrames)
+				}).Should(Equal(1))
+				// PingRoundTrip waits for the outstanding PING
+				Expect(sess.SendPing()).To(MatchError(ErrPingPending))
+				sendAndAckPing()
+				var rtt time.Duration
+				Eventually(rttChan).Should(Receive(&rtt))
+				Expect(rtt).To(BeNumerically(">", 0))
+			})
+
+			It("stops waiting for the ACK when the context is canceled", func() {
+				ctx, cancel := context.WithCancel(context.Background())
+				cancel()
+				_, err := sess.PingRoundTrip(ctx)
+				Expect(err).To(MatchError(context.Canceled))
+			})
+
+			It("stops waiting for the ACK when the session is closed", func() {
+				sess.ctxCancel()
+				_, err := sess.PingRoundTrip(context.Background())
+				Expect(err).To(MatchError(errSessionClosedBeforePingAcked))
+			})
+		})
+
+		Context("custom frames", func() {
+			It("queues custom frames", func() {
+				f := &testCustomFrame{frameType: 0x42, data: []byte("foobar")}
+				Expect(sess.SendCustomFrame(f)).To(Succeed())
+				frames, _ := sess.framer.AppendControlFrames(nil, 1000)
+				Expect(frames).To(Equal([]wire.Frame{&wire.CustomFrame{Frame: f}}))
+			})
+
+			It("refuses to send frames of types defined by QUIC", func() {
+				err := sess.SendCustomFrame(&testCustomFrame{frameType: 0x1})
+				Expect(err).To(MatchError("frame type 0x1 can't be used for custom frames"))
+			})
+
+			It("refuses to send frames that are too large", func() {
+				// the frame type is encoded in 1 byte
+				Expect(sess.SendCustomFrame(&testCustomFrame{frameType: 0x20, data: make([]byte, protocol.MaxCustomFrameSize-1)})).To(Succeed())
+				err := sess.SendCustomFrame(&testCustomFrame{frameType: 0x20, data: make([]byte, protocol.MaxCustomFrameSize)})
+				Expect(err).To(MatchError("custom frame too large"))
+			})
+
+			It("passes received custom frames to the application", func() {
+				var received []CustomFrame
+				sess.config.OnCustomFrame = func(s Session, f CustomFrame) {
+					Expect(s).To(Equal(sess))
+					received = append(received, f)
+				}
+				f := &testCustomFrame{frameType: 0x42, data: []byte("foobar")}
+				Expect(sess.handleFrame(&wire.CustomFrame{Frame: f}, 1, protocol.Encryption1RTT)).To(Succeed())
+				Expect(received).To(Equal([]CustomFrame{f}))
+			})
+
+			It("ignores received custom frames if no callback is set", func() {
+				f := &testCustomFrame{frameType: 0x42, data: []byte("foobar")}
+				Expect(sess.handleFrame(&wire.CustomFrame{Frame: f}, 1, protocol.Encryption1RTT)).To(Succeed())
+			})
+		})
+
+		Context("dropping keys", func() {
+			var (
+				sph *mockackhandler.MockSentPacketHandler
+				rph *mockackhandler.MockReceivedPacketHandler
+			)
+
+			BeforeEach(func() {
+				sph = mockackhandler.NewMockSentPacketHandler(mockCtrl)
+				sess.sentPacketHandler = sph
+				rph = mockackhandler.NewMockReceivedPacketHandler(mockCtrl)
+				sess.receivedPacketHandler = rph
+			})
+
+			expectDropKeys := func(encLevel protocol.EncryptionLevel) {
+				switch encLevel {
+				case protocol.EncryptionInitial:
+					cryptoSetup.EXPECT().DropInitialKeys()
+				case protocol.EncryptionHandshake:
+					cryptoSetup.EXPECT().DropHandshakeKeys()
+				}
+				sph.EXPECT().DropPackets(encLevel)
+				rph.EXPECT().DropPackets(encLevel)
+			}
+
+			getPackedPacket := func(packetType protocol.PacketType) *packedPacket {
+				return &packedPacket{
+					header: &wire.ExtendedHeader{Header: wire.Header{IsLongHeader: true, Type: packetType}},
+					buffer: getPacketBuffer(),
+				}
+			}
+
+			It("drops the Initial keys only once", func() {
+				expectDropKeys(protocol.EncryptionInitial)
+				sess.discardInitialKeys()
+				sess.discardInitialKeys()
+			})
+
+			It("drops the Initial keys when the server processes a Handshake packet", func() {
+				expectDropKeys(protocol.EncryptionInitial)
+				rph.EXPECT().ReceivedPacket(gomock.Any(), protocol.EncryptionHandshake, gomock.Any(), gomock.Any())
+				Expect(sess.handleUnpackedPacket(&unpackedPacket{
+					hdr:             &wire.ExtendedHeader{Header: wire.Header{IsLongHeader: true, Type: protocol.PacketTypeHandshake}},
+					encryptionLevel: protocol.EncryptionHandshake,
+					data:            []byte{0}, // PADDING
+				}, time.Now(), 1)).To(Succeed())
+			})
+
+			It("drops the Initial keys when the client sends a Handshake packet", func() {
+				sess.perspective = protocol.PerspectiveClient
+				Expect(sess.sendPackedPacket(getPackedPacket(protocol.PacketTypeInitial))).To(Succeed())
+				expectDropKeys(protocol.EncryptionInitial)
+				Expect(sess.sendPackedPacket(getPackedPacket(protocol.PacketTypeHandshake))).To(Succeed())
+			})
+
+			It("drops the Handshake keys when a 1-RTT packet is acknowledged after the handshake completed", func() {
+				sph.EXPECT().ReceivedAck(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(2)
+				sph.EXPECT().GetLowestPacketNotConfirmedAcked().AnyTimes()
+				rph.EXPECT().IgnoreBelow(gomock.Any()).AnyTimes()
+				ack := &wire.AckFrame{AckRanges: []wire.AckRange{{Smallest: 1, Largest: 1}}}
+				Expect(sess.handleAckFrame(ack, 0, protocol.Encryption1RTT)).To(Succeed())
+				sess.handshakeComplete = true
+				expectDropKeys(protocol.EncryptionInitial)
+				expectDropKeys(protocol.EncryptionHandshake)
+				Expect(sess.handleAckFrame(ack, 1, protocol.Encryption1RTT)).To(Succeed())
+			})
+
+			It("doesn't drop the Handshake keys when a Handshake packet is acknowledged", func() {
+				sess.handshakeComplete = true
+				sph.EXPECT().ReceivedAck(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any())
+				ack := &wire.AckFrame{AckRanges: []wire.AckRange{{Smallest: 1, Largest: 1}}}
+				Expect(sess.handleAckFrame(ack, 0, protocol.EncryptionHandshake)).To(Succeed())
+			})
+		})
+
 		Context("handling RESET_STREAM frames", func() {
 			It("closes the streams for writing", func() {
 				f := &wire.ResetStreamFrame{
@@ -314,6 +508,11 @@ var _ = Describe("Session", func() {
 			Expect(err).NotTo(HaveOccurred())
 		})
 
+		It("handles DATAGRAM frames", func() {
+			err := sess.handleFrame(&wire.DatagramFrame{Data: []byte("foobar")}, 0, protocol.Encryption1RTT)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
 		It("handles STREAM_ID_BLOCKED frames", func() {
 			err := sess.handleFrame(&wire.StreamsBlockedFrame{}, 0, protocol.EncryptionUnspecified)
 			Expect(err).NotTo(HaveOccurred())
@@ -337,6 +536,37 @@ var _ = Describe("Session", func() {
 			Expect(sess.handleFrame(ccf, 0, protocol.EncryptionUnspecified)).To(Succeed())
 			Eventually(sess.Context().Done()).Should(BeClosed())
 		})
+
+		It("returns a CryptoError when the peer closes the connection with a TLS alert", func() {
+			expectedErr := &CryptoError{Alert: 116, Remote: true, err: qerr.Error(qerr.CertificateRequired, "")}
+			streamManager.EXPECT().CloseWithError(expectedErr)
+			sessionRunner.EXPECT().Remove(gomock.Any())
+			cryptoSetup.EXPECT().Close()
+
+			go func() {
+				defer GinkgoRecover()
+				cryptoSetup.EXPECT().RunHandshake().Do(func() { <-sess.Context().Done() })
+				err := sess.run()
+				Expect(err).To(Equal(expectedErr))
+				Expect(err).To(MatchError("CRYPTO_ERROR: tls: certificate required"))
+			}()
+			ccf := &wire.ConnectionCloseFrame{ErrorCode: qerr.CertificateRequired}
+			Expect(sess.handleFrame(ccf, 0, protocol.EncryptionUnspecified)).To(Succeed())
+			Eventually(sess.Context().Done()).Should(BeClosed())
+		})
+	})
+
+	It("calls the OnReadAvailable callback", func() {
+		sess.onReadAvailable(nil, 10) // no callback set
+		str := NewMockReceiveStreamI(mockCtrl)
+		var called bool
+		sess.config.OnReadAvailable = func(s ReceiveStream, available int) {
+			Expect(s).To(Equal(str))
+			Expect(available).To(Equal(42))
+			called = true
+		}
+		sess.onReadAvailable(str, 42)
+		Expect(called).To(BeTrue())
 	})
 
 	It("tells its versions", func() {
@@ -468,6 +698,13 @@ var _ = Describe("Session", func() {
 		})
 	})
 
+	It("stores the TB used for error injection in the context", func() {
+		tb := &testTB{}
+		sess.config.testingTB = tb
+		Expect(sess.postSetup()).To(Succeed())
+		Expect(sess.testingTB()).To(Equal(tb))
+	})
+
 	Context("receiving packets", func() {
 		var unpacker *MockUnpacker
 
@@ -493,6 +730,22 @@ var _ = Describe("Session", func() {
 			Expect(sess.handlePacketImpl(getPacket(&wire.ExtendedHeader{Header: hdr}, nil))).To(BeFalse())
 		})
 
+		It("only unpacks long header packets of valid types", func() {
+			var unpacked []protocol.PacketType
+			unpacker.EXPECT().Unpack(gomock.Any(), gomock.Any()).DoAndReturn(func(hdr *wire.Header, _ []byte) (*unpackedPacket, error) {
+				unpacked = append(unpacked, hdr.Type)
+				return nil, errors.New("decryption failed")
+			}).AnyTimes()
+			for _, p := range longHeaderPacketsOfAllTypes(sess.srcConnID, sess.destConnID, sess.version) {
+				Expect(sess.handlePacketImpl(p)).To(BeFalse())
+			}
+			// 16 Initial and 16 Handshake packets, Retry and 0-RTT packets are dropped
+			Expect(unpacked).To(HaveLen(32))
+			for _, t := range unpacked {
+				Expect(t).To(Or(Equal(protocol.PacketTypeInitial), Equal(protocol.PacketTypeHandshake)))
+			}
+		})
+
 		It("informs the ReceivedPacketHandler about non-ack-eliciting packets", func() {
 			hdr := &wire.ExtendedHeader{
 				Header:          wire.Header{DestConnectionID: sess.srcConnID},
@@ -507,11 +760,13 @@ var _ = Describe("Session", func() {
 				data:            []byte{0}, // one PADDING frame
 			}, nil)
 			rph := mockackhandler.NewMockReceivedPacketHandler(mockCtrl)
+			rph.EXPECT().IsPotentiallyDuplicate(protocol.PacketNumber(0x1337), protocol.EncryptionInitial)
 			rph.EXPECT().ReceivedPacket(protocol.PacketNumber(0x1337), protocol.EncryptionInitial, rcvTime, false)
 			sess.receivedPacketHandler = rph
 			packet := getPacket(hdr, nil)
 			packet.rcvTime = rcvTime
 			Expect(sess.handlePacketImpl(packet)).To(BeTrue())
+			Expect(sess.lastActivityTime()).To(Equal(rcvTime))
 		})
 
 		It("informs the ReceivedPacketHandler about ack-eliciting packets", func() {
@@ -529,7 +784,10 @@ var _ = Describe("Session", func() {
 				hdr:             hdr,
 				data:            buf.Bytes(),
 			}, nil)
+			cryptoSetup.EXPECT().DropInitialKeys()
 			rph := mockackhandler.NewMockReceivedPacketHandler(mockCtrl)
+			rph.EXPECT().IsPotentiallyDuplicate(protocol.PacketNumber(0x1337), protocol.EncryptionHandshake)
+			rph.EXPECT().DropPackets(protocol.EncryptionInitial)
 			rph.EXPECT().ReceivedPacket(protocol.PacketNumber(0x1337), protocol.EncryptionHandshake, rcvTime, true)
 			sess.receivedPacketHandler = rph
 			packet := getPacket(hdr, nil)
@@ -537,6 +795,24 @@ var _ = Describe("Session", func() {
 			Expect(sess.handlePacketImpl(packet)).To(BeTrue())
 		})
 
+		It("drops duplicate packets", func() {
+			hdr := &wire.ExtendedHeader{
+				Header:          wire.Header{DestConnectionID: sess.srcConnID},
+				PacketNumber:    0x37,
+				PacketNumberLen: protocol.PacketNumberLen1,
+			}
+			unpacker.EXPECT().Unpack(gomock.Any(), gomock.Any()).Return(&unpackedPacket{
+				packetNumber:    0x1337,
+				encryptionLevel: protocol.Encryption1RTT,
+				hdr:             hdr,
+				data:            []byte{0}, // one PADDING frame
+			}, nil).Times(2)
+			Expect(sess.handlePacketImpl(getPacket(hdr, nil))).To(BeTrue())
+			Expect(sess.ConnectionStats().DroppedPackets).To(BeEmpty())
+			Expect(sess.handlePacketImpl(getPacket(hdr, nil))).To(BeFalse())
+			Expect(sess.ConnectionStats().DroppedPackets).To(Equal(map[PacketDropReason]uint64{PacketDropDuplicate: 1}))
+		})
+
 		It("drops a packet when unpacking fails", func() {
 			unpacker.EXPECT().Unpack(gomock.Any(), gomock.Any()).Return(nil, errors.New("unpack error"))
 			streamManager.EXPECT().CloseWithError(gomock.Any())
@@ -558,6 +834,30 @@ var _ = Describe("Session", func() {
 			Eventually(sess.Context().Done()).Should(BeClosed())
 		})
 
+		It("counts packets that fail to decrypt", func() {
+			unpacker.EXPECT().Unpack(gomock.Any(), gomock.Any()).Return(nil, errors.New("unpack error")).Times(3)
+			hdr := &wire.ExtendedHeader{
+				Header:          wire.Header{DestConnectionID: sess.srcConnID},
+				PacketNumberLen: protocol.PacketNumberLen1,
+			}
+			for i := 0; i < 3; i++ {
+				Expect(sess.handlePacketImpl(getPacket(hdr, nil))).To(BeFalse())
+			}
+			Expect(sess.ConnectionStats().DroppedPackets).To(Equal(map[PacketDropReason]uint64{PacketDropPayloadDecryptError: 3}))
+		})
+
+		It("counts packets dropped because the queue is full", func() {
+			hdr := &wire.ExtendedHeader{
+				Header:          wire.Header{DestConnectionID: sess.srcConnID},
+				PacketNumberLen: protocol.PacketNumberLen1,
+			}
+			// the session is not running, so packets are not taken from the queue
+			for i := 0; i < protocol.MaxSessionUnprocessedPackets+2; i++ {
+				sess.handlePacket(getPacket(hdr, nil))
+			}
+			Expect(sess.ConnectionStats().DroppedPackets).To(Equal(map[PacketDropReason]uint64{PacketDropBufferFull: 2}))
+		})
+
 		It("rejects packets with empty payload", func() {
 			unpacker.EXPECT().Unpack(gomock.Any(), gomock.Any()).Return(&unpackedPacket{
 				hdr:  &wire.ExtendedHeader{},
@@ -582,6 +882,111 @@ var _ = Describe("Session", func() {
 			Eventually(done).Should(BeClosed())
 		})
 
+		It("closes the session when receiving an ACK with invalid ECN counts", func() {
+			sess.sentPacketHandler.SentPacket(&ackhandler.Packet{
+				PacketNumber:    0,
+				Length:          1000,
+				EncryptionLevel: protocol.Encryption1RTT,
+				Frames:          []wire.Frame{&wire.PingFrame{}},
+				SendTime:        time.Now(),
+			})
+			buf := &bytes.Buffer{}
+			ack := &wire.AckFrame{
+				AckRanges: []wire.AckRange{{Smallest: 0, Largest: 0}},
+				ECNCE:     99999,
+			}
+			Expect(ack.Write(buf, sess.version)).To(Succeed())
+			unpacker.EXPECT().Unpack(gomock.Any(), gomock.Any()).Return(&unpackedPacket{
+				hdr:             &wire.ExtendedHeader{},
+				encryptionLevel: protocol.Encryption1RTT,
+				data:            buf.Bytes(),
+			}, nil)
+			streamManager.EXPECT().CloseWithError(gomock.Any())
+			cryptoSetup.EXPECT().Close()
+			packer.EXPECT().PackConnectionClose(gomock.Any()).DoAndReturn(func(f *wire.ConnectionCloseFrame) (*packedPacket, error) {
+				Expect(f.ErrorCode).To(Equal(qerr.ProtocolViolation))
+				return &packedPacket{}, nil
+			})
+			done := make(chan struct{})
+			go func() {
+				defer GinkgoRecover()
+				cryptoSetup.EXPECT().RunHandshake().Do(func() { <-sess.Context().Done() })
+				err := sess.run()
+				Expect(err).To(MatchError("PROTOCOL_VIOLATION: Received an ACK with ECN counts exceeding the number of acknowledged packets"))
+				close(done)
+			}()
+			sessionRunner.EXPECT().Retire(gomock.Any())
+			sess.handlePacket(getPacket(&wire.ExtendedHeader{
+				Header:          wire.Header{DestConnectionID: sess.srcConnID},
+				PacketNumberLen: protocol.PacketNumberLen1,
+			}, nil))
+			Eventually(done).Should(BeClosed())
+		})
+
+		It("sends the frame type when closing the connection due to an invalid frame", func() {
+			Expect(sess.perspective).To(Equal(protocol.PerspectiveServer))
+			buf := &bytes.Buffer{}
+			Expect((&wire.NewTokenFrame{Token: []byte("foobar")}).Write(buf, sess.version)).To(Succeed())
+			unpacker.EXPECT().Unpack(gomock.Any(), gomock.Any()).Return(&unpackedPacket{
+				hdr:             &wire.ExtendedHeader{},
+				encryptionLevel: protocol.Encryption1RTT,
+				data:            buf.Bytes(),
+			}, nil)
+			streamManager.EXPECT().CloseWithError(gomock.Any())
+			cryptoSetup.EXPECT().Close()
+			packer.EXPECT().PackConnectionClose(gomock.Any()).DoAndReturn(func(f *wire.ConnectionCloseFrame) (*packedPacket, error) {
+				Expect(f.ErrorCode).To(Equal(qerr.ProtocolViolation))
+				Expect(f.FrameType).To(Equal(uint64(0x7)))
+				return &packedPacket{}, nil
+			})
+			done := make(chan struct{})
+			go func() {
+				defer GinkgoRecover()
+				cryptoSetup.EXPECT().RunHandshake().Do(func() { <-sess.Context().Done() })
+				err := sess.run()
+				Expect(err).To(MatchError("PROTOCOL_VIOLATION: received NEW_TOKEN frame from the client"))
+				close(done)
+			}()
+			sessionRunner.EXPECT().Retire(gomock.Any())
+			sess.handlePacket(getPacket(&wire.ExtendedHeader{
+				Header:          wire.Header{DestConnectionID: sess.srcConnID},
+				PacketNumberLen: protocol.PacketNumberLen1,
+			}, nil))
+			Eventually(done).Should(BeClosed())
+		})
+
+		It("closes the connection with a FRAME_ENCODING_ERROR when receiving an unknown frame type", func() {
+			buf := &bytes.Buffer{}
+			Expect((&wire.PingFrame{}).Write(buf, sess.version)).To(Succeed())
+			utils.WriteVarInt(buf, 0x1f*500+0x1c)
+			unpacker.EXPECT().Unpack(gomock.Any(), gomock.Any()).Return(&unpackedPacket{
+				hdr:             &wire.ExtendedHeader{},
+				encryptionLevel: protocol.Encryption1RTT,
+				data:            buf.Bytes(),
+			}, nil)
+			streamManager.EXPECT().CloseWithError(gomock.Any())
+			cryptoSetup.EXPECT().Close()
+			packer.EXPECT().PackConnectionClose(gomock.Any()).DoAndReturn(func(f *wire.ConnectionCloseFrame) (*packedPacket, error) {
+				Expect(f.ErrorCode).To(Equal(qerr.FrameEncodingError))
+				Expect(f.FrameType).To(Equal(uint64(0x1f*500 + 0x1c)))
+				return &packedPacket{}, nil
+			})
+			done := make(chan struct{})
+			go func() {
+				defer GinkgoRecover()
+				cryptoSetup.EXPECT().RunHandshake().Do(func() { <-sess.Context().Done() })
+				err := sess.run()
+				Expect(err).To(MatchError(fmt.Sprintf("FRAME_ENCODING_ERROR: unknown frame type 0x%x at offset 1", 0x1f*500+0x1c)))
+				close(done)
+			}()
+			sessionRunner.EXPECT().Retire(gomock.Any())
+			sess.handlePacket(getPacket(&wire.ExtendedHeader{
+				Header:          wire.Header{DestConnectionID: sess.srcConnID},
+				PacketNumberLen: protocol.PacketNumberLen1,
+			}, nil))
+			Eventually(done).Should(BeClosed())
+		})
+
 		It("ignores 0-RTT packets", func() {
 			hdr := &wire.ExtendedHeader{
 				Header: wire.Header{
@@ -691,6 +1096,11 @@ var _ = Describe("Session", func() {
 				return int(hdrLen), packet
 			}
 
+			BeforeEach(func() {
+				// processing the first Handshake packet drops the Initial keys
+				cryptoSetup.EXPECT().DropInitialKeys().MaxTimes(1)
+			})
+
 			It("cuts packets to the right length", func() {
 				hdrLen, packet := getPacketWithLength(sess.srcConnID, 456)
 				unpacker.EXPECT().Unpack(gomock.Any(), gomock.Any()).DoAndReturn(func(_ *wire.Header, data []byte) (*unpackedPacket, error) {
@@ -744,6 +1154,87 @@ var _ = Describe("Session", func() {
 				Expect(sess.undecryptablePackets[0].data).To(HaveLen(hdrLen1 + 456 - 3))
 			})
 
+			It("continues with the next packet if a packet can't be decrypted", func() {
+				_, packet1 := getPacketWithLength(sess.srcConnID, 456)
+				hdrLen2, packet2 := getPacketWithLength(sess.srcConnID, 123)
+				gomock.InOrder(
+					unpacker.EXPECT().Unpack(gomock.Any(), gomock.Any()).Return(nil, errors.New("authentication failed")),
+					unpacker.EXPECT().Unpack(gomock.Any(), gomock.Any()).DoAndReturn(func(_ *wire.Header, data []byte) (*unpackedPacket, error) {
+						Expect(data).To(HaveLen(hdrLen2 + 123 - 3))
+						return &unpackedPacket{
+							encryptionLevel: protocol.EncryptionHandshake,
+							data:            []byte{0},
+						}, nil
+					}),
+				)
+				packet1.data = append(packet1.data, packet2.data...)
+				Expect(sess.handlePacketImpl(packet1)).To(BeTrue())
+			})
+
+			It("processes the first packet if a trailing packet can't be decrypted", func() {
+				hdrLen1, packet1 := getPacketWithLength(sess.srcConnID, 456)
+				_, packet2 := getPacketWithLength(sess.srcConnID, 123)
+				gomock.InOrder(
+					unpacker.EXPECT().Unpack(gomock.Any(), gomock.Any()).DoAndReturn(func(_ *wire.Header, data []byte) (*unpackedPacket, error) {
+						Expect(data).To(HaveLen(hdrLen1 + 456 - 3))
+						return &unpackedPacket{
+							encryptionLevel: protocol.EncryptionHandshake,
+							data:            []byte{0},
+						}, nil
+					}),
+					unpacker.EXPECT().Unpack(gomock.Any(), gomock.Any()).Return(nil, errors.New("authentication failed")),
+				)
+				packet1.data = append(packet1.data, packet2.data...)
+				Expect(sess.handlePacketImpl(packet1)).To(BeTrue())
+				Expect(sess.undecryptablePackets).To(BeEmpty())
+			})
+
+			It("handles a short header packet coalesced after a long header packet", func() {
+				hdrLen1, packet1 := getPacketWithLength(sess.srcConnID, 456)
+				packet2 := getPacket(&wire.ExtendedHeader{
+					Header:          wire.Header{DestConnectionID: sess.srcConnID},
+					PacketNumber:    0x1337,
+					PacketNumberLen: protocol.PacketNumberLen2,
+				}, bytes.Repeat([]byte{0x42}, 200))
+				gomock.InOrder(
+					unpacker.EXPECT().Unpack(gomock.Any(), gomock.Any()).DoAndReturn(func(hdr *wire.Header, data []byte) (*unpackedPacket, error) {
+						Expect(hdr.IsLongHeader).To(BeTrue())
+						Expect(data).To(HaveLen(hdrLen1 + 456 - 3))
+						return &unpackedPacket{
+							encryptionLevel: protocol.EncryptionHandshake,
+							data:            []byte{0},
+						}, nil
+					}),
+					unpacker.EXPECT().Unpack(gomock.Any(), gomock.Any()).DoAndReturn(func(hdr *wire.Header, data []byte) (*unpackedPacket, error) {
+						Expect(hdr.IsLongHeader).To(BeFalse())
+						// the short header packet fills the rest of the datagram
+						Expect(data).To(Equal(packet2.data))
+						return &unpackedPacket{
+							packetNumber:    0x1337,
+							encryptionLevel: protocol.Encryption1RTT,
+							hdr:             &wire.ExtendedHeader{PacketNumber: 0x1337},
+							data:            []byte{0},
+						}, nil
+					}),
+				)
+				packet1.data = append(packet1.data, packet2.data...)
+				Expect(sess.handlePacketImpl(packet1)).To(BeTrue())
+			})
+
+			It("stops parsing when it encounters garbage", func() {
+				hdrLen1, packet1 := getPacketWithLength(sess.srcConnID, 456)
+				unpacker.EXPECT().Unpack(gomock.Any(), gomock.Any()).DoAndReturn(func(_ *wire.Header, data []byte) (*unpackedPacket, error) {
+					Expect(data).To(HaveLen(hdrLen1 + 456 - 3))
+					return &unpackedPacket{
+						encryptionLevel: protocol.EncryptionHandshake,
+						data:            []byte{0},
+					}, nil
+				})
+				// a truncated long header
+				packet1.data = append(packet1.data, 0xc0, 0x1)
+				Expect(sess.handlePacketImpl(packet1)).To(BeTrue())
+			})
+
 			It("ignores coalesced packet parts if the destination connection IDs don't match", func() {
 				wrongConnID := protocol.ConnectionID{0xde, 0xad, 0xbe, 0xef}
 				Expect(sess.srcConnID).ToNot(Equal(wrongConnID))
@@ -794,6 +1285,9 @@ var _ = Describe("Session", func() {
 		It("sends ACK only packets", func() {
 			sph := mockackhandler.NewMockSentPacketHandler(mockCtrl)
 			sph.EXPECT().GetAlarmTimeout().AnyTimes()
+			sph.EXPECT().GetStats().AnyTimes()
+			sph.EXPECT().GetCongestionWindow().AnyTimes()
+			sph.EXPECT().GetBytesInFlight().AnyTimes()
 			sph.EXPECT().SendMode().Return(ackhandler.SendAck)
 			sph.EXPECT().ShouldSendNumPackets().Return(1000)
 			packer.EXPECT().MaybePackAckPacket()
@@ -887,10 +1381,28 @@ var _ = Describe("Session", func() {
 			Expect(sess.sendPackets()).To(Succeed())
 		})
 
-		It("doesn't send when the SentPacketHandler doesn't allow it", func() {
+		It("sends a PING as a probe packet if there's no packet to retransmit", func() {
 			sph := mockackhandler.NewMockSentPacketHandler(mockCtrl)
-			sph.EXPECT().SendMode().Return(ackhandler.SendNone)
-			sess.sentPacketHandler = sph
+			sph.EXPECT().TimeUntilSend()
+			sph.EXPECT().SendMode().Return(ackhandler.SendPTO)
+			sph.EXPECT().ShouldSendNumPackets().Return(1)
+			sph.EXPECT().DequeueProbePacket()
+			gomock.InOrder(
+				packer.EXPECT().QueuePing(),
+				packer.EXPECT().PackPacket().Return(getPacket(123), nil),
+			)
+			sph.EXPECT().SentPacket(gomock.Any()).Do(func(p *ackhandler.Packet) {
+				Expect(p.PacketNumber).To(Equal(protocol.PacketNumber(123)))
+			})
+			sess.sentPacketHandler = sph
+			Expect(sess.sendPackets()).To(Succeed())
+			Expect(mconn.written).To(HaveLen(1))
+		})
+
+		It("doesn't send when the SentPacketHandler doesn't allow it", func() {
+			sph := mockackhandler.NewMockSentPacketHandler(mockCtrl)
+			sph.EXPECT().SendMode().Return(ackhandler.SendNone)
+			sess.sentPacketHandler = sph
 			err := sess.sendPackets()
 			Expect(err).ToNot(HaveOccurred())
 		})
@@ -901,6 +1413,9 @@ var _ = Describe("Session", func() {
 			BeforeEach(func() {
 				sph = mockackhandler.NewMockSentPacketHandler(mockCtrl)
 				sph.EXPECT().GetAlarmTimeout().AnyTimes()
+				sph.EXPECT().GetStats().AnyTimes()
+				sph.EXPECT().GetCongestionWindow().AnyTimes()
+				sph.EXPECT().GetBytesInFlight().AnyTimes()
 				sph.EXPECT().DequeuePacketForRetransmission().AnyTimes()
 				sess.sentPacketHandler = sph
 				streamManager.EXPECT().CloseWithError(gomock.Any())
@@ -1014,6 +1529,40 @@ var _ = Describe("Session", func() {
 				Eventually(done).Should(BeClosed())
 			})
 
+			It("limits the size of bursts", func() {
+				Expect(sess.config.MaxBurstPackets).To(Equal(protocol.DefaultMaxBurstPackets))
+				numPackets := protocol.DefaultMaxBurstPackets + 5
+				sph.EXPECT().SentPacket(gomock.Any()).Times(numPackets)
+				gomock.InOrder(
+					sph.EXPECT().ShouldSendNumPackets().Return(numPackets),
+					sph.EXPECT().ShouldSendNumPackets().Return(5),
+				)
+				// The first burst is limited, and the pacer doesn't set a deadline.
+				// The session needs to continue sending nevertheless.
+				sph.EXPECT().TimeUntilSend().Times(3)
+				sph.EXPECT().TimeUntilSend().Return(time.Now().Add(time.Hour))
+				sph.EXPECT().SendMode().Return(ackhandler.SendAny).Times(numPackets)
+				for i := 0; i < numPackets; i++ {
+					packer.EXPECT().PackPacket().Return(getPacket(protocol.PacketNumber(1000+i)), nil)
+				}
+				done := make(chan struct{})
+				go func() {
+					defer GinkgoRecover()
+					cryptoSetup.EXPECT().RunHandshake().Do(func() { <-sess.Context().Done() })
+					sess.run()
+					close(done)
+				}()
+				sess.scheduleSending()
+				Eventually(mconn.written).Should(HaveLen(numPackets))
+				Consistently(mconn.written).Should(HaveLen(numPackets))
+				// make the go routine return
+				packer.EXPECT().PackConnectionClose(gomock.Any()).Return(&packedPacket{}, nil)
+				sessionRunner.EXPECT().Retire(gomock.Any())
+				cryptoSetup.EXPECT().Close()
+				sess.Close()
+				Eventually(done).Should(BeClosed())
+			})
+
 			It("doesn't set a pacing timer when there is no data to send", func() {
 				sph.EXPECT().TimeUntilSend().Return(time.Now())
 				sph.EXPECT().ShouldSendNumPackets().Return(1)
@@ -1041,6 +1590,9 @@ var _ = Describe("Session", func() {
 			It("sends when scheduleSending is called", func() {
 				sph := mockackhandler.NewMockSentPacketHandler(mockCtrl)
 				sph.EXPECT().GetAlarmTimeout().AnyTimes()
+				sph.EXPECT().GetStats().AnyTimes()
+				sph.EXPECT().GetCongestionWindow().AnyTimes()
+				sph.EXPECT().GetBytesInFlight().AnyTimes()
 				sph.EXPECT().TimeUntilSend().AnyTimes()
 				sph.EXPECT().SendMode().Return(ackhandler.SendAny).AnyTimes()
 				sph.EXPECT().ShouldSendNumPackets().AnyTimes().Return(1)
@@ -1071,6 +1623,9 @@ var _ = Describe("Session", func() {
 				sph.EXPECT().TimeUntilSend().Return(time.Now())
 				sph.EXPECT().TimeUntilSend().Return(time.Now().Add(time.Hour))
 				sph.EXPECT().GetAlarmTimeout().AnyTimes()
+				sph.EXPECT().GetStats().AnyTimes()
+				sph.EXPECT().GetCongestionWindow().AnyTimes()
+				sph.EXPECT().GetBytesInFlight().AnyTimes()
 				sph.EXPECT().SendMode().Return(ackhandler.SendAny).AnyTimes()
 				sph.EXPECT().ShouldSendNumPackets().Return(1)
 				sph.EXPECT().SentPacket(gomock.Any()).Do(func(p *ackhandler.Packet) {
@@ -1115,6 +1670,120 @@ var _ = Describe("Session", func() {
 		Eventually(sess.Context().Done()).Should(BeClosed())
 	})
 
+	It("closes with a CryptoError when the handshake fails", func() {
+		expectedErr := &CryptoError{Alert: 42, err: qerr.CryptoError(42, "bad certificate")}
+		streamManager.EXPECT().CloseWithError(expectedErr)
+		sessionRunner.EXPECT().Retire(gomock.Any())
+		cryptoSetup.EXPECT().Close()
+		packer.EXPECT().PackConnectionClose(gomock.Any()).DoAndReturn(func(f *wire.ConnectionCloseFrame) (*packedPacket, error) {
+			Expect(f.ErrorCode).To(Equal(qerr.ErrorCode(0x100 + 42)))
+			Expect(f.ReasonPhrase).To(BeEmpty())
+			return &packedPacket{}, nil
+		})
+		done := make(chan struct{})
+		go func() {
+			defer GinkgoRecover()
+			cryptoSetup.EXPECT().RunHandshake().Return(qerr.CryptoError(42, "bad certificate"))
+			err := sess.run()
+			Expect(err).To(Equal(expectedErr))
+			close(done)
+		}()
+		Eventually(done).Should(BeClosed())
+	})
+
+	Context("verifying the connection", func() {
+		It("calls VerifyConnection before completing the handshake", func() {
+			state := tls.ConnectionState{NegotiatedProtocol: "proto"}
+			cryptoSetup.EXPECT().ConnectionState().Return(state)
+			verified := make(chan struct{})
+			sess.config.VerifyConnection = func(s tls.ConnectionState, session Session) error {
+				defer GinkgoRecover()
+				Expect(s).To(Equal(state))
+				Expect(session).To(Equal(sess))
+				close(verified)
+				return nil
+			}
+			packer.EXPECT().PackPacket().AnyTimes()
+			handshakeCompleted := make(chan struct{})
+			go func() {
+				defer GinkgoRecover()
+				sessionRunner.EXPECT().OnHandshakeComplete(gomock.Any()).Do(func(Session) {
+					defer GinkgoRecover()
+					Expect(verified).To(BeClosed())
+					close(handshakeCompleted)
+				})
+				cryptoSetup.EXPECT().RunHandshake()
+				sess.run()
+			}()
+			Eventually(handshakeCompleted).Should(BeClosed())
+			// make sure the go routine returns
+			sessionRunner.EXPECT().Retire(gomock.Any())
+			streamManager.EXPECT().CloseWithError(gomock.Any())
+			packer.EXPECT().PackConnectionClose(gomock.Any()).Return(&packedPacket{}, nil)
+			cryptoSetup.EXPECT().Close()
+			Expect(sess.Close()).To(Succeed())
+			Eventually(sess.Context().Done()).Should(BeClosed())
+		})
+
+		It("closes with a certificate_required alert when VerifyConnection fails", func() {
+			cryptoSetup.EXPECT().ConnectionState()
+			sess.config.VerifyConnection = func(tls.ConnectionState, Session) error {
+				return errors.New("unknown device")
+			}
+			expectedErr := &CryptoError{Alert: 116, err: qerr.Error(qerr.CertificateRequired, "unknown device")}
+			streamManager.EXPECT().CloseWithError(expectedErr)
+			sessionRunner.EXPECT().Retire(gomock.Any())
+			cryptoSetup.EXPECT().Close()
+			packer.EXPECT().PackConnectionClose(gomock.Any()).DoAndReturn(func(f *wire.ConnectionCloseFrame) (*packedPacket, error) {
+				Expect(f.ErrorCode).To(Equal(qerr.ErrorCode(0x100 + 116)))
+				return &packedPacket{}, nil
+			})
+			done := make(chan struct{})
+			go func() {
+				defer GinkgoRecover()
+				cryptoSetup.EXPECT().RunHandshake()
+				err := sess.run()
+				Expect(err).To(Equal(expectedErr))
+				close(done)
+			}()
+			Eventually(done).Should(BeClosed())
+		})
+	})
+
+	Context("peer certificates", func() {
+		It("returns the peer's certificates", func() {
+			leaf := &x509.Certificate{Subject: pkix.Name{CommonName: "client.example.com"}}
+			ca := &x509.Certificate{Subject: pkix.Name{CommonName: "CA"}}
+			state := tls.ConnectionState{
+				PeerCertificates: []*x509.Certificate{leaf, ca},
+				VerifiedChains:   [][]*x509.Certificate{{leaf, ca}},
+			}
+			cryptoSetup.EXPECT().ConnectionState().Return(state).Times(3)
+			Expect(sess.PeerCertificates()).To(Equal([]*x509.Certificate{leaf, ca}))
+			Expect(sess.VerifiedChains()).To(Equal([][]*x509.Certificate{{leaf, ca}}))
+			Expect(sess.PeerCommonName()).To(Equal("client.example.com"))
+		})
+
+		It("returns an empty common name if the peer didn't present a certificate", func() {
+			cryptoSetup.EXPECT().ConnectionState()
+			Expect(sess.PeerCommonName()).To(BeEmpty())
+		})
+
+		It("exports keying material", func() {
+			cryptoSetup.EXPECT().ExportKeyingMaterial("label", []byte("context"), 42).Return([]byte("foobar"), nil)
+			key, err := sess.ExportKeyingMaterial("label", []byte("context"), 42)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(key).To(Equal([]byte("foobar")))
+		})
+
+		It("returns the error when exporting keying material fails", func() {
+			testErr := errors.New("handshake not complete")
+			cryptoSetup.EXPECT().ExportKeyingMaterial("label", nil, 32).Return(nil, testErr)
+			_, err := sess.ExportKeyingMaterial("label", nil, 32)
+			Expect(err).To(MatchError(testErr))
+		})
+	})
+
 	It("calls the onHandshakeComplete callback when the handshake completes", func() {
 		packer.EXPECT().PackPacket().AnyTimes()
 		go func() {
@@ -1133,6 +1802,40 @@ var _ = Describe("Session", func() {
 		Eventually(sess.Context().Done()).Should(BeClosed())
 	})
 
+	It("calls the OnHandshakeComplete event hook when the handshake completes", func() {
+		called := make(chan Session, 1)
+		sess.config.EventHooks.OnHandshakeComplete = func(s Session) { called <- s }
+		packer.EXPECT().PackPacket().AnyTimes()
+		go func() {
+			defer GinkgoRecover()
+			sessionRunner.EXPECT().OnHandshakeComplete(gomock.Any())
+			cryptoSetup.EXPECT().RunHandshake()
+			sess.run()
+		}()
+		Eventually(called).Should(Receive(Equal(sess)))
+		// make sure the go routine returns
+		sessionRunner.EXPECT().Retire(gomock.Any())
+		streamManager.EXPECT().CloseWithError(gomock.Any())
+		packer.EXPECT().PackConnectionClose(gomock.Any()).Return(&packedPacket{}, nil)
+		cryptoSetup.EXPECT().Close()
+		Expect(sess.Close()).To(Succeed())
+		Eventually(sess.Context().Done()).Should(BeClosed())
+	})
+
+	It("calls the OnStreamClosed event hook when a stream is completed", func() {
+		var closedID protocol.StreamID
+		var closedErr error
+		sess.config.EventHooks.OnStreamClosed = func(id protocol.StreamID, err error) {
+			closedID = id
+			closedErr = err
+		}
+		testErr := errors.New("stream canceled")
+		streamManager.EXPECT().DeleteStream(protocol.StreamID(5))
+		sess.onStreamCompleted(5, testErr)
+		Expect(closedID).To(Equal(protocol.StreamID(5)))
+		Expect(closedErr).To(MatchError(testErr))
+	})
+
 	It("sends a forward-secure packet when the handshake completes", func() {
 		done := make(chan struct{})
 		gomock.InOrder(
@@ -1161,6 +1864,218 @@ var _ = Describe("Session", func() {
 		Eventually(sess.Context().Done()).Should(BeClosed())
 	})
 
+	It("reports the estimated bandwidth in the connection stats", func() {
+		sph := mockackhandler.NewMockSentPacketHandler(mockCtrl)
+		sph.EXPECT().DeliveryRate().Return(1.25e6)
+		sess.sentPacketHandler = sph
+		Expect(sess.ConnectionStats().EstimatedBandwidthBps).To(Equal(1.25e6))
+	})
+
+	Context("connection stats", func() {
+		It("takes a snapshot of the RTT and the congestion state", func() {
+			sph := mockackhandler.NewMockSentPacketHandler(mockCtrl)
+			sph.EXPECT().DeliveryRate().AnyTimes()
+			sph.EXPECT().ReceivedAck(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Do(func(*wire.AckFrame, protocol.PacketNumber, protocol.EncryptionLevel, time.Time) {
+				sess.rttStats.UpdateRTT(30*time.Millisecond, 0, time.Now())
+			})
+			sph.EXPECT().GetStats().Return(ackhandler.SentPacketStats{
+				PacketsLost:             1,
+				BytesLost:               1000,
+				PacketsRetransmitted:    2,
+				BytesRetransmitted:      1500,
+				ProbeTimeouts:           3,
+				SpuriousLosses:          4,
+				SpuriousRetransmissions: 2,
+				PacketLossRate:          0.1,
+			})
+			sph.EXPECT().GetCongestionWindow().Return(protocol.ByteCount(10000))
+			sph.EXPECT().GetBytesInFlight().Return(protocol.ByteCount(5000))
+			sess.sentPacketHandler = sph
+			ack := &wire.AckFrame{AckRanges: []wire.AckRange{{Smallest: 1, Largest: 1}}}
+			Expect(sess.handleAckFrame(ack, 0, protocol.EncryptionHandshake)).To(Succeed())
+			// the snapshot is only updated by the run loop
+			Expect(sess.ConnectionStats().SmoothedRTT).To(BeZero())
+			sess.updateStats()
+			stats := sess.ConnectionStats()
+			Expect(stats.SmoothedRTT).To(Equal(30 * time.Millisecond))
+			Expect(stats.MinRTT).To(Equal(30 * time.Millisecond))
+			Expect(stats.LatestRTT).To(Equal(30 * time.Millisecond))
+			Expect(stats.RTTVariance).To(Equal(15 * time.Millisecond))
+			Expect(stats.CongestionWindow).To(Equal(protocol.ByteCount(10000)))
+			Expect(stats.BytesInFlight).To(Equal(protocol.ByteCount(5000)))
+			Expect(stats.PacketsLost).To(BeEquivalentTo(1))
+			Expect(stats.BytesLost).To(Equal(protocol.ByteCount(1000)))
+			Expect(stats.PacketsRetransmitted).To(BeEquivalentTo(2))
+			Expect(stats.BytesRetransmitted).To(Equal(protocol.ByteCount(1500)))
+			Expect(stats.ProbeTimeouts).To(BeEquivalentTo(3))
+			Expect(stats.SpuriousLosses).To(BeEquivalentTo(4))
+			Expect(stats.SpuriousRetransmissions).To(BeEquivalentTo(2))
+			Expect(stats.PacketLossRate).To(Equal(0.1))
+			Expect(stats.RecentRTTSamples).To(Equal([]time.Duration{30 * time.Millisecond}))
+		})
+
+		It("returns a copy of the recent RTT samples", func() {
+			sph := mockackhandler.NewMockSentPacketHandler(mockCtrl)
+			sph.EXPECT().DeliveryRate().AnyTimes()
+			sph.EXPECT().GetStats().AnyTimes()
+			sph.EXPECT().GetCongestionWindow().AnyTimes()
+			sph.EXPECT().GetBytesInFlight().AnyTimes()
+			sess.sentPacketHandler = sph
+			sess.rttStats.UpdateRTT(30*time.Millisecond, 0, time.Now())
+			sess.updateStats()
+			stats := sess.ConnectionStats()
+			sess.rttStats.UpdateRTT(40*time.Millisecond, 0, time.Now())
+			sess.updateStats()
+			Expect(stats.RecentRTTSamples).To(Equal([]time.Duration{30 * time.Millisecond}))
+			Expect(sess.ConnectionStats().RecentRTTSamples).To(Equal([]time.Duration{30 * time.Millisecond, 40 * time.Millisecond}))
+		})
+
+		It("counts the packets sent and received", func() {
+			Expect(sess.sendPackedPacket(&packedPacket{raw: []byte("foobar"), buffer: getPacketBuffer()})).To(Succeed())
+			Expect(sess.sendPackedPacket(&packedPacket{raw: []byte("foo"), buffer: getPacketBuffer()})).To(Succeed())
+			rph := mockackhandler.NewMockReceivedPacketHandler(mockCtrl)
+			rph.EXPECT().ReceivedPacket(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any())
+			sess.receivedPacketHandler = rph
+			buf := &bytes.Buffer{}
+			Expect((&wire.PingFrame{}).Write(buf, sess.version)).To(Succeed())
+			Expect(sess.handleUnpackedPacket(&unpackedPacket{
+				packetNumber:    0x37,
+				hdr:             &wire.ExtendedHeader{PacketNumber: 0x37},
+				encryptionLevel: protocol.Encryption1RTT,
+				data:            buf.Bytes(),
+			}, time.Now(), 42)).To(Succeed())
+			sess.updateStats()
+			stats := sess.ConnectionStats()
+			Expect(stats.PacketsSent).To(BeEquivalentTo(2))
+			Expect(stats.BytesSent).To(Equal(protocol.ByteCount(9)))
+			Expect(stats.LargestPacketSent).To(Equal(protocol.ByteCount(6)))
+			Expect(stats.PacketsReceived).To(BeEquivalentTo(1))
+			Expect(stats.BytesReceived).To(Equal(protocol.ByteCount(42)))
+		})
+
+		It("counts the streams opened and closed by both sides", func() {
+			Expect(sess.perspective).To(Equal(protocol.PerspectiveServer))
+			sess.onStreamOpened(1)
+			sess.onStreamOpened(3)
+			sess.onStreamOpened(4)
+			streamManager.EXPECT().DeleteStream(protocol.StreamID(4))
+			sess.onStreamCompleted(4, nil)
+			stats := sess.ConnectionStats()
+			Expect(stats.LocalStreamsOpened).To(BeEquivalentTo(2))
+			Expect(stats.RemoteStreamsOpened).To(BeEquivalentTo(1))
+			Expect(stats.LocalStreamsClosed).To(BeZero())
+			Expect(stats.RemoteStreamsClosed).To(BeEquivalentTo(1))
+		})
+
+		It("reports the duration of the handshake", func() {
+			sess.sessionCreationTime = time.Now().Add(-time.Second)
+			sessionRunner.EXPECT().OnHandshakeComplete(sess)
+			sess.handleHandshakeComplete()
+			Expect(sess.ConnectionStats().HandshakeDuration).To(BeNumerically("~", time.Second, 100*time.Millisecond))
+		})
+
+		It("reports the final stats after the session was closed", func() {
+			sess.packetsSent = 42
+			done := make(chan struct{})
+			go func() {
+				defer GinkgoRecover()
+				cryptoSetup.EXPECT().RunHandshake().Do(func() { <-sess.Context().Done() })
+				sess.run()
+				close(done)
+			}()
+			streamManager.EXPECT().CloseWithError(gomock.Any())
+			sessionRunner.EXPECT().Remove(gomock.Any())
+			cryptoSetup.EXPECT().Close()
+			sess.destroy(errors.New("test error"))
+			Eventually(done).Should(BeClosed())
+			Expect(sess.ConnectionStats().PacketsSent).To(BeEquivalentTo(42))
+		})
+	})
+
+	It("sends an address validation token when the handshake completes", func() {
+		mconn.remoteAddr = &net.UDPAddr{IP: net.IPv4(192, 168, 13, 37), Port: 1337}
+		var err error
+		sess.cookieGenerator, err = handshake.NewCookieGenerator(func() ([32]byte, [32]byte) { return [32]byte{1, 2, 3}, [32]byte{} })
+		Expect(err).ToNot(HaveOccurred())
+		sessionRunner.EXPECT().OnHandshakeComplete(sess)
+		sess.handleHandshakeComplete()
+		frames, _ := sess.framer.AppendControlFrames(nil, protocol.MaxByteCount)
+		var token []byte
+		for _, f := range frames {
+			if ntf, ok := f.(*wire.NewTokenFrame); ok {
+				token = ntf.Token
+			}
+		}
+		Expect(token).ToNot(BeEmpty())
+		cookie, err := sess.cookieGenerator.DecodeToken(token)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(cookie.IsRetryToken).To(BeFalse())
+		Expect(validateNewToken(mconn.RemoteAddr(), &Cookie{RemoteAddr: cookie.RemoteAddr, SentTime: cookie.SentTime}, time.Hour, time.Now())).To(BeTrue())
+	})
+
+	It("doesn't send an address validation token if no key is configured", func() {
+		sessionRunner.EXPECT().OnHandshakeComplete(sess)
+		sess.handleHandshakeComplete()
+		frames, _ := sess.framer.AppendControlFrames(nil, protocol.MaxByteCount)
+		Expect(frames).To(Equal([]wire.Frame{&wire.PingFrame{}}))
+	})
+
+	Context("accepting sessions early", func() {
+		BeforeEach(func() {
+			sess.cryptoStreamManager = newCryptoStreamManager(cryptoSetup, newCryptoStream(), newCryptoStream(), newCryptoStream())
+		})
+
+		It("notifies the runner after sending the first flight", func() {
+			clientHello := []byte{1, 0, 0, 2, 'f', 'o'}
+			cryptoSetup.EXPECT().HandleMessage(clientHello, protocol.EncryptionInitial).Return(true)
+			Expect(sess.handleCryptoFrame(&wire.CryptoFrame{Data: clientHello}, protocol.EncryptionInitial)).To(Succeed())
+			Expect(sess.earlySessionReady).To(BeTrue())
+
+			sph := mockackhandler.NewMockSentPacketHandler(mockCtrl)
+			sph.EXPECT().GetAlarmTimeout().AnyTimes()
+			sph.EXPECT().GetStats().AnyTimes()
+			sph.EXPECT().GetCongestionWindow().AnyTimes()
+			sph.EXPECT().GetBytesInFlight().AnyTimes()
+			sph.EXPECT().TimeUntilSend().AnyTimes()
+			sph.EXPECT().SendMode().Return(ackhandler.SendNone).AnyTimes()
+			sess.sentPacketHandler = sph
+			notified := make(chan struct{})
+			sessionRunner.EXPECT().OnEarlySessionReady(sess).Do(func(quicSession) { close(notified) })
+			done := make(chan struct{})
+			go func() {
+				defer GinkgoRecover()
+				cryptoSetup.EXPECT().RunHandshake().Do(func() { <-sess.Context().Done() })
+				sess.run()
+				close(done)
+			}()
+			sess.scheduleSending()
+			Eventually(notified).Should(BeClosed())
+			Expect(sess.HandshakeComplete().Err()).ToNot(HaveOccurred())
+			// make the go routine return
+			streamManager.EXPECT().CloseWithError(gomock.Any())
+			sessionRunner.EXPECT().Retire(gomock.Any())
+			packer.EXPECT().PackConnectionClose(gomock.Any()).Return(&packedPacket{}, nil)
+			cryptoSetup.EXPECT().Close()
+			Expect(sess.Close()).To(Succeed())
+			Eventually(done).Should(BeClosed())
+			Expect(sess.HandshakeComplete().Done()).To(BeClosed())
+		})
+
+		It("doesn't notify the runner when receiving a Handshake message", func() {
+			finished := []byte{20, 0, 0, 2, 'f', 'o'}
+			cryptoSetup.EXPECT().HandleMessage(finished, protocol.EncryptionHandshake).Return(true)
+			Expect(sess.handleCryptoFrame(&wire.CryptoFrame{Data: finished}, protocol.EncryptionHandshake)).To(Succeed())
+			Expect(sess.earlySessionReady).To(BeFalse())
+		})
+
+		It("cancels the handshake context when the handshake completes", func() {
+			sessionRunner.EXPECT().OnHandshakeComplete(sess)
+			Expect(sess.HandshakeComplete().Done()).ToNot(BeClosed())
+			sess.handleHandshakeComplete()
+			Expect(sess.HandshakeComplete().Done()).To(BeClosed())
+		})
+	})
+
 	It("doesn't return a run error when closing", func() {
 		done := make(chan struct{})
 		go func() {
@@ -1236,6 +2151,23 @@ var _ = Describe("Session", func() {
 			sess.Close()
 			Eventually(sess.Context().Done()).Should(BeClosed())
 		})
+
+		It("returns the peer's custom transport parameters", func() {
+			Expect(sess.PeerTransportParameters()).To(BeNil())
+			params := &handshake.TransportParameters{
+				MaxPacketSize:    protocol.MaxReceivePacketSize,
+				CustomParameters: map[uint64][]byte{0x1337: []byte("foobar")},
+			}
+			streamManager.EXPECT().UpdateLimits(gomock.Any())
+			packer.EXPECT().HandleTransportParameters(gomock.Any())
+			sess.processTransportParameters(params.Marshal())
+			custom := sess.PeerTransportParameters()
+			Expect(custom).To(Equal(map[uint64][]byte{0x1337: []byte("foobar")}))
+			// modifying the returned map doesn't change the session's state
+			custom[0x1337][0] = 'F'
+			custom[0x42] = []byte("foo")
+			Expect(sess.PeerTransportParameters()).To(Equal(map[uint64][]byte{0x1337: []byte("foobar")}))
+		})
 	})
 
 	Context("keep-alives", func() {
@@ -1252,10 +2184,13 @@ var _ = Describe("Session", func() {
 			sess.config.KeepAlive = true
 			sess.lastPacketReceivedTime = time.Now().Add(-remoteIdleTimeout / 2)
 			sent := make(chan struct{})
-			packer.EXPECT().PackPacket().Do(func() (*packedPacket, error) {
-				close(sent)
-				return nil, nil
-			})
+			gomock.InOrder(
+				packer.EXPECT().QueuePing(),
+				packer.EXPECT().PackPacket().Do(func() (*packedPacket, error) {
+					close(sent)
+					return nil, nil
+				}),
+			)
 			done := make(chan struct{})
 			go func() {
 				defer GinkgoRecover()
@@ -1418,6 +2353,405 @@ var _ = Describe("Session", func() {
 			sess.Close()
 			Eventually(sess.Context().Done()).Should(BeClosed())
 		})
+
+		It("doesn't time out the handshake on a high latency path, when dialing", func() {
+			sess.perspective = protocol.PerspectiveClient
+			Expect(sess.config.IdleTimeoutMultiplier).To(BeEquivalentTo(protocol.DefaultIdleTimeoutMultiplier))
+			sess.sessionCreationTime = time.Now().Add(-protocol.DefaultHandshakeTimeout).Add(-time.Second)
+			sess.rttStats.UpdateRTT(500*time.Millisecond, 0, time.Now())
+			go func() {
+				defer GinkgoRecover()
+				cryptoSetup.EXPECT().RunHandshake().Do(func() { <-sess.Context().Done() })
+				sess.run()
+			}()
+			Consistently(sess.Context().Done()).ShouldNot(BeClosed())
+			// make the go routine return
+			packer.EXPECT().PackConnectionClose(gomock.Any()).Return(&packedPacket{}, nil)
+			sessionRunner.EXPECT().Retire(gomock.Any())
+			cryptoSetup.EXPECT().Close()
+			sess.Close()
+			Eventually(sess.Context().Done()).Should(BeClosed())
+		})
+	})
+
+	Context("tracing", func() {
+		var tracer *MockConnectionTracer
+
+		BeforeEach(func() {
+			tracer = NewMockConnectionTracer(mockCtrl)
+			sess.tracer = tracer
+		})
+
+		It("traces the start and the end of the connection", func() {
+			tracer.EXPECT().StartedConnection(mconn.LocalAddr(), mconn.RemoteAddr(), sess.version, sess.srcConnID, sess.destConnID)
+			done := make(chan struct{})
+			go func() {
+				defer GinkgoRecover()
+				cryptoSetup.EXPECT().RunHandshake().Do(func() { <-sess.Context().Done() })
+				sess.run()
+				close(done)
+			}()
+			testErr := errors.New("test error")
+			tracer.EXPECT().ClosedConnection(testErr)
+			streamManager.EXPECT().CloseWithError(gomock.Any())
+			sessionRunner.EXPECT().Remove(gomock.Any())
+			cryptoSetup.EXPECT().Close()
+			sess.destroy(testErr)
+			Eventually(done).Should(BeClosed())
+		})
+
+		It("traces sent packets", func() {
+			ack := &wire.AckFrame{AckRanges: []wire.AckRange{{Smallest: 1, Largest: 2}}}
+			packet := &packedPacket{
+				header: &wire.ExtendedHeader{PacketNumber: 3},
+				raw:    []byte("foobar"),
+				frames: []wire.Frame{ack, &wire.PingFrame{}},
+				buffer: getPacketBuffer(),
+			}
+			tracer.EXPECT().SentPacket(packet.header, protocol.ByteCount(6), ack, []wire.Frame{&wire.PingFrame{}})
+			Expect(sess.sendPackedPacket(packet)).To(Succeed())
+		})
+
+		It("traces received packets", func() {
+			hdr := &wire.ExtendedHeader{PacketNumber: 0x37, PacketNumberLen: protocol.PacketNumberLen1}
+			buf := &bytes.Buffer{}
+			Expect((&wire.PingFrame{}).Write(buf, sess.version)).To(Succeed())
+			rph := mockackhandler.NewMockReceivedPacketHandler(mockCtrl)
+			rph.EXPECT().ReceivedPacket(protocol.PacketNumber(0x37), protocol.Encryption1RTT, gomock.Any(), true)
+			sess.receivedPacketHandler = rph
+			tracer.EXPECT().ReceivedPacket(hdr, protocol.ByteCount(42), []wire.Frame{&wire.PingFrame{}})
+			Expect(sess.handleUnpackedPacket(&unpackedPacket{
+				packetNumber:    0x37,
+				hdr:             hdr,
+				encryptionLevel: protocol.Encryption1RTT,
+				data:            buf.Bytes(),
+			}, time.Now(), 42)).To(Succeed())
+		})
+
+		It("traces packets that can't be parsed", func() {
+			tracer.EXPECT().DroppedPacket(protocol.ByteCount(3), PacketDropHeaderParseError)
+			Expect(sess.handlePacketImpl(&receivedPacket{
+				data:   []byte{0xc0, 0, 0}, // truncated long header
+				buffer: getPacketBuffer(),
+			})).To(BeFalse())
+		})
+
+		It("traces packets that can't be decrypted", func() {
+			unpacker := NewMockUnpacker(mockCtrl)
+			unpacker.EXPECT().Unpack(gomock.Any(), gomock.Any()).Return(nil, errors.New("decryption failed"))
+			sess.unpacker = unpacker
+			buf := &bytes.Buffer{}
+			hdr := &wire.ExtendedHeader{
+				Header:          wire.Header{DestConnectionID: sess.srcConnID},
+				PacketNumber:    1,
+				PacketNumberLen: protocol.PacketNumberLen2,
+			}
+			Expect(hdr.Write(buf, sess.version)).To(Succeed())
+			buf.Write([]byte("foobar"))
+			tracer.EXPECT().DroppedPacket(protocol.ByteCount(buf.Len()), PacketDropPayloadDecryptError)
+			Expect(sess.handlePacketImpl(&receivedPacket{
+				data:   buf.Bytes(),
+				buffer: getPacketBuffer(),
+			})).To(BeFalse())
+		})
+
+		It("traces lost packets, and calls the OnPacketLost hook", func() {
+			var lost []PacketNumber
+			sess.config.EventHooks.OnPacketLost = func(pn PacketNumber, _ EncryptionLevel) { lost = append(lost, pn) }
+			tracer.EXPECT().LostPacket(protocol.Encryption1RTT, protocol.PacketNumber(42), PacketLossTimeThreshold)
+			sess.onPacketLost()(42, protocol.Encryption1RTT, ackhandler.PacketLossTimeThreshold)
+			Expect(lost).To(Equal([]PacketNumber{42}))
+		})
+
+		It("traces the lifecycle of a stream", func() {
+			var opened []protocol.StreamID
+			sess.config.EventHooks.OnStreamOpened = func(id protocol.StreamID) { opened = append(opened, id) }
+			sess.onStreamOpened(4)
+			Expect(opened).To(Equal([]protocol.StreamID{4}))
+			str := NewMockReceiveStreamI(mockCtrl)
+			streamManager.EXPECT().GetOrOpenReceiveStream(protocol.StreamID(4)).Return(str, nil).Times(2)
+			f := &wire.StreamFrame{StreamID: 4, Offset: 10, Data: []byte("foobar")}
+			str.EXPECT().handleStreamFrame(f)
+			Expect(sess.handleStreamFrame(f, protocol.Encryption1RTT)).To(Succeed())
+			rst := &wire.ResetStreamFrame{StreamID: 4, ByteOffset: 100, ErrorCode: 1337}
+			str.EXPECT().handleResetStreamFrame(rst)
+			Expect(sess.handleResetStreamFrame(rst)).To(Succeed())
+			sess.queueControlFrame(&wire.ResetStreamFrame{StreamID: 4, ByteOffset: 42, ErrorCode: 1234})
+			streamManager.EXPECT().DeleteStream(protocol.StreamID(4))
+			sess.onStreamCompleted(4, nil)
+			gomock.InOrder(
+				tracer.EXPECT().StreamOpened(protocol.StreamID(4), true),
+				tracer.EXPECT().StreamDataMoved(protocol.StreamID(4), protocol.ByteCount(6), StreamDataReceived),
+				tracer.EXPECT().StreamReset(protocol.StreamID(4), protocol.ApplicationErrorCode(1337), true),
+				tracer.EXPECT().StreamReset(protocol.StreamID(4), protocol.ApplicationErrorCode(1234), false),
+				tracer.EXPECT().StreamClosed(protocol.StreamID(4), protocol.ByteCount(42), protocol.ByteCount(100)),
+			)
+			sess.streamEvents.Flush(tracer)
+		})
+
+		It("traces stream data sent", func() {
+			sess.onStreamOpened(1)
+			packet := &packedPacket{
+				header: &wire.ExtendedHeader{PacketNumber: 3},
+				raw:    []byte("foobar"),
+				frames: []wire.Frame{&wire.StreamFrame{StreamID: 1, Data: []byte("foobar"), FinBit: true}},
+				buffer: getPacketBuffer(),
+			}
+			tracer.EXPECT().SentPacket(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any())
+			Expect(sess.sendPackedPacket(packet)).To(Succeed())
+			gomock.InOrder(
+				tracer.EXPECT().StreamOpened(protocol.StreamID(1), false),
+				tracer.EXPECT().StreamDataMoved(protocol.StreamID(1), protocol.ByteCount(6), StreamDataSent),
+			)
+			sess.streamEvents.Flush(tracer)
+		})
+
+		It("doesn't set a loss callback if neither a tracer nor the OnPacketLost hook is set", func() {
+			sess.tracer = nil
+			Expect(sess.onPacketLost()).To(BeNil())
+		})
+
+		It("traces metrics after processing an ACK", func() {
+			sph := mockackhandler.NewMockSentPacketHandler(mockCtrl)
+			sph.EXPECT().ReceivedAck(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any())
+			sph.EXPECT().GetCongestionWindow().Return(protocol.ByteCount(1000))
+			sph.EXPECT().GetBytesInFlight().Return(protocol.ByteCount(500))
+			sess.sentPacketHandler = sph
+			tracer.EXPECT().UpdatedMetrics(sess.rttStats, protocol.ByteCount(1000), protocol.ByteCount(500))
+			ack := &wire.AckFrame{AckRanges: []wire.AckRange{{Smallest: 1, Largest: 1}}}
+			Expect(sess.handleAckFrame(ack, 0, protocol.EncryptionHandshake)).To(Succeed())
+		})
+	})
+
+	Context("capturing datagrams", func() {
+		var (
+			capturer *connectionCapturer
+			capture  *MockConnectionCapture
+		)
+
+		BeforeEach(func() {
+			capture = NewMockConnectionCapture(mockCtrl)
+			capturer = &connectionCapturer{capture: capture}
+			sess.config.PacketCapturer = capturer
+			sess.setupCapture(false, protocol.ConnectionID{1, 2, 3, 4})
+		})
+
+		It("creates the capture", func() {
+			Expect(capturer.isClient).To(BeFalse())
+			Expect(capturer.odcid).To(Equal(protocol.ConnectionID{1, 2, 3, 4}))
+			Expect(sess.capture).To(Equal(capture))
+		})
+
+		It("doesn't capture datagrams if the PacketCapturer returns nil", func() {
+			sess.conn = mconn
+			sess.capture = nil
+			capturer.capture = nil
+			sess.setupCapture(false, protocol.ConnectionID{1, 2, 3, 4})
+			Expect(sess.capture).To(BeNil())
+			Expect(sess.conn).To(Equal(mconn))
+		})
+
+		It("captures sent datagrams", func() {
+			packet := &packedPacket{
+				header: &wire.ExtendedHeader{PacketNumber: 3},
+				raw:    []byte("foobar"),
+				buffer: getPacketBuffer(),
+			}
+			capture.EXPECT().SentDatagram(gomock.Any(), mconn.LocalAddr(), mconn.RemoteAddr(), []byte("foobar"))
+			Expect(sess.sendPackedPacket(packet)).To(Succeed())
+			Expect(mconn.written).To(Receive(Equal([]byte("foobar"))))
+		})
+
+		It("captures received datagrams, but not when undecryptable packets are processed again", func() {
+			p := &receivedPacket{
+				remoteAddr: &net.UDPAddr{IP: net.IPv4(1, 2, 3, 4), Port: 1337},
+				rcvTime:    time.Now(),
+				data:       []byte("foobar"),
+			}
+			capture.EXPECT().ReceivedDatagram(p.rcvTime, mconn.LocalAddr(), p.remoteAddr, []byte("foobar"))
+			sess.handlePacket(p)
+			Expect(sess.receivedPackets).To(Receive(Equal(p)))
+			sess.undecryptablePackets = []*receivedPacket{p}
+			sess.tryDecryptingQueuedPackets()
+			Expect(sess.receivedPackets).To(Receive(Equal(p)))
+		})
+
+		It("closes the capture when the connection is closed", func() {
+			done := make(chan struct{})
+			go func() {
+				defer GinkgoRecover()
+				cryptoSetup.EXPECT().RunHandshake().Do(func() { <-sess.Context().Done() })
+				sess.run()
+				close(done)
+			}()
+			capture.EXPECT().Close()
+			streamManager.EXPECT().CloseWithError(gomock.Any())
+			sessionRunner.EXPECT().Remove(gomock.Any())
+			cryptoSetup.EXPECT().Close()
+			sess.destroy(errors.New("test error"))
+			Eventually(done).Should(BeClosed())
+		})
+	})
+
+	Context("collecting metrics", func() {
+		var metrics *Metrics
+
+		BeforeEach(func() {
+			metrics = &Metrics{}
+			sess.config.MetricsCollector = metrics
+		})
+
+		It("counts started connections, completed handshakes and closed connections", func() {
+			packer.EXPECT().PackPacket().AnyTimes()
+			done := make(chan struct{})
+			go func() {
+				defer GinkgoRecover()
+				sessionRunner.EXPECT().OnHandshakeComplete(gomock.Any())
+				cryptoSetup.EXPECT().RunHandshake()
+				sess.run()
+				close(done)
+			}()
+			Eventually(func() uint64 { return metrics.Snapshot().HandshakesCompleted }).Should(BeEquivalentTo(1))
+			Expect(metrics.Snapshot().ConnectionsStarted).To(BeEquivalentTo(1))
+			sessionRunner.EXPECT().Retire(gomock.Any())
+			streamManager.EXPECT().CloseWithError(gomock.Any())
+			packer.EXPECT().PackConnectionClose(gomock.Any()).Return(&packedPacket{
+				header: &wire.ExtendedHeader{},
+				raw:    []byte("connection close"),
+			}, nil)
+			cryptoSetup.EXPECT().Close()
+			Expect(sess.Close()).To(Succeed())
+			Eventually(done).Should(BeClosed())
+			snapshot := metrics.Snapshot()
+			Expect(snapshot.ConnectionsClosed).To(Equal(map[ConnectionCloseReason]uint64{CloseReasonLocal: 1}))
+			Expect(snapshot.PacketsSent).To(Equal(map[EncryptionLevel]uint64{protocol.Encryption1RTT: 1}))
+			Expect(snapshot.BytesSent).To(Equal(map[EncryptionLevel]ByteCount{protocol.Encryption1RTT: 16}))
+		})
+
+		It("doesn't count sessions that are closed for recreation", func() {
+			done := make(chan struct{})
+			go func() {
+				defer GinkgoRecover()
+				cryptoSetup.EXPECT().RunHandshake().Do(func() { <-sess.Context().Done() })
+				sess.run()
+				close(done)
+			}()
+			streamManager.EXPECT().CloseWithError(gomock.Any())
+			sessionRunner.EXPECT().Remove(gomock.Any())
+			cryptoSetup.EXPECT().Close()
+			sess.destroy(errCloseForRecreating)
+			Eventually(done).Should(BeClosed())
+			Expect(metrics.Snapshot().ConnectionsClosed).To(BeEmpty())
+		})
+
+		It("determines the close reason", func() {
+			Expect(sess.closeReason(closeError{})).To(Equal(CloseReasonLocal))
+			Expect(sess.closeReason(closeError{err: errors.New("foobar"), sendClose: true})).To(Equal(CloseReasonLocalError))
+			Expect(sess.closeReason(closeError{err: qerr.Error(qerr.ProtocolViolation, "foobar"), remote: true})).To(Equal(CloseReasonRemote))
+			Expect(sess.closeReason(closeError{err: errStatelessReset})).To(Equal(CloseReasonStatelessReset))
+			Expect(sess.closeReason(closeError{err: qerr.TimeoutError("handshake")})).To(Equal(CloseReasonHandshakeTimeout))
+			sess.handshakeComplete = true
+			Expect(sess.closeReason(closeError{err: qerr.TimeoutError("idle")})).To(Equal(CloseReasonIdleTimeout))
+		})
+
+		It("counts received packets", func() {
+			rph := mockackhandler.NewMockReceivedPacketHandler(mockCtrl)
+			rph.EXPECT().ReceivedPacket(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any())
+			sess.receivedPacketHandler = rph
+			buf := &bytes.Buffer{}
+			Expect((&wire.PingFrame{}).Write(buf, sess.version)).To(Succeed())
+			Expect(sess.handleUnpackedPacket(&unpackedPacket{
+				packetNumber:    0x37,
+				hdr:             &wire.ExtendedHeader{PacketNumber: 0x37},
+				encryptionLevel: protocol.Encryption1RTT,
+				data:            buf.Bytes(),
+			}, time.Now(), 42)).To(Succeed())
+			snapshot := metrics.Snapshot()
+			Expect(snapshot.PacketsReceived).To(Equal(map[EncryptionLevel]uint64{protocol.Encryption1RTT: 1}))
+			Expect(snapshot.BytesReceived).To(Equal(map[EncryptionLevel]ByteCount{protocol.Encryption1RTT: 42}))
+		})
+
+		It("counts lost packets", func() {
+			sess.tracer = nil
+			onPacketLost := sess.onPacketLost()
+			Expect(onPacketLost).ToNot(BeNil())
+			onPacketLost(42, protocol.Encryption1RTT, ackhandler.PacketLossTimeThreshold)
+			Expect(metrics.Snapshot().PacketsLost).To(Equal(map[EncryptionLevel]uint64{protocol.Encryption1RTT: 1}))
+		})
+
+		It("counts probe timeouts", func() {
+			sess.onProbeTimeout()()
+			Expect(metrics.Snapshot().ProbeTimeouts).To(BeEquivalentTo(1))
+			sess.config.MetricsCollector = nil
+			Expect(sess.onProbeTimeout()).To(BeNil())
+		})
+	})
+
+	Context("scaling the timeouts with the RTT", func() {
+		BeforeEach(func() {
+			sess.config.HandshakeTimeout = 10 * time.Second
+			sess.config.IdleTimeout = 30 * time.Second
+			Expect(sess.config.IdleTimeoutMultiplier).To(BeEquivalentTo(protocol.DefaultIdleTimeoutMultiplier))
+		})
+
+		It("uses the configured timeouts on low latency paths", func() {
+			sess.rttStats.UpdateRTT(5*time.Millisecond, 0, time.Now())
+			Expect(sess.idleTimeout()).To(Equal(30 * time.Second))
+			Expect(sess.handshakeTimeout()).To(Equal(10 * time.Second))
+		})
+
+		It("scales the timeouts on high latency paths", func() {
+			sess.perspective = protocol.PerspectiveClient
+			sess.rttStats.UpdateRTT(2*time.Second, 0, time.Now())
+			Expect(sess.idleTimeout()).To(Equal(time.Minute))
+			Expect(sess.handshakeTimeout()).To(Equal(time.Minute))
+		})
+
+		It("never scales the handshake timeout on the server side", func() {
+			Expect(sess.perspective).To(Equal(protocol.PerspectiveServer))
+			sess.rttStats.UpdateRTT(2*time.Second, 0, time.Now())
+			Expect(sess.idleTimeout()).To(Equal(time.Minute))
+			Expect(sess.handshakeTimeout()).To(Equal(10 * time.Second))
+		})
+
+		It("doesn't scale the timeouts if the multiplier is zero", func() {
+			sess.config.IdleTimeoutMultiplier = 0
+			sess.rttStats.UpdateRTT(2*time.Second, 0, time.Now())
+			Expect(sess.idleTimeout()).To(Equal(30 * time.Second))
+			Expect(sess.handshakeTimeout()).To(Equal(10 * time.Second))
+		})
+
+		It("bounds the idle timeout", func() {
+			sess.config.MinIdleTimeout = 45 * time.Second
+			sess.config.MaxIdleTimeout = 50 * time.Second
+			Expect(sess.idleTimeout()).To(Equal(45 * time.Second))
+			sess.perspective = protocol.PerspectiveClient
+			sess.rttStats.UpdateRTT(2*time.Second, 0, time.Now())
+			Expect(sess.idleTimeout()).To(Equal(50 * time.Second))
+			// the handshake timeout is not bounded
+			Expect(sess.handshakeTimeout()).To(Equal(time.Minute))
+		})
+
+		It("advertises the bounded idle timeout", func() {
+			Expect(advertisedIdleTimeout(&Config{IdleTimeout: 30 * time.Second})).To(Equal(30 * time.Second))
+			Expect(advertisedIdleTimeout(&Config{
+				IdleTimeout:    30 * time.Second,
+				MinIdleTimeout: 45 * time.Second,
+				MaxIdleTimeout: 50 * time.Second,
+			})).To(Equal(45 * time.Second))
+			Expect(advertisedIdleTimeout(&Config{
+				IdleTimeout:    30 * time.Second,
+				MaxIdleTimeout: 20 * time.Second,
+			})).To(Equal(20 * time.Second))
+		})
+
+		It("advertises the upper bound of the idle timeout, if it is scaled with the RTT", func() {
+			Expect(advertisedIdleTimeout(&Config{
+				IdleTimeout:           30 * time.Second,
+				IdleTimeoutMultiplier: 30,
+				MaxIdleTimeout:        50 * time.Second,
+			})).To(Equal(50 * time.Second))
+		})
 	})
 
 	It("stores up to MaxSessionUnprocessedPackets packets", func(done Done) {
@@ -1502,6 +2836,177 @@ var _ = Describe("Session", func() {
 		})
 	})
 
+	Context("donating send credit", func() {
+		var connFC *mocks.MockConnectionFlowController
+
+		BeforeEach(func() {
+			connFC = mocks.NewMockConnectionFlowController(mockCtrl)
+			sess.connFlowController = connFC
+		})
+
+		It("donates send credit", func() {
+			gomock.InOrder(
+				streamManager.EXPECT().SendStreamState(protocol.StreamID(5)).Return(streamStateOpen),
+				streamManager.EXPECT().SendStreamState(protocol.StreamID(1)).Return(streamStateOpen),
+				connFC.EXPECT().DonateSendCredit(protocol.StreamID(1), protocol.StreamID(5), protocol.ByteCount(1000)),
+				streamManager.EXPECT().SendStreamState(protocol.StreamID(5)).Return(streamStateOpen),
+			)
+			Expect(sess.DonateStreamSendCredit(1, 5, 1000)).To(Succeed())
+		})
+
+		It("donates send credit to streams that were not opened yet", func() {
+			gomock.InOrder(
+				streamManager.EXPECT().SendStreamState(protocol.StreamID(5)).Return(streamStateNotOpened),
+				streamManager.EXPECT().SendStreamState(protocol.StreamID(1)).Return(streamStateOpen),
+				connFC.EXPECT().DonateSendCredit(protocol.StreamID(1), protocol.StreamID(5), protocol.ByteCount(1000)),
+				streamManager.EXPECT().SendStreamState(protocol.StreamID(5)).Return(streamStateNotOpened),
+			)
+			Expect(sess.DonateStreamSendCredit(1, 5, 1000)).To(Succeed())
+		})
+
+		It("returns errors from the flow controller", func() {
+			testErr := errors.New("not enough credit")
+			streamManager.EXPECT().SendStreamState(protocol.StreamID(3)).Return(streamStateOpen)
+			streamManager.EXPECT().SendStreamState(protocol.StreamID(1)).Return(streamStateOpen)
+			connFC.EXPECT().DonateSendCredit(protocol.StreamID(1), protocol.StreamID(3), protocol.ByteCount(1000)).Return(testErr)
+			Expect(sess.DonateStreamSendCredit(1, 3, 1000)).To(MatchError(testErr))
+		})
+
+		It("doesn't donate send credit to streams that are closed or exceed the stream limit", func() {
+			streamManager.EXPECT().SendStreamState(protocol.StreamID(5)).Return(streamStateUnavailable)
+			Expect(sess.DonateStreamSendCredit(1, 5, 1000)).To(MatchError("can't donate send credit to stream 5, it is closed or exceeds the stream limit"))
+		})
+
+		It("doesn't donate send credit from streams that are closed or exceed the stream limit", func() {
+			streamManager.EXPECT().SendStreamState(protocol.StreamID(5)).Return(streamStateOpen)
+			streamManager.EXPECT().SendStreamState(protocol.StreamID(1)).Return(streamStateUnavailable)
+			Expect(sess.DonateStreamSendCredit(1, 5, 1000)).To(MatchError("stream 1 can't donate send credit, it is closed or exceeds the stream limit"))
+		})
+
+		It("only donates send credit from streams that were not opened yet, if it was donated to them", func() {
+			streamManager.EXPECT().SendStreamState(protocol.StreamID(5)).Return(streamStateOpen)
+			streamManager.EXPECT().SendStreamState(protocol.StreamID(1)).Return(streamStateNotOpened)
+			connFC.EXPECT().GrantedSendCredit(protocol.StreamID(1)).Return(protocol.ByteCount(500))
+			Expect(sess.DonateStreamSendCredit(1, 5, 1000)).To(MatchError("stream 1 can't donate 1000 bytes of send credit, only 500 bytes were donated to it"))
+		})
+
+		It("releases the donated send credit if the stream is completed concurrently", func() {
+			gomock.InOrder(
+				streamManager.EXPECT().SendStreamState(protocol.StreamID(5)).Return(streamStateOpen),
+				streamManager.EXPECT().SendStreamState(protocol.StreamID(1)).Return(streamStateOpen),
+				connFC.EXPECT().DonateSendCredit(protocol.StreamID(1), protocol.StreamID(5), protocol.ByteCount(1000)),
+				streamManager.EXPECT().SendStreamState(protocol.StreamID(5)).Return(streamStateUnavailable),
+				connFC.EXPECT().ReleaseSendCredit(protocol.StreamID(5)),
+			)
+			Expect(sess.DonateStreamSendCredit(1, 5, 1000)).To(MatchError("can't donate send credit to stream 5, it is closed or exceeds the stream limit"))
+		})
+
+		It("donates send credit to a push stream before it is opened", func() {
+			sess.connFlowController = flowcontrol.NewConnectionFlowController(1000, 1000, func() {}, sess.rttStats, utils.DefaultLogger)
+			sess.connFlowController.UpdateSendWindow(10000)
+			sess.streamsMap = newStreamsMap(sess, sess.newFlowController, sess.connSendBuffer, nil, 100, 100, protocol.PerspectiveServer, protocol.VersionWhatever)
+			Expect(sess.streamsMap.UpdateLimits(&handshake.TransportParameters{MaxBidiStreams: 10, MaxUniStreams: 10})).To(Succeed())
+			str, err := sess.OpenStream()
+			Expect(err).ToNot(HaveOccurred())
+			pushStreamID := protocol.FirstStream(protocol.StreamTypeUni, protocol.PerspectiveServer)
+			Expect(sess.DonateStreamSendCredit(str.StreamID(), pushStreamID, 1000)).To(Succeed())
+			pushStr, err := sess.OpenUniStream()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(pushStr.StreamID()).To(Equal(pushStreamID))
+			Expect(pushStr.GrantedCredit()).To(Equal(protocol.ByteCount(1000)))
+			// the push stream can pass on the credit donated to it
+			Expect(sess.DonateStreamSendCredit(pushStreamID, pushStreamID+4, 600)).To(Succeed())
+			Expect(sess.DonateStreamSendCredit(pushStreamID+8, pushStreamID+12, 100)).To(MatchError(fmt.Sprintf("stream %d can't donate 100 bytes of send credit, only 0 bytes were donated to it", pushStreamID+8)))
+			// streams exceeding the peer's stream limit can never be opened
+			Expect(sess.DonateStreamSendCredit(str.StreamID(), pushStreamID+40, 100)).To(MatchError(fmt.Sprintf("can't donate send credit to stream %d, it is closed or exceeds the stream limit", pushStreamID+40)))
+		})
+
+		It("doesn't donate send credit to receive-only streams", func() {
+			Expect(sess.DonateStreamSendCredit(1, 2, 1000)).To(MatchError("can't donate send credit to stream 2, it is a receive-only stream"))
+		})
+
+		It("releases the send credit when a stream is completed, after deleting it", func() {
+			gomock.InOrder(
+				streamManager.EXPECT().DeleteStream(protocol.StreamID(5)),
+				connFC.EXPECT().ReleaseSendCredit(protocol.StreamID(5)),
+			)
+			sess.onStreamCompleted(5, nil)
+		})
+	})
+
+	Context("sending DATAGRAM frames", func() {
+		It("doesn't support DATAGRAM frames if the peer didn't advertise support", func() {
+			Expect(sess.datagramsSupported()).To(BeFalse())
+		})
+
+		It("queues a DATAGRAM frame", func() {
+			sess.peerMaxDatagramFrameSize = protocol.MaxDatagramFrameSize
+			Expect(sess.datagramsSupported()).To(BeTrue())
+			Expect(sess.sendDatagram([]byte("foobar"))).To(Succeed())
+			Expect(sess.sendingScheduled).To(Receive())
+			frames, _ := sess.framer.AppendControlFrames(nil, 1000)
+			Expect(frames).To(Equal([]wire.Frame{&wire.DatagramFrame{DataLenPresent: true, Data: []byte("foobar")}}))
+		})
+
+		It("refuses to send messages that exceed the peer's maximum DATAGRAM frame size", func() {
+			sess.peerMaxDatagramFrameSize = 10
+			Expect(sess.sendDatagram(make([]byte, 8))).To(Succeed())
+			Expect(sess.sendDatagram(make([]byte, 9))).To(MatchError("message too large for a DATAGRAM frame (9 bytes, maximum frame size: 10 bytes)"))
+		})
+
+		It("refuses to send messages that wouldn't fit into a packet", func() {
+			sess.peerMaxDatagramFrameSize = protocol.MaxDatagramFrameSize
+			Expect(sess.sendDatagram(make([]byte, protocol.MaxDatagramSendFrameSize))).To(MatchError(ContainSubstring("message too large for a DATAGRAM frame")))
+		})
+
+		It("errors when too many DATAGRAM frames are queued", func() {
+			sess.peerMaxDatagramFrameSize = protocol.MaxDatagramFrameSize
+			for i := 0; i < protocol.MaxDatagramSendQueueLen; i++ {
+				Expect(sess.sendDatagram([]byte("foobar"))).To(Succeed())
+			}
+			Expect(sess.sendDatagram([]byte("foobar"))).To(MatchError("too many DATAGRAM frames queued"))
+		})
+	})
+
+	Context("receiving DATAGRAM frames", func() {
+		It("delivers DATAGRAM frames to the application", func() {
+			Expect(sess.handleFrame(&wire.DatagramFrame{Data: []byte("foo")}, 1, protocol.Encryption1RTT)).To(Succeed())
+			Expect(sess.handleFrame(&wire.DatagramFrame{Data: []byte("bar")}, 2, protocol.Encryption1RTT)).To(Succeed())
+			p, err := sess.ReceiveUnreliable(context.Background())
+			Expect(err).ToNot(HaveOccurred())
+			Expect(p).To(Equal([]byte("foo")))
+			p, err = sess.ReceiveUnreliable(context.Background())
+			Expect(err).ToNot(HaveOccurred())
+			Expect(p).To(Equal([]byte("bar")))
+		})
+
+		It("drops DATAGRAM frames if the application doesn't read them", func() {
+			for i := 0; i < protocol.MaxDatagramRcvQueueLen+1; i++ {
+				Expect(sess.handleFrame(&wire.DatagramFrame{Data: []byte{byte(i)}}, protocol.PacketNumber(i), protocol.Encryption1RTT)).To(Succeed())
+			}
+			for i := 0; i < protocol.MaxDatagramRcvQueueLen; i++ {
+				p, err := sess.ReceiveUnreliable(context.Background())
+				Expect(err).ToNot(HaveOccurred())
+				Expect(p).To(Equal([]byte{byte(i)}))
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), scaleDuration(10*time.Millisecond))
+			defer cancel()
+			_, err := sess.ReceiveUnreliable(ctx)
+			Expect(err).To(MatchError(context.DeadlineExceeded))
+		})
+
+		It("returns an error when the session is closed", func() {
+			Expect(sess.handleFrame(&wire.DatagramFrame{Data: []byte("foo")}, 1, protocol.Encryption1RTT)).To(Succeed())
+			sess.ctxCancel()
+			// messages received before the session was closed are still delivered
+			p, err := sess.ReceiveUnreliable(context.Background())
+			Expect(err).ToNot(HaveOccurred())
+			Expect(p).To(Equal([]byte("foo")))
+			_, err = sess.ReceiveUnreliable(context.Background())
+			Expect(err).To(MatchError(errSessionClosedBeforeDatagramReceived))
+		})
+	})
+
 	It("returns the local address", func() {
 		addr := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 1337}
 		mconn.localAddr = addr
@@ -1513,6 +3018,38 @@ var _ = Describe("Session", func() {
 		mconn.remoteAddr = addr
 		Expect(sess.RemoteAddr()).To(Equal(addr))
 	})
+
+	It("returns the connection IDs", func() {
+		Expect(sess.ConnectionID()).To(Equal("0102030405060708"))
+		Expect(sess.OriginalDestConnectionID()).To(Equal("0102030405060708090a"))
+	})
+
+	It("returns the client's original destination connection ID after a Retry", func() {
+		s, err := newSession(
+			mconn,
+			sessionRunner,
+			protocol.ConnectionID{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}, // the source connection ID of the Retry
+			protocol.ConnectionID{8, 7, 6, 5, 4, 3, 2, 1},
+			protocol.ConnectionID{1, 2, 3, 4, 5, 6, 7, 8},
+			populateServerConfig(&Config{}),
+			nil, // tls.Config
+			&handshake.TransportParameters{OriginalConnectionID: protocol.ConnectionID{0xde, 0xad, 0xbe, 0xef}},
+			utils.DefaultLogger,
+			protocol.VersionTLS,
+		)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(s.(*session).OriginalDestConnectionID()).To(Equal("deadbeef"))
+	})
+
+	It("stores the connection ID in the context", func() {
+		ctx, cancel := context.WithCancel(sess.Context())
+		defer cancel()
+		connID, ok := ConnectionIDFromContext(ctx)
+		Expect(ok).To(BeTrue())
+		Expect(connID).To(Equal("0102030405060708"))
+		_, ok = ConnectionIDFromContext(context.Background())
+		Expect(ok).To(BeFalse())
+	})
 })
 
 var _ = Describe("Client Session", func() {
@@ -1559,7 +3096,68 @@ var _ = Describe("Client Session", func() {
 		sess.cryptoStreamHandler = cryptoSetup
 	})
 
+	Context("handling tokens", func() {
+		It("stores tokens received in NEW_TOKEN frames", func() {
+			store := NewLRUTokenStore(1, 1)
+			sess.config.TokenStore = store
+			sess.tokenStoreKey = "quic.clemente.io"
+			Expect(sess.handleFrame(&wire.NewTokenFrame{Token: []byte("foobar")}, 1, protocol.Encryption1RTT)).To(Succeed())
+			token := store.Pop("quic.clemente.io")
+			Expect(token).ToNot(BeNil())
+			Expect(token.data).To(Equal([]byte("foobar")))
+		})
+
+		It("ignores NEW_TOKEN frames if no TokenStore is configured", func() {
+			Expect(sess.handleFrame(&wire.NewTokenFrame{Token: []byte("foobar")}, 1, protocol.Encryption1RTT)).To(Succeed())
+		})
+
+		It("sends a stored token in the Initial packet", func() {
+			store := NewLRUTokenStore(1, 1)
+			store.Put("quic.clemente.io", &ClientToken{data: []byte("foobar")})
+			sessP, err := newClientSession(
+				mconn,
+				sessionRunner,
+				protocol.ConnectionID{8, 7, 6, 5, 4, 3, 2, 1},
+				protocol.ConnectionID{1, 2, 3, 4, 5, 6, 7, 8},
+				populateClientConfig(&Config{TokenStore: store}, true),
+				&tls.Config{ServerName: "quic.clemente.io"},
+				42, // initial packet number
+				&handshake.TransportParameters{},
+				protocol.VersionTLS,
+				utils.DefaultLogger,
+				protocol.VersionTLS,
+			)
+			Expect(err).ToNot(HaveOccurred())
+			s := sessP.(*session)
+			Expect(s.tokenStoreKey).To(Equal("quic.clemente.io"))
+			Expect(s.packer.(*packetPacker).token).To(Equal([]byte("foobar")))
+			Expect(store.Pop("quic.clemente.io")).To(BeNil())
+		})
+
+		It("uses the server address as the key if no server name is set", func() {
+			store := NewLRUTokenStore(1, 1)
+			store.Put(mconn.RemoteAddr().String(), &ClientToken{data: []byte("foobar")})
+			sessP, err := newClientSession(
+				mconn,
+				sessionRunner,
+				protocol.ConnectionID{8, 7, 6, 5, 4, 3, 2, 1},
+				protocol.ConnectionID{1, 2, 3, 4, 5, 6, 7, 8},
+				populateClientConfig(&Config{TokenStore: store}, true),
+				nil, // tls.Config
+				42,  // initial packet number
+				&handshake.TransportParameters{},
+				protocol.VersionTLS,
+				utils.DefaultLogger,
+				protocol.VersionTLS,
+			)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(sessP.(*session).packer.(*packetPacker).token).To(Equal([]byte("foobar")))
+		})
+	})
+
 	It("changes the connection ID when receiving the first packet from the server", func() {
+		Expect(sess.ConnectionID()).To(Equal("0807060504030201"))
+		Expect(sess.OriginalDestConnectionID()).To(Equal("0807060504030201"))
 		unpacker := NewMockUnpacker(mockCtrl)
 		unpacker.EXPECT().Unpack(gomock.Any(), gomock.Any()).DoAndReturn(func(hdr *wire.Header, data []byte) (*unpackedPacket, error) {
 			return &unpackedPacket{
@@ -1583,9 +3181,12 @@ var _ = Describe("Client Session", func() {
 				SrcConnectionID:  newConnID,
 				DestConnectionID: sess.srcConnID,
 				Length:           1,
+				Version:          sess.version,
 			},
 			PacketNumberLen: protocol.PacketNumberLen2,
 		}, []byte{0}))).To(BeTrue())
+		Expect(sess.ConnectionID()).To(Equal("0103030701030307"))
+		Expect(sess.OriginalDestConnectionID()).To(Equal("0807060504030201"))
 		// make sure the go routine returns
 		packer.EXPECT().PackConnectionClose(gomock.Any()).Return(&packedPacket{}, nil)
 		sessionRunner.EXPECT().Retire(gomock.Any())
@@ -1594,6 +3195,25 @@ var _ = Describe("Client Session", func() {
 		Eventually(sess.Context().Done()).Should(BeClosed())
 	})
 
+	It("only unpacks long header packets of valid types", func() {
+		sess.receivedFirstPacket = true
+		unpacker := NewMockUnpacker(mockCtrl)
+		var unpacked []protocol.PacketType
+		unpacker.EXPECT().Unpack(gomock.Any(), gomock.Any()).DoAndReturn(func(hdr *wire.Header, _ []byte) (*unpackedPacket, error) {
+			unpacked = append(unpacked, hdr.Type)
+			return nil, errors.New("decryption failed")
+		}).AnyTimes()
+		sess.unpacker = unpacker
+		for _, p := range longHeaderPacketsOfAllTypes(sess.srcConnID, sess.destConnID, sess.version) {
+			Expect(sess.handlePacketImpl(p)).To(BeFalse())
+		}
+		// 16 Initial and 16 Handshake packets, Retry and 0-RTT packets are dropped
+		Expect(unpacked).To(HaveLen(32))
+		for _, t := range unpacked {
+			Expect(t).To(Or(Equal(protocol.PacketTypeInitial), Equal(protocol.PacketTypeHandshake)))
+		}
+	})
+
 	Context("handling Retry", func() {
 		var validRetryHdr *wire.ExtendedHeader
 
@@ -1681,3 +3301,84 @@ var _ = Describe("Client Session", func() {
 		})
 	})
 })
+
+var _ = Describe("validating packet types", func() {
+	client := connectionState{perspective: protocol.PerspectiveClient}
+	server := connectionState{perspective: protocol.PerspectiveServer}
+	clientAfterFirstPacket := connectionState{perspective: protocol.PerspectiveClient, receivedFirstPacket: true}
+
+	It("accepts Initial and Handshake packets", func() {
+		for _, state := range []connectionState{client, server, clientAfterFirstPacket} {
+			Expect(validatePacketType(protocol.PacketTypeInitial, state)).To(Succeed())
+			Expect(validatePacketType(protocol.PacketTypeHandshake, state)).To(Succeed())
+		}
+	})
+
+	It("accepts Retry packets only before the client received the first packet", func() {
+		Expect(validatePacketType(protocol.PacketTypeRetry, client)).To(Succeed())
+		Expect(validatePacketType(protocol.PacketTypeRetry, clientAfterFirstPacket)).To(MatchError(qerr.Error(qerr.ProtocolViolation, "received a Retry packet after receiving a packet from the server")))
+		Expect(validatePacketType(protocol.PacketTypeRetry, server)).To(MatchError(qerr.Error(qerr.ProtocolViolation, "received a Retry packet from the client")))
+	})
+
+	It("accepts 0-RTT packets only on the server side", func() {
+		Expect(validatePacketType(protocol.PacketType0RTT, server)).To(Succeed())
+		Expect(validatePacketType(protocol.PacketType0RTT, client)).To(MatchError(qerr.Error(qerr.ProtocolViolation, "received a 0-RTT packet from the server")))
+	})
+
+	It("rejects unknown packet types", func() {
+		Expect(validatePacketType(protocol.PacketType(42), server)).To(MatchError(qerr.Error(qerr.ProtocolViolation, "invalid long header packet type: 42")))
+	})
+})
+
+// longHeaderPacketsOfAllTypes returns one long header packet for every value of the first byte,
+// such that the packets cover all packet types, with all values of the type-specific bits.
+// The packets are sent from srcConnID to destConnID.
+func longHeaderPacketsOfAllTypes(destConnID, srcConnID protocol.ConnectionID, v protocol.VersionNumber) []*receivedPacket {
+	var packets []*receivedPacket
+	for b := 0xc0; b <= 0xff; b++ {
+		hdr := &wire.ExtendedHeader{
+			Header: wire.Header{
+				IsLongHeader:     true,
+				Type:             protocol.PacketTypeInitial,
+				DestConnectionID: destConnID,
+				SrcConnectionID:  srcConnID,
+				Length:           4,
+				Version:          v,
+			},
+			PacketNumberLen: protocol.PacketNumberLen4,
+		}
+		switch (b & 0x30) >> 4 {
+		case 0x1:
+			hdr.Type = protocol.PacketType0RTT
+		case 0x2:
+			hdr.Type = protocol.PacketTypeHandshake
+		case 0x3:
+			hdr.Type = protocol.PacketTypeRetry
+			hdr.OrigDestConnectionID = protocol.ConnectionID{1, 2, 3, 4}
+			hdr.Token = []byte("foobar")
+		}
+		buf := &bytes.Buffer{}
+		ExpectWithOffset(1, hdr.Write(buf, v)).To(Succeed())
+		data := buf.Bytes()
+		// Overwrite the type-specific bits.
+		// For Retry packets, this changes the length of the original destination connection ID.
+		data[0] = byte(b)
+		packets = append(packets, &receivedPacket{
+			data:   data,
+			buffer: getPacketBuffer(),
+		})
+	}
+	return packets
+}
+
+type testTB struct {
+	logs []string
+}
+
+var _ TB = &testTB{}
+
+func (t *testTB) Helper() {}
+
+func (t *testTB) Logf(format string, args ...interface{}) {
+	t.logs = append(t.logs, fmt.Sprintf(format, args...))
+}
@@ -16,15 +16,21 @@ const errorCodeStopping protocol.ApplicationErrorCode = 0
 type streamSender interface {
 	queueControlFrame(wire.Frame)
 	onHasStreamData(protocol.StreamID)
+	setStreamPriority(id protocol.StreamID, urgency uint8, incremental bool)
 	// must be called without holding the mutex that is acquired by closeForShutdown
-	onStreamCompleted(protocol.StreamID)
+	// The error is nil if the stream was completed gracefully, i.e. if it wasn't canceled or reset.
+	onStreamCompleted(protocol.StreamID, error)
+	// must be called without holding the stream's mutex
+	onReadAvailable(ReceiveStream, int)
+	// returns nil unless error injection is enabled
+	testingTB() TB
 }
 
 // Each of the both stream halves gets its own uniStreamSender.
 // This is necessary in order to keep track when both halves have been completed.
 type uniStreamSender struct {
 	streamSender
-	onStreamCompletedImpl func()
+	onStreamCompletedImpl func(error)
 }
 
 func (s *uniStreamSender) queueControlFrame(f wire.Frame) {
@@ -35,8 +41,12 @@ func (s *uniStreamSender) onHasStreamData(id protocol.StreamID) {
 	s.streamSender.onHasStreamData(id)
 }
 
-func (s *uniStreamSender) onStreamCompleted(protocol.StreamID) {
-	s.onStreamCompletedImpl()
+func (s *uniStreamSender) onStreamCompleted(_ protocol.StreamID, err error) {
+	s.onStreamCompletedImpl(err)
+}
+
+func (s *uniStreamSender) onReadAvailable(str ReceiveStream, available int) {
+	s.streamSender.onReadAvailable(str, available)
 }
 
 var _ streamSender = &uniStreamSender{}
@@ -69,6 +79,8 @@ type stream struct {
 	sender                 streamSender
 	receiveStreamCompleted bool
 	sendStreamCompleted    bool
+	// completedErr is the error of the first stream half that was canceled or reset, if any
+	completedErr error
 
 	version protocol.VersionNumber
 }
@@ -97,29 +109,31 @@ var _ StreamError = &streamCanceledError{}
 func newStream(streamID protocol.StreamID,
 	sender streamSender,
 	flowController flowcontrol.StreamFlowController,
+	connSendBuffer *connectionSendBuffer,
 	version protocol.VersionNumber,
 ) *stream {
 	s := &stream{sender: sender, version: version}
 	senderForSendStream := &uniStreamSender{
 		streamSender: sender,
-		onStreamCompletedImpl: func() {
+		onStreamCompletedImpl: func(err error) {
 			s.completedMutex.Lock()
 			s.sendStreamCompleted = true
-			s.checkIfCompleted()
+			s.checkIfCompleted(err)
 			s.completedMutex.Unlock()
 		},
 	}
-	s.sendStream = *newSendStream(streamID, senderForSendStream, flowController, version)
+	s.sendStream = *newSendStream(streamID, senderForSendStream, flowController, connSendBuffer, version)
 	senderForReceiveStream := &uniStreamSender{
 		streamSender: sender,
-		onStreamCompletedImpl: func() {
+		onStreamCompletedImpl: func(err error) {
 			s.completedMutex.Lock()
 			s.receiveStreamCompleted = true
-			s.checkIfCompleted()
+			s.checkIfCompleted(err)
 			s.completedMutex.Unlock()
 		},
 	}
 	s.receiveStream = *newReceiveStream(streamID, senderForReceiveStream, flowController, version)
+	s.receiveStream.notifyStream = s
 	return s
 }
 
@@ -156,8 +170,11 @@ func (s *stream) handleResetStreamFrame(frame *wire.ResetStreamFrame) error {
 
 // checkIfCompleted is called from the uniStreamSender, when one of the stream halves is completed.
 // It makes sure that the onStreamCompleted callback is only called if both receive and send side have completed.
-func (s *stream) checkIfCompleted() {
+func (s *stream) checkIfCompleted(err error) {
+	if s.completedErr == nil {
+		s.completedErr = err
+	}
 	if s.sendStreamCompleted && s.receiveStreamCompleted {
-		s.sender.onStreamCompleted(s.StreamID())
+		s.sender.onStreamCompleted(s.StreamID(), s.completedErr)
 	}
 }
@@ -0,0 +1,196 @@
+package quic
+
+import (
+	"sync"
+
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+	"github.com/lucas-clemente/quic-go/internal/utils"
+	"github.com/lucas-clemente/quic-go/internal/wire"
+)
+
+type streamEventType uint8
+
+const (
+	streamEventOpened streamEventType = iota
+	streamEventDataMoved
+	streamEventReset
+	streamEventClosed
+)
+
+type streamEvent struct {
+	typ streamEventType
+	id  protocol.StreamID
+
+	remote    bool // for streamEventOpened and streamEventReset
+	errorCode protocol.ApplicationErrorCode
+	bytes     protocol.ByteCount // for streamEventDataMoved
+	direction StreamDataDirection
+
+	sendFinalSize, receiveFinalSize protocol.ByteCount // for streamEventClosed
+}
+
+// tracedStream is the state of a stream that is tracked by the streamEventQueue.
+type tracedStream struct {
+	// the amount of data sent and received since the last call to Flush
+	bytesSent, bytesReceived protocol.ByteCount
+	// the highest offset sent and received
+	sendOffset, receiveOffset protocol.ByteCount
+	resetRemotely             bool
+}
+
+// The streamEventQueue collects the stream events for the ConnectionTracer.
+// Streams are opened, canceled and completed on application goroutines,
+// but the ConnectionTracer may only be called from the run loop.
+// Events are therefore queued, and passed to the ConnectionTracer when Flush is called from the run loop.
+// The amount of stream data sent and received is aggregated, and reported once per call to Flush.
+type streamEventQueue struct {
+	mutex sync.Mutex
+
+	events  []streamEvent
+	streams map[protocol.StreamID]*tracedStream
+	// the streams that data was sent or received on since the last call to Flush
+	streamsWithData []protocol.StreamID
+
+	// only used by Flush
+	flushing []streamEvent
+}
+
+func (q *streamEventQueue) Opened(id protocol.StreamID, remote bool) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	if q.streams == nil {
+		q.streams = make(map[protocol.StreamID]*tracedStream)
+	}
+	q.streams[id] = &tracedStream{}
+	q.events = append(q.events, streamEvent{typ: streamEventOpened, id: id, remote: remote})
+}
+
+func (q *streamEventQueue) SentStreamFrame(f *wire.StreamFrame) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	str, ok := q.streams[f.StreamID]
+	if !ok {
+		return
+	}
+	if f.DataLen() > 0 {
+		q.markHasData(f.StreamID, str)
+		str.bytesSent += f.DataLen()
+	}
+	str.sendOffset = utils.MaxByteCount(str.sendOffset, f.Offset+f.DataLen())
+}
+
+func (q *streamEventQueue) ReceivedStreamFrame(f *wire.StreamFrame) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	str, ok := q.streams[f.StreamID]
+	if !ok {
+		return
+	}
+	if f.DataLen() > 0 {
+		q.markHasData(f.StreamID, str)
+		str.bytesReceived += f.DataLen()
+	}
+	str.receiveOffset = utils.MaxByteCount(str.receiveOffset, f.Offset+f.DataLen())
+}
+
+// must be called before adding to bytesSent or bytesReceived
+func (q *streamEventQueue) markHasData(id protocol.StreamID, str *tracedStream) {
+	if str.bytesSent == 0 && str.bytesReceived == 0 {
+		q.streamsWithData = append(q.streamsWithData, id)
+	}
+}
+
+// Reset is called when a RESET_STREAM frame is queued for sending (remote = false), or when it is received (remote = true).
+// The peer might retransmit a RESET_STREAM frame, so only the first one received is reported.
+func (q *streamEventQueue) Reset(f *wire.ResetStreamFrame, remote bool) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	str, ok := q.streams[f.StreamID]
+	if !ok {
+		return
+	}
+	if remote {
+		if str.resetRemotely {
+			return
+		}
+		str.resetRemotely = true
+		str.receiveOffset = utils.MaxByteCount(str.receiveOffset, f.ByteOffset)
+	} else {
+		str.sendOffset = utils.MaxByteCount(str.sendOffset, f.ByteOffset)
+	}
+	q.events = append(q.events, streamEvent{typ: streamEventReset, id: f.StreamID, errorCode: f.ErrorCode, remote: remote})
+}
+
+// Closed is called when a stream has completed.
+// The final sizes are determined when the event is flushed,
+// since a STREAM frame with the FIN bit might only be recorded after the send side of the stream has completed.
+func (q *streamEventQueue) Closed(id protocol.StreamID) {
+	q.mutex.Lock()
+	q.events = append(q.events, streamEvent{typ: streamEventClosed, id: id})
+	q.mutex.Unlock()
+}
+
+// Flush passes all queued events to the tracer.
+// It must be called from the run loop.
+func (q *streamEventQueue) Flush(tracer ConnectionTracer) {
+	q.mutex.Lock()
+	events := q.flushing[:0]
+	for _, ev := range q.events {
+		switch ev.typ {
+		case streamEventReset:
+			// report the data sent or received before the stream was reset first
+			events = q.appendDataMoved(events, ev.id)
+		case streamEventClosed:
+			events = q.appendDataMoved(events, ev.id)
+			if str, ok := q.streams[ev.id]; ok {
+				ev.sendFinalSize = str.sendOffset
+				ev.receiveFinalSize = str.receiveOffset
+				delete(q.streams, ev.id)
+			}
+		}
+		events = append(events, ev)
+	}
+	for _, id := range q.streamsWithData {
+		events = q.appendDataMoved(events, id)
+	}
+	q.events = q.events[:0]
+	q.streamsWithData = q.streamsWithData[:0]
+	q.mutex.Unlock()
+
+	// Call the tracer without holding the mutex.
+	// Otherwise a tracer that opens or closes a stream would deadlock.
+	for _, ev := range events {
+		switch ev.typ {
+		case streamEventOpened:
+			tracer.StreamOpened(ev.id, ev.remote)
+		case streamEventDataMoved:
+			tracer.StreamDataMoved(ev.id, ev.bytes, ev.direction)
+		case streamEventReset:
+			tracer.StreamReset(ev.id, ev.errorCode, ev.remote)
+		case streamEventClosed:
+			tracer.StreamClosed(ev.id, ev.sendFinalSize, ev.receiveFinalSize)
+		}
+	}
+	q.flushing = events[:0]
+}
+
+// must be called with the mutex held
+func (q *streamEventQueue) appendDataMoved(events []streamEvent, id protocol.StreamID) []streamEvent {
+	str, ok := q.streams[id]
+	if !ok {
+		return events
+	}
+	if str.bytesSent > 0 {
+		events = append(events, streamEvent{typ: streamEventDataMoved, id: id, bytes: str.bytesSent, direction: StreamDataSent})
+		str.bytesSent = 0
+	}
+	if str.bytesReceived > 0 {
+		events = append(events, streamEvent{typ: streamEventDataMoved, id: id, bytes: str.bytesReceived, direction: StreamDataReceived})
+		str.bytesReceived = 0
+	}
+	return events
+}
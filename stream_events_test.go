@@ -0,0 +1,85 @@
+package quic
+
+import (
+	"github.com/golang/mock/gomock"
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+	"github.com/lucas-clemente/quic-go/internal/wire"
+
+	. "github.com/onsi/ginkgo"
+)
+
+var _ = Describe("Stream Events", func() {
+	var (
+		q      *streamEventQueue
+		tracer *MockConnectionTracer
+	)
+
+	BeforeEach(func() {
+		q = &streamEventQueue{}
+		tracer = NewMockConnectionTracer(mockCtrl)
+	})
+
+	It("doesn't call the tracer if there are no events", func() {
+		q.Flush(tracer)
+	})
+
+	It("aggregates the data sent and received", func() {
+		q.Opened(1, false)
+		q.Opened(4, true)
+		q.SentStreamFrame(&wire.StreamFrame{StreamID: 1, Data: []byte("foo")})
+		q.ReceivedStreamFrame(&wire.StreamFrame{StreamID: 4, Data: []byte("foobar")})
+		q.SentStreamFrame(&wire.StreamFrame{StreamID: 1, Offset: 3, Data: []byte("bar")})
+		q.ReceivedStreamFrame(&wire.StreamFrame{StreamID: 1, Data: []byte("lorem")})
+		gomock.InOrder(
+			tracer.EXPECT().StreamOpened(protocol.StreamID(1), false),
+			tracer.EXPECT().StreamOpened(protocol.StreamID(4), true),
+			tracer.EXPECT().StreamDataMoved(protocol.StreamID(1), protocol.ByteCount(6), StreamDataSent),
+			tracer.EXPECT().StreamDataMoved(protocol.StreamID(1), protocol.ByteCount(5), StreamDataReceived),
+			tracer.EXPECT().StreamDataMoved(protocol.StreamID(4), protocol.ByteCount(6), StreamDataReceived),
+		)
+		q.Flush(tracer)
+		// the amounts are reset after flushing
+		q.SentStreamFrame(&wire.StreamFrame{StreamID: 1, Offset: 6, Data: []byte("ipsum")})
+		tracer.EXPECT().StreamDataMoved(protocol.StreamID(1), protocol.ByteCount(5), StreamDataSent)
+		q.Flush(tracer)
+	})
+
+	It("reports the final sizes when a stream is closed", func() {
+		q.Opened(1, false)
+		q.SentStreamFrame(&wire.StreamFrame{StreamID: 1, Offset: 100, Data: []byte("foobar"), FinBit: true})
+		q.ReceivedStreamFrame(&wire.StreamFrame{StreamID: 1, Offset: 10, FinBit: true})
+		q.SentStreamFrame(&wire.StreamFrame{StreamID: 1, Offset: 50, Data: []byte("foo")}) // a retransmission
+		q.Closed(1)
+		gomock.InOrder(
+			tracer.EXPECT().StreamOpened(protocol.StreamID(1), false),
+			tracer.EXPECT().StreamDataMoved(protocol.StreamID(1), protocol.ByteCount(9), StreamDataSent),
+			tracer.EXPECT().StreamClosed(protocol.StreamID(1), protocol.ByteCount(106), protocol.ByteCount(10)),
+		)
+		q.Flush(tracer)
+		// events for closed streams are ignored
+		q.SentStreamFrame(&wire.StreamFrame{StreamID: 1, Offset: 100, Data: []byte("foobar"), FinBit: true})
+		q.Reset(&wire.ResetStreamFrame{StreamID: 1}, true)
+		q.Flush(tracer)
+	})
+
+	It("reports resets, and data sent or received before the reset", func() {
+		q.Opened(1, false)
+		q.Opened(5, false)
+		q.SentStreamFrame(&wire.StreamFrame{StreamID: 1, Data: []byte("foobar")})
+		q.SentStreamFrame(&wire.StreamFrame{StreamID: 5, Data: []byte("foo")})
+		q.Reset(&wire.ResetStreamFrame{StreamID: 1, ByteOffset: 6, ErrorCode: 42}, false)
+		q.Reset(&wire.ResetStreamFrame{StreamID: 5, ByteOffset: 100, ErrorCode: 1337}, true)
+		q.Reset(&wire.ResetStreamFrame{StreamID: 5, ByteOffset: 100, ErrorCode: 1337}, true) // a retransmission
+		q.Closed(5)
+		gomock.InOrder(
+			tracer.EXPECT().StreamOpened(protocol.StreamID(1), false),
+			tracer.EXPECT().StreamOpened(protocol.StreamID(5), false),
+			tracer.EXPECT().StreamDataMoved(protocol.StreamID(1), protocol.ByteCount(6), StreamDataSent),
+			tracer.EXPECT().StreamReset(protocol.StreamID(1), protocol.ApplicationErrorCode(42), false),
+			tracer.EXPECT().StreamDataMoved(protocol.StreamID(5), protocol.ByteCount(3), StreamDataSent),
+			tracer.EXPECT().StreamReset(protocol.StreamID(5), protocol.ApplicationErrorCode(1337), true),
+			tracer.EXPECT().StreamClosed(protocol.StreamID(5), protocol.ByteCount(3), protocol.ByteCount(100)),
+		)
+		q.Flush(tracer)
+	})
+})
@@ -0,0 +1,151 @@
+package quic
+
+import (
+	"sync/atomic"
+
+	"github.com/lucas-clemente/quic-go/internal/flowcontrol"
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+	"github.com/lucas-clemente/quic-go/internal/utils"
+	"github.com/lucas-clemente/quic-go/internal/wire"
+)
+
+// The connectionSendBuffer keeps track of the number of bytes buffered in the send buffers of all streams of a connection.
+type connectionSendBuffer struct {
+	sizeLimit protocol.ByteCount
+	buffered  uint64 // to be used as an atomic
+}
+
+func newConnectionSendBuffer(sizeLimit protocol.ByteCount) *connectionSendBuffer {
+	return &connectionSendBuffer{sizeLimit: sizeLimit}
+}
+
+// Len returns the number of bytes buffered in all streams.
+func (b *connectionSendBuffer) Len() protocol.ByteCount {
+	return protocol.ByteCount(atomic.LoadUint64(&b.buffered))
+}
+
+// Available returns the number of bytes that can be buffered before reaching the limit.
+func (b *connectionSendBuffer) Available() protocol.ByteCount {
+	if l := b.Len(); l < b.sizeLimit {
+		return b.sizeLimit - l
+	}
+	return 0
+}
+
+func (b *connectionSendBuffer) add(n protocol.ByteCount) {
+	atomic.AddUint64(&b.buffered, uint64(n))
+}
+
+func (b *connectionSendBuffer) remove(n protocol.ByteCount) {
+	atomic.AddUint64(&b.buffered, ^uint64(n-1))
+}
+
+// The streamSendBuffer holds data that was written to a send stream, but not yet sent.
+// Consecutive writes are appended to the same buffer,
+// such that they can be sent in a single STREAM frame.
+type streamSendBuffer struct {
+	streamID protocol.StreamID
+	offset   protocol.ByteCount // the stream offset of the first buffered byte
+	data     []byte
+
+	// SizeLimit is the maximum number of bytes that this buffer holds.
+	SizeLimit protocol.ByteCount
+	// connBuffer is used to limit the number of bytes buffered in all streams of the connection.
+	// It is nil if there's no connection-level limit.
+	connBuffer *connectionSendBuffer
+
+	flowController flowcontrol.StreamFlowController
+
+	version protocol.VersionNumber
+}
+
+func newStreamSendBuffer(
+	streamID protocol.StreamID,
+	flowController flowcontrol.StreamFlowController,
+	connBuffer *connectionSendBuffer,
+	version protocol.VersionNumber,
+) *streamSendBuffer {
+	return &streamSendBuffer{
+		streamID:       streamID,
+		SizeLimit:      protocol.MaxStreamSendBufferSize,
+		connBuffer:     connBuffer,
+		flowController: flowController,
+		version:        version,
+	}
+}
+
+// Len returns the number of buffered bytes.
+func (b *streamSendBuffer) Len() protocol.ByteCount {
+	return protocol.ByteCount(len(b.data))
+}
+
+// Available returns the number of bytes that can be added to the buffer.
+// It respects both the size limit of this buffer and the connection-level limit.
+// To guarantee progress, an empty buffer can always take at least protocol.MinStreamSendBufferReservation bytes,
+// even if the connection-level limit was reached.
+func (b *streamSendBuffer) Available() protocol.ByteCount {
+	if b.Len() >= b.SizeLimit {
+		return 0
+	}
+	available := b.SizeLimit - b.Len()
+	if b.connBuffer == nil {
+		return available
+	}
+	connAvailable := b.connBuffer.Available()
+	if b.Len() == 0 {
+		connAvailable = utils.MaxByteCount(connAvailable, protocol.MinStreamSendBufferReservation)
+	}
+	return utils.MinByteCount(available, connAvailable)
+}
+
+// Write appends p to the buffer.
+// The data is copied, so p may be reused after Write returns.
+func (b *streamSendBuffer) Write(p []byte) {
+	b.data = append(b.data, p...)
+	if b.connBuffer != nil {
+		b.connBuffer.add(protocol.ByteCount(len(p)))
+	}
+}
+
+// Reset drops all buffered data.
+func (b *streamSendBuffer) Reset() {
+	if b.connBuffer != nil && len(b.data) > 0 {
+		b.connBuffer.remove(b.Len())
+	}
+	b.data = nil
+}
+
+// Coalesce returns a single STREAM frame covering as much of the buffered data as fits into maxSize.
+// maxSize is the maximum length of the frame, including the frame header.
+// The data is also limited by the stream's flow control window.
+// It returns nil if the buffer is empty, or if no data can be sent.
+func (b *streamSendBuffer) Coalesce(maxSize protocol.ByteCount) *wire.StreamFrame {
+	if len(b.data) == 0 {
+		return nil
+	}
+	frame := &wire.StreamFrame{
+		StreamID:       b.streamID,
+		Offset:         b.offset,
+		DataLenPresent: true,
+	}
+	n := utils.MinByteCount(frame.MaxDataLen(maxSize, b.version), b.Len())
+	if n == 0 { // a STREAM frame must have at least one byte of data
+		return nil
+	}
+	n = utils.MinByteCount(n, b.flowController.SendWindowSize())
+	if n == 0 {
+		return nil
+	}
+	// Limit the capacity, so that appending to the frame's data can't overwrite the buffer.
+	frame.Data = b.data[:n:n]
+	b.data = b.data[n:]
+	if len(b.data) == 0 {
+		b.data = nil
+	}
+	b.offset += n
+	if b.connBuffer != nil {
+		b.connBuffer.remove(n)
+	}
+	b.flowController.AddBytesSent(n)
+	return frame
+}
@@ -0,0 +1,221 @@
+package quic
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/lucas-clemente/quic-go/internal/congestion"
+	"github.com/lucas-clemente/quic-go/internal/flowcontrol"
+	"github.com/lucas-clemente/quic-go/internal/mocks"
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+	"github.com/lucas-clemente/quic-go/internal/utils"
+	"github.com/lucas-clemente/quic-go/internal/wire"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Stream Send Buffer", func() {
+	const streamID protocol.StreamID = 1337
+
+	var (
+		buf    *streamSendBuffer
+		mockFC *mocks.MockStreamFlowController
+	)
+
+	BeforeEach(func() {
+		mockFC = mocks.NewMockStreamFlowController(mockCtrl)
+		buf = newStreamSendBuffer(streamID, mockFC, nil, protocol.VersionWhatever)
+	})
+
+	It("returns nil when empty", func() {
+		Expect(buf.Coalesce(1000)).To(BeNil())
+	})
+
+	It("copies the data", func() {
+		b := []byte("foobar")
+		buf.Write(b)
+		b[0] = 'g'
+		mockFC.EXPECT().SendWindowSize().Return(protocol.MaxByteCount)
+		mockFC.EXPECT().AddBytesSent(protocol.ByteCount(6))
+		f := buf.Coalesce(1000)
+		Expect(f.Data).To(Equal([]byte("foobar")))
+	})
+
+	It("coalesces consecutive writes", func() {
+		for i := 0; i < 100; i++ {
+			buf.Write(bytes.Repeat([]byte{byte(i)}, 10))
+		}
+		Expect(buf.Len()).To(Equal(protocol.ByteCount(1000)))
+		mockFC.EXPECT().SendWindowSize().Return(protocol.MaxByteCount)
+		mockFC.EXPECT().AddBytesSent(protocol.ByteCount(1000))
+		f := buf.Coalesce(2000)
+		Expect(f).ToNot(BeNil())
+		Expect(f.StreamID).To(Equal(streamID))
+		Expect(f.Offset).To(BeZero())
+		Expect(f.DataLenPresent).To(BeTrue())
+		Expect(f.Data).To(HaveLen(1000))
+		Expect(f.Data[995:]).To(Equal(bytes.Repeat([]byte{99}, 5)))
+		Expect(buf.Len()).To(BeZero())
+	})
+
+	It("respects the maximum frame size", func() {
+		buf.Write(make([]byte, 1000))
+		mockFC.EXPECT().SendWindowSize().Return(protocol.MaxByteCount).Times(2)
+		mockFC.EXPECT().AddBytesSent(gomock.Any()).Times(2)
+		f := buf.Coalesce(500)
+		Expect(f.Length(protocol.VersionWhatever)).To(Equal(protocol.ByteCount(500)))
+		f2 := buf.Coalesce(1000)
+		Expect(f2.Offset).To(Equal(f.DataLen()))
+		Expect(f.DataLen() + f2.DataLen()).To(Equal(protocol.ByteCount(1000)))
+		Expect(buf.Len()).To(BeZero())
+	})
+
+	It("doesn't return a frame if the maximum size is too small", func() {
+		buf.Write([]byte("foobar"))
+		Expect(buf.Coalesce(2)).To(BeNil())
+		Expect(buf.Len()).To(Equal(protocol.ByteCount(6)))
+	})
+
+	It("respects the flow control window", func() {
+		buf.Write([]byte("foobar"))
+		mockFC.EXPECT().SendWindowSize().Return(protocol.ByteCount(4))
+		mockFC.EXPECT().AddBytesSent(protocol.ByteCount(4))
+		f := buf.Coalesce(1000)
+		Expect(f.Data).To(Equal([]byte("foob")))
+		mockFC.EXPECT().SendWindowSize().Return(protocol.ByteCount(0))
+		Expect(buf.Coalesce(1000)).To(BeNil())
+		Expect(buf.Len()).To(Equal(protocol.ByteCount(2)))
+	})
+
+	It("doesn't overwrite popped data when appending", func() {
+		buf.Write([]byte("foobar"))
+		mockFC.EXPECT().SendWindowSize().Return(protocol.MaxByteCount).Times(2)
+		mockFC.EXPECT().AddBytesSent(gomock.Any()).Times(2)
+		f := buf.Coalesce(1000)
+		buf.Write([]byte("raboof"))
+		f.Data = append(f.Data, 'x')
+		Expect(f.Data).To(Equal([]byte("foobarx")))
+		Expect(buf.Coalesce(1000).Data).To(Equal([]byte("raboof")))
+	})
+
+	It("says how much space is available", func() {
+		Expect(buf.Available()).To(Equal(protocol.MaxStreamSendBufferSize))
+		buf.Write([]byte("foobar"))
+		Expect(buf.Available()).To(Equal(protocol.MaxStreamSendBufferSize - 6))
+		buf.Write(make([]byte, protocol.MaxStreamSendBufferSize))
+		Expect(buf.Available()).To(BeZero())
+	})
+
+	It("respects the size limit", func() {
+		buf.SizeLimit = 100
+		Expect(buf.Available()).To(Equal(protocol.ByteCount(100)))
+		buf.Write(make([]byte, 60))
+		Expect(buf.Available()).To(Equal(protocol.ByteCount(40)))
+	})
+
+	It("drops the data when reset", func() {
+		buf.Write([]byte("foobar"))
+		buf.Reset()
+		Expect(buf.Len()).To(BeZero())
+		Expect(buf.Coalesce(1000)).To(BeNil())
+	})
+
+	Context("limiting the connection send buffer", func() {
+		var connBuffer *connectionSendBuffer
+
+		BeforeEach(func() {
+			connBuffer = newConnectionSendBuffer(10000)
+			buf = newStreamSendBuffer(streamID, mockFC, connBuffer, protocol.VersionWhatever)
+		})
+
+		It("accounts for written and sent data", func() {
+			buf.Write(make([]byte, 1000))
+			Expect(connBuffer.Len()).To(Equal(protocol.ByteCount(1000)))
+			Expect(connBuffer.Available()).To(Equal(protocol.ByteCount(9000)))
+			mockFC.EXPECT().SendWindowSize().Return(protocol.MaxByteCount)
+			mockFC.EXPECT().AddBytesSent(gomock.Any())
+			f := buf.Coalesce(500)
+			Expect(connBuffer.Len()).To(Equal(1000 - f.DataLen()))
+		})
+
+		It("releases the data when reset", func() {
+			buf.Write(make([]byte, 1000))
+			buf.Reset()
+			Expect(connBuffer.Len()).To(BeZero())
+		})
+
+		It("respects the connection-level limit", func() {
+			buf2 := newStreamSendBuffer(streamID+4, mockFC, connBuffer, protocol.VersionWhatever)
+			buf2.Write(make([]byte, 8000))
+			Expect(buf.Available()).To(Equal(protocol.ByteCount(2000)))
+			buf.Write(make([]byte, 1000))
+			Expect(buf.Available()).To(Equal(protocol.ByteCount(1000)))
+			buf2.Write(make([]byte, 1000))
+			Expect(buf.Available()).To(BeZero())
+			Expect(buf2.Available()).To(BeZero())
+		})
+
+		It("always allows an empty buffer to take a minimum number of bytes", func() {
+			buf2 := newStreamSendBuffer(streamID+4, mockFC, connBuffer, protocol.VersionWhatever)
+			buf2.Write(make([]byte, 10000))
+			Expect(buf.Available()).To(Equal(protocol.MinStreamSendBufferReservation))
+			buf.Write(make([]byte, 10))
+			Expect(buf.Available()).To(BeZero())
+		})
+	})
+})
+
+func newBenchmarkStreamFlowController(id protocol.StreamID) flowcontrol.StreamFlowController {
+	rttStats := &congestion.RTTStats{}
+	cfc := flowcontrol.NewConnectionFlowController(protocol.MaxByteCount, protocol.MaxByteCount, func() {}, rttStats, utils.DefaultLogger)
+	cfc.UpdateSendWindow(protocol.MaxByteCount)
+	return flowcontrol.NewStreamFlowController(id, cfc, protocol.MaxByteCount, protocol.MaxByteCount, protocol.MaxByteCount, func(protocol.StreamID) {}, rttStats, utils.DefaultLogger)
+}
+
+// BenchmarkStreamFramesIndividual serializes 1000 STREAM frames containing 100 bytes each,
+// as they would be sent if every Write was sent in a separate frame.
+func BenchmarkStreamFramesIndividual(b *testing.B) {
+	data := make([]byte, 100)
+	buf := &bytes.Buffer{}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		buf.Reset()
+		var offset protocol.ByteCount
+		for j := 0; j < 1000; j++ {
+			f := &wire.StreamFrame{
+				StreamID:       4,
+				Offset:         offset,
+				DataLenPresent: true,
+				Data:           data,
+			}
+			if err := f.Write(buf, protocol.VersionTLS); err != nil {
+				b.Fatal(err)
+			}
+			offset += f.DataLen()
+		}
+	}
+}
+
+func BenchmarkStreamFramesCoalesced(b *testing.B) {
+	data := make([]byte, 100)
+	buf := &bytes.Buffer{}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		buf.Reset()
+		sendBuf := newStreamSendBuffer(4, newBenchmarkStreamFlowController(4), nil, protocol.VersionTLS)
+		for j := 0; j < 1000; j++ {
+			sendBuf.Write(data)
+		}
+		for {
+			f := sendBuf.Coalesce(protocol.MaxPacketSizeIPv4)
+			if f == nil {
+				break
+			}
+			if err := f.Write(buf, protocol.VersionTLS); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
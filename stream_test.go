@@ -1,6 +1,7 @@
 package quic
 
 import (
+	"errors"
 	"io"
 	"os"
 	"strconv"
@@ -39,7 +40,7 @@ var _ = Describe("Stream", func() {
 	BeforeEach(func() {
 		mockSender = NewMockStreamSender(mockCtrl)
 		mockFC = mocks.NewMockStreamFlowController(mockCtrl)
-		str = newStream(streamID, mockSender, mockFC, protocol.VersionWhatever)
+		str = newStream(streamID, mockSender, mockFC, nil, protocol.VersionWhatever)
 
 		timeout := scaleDuration(250 * time.Millisecond)
 		strWithTimeout = struct {
@@ -55,6 +56,13 @@ var _ = Describe("Stream", func() {
 		Expect(str.StreamID()).To(Equal(protocol.StreamID(1337)))
 	})
 
+	It("passes the bidirectional stream to the OnReadAvailable callback", func() {
+		mockFC.EXPECT().UpdateHighestReceived(protocol.ByteCount(6), false)
+		mockSender.EXPECT().onReadAvailable(str, 6)
+		str.SetReadNotifyThreshold(1)
+		Expect(str.handleStreamFrame(&wire.StreamFrame{Data: []byte("foobar")})).To(Succeed())
+	})
+
 	Context("deadlines", func() {
 		It("sets a write deadline, when SetDeadline is called", func() {
 			str.SetDeadline(time.Now().Add(-time.Second))
@@ -79,18 +87,32 @@ var _ = Describe("Stream", func() {
 	Context("completing", func() {
 		It("is not completed when only the receive side is completed", func() {
 			// don't EXPECT a call to mockSender.onStreamCompleted()
-			str.receiveStream.sender.onStreamCompleted(streamID)
+			str.receiveStream.sender.onStreamCompleted(streamID, nil)
 		})
 
 		It("is not completed when only the send side is completed", func() {
 			// don't EXPECT a call to mockSender.onStreamCompleted()
-			str.sendStream.sender.onStreamCompleted(streamID)
+			str.sendStream.sender.onStreamCompleted(streamID, nil)
 		})
 
 		It("is completed when both sides are completed", func() {
-			mockSender.EXPECT().onStreamCompleted(streamID)
-			str.sendStream.sender.onStreamCompleted(streamID)
-			str.receiveStream.sender.onStreamCompleted(streamID)
+			mockSender.EXPECT().onStreamCompleted(streamID, nil)
+			str.sendStream.sender.onStreamCompleted(streamID, nil)
+			str.receiveStream.sender.onStreamCompleted(streamID, nil)
+		})
+
+		It("reports the error of the stream half that was canceled", func() {
+			testErr := errors.New("canceled")
+			mockSender.EXPECT().onStreamCompleted(streamID, testErr)
+			str.sendStream.sender.onStreamCompleted(streamID, testErr)
+			str.receiveStream.sender.onStreamCompleted(streamID, nil)
+		})
+
+		It("reports the error of the stream half that was canceled first", func() {
+			testErr := errors.New("canceled")
+			mockSender.EXPECT().onStreamCompleted(streamID, testErr)
+			str.receiveStream.sender.onStreamCompleted(streamID, testErr)
+			str.sendStream.sender.onStreamCompleted(streamID, errors.New("reset"))
 		})
 	})
 })
@@ -22,11 +22,27 @@ func (streamOpenErr) Timeout() bool     { return false }
 // errTooManyOpenStreams is used internally by the outgoing streams maps.
 var errTooManyOpenStreams = errors.New("too many open streams")
 
+// streamState is the state of a stream, as returned by the State method of the streams maps.
+type streamState uint8
+
+const (
+	// streamStateOpen means that the stream is open.
+	streamStateOpen streamState = iota
+	// streamStateNotOpened means that the stream wasn't opened yet, but it is allowed to be opened.
+	streamStateNotOpened
+	// streamStateUnavailable means that the stream was already closed, or that it can't be opened,
+	// because it exceeds the stream limit.
+	streamStateUnavailable
+)
+
 type streamsMap struct {
 	perspective protocol.Perspective
 
 	sender            streamSender
 	newFlowController func(protocol.StreamID) flowcontrol.StreamFlowController
+	connSendBuffer    *connectionSendBuffer
+	// onStreamOpened is called for every stream that is opened. It may be nil.
+	onStreamOpened func(protocol.StreamID)
 
 	outgoingBidiStreams *outgoingBidiStreamsMap
 	outgoingUniStreams  *outgoingUniStreamsMap
@@ -39,6 +55,8 @@ var _ streamManager = &streamsMap{}
 func newStreamsMap(
 	sender streamSender,
 	newFlowController func(protocol.StreamID) flowcontrol.StreamFlowController,
+	connSendBuffer *connectionSendBuffer,
+	onStreamOpened func(protocol.StreamID),
 	maxIncomingStreams uint64,
 	maxIncomingUniStreams uint64,
 	perspective protocol.Perspective,
@@ -47,15 +65,20 @@ func newStreamsMap(
 	m := &streamsMap{
 		perspective:       perspective,
 		newFlowController: newFlowController,
+		connSendBuffer:    connSendBuffer,
+		onStreamOpened:    onStreamOpened,
 		sender:            sender,
 	}
 	newBidiStream := func(id protocol.StreamID) streamI {
-		return newStream(id, m.sender, m.newFlowController(id), version)
+		m.streamOpened(id)
+		return newStream(id, m.sender, m.newFlowController(id), m.connSendBuffer, version)
 	}
 	newUniSendStream := func(id protocol.StreamID) sendStreamI {
-		return newSendStream(id, m.sender, m.newFlowController(id), version)
+		m.streamOpened(id)
+		return newSendStream(id, m.sender, m.newFlowController(id), m.connSendBuffer, version)
 	}
 	newUniReceiveStream := func(id protocol.StreamID) receiveStreamI {
+		m.streamOpened(id)
 		return newReceiveStream(id, m.sender, m.newFlowController(id), version)
 	}
 	m.outgoingBidiStreams = newOutgoingBidiStreamsMap(
@@ -85,6 +108,12 @@ func newStreamsMap(
 	return m
 }
 
+func (m *streamsMap) streamOpened(id protocol.StreamID) {
+	if m.onStreamOpened != nil {
+		m.onStreamOpened(id)
+	}
+}
+
 func (m *streamsMap) OpenStream() (Stream, error) {
 	return m.outgoingBidiStreams.OpenStream()
 }
@@ -159,6 +188,25 @@ func (m *streamsMap) GetOrOpenSendStream(id protocol.StreamID) (sendStreamI, err
 	panic("")
 }
 
+// SendStreamState returns the state of the send stream with the given ID.
+// Unlike GetOrOpenSendStream, it never opens a new stream.
+// Receive-only streams are unavailable.
+func (m *streamsMap) SendStreamState(id protocol.StreamID) streamState {
+	switch id.Type() {
+	case protocol.StreamTypeUni:
+		if id.InitiatedBy() == m.perspective {
+			return m.outgoingUniStreams.State(id)
+		}
+		return streamStateUnavailable
+	case protocol.StreamTypeBidi:
+		if id.InitiatedBy() == m.perspective {
+			return m.outgoingBidiStreams.State(id)
+		}
+		return m.incomingBidiStreams.State(id)
+	}
+	panic("")
+}
+
 func (m *streamsMap) HandleMaxStreamsFrame(f *wire.MaxStreamsFrame) error {
 	if f.MaxStreams > protocol.MaxStreamCount {
 		return qerr.StreamLimitError
@@ -114,6 +114,28 @@ func (m *incomingItemsMap) GetOrOpenStream(id protocol.StreamID) (item, error) {
 	return s, nil
 }
 
+// State returns the state of the stream with the given ID.
+// Unlike GetOrOpenStream, it never opens a new stream.
+func (m *incomingItemsMap) State(id protocol.StreamID) streamState {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	if id >= m.nextStreamToOpen {
+		if id > m.maxStream {
+			return streamStateUnavailable
+		}
+		return streamStateNotOpened
+	}
+	// If the stream was already queued for deletion, and is just waiting to be accepted, it is closed.
+	if _, ok := m.streamsToDelete[id]; ok {
+		return streamStateUnavailable
+	}
+	if _, ok := m.streams[id]; !ok {
+		return streamStateUnavailable
+	}
+	return streamStateOpen
+}
+
 func (m *incomingItemsMap) DeleteStream(id protocol.StreamID) error {
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
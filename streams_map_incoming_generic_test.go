@@ -197,6 +197,20 @@ var _ = Describe("Streams Map (incoming)", func() {
 		Expect(str).ToNot(BeNil())
 	})
 
+	It("says what state a stream is in, without opening it", func() {
+		Expect(m.State(firstNewStream)).To(Equal(streamStateNotOpened))
+		Expect(m.State(initialMaxStream)).To(Equal(streamStateNotOpened))
+		Expect(m.State(initialMaxStream + 4)).To(Equal(streamStateUnavailable))
+		_, err := m.GetOrOpenStream(firstNewStream)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(m.State(firstNewStream)).To(Equal(streamStateOpen))
+		Expect(m.State(firstNewStream + 4)).To(Equal(streamStateNotOpened))
+		Expect(newItemCounter).To(Equal(1))
+		// the stream is queued for deletion, since it wasn't accepted yet
+		Expect(m.DeleteStream(firstNewStream)).To(Succeed())
+		Expect(m.State(firstNewStream)).To(Equal(streamStateUnavailable))
+	})
+
 	It("errors when deleting a non-existing stream", func() {
 		err := m.DeleteStream(1337)
 		Expect(err).To(MatchError("Tried to delete unknown stream 1337"))
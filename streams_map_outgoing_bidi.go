@@ -114,6 +114,24 @@ func (m *outgoingBidiStreamsMap) GetStream(id protocol.StreamID) (streamI, error
 	return s, nil
 }
 
+// State returns the state of the stream with the given ID.
+// Streams that exceed the limit set by the peer can't be opened.
+func (m *outgoingBidiStreamsMap) State(id protocol.StreamID) streamState {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	if id >= m.nextStream {
+		if !m.maxStreamSet || id > m.maxStream {
+			return streamStateUnavailable
+		}
+		return streamStateNotOpened
+	}
+	if _, ok := m.streams[id]; !ok {
+		return streamStateUnavailable
+	}
+	return streamStateOpen
+}
+
 func (m *outgoingBidiStreamsMap) DeleteStream(id protocol.StreamID) error {
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
@@ -101,6 +101,19 @@ var _ = Describe("Streams Map (outgoing)", func() {
 	})
 
 	Context("with stream ID limits", func() {
+		It("says what state a stream is in", func() {
+			Expect(m.State(firstNewStream)).To(Equal(streamStateUnavailable))
+			m.SetMaxStream(firstNewStream + 4)
+			Expect(m.State(firstNewStream)).To(Equal(streamStateNotOpened))
+			Expect(m.State(firstNewStream + 4)).To(Equal(streamStateNotOpened))
+			Expect(m.State(firstNewStream + 8)).To(Equal(streamStateUnavailable))
+			_, err := m.OpenStream()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(m.State(firstNewStream)).To(Equal(streamStateOpen))
+			Expect(m.DeleteStream(firstNewStream)).To(Succeed())
+			Expect(m.State(firstNewStream)).To(Equal(streamStateUnavailable))
+		})
+
 		It("errors when no stream can be opened immediately", func() {
 			mockSender.EXPECT().queueControlFrame(gomock.Any())
 			_, err := m.OpenStream()
@@ -81,7 +81,7 @@ var _ = Describe("Streams Map", func() {
 
 			BeforeEach(func() {
 				mockSender = NewMockStreamSender(mockCtrl)
-				m = newStreamsMap(mockSender, newFlowController, maxBidiStreams, maxUniStreams, perspective, protocol.VersionWhatever).(*streamsMap)
+				m = newStreamsMap(mockSender, newFlowController, nil, nil, maxBidiStreams, maxUniStreams, perspective, protocol.VersionWhatever).(*streamsMap)
 			})
 
 			Context("opening", func() {
@@ -110,6 +110,25 @@ var _ = Describe("Streams Map", func() {
 				})
 			})
 
+			It("reports opened streams", func() {
+				var opened []protocol.StreamID
+				m.onStreamOpened = func(id protocol.StreamID) { opened = append(opened, id) }
+				allowUnlimitedStreams()
+				_, err := m.OpenStream()
+				Expect(err).ToNot(HaveOccurred())
+				_, err = m.OpenUniStream()
+				Expect(err).ToNot(HaveOccurred())
+				// opening the second incoming stream implicitly opens the first one
+				_, err = m.GetOrOpenReceiveStream(ids.firstIncomingBidiStream + 4)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(opened).To(Equal([]protocol.StreamID{
+					ids.firstOutgoingBidiStream,
+					ids.firstOutgoingUniStream,
+					ids.firstIncomingBidiStream,
+					ids.firstIncomingBidiStream + 4,
+				}))
+			})
+
 			Context("accepting", func() {
 				It("accepts bidirectional streams", func() {
 					_, err := m.GetOrOpenReceiveStream(ids.firstIncomingBidiStream)
@@ -292,6 +311,48 @@ var _ = Describe("Streams Map", func() {
 						Expect(err).To(MatchError(fmt.Errorf("peer attempted to open receive stream %d", id)))
 					})
 				})
+
+				Context("the state of send streams", func() {
+					It("says if outgoing streams are open", func() {
+						Expect(m.SendStreamState(ids.firstOutgoingBidiStream)).To(Equal(streamStateNotOpened))
+						Expect(m.SendStreamState(ids.firstOutgoingUniStream)).To(Equal(streamStateNotOpened))
+						_, err := m.OpenStream()
+						Expect(err).ToNot(HaveOccurred())
+						_, err = m.OpenUniStream()
+						Expect(err).ToNot(HaveOccurred())
+						Expect(m.SendStreamState(ids.firstOutgoingBidiStream)).To(Equal(streamStateOpen))
+						Expect(m.SendStreamState(ids.firstOutgoingUniStream)).To(Equal(streamStateOpen))
+					})
+
+					It("says if incoming bidirectional streams are open, without opening them", func() {
+						Expect(m.SendStreamState(ids.firstIncomingBidiStream)).To(Equal(streamStateNotOpened))
+						_, err := m.GetOrOpenSendStream(ids.firstIncomingBidiStream)
+						Expect(err).ToNot(HaveOccurred())
+						Expect(m.SendStreamState(ids.firstIncomingBidiStream)).To(Equal(streamStateOpen))
+					})
+
+					It("says that incoming unidirectional streams are unavailable", func() {
+						_, err := m.GetOrOpenReceiveStream(ids.firstIncomingUniStream)
+						Expect(err).ToNot(HaveOccurred())
+						Expect(m.SendStreamState(ids.firstIncomingUniStream)).To(Equal(streamStateUnavailable))
+					})
+
+					It("says that deleted streams are unavailable", func() {
+						_, err := m.OpenStream()
+						Expect(err).ToNot(HaveOccurred())
+						Expect(m.DeleteStream(ids.firstOutgoingBidiStream)).To(Succeed())
+						Expect(m.SendStreamState(ids.firstOutgoingBidiStream)).To(Equal(streamStateUnavailable))
+					})
+
+					It("says that streams exceeding the stream limit are unavailable", func() {
+						m = newStreamsMap(mockSender, newFlowController, nil, nil, maxBidiStreams, maxUniStreams, perspective, protocol.VersionWhatever).(*streamsMap)
+						m.UpdateLimits(&handshake.TransportParameters{MaxBidiStreams: 1, MaxUniStreams: 1})
+						Expect(m.SendStreamState(ids.firstOutgoingBidiStream)).To(Equal(streamStateNotOpened))
+						Expect(m.SendStreamState(ids.firstOutgoingBidiStream + 4)).To(Equal(streamStateUnavailable))
+						Expect(m.SendStreamState(ids.firstOutgoingUniStream + 4)).To(Equal(streamStateUnavailable))
+						Expect(m.SendStreamState(ids.firstIncomingBidiStream + 4*maxBidiStreams)).To(Equal(streamStateUnavailable))
+					})
+				})
 			})
 
 			Context("updating stream ID limits", func() {
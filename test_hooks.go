@@ -0,0 +1,43 @@
+// +build internal_test
+
+package quic
+
+import (
+	"errors"
+	"sync"
+)
+
+// testHooks are functions that are run on the run loop of a session.
+type testHooks struct {
+	mutex sync.Mutex
+	queue []func()
+}
+
+// runOnRunLoop runs f on the run loop and waits for it to return.
+// Tests use it to access state that is not thread-safe, e.g. the sent packet handler.
+func (s *session) runOnRunLoop(f func()) error {
+	done := make(chan struct{})
+	s.testHooks.mutex.Lock()
+	s.testHooks.queue = append(s.testHooks.queue, func() {
+		f()
+		close(done)
+	})
+	s.testHooks.mutex.Unlock()
+	s.scheduleSending()
+	select {
+	case <-done:
+		return nil
+	case <-s.ctx.Done():
+		return errors.New("session closed")
+	}
+}
+
+func (s *session) runTestHooks() {
+	s.testHooks.mutex.Lock()
+	queue := s.testHooks.queue
+	s.testHooks.queue = nil
+	s.testHooks.mutex.Unlock()
+	for _, f := range queue {
+		f()
+	}
+}
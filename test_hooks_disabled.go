@@ -0,0 +1,8 @@
+// +build !internal_test
+
+package quic
+
+// Test hooks are only available in builds with the internal_test build tag.
+type testHooks struct{}
+
+func (s *session) runTestHooks() {}
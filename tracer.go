@@ -0,0 +1,196 @@
+package quic
+
+import (
+	"net"
+
+	"github.com/lucas-clemente/quic-go/internal/ackhandler"
+	"github.com/lucas-clemente/quic-go/internal/congestion"
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+	"github.com/lucas-clemente/quic-go/internal/wire"
+)
+
+// An ExtendedHeader is the header of a QUIC packet, including the packet number.
+type ExtendedHeader = wire.ExtendedHeader
+
+// A PacketNumber is a QUIC packet number.
+type PacketNumber = protocol.PacketNumber
+
+// A Frame is a QUIC frame.
+type Frame = wire.Frame
+
+// An AckFrame is an ACK frame.
+type AckFrame = wire.AckFrame
+
+// RTTStats are the RTT statistics of a connection.
+type RTTStats = congestion.RTTStats
+
+// A PacketLossTrigger is the reason why a packet was declared lost.
+type PacketLossTrigger = ackhandler.PacketLossTrigger
+
+const (
+	// PacketLossTimeThreshold is used when a packet was sent too long before a packet that was acknowledged.
+	PacketLossTimeThreshold = ackhandler.PacketLossTimeThreshold
+	// PacketLossInjected is used when a packet was declared lost using ErrorInjector.TestInjectPacketLoss (see EnableErrorInjection).
+	PacketLossInjected = ackhandler.PacketLossInjected
+)
+
+// A PacketDropReason is the reason why a packet was dropped.
+type PacketDropReason uint8
+
+const (
+	// PacketDropHeaderParseError is used when the header of a packet could not be parsed.
+	PacketDropHeaderParseError PacketDropReason = iota
+	// PacketDropUnknownConnectionID is used when a packet has an unexpected connection ID,
+	// e.g. when a coalesced packet has a different destination connection ID than the first packet.
+	PacketDropUnknownConnectionID
+	// PacketDropUnexpectedPacket is used for packets that are not expected in the current state of the connection,
+	// e.g. a Retry packet after the client received a packet from the server.
+	PacketDropUnexpectedPacket
+	// PacketDropKeyUnavailable is used when the keys to decrypt a packet are not available,
+	// and the packet can't be queued for later decryption.
+	PacketDropKeyUnavailable
+	// PacketDropPayloadDecryptError is used when a packet could not be decrypted.
+	PacketDropPayloadDecryptError
+	// PacketDropUnsupportedVersion is used when a packet uses a QUIC version that is not supported.
+	// The server responds with a Version Negotiation packet.
+	PacketDropUnsupportedVersion
+	// PacketDropBufferFull is used when a packet is dropped because the queue of packets waiting to be processed is full.
+	// The ConnectionTracer is not called for these packets, since they are dropped before reaching the session's run loop.
+	PacketDropBufferFull
+	// PacketDropDuplicate is used when a packet with the same packet number was already received.
+	PacketDropDuplicate
+)
+
+const numPacketDropReasons = int(PacketDropDuplicate) + 1
+
+func (r PacketDropReason) String() string {
+	switch r {
+	case PacketDropHeaderParseError:
+		return "header parse error"
+	case PacketDropUnknownConnectionID:
+		return "unknown connection ID"
+	case PacketDropUnexpectedPacket:
+		return "unexpected packet"
+	case PacketDropKeyUnavailable:
+		return "key unavailable"
+	case PacketDropPayloadDecryptError:
+		return "payload decrypt error"
+	case PacketDropUnsupportedVersion:
+		return "unsupported version"
+	case PacketDropBufferFull:
+		return "buffer full"
+	case PacketDropDuplicate:
+		return "duplicate"
+	default:
+		return "unknown drop reason"
+	}
+}
+
+// A StreamDataDirection is the direction in which stream data was transferred.
+type StreamDataDirection uint8
+
+const (
+	// StreamDataSent is used for stream data sent to the peer.
+	StreamDataSent StreamDataDirection = iota
+	// StreamDataReceived is used for stream data received from the peer.
+	StreamDataReceived
+)
+
+func (d StreamDataDirection) String() string {
+	switch d {
+	case StreamDataSent:
+		return "sent"
+	case StreamDataReceived:
+		return "received"
+	default:
+		return "unknown direction"
+	}
+}
+
+// A Tracer creates a ConnectionTracer for every connection.
+type Tracer interface {
+	// TracerForConnection is called when a connection is created.
+	// For the client, odcid is the destination connection ID of the first Initial packet,
+	// for the server, it is the destination connection ID of the client's Initial packet.
+	// It may return nil, in which case the connection is not traced.
+	TracerForConnection(isClient bool, odcid ConnectionID) ConnectionTracer
+}
+
+// A ConnectionTracer records events that happen on a single connection.
+// All methods are called synchronously from the session's run loop,
+// so implementations can keep per-connection state without synchronization.
+// They must return quickly, and must not retain the headers and frames passed to them.
+type ConnectionTracer interface {
+	// StartedConnection is called when the session starts running.
+	StartedConnection(local, remote net.Addr, version VersionNumber, srcConnID, destConnID ConnectionID)
+	// SentPacket is called when a packet is sent.
+	// ack is the ACK frame contained in the packet, if any. It is not included in frames.
+	SentPacket(hdr *ExtendedHeader, size ByteCount, ack *AckFrame, frames []Frame)
+	// ReceivedPacket is called when a packet was received and successfully decrypted.
+	ReceivedPacket(hdr *ExtendedHeader, size ByteCount, frames []Frame)
+	// DroppedPacket is called when a packet is dropped.
+	DroppedPacket(size ByteCount, reason PacketDropReason)
+	// LostPacket is called when a packet is declared lost.
+	LostPacket(encLevel EncryptionLevel, pn PacketNumber, trigger PacketLossTrigger)
+	// UpdatedMetrics is called after processing an ACK frame.
+	UpdatedMetrics(rttStats *RTTStats, cwnd, bytesInFlight ByteCount)
+	// StreamOpened is called when a stream is opened.
+	// remote is true if the stream was opened by the peer.
+	StreamOpened(id StreamID, remote bool)
+	// StreamDataMoved is called with the amount of stream data sent to or received from the peer in STREAM frames,
+	// including retransmissions.
+	// It is not called for every STREAM frame: the amount is aggregated,
+	// and reported at most once per run loop iteration for every stream and direction.
+	StreamDataMoved(id StreamID, bytes ByteCount, direction StreamDataDirection)
+	// StreamReset is called when a RESET_STREAM frame is sent or received.
+	// remote is true if the stream was reset by the peer.
+	StreamReset(id StreamID, errorCode ErrorCode, remote bool)
+	// StreamClosed is called when a stream has completed in both directions,
+	// i.e. all data was sent and received, or the stream was canceled or reset.
+	// sendFinalSize and receiveFinalSize are the final sizes of the two directions of the stream.
+	// For unidirectional streams, the final size of the direction not used is 0.
+	// It is not called for streams that are still open when the connection is closed.
+	StreamClosed(id StreamID, sendFinalSize, receiveFinalSize ByteCount)
+	// ClosedConnection is called when the session is closed.
+	// err is nil if the session was closed by calling Close.
+	ClosedConnection(err error)
+}
+
+// onPacketLost returns the callback used by the sent packet handler when a packet is declared lost.
+// It returns nil if neither the OnPacketLost hook, nor a tracer, nor a MetricsCollector is set.
+func (s *session) onPacketLost() func(protocol.PacketNumber, protocol.EncryptionLevel, ackhandler.PacketLossTrigger) {
+	hook := s.config.EventHooks.OnPacketLost
+	metrics := s.config.MetricsCollector
+	if hook == nil && s.tracer == nil && metrics == nil {
+		return nil
+	}
+	return func(pn protocol.PacketNumber, encLevel protocol.EncryptionLevel, trigger ackhandler.PacketLossTrigger) {
+		if hook != nil {
+			hook(pn, encLevel)
+		}
+		if s.tracer != nil {
+			s.tracer.LostPacket(encLevel, pn, trigger)
+		}
+		if metrics != nil {
+			metrics.LostPacket(encLevel)
+		}
+	}
+}
+
+func (s *session) traceSentPacket(packet *packedPacket) {
+	var ack *wire.AckFrame
+	frames := make([]wire.Frame, 0, len(packet.frames))
+	for _, f := range packet.frames {
+		if af, ok := f.(*wire.AckFrame); ok {
+			ack = af
+			continue
+		}
+		frames = append(frames, f)
+	}
+	s.tracer.SentPacket(packet.header, protocol.ByteCount(len(packet.raw)), ack, frames)
+	for _, f := range frames {
+		if sf, ok := f.(*wire.StreamFrame); ok {
+			s.streamEvents.SentStreamFrame(sf)
+		}
+	}
+}
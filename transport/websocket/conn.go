@@ -0,0 +1,121 @@
+package websocket
+
+import (
+	"crypto/tls"
+	"net"
+	"net/url"
+	"time"
+
+	"golang.org/x/net/websocket"
+)
+
+// addr is the address of a WebSocket connection.
+type addr string
+
+var _ net.Addr = addr("")
+
+func (a addr) Network() string { return "websocket" }
+func (a addr) String() string  { return string(a) }
+
+// A Conn is a net.PacketConn that sends QUIC packets to a single peer, over a WebSocket connection.
+// It is returned by Dialer.Dial, and can be passed to quic.Dial.
+type Conn struct {
+	ws *websocket.Conn
+
+	localAddr, remoteAddr net.Addr
+}
+
+var _ net.PacketConn = &Conn{}
+
+func newConn(ws *websocket.Conn, localAddr, remoteAddr net.Addr) *Conn {
+	ws.PayloadType = websocket.BinaryFrame
+	return &Conn{
+		ws:         ws,
+		localAddr:  localAddr,
+		remoteAddr: remoteAddr,
+	}
+}
+
+// ReadFrom reads the next packet sent by the peer.
+func (c *Conn) ReadFrom(b []byte) (int, net.Addr, error) {
+	n, err := readPacket(c.ws, b)
+	return n, c.remoteAddr, err
+}
+
+// WriteTo sends a packet to the peer.
+// Since a WebSocket connection only has a single peer, the address is ignored.
+func (c *Conn) WriteTo(b []byte, _ net.Addr) (int, error) {
+	if err := writePacket(c.ws, b); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// Close closes the WebSocket connection.
+func (c *Conn) Close() error {
+	return c.ws.Close()
+}
+
+// LocalAddr returns the local address.
+func (c *Conn) LocalAddr() net.Addr {
+	return c.localAddr
+}
+
+// RemoteAddr returns the address of the peer.
+// It can be used as the remote address passed to quic.Dial.
+func (c *Conn) RemoteAddr() net.Addr {
+	return c.remoteAddr
+}
+
+// SetDeadline sets the read and write deadlines of the underlying connection.
+func (c *Conn) SetDeadline(t time.Time) error {
+	return c.ws.SetDeadline(t)
+}
+
+// SetReadDeadline sets the read deadline of the underlying connection.
+func (c *Conn) SetReadDeadline(t time.Time) error {
+	return c.ws.SetReadDeadline(t)
+}
+
+// SetWriteDeadline sets the write deadline of the underlying connection.
+func (c *Conn) SetWriteDeadline(t time.Time) error {
+	return c.ws.SetWriteDeadline(t)
+}
+
+// A Dialer establishes WebSocket connections that QUIC packets can be sent on.
+type Dialer struct {
+	// Origin is the value of the Origin header.
+	// If empty, the origin is derived from the URL.
+	Origin string
+
+	// TLSConfig is the TLS configuration used for wss:// URLs.
+	// Note that this configures the TLS connection that the WebSocket runs on,
+	// not the TLS handshake of the QUIC connection.
+	TLSConfig *tls.Config
+}
+
+// Dial opens a WebSocket connection to the URL (using the ws:// or wss:// scheme).
+// The Listener serving the URL accepts the connection.
+func (d *Dialer) Dial(rawurl string) (*Conn, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, err
+	}
+	origin := d.Origin
+	if origin == "" {
+		origin = (&url.URL{Scheme: "http", Host: u.Host}).String()
+		if u.Scheme == "wss" {
+			origin = (&url.URL{Scheme: "https", Host: u.Host}).String()
+		}
+	}
+	config, err := websocket.NewConfig(rawurl, origin)
+	if err != nil {
+		return nil, err
+	}
+	config.TlsConfig = d.TLSConfig
+	ws, err := websocket.DialConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	return newConn(ws, addr(origin), addr(rawurl)), nil
+}
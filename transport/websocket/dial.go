@@ -0,0 +1,78 @@
+package websocket
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"time"
+
+	quic "github.com/lucas-clemente/quic-go"
+)
+
+// udpTimeout is the time that Dial waits for the QUIC handshake over UDP to complete,
+// before falling back to WebSocket.
+const udpTimeout = 500 * time.Millisecond
+
+// make it possible to mock dialing in the tests
+var (
+	quicDialAddrContext = quic.DialAddrContext
+	quicDialContext     = quic.DialContext
+	dialWebSocket       = func(d *Dialer, rawurl string) (net.PacketConn, net.Addr, error) {
+		conn, err := d.Dial(rawurl)
+		if err != nil {
+			return nil, nil, err
+		}
+		return conn, conn.RemoteAddr(), nil
+	}
+)
+
+// Dial establishes a new QUIC connection to a server.
+// It first tries to establish the connection using UDP.
+// If the handshake doesn't complete within 500ms, for example because UDP is blocked by a firewall,
+// it falls back to sending QUIC packets over a WebSocket connection to wsURL.
+// Any other error is returned without falling back.
+// The server needs to serve a Listener at wsURL.
+// The hostname for SNI is taken from addr.
+func Dial(addr, wsURL string, tlsConf *tls.Config, config *quic.Config) (quic.Session, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), udpTimeout)
+	sess, err := quicDialAddrContext(ctx, addr, tlsConf, config)
+	cancel()
+	if err == nil {
+		return sess, nil
+	}
+	// Only fall back to WebSocket if the handshake timed out.
+	// Other errors (e.g. a failed certificate verification) would occur when using WebSocket as well.
+	if !isTimeoutError(err) {
+		return nil, err
+	}
+
+	// The TLS connection that the WebSocket runs on uses different ALPN values than QUIC.
+	var wsTLSConf *tls.Config
+	if tlsConf != nil {
+		wsTLSConf = tlsConf.Clone()
+		wsTLSConf.NextProtos = nil
+	}
+	conn, remoteAddr, err := dialWebSocket(&Dialer{TLSConfig: wsTLSConf}, wsURL)
+	if err != nil {
+		return nil, err
+	}
+	sess, err = quicDialContext(context.Background(), conn, remoteAddr, addr, tlsConf, config)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	// quic.Dial doesn't close the packet conn when the session is closed
+	go func() {
+		<-sess.Context().Done()
+		conn.Close()
+	}()
+	return sess, nil
+}
+
+func isTimeoutError(err error) bool {
+	if err == context.DeadlineExceeded {
+		return true
+	}
+	nerr, ok := err.(net.Error)
+	return ok && nerr.Timeout()
+}
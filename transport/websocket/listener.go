@@ -0,0 +1,175 @@
+package websocket
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+	"golang.org/x/net/websocket"
+)
+
+var errListenerClosed = errors.New("websocket: listener closed")
+
+type receivedPacket struct {
+	data []byte
+	addr net.Addr
+}
+
+// A Listener is a net.PacketConn that receives QUIC packets on WebSocket connections.
+// It is an http.Handler, and needs to be served by an HTTP server.
+// It can be passed to quic.Listen.
+//
+// Every WebSocket connection is treated as a separate peer,
+// and is identified by the remote address of the underlying TCP connection.
+type Listener struct {
+	mutex        sync.Mutex
+	conns        map[string]*websocket.Conn
+	readDeadline time.Time
+
+	receivedPackets chan receivedPacket
+	closeOnce       sync.Once
+	closed          chan struct{}
+
+	server websocket.Server
+}
+
+var _ net.PacketConn = &Listener{}
+var _ http.Handler = &Listener{}
+
+// NewListener creates a new Listener.
+func NewListener() *Listener {
+	l := &Listener{
+		conns:           make(map[string]*websocket.Conn),
+		receivedPackets: make(chan receivedPacket, 64),
+		closed:          make(chan struct{}),
+	}
+	l.server = websocket.Server{
+		// QUIC clients are not browsers, and might not send an Origin header
+		Handshake: func(*websocket.Config, *http.Request) error { return nil },
+		Handler:   l.handleConn,
+	}
+	return l
+}
+
+// ServeHTTP upgrades the request to a WebSocket connection.
+func (l *Listener) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	select {
+	case <-l.closed:
+		http.Error(w, "listener closed", http.StatusServiceUnavailable)
+		return
+	default:
+	}
+	l.server.ServeHTTP(w, r)
+}
+
+// handleConn reads packets from a WebSocket connection, until the connection is closed.
+func (l *Listener) handleConn(ws *websocket.Conn) {
+	ws.PayloadType = websocket.BinaryFrame
+	remoteAddr := addr(ws.Request().RemoteAddr)
+	l.mutex.Lock()
+	l.conns[remoteAddr.String()] = ws
+	l.mutex.Unlock()
+
+	defer func() {
+		l.mutex.Lock()
+		delete(l.conns, remoteAddr.String())
+		l.mutex.Unlock()
+	}()
+
+	for {
+		b := make([]byte, protocol.MaxReceivePacketSize)
+		n, err := readPacket(ws, b)
+		if err != nil {
+			return
+		}
+		select {
+		case l.receivedPackets <- receivedPacket{data: b[:n], addr: remoteAddr}:
+		case <-l.closed:
+			return
+		}
+	}
+}
+
+// ReadFrom reads the next packet received on any of the WebSocket connections.
+func (l *Listener) ReadFrom(b []byte) (int, net.Addr, error) {
+	l.mutex.Lock()
+	deadline := l.readDeadline
+	l.mutex.Unlock()
+	var timeout <-chan time.Time
+	if !deadline.IsZero() {
+		timer := time.NewTimer(time.Until(deadline))
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	select {
+	case p := <-l.receivedPackets:
+		return copy(b, p.data), p.addr, nil
+	case <-timeout:
+		return 0, nil, &net.OpError{Op: "read", Net: "websocket", Addr: l.LocalAddr(), Err: errTimeout}
+	case <-l.closed:
+		return 0, nil, errListenerClosed
+	}
+}
+
+// WriteTo sends a packet on the WebSocket connection of the peer.
+func (l *Listener) WriteTo(b []byte, a net.Addr) (int, error) {
+	l.mutex.Lock()
+	ws, ok := l.conns[a.String()]
+	l.mutex.Unlock()
+	if !ok {
+		return 0, &net.OpError{Op: "write", Net: "websocket", Addr: a, Err: errors.New("unknown peer")}
+	}
+	if err := writePacket(ws, b); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// Close closes the listener, and all WebSocket connections.
+// It doesn't close the HTTP server.
+func (l *Listener) Close() error {
+	l.closeOnce.Do(func() {
+		close(l.closed)
+		l.mutex.Lock()
+		for _, ws := range l.conns {
+			ws.Close()
+		}
+		l.mutex.Unlock()
+	})
+	return nil
+}
+
+// LocalAddr returns the address of the listener.
+func (l *Listener) LocalAddr() net.Addr {
+	return addr("websocket")
+}
+
+// SetDeadline sets the read deadline. Write deadlines are not supported.
+func (l *Listener) SetDeadline(t time.Time) error {
+	return l.SetReadDeadline(t)
+}
+
+// SetReadDeadline sets the deadline for future ReadFrom calls.
+func (l *Listener) SetReadDeadline(t time.Time) error {
+	l.mutex.Lock()
+	l.readDeadline = t
+	l.mutex.Unlock()
+	return nil
+}
+
+// SetWriteDeadline is not supported, and is a no-op.
+func (l *Listener) SetWriteDeadline(time.Time) error {
+	return nil
+}
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+var errTimeout net.Error = timeoutError{}
@@ -0,0 +1,47 @@
+package websocket
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"io/ioutil"
+)
+
+// Every QUIC packet is prefixed with its length, encoded as a 2 byte big endian integer.
+const lengthPrefixLen = 2
+
+const maxPacketSize = 1<<(8*lengthPrefixLen) - 1
+
+var errPacketTooLarge = errors.New("websocket: packet too large")
+
+// writePacket writes a length-prefixed packet.
+// Each packet is sent in a single WebSocket frame.
+func writePacket(w io.Writer, p []byte) error {
+	if len(p) > maxPacketSize {
+		return errPacketTooLarge
+	}
+	b := make([]byte, lengthPrefixLen+len(p))
+	binary.BigEndian.PutUint16(b, uint16(len(p)))
+	copy(b[lengthPrefixLen:], p)
+	_, err := w.Write(b)
+	return err
+}
+
+// readPacket reads a length-prefixed packet into b.
+// Like for UDP, if b is too small to hold the packet, the rest of the packet is discarded.
+func readPacket(r io.Reader, b []byte) (int, error) {
+	var prefix [lengthPrefixLen]byte
+	if _, err := io.ReadFull(r, prefix[:]); err != nil {
+		return 0, err
+	}
+	l := int(binary.BigEndian.Uint16(prefix[:]))
+	if l <= len(b) {
+		return io.ReadFull(r, b[:l])
+	}
+	n, err := io.ReadFull(r, b)
+	if err != nil {
+		return n, err
+	}
+	_, err = io.CopyN(ioutil.Discard, r, int64(l-n))
+	return n, err
+}
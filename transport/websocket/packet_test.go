@@ -0,0 +1,54 @@
+package websocket
+
+import (
+	"bytes"
+	"io"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Packet framing", func() {
+	It("writes and reads packets", func() {
+		buf := &bytes.Buffer{}
+		Expect(writePacket(buf, []byte("foobar"))).To(Succeed())
+		Expect(writePacket(buf, []byte("lorem ipsum"))).To(Succeed())
+		Expect(buf.Bytes()[:2]).To(Equal([]byte{0, 6}))
+		b := make([]byte, 100)
+		n, err := readPacket(buf, b)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(b[:n]).To(Equal([]byte("foobar")))
+		n, err = readPacket(buf, b)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(b[:n]).To(Equal([]byte("lorem ipsum")))
+		_, err = readPacket(buf, b)
+		Expect(err).To(MatchError(io.EOF))
+	})
+
+	It("truncates packets that are larger than the buffer", func() {
+		buf := &bytes.Buffer{}
+		Expect(writePacket(buf, []byte("foobar"))).To(Succeed())
+		Expect(writePacket(buf, []byte("raboof"))).To(Succeed())
+		b := make([]byte, 3)
+		n, err := readPacket(buf, b)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(b[:n]).To(Equal([]byte("foo")))
+		n, err = readPacket(buf, b)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(b[:n]).To(Equal([]byte("rab")))
+	})
+
+	It("refuses to write packets that are too large for the length prefix", func() {
+		buf := &bytes.Buffer{}
+		Expect(writePacket(buf, make([]byte, 1<<16))).To(MatchError(errPacketTooLarge))
+		Expect(buf.Len()).To(BeZero())
+	})
+
+	It("errors on incomplete packets", func() {
+		buf := &bytes.Buffer{}
+		Expect(writePacket(buf, []byte("foobar"))).To(Succeed())
+		data := buf.Bytes()
+		_, err := readPacket(bytes.NewReader(data[:len(data)-1]), make([]byte, 100))
+		Expect(err).To(MatchError(io.ErrUnexpectedEOF))
+	})
+})
@@ -0,0 +1,25 @@
+package websocket
+
+import (
+	"testing"
+
+	"github.com/golang/mock/gomock"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestWebSocket(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "WebSocket Suite")
+}
+
+var mockCtrl *gomock.Controller
+
+var _ = BeforeEach(func() {
+	mockCtrl = gomock.NewController(GinkgoT())
+})
+
+var _ = AfterEach(func() {
+	mockCtrl.Finish()
+})
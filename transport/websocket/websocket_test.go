@@ -0,0 +1,230 @@
+package websocket
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	quic "github.com/lucas-clemente/quic-go"
+	mockquic "github.com/lucas-clemente/quic-go/internal/mocks/quic"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("WebSocket transport", func() {
+	var (
+		ln     *Listener
+		server *httptest.Server
+		wsURL  string
+	)
+
+	BeforeEach(func() {
+		ln = NewListener()
+		server = httptest.NewServer(ln)
+		wsURL = "ws://" + strings.TrimPrefix(server.URL, "http://")
+	})
+
+	AfterEach(func() {
+		ln.Close()
+		server.Close()
+	})
+
+	Context("sending packets", func() {
+		It("sends packets in both directions", func() {
+			conn, err := (&Dialer{}).Dial(wsURL)
+			Expect(err).ToNot(HaveOccurred())
+			defer conn.Close()
+			Expect(conn.RemoteAddr().String()).To(Equal(wsURL))
+			Expect(conn.RemoteAddr().Network()).To(Equal("websocket"))
+
+			_, err = conn.WriteTo([]byte("foobar"), conn.RemoteAddr())
+			Expect(err).ToNot(HaveOccurred())
+			b := make([]byte, 100)
+			n, addr, err := ln.ReadFrom(b)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(b[:n]).To(Equal([]byte("foobar")))
+
+			_, err = ln.WriteTo([]byte("raboof"), addr)
+			Expect(err).ToNot(HaveOccurred())
+			n, remoteAddr, err := conn.ReadFrom(b)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(b[:n]).To(Equal([]byte("raboof")))
+			Expect(remoteAddr).To(Equal(conn.RemoteAddr()))
+		})
+
+		It("distinguishes between different peers", func() {
+			conn1, err := (&Dialer{}).Dial(wsURL)
+			Expect(err).ToNot(HaveOccurred())
+			defer conn1.Close()
+			conn2, err := (&Dialer{}).Dial(wsURL)
+			Expect(err).ToNot(HaveOccurred())
+			defer conn2.Close()
+
+			_, err = conn1.WriteTo([]byte("conn1"), nil)
+			Expect(err).ToNot(HaveOccurred())
+			b := make([]byte, 100)
+			_, addr1, err := ln.ReadFrom(b)
+			Expect(err).ToNot(HaveOccurred())
+			_, err = conn2.WriteTo([]byte("conn2"), nil)
+			Expect(err).ToNot(HaveOccurred())
+			_, addr2, err := ln.ReadFrom(b)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(addr1).ToNot(Equal(addr2))
+
+			_, err = ln.WriteTo([]byte("to conn2"), addr2)
+			Expect(err).ToNot(HaveOccurred())
+			n, _, err := conn2.ReadFrom(b)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(b[:n]).To(Equal([]byte("to conn2")))
+		})
+
+		It("errors when writing to an unknown peer", func() {
+			_, err := ln.WriteTo([]byte("foobar"), addr("127.0.0.1:1234"))
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("unknown peer"))
+		})
+
+		It("times out reads", func() {
+			Expect(ln.SetReadDeadline(time.Now().Add(50 * time.Millisecond))).To(Succeed())
+			_, _, err := ln.ReadFrom(make([]byte, 100))
+			Expect(err).To(HaveOccurred())
+			Expect(err.(net.Error).Timeout()).To(BeTrue())
+		})
+
+		It("unblocks ReadFrom when the listener is closed", func() {
+			done := make(chan struct{})
+			go func() {
+				defer GinkgoRecover()
+				_, _, err := ln.ReadFrom(make([]byte, 100))
+				Expect(err).To(MatchError(errListenerClosed))
+				close(done)
+			}()
+			Consistently(done).ShouldNot(BeClosed())
+			Expect(ln.Close()).To(Succeed())
+			Eventually(done).Should(BeClosed())
+		})
+
+		It("closes the WebSocket connections when the listener is closed", func() {
+			conn, err := (&Dialer{}).Dial(wsURL)
+			Expect(err).ToNot(HaveOccurred())
+			defer conn.Close()
+			_, err = conn.WriteTo([]byte("foobar"), nil)
+			Expect(err).ToNot(HaveOccurred())
+			_, _, err = ln.ReadFrom(make([]byte, 100))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(ln.Close()).To(Succeed())
+			_, _, err = conn.ReadFrom(make([]byte, 100))
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Context("dialing", func() {
+		var (
+			origQuicDialAddrContext = quicDialAddrContext
+			origQuicDialContext     = quicDialContext
+			origDialWebSocket       = dialWebSocket
+		)
+
+		AfterEach(func() {
+			quicDialAddrContext = origQuicDialAddrContext
+			quicDialContext = origQuicDialContext
+			dialWebSocket = origDialWebSocket
+		})
+
+		It("uses UDP, if the handshake succeeds", func() {
+			sess := mockquic.NewMockSession(mockCtrl)
+			quicDialAddrContext = func(_ context.Context, addr string, _ *tls.Config, _ *quic.Config) (quic.Session, error) {
+				Expect(addr).To(Equal("localhost:443"))
+				return sess, nil
+			}
+			dialWebSocket = func(*Dialer, string) (net.PacketConn, net.Addr, error) {
+				Fail("didn't expect a WebSocket connection")
+				return nil, nil, nil
+			}
+			Expect(Dial("localhost:443", wsURL, nil, nil)).To(Equal(sess))
+		})
+
+		It("falls back to WebSocket, if the UDP handshake doesn't complete", func() {
+			start := time.Now()
+			quicDialAddrContext = func(ctx context.Context, _ string, _ *tls.Config, _ *quic.Config) (quic.Session, error) {
+				<-ctx.Done()
+				return nil, ctx.Err()
+			}
+			var usedConn net.PacketConn
+			sessCtx, cancel := context.WithCancel(context.Background())
+			sess := mockquic.NewMockSession(mockCtrl)
+			sess.EXPECT().Context().Return(sessCtx)
+			quicDialContext = func(_ context.Context, pconn net.PacketConn, remoteAddr net.Addr, host string, tlsConf *tls.Config, _ *quic.Config) (quic.Session, error) {
+				Expect(time.Since(start)).To(BeNumerically(">=", udpTimeout))
+				Expect(remoteAddr.String()).To(Equal(wsURL))
+				Expect(host).To(Equal("localhost:443"))
+				Expect(tlsConf.NextProtos).To(Equal([]string{"quic"}))
+				usedConn = pconn
+				return sess, nil
+			}
+			Expect(Dial("localhost:443", wsURL, &tls.Config{NextProtos: []string{"quic"}}, nil)).To(Equal(sess))
+			Expect(usedConn).To(BeAssignableToTypeOf(&Conn{}))
+			// the WebSocket connection is closed when the session is closed
+			cancel()
+			Eventually(func() error {
+				_, err := usedConn.WriteTo([]byte("foobar"), nil)
+				return err
+			}).Should(HaveOccurred())
+		})
+
+		It("falls back to WebSocket, if the UDP handshake times out", func() {
+			quicDialAddrContext = func(context.Context, string, *tls.Config, *quic.Config) (quic.Session, error) {
+				return nil, &net.OpError{Op: "read", Err: errTimeout}
+			}
+			var usedConn net.PacketConn
+			sessCtx, cancel := context.WithCancel(context.Background())
+			sess := mockquic.NewMockSession(mockCtrl)
+			sess.EXPECT().Context().Return(sessCtx)
+			quicDialContext = func(_ context.Context, pconn net.PacketConn, _ net.Addr, _ string, _ *tls.Config, _ *quic.Config) (quic.Session, error) {
+				usedConn = pconn
+				return sess, nil
+			}
+			Expect(Dial("localhost:443", wsURL, nil, nil)).To(Equal(sess))
+			Expect(usedConn).To(BeAssignableToTypeOf(&Conn{}))
+			cancel()
+			Eventually(func() error {
+				_, err := usedConn.WriteTo([]byte("foobar"), nil)
+				return err
+			}).Should(HaveOccurred())
+		})
+
+		It("doesn't fall back to WebSocket, if the UDP handshake fails", func() {
+			testErr := errors.New("handshake failed")
+			quicDialAddrContext = func(context.Context, string, *tls.Config, *quic.Config) (quic.Session, error) {
+				return nil, testErr
+			}
+			dialWebSocket = func(*Dialer, string) (net.PacketConn, net.Addr, error) {
+				Fail("didn't expect a WebSocket connection")
+				return nil, nil, nil
+			}
+			_, err := Dial("localhost:443", wsURL, nil, nil)
+			Expect(err).To(MatchError(testErr))
+		})
+
+		It("closes the WebSocket connection if the QUIC handshake fails", func() {
+			testErr := errors.New("handshake failed")
+			quicDialAddrContext = func(context.Context, string, *tls.Config, *quic.Config) (quic.Session, error) {
+				return nil, context.DeadlineExceeded
+			}
+			var usedConn net.PacketConn
+			quicDialContext = func(_ context.Context, pconn net.PacketConn, _ net.Addr, _ string, _ *tls.Config, _ *quic.Config) (quic.Session, error) {
+				usedConn = pconn
+				return nil, testErr
+			}
+			_, err := Dial("localhost:443", wsURL, nil, nil)
+			Expect(err).To(MatchError(testErr))
+			_, err = usedConn.WriteTo([]byte("foobar"), nil)
+			Expect(err).To(HaveOccurred())
+		})
+	})
+})
@@ -0,0 +1,79 @@
+package quic
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"syscall"
+
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+	"github.com/lucas-clemente/quic-go/internal/utils"
+)
+
+var udpBufferSizeWarningOnce sync.Once
+
+type udpBufferSetter interface {
+	SetReadBuffer(int) error
+	SetWriteBuffer(int) error
+}
+
+// SetUDPBufferSizes attempts to set the receive and send buffer sizes (SO_RCVBUF and SO_SNDBUF) of conn to size bytes.
+// It returns the effective buffer sizes, as reported by the kernel.
+// These may be smaller than the requested size, for example if the process is not allowed to exceed the system-wide limit.
+// On Linux, the kernel reports double the requested size, since it reserves space for bookkeeping overhead.
+// The PacketConn must be a *net.UDPConn, or implement SetReadBuffer, SetWriteBuffer and syscall.Conn.
+func SetUDPBufferSizes(conn net.PacketConn, size int) (receive, send int, err error) {
+	c, ok := conn.(udpBufferSetter)
+	if !ok {
+		return 0, 0, errors.New("quic: setting the buffer size not supported on this connection")
+	}
+	if err := c.SetReadBuffer(size); err != nil {
+		return 0, 0, err
+	}
+	if err := c.SetWriteBuffer(size); err != nil {
+		return 0, 0, err
+	}
+	return getUDPBufferSizes(conn)
+}
+
+// setUDPBufferSizes sets the buffer sizes on a packet conn created by quic-go.
+// If the effective size is smaller than the target, it logs a warning (once per process).
+func setUDPBufferSizes(conn net.PacketConn, size int, logger utils.Logger) {
+	receive, send, err := SetUDPBufferSizes(conn, size)
+	if err != nil {
+		logger.Debugf("Failed to set UDP buffer sizes: %s", err)
+		return
+	}
+	if receive < size || send < size {
+		udpBufferSizeWarningOnce.Do(func() {
+			logger.Errorf("Failed to increase UDP buffer sizes: target: %d bytes, receive buffer: %d bytes, send buffer: %d bytes. This may lead to packet loss at high bandwidths.", size, receive, send)
+		})
+		return
+	}
+	logger.Debugf("Set UDP buffer sizes. Receive buffer: %d bytes, send buffer: %d bytes.", receive, send)
+}
+
+func getUDPBufferSizes(conn net.PacketConn) (receive, send int, err error) {
+	c, ok := conn.(syscall.Conn)
+	if !ok {
+		return 0, 0, errors.New("quic: reading the buffer size not supported on this connection")
+	}
+	rawConn, err := c.SyscallConn()
+	if err != nil {
+		return 0, 0, err
+	}
+	var serr error
+	if err := rawConn.Control(func(fd uintptr) {
+		receive, send, serr = getSocketBufferSizes(fd)
+	}); err != nil {
+		return 0, 0, err
+	}
+	return receive, send, serr
+}
+
+func udpBufferSize(config *Config) int {
+	if config.UDPReceiveBufferSize > 0 {
+		return config.UDPReceiveBufferSize
+	}
+	return protocol.DefaultUDPBufferSize
+}
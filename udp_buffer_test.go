@@ -0,0 +1,56 @@
+package quic
+
+import (
+	"net"
+
+	"github.com/lucas-clemente/quic-go/internal/ackhandler"
+	"github.com/lucas-clemente/quic-go/internal/congestion"
+	"github.com/lucas-clemente/quic-go/internal/utils"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("UDP buffer sizes", func() {
+	newSentPacketHandler := func() ackhandler.SentPacketHandler {
+		return ackhandler.NewSentPacketHandler(0, &congestion.RTTStats{}, nil, nil, nil, utils.DefaultLogger)
+	}
+
+	It("sets the buffer sizes", func() {
+		conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 0})
+		Expect(err).ToNot(HaveOccurred())
+		defer conn.Close()
+		origReceive, origSend, err := getUDPBufferSizes(conn)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(origReceive).ToNot(BeZero())
+		Expect(origSend).ToNot(BeZero())
+		// setting the buffer size to a small value should always succeed
+		receive, send, err := SetUDPBufferSizes(conn, 4096)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(receive).To(BeNumerically(">=", 4096))
+		Expect(receive).To(BeNumerically("<", origReceive))
+		Expect(send).To(BeNumerically(">=", 4096))
+	})
+
+	It("errors if the conn doesn't allow setting the buffer sizes", func() {
+		_, _, err := SetUDPBufferSizes(newMockPacketConn(), 4096)
+		Expect(err).To(MatchError("quic: setting the buffer size not supported on this connection"))
+	})
+
+	It("reports the buffer sizes in the connection stats", func() {
+		udpConn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 0})
+		Expect(err).ToNot(HaveOccurred())
+		defer udpConn.Close()
+		receive, send, err := SetUDPBufferSizes(udpConn, 8192)
+		Expect(err).ToNot(HaveOccurred())
+		sess := &session{conn: &conn{pconn: udpConn}, sentPacketHandler: newSentPacketHandler()}
+		stats := sess.ConnectionStats()
+		Expect(stats.UDPReceiveBufferSize).To(Equal(receive))
+		Expect(stats.UDPSendBufferSize).To(Equal(send))
+	})
+
+	It("doesn't report buffer sizes if the connection is not a UDP conn", func() {
+		sess := &session{conn: newMockConnection(), sentPacketHandler: newSentPacketHandler()}
+		Expect(sess.ConnectionStats()).To(Equal(ConnectionStats{}))
+	})
+})
@@ -0,0 +1,17 @@
+// +build windows
+
+package quic
+
+import "syscall"
+
+func getSocketBufferSizes(fd uintptr) (receive, send int, err error) {
+	receive, err = syscall.GetsockoptInt(syscall.Handle(fd), syscall.SOL_SOCKET, syscall.SO_RCVBUF)
+	if err != nil {
+		return 0, 0, err
+	}
+	send, err = syscall.GetsockoptInt(syscall.Handle(fd), syscall.SOL_SOCKET, syscall.SO_SNDBUF)
+	if err != nil {
+		return 0, 0, err
+	}
+	return receive, send, nil
+}